@@ -0,0 +1,325 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package alarms evaluates thresholds on OpenConfig leaves as they are streamed, so that basic alerting
+can be done at the edge for devices which have no alarms of their own. Alarms are declared in an
+Alarms proto (see proto/alarms.proto). Raised alarms are reported as entries of the OpenConfig alarms
+list, /system/alarms/alarm[id=...], and cleared alarms as deletes of their entries, so that clients
+subscribed to a target see its alarms as they would a native device's.
+*/
+package alarms
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/sink"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// alarmTypes is the module defining the identities of alarm severities.
+const alarmTypes = "openconfig-alarm-types"
+
+type alarm struct {
+	*pb.Alarm
+	path *gpb.Path
+}
+
+/*
+Monitor is a Sink which evaluates alarms on the updates sent through it. Notifications are passed on
+to the underlying sink unchanged; whenever alarms are raised or cleared, a further notification with
+the same target and timestamp reports them.
+*/
+type Monitor struct {
+	sink   sink.Sink
+	alarms map[string][]alarm // Watched path, without keys -> alarms.
+
+	mu     sync.Mutex
+	active map[string]map[string]string // Target -> alarm entry ID -> the leaf which raised it.
+}
+
+var _ sink.Sink = (*Monitor)(nil)
+
+// NewMonitor returns a monitor of the given alarms, which sends notifications on to the given sink.
+func NewMonitor(alarms *pb.Alarms, s sink.Sink) (*Monitor, error) {
+	m := &Monitor{
+		sink:   s,
+		alarms: map[string][]alarm{},
+		active: map[string]map[string]string{},
+	}
+	ids := map[string]bool{}
+	for _, a := range alarms.GetAlarms() {
+		if err := validate(a); err != nil {
+			return nil, fmt.Errorf("invalid alarm %q: %v", a.GetId(), err)
+		}
+		if ids[a.GetId()] {
+			return nil, fmt.Errorf("alarm %q is declared more than once", a.GetId())
+		}
+		ids[a.GetId()] = true
+		path, err := gnmiserver.StringToPath(a.GetPath())
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of alarm %q: %v", a.GetId(), err)
+		}
+		schemaPath := schemaPath(path)
+		m.alarms[schemaPath] = append(m.alarms[schemaPath], alarm{Alarm: a, path: path})
+	}
+	return m, nil
+}
+
+func validate(a *pb.Alarm) error {
+	switch {
+	case a.GetId() == "":
+		return fmt.Errorf("alarm has no ID")
+	case a.GetPath() == "":
+		return fmt.Errorf("alarm has no path")
+	case a.GetValue() != "" && a.GetComparison() != pb.Alarm_EQUAL && a.GetComparison() != pb.Alarm_NOT_EQUAL:
+		return fmt.Errorf("values can only be compared with EQUAL or NOT_EQUAL, got %v", a.GetComparison())
+	case a.GetHysteresis() < 0:
+		return fmt.Errorf("hysteresis must not be negative, got %v", a.GetHysteresis())
+	}
+	return nil
+}
+
+// schemaPath returns the string form of a path without its keys.
+func schemaPath(path *gpb.Path) string {
+	var b strings.Builder
+	for _, elem := range path.GetElem() {
+		b.WriteString("/")
+		b.WriteString(elem.GetName())
+	}
+	return b.String()
+}
+
+// Send implements sink.Sink.
+func (m *Monitor) Send(ctx context.Context, notification *gpb.Notification) error {
+	if err := m.sink.Send(ctx, notification); err != nil {
+		return err
+	}
+	if alarms := m.Alarms(notification); alarms != nil {
+		return m.sink.Send(ctx, alarms)
+	}
+	return nil
+}
+
+// Close closes the underlying sink.
+func (m *Monitor) Close() error {
+	return m.sink.Close()
+}
+
+/*
+Alarms evaluates alarms on the updates and deletes of a notification, returning a notification which
+raises and clears alarms accordingly, or nil if no alarm was raised or cleared. Deleting a leaf clears
+its alarms.
+*/
+func (m *Monitor) Alarms(notification *gpb.Notification) *gpb.Notification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	target := notification.GetPrefix().GetTarget()
+	active := m.active[target]
+	if active == nil {
+		active = map[string]string{}
+		m.active[target] = active
+	}
+	prefix := notification.GetPrefix().GetElem()
+	alarms := &gpb.Notification{
+		Timestamp: notification.GetTimestamp(),
+		Prefix:    &gpb.Path{Target: target},
+	}
+	for _, del := range notification.GetDelete() {
+		deleted := gnmiserver.PathToString(&gpb.Path{Elem: append(append([]*gpb.PathElem{}, prefix...), del.GetElem()...)})
+		deleted = strings.TrimSuffix(deleted, "/")
+		var cleared []string
+		for id, leaf := range active {
+			if leaf == deleted || strings.HasPrefix(leaf, deleted+"/") {
+				cleared = append(cleared, id)
+			}
+		}
+		sort.Strings(cleared)
+		for _, id := range cleared {
+			delete(active, id)
+			alarms.Delete = append(alarms.Delete, entryPath(id))
+		}
+	}
+	for _, update := range notification.GetUpdate() {
+		path := &gpb.Path{Elem: append(append([]*gpb.PathElem{}, prefix...), update.GetPath().GetElem()...)}
+		for _, a := range m.alarms[schemaPath(path)] {
+			if !matches(a.path, path) {
+				continue
+			}
+			id := entryID(a.GetId(), path)
+			_, raised := active[id]
+			switch {
+			case !raised && a.raises(update.GetVal()):
+				leaf := gnmiserver.PathToString(path)
+				active[id] = leaf
+				alarms.Update = append(alarms.Update, entry(a, id, leaf, update.GetVal(), notification.GetTimestamp())...)
+			case raised && a.clears(update.GetVal()):
+				delete(active, id)
+				alarms.Delete = append(alarms.Delete, entryPath(id))
+			}
+		}
+	}
+	if len(alarms.Update) == 0 && len(alarms.Delete) == 0 {
+		return nil
+	}
+	return alarms
+}
+
+// Active returns the IDs of the alarm entries currently raised for a target, sorted.
+func (m *Monitor) Active(target string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id := range m.active[target] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// matches returns whether a leaf matches a watched path, ie: has the same keys where any are given.
+func matches(watched, leaf *gpb.Path) bool {
+	for i, elem := range watched.GetElem() {
+		for key, value := range elem.GetKey() {
+			if leaf.GetElem()[i].GetKey()[key] != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/*
+entryID returns the ID of the alarm entry raised by an alarm for a leaf: the alarm's ID, followed by
+the leaf's key values if it has any, eg: "cpu-high:cpu0".
+*/
+func entryID(id string, leaf *gpb.Path) string {
+	var values []string
+	for _, elem := range leaf.GetElem() {
+		keys := make([]string, 0, len(elem.GetKey()))
+		for key := range elem.GetKey() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			values = append(values, elem.GetKey()[key])
+		}
+	}
+	if len(values) == 0 {
+		return id
+	}
+	return id + ":" + strings.Join(values, ",")
+}
+
+func entryPath(id string) *gpb.Path {
+	return &gpb.Path{Elem: []*gpb.PathElem{
+		{Name: "system"},
+		{Name: "alarms"},
+		{Name: "alarm", Key: map[string]string{"id": id}},
+	}}
+}
+
+// entry returns the updates describing a raised alarm entry, following the openconfig-alarms model.
+func entry(a alarm, id, leaf string, value *gpb.TypedValue, timestamp int64) []*gpb.Update {
+	text := strings.Replace(a.GetText(), "{value}", valueString(value), -1)
+	leaves := []struct {
+		name  string
+		value *gpb.TypedValue
+	}{
+		{"id", stringVal(id)},
+		{"resource", stringVal(leaf)},
+		{"text", stringVal(text)},
+		{"time-created", &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: uint64(timestamp)}}},
+		{"severity", stringVal(alarmTypes + ":" + a.GetSeverity().String())},
+		{"type-id", stringVal(a.GetId())},
+	}
+	var updates []*gpb.Update
+	for _, l := range leaves {
+		path := entryPath(id)
+		path.Elem = append(path.Elem, &gpb.PathElem{Name: "state"}, &gpb.PathElem{Name: l.name})
+		updates = append(updates, &gpb.Update{Path: path, Val: l.value})
+	}
+	return updates
+}
+
+func stringVal(s string) *gpb.TypedValue {
+	return &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: s}}
+}
+
+// valueString formats a value for an alarm's text.
+func valueString(value *gpb.TypedValue) string {
+	if f, ok := gnmiserver.Float(value); ok {
+		return fmt.Sprint(f)
+	}
+	if s, ok := value.GetValue().(*gpb.TypedValue_StringVal); ok {
+		return s.StringVal
+	}
+	return fmt.Sprint(value.GetValue())
+}
+
+// raises returns whether a value raises the alarm.
+func (a alarm) raises(value *gpb.TypedValue) bool {
+	return a.compare(value, a.GetThreshold())
+}
+
+// clears returns whether a value clears the alarm, once raised, allowing for hysteresis.
+func (a alarm) clears(value *gpb.TypedValue) bool {
+	threshold := a.GetThreshold()
+	switch a.GetComparison() {
+	case pb.Alarm_GREATER, pb.Alarm_GREATER_OR_EQUAL:
+		threshold -= a.GetHysteresis()
+	case pb.Alarm_LESS, pb.Alarm_LESS_OR_EQUAL:
+		threshold += a.GetHysteresis()
+	}
+	return !a.compare(value, threshold)
+}
+
+// compare compares a value with a threshold (or the alarm's string value, if it has one).
+func (a alarm) compare(value *gpb.TypedValue, threshold float64) bool {
+	if a.GetValue() != "" {
+		equal := valueString(value) == a.GetValue()
+		if a.GetComparison() == pb.Alarm_NOT_EQUAL {
+			return !equal
+		}
+		return equal
+	}
+	x, ok := gnmiserver.Float(value)
+	if !ok {
+		return false
+	}
+	switch a.GetComparison() {
+	case pb.Alarm_GREATER:
+		return x > threshold
+	case pb.Alarm_GREATER_OR_EQUAL:
+		return x >= threshold
+	case pb.Alarm_LESS:
+		return x < threshold
+	case pb.Alarm_LESS_OR_EQUAL:
+		return x <= threshold
+	case pb.Alarm_EQUAL:
+		return x == threshold
+	case pb.Alarm_NOT_EQUAL:
+		return x != threshold
+	}
+	return false
+}
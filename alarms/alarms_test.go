@@ -0,0 +1,224 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alarms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// recordingSink records the notifications sent to it.
+type recordingSink struct {
+	notifications []*gpb.Notification
+}
+
+func (s *recordingSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	s.notifications = append(s.notifications, notification)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func makeMonitor(t *testing.T, s *recordingSink) *Monitor {
+	t.Helper()
+	alarms, err := utils.LoadAlarms("../testdata/alarms_test.pb")
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	alarms.Alarms = append(alarms.Alarms, &pb.Alarm{
+		Id:         "eth0-errors",
+		Path:       "/interfaces/interface[name=eth0]/state/counters/in-errors",
+		Comparison: pb.Alarm_GREATER_OR_EQUAL,
+		Threshold:  10,
+	})
+	m, err := NewMonitor(alarms, s)
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	return m
+}
+
+func notification(t *testing.T, values map[string]interface{}, deletes ...string) *gpb.Notification {
+	t.Helper()
+	n := &gpb.Notification{Timestamp: 42, Prefix: &gpb.Path{Target: "switch1"}}
+	for leaf, value := range values {
+		update, err := gnmiserver.Update(leaf, value)
+		if err != nil {
+			t.Fatalf("Could not set up test: %v", err)
+		}
+		n.Update = append(n.Update, update)
+	}
+	for _, leaf := range deletes {
+		path, err := gnmiserver.StringToPath(leaf)
+		if err != nil {
+			t.Fatalf("Could not set up test: %v", err)
+		}
+		n.Delete = append(n.Delete, path)
+	}
+	return n
+}
+
+func TestMonitor(t *testing.T) {
+	const (
+		cpu0   = "/components/component[name=cpu0]/cpu/utilization/state/instant"
+		cpu1   = "/components/component[name=cpu1]/cpu/utilization/state/instant"
+		status = "/interfaces/interface[name=eth0]/state/oper-status"
+		eth0   = "/interfaces/interface[name=eth0]/state/counters/in-errors"
+		eth1   = "/interfaces/interface[name=eth1]/state/counters/in-errors"
+	)
+	m := makeMonitor(t, &recordingSink{})
+	for _, test := range []struct {
+		name     string
+		values   map[string]interface{}
+		deletes  []string
+		raised   []string
+		cleared  []string
+		expected []string // Active alarm entries afterwards.
+	}{
+		{
+			name:   "values within thresholds",
+			values: map[string]interface{}{cpu0: 50.0, cpu1: 90.0, status: "UP", eth0: 9.0},
+		},
+		{
+			name:     "thresholds crossed",
+			values:   map[string]interface{}{cpu0: 95.0, status: "DOWN", eth0: 10.0, eth1: 100.0},
+			raised:   []string{"cpu-high:cpu0", "link-down:eth0", "eth0-errors:eth0"},
+			expected: []string{"cpu-high:cpu0", "eth0-errors:eth0", "link-down:eth0"},
+		},
+		{
+			name:     "raised alarms are not raised again",
+			values:   map[string]interface{}{cpu0: 99.0},
+			expected: []string{"cpu-high:cpu0", "eth0-errors:eth0", "link-down:eth0"},
+		},
+		{
+			name:     "hysteresis holds alarms",
+			values:   map[string]interface{}{cpu0: 86.0, status: "UP"},
+			cleared:  []string{"link-down:eth0"},
+			expected: []string{"cpu-high:cpu0", "eth0-errors:eth0"},
+		},
+		{
+			name:     "alarms clear past the hysteresis",
+			values:   map[string]interface{}{cpu0: 85.0},
+			cleared:  []string{"cpu-high:cpu0"},
+			expected: []string{"eth0-errors:eth0"},
+		},
+		{
+			name:    "deletes clear alarms",
+			deletes: []string{"/interfaces/interface[name=eth0]"},
+			cleared: []string{"eth0-errors:eth0"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			alarms := m.Alarms(notification(t, test.values, test.deletes...))
+			var raised, cleared []string
+			for _, update := range alarms.GetUpdate() {
+				if update.GetPath().GetElem()[4].GetName() == "id" {
+					raised = append(raised, update.GetVal().GetStringVal())
+				}
+			}
+			for _, del := range alarms.GetDelete() {
+				cleared = append(cleared, del.GetElem()[2].GetKey()["id"])
+			}
+			if !cmp.Equal(raised, test.raised, cmpSorted) {
+				t.Errorf("Alarms() raised %v, expected %v", raised, test.raised)
+			}
+			if !cmp.Equal(cleared, test.cleared) {
+				t.Errorf("Alarms() cleared %v, expected %v", cleared, test.cleared)
+			}
+			if got := m.Active("switch1"); !cmp.Equal(got, test.expected) {
+				t.Errorf("Active() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+var cmpSorted = cmp.Transformer("sort", func(in []string) map[string]bool {
+	out := map[string]bool{}
+	for _, s := range in {
+		out[s] = true
+	}
+	return out
+})
+
+func TestMonitorSend(t *testing.T) {
+	s := &recordingSink{}
+	m := makeMonitor(t, s)
+	n := notification(t, map[string]interface{}{"/components/component[name=cpu0]/cpu/utilization/state/instant": 95.0})
+	if err := m.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send() got error: %v", err)
+	}
+	if len(s.notifications) != 2 || s.notifications[0] != n {
+		t.Fatalf("Send() sent %v, expected the notification followed by its alarms", s.notifications)
+	}
+	entry := func(leaf string, value *gpb.TypedValue) *gpb.Update {
+		path := entryPath("cpu-high:cpu0")
+		path.Elem = append(path.Elem, &gpb.PathElem{Name: "state"}, &gpb.PathElem{Name: leaf})
+		return &gpb.Update{Path: path, Val: value}
+	}
+	expected := &gpb.Notification{
+		Timestamp: 42,
+		Prefix:    &gpb.Path{Target: "switch1"},
+		Update: []*gpb.Update{
+			entry("id", stringVal("cpu-high:cpu0")),
+			entry("resource", stringVal("/components/component[name=cpu0]/cpu/utilization/state/instant")),
+			entry("text", stringVal("CPU utilization is 95%")),
+			entry("time-created", &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: 42}}),
+			entry("severity", stringVal("openconfig-alarm-types:MAJOR")),
+			entry("type-id", stringVal("cpu-high")),
+		},
+	}
+	if !proto.Equal(s.notifications[1], expected) {
+		t.Errorf("Send() sent alarms %v, expected %v", s.notifications[1], expected)
+	}
+
+	if err := m.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send() got error: %v", err)
+	}
+	if len(s.notifications) != 3 {
+		t.Errorf("Send() of unchanged alarms sent %d notifications, expected 1", len(s.notifications)-2)
+	}
+}
+
+func TestNewMonitorErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		alarms []*pb.Alarm
+	}{
+		{name: "no ID", alarms: []*pb.Alarm{{Path: "/a"}}},
+		{name: "no path", alarms: []*pb.Alarm{{Id: "a"}}},
+		{name: "value with ordering", alarms: []*pb.Alarm{{Id: "a", Path: "/a", Value: "DOWN", Comparison: pb.Alarm_LESS}}},
+		{name: "negative hysteresis", alarms: []*pb.Alarm{{Id: "a", Path: "/a", Hysteresis: -1}}},
+		{name: "duplicate ID", alarms: []*pb.Alarm{{Id: "a", Path: "/a"}, {Id: "a", Path: "/b"}}},
+		{name: "invalid path", alarms: []*pb.Alarm{{Id: "a", Path: "/a[name=b"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewMonitor(&pb.Alarms{Alarms: test.alarms}, &recordingSink{}); err == nil {
+				t.Errorf("NewMonitor() expected error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package capabilities caches what was learned by probing targets, eg: their vendor and model (from
+sysObjectID) and the OIDs they turned out not to support, so that collectors need not re-probe every
+device when they restart. Caches may be shared between Orismologer instances (see FileCache and
+RedisCache), so that horizontally scaled collectors probe each device once between them.
+*/
+package capabilities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/orismologer/store"
+)
+
+// Capabilities are the results of probing a target.
+type Capabilities struct {
+	Target string `json:"target"`
+	Vendor string `json:"vendor"`
+	// Model is the hardware model of the target, as named in VendorOids, if known.
+	Model       string `json:"model,omitempty"`
+	SysObjectID string `json:"sys_object_id,omitempty"`
+	// Unsupported lists OIDs (or OID prefixes) the target was found not to support.
+	Unsupported []string `json:"unsupported,omitempty"`
+	// Discovered is when the target was probed.
+	Discovered time.Time `json:"discovered"`
+}
+
+// Cache stores the capabilities of targets.
+type Cache interface {
+	// Get returns the capabilities of a target, or false if they are not cached (or have expired).
+	Get(ctx context.Context, target string) (*Capabilities, bool, error)
+	Put(ctx context.Context, capabilities *Capabilities) error
+	// Delete removes a target's capabilities, eg: after its software is upgraded.
+	Delete(ctx context.Context, target string) error
+}
+
+// Probe discovers the capabilities of a target.
+type Probe func(ctx context.Context, target string) (*Capabilities, error)
+
+/*
+Lookup returns the capabilities of a target from the cache, probing the target (and caching the
+result) if they are not cached. Failures to read or write the cache are returned, since they would
+otherwise silently cause every instance to re-probe.
+*/
+func Lookup(ctx context.Context, cache Cache, target string, probe Probe) (*Capabilities, error) {
+	if c, ok, err := cache.Get(ctx, target); err != nil || ok {
+		return c, err
+	}
+	c, err := probe(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("could not probe target %q: %v", target, err)
+	}
+	c.Target = target
+	if c.Discovered.IsZero() {
+		c.Discovered = time.Now()
+	}
+	if err := cache.Put(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/*
+FileCache keeps capabilities in a directory, as one JSON file per target. Files are replaced
+atomically, so the directory may be shared (eg: over NFS) by instances on several hosts. Entries
+older than TTL are ignored; a zero TTL means entries never expire.
+*/
+type FileCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+var _ Cache = (*FileCache)(nil)
+
+func (f *FileCache) file(target string) string {
+	// Escaping keeps target names from reaching outside the directory.
+	return filepath.Join(f.Dir, url.PathEscape(target)+".json")
+}
+
+// Get implements Cache.
+func (f *FileCache) Get(ctx context.Context, target string) (*Capabilities, bool, error) {
+	b, err := ioutil.ReadFile(f.file(target))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read capabilities of %q: %v", target, err)
+	}
+	return decode(target, b, f.TTL)
+}
+
+// Put implements Cache.
+func (f *FileCache) Put(ctx context.Context, capabilities *Capabilities) error {
+	b, err := json.Marshal(capabilities)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.Dir, ".capabilities")
+	if err != nil {
+		return fmt.Errorf("could not write capabilities of %q: %v", capabilities.Target, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write capabilities of %q: %v", capabilities.Target, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write capabilities of %q: %v", capabilities.Target, err)
+	}
+	if err := os.Rename(tmp.Name(), f.file(capabilities.Target)); err != nil {
+		return fmt.Errorf("could not write capabilities of %q: %v", capabilities.Target, err)
+	}
+	return nil
+}
+
+// Delete implements Cache.
+func (f *FileCache) Delete(ctx context.Context, target string) error {
+	if err := os.Remove(f.file(target)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete capabilities of %q: %v", target, err)
+	}
+	return nil
+}
+
+/*
+RedisClient is the subset of a Redis client used by RedisCache. It is easily implemented by wrapping
+a client library, eg: github.com/go-redis/redis's Client.
+*/
+type RedisClient interface {
+	// Get returns the value of a key, or false if the key does not exist.
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Set sets the value of a key, which expires after ttl (or never, if ttl is zero).
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+}
+
+/*
+RedisCache keeps capabilities in Redis, as JSON values under keys made of Prefix and the target's
+name. Entries expire after TTL, using Redis' own expiry; a zero TTL means entries never expire.
+*/
+type RedisCache struct {
+	Client RedisClient
+	Prefix string
+	TTL    time.Duration
+}
+
+var _ Cache = (*RedisCache)(nil)
+
+// Get implements Cache.
+func (r *RedisCache) Get(ctx context.Context, target string) (*Capabilities, bool, error) {
+	value, ok, err := r.Client.Get(ctx, r.Prefix+target)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not get capabilities of %q from Redis: %v", target, err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	return decode(target, []byte(value), 0)
+}
+
+// Put implements Cache.
+func (r *RedisCache) Put(ctx context.Context, capabilities *Capabilities) error {
+	b, err := json.Marshal(capabilities)
+	if err != nil {
+		return err
+	}
+	if err := r.Client.Set(ctx, r.Prefix+capabilities.Target, string(b), r.TTL); err != nil {
+		return fmt.Errorf("could not put capabilities of %q in Redis: %v", capabilities.Target, err)
+	}
+	return nil
+}
+
+// Delete implements Cache.
+func (r *RedisCache) Delete(ctx context.Context, target string) error {
+	if err := r.Client.Del(ctx, r.Prefix+target); err != nil {
+		return fmt.Errorf("could not delete capabilities of %q from Redis: %v", target, err)
+	}
+	return nil
+}
+
+/*
+StoreCache keeps capabilities in a bucket of a store.Store, eg: the on-disk store of a single
+instance, for continuity across its restarts.
+*/
+type StoreCache struct {
+	cache *store.Cache
+}
+
+var _ Cache = (*StoreCache)(nil)
+
+// NewStoreCache returns a cache of capabilities in store.CapabilityBucket, expiring after ttl.
+func NewStoreCache(s store.Store, ttl time.Duration) *StoreCache {
+	return &StoreCache{cache: store.NewCache(s, store.CapabilityBucket, ttl)}
+}
+
+// Get implements Cache.
+func (s *StoreCache) Get(ctx context.Context, target string) (*Capabilities, bool, error) {
+	c := &Capabilities{}
+	ok, err := s.cache.Get(target, c)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return c, true, nil
+}
+
+// Put implements Cache.
+func (s *StoreCache) Put(ctx context.Context, capabilities *Capabilities) error {
+	return s.cache.Put(capabilities.Target, capabilities)
+}
+
+// Delete implements Cache.
+func (s *StoreCache) Delete(ctx context.Context, target string) error {
+	return s.cache.Delete(target)
+}
+
+// decode decodes cached capabilities, treating them as absent if they are older than ttl.
+func decode(target string, b []byte, ttl time.Duration) (*Capabilities, bool, error) {
+	c := &Capabilities{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, false, fmt.Errorf("could not decode capabilities of %q: %v", target, err)
+	}
+	if ttl > 0 && time.Since(c.Discovered) >= ttl {
+		return nil, false, nil
+	}
+	return c, true, nil
+}
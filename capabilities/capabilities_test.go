@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capabilities
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/store"
+)
+
+// fakeRedis is an in-memory RedisClient, which records the TTLs keys were set with.
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{values: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.values[key]
+	return value, ok, nil
+}
+
+func (r *fakeRedis) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key], r.ttls[key] = value, ttl
+	return nil
+}
+
+func (r *fakeRedis) Del(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, key)
+	return nil
+}
+
+func TestCaches(t *testing.T) {
+	redis := newFakeRedis()
+	for _, test := range []struct {
+		name  string
+		cache Cache
+	}{
+		{name: "file", cache: &FileCache{Dir: t.TempDir(), TTL: time.Hour}},
+		{name: "redis", cache: &RedisCache{Client: redis, Prefix: "orismologer/capabilities/", TTL: time.Hour}},
+		{name: "store", cache: NewStoreCache(store.NewMemory(), time.Hour)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			expected := &Capabilities{
+				Target:      "switch/1",
+				Vendor:      "cisco",
+				Model:       "cisco-asr",
+				SysObjectID: "1.3.6.1.4.1.9.1.1639",
+				Unsupported: []string{"1.3.6.1.4.1.9.9.109"},
+				Discovered:  time.Now().Round(0),
+			}
+			if _, ok, err := test.cache.Get(ctx, expected.Target); ok || err != nil {
+				t.Errorf("Get() of uncached target = %v, %v, expected false, nil", ok, err)
+			}
+			if err := test.cache.Put(ctx, expected); err != nil {
+				t.Fatalf("Put() got error: %v", err)
+			}
+			got, ok, err := test.cache.Get(ctx, expected.Target)
+			if err != nil || !ok {
+				t.Fatalf("Get() = %v, %v, expected cached capabilities", ok, err)
+			}
+			if diff := cmp.Diff(expected, got); diff != "" {
+				t.Errorf("Get() returned diff (-expected +got):\n%v", diff)
+			}
+			if err := test.cache.Delete(ctx, expected.Target); err != nil {
+				t.Errorf("Delete() got error: %v", err)
+			}
+			if _, ok, _ := test.cache.Get(ctx, expected.Target); ok {
+				t.Errorf("Get() found deleted capabilities")
+			}
+			if err := test.cache.Delete(ctx, expected.Target); err != nil {
+				t.Errorf("Delete() of uncached target got error: %v", err)
+			}
+		})
+	}
+	if got := redis.ttls["orismologer/capabilities/switch/1"]; got != time.Hour {
+		t.Errorf("RedisCache set TTL %v, expected %v", got, time.Hour)
+	}
+}
+
+func TestFileCacheExpiry(t *testing.T) {
+	dir := t.TempDir()
+	f := &FileCache{Dir: dir, TTL: time.Hour}
+	ctx := context.Background()
+	if err := f.Put(ctx, &Capabilities{Target: "old", Discovered: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatalf("Put() got error: %v", err)
+	}
+	if _, ok, err := f.Get(ctx, "old"); ok || err != nil {
+		t.Errorf("Get() of expired capabilities = %v, %v, expected false, nil", ok, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0644); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if _, _, err := f.Get(ctx, "corrupt"); err == nil {
+		t.Errorf("Get() of corrupt file expected error, got none")
+	}
+	if err := (&FileCache{Dir: filepath.Join(dir, "missing")}).Put(ctx, &Capabilities{Target: "t"}); err == nil {
+		t.Errorf("Put() into missing directory expected error, got none")
+	}
+}
+
+func TestLookupSharedBetweenInstances(t *testing.T) {
+	dir := t.TempDir()
+	probes := 0
+	probe := func(ctx context.Context, target string) (*Capabilities, error) {
+		probes++
+		if target == "unreachable" {
+			return nil, fmt.Errorf("timeout")
+		}
+		return &Capabilities{Vendor: "cisco"}, nil
+	}
+	// Each instance has its own cache, sharing a directory.
+	for i := 0; i < 3; i++ {
+		c, err := Lookup(context.Background(), &FileCache{Dir: dir}, "switch1", probe)
+		if err != nil {
+			t.Fatalf("Lookup() got error: %v", err)
+		}
+		if c.Target != "switch1" || c.Vendor != "cisco" || c.Discovered.IsZero() {
+			t.Errorf("Lookup() = %+v, expected the probed capabilities of switch1", c)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("switch1 was probed %d times, expected once", probes)
+	}
+	if _, err := Lookup(context.Background(), &FileCache{Dir: dir}, "unreachable", probe); err == nil {
+		t.Errorf("Lookup() of target failing to probe expected error, got none")
+	}
+}
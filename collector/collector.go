@@ -0,0 +1,167 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package collector schedules mass collection: it polls a set of OpenConfig paths for every target in
+an inventory, each target on its own loop, and sends the results to a sink. Polls are spread out with
+jitter, and a pool of workers bounds how many targets are polled at once.
+*/
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/orismologer/sink"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+/*
+Scheduler polls Paths for each target in Inventory every Interval, and sends one notification per
+target per poll to Sink. A target is never polled while its previous poll is still running: if a poll
+overruns the interval, the next poll follows immediately after it.
+*/
+type Scheduler struct {
+	Evaluator sink.Evaluator
+	Inventory *pb.Inventory
+	Paths     []string
+	Interval  time.Duration
+	Sink      sink.Sink
+
+	// Jitter randomly varies each target's interval by up to this fraction of Interval (eg: 0.1 for
+	// ±10%), so that targets drift apart rather than being polled in bursts. Must be in [0, 1).
+	Jitter float64
+
+	// Workers is the maximum number of targets polled at once. Defaults to the number of CPUs.
+	Workers int
+
+	// Health, if set, stretches the intervals of unhealthy targets, so that workers are not tied up
+	// waiting on targets which do not answer.
+	Health Health
+
+	rand *rand.Rand
+	mu   sync.Mutex // Guards rand, which is not safe for concurrent use.
+}
+
+// Health reports how far to back off from polling a target. It is implemented by *health.Checker.
+type Health interface {
+	// Backoff returns the factor by which to stretch a target's interval: 1 if it is healthy.
+	Backoff(target string) int
+}
+
+func (s *Scheduler) validate() error {
+	switch {
+	case s.Evaluator == nil || s.Sink == nil:
+		return fmt.Errorf("a collector needs an evaluator and a sink")
+	case s.Interval <= 0:
+		return fmt.Errorf("interval must be positive, got %v", s.Interval)
+	case s.Jitter < 0 || s.Jitter >= 1:
+		return fmt.Errorf("jitter must be in [0, 1), got %v", s.Jitter)
+	case s.Workers < 0:
+		return fmt.Errorf("workers must not be negative, got %v", s.Workers)
+	}
+	return nil
+}
+
+/*
+Run polls until the context is cancelled. It then stops starting polls, waits for those in progress
+to finish and returns the context's error. Targets' first polls are spread randomly over the first
+interval, so that a large inventory does not start with a burst.
+*/
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if s.rand == nil {
+		s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	workers := s.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, target := range s.Inventory.GetTargets() {
+		wg.Add(1)
+		go func(target *pb.Target) {
+			defer wg.Done()
+			s.loop(ctx, target, slots)
+		}(target)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// loop polls a target until the context is cancelled, holding a worker slot while polling.
+func (s *Scheduler) loop(ctx context.Context, target *pb.Target, slots chan struct{}) {
+	delay := time.Duration(s.random() * float64(s.Interval))
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case slots <- struct{}{}:
+		}
+		s.poll(ctx, target)
+		<-slots
+		delay = s.interval()
+		if s.Health != nil {
+			if backoff := s.Health.Backoff(target.GetName()); backoff > 1 {
+				delay *= time.Duration(backoff)
+			}
+		}
+		delay -= time.Since(start)
+	}
+}
+
+func (s *Scheduler) poll(ctx context.Context, target *pb.Target) {
+	pprof.Do(ctx, pprof.Labels("target", target.GetName()), func(ctx context.Context) {
+		notification := sink.Collect(s.Evaluator, target, s.Paths, time.Now())
+		if len(notification.GetUpdate()) == 0 {
+			return
+		}
+		// Results are sent even if the context has been cancelled meanwhile, so that shutdown does not
+		// discard a completed poll.
+		if err := s.Sink.Send(context.Background(), notification); err != nil {
+			glog.Warningf("could not send updates for target %q: %v", target.GetName(), err)
+		}
+	})
+}
+
+// interval returns the interval until a target's next poll, with jitter applied.
+func (s *Scheduler) interval() time.Duration {
+	return time.Duration(float64(s.Interval) * (1 + s.Jitter*(2*s.random()-1)))
+}
+
+func (s *Scheduler) random() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64()
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/orismologer/orismologer"
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// slowEvaluator takes a while to evaluate, and records the greatest number of concurrent evaluations.
+type slowEvaluator struct {
+	mu     sync.Mutex
+	active int
+	max    int
+}
+
+func (e *slowEvaluator) EvalResult(openConfigPath, target, vendor string) (*orismologer.Result, error) {
+	e.mu.Lock()
+	e.active++
+	if e.active > e.max {
+		e.max = e.active
+	}
+	e.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	e.mu.Lock()
+	e.active--
+	e.mu.Unlock()
+	return &orismologer.Result{Path: openConfigPath, Target: target, Vendor: vendor, Value: target}, nil
+}
+
+func (e *slowEvaluator) Leaves(root string) ([]string, error) {
+	return []string{"/system/state/hostname"}, nil
+}
+
+// recordingSink counts the notifications sent for each target.
+type recordingSink struct {
+	mu    sync.Mutex
+	sends map[string]int
+}
+
+func (s *recordingSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sends[notification.GetPrefix().GetTarget()]++
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func (s *recordingSink) counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[string]int{}
+	for target, n := range s.sends {
+		counts[target] = n
+	}
+	return counts
+}
+
+func TestSchedulerRun(t *testing.T) {
+	inventory := &pb.Inventory{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		inventory.Targets = append(inventory.Targets, &pb.Target{Name: name, Vendor: "cisco"})
+	}
+	evaluator := &slowEvaluator{}
+	recorder := &recordingSink{sends: map[string]int{}}
+	s := &Scheduler{
+		Evaluator: evaluator,
+		Inventory: inventory,
+		Paths:     []string{"/system"},
+		Interval:  20 * time.Millisecond,
+		Jitter:    0.1,
+		Workers:   2,
+		Sink:      recorder,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run() got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	counts := recorder.counts()
+	for _, target := range inventory.GetTargets() {
+		if counts[target.GetName()] < 2 {
+			t.Errorf("target %q was polled %d times, expected at least 2", target.GetName(), counts[target.GetName()])
+		}
+	}
+	if evaluator.max > s.Workers {
+		t.Errorf("%d targets were polled at once, expected at most %d", evaluator.max, s.Workers)
+	}
+	// Nothing is polled once Run has returned.
+	time.Sleep(50 * time.Millisecond)
+	for target, n := range recorder.counts() {
+		if n != counts[target] {
+			t.Errorf("target %q was polled after Run() returned", target)
+		}
+	}
+}
+
+// backoffs is a Health with fixed backoff factors.
+type backoffs map[string]int
+
+func (b backoffs) Backoff(target string) int {
+	if factor, ok := b[target]; ok {
+		return factor
+	}
+	return 1
+}
+
+func TestSchedulerBacksOff(t *testing.T) {
+	inventory := &pb.Inventory{Targets: []*pb.Target{{Name: "healthy"}, {Name: "unhealthy"}}}
+	recorder := &recordingSink{sends: map[string]int{}}
+	s := &Scheduler{
+		Evaluator: &slowEvaluator{},
+		Inventory: inventory,
+		Paths:     []string{"/system"},
+		Interval:  10 * time.Millisecond,
+		Sink:      recorder,
+		Health:    backoffs{"unhealthy": 100},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	counts := recorder.counts()
+	if counts["healthy"] < 5 {
+		t.Errorf("healthy target was polled %d times, expected at least 5", counts["healthy"])
+	}
+	if counts["unhealthy"] != 1 {
+		t.Errorf("unhealthy target was polled %d times, expected once", counts["unhealthy"])
+	}
+}
+
+func TestSchedulerValidation(t *testing.T) {
+	valid := func() *Scheduler {
+		return &Scheduler{
+			Evaluator: &slowEvaluator{},
+			Sink:      &recordingSink{sends: map[string]int{}},
+			Interval:  time.Second,
+		}
+	}
+	for _, test := range []struct {
+		name   string
+		modify func(s *Scheduler)
+	}{
+		{name: "no evaluator", modify: func(s *Scheduler) { s.Evaluator = nil }},
+		{name: "no sink", modify: func(s *Scheduler) { s.Sink = nil }},
+		{name: "zero interval", modify: func(s *Scheduler) { s.Interval = 0 }},
+		{name: "negative jitter", modify: func(s *Scheduler) { s.Jitter = -0.1 }},
+		{name: "jitter of a whole interval", modify: func(s *Scheduler) { s.Jitter = 1 }},
+		{name: "negative workers", modify: func(s *Scheduler) { s.Workers = -1 }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := valid()
+			test.modify(s)
+			if err := s.Run(context.Background()); err == nil {
+				t.Errorf("Run() expected error, got none")
+			}
+		})
+	}
+}
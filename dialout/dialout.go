@@ -0,0 +1,213 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package dialout serves the legacy targets in an inventory over sessions which a collector opens
+through a tunnel dialled out by Orismologer's host, for collection infrastructures which expect
+devices to connect inbound, eg: via a gRPC tunnel (github.com/openconfig/grpctunnel).
+
+A Proxy is a net.Listener yielding one connection per session the collector opens to a target, so it
+can be served by a grpc.Server with the gNMI service registered. Sessions are dedicated to their
+target (see gnmiserver.TargetNetwork): collectors need not name the target in requests, and cannot
+query other targets over them.
+
+The Proxy only serves sessions: it does not dial the collector or register targets with it, and does
+not depend on a particular tunnel implementation. The embedding program runs a tunnel client which
+does, eg: with a grpctunnel client:
+
+	proxy := dialout.NewProxy(inventory)
+	targets := map[tunnel.Target]struct{}{}
+	for _, target := range proxy.Targets() {
+		targets[tunnel.Target{ID: target, Type: dialout.TargetType}] = struct{}{}
+	}
+	client, err := tunnel.NewClient(tpb.NewTunnelClient(conn), tunnel.ClientConfig{
+		RegisterHandler: func(t tunnel.Target) error { return proxy.Accepts(t.ID) },
+		Handler:         func(t tunnel.Target, rwc io.ReadWriteCloser) error { return proxy.Handle(t.ID, rwc) },
+	}, targets)
+	...
+	go server.Serve(proxy)
+	client.Register(ctx)
+	client.Start(ctx)
+*/
+package dialout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/orismologer/gnmiserver"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// TargetType is the type with which targets are registered with a collector: they serve gNMI.
+const TargetType = "GNMI_GNOI"
+
+// ErrClosed is returned when using a closed Proxy.
+var ErrClosed = errors.New("dial-out proxy closed")
+
+// Proxy accepts sessions opened by a collector to the targets in an inventory.
+type Proxy struct {
+	targets map[string]bool
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+}
+
+var _ net.Listener = (*Proxy)(nil)
+
+// NewProxy returns a Proxy for the targets in the given inventory.
+func NewProxy(inventory *pb.Inventory) *Proxy {
+	targets := map[string]bool{}
+	for _, target := range inventory.GetTargets() {
+		targets[target.GetName()] = true
+	}
+	return &Proxy{
+		targets: targets,
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+	}
+}
+
+// Targets returns the names of the targets to register with the collector, in sorted order.
+func (p *Proxy) Targets() []string {
+	var targets []string
+	for target := range p.targets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Accepts returns an error unless the collector may open sessions to the given target.
+func (p *Proxy) Accepts(target string) error {
+	if !p.targets[target] {
+		return fmt.Errorf("unknown target %q", target)
+	}
+	return nil
+}
+
+/*
+Handle serves a session opened by the collector to the given target, returning once the session has
+been closed. The session is closed if it cannot be served.
+*/
+func (p *Proxy) Handle(target string, session io.ReadWriteCloser) error {
+	if err := p.Accepts(target); err != nil {
+		session.Close()
+		return err
+	}
+	conn := &sessionConn{ReadWriteCloser: session, addr: targetAddr(target), closed: make(chan struct{})}
+	select {
+	case p.conns <- conn:
+	case <-p.done:
+		session.Close()
+		return ErrClosed
+	}
+	select {
+	case <-conn.closed:
+	case <-p.done:
+		conn.Close()
+	}
+	return nil
+}
+
+// Accept waits for the collector to open a session to a target.
+func (p *Proxy) Accept() (net.Conn, error) {
+	select {
+	case conn := <-p.conns:
+		return conn, nil
+	case <-p.done:
+		return nil, ErrClosed
+	}
+}
+
+// Close stops accepting sessions, and closes those being served.
+func (p *Proxy) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+// Addr returns a placeholder address: sessions do not arrive on a local address.
+func (p *Proxy) Addr() net.Addr {
+	return targetAddr("")
+}
+
+// targetAddr is the address of a session's target. See gnmiserver.TargetNetwork.
+type targetAddr string
+
+func (a targetAddr) Network() string {
+	return gnmiserver.TargetNetwork
+}
+
+func (a targetAddr) String() string {
+	return string(a)
+}
+
+// sessionConn adapts a session to a net.Conn.
+type sessionConn struct {
+	io.ReadWriteCloser
+	addr   net.Addr
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *sessionConn) Close() error {
+	err := c.ReadWriteCloser.Close()
+	c.once.Do(func() { close(c.closed) })
+	return err
+}
+
+func (c *sessionConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *sessionConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// deadliner is implemented by sessions which support deadlines, eg: net.Conn.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// SetDeadline sets the session's deadlines, if it supports them.
+func (c *sessionConn) SetDeadline(t time.Time) error {
+	if d, ok := c.ReadWriteCloser.(deadliner); ok {
+		return d.SetDeadline(t)
+	}
+	return nil
+}
+
+func (c *sessionConn) SetReadDeadline(t time.Time) error {
+	if d, ok := c.ReadWriteCloser.(deadliner); ok {
+		return d.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *sessionConn) SetWriteDeadline(t time.Time) error {
+	if d, ok := c.ReadWriteCloser.(deadliner); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return nil
+}
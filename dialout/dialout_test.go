@@ -0,0 +1,151 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dialout
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/orismologer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// fakeEvaluator serves the target's name as its hostname.
+type fakeEvaluator struct{}
+
+func (fakeEvaluator) EvalResult(openConfigPath, target, vendor string) (*orismologer.Result, error) {
+	if openConfigPath != "/system/state/hostname" {
+		return nil, fmt.Errorf("cannot evaluate %q", openConfigPath)
+	}
+	return &orismologer.Result{Path: openConfigPath, Target: target, Vendor: vendor, Value: target}, nil
+}
+
+func (fakeEvaluator) Leaves(root string) ([]string, error) {
+	return []string{"/system/state/hostname"}, nil
+}
+
+func (fakeEvaluator) Supported(openConfigPath, vendor string) (bool, error) {
+	return true, nil
+}
+
+func (fakeEvaluator) Revisions(openConfigPath string) ([]string, error) {
+	return nil, nil
+}
+
+func (fakeEvaluator) KeyVariables(openConfigPath string) (map[string]string, error) {
+	return nil, nil
+}
+
+var inventory = &pb.Inventory{
+	Targets: []*pb.Target{
+		{Name: "switch2", Vendor: "cisco"},
+		{Name: "switch1", Vendor: "cisco"},
+	},
+}
+
+func TestProxy(t *testing.T) {
+	proxy := NewProxy(inventory)
+	server := grpc.NewServer()
+	gpb.RegisterGNMIServer(server, gnmiserver.NewServer(fakeEvaluator{}, inventory))
+	go server.Serve(proxy)
+	defer server.Stop()
+
+	if got := proxy.Targets(); len(got) != 2 || got[0] != "switch1" || got[1] != "switch2" {
+		t.Errorf("Targets() = %v, expected [switch1 switch2]", got)
+	}
+
+	for _, target := range []string{"switch1", "switch2"} {
+		t.Run(target, func(t *testing.T) {
+			// The collector's end of the session, and the end handed to the proxy by the tunnel.
+			collectorEnd, proxyEnd := net.Pipe()
+			handled := make(chan error, 1)
+			go func() {
+				handled <- proxy.Handle(target, proxyEnd)
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			conn, err := grpc.DialContext(ctx, "session", grpc.WithInsecure(), grpc.WithBlock(),
+				grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+					return collectorEnd, nil
+				}))
+			if err != nil {
+				t.Fatalf("Could not set up test: %v", err)
+			}
+			// The request does not name a target: the session's target is used.
+			resp, err := gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{
+				Path: []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}}},
+			})
+			if err != nil {
+				t.Fatalf("Get() got error: %v", err)
+			}
+			if got := resp.GetNotification()[0].GetUpdate()[0].GetVal().GetStringVal(); got != target {
+				t.Errorf("Get() = %q, expected %q", got, target)
+			}
+			// The session cannot be used to query the other targets.
+			for _, other := range proxy.Targets() {
+				_, err := gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{
+					Prefix: &gpb.Path{Target: other},
+					Path:   []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}}},
+				})
+				if other == target && err != nil {
+					t.Errorf("Get() naming the session's target got error: %v", err)
+				}
+				if other != target && status.Code(err) != codes.PermissionDenied {
+					t.Errorf("Get() naming target %q got error %v, expected code %v", other, err, codes.PermissionDenied)
+				}
+			}
+			conn.Close()
+			select {
+			case err := <-handled:
+				if err != nil {
+					t.Errorf("Handle() got error: %v", err)
+				}
+			case <-ctx.Done():
+				t.Errorf("Handle() did not return after the session was closed")
+			}
+		})
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	proxy := NewProxy(inventory)
+	if err := proxy.Accepts("unknown"); err == nil {
+		t.Errorf("Accepts(%q) expected error, got none", "unknown")
+	}
+	collectorEnd, proxyEnd := net.Pipe()
+	defer collectorEnd.Close()
+	if err := proxy.Handle("unknown", proxyEnd); err == nil {
+		t.Errorf("Handle(%q) expected error, got none", "unknown")
+	}
+
+	proxy.Close()
+	if _, err := proxy.Accept(); err != ErrClosed {
+		t.Errorf("Accept() on closed proxy got error %v, expected %v", err, ErrClosed)
+	}
+	if err := proxy.Handle("switch1", proxyEnd); err != ErrClosed {
+		t.Errorf("Handle() on closed proxy got error %v, expected %v", err, ErrClosed)
+	}
+}
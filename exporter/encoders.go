@@ -0,0 +1,215 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is the value of an OpenConfig leaf for a target, evaluated at a point in time.
+type Sample struct {
+	Target string
+	// Path is the OpenConfig leaf, which may include keys, eg: /interfaces/interface[name=Eth1/1]/state/mtu.
+	Path      string
+	Value     interface{}
+	Timestamp time.Time
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxKeyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	influxStringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	openMetricsEscaper       = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+/*
+WriteInfluxLineProtocol writes samples in InfluxDB line protocol. The measurement is the path of a
+leaf's parent (without keys), the field is the leaf's name, and the tags are the target and the keys
+of the path, eg:
+
+	/interfaces/interface/state,name=Eth1/1,target=switch1 mtu=1500 1545178344000000000
+
+Samples which share a measurement, tags and timestamp are written as one line.
+*/
+func WriteInfluxLineProtocol(w io.Writer, samples []Sample) error {
+	type line struct {
+		series string // Measurement and tags.
+		fields []string
+		time   int64
+	}
+	var lines []*line
+	index := map[string]*line{}
+	for _, sample := range samples {
+		names := elementNames(sample.Path)
+		if len(names) == 0 {
+			return fmt.Errorf("cannot encode sample for path %q", sample.Path)
+		}
+		labels, err := sampleLabels(sample)
+		if err != nil {
+			return err
+		}
+		var series strings.Builder
+		series.WriteString(influxMeasurementEscaper.Replace("/" + strings.Join(names[:len(names)-1], "/")))
+		for _, k := range sortedKeys(labels) {
+			if labels[k] == "" {
+				continue // Influx does not permit empty tag values.
+			}
+			fmt.Fprintf(&series, ",%v=%v", influxKeyEscaper.Replace(k), influxKeyEscaper.Replace(labels[k]))
+		}
+		value, err := influxValue(sample.Value)
+		if err != nil {
+			return fmt.Errorf("cannot encode value of %q: %v", sample.Path, err)
+		}
+		field := influxKeyEscaper.Replace(names[len(names)-1]) + "=" + value
+		t := sample.Timestamp.UnixNano()
+		id := fmt.Sprintf("%v %v", series.String(), t)
+		if l, ok := index[id]; ok {
+			l.fields = append(l.fields, field)
+			continue
+		}
+		l := &line{series: series.String(), fields: []string{field}, time: t}
+		index[id] = l
+		lines = append(lines, l)
+	}
+	b := bufio.NewWriter(w)
+	for _, l := range lines {
+		fmt.Fprintf(b, "%v %v %v\n", l.series, strings.Join(l.fields, ","), l.time)
+	}
+	return b.Flush()
+}
+
+func influxValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("%v is not representable", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v) + "i", nil
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", nil
+	case uint64:
+		return strconv.FormatUint(v, 10) + "u", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return `"` + influxStringEscaper.Replace(v) + `"`, nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+/*
+WriteOpenMetrics writes samples in the OpenMetrics text format. Metric names are derived from paths
+(see MetricName) and labels are the target and the keys of the path. Numeric values are written as
+gauges; strings are written as info metrics with the value in a "value" label. eg:
+
+	# TYPE interfaces_interface_state_mtu gauge
+	interfaces_interface_state_mtu{name="Eth1/1",target="switch1"} 1500 1545178344
+	# TYPE system_state_hostname info
+	system_state_hostname_info{target="switch1",value="switch1"} 1 1545178344
+	# EOF
+*/
+func WriteOpenMetrics(w io.Writer, samples []Sample) error {
+	type family struct {
+		kind    string
+		samples []string
+	}
+	families := map[string]*family{}
+	for _, sample := range samples {
+		name := MetricName(sample.Path)
+		if !metricNameRe.MatchString(name) {
+			return fmt.Errorf("cannot derive a metric name from path %q", sample.Path)
+		}
+		labels, err := sampleLabels(sample)
+		if err != nil {
+			return err
+		}
+		kind, sampleName, value := "gauge", name, ""
+		if s, ok := sample.Value.(string); ok {
+			if _, ok := labels["value"]; ok {
+				return fmt.Errorf("path %q has a key named %q", sample.Path, "value")
+			}
+			kind, sampleName, value = "info", name+"_info", "1"
+			labels["value"] = s
+		} else {
+			f, err := ToFloat(sample.Value)
+			if err != nil {
+				return fmt.Errorf("cannot encode value of %q: %v", sample.Path, err)
+			}
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		f, ok := families[name]
+		if !ok {
+			f = &family{kind: kind}
+			families[name] = f
+		}
+		if f.kind != kind {
+			return fmt.Errorf("metric %q has both %v and %v samples", name, f.kind, kind)
+		}
+		var labelPairs []string
+		for _, k := range sortedKeys(labels) {
+			labelPairs = append(labelPairs, fmt.Sprintf(`%v="%v"`, k, openMetricsEscaper.Replace(labels[k])))
+		}
+		timestamp := strconv.FormatFloat(float64(sample.Timestamp.UnixNano())/1e9, 'f', -1, 64)
+		f.samples = append(f.samples, fmt.Sprintf("%v{%v} %v %v", sampleName, strings.Join(labelPairs, ","), value, timestamp))
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b := bufio.NewWriter(w)
+	for _, name := range names {
+		fmt.Fprintf(b, "# TYPE %v %v\n", name, families[name].kind)
+		for _, s := range families[name].samples {
+			fmt.Fprintln(b, s)
+		}
+	}
+	fmt.Fprintln(b, "# EOF")
+	return b.Flush()
+}
+
+// sampleLabels returns the target and path keys of a sample.
+func sampleLabels(sample Sample) (map[string]string, error) {
+	labels, err := pathLabels(sample.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := labels[TargetLabel]; ok {
+		return nil, fmt.Errorf("path %q has a key named %q", sample.Path, TargetLabel)
+	}
+	labels[TargetLabel] = sample.Target
+	return labels, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+var (
+	testTime    = time.Unix(1545178344, 500000000)
+	testSamples = []Sample{
+		{Target: "switch1", Path: "/system/state/boot-time", Value: 1545178344.0, Timestamp: testTime},
+		{Target: "switch1", Path: "/system/state/hostname", Value: `sw "1"`, Timestamp: testTime},
+		{Target: "switch1", Path: "/interfaces/interface[name=Eth1/1]/state/mtu", Value: 1500, Timestamp: testTime},
+		{Target: "switch1", Path: "/interfaces/interface[name=Eth1/1]/state/counters/in-octets", Value: uint64(42), Timestamp: testTime},
+		{Target: "switch 2", Path: "/system/state/boot-time", Value: 1.5, Timestamp: testTime},
+	}
+)
+
+func TestWriteInfluxLineProtocol(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteInfluxLineProtocol(&b, testSamples); err != nil {
+		t.Fatalf("WriteInfluxLineProtocol() got error: %v", err)
+	}
+	expected := `/system/state,target=switch1 boot-time=1545178344,hostname="sw \"1\"" 1545178344500000000
+/interfaces/interface/state,name=Eth1/1,target=switch1 mtu=1500i 1545178344500000000
+/interfaces/interface/state/counters,name=Eth1/1,target=switch1 in-octets=42u 1545178344500000000
+/system/state,target=switch\ 2 boot-time=1.5 1545178344500000000
+`
+	if got := b.String(); got != expected {
+		t.Errorf("WriteInfluxLineProtocol() wrote:\n%v\nexpected:\n%v", got, expected)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteOpenMetrics(&b, testSamples); err != nil {
+		t.Fatalf("WriteOpenMetrics() got error: %v", err)
+	}
+	expected := `# TYPE interfaces_interface_state_counters_in_octets gauge
+interfaces_interface_state_counters_in_octets{name="Eth1/1",target="switch1"} 42 1545178344.5
+# TYPE interfaces_interface_state_mtu gauge
+interfaces_interface_state_mtu{name="Eth1/1",target="switch1"} 1500 1545178344.5
+# TYPE system_state_boot_time gauge
+system_state_boot_time{target="switch1"} 1545178344 1545178344.5
+system_state_boot_time{target="switch 2"} 1.5 1545178344.5
+# TYPE system_state_hostname info
+system_state_hostname_info{target="switch1",value="sw \"1\""} 1 1545178344.5
+# EOF
+`
+	if got := b.String(); got != expected {
+		t.Errorf("WriteOpenMetrics() wrote:\n%v\nexpected:\n%v", got, expected)
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	for name, samples := range map[string][]Sample{
+		"unsupported type": {{Target: "t", Path: "/a/b", Value: []int{1}}},
+		"reserved key":     {{Target: "t", Path: "/a[target=x]/b", Value: 1}},
+		"invalid key":      {{Target: "t", Path: "/a[target]/b", Value: 1}},
+	} {
+		if err := WriteInfluxLineProtocol(&bytes.Buffer{}, samples); err == nil {
+			t.Errorf("WriteInfluxLineProtocol() with %v expected error, got none", name)
+		}
+		if err := WriteOpenMetrics(&bytes.Buffer{}, samples); err == nil {
+			t.Errorf("WriteOpenMetrics() with %v expected error, got none", name)
+		}
+	}
+}
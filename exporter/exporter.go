@@ -0,0 +1,275 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package exporter exposes OpenConfig leaves evaluated by Orismologer as Prometheus metrics, so that
+Go services embedding Orismologer can serve device telemetry to Prometheus directly. eg:
+
+	collector, err := exporter.NewCollector(o, inventory, []exporter.Mapping{
+		{Path: "/system/memory/state/physical", Name: "memory_physical_bytes"},
+		{Path: "/system/cpus/cpu[index=0]/state/total/instant", Labels: map[string]string{"unit": "percent"}},
+	})
+	prometheus.MustRegister(collector)
+
+Every leaf is evaluated for every target in the inventory each time the collector is scraped. Each
+sample carries a "target" label naming the device it describes.
+
+Evaluated samples can also be written in InfluxDB line protocol or OpenMetrics text, for shipping
+directly to other time series databases (see WriteInfluxLineProtocol and WriteOpenMetrics).
+*/
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// TargetLabel is the label naming the target each sample describes.
+const TargetLabel = "target"
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	invalidRe    = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+)
+
+// Evaluator evaluates OpenConfig paths for a target. It is implemented by *orismologer.Orismologer.
+type Evaluator interface {
+	Eval(openConfigPath, target, vendor string) (interface{}, error)
+}
+
+// Mapping describes how an OpenConfig leaf is exported as a Prometheus metric.
+type Mapping struct {
+	// Path is the OpenConfig leaf to evaluate. Keys in the path (eg: [name=cpu0]) become labels.
+	Path string
+	// Name is the metric name. If empty, a name is derived from the path (see MetricName).
+	Name string
+	// Help is the metric's help string. If empty, the path (without keys) is used.
+	Help string
+	// Labels are added to every sample of the metric.
+	Labels map[string]string
+	// Counter marks the metric as a counter, rather than a gauge.
+	Counter bool
+}
+
+type metric struct {
+	path      string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+// Collector is a prometheus.Collector which evaluates OpenConfig leaves for a set of targets.
+type Collector struct {
+	evaluator Evaluator
+	targets   []*pb.Target
+	metrics   []metric
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+/*
+NewCollector returns a Collector exporting the given mappings for each target in the inventory.
+Mappings which share a metric name must have the same label names and help string.
+*/
+func NewCollector(evaluator Evaluator, inventory *pb.Inventory, mappings []Mapping) (*Collector, error) {
+	c := &Collector{
+		evaluator: evaluator,
+		targets:   inventory.GetTargets(),
+	}
+	type signature struct{ labels, help string }
+	signatures := map[string]signature{} // Metric name -> signature.
+	for _, m := range mappings {
+		name := m.Name
+		if name == "" {
+			name = MetricName(m.Path)
+		}
+		if !metricNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid metric name %q for path %q", name, m.Path)
+		}
+		labels, err := pathLabels(m.Path)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range m.Labels {
+			if _, ok := labels[k]; ok {
+				return nil, fmt.Errorf("label %q of path %q is also a path key", k, m.Path)
+			}
+			labels[k] = v
+		}
+		var labelNames []string
+		for k := range labels {
+			if !labelNameRe.MatchString(k) || k == TargetLabel {
+				return nil, fmt.Errorf("invalid label name %q for path %q", k, m.Path)
+			}
+			labelNames = append(labelNames, k)
+		}
+		sort.Strings(labelNames)
+		help := m.Help
+		if help == "" {
+			help = "/" + strings.Join(elementNames(m.Path), "/")
+		}
+		sig := signature{labels: strings.Join(labelNames, ","), help: help}
+		if existing, ok := signatures[name]; ok && existing != sig {
+			return nil, fmt.Errorf("metric %q is mapped more than once with different labels or help", name)
+		}
+		signatures[name] = sig
+		valueType := prometheus.GaugeValue
+		if m.Counter {
+			valueType = prometheus.CounterValue
+		}
+		c.metrics = append(c.metrics, metric{
+			path:      m.Path,
+			desc:      prometheus.NewDesc(name, help, []string{TargetLabel}, labels),
+			valueType: valueType,
+		})
+	}
+	return c, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics {
+		ch <- m.desc
+	}
+}
+
+/*
+Collect implements prometheus.Collector. Leaves which cannot be evaluated for a target, or whose
+values are not numeric, are skipped.
+*/
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, target := range c.targets {
+		for _, m := range c.metrics {
+			value, err := c.evaluator.Eval(m.path, target.GetName(), target.GetVendor())
+			if err != nil {
+				glog.V(1).Infof("skipping %q for target %q: %v", m.path, target.GetName(), err)
+				continue
+			}
+			f, err := ToFloat(value)
+			if err != nil {
+				glog.V(1).Infof("skipping %q for target %q: %v", m.path, target.GetName(), err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, f, target.GetName())
+		}
+	}
+}
+
+// ToFloat converts a value produced by Orismologer to a sample value.
+func ToFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not numeric", v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+/*
+MetricName derives a metric name from an OpenConfig path by dropping keys and joining its elements
+with underscores, eg: /system/cpus/cpu[index=0]/state/total/instant -> system_cpus_cpu_state_total_instant.
+*/
+func MetricName(path string) string {
+	var elements []string
+	for _, element := range elementNames(path) {
+		elements = append(elements, strings.Trim(invalidRe.ReplaceAllString(element, "_"), "_"))
+	}
+	return strings.Join(elements, "_")
+}
+
+// elementNames returns the names of the elements of a path, without their keys.
+func elementNames(path string) []string {
+	var names []string
+	for _, element := range splitPath(path) {
+		if i := strings.Index(element, "["); i >= 0 {
+			element = element[:i]
+		}
+		names = append(names, element)
+	}
+	return names
+}
+
+// pathLabels returns the keys of the given path, eg: /a/b[name=x]/c -> {name: x}.
+func pathLabels(path string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, element := range splitPath(path) {
+		for i := strings.Index(element, "["); i >= 0; i = strings.Index(element, "[") {
+			end := strings.Index(element, "]")
+			if end < i {
+				return nil, fmt.Errorf("unterminated key in path %q", path)
+			}
+			kv := strings.SplitN(element[i+1:end], "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid key %q in path %q", element[i+1:end], path)
+			}
+			if _, ok := labels[kv[0]]; ok {
+				return nil, fmt.Errorf("key %q appears more than once in path %q", kv[0], path)
+			}
+			labels[kv[0]] = kv[1]
+			element = element[end+1:]
+		}
+	}
+	return labels, nil
+}
+
+// splitPath splits a path into its elements. Key values may contain slashes.
+func splitPath(path string) []string {
+	var elements []string
+	depth, start := 0, 0
+	path = strings.TrimPrefix(path, "/")
+	for i, c := range path {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				elements = append(elements, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(path) {
+		elements = append(elements, path[start:])
+	}
+	return elements
+}
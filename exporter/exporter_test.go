@@ -0,0 +1,155 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// fakeEvaluator serves fixed values for fixed leaves, for Cisco targets only.
+type fakeEvaluator map[string]interface{}
+
+func (f fakeEvaluator) Eval(openConfigPath, target, vendor string) (interface{}, error) {
+	if vendor != "cisco" {
+		return nil, fmt.Errorf("unsupported vendor %q", vendor)
+	}
+	value, ok := f[openConfigPath]
+	if !ok {
+		return nil, fmt.Errorf("cannot evaluate %q", openConfigPath)
+	}
+	return value, nil
+}
+
+func TestCollector(t *testing.T) {
+	evaluator := fakeEvaluator{
+		"/system/memory/state/physical":                   1024.0,
+		"/system/cpus/cpu[index=0]/state/total/instant":   "12.5",
+		"/system/cpus/cpu[index=1]/state/total/instant":   50,
+		"/interfaces/interface[name=Eth1/1]/state/mtu":    1500.0,
+		"/interfaces/interface[name=Eth1/1]/state/octets": uint64(42),
+		"/system/state/hostname":                          "switch1",
+	}
+	inventory := &pb.Inventory{
+		Targets: []*pb.Target{
+			{Name: "switch1", Vendor: "cisco"},
+			{Name: "ap1", Vendor: "aruba"},
+		},
+	}
+	collector, err := NewCollector(evaluator, inventory, []Mapping{
+		{Path: "/system/memory/state/physical", Name: "memory_physical_bytes", Help: "Physical memory."},
+		{Path: "/system/cpus/cpu[index=0]/state/total/instant", Labels: map[string]string{"unit": "percent"}},
+		{Path: "/system/cpus/cpu[index=1]/state/total/instant", Labels: map[string]string{"unit": "percent"}},
+		{Path: "/interfaces/interface[name=Eth1/1]/state/mtu"},
+		{Path: "/interfaces/interface[name=Eth1/1]/state/octets", Counter: true},
+		{Path: "/system/state/hostname"},
+		{Path: "/system/state/unmapped"},
+	})
+	if err != nil {
+		t.Fatalf("NewCollector() got error: %v", err)
+	}
+	expected := `
+# HELP interfaces_interface_state_mtu /interfaces/interface/state/mtu
+# TYPE interfaces_interface_state_mtu gauge
+interfaces_interface_state_mtu{name="Eth1/1",target="switch1"} 1500
+# HELP interfaces_interface_state_octets /interfaces/interface/state/octets
+# TYPE interfaces_interface_state_octets counter
+interfaces_interface_state_octets{name="Eth1/1",target="switch1"} 42
+# HELP memory_physical_bytes Physical memory.
+# TYPE memory_physical_bytes gauge
+memory_physical_bytes{target="switch1"} 1024
+# HELP system_cpus_cpu_state_total_instant /system/cpus/cpu/state/total/instant
+# TYPE system_cpus_cpu_state_total_instant gauge
+system_cpus_cpu_state_total_instant{index="0",target="switch1",unit="percent"} 12.5
+system_cpus_cpu_state_total_instant{index="1",target="switch1",unit="percent"} 50
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestNewCollectorErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		mappings []Mapping
+	}{
+		{
+			name:     "invalid metric name",
+			mappings: []Mapping{{Path: "/a", Name: "0a"}},
+		},
+		{
+			name:     "invalid label name",
+			mappings: []Mapping{{Path: "/a", Labels: map[string]string{"a-b": "c"}}},
+		},
+		{
+			name:     "reserved label name",
+			mappings: []Mapping{{Path: "/a", Labels: map[string]string{TargetLabel: "c"}}},
+		},
+		{
+			name:     "label duplicates path key",
+			mappings: []Mapping{{Path: "/a[k=v]", Labels: map[string]string{"k": "c"}}},
+		},
+		{
+			name:     "invalid key",
+			mappings: []Mapping{{Path: "/a[k]/b"}},
+		},
+		{
+			name: "inconsistent labels",
+			mappings: []Mapping{
+				{Path: "/a[k=v]/b"},
+				{Path: "/a[j=v]/b"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewCollector(fakeEvaluator{}, &pb.Inventory{}, test.mappings); err == nil {
+				t.Errorf("NewCollector() expected error, got none")
+			}
+		})
+	}
+}
+
+func TestMetricName(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		expected string
+	}{
+		{path: "/system/state/boot-time", expected: "system_state_boot_time"},
+		{path: "/interfaces/interface[name=Eth1/1]/state/mtu", expected: "interfaces_interface_state_mtu"},
+	} {
+		if got := MetricName(test.path); got != test.expected {
+			t.Errorf("MetricName(%q) = %q, expected %q", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestPathLabels(t *testing.T) {
+	got, err := pathLabels("/a[k1=v1][k2=x/y]/b[k3=v3]/c")
+	if err != nil {
+		t.Fatalf("pathLabels() got error: %v", err)
+	}
+	expected := map[string]string{"k1": "v1", "k2": "x/y", "k3": "v3"}
+	if !cmp.Equal(got, expected) {
+		t.Errorf("pathLabels() = %v, expected %v", got, expected)
+	}
+}
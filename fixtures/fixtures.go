@@ -0,0 +1,206 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package fixtures synthesizes Mappings, Transformations and VendorOids protos (and sample NocPath
+values) for table-driven tests, so tests need not maintain large text proto files. eg:
+
+	b := fixtures.New().
+		Vendor("cisco", "9").
+		Leaf("/system/state/boot-time", "boot_time").
+		Transformation("boot_time", "to_int(up_time) / 100").
+		NocPath("boot_time", "up_time", "1.3.6.1.2.1.1.3", "2000")
+	mappingsFile, transformationsFile, vendorOidsFile, err := b.WriteFiles(dir)
+*/
+package fixtures
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// DefaultVendorRoot is the vendor root used unless VendorRoot is called.
+const DefaultVendorRoot = "1.3.6.1.4.1"
+
+// Builder accumulates the contents of a configuration. Its methods return the builder for chaining.
+type Builder struct {
+	mappings        *pb.Mappings
+	transformations *pb.Transformations
+	vendorOids      *pb.VendorOids
+	byBind          map[string]*pb.Transformation
+	err             error
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return &Builder{
+		mappings:        &pb.Mappings{},
+		transformations: &pb.Transformations{},
+		vendorOids:      &pb.VendorOids{VendorRoot: DefaultVendorRoot, Vendors: map[string]string{}},
+		byBind:          map[string]*pb.Transformation{},
+	}
+}
+
+// VendorRoot sets the root of the vendor-specific part of the MIB tree.
+func (b *Builder) VendorRoot(root string) *Builder {
+	b.vendorOids.VendorRoot = root
+	return b
+}
+
+// Vendor adds a vendor with the given enterprise number.
+func (b *Builder) Vendor(name, enterprise string) *Builder {
+	b.vendorOids.Vendors[name] = enterprise
+	return b
+}
+
+// Model adds a hardware model of the given vendor, reporting the given sysObjectIDs.
+func (b *Builder) Model(name, vendor string, sysObjectIDs ...string) *Builder {
+	b.vendorOids.Models = append(b.vendorOids.Models, &pb.DeviceModel{
+		Name:         name,
+		Vendor:       vendor,
+		SysObjectIds: sysObjectIDs,
+	})
+	return b
+}
+
+// Leaf maps an absolute OpenConfig path to the transformation with the given identifier.
+func (b *Builder) Leaf(path, bind string) *Builder {
+	if !strings.HasPrefix(path, "/") {
+		b.fail(fmt.Errorf("leaf path %q is not absolute", path))
+		return b
+	}
+	b.mappings.Nodes = append(b.mappings.Nodes, &pb.OpenConfigNode{
+		Subpath: &pb.OpenConfigPath{Path: path},
+		Bind:    bind,
+	})
+	return b
+}
+
+/*
+Transformation adds expressions to the transformation with the given identifier, creating it if
+necessary.
+*/
+func (b *Builder) Transformation(bind string, expressions ...string) *Builder {
+	t := b.transformation(bind)
+	t.Expressions = append(t.Expressions, expressions...)
+	return b
+}
+
+/*
+NocPath adds a NocPath with a single OID and the given samples to the given transformation, creating
+the transformation if necessary.
+*/
+func (b *Builder) NocPath(transformation, bind, oid string, samples ...string) *Builder {
+	t := b.transformation(transformation)
+	t.NocPaths = append(t.NocPaths, &pb.NocPath{
+		Bind:    bind,
+		Oids:    []string{oid},
+		Samples: samples,
+	})
+	return b
+}
+
+func (b *Builder) transformation(bind string) *pb.Transformation {
+	t, ok := b.byBind[bind]
+	if !ok {
+		t = &pb.Transformation{Bind: bind}
+		b.byBind[bind] = t
+		b.transformations.Transformations = append(b.transformations.Transformations, t)
+	}
+	return t
+}
+
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Err returns the first error encountered while building, if any.
+func (b *Builder) Err() error {
+	return b.err
+}
+
+// Mappings returns a copy of the Mappings built so far.
+func (b *Builder) Mappings() *pb.Mappings {
+	return proto.Clone(b.mappings).(*pb.Mappings)
+}
+
+// Transformations returns a copy of the Transformations built so far.
+func (b *Builder) Transformations() *pb.Transformations {
+	return proto.Clone(b.transformations).(*pb.Transformations)
+}
+
+// VendorOids returns a copy of the VendorOids built so far.
+func (b *Builder) VendorOids() *pb.VendorOids {
+	return proto.Clone(b.vendorOids).(*pb.VendorOids)
+}
+
+/*
+WriteFiles writes the built protos as text protos to mappings.pb, transformations.pb and
+vendor_oids.pb in the given directory, returning their paths in that order. The files can be passed
+straight to orismologer.NewOrismologer.
+*/
+func (b *Builder) WriteFiles(dir string) (mappingsFile, transformationsFile, vendorOidsFile string, err error) {
+	if b.err != nil {
+		return "", "", "", b.err
+	}
+	mappingsFile = filepath.Join(dir, "mappings.pb")
+	transformationsFile = filepath.Join(dir, "transformations.pb")
+	vendorOidsFile = filepath.Join(dir, "vendor_oids.pb")
+	for file, message := range map[string]proto.Message{
+		mappingsFile:        b.mappings,
+		transformationsFile: b.transformations,
+		vendorOidsFile:      b.vendorOids,
+	} {
+		if err := utils.SaveTextProto(file, message); err != nil {
+			return "", "", "", err
+		}
+	}
+	return mappingsFile, transformationsFile, vendorOidsFile, nil
+}
+
+// Functions for synthesizing sample values in the formats devices return them.
+
+const ntpEpochOffset = 2208988800 // Seconds from 1900-01-01 (NTP epoch) to 1970-01-01.
+
+/*
+NTPTimestamp formats a time as a 64-bit NTP timestamp in the space-separated hex form returned by
+SNMP agents, eg: "dfc4 0b68 8147 af78".
+*/
+func NTPTimestamp(t time.Time) string {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fractional := (uint64(t.Nanosecond()) << 32) / 1000000000
+	hex := fmt.Sprintf("%016x", seconds<<32|fractional)
+	return strings.Join([]string{hex[0:4], hex[4:8], hex[8:12], hex[12:16]}, " ")
+}
+
+// TimeTicks returns a duration as SNMP TimeTicks (hundredths of a second), as a string.
+func TimeTicks(d time.Duration) string {
+	return fmt.Sprint(int64(d / (10 * time.Millisecond)))
+}
+
+// Counter returns a sample counter value, as a string.
+func Counter(value uint64) string {
+	return fmt.Sprint(value)
+}
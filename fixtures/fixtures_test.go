@@ -0,0 +1,85 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fixtures
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/orismologer"
+)
+
+func TestBuilderWithOrismologer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := New().
+		Vendor("cisco", "9").
+		Vendor("aruba", "14823").
+		Leaf("/system/state/up-time", "up_time").
+		Transformation("up_time", "to_int(up_time_cisco) / 100", "to_int(up_time_aruba)").
+		NocPath("up_time", "up_time_cisco", "1.3.6.1.4.1.9.1", TimeTicks(20*time.Second)).
+		NocPath("up_time", "up_time_aruba", "1.3.6.1.4.1.14823.1", "30")
+	mappingsFile, transformationsFile, vendorOidsFile, err := b.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("WriteFiles() got error: %v", err)
+	}
+	o, err := orismologer.NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile)
+	if err != nil {
+		t.Fatalf("NewOrismologer() got error: %v", err)
+	}
+	for vendor, expected := range map[string]interface{}{"cisco": 20.0, "aruba": 30.0} {
+		got, err := o.Eval("/system/state/up-time", "target", vendor)
+		if err != nil {
+			t.Errorf("Eval() for %v got error: %v", vendor, err)
+			continue
+		}
+		if !cmp.Equal(got, expected) {
+			t.Errorf("Eval() for %v = %v, expected %v", vendor, got, expected)
+		}
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	b := New().Leaf("relative/path", "bind")
+	if b.Err() == nil {
+		t.Errorf("Leaf() with relative path expected error, got none")
+	}
+	if _, _, _, err := b.WriteFiles(os.TempDir()); err == nil {
+		t.Errorf("WriteFiles() after error expected error, got none")
+	}
+}
+
+func TestNTPTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		time     time.Time
+		expected string
+	}{
+		{time: time.Unix(1545178344, 0), expected: "dfc4 0b68 0000 0000"},
+		{time: time.Unix(1545178344, 500000000), expected: "dfc4 0b68 8000 0000"},
+	} {
+		if got := NTPTimestamp(test.time); got != test.expected {
+			t.Errorf("NTPTimestamp(%v) = %q, expected %q", test.time, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+adaptergen generates the adapters with which the functions library calls registered functions without
+reflection (see functions.adapt), for each of the signatures listed in shapes. Run it (with go
+generate, in the functions package) after adding a shape:
+
+	go run ./adaptergen -output adapters.go
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+var output = flag.String("output", "adapters.go", "the file to write the adapters to")
+
+/*
+shape is the signature of a function: the types of its parameters, and of its results (a value,
+optionally followed by an error). Parameters may be interface{}, which is passed any argument, string
+or bool, which are passed arguments of that type only, or CallContext, which the library passes as the
+first argument of functions which take one.
+*/
+type shape struct {
+	params  []string
+	results []string
+}
+
+// The shapes of the functions registered with the library. Functions of other shapes are called via reflection.
+var shapes = []shape{
+	{params: []string{"interface{}"}, results: []string{"string", "error"}},
+	{params: []string{"interface{}"}, results: []string{"int", "error"}},
+	{params: []string{"interface{}"}, results: []string{"float64", "error"}},
+	{params: []string{"interface{}"}, results: []string{"uint64", "error"}},
+	{params: []string{"interface{}"}, results: []string{"bool", "error"}},
+	{params: []string{"interface{}"}, results: []string{"interface{}", "error"}},
+	{params: []string{"interface{}", "interface{}"}, results: []string{"float64", "error"}},
+	{params: []string{"interface{}", "interface{}", "interface{}"}, results: []string{"float64", "error"}},
+	{params: []string{"interface{}", "interface{}", "interface{}"}, results: []string{"interface{}", "error"}},
+	{params: []string{"CallContext", "interface{}", "string", "interface{}"}, results: []string{"float64", "error"}},
+	{params: []string{"interface{}", "string"}, results: []string{"string", "error"}},
+	{params: []string{"interface{}", "string"}, results: []string{"int", "error"}},
+	{params: []string{"interface{}", "string", "string"}, results: []string{"int", "error"}},
+	{params: []string{"interface{}", "string", "bool"}, results: []string{"interface{}", "error"}},
+	{params: []string{"string"}, results: []string{"interface{}", "error"}},
+	{params: []string{"string"}, results: []string{"string"}},
+	{params: []string{"string", "string"}, results: []string{"string"}},
+	{params: []string{"string", "string"}, results: []string{"bool"}},
+	{params: []string{"string", "string"}, results: []string{"map[string]interface{}", "error"}},
+	{params: []string{"string", "string", "string"}, results: []string{"string"}},
+	{params: []string{"string", "string", "string"}, results: []string{"interface{}", "error"}},
+	{params: []string{"string", "string", "interface{}"}, results: []string{"string", "error"}},
+	{params: []string{"string", "interface{}", "interface{}"}, results: []string{"string", "error"}},
+	{params: []string{"interface{}", "interface{}", "string"}, results: []string{"string", "error"}},
+}
+
+// signature returns the type of a function of the shape, eg: func(interface{}, string) (int, error).
+func (s shape) signature() string {
+	results := strings.Join(s.results, ", ")
+	if len(s.results) > 1 {
+		results = "(" + results + ")"
+	}
+	return fmt.Sprintf("func(%v) %v", strings.Join(s.params, ", "), results)
+}
+
+const header = `/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by adaptergen. DO NOT EDIT.
+
+package functions
+
+/*
+adapt returns an adapter for a function of one of the signature shapes used by the library, or
+false if the function must be called via reflection. To add a shape, add it to the shapes of
+adaptergen and run go generate.
+*/
+func adapt(funcName string, f interface{}) (adapter, bool) {
+	switch f := f.(type) {
+`
+
+// generate returns the source of the adapters of the given shapes, formatted as by gofmt.
+func generate(shapes []shape) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(header)
+	seen := map[string]bool{}
+	for _, s := range shapes {
+		signature := s.signature()
+		if seen[signature] {
+			return nil, fmt.Errorf("shape %v is listed twice", signature)
+		}
+		seen[signature] = true
+		if err := writeCase(&b, s); err != nil {
+			return nil, fmt.Errorf("shape %v: %v", signature, err)
+		}
+	}
+	b.WriteString("\t}\n\treturn adapter{}, false\n}\n")
+	return format.Source(b.Bytes())
+}
+
+// writeCase writes the case of adapt for functions of the given shape.
+func writeCase(b *bytes.Buffer, s shape) error {
+	if len(s.results) == 0 || len(s.results) > 2 || len(s.results) == 2 && s.results[1] != "error" {
+		return fmt.Errorf("functions must return a value, optionally followed by an error")
+	}
+	fmt.Fprintf(b, "case %v:\n", s.signature())
+	fmt.Fprintf(b, "return adapter{%v, func(args []interface{}) (interface{}, error) {\n", len(s.params))
+	// Arguments are numbered in errors as expressions pass them, without the context.
+	args, numbered := "args", 0
+	callArgs := make([]string, len(s.params))
+	for i, param := range s.params {
+		name := fmt.Sprintf("a%v", i)
+		switch param {
+		case "interface{}":
+			callArgs[i] = fmt.Sprintf("args[%v]", i)
+			continue
+		case "CallContext":
+			if i != 0 {
+				return fmt.Errorf("only the first parameter may be a CallContext")
+			}
+			fmt.Fprintf(b, "%v, err := contextArg(funcName, args)\n", name)
+			args, numbered = "args[1:]", 1
+		case "string":
+			fmt.Fprintf(b, "%v, err := stringArg(funcName, %v, %v)\n", name, args, i-numbered)
+		case "bool":
+			fmt.Fprintf(b, "%v, err := boolArg(funcName, %v, %v)\n", name, args, i-numbered)
+		default:
+			return fmt.Errorf("parameters of type %v are not supported", param)
+		}
+		b.WriteString("if err != nil {\nreturn nil, err\n}\n")
+		callArgs[i] = name
+	}
+	call := fmt.Sprintf("f(%v)", strings.Join(callArgs, ", "))
+	if len(s.results) == 1 {
+		call += ", nil"
+	}
+	fmt.Fprintf(b, "return %v\n}}, true\n", call)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	generated, err := generate(shapes)
+	if err != nil {
+		log.Fatalf("could not generate adapters: %v", err)
+	}
+	if err := ioutil.WriteFile(*output, generated, 0644); err != nil {
+		log.Fatalf("could not write adapters: %v", err)
+	}
+}
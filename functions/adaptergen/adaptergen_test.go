@@ -0,0 +1,75 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerateIsCurrent(t *testing.T) {
+	generated, err := generate(shapes)
+	if err != nil {
+		t.Fatalf("generate() got error: %v", err)
+	}
+	current, err := ioutil.ReadFile("../adapters.go")
+	if err != nil {
+		t.Fatalf("Could not read the generated adapters: %v", err)
+	}
+	if diff := cmp.Diff(string(current), string(generated)); diff != "" {
+		t.Errorf("adapters.go is out of date; run go generate in the functions package (-current +generated):\n%v", diff)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		shapes []shape
+	}{
+		{name: "shape listed twice", shapes: []shape{
+			{params: []string{"string"}, results: []string{"string"}},
+			{params: []string{"string"}, results: []string{"string"}},
+		}},
+		{name: "no results", shapes: []shape{{params: []string{"string"}}}},
+		{name: "second result not an error", shapes: []shape{{params: []string{"string"}, results: []string{"string", "string"}}}},
+		{name: "unsupported parameter", shapes: []shape{{params: []string{"int"}, results: []string{"string"}}}},
+		{name: "context not first", shapes: []shape{{params: []string{"string", "CallContext"}, results: []string{"string"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := generate(test.shapes); err == nil {
+				t.Errorf("generate(%v) got no error, expected an error", test.shapes)
+			}
+		})
+	}
+}
+
+func TestSignature(t *testing.T) {
+	for _, test := range []struct {
+		shape    shape
+		expected string
+	}{
+		{shape: shape{params: []string{"string"}, results: []string{"string"}}, expected: "func(string) string"},
+		{shape: shape{params: []string{"interface{}", "bool"}, results: []string{"int", "error"}}, expected: "func(interface{}, bool) (int, error)"},
+	} {
+		if got := test.shape.signature(); got != test.expected {
+			t.Errorf("signature() = %q, expected %q", got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by adaptergen. DO NOT EDIT.
+
+package functions
+
+/*
+adapt returns an adapter for a function of one of the signature shapes used by the library, or
+false if the function must be called via reflection. To add a shape, add it to the shapes of
+adaptergen and run go generate.
+*/
+func adapt(funcName string, f interface{}) (adapter, bool) {
+	switch f := f.(type) {
+	case func(interface{}) (string, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			return f(args[0])
+		}}, true
+	case func(interface{}) (int, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			return f(args[0])
+		}}, true
+	case func(interface{}) (float64, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			return f(args[0])
+		}}, true
+	case func(interface{}) (uint64, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			return f(args[0])
+		}}, true
+	case func(interface{}) (bool, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			return f(args[0])
+		}}, true
+	case func(interface{}) (interface{}, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			return f(args[0])
+		}}, true
+	case func(interface{}, interface{}) (float64, error):
+		return adapter{2, func(args []interface{}) (interface{}, error) {
+			return f(args[0], args[1])
+		}}, true
+	case func(interface{}, interface{}, interface{}) (float64, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			return f(args[0], args[1], args[2])
+		}}, true
+	case func(interface{}, interface{}, interface{}) (interface{}, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			return f(args[0], args[1], args[2])
+		}}, true
+	case func(CallContext, interface{}, string, interface{}) (float64, error):
+		return adapter{4, func(args []interface{}) (interface{}, error) {
+			a0, err := contextArg(funcName, args)
+			if err != nil {
+				return nil, err
+			}
+			a2, err := stringArg(funcName, args[1:], 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, args[1], a2, args[3])
+		}}, true
+	case func(interface{}, string) (string, error):
+		return adapter{2, func(args []interface{}) (interface{}, error) {
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(args[0], a1)
+		}}, true
+	case func(interface{}, string) (int, error):
+		return adapter{2, func(args []interface{}) (interface{}, error) {
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(args[0], a1)
+		}}, true
+	case func(interface{}, string, string) (int, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			a2, err := stringArg(funcName, args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return f(args[0], a1, a2)
+		}}, true
+	case func(interface{}, string, bool) (interface{}, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			a2, err := boolArg(funcName, args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return f(args[0], a1, a2)
+		}}, true
+	case func(string) (interface{}, error):
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0)
+		}}, true
+	case func(string) string:
+		return adapter{1, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0), nil
+		}}, true
+	case func(string, string) string:
+		return adapter{2, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, a1), nil
+		}}, true
+	case func(string, string) bool:
+		return adapter{2, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, a1), nil
+		}}, true
+	case func(string, string) (map[string]interface{}, error):
+		return adapter{2, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, a1)
+		}}, true
+	case func(string, string, string) string:
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			a2, err := stringArg(funcName, args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, a1, a2), nil
+		}}, true
+	case func(string, string, string) (interface{}, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			a2, err := stringArg(funcName, args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, a1, a2)
+		}}, true
+	case func(string, string, interface{}) (string, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			a1, err := stringArg(funcName, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, a1, args[2])
+		}}, true
+	case func(string, interface{}, interface{}) (string, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a0, err := stringArg(funcName, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return f(a0, args[1], args[2])
+		}}, true
+	case func(interface{}, interface{}, string) (string, error):
+		return adapter{3, func(args []interface{}) (interface{}, error) {
+			a2, err := stringArg(funcName, args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return f(args[0], args[1], a2)
+		}}, true
+	}
+	return adapter{}, false
+}
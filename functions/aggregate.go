@@ -0,0 +1,133 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Implementations of aggregation functions, over the values of a list or map, eg: the values of a table
+column returned by a walk (per-CPU load, keyed by index). Null values (eg: rows without the column) are
+ignored.
+*/
+
+func sum(values interface{}) (float64, error) {
+	numbers, err := toNumbers(values)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, n := range numbers {
+		total += n
+	}
+	return total, nil
+}
+
+func avg(values interface{}) (float64, error) {
+	numbers, err := toNumbers(values)
+	if err != nil {
+		return 0, err
+	}
+	if len(numbers) == 0 {
+		return 0, fmt.Errorf("cannot average no values")
+	}
+	total, _ := sum(numbers)
+	return total / float64(len(numbers)), nil
+}
+
+// count returns the number of values of a list or map which are not null.
+func count(values interface{}) (int, error) {
+	numbers, err := toNumbers(values)
+	return len(numbers), err
+}
+
+/*
+extremum returns a function applying f to two numbers (see binary), or, if the second is null, to the
+values of a list or map in turn, eg: min(a, b) or min(cpu_loads).
+*/
+func extremum(f func(float64, float64) float64) func(interface{}, interface{}) (float64, error) {
+	pair := binary(f)
+	return func(a, b interface{}) (float64, error) {
+		if b != nil {
+			return pair(a, b)
+		}
+		numbers, err := toNumbers(a)
+		if err != nil {
+			return 0, err
+		}
+		if len(numbers) == 0 {
+			return 0, fmt.Errorf("no values to compare")
+		}
+		result := numbers[0]
+		for _, n := range numbers[1:] {
+			result = f(result, n)
+		}
+		return result, nil
+	}
+}
+
+/*
+toNumbers returns the values of a list (a slice of any type) or a map with string keys which are not
+null, which must be numbers (see toNumber). The values of a map are in no particular order.
+*/
+func toNumbers(values interface{}) ([]float64, error) {
+	if numbers, ok := values.([]float64); ok {
+		return numbers, nil
+	}
+	v := reflect.ValueOf(values)
+	var elements []reflect.Value
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		for i := 0; i < v.Len(); i++ {
+			elements = append(elements, v.Index(i))
+		}
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			elements = append(elements, iter.Value())
+		}
+	default:
+		return nil, fmt.Errorf("value `%v` is not a list or map", values)
+	}
+	numbers := make([]float64, 0, len(elements))
+	for _, e := range elements {
+		if e.Kind() == reflect.Interface {
+			if e.IsNil() {
+				continue
+			}
+			e = e.Elem()
+		}
+		var n float64
+		switch e.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(e.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(e.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = e.Float()
+		default:
+			var err error
+			if n, err = toNumber(e.Interface()); err != nil {
+				return nil, err
+			}
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
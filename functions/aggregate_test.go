@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryAggregates(t *testing.T) {
+	loads := map[string]interface{}{"1": 10, "2": uint64(30), "3": nil, "4": "20"}
+	tests := []struct {
+		name         string
+		funcName     string
+		args         []interface{}
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "sum", funcName: "sum", args: []interface{}{[]interface{}{1, 2.5, "3"}}, expected: 6.5},
+		{name: "sum of a map", funcName: "sum", args: []interface{}{loads}, expected: 60.0},
+		{name: "sum of a typed list", funcName: "sum", args: []interface{}{[]uint32{1, 2}}, expected: 3.0},
+		{name: "empty sum", funcName: "sum", args: []interface{}{[]interface{}{}}, expected: 0.0},
+		{name: "sum of a non-list", funcName: "sum", args: []interface{}{1}, expectsError: true},
+		{name: "sum of an octet string", funcName: "sum", args: []interface{}{[]byte{1, 2}}, expectsError: true},
+		{name: "sum of non-numbers", funcName: "sum", args: []interface{}{[]string{"one"}}, expectsError: true},
+		{name: "avg", funcName: "avg", args: []interface{}{loads}, expected: 20.0},
+		{name: "avg ignores nulls", funcName: "avg", args: []interface{}{[]interface{}{nil, 4, nil}}, expected: 4.0},
+		{name: "empty avg", funcName: "avg", args: []interface{}{[]interface{}{nil}}, expectsError: true},
+		{name: "count", funcName: "count", args: []interface{}{loads}, expected: 3},
+		{name: "empty count", funcName: "count", args: []interface{}{map[string]int{}}, expected: 0},
+		{name: "min of a list", funcName: "min", args: []interface{}{[]int64{5, -2, 7}}, expected: -2.0},
+		{name: "max of a map", funcName: "max", args: []interface{}{loads}, expected: 30.0},
+		{name: "max of a list keyword arg", funcName: "max", args: []interface{}{oparse.KeywordArgs{"a": []float64{1, 3}}}, expected: 3.0},
+		{name: "empty max", funcName: "max", args: []interface{}{[]int{}}, expectsError: true},
+	}
+	library := NewLibrary()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call(test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("%v(%v) got error: %v", test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("%v(%v) = %v, expected error", test.funcName, test.args, got)
+			case err == nil && got != test.expected:
+				t.Errorf("%v(%v) = %v, expected %v", test.funcName, test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestAggregateExpression(t *testing.T) {
+	l := NewLibrary()
+	expression, err := oparse.Parse("round(avg(cpu_loads), 1) + max(cpu_loads) - count(cpu_loads)")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, l.Signatures()); err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	ctx := oparse.Context{"cpu_loads": map[string]uint32{"1": 4, "2": 5, "3": 7}}
+	got, err := oparse.Eval(expression, ctx, l.Call)
+	if expected := 5.3 + 7 - 3; err != nil || got != expected {
+		t.Errorf("Eval(%v) = %v, %v, expected %v", expression, got, err, expected)
+	}
+}
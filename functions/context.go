@@ -0,0 +1,77 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Code for functions which are passed metadata of the evaluation they are called for, eg: its target.
+
+/*
+CallContext describes the evaluation of an expression which calls a function. Functions whose first
+parameter is a CallContext are passed it by the library (see CallWithContext), eg: so that parsers can
+tell vendors apart without expressions passing the vendor as a string; expressions pass only the other
+arguments. Fields which are not known are empty, eg: Call passes an empty CallContext.
+*/
+type CallContext struct {
+	Target string    // The target the expression is evaluated for.
+	Vendor string    // The vendor (or model) of the target.
+	Time   time.Time // When the values of the expression were collected.
+}
+
+var callContextType = reflect.TypeOf(CallContext{})
+
+/*
+CallWithContext is like Call, for an expression evaluated in the given context, which is passed to
+functions which take one (see CallContext). Functions which keep state per target (see Target) are
+passed the context's target, so can only be called if it is set.
+*/
+func (l Library) CallWithContext(cc CallContext, funcName string, args ...interface{}) (interface{}, error) {
+	return l.call(cc, funcName, args)
+}
+
+// inject returns the arguments of a call, preceded by the argument which the library passes to the named function, if any (see injected).
+func (l Library) inject(cc CallContext, funcName string, args []interface{}) ([]interface{}, error) {
+	switch l.injected(funcName) {
+	case targetType:
+		if cc.Target == "" {
+			return nil, fmt.Errorf("function %q keeps state per target, so can only be called for a target", funcName)
+		}
+		return append([]interface{}{Target(cc.Target)}, args...), nil
+	case callContextType:
+		return append([]interface{}{cc}, args...), nil
+	}
+	return args, nil
+}
+
+/*
+injected returns the type of the first parameter of the named function if the library passes it,
+rather than expressions, ie: if it is a Target or CallContext. Otherwise, it returns nil.
+*/
+func (l Library) injected(funcName string) reflect.Type {
+	t := reflect.TypeOf(l.functions[funcName])
+	if t == nil || t.NumIn() == 0 {
+		return nil
+	}
+	if in := t.In(0); in == targetType || in == callContextType {
+		return in
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryCallWithContext(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"describe": func(cc CallContext, s string) string {
+			return fmt.Sprintf("%v %v %v %v", cc.Target, cc.Vendor, cc.Time.Unix(), s)
+		},
+		"owner": func(target Target) string { return string(target) },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	if l, err = l.WithArgNames("describe", "s"); err != nil {
+		t.Fatalf("WithArgNames() got error: %v", err)
+	}
+	cc := CallContext{Target: "r1", Vendor: "cisco", Time: time.Unix(1545178344, 0)}
+	tests := []struct {
+		name         string
+		call         func() (interface{}, error)
+		expected     interface{}
+		expectsError bool
+	}{
+		{
+			name:     "context",
+			call:     func() (interface{}, error) { return l.CallWithContext(cc, "describe", "x") },
+			expected: "r1 cisco 1545178344 x",
+		},
+		{
+			name:     "keyword args",
+			call:     func() (interface{}, error) { return l.CallWithContext(cc, "describe", oparse.KeywordArgs{"s": "y"}) },
+			expected: "r1 cisco 1545178344 y",
+		},
+		{
+			name:     "target",
+			call:     func() (interface{}, error) { return l.CallTarget("r2", "describe", "x") },
+			expected: fmt.Sprintf("r2  %v x", time.Time{}.Unix()),
+		},
+		{
+			name:     "empty context",
+			call:     func() (interface{}, error) { return l.Call("describe", "x") },
+			expected: fmt.Sprintf("  %v x", time.Time{}.Unix()),
+		},
+		{
+			name:     "target of context",
+			call:     func() (interface{}, error) { return l.CallWithContext(cc, "owner") },
+			expected: "r1",
+		},
+		{
+			name:         "target function without a target",
+			call:         func() (interface{}, error) { return l.CallWithContext(CallContext{Vendor: "cisco"}, "owner") },
+			expectsError: true,
+		},
+		{
+			name:         "context passed by expression",
+			call:         func() (interface{}, error) { return l.CallWithContext(cc, "describe", cc, "x") },
+			expectsError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.call()
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("got error: %v", err)
+			case err == nil && test.expectsError:
+				t.Errorf("got %v, expected error", got)
+			case err == nil && got != test.expected:
+				t.Errorf("got %q, expected %q", got, test.expected)
+			}
+		})
+	}
+
+	signature, err := l.Signature("describe")
+	if err != nil {
+		t.Fatalf("Signature() got error: %v", err)
+	}
+	if got, expected := signature.String(), "describe(s string) string"; got != expected {
+		t.Errorf("Signature() = %v, expected %v", got, expected)
+	}
+}
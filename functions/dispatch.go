@@ -0,0 +1,152 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+//go:generate go run ./adaptergen -output adapters.go
+
+/*
+adapter calls a registered function of a known signature without reflection, which otherwise
+dominates the cost of calls in tight polling loops. Adapters are generated (by adaptergen, see adapt)
+for the signatures of registered functions; functions of other signatures are called via reflection.
+Arguments are checked against the function's parameter types, so mistyped arguments yield errors (as
+they do via reflection, see coerce).
+*/
+type adapter struct {
+	numArgs int
+	call    func(args []interface{}) (interface{}, error)
+}
+
+// contextArg returns the first argument, which must be the context the library passes (see inject).
+func contextArg(funcName string, args []interface{}) (CallContext, error) {
+	cc, ok := args[0].(CallContext)
+	if !ok {
+		return CallContext{}, fmt.Errorf("function %q must be called with a context", funcName)
+	}
+	return cc, nil
+}
+
+// stringArg returns the i'th argument, which must be a string.
+func stringArg(funcName string, args []interface{}, i int) (string, error) {
+	arg, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %v of function %q must be a string, but got %T", i+1, funcName, args[i])
+	}
+	return arg, nil
+}
+
+// boolArg returns the i'th argument, which must be a bool.
+func boolArg(funcName string, args []interface{}, i int) (bool, error) {
+	arg, ok := args[i].(bool)
+	if !ok {
+		return false, fmt.Errorf("argument %v of function %q must be a bool, but got %T", i+1, funcName, args[i])
+	}
+	return arg, nil
+}
+
+/*
+coerce converts an argument to the type of the parameter it is passed to, for functions called via
+reflection: expressions produce numbers of whichever kind their arithmetic uses (eg: float64), so a
+number may be passed to a parameter of any numeric type which can represent it exactly, eg: 2.0 to an
+int, but not 2.5, or -1 to a uint. Strings and bools may be passed to types defined on them, and octet
+strings ([]byte) to strings. Other arguments must be assignable to their parameters.
+*/
+func coerce(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	converted := reflect.New(t).Elem()
+	switch {
+	case isInt(t.Kind()) && isNumber(v.Kind()):
+		if n, ok := exactInt(v); ok && !converted.OverflowInt(n) {
+			converted.SetInt(n)
+			return converted, nil
+		}
+	case isUint(t.Kind()) && isNumber(v.Kind()):
+		if n, ok := exactUint(v); ok && !converted.OverflowUint(n) {
+			converted.SetUint(n)
+			return converted, nil
+		}
+	case isFloat(t.Kind()) && isNumber(v.Kind()):
+		if f := floatValue(v); !converted.OverflowFloat(f) {
+			converted.SetFloat(f)
+			return converted, nil
+		}
+	case (t.Kind() == reflect.String || t.Kind() == reflect.Bool) && v.Kind() == t.Kind():
+		return v.Convert(t), nil
+	case t.Kind() == reflect.String && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		converted.SetString(string(v.Bytes()))
+		return converted, nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot convert %v (%v) to %v", v.Interface(), v.Type(), t)
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func isNumber(k reflect.Kind) bool {
+	return isInt(k) || isUint(k) || isFloat(k)
+}
+
+// exactInt returns a number as an int64, or false if it is not an integer which fits in one.
+func exactInt(v reflect.Value) (int64, bool) {
+	switch {
+	case isInt(v.Kind()):
+		return v.Int(), true
+	case isUint(v.Kind()):
+		return int64(v.Uint()), v.Uint() <= math.MaxInt64
+	}
+	f := v.Float()
+	return int64(f), f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+}
+
+// exactUint returns a number as a uint64, or false if it is not a non-negative integer which fits in one.
+func exactUint(v reflect.Value) (uint64, bool) {
+	switch {
+	case isInt(v.Kind()):
+		return uint64(v.Int()), v.Int() >= 0
+	case isUint(v.Kind()):
+		return v.Uint(), true
+	}
+	f := v.Float()
+	return uint64(f), f == math.Trunc(f) && f >= 0 && f < math.MaxUint64
+}
+
+// floatValue returns a number as a float64.
+func floatValue(v reflect.Value) float64 {
+	switch {
+	case isInt(v.Kind()):
+		return float64(v.Int())
+	case isUint(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
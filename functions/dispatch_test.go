@@ -0,0 +1,152 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegistryAdapted(t *testing.T) {
+	library := NewLibrary()
+	for name := range registry {
+		if _, ok := library.adapters[name]; !ok {
+			t.Errorf("function %q has no adapter and will be called via reflection; add its signature to the shapes of adaptergen and run go generate", name)
+		}
+	}
+}
+
+func TestAdaptersMatchReflection(t *testing.T) {
+	adapted := NewLibrary()
+	reflected := Library{functions: registry}
+	for _, test := range []struct {
+		funcName string
+		args     []interface{}
+	}{
+		{funcName: "to_int", args: []interface{}{"42"}},
+		{funcName: "to_int", args: []interface{}{42}},
+		{funcName: "to_int", args: []interface{}{"forty-two"}},
+		{funcName: "to_str", args: []interface{}{"hello"}},
+		{funcName: "to_str", args: []interface{}{42.0}},
+		{funcName: "time_since_epoch", args: []interface{}{"dfc4 0b68 8147 af78", "ntp", "ms"}},
+		{funcName: "time_since_epoch", args: []interface{}{"2018-12-18 15:15:59", "2006-01-02 15:04:05", "s"}},
+		{funcName: "time_since_epoch", args: []interface{}{"2018-12-18 15:15:59", "rfc3339", "s"}},
+		{funcName: "abs", args: []interface{}{-1.5}},
+		{funcName: "max", args: []interface{}{int64(2), uint64(3)}},
+		{funcName: "round", args: []interface{}{"2.5", 0}},
+		{funcName: "pow", args: []interface{}{"two", 2}},
+		{funcName: "upper", args: []interface{}{"eth0"}},
+		{funcName: "trim", args: []interface{}{" eth0 ", ""}},
+		{funcName: "contains", args: []interface{}{"eth0", "eth"}},
+		{funcName: "replace", args: []interface{}{"Gi0/1", "Gi", "GigabitEthernet"}},
+		{funcName: "split", args: []interface{}{"Gi0/1", "/", -1.0}},
+		{funcName: "substr", args: []interface{}{"Gi0/1", 2.0, 1.0}},
+		{funcName: "join", args: []interface{}{"uplink", nil, " - "}},
+		{funcName: "clamp", args: []interface{}{-127, -40, 125}},
+		{funcName: "safe_div", args: []interface{}{1, 0, nil}},
+		{funcName: "bytes_to_int", args: []interface{}{"\xff\xfe", "big", true}},
+		{funcName: "textfsm", args: []interface{}{"PSU1 is OK", "envmon"}},
+	} {
+		t.Run(test.funcName, func(t *testing.T) {
+			got, gotErr := adapted.Call(test.funcName, test.args...)
+			expected, expectedErr := reflected.Call(test.funcName, test.args...)
+			if (gotErr == nil) != (expectedErr == nil) {
+				t.Fatalf("Call(%q, %v) got error %v, expected %v", test.funcName, test.args, gotErr, expectedErr)
+			}
+			if !cmp.Equal(got, expected) {
+				t.Errorf("Call(%q, %v) = %v, expected %v", test.funcName, test.args, got, expected)
+			}
+		})
+	}
+}
+
+func TestAdapterErrors(t *testing.T) {
+	library := NewLibrary()
+	for _, test := range []struct {
+		name     string
+		funcName string
+		args     []interface{}
+	}{
+		{name: "too few arguments", funcName: "time_since_epoch", args: []interface{}{"dfc4 0b68 8147 af78"}},
+		{name: "too many arguments", funcName: "to_int", args: []interface{}{"1", "2"}},
+		{name: "format is not a string", funcName: "time_since_epoch", args: []interface{}{"dfc4 0b68 8147 af78", 1.0, "s"}},
+		{name: "units are not a string", funcName: "time_since_epoch", args: []interface{}{"dfc4 0b68 8147 af78", "ntp", 1.0}},
+		{name: "substring is not a string", funcName: "contains", args: []interface{}{"eth0", 0.0}},
+		{name: "new is not a string", funcName: "replace", args: []interface{}{"eth0", "eth", nil}},
+		{name: "separator is not a string", funcName: "split", args: []interface{}{"eth0", 0.0, 0.0}},
+		{name: "value is not a string", funcName: "substr", args: []interface{}{0.0, 0.0, 1.0}},
+		{name: "separator of join is not a string", funcName: "join", args: []interface{}{"a", "b", 0.0}},
+		{name: "signed is not a bool", funcName: "bytes_to_int", args: []interface{}{"\x01", "big", 1.0}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := library.Call(test.funcName, test.args...); err == nil {
+				t.Errorf("Call(%q, %v) = %v, expected error", test.funcName, test.args, got)
+			}
+		})
+	}
+}
+
+func TestReflectionCoercion(t *testing.T) {
+	type status string
+	library, err := NewLibrary().With(map[string]interface{}{
+		"twice":     func(n int) int { return 2 * n },
+		"octet":     func(n uint8) uint8 { return n },
+		"half":      func(f float32) float32 { return f / 2 },
+		"status":    func(s status) string { return "status " + string(s) },
+		"negate":    func(b bool) bool { return !b },
+		"row_count": func(row map[string]interface{}) int { return len(row) },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	tests := []struct {
+		name         string
+		funcName     string
+		args         []interface{}
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "float to int", funcName: "twice", args: []interface{}{2.0}, expected: 4},
+		{name: "uint64 to int", funcName: "twice", args: []interface{}{uint64(2)}, expected: 4},
+		{name: "fractional float to int", funcName: "twice", args: []interface{}{2.5}, expectsError: true},
+		{name: "string to int", funcName: "twice", args: []interface{}{"2"}, expectsError: true},
+		{name: "uint64 beyond int", funcName: "twice", args: []interface{}{uint64(1) << 63}, expectsError: true},
+		{name: "float to uint8", funcName: "octet", args: []interface{}{255.0}, expected: uint8(255)},
+		{name: "overflowing uint8", funcName: "octet", args: []interface{}{256}, expectsError: true},
+		{name: "negative uint8", funcName: "octet", args: []interface{}{int64(-1)}, expectsError: true},
+		{name: "int to float32", funcName: "half", args: []interface{}{3}, expected: float32(1.5)},
+		{name: "string to defined string", funcName: "status", args: []interface{}{"up"}, expected: "status up"},
+		{name: "octets to defined string", funcName: "status", args: []interface{}{[]byte("up")}, expected: "status up"},
+		{name: "number to bool", funcName: "negate", args: []interface{}{1.0}, expectsError: true},
+		{name: "nil map", funcName: "row_count", args: []interface{}{nil}, expected: 0},
+		{name: "map of the wrong type", funcName: "row_count", args: []interface{}{map[string]int{"a": 1}}, expectsError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call(test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("%v(%v) got error: %v", test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("%v(%v) = %v, expected error", test.funcName, test.args, got)
+			case err == nil && got != test.expected:
+				t.Errorf("%v(%v) = %v (%T), expected %v", test.funcName, test.args, got, got, test.expected)
+			}
+		})
+	}
+}
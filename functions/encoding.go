@@ -0,0 +1,209 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+/*
+Implementations of functions decoding OctetStrings (and DisplayStrings) from devices. Expressions have
+no bytes type, so octet strings are strings holding the raw octets (as oparse casts []byte values).
+*/
+
+// hexToInt parses a hex string (see hexDigits) as an unsigned integer of up to 64 bits, eg: "0x00 1F" is 31.
+func hexToInt(value interface{}) (uint64, error) {
+	digits, err := hexDigits(value)
+	if err != nil {
+		return 0, err
+	}
+	if digits == "" {
+		return 0, fmt.Errorf("%q has no hex digits", value)
+	}
+	result, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %q as a hex integer: %v", value, err)
+	}
+	return result, nil
+}
+
+// hexToBytes returns the octets of a hex string (see hexDigits), eg: "48:69" is "Hi".
+func hexToBytes(value interface{}) (string, error) {
+	digits, err := hexDigits(value)
+	if err != nil {
+		return "", err
+	}
+	octets, err := hex.DecodeString(digits)
+	if err != nil {
+		return "", fmt.Errorf("could not decode %q as hex: %v", value, err)
+	}
+	return string(octets), nil
+}
+
+/*
+hexDigits returns the hex digits of a string as devices and tools print octet strings, eg: "0x001A2B",
+"00 1A 2B" or "0:1a:2b", with an optional 0x prefix and groups of digits separated by spaces, colons,
+dashes or dots. Groups of an odd number of digits are padded with a leading zero, as in MAC addresses.
+*/
+func hexDigits(value interface{}) (string, error) {
+	s, err := toStr(value)
+	if err != nil {
+		return "", err
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	var digits strings.Builder
+	for _, group := range strings.FieldsFunc(s, isHexSeparator) {
+		if len(group)%2 == 1 {
+			digits.WriteByte('0')
+		}
+		digits.WriteString(group)
+	}
+	return digits.String(), nil
+}
+
+func isHexSeparator(r rune) bool {
+	return r == ' ' || r == ':' || r == '-' || r == '.' || r == '\t' || r == '\n'
+}
+
+/*
+base64Decode returns the octets encoded by a base64 string (RFC 4648), eg: "SGk=" is "Hi", as some
+vendors' REST APIs deliver binary values. Both the standard and the URL-safe alphabets are accepted,
+with or without padding, and whitespace (eg: line breaks) is ignored.
+*/
+func base64Decode(value interface{}) (string, error) {
+	s, err := toStr(value)
+	if err != nil {
+		return "", err
+	}
+	s = strings.Join(strings.Fields(s), "")
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(s, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	octets, err := encoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return "", fmt.Errorf("could not decode %q as base64: %v", value, err)
+	}
+	return string(octets), nil
+}
+
+/*
+bytesToInt returns the integer packed in 1 to 8 octets, in big ("big", network order) or little
+("little") endian order, eg: "\x01\x00" is 256 in big endian order. It is a uint64, or an int64 (in
+two's complement) if signed.
+*/
+func bytesToInt(value interface{}, order string, signed bool) (interface{}, error) {
+	octets, err := toStr(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(octets) == 0 || len(octets) > 8 {
+		return nil, fmt.Errorf("%q has %v octets, expected 1 to 8", value, len(octets))
+	}
+	var result uint64
+	switch strings.ToLower(order) {
+	case "big":
+		for i := 0; i < len(octets); i++ {
+			result = result<<8 | uint64(octets[i])
+		}
+	case "little":
+		for i := len(octets) - 1; i >= 0; i-- {
+			result = result<<8 | uint64(octets[i])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported byte order %q, expected \"big\" or \"little\"", order)
+	}
+	if !signed {
+		return result, nil
+	}
+	// Extend the sign bit of the most significant octet.
+	shift := uint(64 - 8*len(octets))
+	return int64(result<<shift) >> shift, nil
+}
+
+/*
+octetsToStr decodes the octets of an octet string (eg: a DisplayString) in the given charset: "utf-8"
+(whose invalid sequences are replaced with U+FFFD), "ascii", "latin1" (ISO-8859-1), "utf-16" (big
+endian, unless it starts with a byte order mark), "utf-16be" or "utf-16le". Charsets are matched
+ignoring case, dashes and underscores. Trailing NULs, which pad fixed-length strings, are removed.
+*/
+func octetsToStr(value interface{}, charset string) (string, error) {
+	octets, err := toStr(value)
+	if err != nil {
+		return "", err
+	}
+	switch normalizeCharset(charset) {
+	case "utf8":
+		return strings.TrimRight(strings.ToValidUTF8(octets, string(utf8.RuneError)), "\x00"), nil
+	case "ascii", "usascii":
+		for i := 0; i < len(octets); i++ {
+			if octets[i] >= utf8.RuneSelf {
+				return "", fmt.Errorf("%q is not ascii: octet %v is %#x", value, i, octets[i])
+			}
+		}
+		return strings.TrimRight(octets, "\x00"), nil
+	case "latin1", "iso88591":
+		runes := make([]rune, len(octets))
+		for i := 0; i < len(octets); i++ {
+			runes[i] = rune(octets[i])
+		}
+		return strings.TrimRight(string(runes), "\x00"), nil
+	case "utf16":
+		switch {
+		case strings.HasPrefix(octets, "\xfe\xff"):
+			return decodeUTF16(octets[2:], true)
+		case strings.HasPrefix(octets, "\xff\xfe"):
+			return decodeUTF16(octets[2:], false)
+		}
+		return decodeUTF16(octets, true)
+	case "utf16be":
+		return decodeUTF16(octets, true)
+	case "utf16le":
+		return decodeUTF16(octets, false)
+	}
+	return "", fmt.Errorf("unsupported charset %q", charset)
+}
+
+// normalizeCharset returns the name of a charset in lower case, without dashes or underscores.
+func normalizeCharset(charset string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(charset))
+}
+
+// decodeUTF16 decodes UTF-16 octets of the given byte order, removing trailing NULs.
+func decodeUTF16(octets string, bigEndian bool) (string, error) {
+	if len(octets)%2 == 1 {
+		return "", fmt.Errorf("%q has an odd number of octets, so is not utf-16", octets)
+	}
+	units := make([]uint16, len(octets)/2)
+	for i := range units {
+		hi, lo := octets[2*i], octets[2*i+1]
+		if !bigEndian {
+			hi, lo = lo, hi
+		}
+		units[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00"), nil
+}
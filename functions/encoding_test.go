@@ -0,0 +1,103 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		funcName     string
+		args         []interface{}
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "hex_to_int", funcName: "hex_to_int", args: []interface{}{"1F"}, expected: uint64(31)},
+		{name: "hex_to_int with prefix", funcName: "hex_to_int", args: []interface{}{"0x00 1f"}, expected: uint64(31)},
+		{name: "hex_to_int of 64 bits", funcName: "hex_to_int", args: []interface{}{"FF FF FF FF FF FF FF FF"}, expected: uint64(18446744073709551615)},
+		{name: "hex_to_int of too many bits", funcName: "hex_to_int", args: []interface{}{"01 00 00 00 00 00 00 00 00"}, expectsError: true},
+		{name: "hex_to_int of non-hex", funcName: "hex_to_int", args: []interface{}{"0xZZ"}, expectsError: true},
+		{name: "hex_to_int of nothing", funcName: "hex_to_int", args: []interface{}{"0x"}, expectsError: true},
+		{name: "hex_to_int of a number", funcName: "hex_to_int", args: []interface{}{31}, expectsError: true},
+		{name: "hex_to_bytes", funcName: "hex_to_bytes", args: []interface{}{"48 65 6C 6C 6F"}, expected: "Hello"},
+		{name: "hex_to_bytes of a MAC address", funcName: "hex_to_bytes", args: []interface{}{"0:1a:2b:3c:4d:5e"}, expected: "\x00\x1a\x2b\x3c\x4d\x5e"},
+		{name: "hex_to_bytes with prefix", funcName: "hex_to_bytes", args: []interface{}{"0x4869"}, expected: "Hi"},
+		{name: "hex_to_bytes of odd digits", funcName: "hex_to_bytes", args: []interface{}{"0x123"}, expected: "\x01\x23"},
+		{name: "hex_to_bytes of nothing", funcName: "hex_to_bytes", args: []interface{}{""}, expected: ""},
+		{name: "hex_to_bytes of non-hex", funcName: "hex_to_bytes", args: []interface{}{"4G"}, expectsError: true},
+		{name: "octets_to_str", funcName: "octets_to_str", args: []interface{}{"eth0\x00\x00"}, expected: "eth0"},
+		{name: "octets_to_str of invalid utf-8", funcName: "octets_to_str", args: []interface{}{"caf\xe9"}, expected: "caf�"},
+		{name: "octets_to_str of latin1", funcName: "octets_to_str", args: []interface{}{"caf\xe9", "ISO-8859-1"}, expected: "café"},
+		{name: "octets_to_str of ascii", funcName: "octets_to_str", args: []interface{}{"eth0", "US-ASCII"}, expected: "eth0"},
+		{name: "octets_to_str of non-ascii", funcName: "octets_to_str", args: []interface{}{"caf\xe9", "ascii"}, expectsError: true},
+		{name: "octets_to_str of utf-16", funcName: "octets_to_str", args: []interface{}{"\x00e\x00t\x00h\x000", "utf-16"}, expected: "eth0"},
+		{name: "octets_to_str of utf-16 with a byte order mark", funcName: "octets_to_str", args: []interface{}{"\xff\xfee\x00\xe9\x00", "UTF_16"}, expected: "eé"},
+		{name: "octets_to_str of utf-16le", funcName: "octets_to_str", args: []interface{}{"h\x00i\x00\x00\x00", "utf-16le"}, expected: "hi"},
+		{name: "octets_to_str of odd utf-16", funcName: "octets_to_str", args: []interface{}{"\x00e\x00", "utf-16be"}, expectsError: true},
+		{name: "octets_to_str of unknown charset", funcName: "octets_to_str", args: []interface{}{"eth0", "ebcdic"}, expectsError: true},
+		{name: "base64_decode", funcName: "base64_decode", args: []interface{}{"SGVsbG8="}, expected: "Hello"},
+		{name: "base64_decode without padding", funcName: "base64_decode", args: []interface{}{"SGVsbG8"}, expected: "Hello"},
+		{name: "base64_decode of lines", funcName: "base64_decode", args: []interface{}{"SGVs\nbG8=\n"}, expected: "Hello"},
+		{name: "base64_decode of url-safe", funcName: "base64_decode", args: []interface{}{"_-8"}, expected: "\xff\xef"},
+		{name: "base64_decode of standard", funcName: "base64_decode", args: []interface{}{"/+8="}, expected: "\xff\xef"},
+		{name: "base64_decode of non-base64", funcName: "base64_decode", args: []interface{}{"SGV*"}, expectsError: true},
+		{name: "bytes_to_int", funcName: "bytes_to_int", args: []interface{}{"\x01\x00"}, expected: uint64(256)},
+		{name: "bytes_to_int little endian", funcName: "bytes_to_int", args: []interface{}{"\x01\x00", "little"}, expected: uint64(1)},
+		{name: "bytes_to_int of 64 bits", funcName: "bytes_to_int", args: []interface{}{"\xff\xff\xff\xff\xff\xff\xff\xff"}, expected: uint64(18446744073709551615)},
+		{name: "bytes_to_int signed", funcName: "bytes_to_int", args: []interface{}{"\xff\x81", "big", true}, expected: int64(-127)},
+		{name: "bytes_to_int signed positive", funcName: "bytes_to_int", args: []interface{}{"\x7f", "big", true}, expected: int64(127)},
+		{name: "bytes_to_int signed little endian", funcName: "bytes_to_int", args: []interface{}{oparse.KeywordArgs{"value": "\x00\x80", "order": "little", "signed": true}}, expected: int64(-32768)},
+		{name: "bytes_to_int of too many octets", funcName: "bytes_to_int", args: []interface{}{"\x01\x00\x00\x00\x00\x00\x00\x00\x00"}, expectsError: true},
+		{name: "bytes_to_int of nothing", funcName: "bytes_to_int", args: []interface{}{""}, expectsError: true},
+		{name: "bytes_to_int of unknown order", funcName: "bytes_to_int", args: []interface{}{"\x01", "middle"}, expectsError: true},
+		{name: "octets_to_str keyword args", funcName: "octets_to_str", args: []interface{}{oparse.KeywordArgs{"value": "caf\xe9", "charset": "latin1"}}, expected: "café"},
+	}
+	library := NewLibrary()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call(test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Call(%q, %q) got error: %v", test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("Call(%q, %q) = %q, expected error", test.funcName, test.args, got)
+			case err == nil && got != test.expected:
+				t.Errorf("Call(%q, %q) = %q, expected %q", test.funcName, test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestEncodingExpressions(t *testing.T) {
+	// Eg: the hostname of a device, from an OctetString printed as hex.
+	expression, err := oparse.Parse("upper(octets_to_str(hex_to_bytes(name), 'latin1'))")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, NewLibrary().Signatures()); err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	context := oparse.Context{"name": "72 6F 75 74 65 72 E9 00"}
+	got, err := oparse.Eval(expression, context, NewLibrary().Call)
+	if err != nil || got != "ROUTERÉ" {
+		t.Errorf("Eval(%v) = %v, %v, expected ROUTERÉ", expression, got, err)
+	}
+}
@@ -23,12 +23,15 @@ package functions
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/google/orismologer/oparse"
+	"github.com/google/orismologer/store"
 	"github.com/google/orismologer/utils"
 )
 
@@ -36,7 +39,188 @@ import (
 var registry = map[string]interface{}{
 	"to_int":           toInt,
 	"to_str":           toStr,
+	"to_bool":          toBool,
+	"to_uint64":        toUint64,
 	"time_since_epoch": timeSinceEpoch,
+	"abs":              unary(math.Abs),
+	"ceil":             unary(math.Ceil),
+	"floor":            unary(math.Floor),
+	"round":            round,
+	"sqrt":             sqrt,
+	"log":              logarithm(math.Log),
+	"log2":             logarithm(math.Log2),
+	"pow":              pow,
+	"safe_div":         safeDiv,
+	"ratio":            ratio,
+	"percent":          percent,
+	"clamp":            clamp,
+	"assert_range":     assertRange,
+	"min":              extremum(math.Min),
+	"max":              extremum(math.Max),
+	"sum":              sum,
+	"avg":              avg,
+	"count":            count,
+	"split":            split,
+	"join":             join,
+	"substr":           substr,
+	"trim":             trim,
+	"upper":            strings.ToUpper,
+	"lower":            strings.ToLower,
+	"replace":          replace,
+	"contains":         contains,
+	"counter_delta32":  counterDelta32,
+	"hex_to_int":       hexToInt,
+	"hex_to_bytes":     hexToBytes,
+	"octets_to_str":    octetsToStr,
+	"base64_decode":    base64Decode,
+	"bytes_to_int":     bytesToInt,
+	"date_and_time":    dateAndTime,
+	"lookup":           lookup,
+	"oid_index":        oidIndex,
+	"textfsm":          noTemplates,
+}
+
+/*
+The names of the arguments of registered functions, which can be passed as keyword arguments, eg:
+`time_since_epoch(t, format='ntp', units='ms')` (see oparse.KeywordArgs). Functions without names
+only take positional arguments.
+*/
+var argNames = map[string][]string{
+	"to_int":           {"value"},
+	"to_str":           {"value"},
+	"to_bool":          {"value"},
+	"to_uint64":        {"value"},
+	"time_since_epoch": {"value", "format", "units"},
+	"abs":              {"value"},
+	"ceil":             {"value"},
+	"floor":            {"value"},
+	"round":            {"value", "digits"},
+	"sqrt":             {"value"},
+	"log":              {"value"},
+	"log2":             {"value"},
+	"pow":              {"base", "exponent"},
+	"safe_div":         {"a", "b", "default"},
+	"ratio":            {"a", "b"},
+	"percent":          {"part", "whole"},
+	"clamp":            {"value", "lo", "hi"},
+	"assert_range":     {"value", "lo", "hi"},
+	"sum":              {"values"},
+	"avg":              {"values"},
+	"count":            {"values"},
+	"min":              {"a", "b"},
+	"max":              {"a", "b"},
+	"split":            {"value", "separator", "index"},
+	"join":             {"a", "b", "separator"},
+	"substr":           {"value", "start", "length"},
+	"trim":             {"value", "chars"},
+	"upper":            {"value"},
+	"lower":            {"value"},
+	"replace":          {"value", "old", "new"},
+	"contains":         {"value", "substring"},
+	"counter_delta32":  {"prev", "curr"},
+	"hex_to_int":       {"value"},
+	"hex_to_bytes":     {"value"},
+	"octets_to_str":    {"value", "charset"},
+	"base64_decode":    {"value"},
+	"bytes_to_int":     {"value", "order", "signed"},
+	"date_and_time":    {"value", "units"},
+	"oid_index":        {"oid", "base", "syntax"},
+	"textfsm":          {"output", "template"},
+	"rate":             {"counter", "key", "bits"},
+	"delta":            {"counter", "key", "bits"},
+}
+
+// Descriptions of registered functions, for users (see Library.Signature).
+var docs = map[string]string{
+	"to_int":           "Converts a string of an integer (eg: \"42\"), or an int, to an int.",
+	"to_str":           "Returns a string value, which must already be a string.",
+	"to_uint64":        "Converts a non-negative integer, or a string of one, to an unsigned integer of up to 64 bits (eg: a Counter64), without converting it to a float.",
+	"to_bool":          "Converts a bool, 0 or 1, an SNMP TruthValue (1 is true, 2 false), or a string of one or of \"true\", \"yes\", \"on\", \"up\" or \"enabled\" (or their opposites), to a bool.",
+	"time_since_epoch": "Converts a timestamp of the given format (\"ntp\", \"rfc3339\" or a Go time layout) to the time since the Unix epoch, in units of \"s\", \"ms\" or \"ns\".",
+	"abs":              "Returns the absolute value of a number.",
+	"ceil":             "Rounds a number up to an integer.",
+	"floor":            "Rounds a number down to an integer.",
+	"round":            "Rounds a number (half away from zero) to the given number of digits after the point, or to a multiple of a power of ten if digits is negative.",
+	"sqrt":             "Returns the square root of a non-negative number.",
+	"log":              "Returns the natural logarithm of a positive number.",
+	"log2":             "Returns the binary logarithm of a positive number.",
+	"pow":              "Returns base to the power of exponent.",
+	"safe_div":         "Divides a by b, or returns default (by default, null) if b is zero, eg: for the counters of an idle interface.",
+	"ratio":            "Divides a by b, or returns 0 if b is zero.",
+	"percent":          "Returns part as a percentage of whole, or 0 if whole is zero, eg: percent(octets * 8, speed).",
+	"clamp":            "Limits a number to the range from lo to hi (inclusive).",
+	"assert_range":     "Returns a number if it is in the range from lo to hi (inclusive), and fails otherwise, eg: assert_range(temperature, -40, 125) rejects a faulty sensor's -127.",
+	"min":              "Returns the smaller of two numbers, or the smallest value of a list or map if only one is given.",
+	"max":              "Returns the larger of two numbers, or the largest value of a list or map if only one is given.",
+	"sum":              "Returns the sum of the values of a list or map (eg: a walked table column), ignoring nulls.",
+	"avg":              "Returns the mean of the values of a list or map (eg: a walked table column), ignoring nulls.",
+	"count":            "Returns the number of values of a list or map (eg: a walked table column) which are not null.",
+	"split":            "Splits a string at each separator, returning the field at index (counting from the end if negative).",
+	"join":             "Joins two strings with a separator, omitting nulls and empty strings.",
+	"substr":           "Returns up to length characters of a string from start (counting from the end if negative), or the rest of the string if length is negative.",
+	"trim":             "Removes the given characters (by default, whitespace) from both ends of a string.",
+	"upper":            "Converts a string to upper case.",
+	"lower":            "Converts a string to lower case.",
+	"replace":          "Replaces every occurrence of old in a string with new.",
+	"contains":         "Returns whether a string contains a substring.",
+	"counter_delta32":  "Returns how much a Counter32 increased from prev to curr, assuming it wrapped at 2^32 if curr is smaller.",
+	"hex_to_int":       "Parses a hex string (eg: \"0x1F\" or \"00 1F\") as an unsigned integer of up to 64 bits.",
+	"hex_to_bytes":     "Decodes a hex string (eg: \"48:69\") to the octets it represents, as a string.",
+	"base64_decode":    "Decodes a base64 string (standard or URL-safe, with or without padding) to the octets it represents, as a string.",
+	"bytes_to_int":     "Returns the integer packed in 1 to 8 octets, in \"big\" or \"little\" endian order, as an unsigned integer, or a signed one (in two's complement) if signed.",
+	"octets_to_str":    "Decodes an octet string in the given charset (\"utf-8\", \"ascii\", \"latin1\", \"utf-16\", \"utf-16be\" or \"utf-16le\"), removing trailing NULs.",
+	"lookup":           "Evaluates another OpenConfig path (without keys) for the same target, eg: lookup('/interfaces/interface/state/high-speed').",
+	"oid_index":        "Returns the index of an OID after a base OID, as a dotted string, or decoded with a syntax of comma-separated (optionally named) int, ip, string or implied objects, eg: 'if_index:int, addr:ip'.",
+	"textfsm":          "Parses CLI output with a TextFSM template, returning its records by the values of the template's Key values (joined by '|'), or by position ('0', '1', ...), eg: textfsm(output, 'envmon')['PSU1'].status.",
+	"date_and_time":    "Converts an SNMPv2-TC DateAndTime octet string (RFC 2579; taken as UTC without a time zone) to the time since the Unix epoch, in units of \"s\", \"ms\" or \"ns\".",
+	"rate":             "Returns the per-second rate at which a counter of the given bits (32 or 64) increased since its previous sample for the target, identified by key. A 32 bit counter which decreased is assumed to have wrapped.",
+	"delta":            "Returns how much a counter of the given bits (32 or 64) increased since its previous sample for the target, identified by key. A 32 bit counter which decreased is assumed to have wrapped.",
+}
+
+// Descriptions of the arguments of registered functions whose meaning their names do not make plain, by name (see Library.WithArgDoc).
+var argDocs = map[string]map[string]string{
+	"time_since_epoch": {
+		"format": "\"ntp\" (hex, eg: \"dfc4 0b68 8147 af78\"), \"rfc3339\", or a Go time layout, eg: \"2006-01-02 15:04:05\".",
+		"units":  "The units of the result: \"s\", \"ms\" or \"ns\".",
+	},
+	"round":         {"digits": "The number of digits after the point, or before it if negative."},
+	"safe_div":      {"default": "The result if b is zero."},
+	"clamp":         {"lo": "The smallest number returned.", "hi": "The largest number returned."},
+	"assert_range":  {"lo": "The smallest valid number.", "hi": "The largest valid number."},
+	"split":         {"index": "The index of the field to return, counting from the end if negative (eg: -1 is the last field)."},
+	"join":          {"separator": "Separates the strings, if neither is null or empty."},
+	"substr":        {"start": "The index of the first character, counting from the end if negative.", "length": "The most characters to return, or -1 for the rest of the string."},
+	"trim":          {"chars": "The characters to remove, or \"\" for whitespace."},
+	"octets_to_str": {"charset": "\"utf-8\", \"ascii\", \"latin1\", \"utf-16\", \"utf-16be\" or \"utf-16le\"."},
+	"bytes_to_int":  {"order": "The byte order of the octets: \"big\" or \"little\" endian.", "signed": "Whether the integer is signed (in two's complement)."},
+	"date_and_time": {"units": "The units of the result: \"s\", \"ms\" or \"ns\"."},
+	"oid_index": {
+		"base":   "The OID of the table column (or entry) the OID is an instance of.",
+		"syntax": "Comma-separated index objects (int, ip, string or implied), each named if there are several, or \"\" for the dotted index.",
+	},
+	"textfsm": {"template": "The name of the template, ie: its file name without \".textfsm\"."},
+	"rate":    {"key": "Identifies the counter among those of the target, eg: its OID.", "bits": "The width of the counter: 32 or 64."},
+	"delta":   {"key": "Identifies the counter among those of the target, eg: its OID.", "bits": "The width of the counter: 32 or 64."},
+}
+
+/*
+The default values of the trailing arguments of registered functions, which calls may omit, eg:
+`time_since_epoch(t, 'ntp')` is `time_since_epoch(t, 'ntp', 's')`.
+*/
+var defaults = map[string][]interface{}{
+	"time_since_epoch": {"s"},
+	"round":            {0},
+	"safe_div":         {nil},
+	"min":              {nil},
+	"max":              {nil},
+	"substr":           {-1},
+	"trim":             {""},
+	"octets_to_str":    {"utf-8"},
+	"bytes_to_int":     {"big", false},
+	"date_and_time":    {"s"},
+	"oid_index":        {""},
+	"rate":             {64},
+	"delta":            {64},
 }
 
 // Implementations of functions.
@@ -62,6 +246,35 @@ func toInt(value interface{}) (int, error) {
 	return result, nil
 }
 
+/*
+toUint64 converts a non-negative integer (of any of the types expressions evaluate to), or a string of
+one, to a uint64, eg: a Counter64, which to_int cannot hold beyond math.MaxInt64. Floats are accepted if
+they are integers, though they are only exact up to 2^53.
+*/
+func toUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case int:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case int64:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case float64:
+		if v >= 0 && v == math.Trunc(v) && v < math.MaxUint64 {
+			return uint64(v), nil
+		}
+	case string:
+		if result, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return result, nil
+		}
+	}
+	return 0, fmt.Errorf("value `%v` could not be converted to uint64", value)
+}
+
 func toFloat(value interface{}) (float64, error) {
 	if str, err := toStr(value); err == nil {
 		if result, err := strconv.ParseFloat(str, 64); err == nil {
@@ -75,6 +288,44 @@ func toFloat(value interface{}) (float64, error) {
 	return result, nil
 }
 
+/*
+toBool converts a value to a bool: a bool, the numbers 0 (false) and 1 (true), or 2 (false) as an SNMP
+TruthValue (1 is true), or a string of one of these, or of "true", "yes", "on", "up" or "enabled"
+(true), or "false", "no", "off", "down" or "disabled" (false), in any case. Other values are errors,
+rather than being truthy, so that unexpected values from devices are not silently mapped.
+*/
+func toBool(value interface{}) (bool, error) {
+	if b, ok := value.(bool); ok {
+		return b, nil
+	}
+	if s, ok := value.(string); ok {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "true", "yes", "on", "up", "enabled":
+			return true, nil
+		case "false", "no", "off", "down", "disabled":
+			return false, nil
+		}
+	}
+	if n, err := toNumber(value); err == nil {
+		switch n {
+		case 1:
+			return true, nil
+		case 0, 2:
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("value `%v` could not be converted to bool", value)
+}
+
+/*
+lookup evaluates another OpenConfig path for the target of an expression. Only Orismologer, which knows
+the path's transformation and the target, can evaluate it (see orismologer.Orismologer.Eval); the
+library declares it so that expressions calling it are valid.
+*/
+func lookup(path string) (interface{}, error) {
+	return nil, fmt.Errorf("lookup(%q) can only be evaluated by Orismologer, for a target", path)
+}
+
 /*
 timeSinceEpoch returns the amount of time since the Unix epoch (1970-01-01) in the requested units.
 Format can be "rfc3339", "ntp" or any time format string understood by Go's time.Parse().
@@ -108,6 +359,44 @@ func timeSinceEpoch(value interface{}, format string, units string) (int, error)
 			return 0, fmt.Errorf("error parsing timestamp %q of format %q: %v", value, format, err)
 		}
 	}
+	return sinceEpoch(t, units)
+}
+
+/*
+dateAndTime returns the amount of time since the Unix epoch, in the requested units, of an SNMPv2-TC
+DateAndTime (RFC 2579), eg: hrSystemDate. This is an octet string of 8 octets (year (2 octets, big
+endian), month, day, hour, minutes, seconds and deci-seconds), optionally followed by 3 octets of time
+zone (direction from UTC ('+' or '-'), hours and minutes). Times without a time zone are taken as UTC.
+*/
+func dateAndTime(value interface{}, units string) (int, error) {
+	octets, ok := value.(string)
+	if !ok || len(octets) != 8 && len(octets) != 11 {
+		return 0, fmt.Errorf("value %q is not a DateAndTime of 8 or 11 octets", value)
+	}
+	year := int(octets[0])<<8 | int(octets[1])
+	month, day, hour, minutes, seconds, deciSeconds := octets[2], octets[3], octets[4], octets[5], octets[6], octets[7]
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minutes > 59 || seconds > 60 || deciSeconds > 9 {
+		return 0, fmt.Errorf("DateAndTime %q is out of range", value)
+	}
+	location := time.UTC
+	if len(octets) == 11 {
+		direction, zoneHours, zoneMinutes := octets[8], octets[9], octets[10]
+		if direction != '+' && direction != '-' || zoneHours > 14 || zoneMinutes > 59 {
+			return 0, fmt.Errorf("DateAndTime %q has an invalid time zone", value)
+		}
+		offset := int(zoneHours)*60*60 + int(zoneMinutes)*60
+		if direction == '-' {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+	// A leap second (60) is normalized to the first second of the next minute.
+	t := time.Date(year, time.Month(month), int(day), int(hour), int(minutes), int(seconds), int(deciSeconds)*100000000, location)
+	return sinceEpoch(t, units)
+}
+
+// sinceEpoch returns the amount of time since the Unix epoch of a time, in units of "s", "ms" or "ns".
+func sinceEpoch(t time.Time, units string) (int, error) {
 	switch units {
 	case "s":
 		return int(t.Unix()), nil
@@ -123,41 +412,189 @@ func timeSinceEpoch(value interface{}, format string, units string) (int, error)
 // Code to handle and call library functions.
 
 /*
-Library contains a predefined collection of functions which may be called via a string key.
+Library contains a predefined collection of functions which may be called via a string key. A library
+is never modified once built: its With methods return modified copies, sharing nothing which either
+may change, so a library may be called concurrently. To register functions while expressions are
+evaluated, use a Registry.
 */
 type Library struct {
 	functions map[string]interface{}
+	adapters  map[string]adapter           // Functions which can be called without reflection.
+	argNames  map[string][]string          // The names of the arguments of functions which take keyword arguments.
+	defaults  map[string][]interface{}     // The default values of the trailing arguments of functions.
+	docs      map[string]string            // Descriptions of functions, for users (see Signature).
+	argDocs   map[string]map[string]string // Descriptions of the arguments of functions, by name (see WithArgDoc).
+	timeouts  map[string]time.Duration     // How long calls of functions may take (see WithTimeout).
+	memos     map[string]*Memo             // Where the results of functions are cached (see WithMemo).
 }
 
-// NewLibrary returns a new function library.
+// NewLibrary returns a new function library, whose rate and delta functions keep their samples in memory (see WithHistory).
 func NewLibrary() Library {
-	return newLibrary(registry)
+	l := newLibrary(registry, argNames, defaults)
+	l.docs, l.argDocs = docs, argDocs
+	return l.WithHistory(NewHistory(store.NewMemory(), DefaultHistoryTTL))
+}
+
+func newLibrary(registry map[string]interface{}, argNames map[string][]string, defaults map[string][]interface{}) Library {
+	return Library{functions: registry, adapters: adapters(registry), argNames: argNames, defaults: defaults}
 }
 
-func newLibrary(registry map[string]interface{}) Library {
-	return Library{functions: registry}
+// adapters returns the adapters of the functions which can be called without reflection (see adapt).
+func adapters(registry map[string]interface{}) map[string]adapter {
+	adapters := map[string]adapter{}
+	for name, f := range registry {
+		if a, ok := adapt(name, f); ok {
+			adapters[name] = a
+		}
+	}
+	return adapters
 }
 
 /*
 Call calls a function from a predefined collected, given only the function's name as a string and
-any arguments to be passed to it.
+any arguments to be passed to it. Omitted trailing arguments take their default values (see
+WithDefaults). Functions of common signatures are called directly (see adapt); others via reflection.
+Functions which keep state per target cannot be called (see CallTarget), and functions which take a
+CallContext are passed an empty one (see CallWithContext). A function which panics returns an error
+instead, as does one which exceeds its timeout (see WithTimeout). The results of memoized functions
+may be reused (see WithMemo).
 */
 func (l Library) Call(funcName string, args ...interface{}) (interface{}, error) {
+	return l.call(CallContext{}, funcName, args)
+}
+
+/*
+CallTarget is like Call, for an expression evaluated for the given target, so that functions which
+keep state per target (see Target) can be called too.
+*/
+func (l Library) CallTarget(target, funcName string, args ...interface{}) (interface{}, error) {
+	return l.call(CallContext{Target: target}, funcName, args)
+}
+
+// logCall logs a call of a function at verbosity 2, as every call of every evaluation is logged.
+func logCall(funcName string, args []interface{}) {
+	if glog.V(2) { // Checked first, so that the arguments are not even formatted otherwise.
+		glog.Infof("Calling %q with args: %v", funcName, utils.SliceToString(args))
+	}
+}
+
+func (l Library) call(cc CallContext, funcName string, args []interface{}) (interface{}, error) {
+	if len(args) > 0 {
+		if keywords, ok := args[len(args)-1].(oparse.KeywordArgs); ok {
+			var err error
+			if args, err = l.positional(funcName, args[:len(args)-1], keywords); err != nil {
+				return nil, err
+			}
+		}
+	}
+	args, err := l.inject(cc, funcName, args)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := l.adapters[funcName]; ok {
+		args = l.withDefaults(funcName, args, a.numArgs)
+		if len(args) != a.numArgs {
+			return nil, l.arityError(funcName, a.numArgs, len(args))
+		}
+		logCall(funcName, args)
+		return l.memoize(funcName, args, a.call)
+	}
 	f, err := l.getFunc(funcName)
 	if err != nil {
 		return nil, err
 	}
 
 	numArgsExpected := f.Type().NumIn()
+	args = l.withDefaults(funcName, args, numArgsExpected)
 	numArgs := len(args)
 	if numArgs != numArgsExpected {
-		return nil, fmt.Errorf("function %q expects %v arguments, but got %v", funcName, numArgsExpected, numArgs)
+		return nil, l.arityError(funcName, numArgsExpected, numArgs)
+	}
+
+	wrappedArgs, err := l.wrapArgs(funcName, f.Type(), args)
+	if err != nil {
+		return nil, err
+	}
+	logCall(funcName, args)
+	return l.memoize(funcName, args, func([]interface{}) (interface{}, error) {
+		// The arguments are already wrapped, so are not read from the slice.
+		return unwrapOutput(f.Call(wrappedArgs), funcName)
+	})
+}
+
+/*
+positional returns the arguments of a call with keyword arguments as positional arguments, in the
+order of the function's argument names. Every argument without a default value must be given, either
+by position or keyword.
+*/
+func (l Library) positional(funcName string, args []interface{}, keywords oparse.KeywordArgs) ([]interface{}, error) {
+	names := l.argNames[funcName]
+	if len(names) == 0 {
+		return nil, fmt.Errorf("function %q does not take keyword arguments", funcName)
+	}
+	if len(args) > len(names) {
+		return nil, l.arityError(funcName, len(names), len(args)+len(keywords))
+	}
+	positional := make([]interface{}, len(names))
+	copy(positional, args)
+	for name, value := range keywords {
+		i := indexOf(names, name)
+		if i < 0 {
+			return nil, fmt.Errorf("function %q has no argument %q", funcName, name)
+		}
+		if i < len(args) {
+			return nil, fmt.Errorf("argument %q of function %q is given twice", name, funcName)
+		}
+		positional[i] = value
+	}
+	defaults := l.defaults[funcName]
+	for i := len(args); i < len(names); i++ {
+		if _, ok := keywords[names[i]]; ok {
+			continue
+		}
+		if j := i - (len(names) - len(defaults)); j >= 0 {
+			positional[i] = defaults[j]
+			continue
+		}
+		return nil, fmt.Errorf("function %q is missing argument %q", funcName, names[i])
+	}
+	return positional, nil
+}
+
+/*
+withDefaults returns the arguments of a call of a function of numArgs arguments with any omitted
+trailing arguments set to their default values. The given args are not modified, as callers may reuse
+them.
+*/
+func (l Library) withDefaults(funcName string, args []interface{}, numArgs int) []interface{} {
+	defaults := l.defaults[funcName]
+	missing := numArgs - len(args)
+	if missing <= 0 || missing > len(defaults) {
+		return args
+	}
+	full := make([]interface{}, 0, numArgs)
+	full = append(full, args...)
+	return append(full, defaults[len(defaults)-missing:]...)
+}
+
+// arityError reports a call of a function of numArgs arguments with the wrong number of arguments.
+func (l Library) arityError(funcName string, numArgs, got int) error {
+	if l.injected(funcName) != nil {
+		numArgs, got = numArgs-1, got-1 // Expressions do not pass the target or context.
+	}
+	if optional := len(l.defaults[funcName]); optional > 0 {
+		return fmt.Errorf("function %q expects %v to %v arguments, but got %v", funcName, numArgs-optional, numArgs, got)
 	}
+	return fmt.Errorf("function %q expects %v arguments, but got %v", funcName, numArgs, got)
+}
 
-	wrappedArgs := wrapArgs(args...)
-	glog.Info(fmt.Sprintf("Calling %q with args: %v\n", funcName, utils.SliceToString(args)))
-	output := f.Call(wrappedArgs)
-	return unwrapOutput(output, funcName)
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
 }
 
 func (l Library) getFunc(funcName string) (reflect.Value, error) {
@@ -167,13 +604,29 @@ func (l Library) getFunc(funcName string) (reflect.Value, error) {
 	return reflect.ValueOf(l.functions[funcName]), nil
 }
 
-// wrapArgs wraps each arg in a reflect.Value.
-func wrapArgs(args ...interface{}) []reflect.Value {
+/*
+wrapArgs wraps each arg of the named function, of type t, in a reflect.Value converted to the type of
+its parameter (see coerce), and nil args as the zero value of their parameter. It is an error if an
+arg cannot be converted, as reflection would panic.
+*/
+func (l Library) wrapArgs(funcName string, t reflect.Type, args []interface{}) ([]reflect.Value, error) {
 	wrappedArgs := make([]reflect.Value, len(args))
 	for i, arg := range args {
-		wrappedArgs[i] = reflect.ValueOf(arg)
+		if arg == nil {
+			wrappedArgs[i] = reflect.Zero(t.In(i))
+			continue
+		}
+		v, err := coerce(reflect.ValueOf(arg), t.In(i))
+		if err != nil {
+			n := i + 1
+			if l.injected(funcName) != nil {
+				n-- // Numbered as expressions pass them, without the target or context.
+			}
+			return nil, fmt.Errorf("argument %v of function %q: %v", n, funcName, err)
+		}
+		wrappedArgs[i] = v
 	}
-	return wrappedArgs
+	return wrappedArgs, nil
 }
 
 // unwrapOutput unwraps output wrapped in reflect.Value.
@@ -200,7 +653,134 @@ func unwrapOutput(output []reflect.Value, funcName string) (interface{}, error)
 	}
 }
 
+/*
+With returns a library containing this library's functions and the given ones, which must follow the
+same conventions as registered functions. Names must not clash with functions already defined.
+*/
+func (l Library) With(functions map[string]interface{}) (Library, error) {
+	merged := map[string]interface{}{}
+	for name, f := range l.functions {
+		merged[name] = f
+	}
+	for name, f := range functions {
+		if l.Contains(name) {
+			return Library{}, fmt.Errorf("function %q is already defined", name)
+		}
+		t := reflect.TypeOf(f)
+		if t == nil || t.Kind() != reflect.Func {
+			return Library{}, fmt.Errorf("%q is not a function", name)
+		}
+		if t.NumOut() < 1 || t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != reflect.TypeOf((*error)(nil)).Elem() {
+			return Library{}, fmt.Errorf("function %q must return a value, optionally followed by an error", name)
+		}
+		merged[name] = f
+	}
+	l.functions, l.adapters = merged, adapters(merged)
+	return l, nil
+}
+
+/*
+WithArgNames returns a library in which the named function takes keyword arguments, with the given
+names for its arguments, in order.
+*/
+func (l Library) WithArgNames(funcName string, names ...string) (Library, error) {
+	if !l.Contains(funcName) {
+		return Library{}, fmt.Errorf("function %q undefined", funcName)
+	}
+	if numIn := l.numArgs(funcName); len(names) != numIn {
+		return Library{}, fmt.Errorf("function %q has %v arguments, but got %v names", funcName, numIn, len(names))
+	}
+	for i, name := range names {
+		if indexOf(names[:i], name) >= 0 {
+			return Library{}, fmt.Errorf("argument name %q of function %q is repeated", name, funcName)
+		}
+	}
+	merged := map[string][]string{funcName: names}
+	for name, n := range l.argNames {
+		if name != funcName {
+			merged[name] = n
+		}
+	}
+	l.argNames = merged
+	return l, nil
+}
+
+/*
+WithDefaults returns a library in which calls of the named function may omit its trailing arguments,
+which then take the given default values, eg: WithDefaults("time_since_epoch", "s") lets calls omit
+the last argument (units). Defaults must be assignable to their arguments' types.
+*/
+func (l Library) WithDefaults(funcName string, defaults ...interface{}) (Library, error) {
+	if !l.Contains(funcName) {
+		return Library{}, fmt.Errorf("function %q undefined", funcName)
+	}
+	t := reflect.TypeOf(l.functions[funcName])
+	if len(defaults) > l.numArgs(funcName) {
+		return Library{}, fmt.Errorf("function %q has %v arguments, but got %v defaults", funcName, l.numArgs(funcName), len(defaults))
+	}
+	for i, d := range defaults {
+		in := t.In(t.NumIn() - len(defaults) + i)
+		if d == nil && in.Kind() != reflect.Interface || d != nil && !reflect.TypeOf(d).AssignableTo(in) {
+			return Library{}, fmt.Errorf("default %v of argument %v of function %q is not a %v", d, l.numArgs(funcName)-len(defaults)+i+1, funcName, in)
+		}
+	}
+	merged := map[string][]interface{}{funcName: defaults}
+	for name, d := range l.defaults {
+		if name != funcName {
+			merged[name] = d
+		}
+	}
+	l.defaults = merged
+	return l, nil
+}
+
+// numArgs returns the number of arguments expressions pass to the named function.
+func (l Library) numArgs(funcName string) int {
+	numIn := reflect.TypeOf(l.functions[funcName]).NumIn()
+	if l.injected(funcName) != nil {
+		return numIn - 1
+	}
+	return numIn
+}
+
 // Contains returns true if a function with the given name has been defined.
 func (l Library) Contains(funcName string) bool {
 	return l.functions[funcName] != nil
 }
+
+// Signatures returns the signatures of the library's functions, eg: to validate expressions (see oparse.Validate).
+func (l Library) Signatures() map[string]oparse.Signature {
+	signatures := map[string]oparse.Signature{}
+	for name := range l.functions {
+		signatures[name] = l.signature(name)
+	}
+	return signatures
+}
+
+func (l Library) signature(funcName string) oparse.Signature {
+	t := reflect.TypeOf(l.functions[funcName])
+	signature := oparse.Signature{Result: kind(t.Out(0)), Names: l.argNames[funcName], Optional: len(l.defaults[funcName])}
+	for i := t.NumIn() - l.numArgs(funcName); i < t.NumIn(); i++ {
+		signature.Args = append(signature.Args, kind(t.In(i)))
+	}
+	return signature
+}
+
+// kind returns the kind of expression value corresponding to a Go type.
+func kind(t reflect.Type) oparse.Kind {
+	switch t.Kind() {
+	case reflect.String:
+		return oparse.StringKind
+	case reflect.Bool:
+		return oparse.BoolKind
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return oparse.IntKind
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return oparse.UintKind
+	case reflect.Float32, reflect.Float64:
+		return oparse.FloatKind
+	case reflect.Map:
+		return oparse.MapKind
+	}
+	return oparse.AnyKind
+}
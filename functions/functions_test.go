@@ -18,8 +18,12 @@ package functions
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
 )
 
 func TestLibraryCall(t *testing.T) {
@@ -52,6 +56,36 @@ func TestLibraryCall(t *testing.T) {
 			funcName:     "dummy",
 			expectsError: true,
 		},
+		{
+			name:     "keyword argument",
+			funcName: "dummy",
+			args:     []interface{}{oparse.KeywordArgs{"arg": "test"}},
+			expected: "test",
+		},
+		{
+			name:         "unknown keyword argument",
+			funcName:     "dummy",
+			args:         []interface{}{oparse.KeywordArgs{"value": "test"}},
+			expectsError: true,
+		},
+		{
+			name:         "argument given by position and keyword",
+			funcName:     "dummy",
+			args:         []interface{}{"test", oparse.KeywordArgs{"arg": "test"}},
+			expectsError: true,
+		},
+		{
+			name:         "missing keyword argument",
+			funcName:     "dummy",
+			args:         []interface{}{oparse.KeywordArgs{}},
+			expectsError: true,
+		},
+		{
+			name:         "function without keyword arguments",
+			funcName:     "oneOutput",
+			args:         []interface{}{oparse.KeywordArgs{"arg": "test"}},
+			expectsError: true,
+		},
 		{
 			name:     "one output",
 			funcName: "oneOutput",
@@ -93,6 +127,163 @@ func TestLibraryCall(t *testing.T) {
 	}
 }
 
+func TestLibraryWith(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"shout": func(s string) string { return strings.ToUpper(s) },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	if got, err := l.Call("shout", "up"); err != nil || got != "UP" {
+		t.Errorf("Call(\"shout\", \"up\") = %v, %v, expected \"UP\", nil", got, err)
+	}
+	if !l.Contains("to_int") {
+		t.Errorf("With() dropped existing functions")
+	}
+	if NewLibrary().Contains("shout") {
+		t.Errorf("With() modified the original library")
+	}
+	for name, f := range map[string]interface{}{
+		"to_int":           func(s string) string { return s },
+		"not_func":         "to_int",
+		"no_outputs":       func() {},
+		"second_not_error": func() (int, int) { return 0, 0 },
+	} {
+		if _, err := NewLibrary().With(map[string]interface{}{name: f}); err == nil {
+			t.Errorf("With(%q) expected error, got none", name)
+		}
+	}
+}
+
+func TestLibraryWithArgNames(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"quotient": func(a, b float64) float64 { return a / b },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	named, err := l.WithArgNames("quotient", "numerator", "denominator")
+	if err != nil {
+		t.Fatalf("WithArgNames() got error: %v", err)
+	}
+	if got, err := named.Call("quotient", 1.0, oparse.KeywordArgs{"denominator": 4.0}); err != nil || got != 0.25 {
+		t.Errorf("Call(\"quotient\", 1, denominator=4) = %v, %v, expected 0.25, nil", got, err)
+	}
+	if _, err := l.Call("quotient", 1.0, oparse.KeywordArgs{"denominator": 4.0}); err == nil {
+		t.Errorf("WithArgNames() modified the original library")
+	}
+	for _, names := range [][]string{{"numerator"}, {"a", "a"}} {
+		if _, err := l.WithArgNames("quotient", names...); err == nil {
+			t.Errorf("WithArgNames(\"quotient\", %v) expected error, got none", names)
+		}
+	}
+	if _, err := l.WithArgNames("undefined", "a"); err == nil {
+		t.Errorf("WithArgNames(\"undefined\") expected error, got none")
+	}
+}
+
+func TestLibraryWithDefaults(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"scale": func(value interface{}, factor float64, offset float64) (float64, error) {
+			f, err := toFloat(value)
+			return f*factor + offset, err
+		},
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	if l, err = l.WithArgNames("scale", "value", "factor", "offset"); err != nil {
+		t.Fatalf("WithArgNames() got error: %v", err)
+	}
+	withDefaults, err := l.WithDefaults("scale", 100.0, 0.5)
+	if err != nil {
+		t.Fatalf("WithDefaults() got error: %v", err)
+	}
+	for _, test := range []struct {
+		name     string
+		args     []interface{}
+		expected float64
+	}{
+		{name: "all arguments", args: []interface{}{"2", 10.0, 1.0}, expected: 21},
+		{name: "one default", args: []interface{}{"2", 10.0}, expected: 20.5},
+		{name: "all defaults", args: []interface{}{"2"}, expected: 200.5},
+		{name: "keyword argument", args: []interface{}{"2", oparse.KeywordArgs{"offset": 1.0}}, expected: 201},
+	} {
+		if got, err := withDefaults.Call("scale", test.args...); err != nil || got != test.expected {
+			t.Errorf("Call(\"scale\") with %v = %v, %v, expected %v, nil", test.name, got, err, test.expected)
+		}
+	}
+	for _, args := range [][]interface{}{{}, {oparse.KeywordArgs{"factor": 1.0}}, {"2", 1.0, 1.0, 1.0}} {
+		if got, err := withDefaults.Call("scale", args...); err == nil {
+			t.Errorf("Call(\"scale\", %v) = %v, expected an error", args, got)
+		}
+	}
+	if _, err := l.Call("scale", "2"); err == nil {
+		t.Errorf("WithDefaults() modified the original library")
+	}
+	if got, err := withDefaults.With(map[string]interface{}{"other": toInt}); err != nil || !got.Contains("other") {
+		t.Errorf("With() after WithDefaults() got error: %v", err)
+	} else if _, err := got.Call("scale", "2"); err != nil {
+		t.Errorf("With() dropped defaults: %v", err)
+	}
+
+	for _, defaults := range [][]interface{}{{1.0, 1.0, 1.0, 1.0}, {"1"}, {nil}} {
+		if _, err := l.WithDefaults("scale", defaults...); err == nil {
+			t.Errorf("WithDefaults(\"scale\", %v) expected error, got none", defaults)
+		}
+	}
+	if _, err := l.WithDefaults("undefined", 1); err == nil {
+		t.Errorf("WithDefaults(\"undefined\") expected error, got none")
+	}
+	// Registered defaults must be valid too.
+	for name, d := range defaults {
+		if _, err := NewLibrary().WithDefaults(name, d...); err != nil {
+			t.Errorf("registered defaults of %q are invalid: %v", name, err)
+		}
+	}
+}
+
+func TestLibraryKeywordArgs(t *testing.T) {
+	expression, err := oparse.Parse("time_since_epoch(t, units='ms', format='ntp')")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	got, err := oparse.Eval(expression, oparse.Context{"t": "dfc40b688147af78"}, NewLibrary().Call)
+	if err != nil || got != 1545178344505.0 {
+		t.Errorf("Eval(%v) = %v, %v, expected 1545178344505", expression, got, err)
+	}
+
+	// Units default to seconds.
+	if expression, err = oparse.Parse("time_since_epoch(t, format='ntp')"); err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	got, err = oparse.Eval(expression, oparse.Context{"t": "dfc40b688147af78"}, NewLibrary().Call)
+	if err != nil || got != 1545178344.0 {
+		t.Errorf("Eval(%v) = %v, %v, expected 1545178344", expression, got, err)
+	}
+}
+
+func TestLibrarySignatures(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"quotient": func(a, b uint64) (float64, error) { return float64(a) / float64(b), nil },
+		"row":      func(up bool) map[string]interface{} { return nil },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	signatures := l.Signatures()
+	for name, expected := range map[string]oparse.Signature{
+		"to_int":           {Args: []oparse.Kind{oparse.AnyKind}, Result: oparse.IntKind, Names: []string{"value"}},
+		"time_since_epoch": {Args: []oparse.Kind{oparse.AnyKind, oparse.StringKind, oparse.StringKind}, Result: oparse.IntKind, Names: []string{"value", "format", "units"}, Optional: 1},
+		"quotient":         {Args: []oparse.Kind{oparse.UintKind, oparse.UintKind}, Result: oparse.FloatKind},
+		"row":              {Args: []oparse.Kind{oparse.BoolKind}, Result: oparse.MapKind},
+	} {
+		if diff := cmp.Diff(expected, signatures[name]); diff != "" {
+			t.Errorf("Signatures()[%q] returned unexpected signature (-expected +got):\n%v", name, diff)
+		}
+	}
+}
+
 func TestLibraryToInt(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -151,6 +342,85 @@ func TestLibraryToInt(t *testing.T) {
 	}
 }
 
+func TestLibraryToUint64(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        interface{}
+		expected     uint64
+		expectsError bool
+	}{
+		{name: "uint64", input: uint64(math.MaxUint64), expected: math.MaxUint64},
+		{name: "int64", input: int64(42), expected: 42},
+		{name: "string beyond int64", input: "18446744073709551615", expected: math.MaxUint64},
+		{name: "integral float", input: 1e6, expected: 1000000},
+		{name: "negative", input: int64(-1), expectsError: true},
+		{name: "fractional float", input: 1.5, expectsError: true},
+		{name: "string beyond uint64", input: "18446744073709551616", expectsError: true},
+		{name: "bool", input: true, expectsError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := toUint64(test.input)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("toUint64(%v) expected %v, got error: %v", test.input, test.expected, err)
+			case err == nil && test.expectsError:
+				t.Errorf("toUint64(%v) got: %v, expected error", test.input, got)
+			case err == nil && got != test.expected:
+				t.Errorf("toUint64(%v) = %v, expected: %v", test.input, got, test.expected)
+			}
+		})
+	}
+
+	// Counter64s are carried intact by the default (float) arithmetic.
+	expression, err := oparse.Parse("to_uint64(in_octets)")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	context := oparse.Context{"in_octets": uint64(math.MaxUint64 - 1)}
+	if got, err := oparse.Eval(expression, context, NewLibrary().Call); err != nil || got != uint64(math.MaxUint64-1) {
+		t.Errorf("Eval(%v) = %v (%T), %v, expected %v", expression, got, got, err, uint64(math.MaxUint64-1))
+	}
+}
+
+func TestLibraryToBool(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        interface{}
+		expected     bool
+		expectsError bool
+	}{
+		{name: "bool", input: true, expected: true},
+		{name: "one", input: int64(1), expected: true},
+		{name: "zero", input: 0, expected: false},
+		{name: "TruthValue false", input: uint64(2), expected: false},
+		{name: "float", input: 1.0, expected: true},
+		{name: "string of a number", input: "2", expected: false},
+		{name: "true", input: "True", expected: true},
+		{name: "up", input: "up", expected: true},
+		{name: "enabled", input: " ENABLED ", expected: true},
+		{name: "down", input: "down", expected: false},
+		{name: "disabled", input: "disabled", expected: false},
+		{name: "other number", input: 3, expectsError: true},
+		{name: "other string", input: "testing", expectsError: true},
+		{name: "empty string", input: "", expectsError: true},
+		{name: "null", input: nil, expectsError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := toBool(test.input)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("toBool(%v) expected %v, got error: %v", test.input, test.expected, err)
+			case err == nil && test.expectsError:
+				t.Errorf("toBool(%v) got: %v, expected error", test.input, got)
+			case err == nil && got != test.expected:
+				t.Errorf("toBool(%v) = %v, expected: %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
 func TestLibraryToStr(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -336,6 +606,68 @@ func TestLibraryTimeSinceEpoch(t *testing.T) {
 	}
 }
 
+func TestLibraryDateAndTime(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        interface{}
+		units        string
+		expected     int
+		expectsError bool
+	}{
+		{name: "with time zone", value: "\x07\xe2\x0c\x13\x0b\x0c\x18\x00+\x0b\x00", units: "s", expected: 1545178344},
+		{name: "west of UTC", value: "\x07\xe2\x0c\x12\x13\x0c\x18\x00-\x05\x00", units: "s", expected: 1545178344},
+		{name: "with zone minutes", value: "\x07\xe2\x0c\x13\x05\x2a\x18\x00+\x05\x1e", units: "s", expected: 1545178344},
+		{name: "without time zone", value: "\x07\xe2\x0c\x19\x00\x0c\x18\x00", units: "s", expected: 1545696744},
+		{name: "deci-seconds to ms", value: "\x07\xe2\x0c\x19\x00\x0c\x18\x05", units: "ms", expected: 1545696744500},
+		{name: "too short", value: "\x07\xe2\x0c\x19\x00\x0c\x18", units: "s", expectsError: true},
+		{name: "not an octet string", value: 1545178344, units: "s", expectsError: true},
+		{name: "month out of range", value: "\x07\xe2\x0d\x19\x00\x0c\x18\x00", units: "s", expectsError: true},
+		{name: "invalid direction", value: "\x07\xe2\x0c\x13\x0b\x0c\x18\x00*\x0b\x00", units: "s", expectsError: true},
+		{name: "invalid units", value: "\x07\xe2\x0c\x19\x00\x0c\x18\x00", units: "h", expectsError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := dateAndTime(test.value, test.units)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("dateAndTime(%q, %q) expected %v, got error: %v", test.value, test.units, test.expected, err)
+			case err == nil && test.expectsError:
+				t.Errorf("dateAndTime(%q, %q) got: %v, expected error", test.value, test.units, got)
+			case err == nil && got != test.expected:
+				t.Errorf("dateAndTime(%q, %q) = %v, expected: %v", test.value, test.units, got, test.expected)
+			}
+		})
+	}
+	// Units default to seconds.
+	got, err := NewLibrary().Call("date_and_time", "\x07\xe2\x0c\x13\x0b\x0c\x18\x00+\x0b\x00")
+	if err != nil || got != 1545178344 {
+		t.Errorf("Call(\"date_and_time\") = %v, %v, expected 1545178344", got, err)
+	}
+}
+
+func BenchmarkLibraryCall(b *testing.B) {
+	library := NewLibrary()
+	for _, bm := range []struct {
+		name     string
+		funcName string
+		args     []interface{}
+	}{
+		{name: "to_int", funcName: "to_int", args: []interface{}{"2000000000"}},
+		{name: "to_str", funcName: "to_str", args: []interface{}{"42"}},
+		{name: "time_since_epoch ntp", funcName: "time_since_epoch", args: []interface{}{"dfc4 0b68 8147 af78", "ntp", "s"}},
+		{name: "time_since_epoch layout", funcName: "time_since_epoch", args: []interface{}{"2018-12-18 15:15:59", "2006-01-02 15:04:05", "s"}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := library.Call(bm.funcName, bm.args...); err != nil {
+					b.Fatalf("Call(%q) got error: %v", bm.funcName, err)
+				}
+			}
+		})
+	}
+}
+
 func makeDummyLibrary() Library {
 	registry := map[string]interface{}{
 		"dummy":                dummy,
@@ -344,7 +676,7 @@ func makeDummyLibrary() Library {
 		"oneOutput":            oneOutput,
 		"secondOutputNotError": secondOutputNotError,
 	}
-	return newLibrary(registry)
+	return newLibrary(registry, map[string][]string{"dummy": {"arg"}}, nil)
 }
 
 func dummy(arg string) string {
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Code to guard evaluation against misbehaving functions, eg: those of plugins, which may panic or hang.
+
+/*
+WithTimeout returns a library in which calls of the named function fail once they take longer than
+timeout, eg: for a function of a plugin which does I/O. A timeout of zero removes the limit. A call
+which times out is abandoned rather than stopped: it runs on in the background until it returns, and
+its result is discarded.
+*/
+func (l Library) WithTimeout(funcName string, timeout time.Duration) (Library, error) {
+	if !l.Contains(funcName) {
+		return Library{}, fmt.Errorf("function %q undefined", funcName)
+	}
+	if timeout < 0 {
+		return Library{}, fmt.Errorf("timeout %v of function %q is negative", timeout, funcName)
+	}
+	merged := map[string]time.Duration{}
+	for name, t := range l.timeouts {
+		if name != funcName {
+			merged[name] = t
+		}
+	}
+	if timeout > 0 {
+		merged[funcName] = timeout
+	}
+	l.timeouts = merged
+	return l, nil
+}
+
+/*
+invoke calls the named function with the given arguments via call, within its timeout if it has one
+(see WithTimeout). A call which may be abandoned is given a copy of the arguments, as the caller may
+reuse their slice once invoke returns (eg: the stack of arguments of an oparse evaluation, which is
+pooled).
+*/
+func (l Library) invoke(funcName string, args []interface{}, call func(args []interface{}) (interface{}, error)) (interface{}, error) {
+	timeout, ok := l.timeouts[funcName]
+	if !ok {
+		return protect(funcName, func() (interface{}, error) { return call(args) })
+	}
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1) // Buffered, so that an abandoned call can still finish.
+	copied := append([]interface{}(nil), args...)
+	go func() {
+		result, err := protect(funcName, func() (interface{}, error) { return call(copied) })
+		done <- outcome{result, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C:
+		return nil, fmt.Errorf("function %q timed out after %v", funcName, timeout)
+	}
+}
+
+/*
+protect calls the named function via call, returning an error rather than panicking if it panics (eg:
+a registered function with a bug, or reflection given arguments of the wrong types), so that one call
+cannot crash the evaluation of every leaf.
+*/
+func protect(funcName string, call func() (interface{}, error)) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Errorf("Function %q panicked: %v\n%s", funcName, r, debug.Stack())
+			result, err = nil, fmt.Errorf("function %q panicked: %v", funcName, r)
+		}
+	}()
+	return call()
+}
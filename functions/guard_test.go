@@ -0,0 +1,114 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLibraryGuards(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+	l, err := NewLibrary().With(map[string]interface{}{
+		"crash":  func(value interface{}) (float64, error) { panic("bug") },
+		"divide": func(a, b int) int { return a / b },
+		"hang": func(value interface{}) (string, error) {
+			<-release
+			return "late", nil
+		},
+		"quick": func(s string) string { return s },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	for _, funcName := range []string{"hang", "quick", "crash"} {
+		if l, err = l.WithTimeout(funcName, 50*time.Millisecond); err != nil {
+			t.Fatalf("WithTimeout(%q) got error: %v", funcName, err)
+		}
+	}
+	tests := []struct {
+		name         string
+		funcName     string
+		args         []interface{}
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "panic", funcName: "crash", args: []interface{}{1}, expectsError: true},
+		{name: "panic via reflection", funcName: "divide", args: []interface{}{1, 0}, expectsError: true},
+		{name: "no panic via reflection", funcName: "divide", args: []interface{}{4, 2}, expected: 2},
+		{name: "timeout", funcName: "hang", args: []interface{}{1}, expectsError: true},
+		{name: "within the timeout", funcName: "quick", args: []interface{}{"a"}, expected: "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := l.Call(test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("%v(%v) got error: %v", test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("%v(%v) = %v, expected error", test.funcName, test.args, got)
+			case err == nil && got != test.expected:
+				t.Errorf("%v(%v) = %v, expected %v", test.funcName, test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	l := NewLibrary()
+	if _, err := l.WithTimeout("undefined", time.Second); err == nil {
+		t.Errorf("WithTimeout(\"undefined\") got no error, expected an error")
+	}
+	if _, err := l.WithTimeout("abs", -time.Second); err == nil {
+		t.Errorf("WithTimeout(\"abs\", -1s) got no error, expected an error")
+	}
+	limited, err := l.WithTimeout("abs", time.Second)
+	if err != nil {
+		t.Fatalf("WithTimeout(\"abs\", 1s) got error: %v", err)
+	}
+	if _, ok := l.timeouts["abs"]; ok {
+		t.Errorf("WithTimeout() modified the library it was called on")
+	}
+	unlimited, err := limited.WithTimeout("abs", 0)
+	if err != nil {
+		t.Fatalf("WithTimeout(\"abs\", 0) got error: %v", err)
+	}
+	if _, ok := unlimited.timeouts["abs"]; ok {
+		t.Errorf("WithTimeout(\"abs\", 0) did not remove the timeout of abs")
+	}
+}
+
+func TestInvokeCopiesArgs(t *testing.T) {
+	l := Library{timeouts: map[string]time.Duration{"hang": 10 * time.Millisecond}}
+	release := make(chan bool)
+	seen := make(chan interface{}, 1)
+	args := []interface{}{"a"}
+	_, err := l.invoke("hang", args, func(args []interface{}) (interface{}, error) {
+		<-release
+		seen <- args[0]
+		return nil, nil
+	})
+	if err == nil {
+		t.Fatalf("invoke() got no error, expected a timeout")
+	}
+	args[0] = "b" // As if the slice were reused by another evaluation.
+	close(release)
+	if got := <-seen; got != "a" {
+		t.Errorf("invoke() gave the abandoned call argument %v, expected a", got)
+	}
+}
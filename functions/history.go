@@ -0,0 +1,189 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/google/orismologer/store"
+)
+
+// Code for functions which keep state per target between calls, eg: to compute rates from counters.
+
+// DefaultHistoryTTL is how long the samples of a History are kept if they are not updated.
+const DefaultHistoryTTL = time.Hour
+
+/*
+Target is the first parameter of functions which keep state per target. Such functions can only be
+called for a target (see CallTarget), which is passed as their first argument; expressions pass only
+the others. Functions which need more than the target (eg: rate, which times samples) take a
+CallContext instead.
+*/
+type Target string
+
+var targetType = reflect.TypeOf(Target(""))
+
+/*
+History keeps the previous sample of each counter passed to rate and delta, per target (see
+CallContext), in a bucket of a store.Store (eg: on disk, so that rates survive restarts). A counter
+should not be sampled for the same target concurrently, or by more than one leaf per poll.
+*/
+type History struct {
+	cache *store.Cache
+	now   func() time.Time
+}
+
+// sample is the stored form of a sample of a counter.
+type sample struct {
+	Value uint64    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// NewHistory returns a History keeping samples in the given store, until they are ttl old.
+func NewHistory(s store.Store, ttl time.Duration) *History {
+	return &History{cache: store.NewCache(s, store.RateBucket, ttl), now: time.Now}
+}
+
+/*
+WithHistory returns a library whose rate and delta functions keep their samples in the given history.
+NewLibrary keeps them in memory, for DefaultHistoryTTL.
+*/
+func (l Library) WithHistory(h *History) Library {
+	merged := map[string]interface{}{}
+	for name, f := range l.functions {
+		merged[name] = f
+	}
+	merged["rate"] = h.rate
+	merged["delta"] = h.delta
+	l.functions, l.adapters = merged, adapters(merged)
+	return l
+}
+
+/*
+rate returns the per-second rate at which a counter of the given number of bits (32 or 64) increased
+since its previous sample.
+*/
+func (h *History) rate(cc CallContext, counter interface{}, key string, bits interface{}) (float64, error) {
+	delta, elapsed, err := h.update(cc, counter, key, bits)
+	if err != nil {
+		return 0, err
+	}
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("no time passed since the previous sample of %q for target %q", key, cc.Target)
+	}
+	return float64(delta) / elapsed.Seconds(), nil
+}
+
+// delta returns how much a counter of the given number of bits (32 or 64) increased since its previous sample.
+func (h *History) delta(cc CallContext, counter interface{}, key string, bits interface{}) (float64, error) {
+	delta, _, err := h.update(cc, counter, key, bits)
+	return float64(delta), err
+}
+
+/*
+update records a sample of a counter, returning how much it increased, and the time passed, since its
+previous sample. Samples are timed when they were collected, if the context has the time, or else when
+they are recorded. It is an error if there is no previous sample, or if a 64 bit counter decreased (eg:
+as the target restarted), in which case the new sample is still recorded for the next call. A 32 bit
+counter which decreased is assumed to have wrapped (see counterDelta32).
+*/
+func (h *History) update(cc CallContext, counter interface{}, key string, bits interface{}) (uint64, time.Duration, error) {
+	target := cc.Target
+	if target == "" {
+		return 0, 0, fmt.Errorf("counter %q can only be sampled for a target", key)
+	}
+	value, err := toUint64(counter)
+	if err != nil {
+		return 0, 0, err
+	}
+	wraps, err := toWraps(bits)
+	if err != nil {
+		return 0, 0, err
+	}
+	if wraps && value > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("counter %q of target %q is not a 32 bit counter, as it is %v", key, target, value)
+	}
+	k := target + "/" + key
+	var previous sample
+	ok, err := h.cache.Get(k, &previous)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not get the previous sample of %q for target %q: %v", key, target, err)
+	}
+	current := sample{Value: value, Time: cc.Time}
+	if current.Time.IsZero() {
+		current.Time = h.now()
+	}
+	if err := h.cache.Put(k, current); err != nil {
+		return 0, 0, fmt.Errorf("could not record a sample of %q for target %q: %v", key, target, err)
+	}
+	elapsed := current.Time.Sub(previous.Time)
+	switch {
+	case !ok:
+		return 0, 0, fmt.Errorf("no previous sample of %q for target %q yet", key, target)
+	case value >= previous.Value:
+		return value - previous.Value, elapsed, nil
+	case wraps && previous.Value <= math.MaxUint32:
+		return wrappedDelta32(previous.Value, value), elapsed, nil
+	}
+	return 0, 0, fmt.Errorf("counter %q of target %q decreased from %v to %v", key, target, previous.Value, value)
+}
+
+// toWraps returns whether a counter of the given number of bits wraps at 2^32, ie: is a Counter32.
+func toWraps(bits interface{}) (bool, error) {
+	n, err := toIndex(bits)
+	if err != nil {
+		return false, err
+	}
+	switch n {
+	case 32:
+		return true, nil
+	case 64:
+		return false, nil
+	}
+	return false, fmt.Errorf("counters have 32 or 64 bits, not %v", bits)
+}
+
+/*
+counterDelta32 returns how much a Counter32 (eg: ifInOctets, on devices without 64 bit counters)
+increased from prev to curr. A counter which decreased is assumed to have wrapped at 2^32 (once),
+though a device which restarted looks the same.
+*/
+func counterDelta32(prev, curr interface{}) (float64, error) {
+	p, err := toUint64(prev)
+	if err != nil {
+		return 0, err
+	}
+	c, err := toUint64(curr)
+	if err != nil {
+		return 0, err
+	}
+	if p > math.MaxUint32 || c > math.MaxUint32 {
+		return 0, fmt.Errorf("counter values %v and %v do not both fit in 32 bits", prev, curr)
+	}
+	if c >= p {
+		return float64(c - p), nil
+	}
+	return float64(wrappedDelta32(p, c)), nil
+}
+
+// wrappedDelta32 returns how much a Counter32 increased from prev to a smaller curr, as it wrapped.
+func wrappedDelta32(prev, curr uint64) uint64 {
+	return curr + (math.MaxUint32 + 1) - prev
+}
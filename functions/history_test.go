@@ -0,0 +1,156 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/orismologer/oparse"
+	"github.com/google/orismologer/store"
+)
+
+// newTestHistory returns a history whose clock advances by ten seconds on each sample.
+func newTestHistory(s store.Store) *History {
+	h := NewHistory(s, time.Hour)
+	now := time.Unix(1545178344, 0)
+	h.now = func() time.Time {
+		now = now.Add(10 * time.Second)
+		return now
+	}
+	return h
+}
+
+func TestLibraryRate(t *testing.T) {
+	s := store.NewMemory()
+	l := NewLibrary().WithHistory(newTestHistory(s))
+	tests := []struct {
+		name         string
+		target       string
+		funcName     string
+		args         []interface{}
+		expected     float64
+		expectsError bool
+	}{
+		{name: "first sample", target: "r1", funcName: "rate", args: []interface{}{"1000", "in"}, expectsError: true},
+		{name: "rate", target: "r1", funcName: "rate", args: []interface{}{"2000", "in"}, expected: 100},
+		{name: "keyword args", target: "r1", funcName: "rate", args: []interface{}{oparse.KeywordArgs{"key": "in", "counter": 3000.0}}, expected: 100},
+		{name: "other key", target: "r1", funcName: "rate", args: []interface{}{uint64(5), "out"}, expectsError: true},
+		{name: "other target", target: "r2", funcName: "rate", args: []interface{}{"5000", "in"}, expectsError: true},
+		{name: "delta", target: "r2", funcName: "delta", args: []interface{}{int64(5500), "in"}, expected: 500},
+		{name: "decrease", target: "r1", funcName: "rate", args: []interface{}{"10", "in"}, expectsError: true},
+		{name: "after a decrease", target: "r1", funcName: "rate", args: []interface{}{"20", "in"}, expected: 1},
+		{name: "not a counter", target: "r1", funcName: "rate", args: []interface{}{-1.5, "in"}, expectsError: true},
+		{name: "without a target", funcName: "rate", args: []interface{}{"30", "in"}, expectsError: true},
+		{name: "too few arguments", target: "r1", funcName: "rate", args: []interface{}{"30"}, expectsError: true},
+		{name: "first 32 bit sample", target: "r3", funcName: "delta", args: []interface{}{"4294967000", "in", 32}, expectsError: true},
+		{name: "32 bit wrap", target: "r3", funcName: "delta", args: []interface{}{"704", "in", 32}, expected: 1000},
+		{name: "32 bit rate", target: "r3", funcName: "rate", args: []interface{}{oparse.KeywordArgs{"counter": 2704, "key": "in", "bits": 32}}, expected: 200},
+		{name: "too large for 32 bits", target: "r3", funcName: "delta", args: []interface{}{"4294967296", "in", 32}, expectsError: true},
+		{name: "invalid bits", target: "r3", funcName: "delta", args: []interface{}{"3000", "in", 16}, expectsError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := l.CallTarget(test.target, test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("CallTarget(%q, %q, %v) got error: %v", test.target, test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("CallTarget(%q, %q, %v) = %v, expected error", test.target, test.funcName, test.args, got)
+			case err == nil && got != test.expected:
+				t.Errorf("CallTarget(%q, %q, %v) = %v, expected %v", test.target, test.funcName, test.args, got, test.expected)
+			}
+		})
+	}
+
+	// Samples are kept in the store, so another library (eg: after a restart) continues from them.
+	restarted := NewLibrary().WithHistory(newTestHistory(s))
+	if got, err := restarted.CallTarget("r1", "delta", "25", "in"); err != nil || got != 5.0 {
+		t.Errorf("CallTarget(\"r1\", \"delta\") after a restart = %v, %v, expected 5, nil", got, err)
+	}
+	if _, err := l.Call("rate", "30", "in"); err == nil {
+		t.Errorf("Call(\"rate\") got no error, expected an error as there is no target")
+	}
+
+	// Samples are timed when they were collected, if the context has the time.
+	collected := CallContext{Target: "r4", Time: time.Unix(1600000000, 0)}
+	if _, err := l.CallWithContext(collected, "delta", "100", "in"); err == nil {
+		t.Errorf("CallWithContext(%v, \"delta\") of the first sample got no error", collected)
+	}
+	collected.Time = collected.Time.Add(4 * time.Second)
+	if got, err := l.CallWithContext(collected, "rate", "500", "in"); err != nil || got != 100.0 {
+		t.Errorf("CallWithContext(%v, \"rate\") = %v, %v, expected 100, nil", collected, got, err)
+	}
+}
+
+func TestRateExpression(t *testing.T) {
+	l := NewLibrary().WithHistory(newTestHistory(store.NewMemory()))
+	expression, err := oparse.Parse("try rate(octets, 'in_octets') * 8 else null")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, l.Signatures()); err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return l.CallTarget("r1", funcName, args...)
+	}
+	for _, test := range []struct {
+		octets   string
+		expected interface{}
+	}{
+		{octets: "1000", expected: nil},
+		{octets: "11000", expected: 8000.0},
+	} {
+		got, err := oparse.Eval(expression, oparse.Context{"octets": test.octets}, caller)
+		if err != nil || got != test.expected {
+			t.Errorf("Eval(%v) with octets %v = %v, %v, expected %v", expression, test.octets, got, err, test.expected)
+		}
+	}
+}
+
+func TestCounterDelta32(t *testing.T) {
+	tests := []struct {
+		name         string
+		prev         interface{}
+		curr         interface{}
+		expected     float64
+		expectsError bool
+	}{
+		{name: "increase", prev: "100", curr: "250", expected: 150},
+		{name: "no change", prev: 7, curr: 7, expected: 0},
+		{name: "wrap", prev: uint64(4294967290), curr: uint64(10), expected: 16},
+		{name: "wrap to zero", prev: 4294967295.0, curr: 0, expected: 1},
+		{name: "too large", prev: "4294967296", curr: "1", expectsError: true},
+		{name: "negative", prev: -1, curr: 1, expectsError: true},
+		{name: "not a counter", prev: "one", curr: 1, expectsError: true},
+	}
+	library := NewLibrary()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call("counter_delta32", test.prev, test.curr)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("counter_delta32(%v, %v) got error: %v", test.prev, test.curr, err)
+			case err == nil && test.expectsError:
+				t.Errorf("counter_delta32(%v, %v) = %v, expected error", test.prev, test.curr, got)
+			case err == nil && got != test.expected:
+				t.Errorf("counter_delta32(%v, %v) = %v, expected %v", test.prev, test.curr, got, test.expected)
+			}
+		})
+	}
+}
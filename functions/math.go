@@ -0,0 +1,219 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Implementations of math functions. Arguments may be numbers of any type, or strings of numbers.
+
+// toNumber converts a number (of any of the types expressions evaluate to), or a string of one, to a float64.
+func toNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case string:
+		if result, err := strconv.ParseFloat(v, 64); err == nil {
+			return result, nil
+		}
+	}
+	return 0, fmt.Errorf("value `%v` is not a number", value)
+}
+
+// unary returns a function applying f to a number.
+func unary(f func(float64) float64) func(interface{}) (float64, error) {
+	return func(value interface{}) (float64, error) {
+		x, err := toNumber(value)
+		if err != nil {
+			return 0, err
+		}
+		return f(x), nil
+	}
+}
+
+// binary returns a function applying f to two numbers.
+func binary(f func(float64, float64) float64) func(interface{}, interface{}) (float64, error) {
+	return func(a, b interface{}) (float64, error) {
+		x, err := toNumber(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toNumber(b)
+		if err != nil {
+			return 0, err
+		}
+		return f(x, y), nil
+	}
+}
+
+func sqrt(value interface{}) (float64, error) {
+	x, err := toNumber(value)
+	if err != nil {
+		return 0, err
+	}
+	if x < 0 {
+		return 0, fmt.Errorf("cannot take the square root of negative number %v", x)
+	}
+	return math.Sqrt(x), nil
+}
+
+// logarithm returns a function taking the logarithm of a positive number with f.
+func logarithm(f func(float64) float64) func(interface{}) (float64, error) {
+	return func(value interface{}) (float64, error) {
+		x, err := toNumber(value)
+		if err != nil {
+			return 0, err
+		}
+		if x <= 0 {
+			return 0, fmt.Errorf("cannot take the logarithm of non-positive number %v", x)
+		}
+		return f(x), nil
+	}
+}
+
+func pow(base, exponent interface{}) (float64, error) {
+	result, err := binary(math.Pow)(base, exponent)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) {
+		return 0, fmt.Errorf("%v to the power of %v is not a real number", base, exponent)
+	}
+	return result, nil
+}
+
+/*
+round rounds a number to the given number of digits after the point (half away from zero), or to a
+multiple of a power of ten if digits is negative, eg: round(1234.5, -2) is 1200.
+*/
+func round(value, digits interface{}) (float64, error) {
+	x, err := toNumber(value)
+	if err != nil {
+		return 0, err
+	}
+	d, err := toNumber(digits)
+	if err != nil {
+		return 0, err
+	}
+	if d != math.Trunc(d) {
+		return 0, fmt.Errorf("number of digits %v is not an integer", d)
+	}
+	scale := math.Pow(10, d)
+	switch {
+	case math.IsInf(x*scale, 0):
+		return x, nil // Too many digits to make a difference.
+	case scale == 0:
+		return 0, nil // A power of ten too large to be a multiple of.
+	}
+	return math.Round(x*scale) / scale, nil
+}
+
+/*
+divide divides a by b, returning whether b is non-zero. Counters of idle (or down) interfaces often
+make denominators zero, which expressions should not treat as errors.
+*/
+func divide(a, b interface{}) (float64, bool, error) {
+	x, err := toNumber(a)
+	if err != nil {
+		return 0, false, err
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return 0, false, err
+	}
+	if y == 0 {
+		return 0, false, nil
+	}
+	return x / y, true, nil
+}
+
+// safeDiv divides a by b, or returns def (eg: null, so that the leaf is not set) if b is zero.
+func safeDiv(a, b, def interface{}) (interface{}, error) {
+	result, ok, err := divide(a, b)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return def, nil
+	}
+	return result, nil
+}
+
+// ratio divides a by b, or returns 0 if b is zero.
+func ratio(a, b interface{}) (float64, error) {
+	result, _, err := divide(a, b)
+	return result, err
+}
+
+// percent returns part as a percentage of whole, or 0 if whole is zero, eg: percent(in_octets * 8, speed).
+func percent(part, whole interface{}) (float64, error) {
+	result, err := ratio(part, whole)
+	return 100 * result, err
+}
+
+// bounds converts a value and the bounds of a range to numbers, checking that the range is not empty.
+func bounds(value, lo, hi interface{}) (float64, float64, float64, error) {
+	x, err := toNumber(value)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	l, err := toNumber(lo)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	h, err := toNumber(hi)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if l > h {
+		return 0, 0, 0, fmt.Errorf("range [%v, %v] is empty", l, h)
+	}
+	return x, l, h, nil
+}
+
+// clamp limits a number to the range from lo to hi (inclusive).
+func clamp(value, lo, hi interface{}) (float64, error) {
+	x, l, h, err := bounds(value, lo, hi)
+	if err != nil {
+		return 0, err
+	}
+	return math.Min(math.Max(x, l), h), nil
+}
+
+/*
+assertRange returns a number if it is in the range from lo to hi (inclusive), and fails otherwise,
+eg: so that garbage from a faulty sensor (eg: a temperature of -127) is not published.
+*/
+func assertRange(value, lo, hi interface{}) (float64, error) {
+	x, l, h, err := bounds(value, lo, hi)
+	if err != nil {
+		return 0, err
+	}
+	if x < l || x > h || math.IsNaN(x) {
+		return 0, fmt.Errorf("value %v is out of range [%v, %v]", x, l, h)
+	}
+	return x, nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryMath(t *testing.T) {
+	tests := []struct {
+		name         string
+		funcName     string
+		args         []interface{}
+		expected     float64
+		expectsError bool
+	}{
+		{name: "abs", funcName: "abs", args: []interface{}{-1.5}, expected: 1.5},
+		{name: "abs of an int", funcName: "abs", args: []interface{}{-3}, expected: 3},
+		{name: "abs of a string", funcName: "abs", args: []interface{}{"-2"}, expected: 2},
+		{name: "abs of a non-number", funcName: "abs", args: []interface{}{"two"}, expectsError: true},
+		{name: "ceil", funcName: "ceil", args: []interface{}{1.2}, expected: 2},
+		{name: "floor", funcName: "floor", args: []interface{}{-1.2}, expected: -2},
+		{name: "round", funcName: "round", args: []interface{}{2.5}, expected: 3},
+		{name: "round half away from zero", funcName: "round", args: []interface{}{-2.5}, expected: -3},
+		{name: "round to digits", funcName: "round", args: []interface{}{3.14159, 2}, expected: 3.14},
+		{name: "round to tens", funcName: "round", args: []interface{}{1234.5, int64(-2)}, expected: 1200},
+		{name: "round to many digits", funcName: "round", args: []interface{}{0.1, 400}, expected: 0.1},
+		{name: "round to a huge power of ten", funcName: "round", args: []interface{}{1234.5, -400}, expected: 0},
+		{name: "round to fractional digits", funcName: "round", args: []interface{}{1.5, 0.5}, expectsError: true},
+		{name: "sqrt", funcName: "sqrt", args: []interface{}{uint64(16)}, expected: 4},
+		{name: "sqrt of a negative number", funcName: "sqrt", args: []interface{}{-1.0}, expectsError: true},
+		{name: "log", funcName: "log", args: []interface{}{math.E}, expected: 1},
+		{name: "log of zero", funcName: "log", args: []interface{}{0}, expectsError: true},
+		{name: "log2", funcName: "log2", args: []interface{}{1024}, expected: 10},
+		{name: "log2 of a negative number", funcName: "log2", args: []interface{}{-2}, expectsError: true},
+		{name: "pow", funcName: "pow", args: []interface{}{2, 10}, expected: 1024},
+		{name: "pow of a negative number", funcName: "pow", args: []interface{}{-8.0, 1.0 / 3}, expectsError: true},
+		{name: "min", funcName: "min", args: []interface{}{int64(-1), uint64(2)}, expected: -1},
+		{name: "max", funcName: "max", args: []interface{}{"1.5", 1}, expected: 1.5},
+		{name: "max of a non-number", funcName: "max", args: []interface{}{1, nil}, expectsError: true},
+		{name: "ratio", funcName: "ratio", args: []interface{}{1, 4}, expected: 0.25},
+		{name: "ratio to zero", funcName: "ratio", args: []interface{}{5, uint64(0)}, expected: 0},
+		{name: "ratio of a non-number", funcName: "ratio", args: []interface{}{"five", 0}, expectsError: true},
+		{name: "percent", funcName: "percent", args: []interface{}{"25", 200}, expected: 12.5},
+		{name: "percent of zero", funcName: "percent", args: []interface{}{0, 0.0}, expected: 0},
+		{name: "safe_div", funcName: "safe_div", args: []interface{}{3, 2}, expected: 1.5},
+		{name: "safe_div by zero", funcName: "safe_div", args: []interface{}{3, 0, -1.0}, expected: -1},
+		{name: "safe_div of a non-number", funcName: "safe_div", args: []interface{}{3, "zero", 0}, expectsError: true},
+		{name: "clamp", funcName: "clamp", args: []interface{}{50, 0, 100}, expected: 50},
+		{name: "clamp below", funcName: "clamp", args: []interface{}{-127, -40, 125}, expected: -40},
+		{name: "clamp above", funcName: "clamp", args: []interface{}{"130.5", -40, 125}, expected: 125},
+		{name: "clamp to an empty range", funcName: "clamp", args: []interface{}{1, 2, 1}, expectsError: true},
+		{name: "assert_range", funcName: "assert_range", args: []interface{}{uint64(125), -40, 125}, expected: 125},
+		{name: "assert_range below", funcName: "assert_range", args: []interface{}{-127, -40, 125}, expectsError: true},
+		{name: "assert_range above", funcName: "assert_range", args: []interface{}{126, -40, 125}, expectsError: true},
+		{name: "assert_range of NaN", funcName: "assert_range", args: []interface{}{math.NaN(), -40, 125}, expectsError: true},
+		{name: "assert_range of a non-number", funcName: "assert_range", args: []interface{}{"hot", -40, 125}, expectsError: true},
+	}
+	library := NewLibrary()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call(test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Call(%q, %v) got error: %v", test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("Call(%q, %v) = %v, expected error", test.funcName, test.args, got)
+			case err == nil && math.Abs(got.(float64)-test.expected) > 1e-9:
+				t.Errorf("Call(%q, %v) = %v, expected %v", test.funcName, test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestMathExpressions(t *testing.T) {
+	// Eg: the utilization of an interface, as a percentage with one decimal place.
+	expression, err := oparse.Parse("round(min(100, 100 * max(out, in) * 8 / speed), digits=1)")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, NewLibrary().Signatures()); err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	got, err := oparse.Eval(expression, oparse.Context{"out": 1000000, "in": 3000000, "speed": 1000000000}, NewLibrary().Call)
+	if err != nil || got != 2.4 {
+		t.Errorf("Eval(%v) = %v, %v, expected 2.4", expression, got, err)
+	}
+}
+
+func TestSafeDivExpressions(t *testing.T) {
+	library := NewLibrary()
+	tests := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{expression: "safe_div(errors, packets)", expected: nil},
+		{expression: "safe_div(errors, packets) ?? 'idle'", expected: "idle"},
+		{expression: "safe_div(errors, packets, default=0)", expected: 0.0},
+		{expression: "round(percent(errors, packets), digits=2)", expected: 0.0},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := oparse.Parse(test.expression)
+			if err != nil {
+				t.Fatalf("Parse() got error: %v", err)
+			}
+			got, err := oparse.Eval(expression, oparse.Context{"errors": 0, "packets": 0}, library.Call)
+			if err != nil || got != test.expected {
+				t.Errorf("Eval(%v) = %v, %v, expected %v", expression, got, err, test.expected)
+			}
+		})
+	}
+}
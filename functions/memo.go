@@ -0,0 +1,140 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Code to cache the results of expensive functions, so that expressions calling them with the same arguments do not repeat the work.
+
+/*
+Memo caches the results of memoized functions (see WithMemo), by their arguments, for a time to live,
+eg: the interval between polls, so that results are reused within a collection cycle but not beyond
+it. Programs with explicit cycles can instead Reset it at the start of each. A Memo may be shared by
+several functions and libraries, and is safe for concurrent use.
+*/
+type Memo struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex // Guards the fields below.
+	results map[string]memoResult
+	purged  time.Time // When expired results were last removed.
+}
+
+type memoResult struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewMemo returns a Memo keeping results for ttl.
+func NewMemo(ttl time.Duration) *Memo {
+	return &Memo{ttl: ttl, now: time.Now, results: map[string]memoResult{}}
+}
+
+// Reset removes every result, eg: at the start of a collection cycle.
+func (m *Memo) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = map[string]memoResult{}
+}
+
+// get returns the unexpired result stored under key, if there is one.
+func (m *Memo) get(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.results[key]
+	if !ok || !m.now().Before(r.expires) {
+		return nil, false
+	}
+	return r.value, true
+}
+
+// put stores a result under key, removing expired results once per time to live, so that the results of past cycles do not accumulate.
+func (m *Memo) put(key string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.Sub(m.purged) >= m.ttl {
+		for k, r := range m.results {
+			if !now.Before(r.expires) {
+				delete(m.results, k)
+			}
+		}
+		m.purged = now
+	}
+	m.results[key] = memoResult{value: value, expires: now.Add(m.ttl)}
+}
+
+/*
+WithMemo returns a library in which the results of the named functions are cached in memo, by their
+arguments, eg: for conversions which many expressions call on the same values. Functions must be
+pure, ie: return the same result whenever they are given the same arguments, so functions which take
+a Target or CallContext cannot be memoized. Errors are not cached, as a call may fail transiently (eg:
+as it timed out). Results are shared between calls, so callers must not modify them (eg: maps).
+*/
+func (l Library) WithMemo(memo *Memo, funcNames ...string) (Library, error) {
+	if memo == nil {
+		return Library{}, fmt.Errorf("memo is nil")
+	}
+	merged := map[string]*Memo{}
+	for name, m := range l.memos {
+		merged[name] = m
+	}
+	for _, funcName := range funcNames {
+		if !l.Contains(funcName) {
+			return Library{}, fmt.Errorf("function %q undefined", funcName)
+		}
+		if l.injected(funcName) != nil {
+			return Library{}, fmt.Errorf("function %q is called for a target, so cannot be memoized", funcName)
+		}
+		merged[funcName] = memo
+	}
+	l.memos = merged
+	return l, nil
+}
+
+// memoize calls the named function via call (see invoke), unless its memo has a result for the same arguments.
+func (l Library) memoize(funcName string, args []interface{}, call func(args []interface{}) (interface{}, error)) (interface{}, error) {
+	memo, ok := l.memos[funcName]
+	if !ok {
+		return l.invoke(funcName, args, call)
+	}
+	key := memoKey(funcName, args)
+	if value, ok := memo.get(key); ok {
+		return value, nil
+	}
+	value, err := l.invoke(funcName, args, call)
+	if err == nil {
+		memo.put(key, value)
+	}
+	return value, err
+}
+
+// memoKey returns the key of the result of a call, which distinguishes arguments of different types (eg: 1 and "1", or 1 and 1.0).
+func memoKey(funcName string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(funcName)
+	for _, arg := range args {
+		fmt.Fprintf(&b, "\x00%T:%#v", arg, arg)
+	}
+	return b.String()
+}
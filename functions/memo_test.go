@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLibraryWithMemo(t *testing.T) {
+	calls := 0
+	l, err := NewLibrary().With(map[string]interface{}{
+		"parse": func(value interface{}, base string) (string, error) {
+			calls++
+			if value == "bad" {
+				return "", errors.New("bad value")
+			}
+			return base, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	if l, err = l.WithDefaults("parse", "10"); err != nil {
+		t.Fatalf("WithDefaults() got error: %v", err)
+	}
+	memo := NewMemo(time.Minute)
+	now := time.Unix(1545178344, 0)
+	memo.now = func() time.Time { return now }
+	if l, err = l.WithMemo(memo, "parse"); err != nil {
+		t.Fatalf("WithMemo() got error: %v", err)
+	}
+	tests := []struct {
+		name          string
+		args          []interface{}
+		advance       time.Duration // How much time passes before the call.
+		reset         bool          // Whether the memo is reset before the call.
+		expectedCalls int
+		expectsError  bool
+	}{
+		{name: "first call", args: []interface{}{"a"}, expectedCalls: 1},
+		{name: "same arguments", args: []interface{}{"a"}, expectedCalls: 1},
+		{name: "default given", args: []interface{}{"a", "10"}, expectedCalls: 1},
+		{name: "other arguments", args: []interface{}{"a", "16"}, expectedCalls: 2},
+		{name: "other type", args: []interface{}{1}, expectedCalls: 3},
+		{name: "same type", args: []interface{}{1}, expectedCalls: 3},
+		{name: "float", args: []interface{}{1.0}, expectedCalls: 4},
+		{name: "error", args: []interface{}{"bad"}, expectedCalls: 5, expectsError: true},
+		{name: "errors are not cached", args: []interface{}{"bad"}, expectedCalls: 6, expectsError: true},
+		{name: "within the time to live", args: []interface{}{"a"}, advance: 59 * time.Second, expectedCalls: 6},
+		{name: "expired", args: []interface{}{"a"}, advance: time.Second, expectedCalls: 7},
+		{name: "reset", args: []interface{}{"a"}, reset: true, expectedCalls: 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now = now.Add(test.advance)
+			if test.reset {
+				memo.Reset()
+			}
+			_, err := l.Call("parse", test.args...)
+			if err != nil && !test.expectsError {
+				t.Errorf("parse(%v) got error: %v", test.args, err)
+			} else if err == nil && test.expectsError {
+				t.Errorf("parse(%v) got no error, expected an error", test.args)
+			}
+			if calls != test.expectedCalls {
+				t.Errorf("parse(%v) made %v calls in total, expected %v", test.args, calls, test.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestWithMemo(t *testing.T) {
+	l := NewLibrary()
+	memo := NewMemo(time.Minute)
+	if _, err := l.WithMemo(memo, "undefined"); err == nil {
+		t.Errorf("WithMemo(\"undefined\") got no error, expected an error")
+	}
+	if _, err := l.WithMemo(memo, "rate"); err == nil {
+		t.Errorf("WithMemo(\"rate\") got no error, expected an error as rate is called for a target")
+	}
+	if _, err := l.WithMemo(nil, "abs"); err == nil {
+		t.Errorf("WithMemo(nil) got no error, expected an error")
+	}
+	if _, err := l.WithMemo(memo, "abs"); err != nil {
+		t.Errorf("WithMemo(\"abs\") got error: %v", err)
+	}
+	if _, ok := l.memos["abs"]; ok {
+		t.Errorf("WithMemo() modified the library it was called on")
+	}
+}
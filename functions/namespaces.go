@@ -0,0 +1,130 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Code to add functions in namespaces, so that vendor packs (eg: plugins) cannot clash with each other.
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+/*
+Namespace is a registry of functions, as for the library's own (see registry), whose functions are
+called by names qualified by the namespace's, eg: the function "parse_envmon" of the namespace "cisco"
+is called as `cisco.parse_envmon(x)`. Every map is keyed by unqualified function names.
+*/
+type Namespace struct {
+	Name      string
+	Functions map[string]interface{}
+	ArgNames  map[string][]string          // The names of the arguments of functions which take keyword arguments (see WithArgNames).
+	Defaults  map[string][]interface{}     // The default values of the trailing arguments of functions (see WithDefaults).
+	Docs      map[string]string            // Descriptions of functions (see WithDoc).
+	ArgDocs   map[string]map[string]string // Descriptions of the arguments of functions, by name (see WithArgDoc).
+}
+
+// Qualify returns the name by which expressions call a function of a namespace, eg: "cisco.parse_envmon".
+func Qualify(namespace, funcName string) string {
+	return namespace + "." + funcName
+}
+
+/*
+WithNamespace returns a library containing this library's functions and those of the given namespace,
+under their qualified names (see Qualify). The names of the namespace and of its functions must be
+identifiers. A namespace may be added in parts, eg: by several plugins, as long as their functions'
+names do not clash.
+*/
+func (l Library) WithNamespace(ns Namespace) (Library, error) {
+	if !identifier.MatchString(ns.Name) {
+		return Library{}, fmt.Errorf("namespace %q is not an identifier", ns.Name)
+	}
+	if name, ok := ns.undefined(); ok {
+		return Library{}, fmt.Errorf("namespace %q has no function %q", ns.Name, name)
+	}
+	qualified := map[string]interface{}{}
+	for name, f := range ns.Functions {
+		if !identifier.MatchString(name) {
+			return Library{}, fmt.Errorf("function %q of namespace %q is not named by an identifier", name, ns.Name)
+		}
+		qualified[Qualify(ns.Name, name)] = f
+	}
+	l, err := l.With(qualified)
+	if err != nil {
+		return Library{}, fmt.Errorf("could not add namespace %q: %v", ns.Name, err)
+	}
+	// In order, so that the first of several errors is reported consistently.
+	names := make([]string, 0, len(ns.Functions))
+	for name := range ns.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if argNames, ok := ns.ArgNames[name]; ok {
+			if l, err = l.WithArgNames(Qualify(ns.Name, name), argNames...); err != nil {
+				return Library{}, err
+			}
+		}
+		if defaults, ok := ns.Defaults[name]; ok {
+			if l, err = l.WithDefaults(Qualify(ns.Name, name), defaults...); err != nil {
+				return Library{}, err
+			}
+		}
+		if doc, ok := ns.Docs[name]; ok {
+			if l, err = l.WithDoc(Qualify(ns.Name, name), doc); err != nil {
+				return Library{}, err
+			}
+		}
+		argNames := make([]string, 0, len(ns.ArgDocs[name]))
+		for argName := range ns.ArgDocs[name] {
+			argNames = append(argNames, argName)
+		}
+		sort.Strings(argNames)
+		for _, argName := range argNames {
+			if l, err = l.WithArgDoc(Qualify(ns.Name, name), argName, ns.ArgDocs[name][argName]); err != nil {
+				return Library{}, err
+			}
+		}
+	}
+	return l, nil
+}
+
+// undefined returns the first (by name) function given argument names, defaults or docs which the namespace does not define.
+func (ns Namespace) undefined() (string, bool) {
+	var names []string
+	for name := range ns.ArgNames {
+		names = append(names, name)
+	}
+	for name := range ns.Defaults {
+		names = append(names, name)
+	}
+	for name := range ns.Docs {
+		names = append(names, name)
+	}
+	for name := range ns.ArgDocs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ns.Functions[name] == nil {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryWithNamespace(t *testing.T) {
+	cisco := Namespace{
+		Name: "cisco",
+		Functions: map[string]interface{}{
+			"to_int":       func(s string) int { return len(s) },
+			"parse_envmon": func(s, unit string) string { return s + unit },
+		},
+		ArgNames: map[string][]string{"parse_envmon": {"text", "unit"}},
+		Defaults: map[string][]interface{}{"parse_envmon": {"C"}},
+		Docs:     map[string]string{"parse_envmon": "Parses show environment."},
+		ArgDocs:  map[string]map[string]string{"parse_envmon": {"unit": "The unit of temperatures."}},
+	}
+	juniper := Namespace{Name: "juniper", Functions: map[string]interface{}{"to_int": func(s string) int { return 2 }}}
+	l, err := NewLibrary().WithNamespace(cisco)
+	if err != nil {
+		t.Fatalf("WithNamespace(cisco) got error: %v", err)
+	}
+	if l, err = l.WithNamespace(juniper); err != nil {
+		t.Fatalf("WithNamespace(juniper) got error: %v", err)
+	}
+	tests := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{expression: "to_int('42')", expected: 42.0},
+		{expression: "cisco.to_int('42')", expected: 2.0},
+		{expression: "juniper.to_int('42')", expected: 2.0},
+		{expression: "cisco.parse_envmon('30')", expected: "30C"},
+		{expression: "cisco.parse_envmon(unit='F', text='86')", expected: "86F"},
+		{expression: "'30' |> cisco.parse_envmon()", expected: "30C"},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := oparse.Parse(test.expression)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expression, err)
+			}
+			if err := oparse.Validate(expression, l.Signatures()); err != nil {
+				t.Errorf("Validate(%q) got error: %v", test.expression, err)
+			}
+			got, err := oparse.Eval(expression, oparse.Context{}, l.Call)
+			if err != nil || got != test.expected {
+				t.Errorf("Eval(%q) = %v (error %v), expected %v", test.expression, got, err, test.expected)
+			}
+		})
+	}
+	signature, err := l.Signature("cisco.parse_envmon")
+	if err != nil {
+		t.Fatalf("Signature() got error: %v", err)
+	}
+	if got, expected := signature.String(), `cisco.parse_envmon(text string, unit string = "C") string`; got != expected {
+		t.Errorf("Signature() = %v, expected %v", got, expected)
+	}
+	if got, expected := signature.Doc, "Parses show environment."; got != expected {
+		t.Errorf("Signature().Doc = %q, expected %q", got, expected)
+	}
+	if got, expected := signature.ArgDocs["unit"], "The unit of temperatures."; got != expected {
+		t.Errorf("Signature().ArgDocs[\"unit\"] = %q, expected %q", got, expected)
+	}
+}
+
+func TestLibraryWithNamespaceErrors(t *testing.T) {
+	f := func(s string) string { return s }
+	tests := []struct {
+		name          string
+		namespace     Namespace
+		expectedError string
+	}{
+		{
+			name:          "invalid namespace",
+			namespace:     Namespace{Name: "cisco.ios", Functions: map[string]interface{}{"f": f}},
+			expectedError: "is not an identifier",
+		},
+		{
+			name:          "invalid function name",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"parse-envmon": f}},
+			expectedError: "is not named by an identifier",
+		},
+		{
+			name:          "clash",
+			namespace:     Namespace{Name: "vendor", Functions: map[string]interface{}{"f": f}},
+			expectedError: `function "vendor.f" is already defined`,
+		},
+		{
+			name:          "not a function",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"f": 1}},
+			expectedError: "is not a function",
+		},
+		{
+			name:          "argument names of undefined function",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"f": f}, ArgNames: map[string][]string{"g": {"s"}}},
+			expectedError: `has no function "g"`,
+		},
+		{
+			name:          "wrong number of argument names",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"f": f}, ArgNames: map[string][]string{"f": {"a", "b"}}},
+			expectedError: "has 1 arguments, but got 2 names",
+		},
+		{
+			name:          "invalid default",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"f": f}, Defaults: map[string][]interface{}{"f": {1}}},
+			expectedError: "is not a string",
+		},
+		{
+			name:          "argument docs of undefined function",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"f": f}, ArgDocs: map[string]map[string]string{"g": {"s": "A string."}}},
+			expectedError: `has no function "g"`,
+		},
+		{
+			name:          "docs of undefined argument",
+			namespace:     Namespace{Name: "cisco", Functions: map[string]interface{}{"f": f}, ArgDocs: map[string]map[string]string{"f": {"s": "A string."}}},
+			expectedError: `has no argument "s"`,
+		},
+	}
+	l, err := NewLibrary().WithNamespace(Namespace{Name: "vendor", Functions: map[string]interface{}{"f": f}})
+	if err != nil {
+		t.Fatalf("WithNamespace() got error: %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := l.WithNamespace(test.namespace)
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("WithNamespace() got error %v, expected one containing %q", err, test.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+/*
+Implementations of functions on OIDs, eg: to get the index of the table row a value was fetched from.
+OIDs are dotted strings of sub-identifiers, with or without a leading dot.
+*/
+
+/*
+oidIndex returns the index of an instance of a table column: the sub-identifiers of oid after base,
+eg: oid_index('1.3.6.1.2.1.2.2.1.2.7', '1.3.6.1.2.1.2.2.1.2') is "7". If syntax is given, the index
+is decoded as the index of a table with the given syntax (see decodeIndex) instead.
+*/
+func oidIndex(oid, base, syntax string) (interface{}, error) {
+	index, err := oidSuffix(oid, base)
+	if err != nil {
+		return nil, err
+	}
+	if syntax == "" {
+		return formatOid(index), nil
+	}
+	return decodeIndex(index, syntax)
+}
+
+// oidSuffix returns the sub-identifiers of oid after base, which must be a proper prefix of it.
+func oidSuffix(oid, base string) ([]uint32, error) {
+	subIDs, err := parseOid(oid)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := parseOid(base)
+	if err != nil {
+		return nil, err
+	}
+	if len(subIDs) <= len(prefix) {
+		return nil, fmt.Errorf("OID %q is not an instance of %q", oid, base)
+	}
+	for i, subID := range prefix {
+		if subIDs[i] != subID {
+			return nil, fmt.Errorf("OID %q is not an instance of %q", oid, base)
+		}
+	}
+	return subIDs[len(prefix):], nil
+}
+
+func parseOid(oid string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	subIDs := make([]uint32, len(parts))
+	for i, part := range parts {
+		subID, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a numeric OID", oid)
+		}
+		subIDs[i] = uint32(subID)
+	}
+	return subIDs, nil
+}
+
+/*
+decodeIndex decodes the index of a table row, encoded as in RFC 2578 section 7.7, given the syntax of
+its index objects: a comma-separated list of types, each optionally preceded by a name and a colon,
+eg: "if_index:int, addr:ip". The types are:
+  - int: an integer (one sub-identifier).
+  - ip: an IpAddress (four sub-identifiers), as a dotted string.
+  - string: an octet string preceded by its length (eg: a DisplayString).
+  - implied: an IMPLIED octet string, which takes the rest of the index, so must be last.
+
+An index of a single unnamed object is returned as its value. Otherwise every object must be named,
+and the index is returned as a map of their values by name, eg: oid_index(oid, base, 'a:int, b:int').b.
+*/
+func decodeIndex(index []uint32, syntax string) (interface{}, error) {
+	values := map[string]interface{}{}
+	var unnamed interface{}
+	objects := strings.Split(syntax, ",")
+	for i, object := range objects {
+		name, kind := "", strings.TrimSpace(object)
+		if colon := strings.Index(kind, ":"); colon >= 0 {
+			name, kind = strings.TrimSpace(kind[:colon]), strings.TrimSpace(kind[colon+1:])
+		}
+		if name == "" && len(objects) > 1 {
+			return nil, fmt.Errorf("index syntax %q has several objects, so each must be named", syntax)
+		}
+		var value interface{}
+		var err error
+		switch kind {
+		case "int":
+			var subIDs []uint32
+			if subIDs, index, err = takeSubIDs(index, 1); err == nil {
+				value = int(subIDs[0])
+			}
+		case "ip":
+			var address string
+			if address, index, err = takeString(index, net.IPv4len); err == nil {
+				value = net.IP([]byte(address)).String()
+			}
+		case "string":
+			var length []uint32
+			if length, index, err = takeSubIDs(index, 1); err == nil {
+				value, index, err = takeString(index, int(length[0]))
+			}
+		case "implied":
+			if i != len(objects)-1 {
+				return nil, fmt.Errorf("implied object %q of index syntax %q must be last", object, syntax)
+			}
+			value, index, err = takeString(index, len(index))
+		default:
+			return nil, fmt.Errorf("unknown type %q of index object %q (expected int, ip, string or implied)", kind, object)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode index object %q: %v", object, err)
+		}
+		if name == "" {
+			unnamed = value
+		} else {
+			values[name] = value
+		}
+	}
+	if len(index) > 0 {
+		return nil, fmt.Errorf("index has %v sub-identifiers left after decoding %q", len(index), syntax)
+	}
+	if len(values) == 0 {
+		return unnamed, nil
+	}
+	return values, nil
+}
+
+// takeSubIDs splits the first n sub-identifiers from the rest of an index.
+func takeSubIDs(index []uint32, n int) ([]uint32, []uint32, error) {
+	if n > len(index) {
+		return nil, nil, fmt.Errorf("expected %v sub-identifiers, but only %v are left", n, len(index))
+	}
+	return index[:n], index[n:], nil
+}
+
+// takeString splits an octet string of n sub-identifiers, each of which must be an octet, from the rest of an index.
+func takeString(index []uint32, n int) (string, []uint32, error) {
+	subIDs, rest, err := takeSubIDs(index, n)
+	if err != nil {
+		return "", nil, err
+	}
+	b := make([]byte, len(subIDs))
+	for i, subID := range subIDs {
+		if subID > math.MaxUint8 {
+			return "", nil, fmt.Errorf("sub-identifier %v is not an octet", subID)
+		}
+		b[i] = byte(subID)
+	}
+	return string(b), rest, nil
+}
+
+// formatOid formats sub-identifiers as a dotted string.
+func formatOid(subIDs []uint32) string {
+	parts := make([]string, len(subIDs))
+	for i, subID := range subIDs {
+		parts[i] = strconv.FormatUint(uint64(subID), 10)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryOidIndex(t *testing.T) {
+	const ifDescr = "1.3.6.1.2.1.2.2.1.2"
+	tests := []struct {
+		name         string
+		args         []interface{}
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "index", args: []interface{}{ifDescr + ".7", ifDescr}, expected: "7"},
+		{name: "leading dots", args: []interface{}{"." + ifDescr + ".7", "." + ifDescr}, expected: "7"},
+		{name: "multi-part index", args: []interface{}{"1.3.6.1.2.1.31.1.2.1.3.10.20", "1.3.6.1.2.1.31.1.2.1.3"}, expected: "10.20"},
+		{name: "int", args: []interface{}{ifDescr + ".7", ifDescr, "int"}, expected: 7},
+		{
+			name:     "int and ip",
+			args:     []interface{}{"1.3.6.1.2.1.4.22.1.2.3.10.0.0.1", "1.3.6.1.2.1.4.22.1.2", "if_index:int, addr:ip"},
+			expected: map[string]interface{}{"if_index": 3, "addr": "10.0.0.1"},
+		},
+		{
+			name:     "string and implied",
+			args:     []interface{}{"1.2.3.2.104.105.101.116.104", "1.2.3", "user:string, iface:implied"},
+			expected: map[string]interface{}{"user": "hi", "iface": "eth"},
+		},
+		{name: "unnamed ip", args: []interface{}{"1.2.3.192.168.1.1", "1.2.3", "ip"}, expected: "192.168.1.1"},
+		{name: "not an instance", args: []interface{}{"1.2.4.1", "1.2.3"}, expectsError: true},
+		{name: "no index", args: []interface{}{"1.2.3", "1.2.3"}, expectsError: true},
+		{name: "not numeric", args: []interface{}{"IF-MIB::ifDescr.7", ifDescr}, expectsError: true},
+		{name: "sub-identifiers left", args: []interface{}{"1.2.3.1.2", "1.2.3", "int"}, expectsError: true},
+		{name: "too few sub-identifiers", args: []interface{}{"1.2.3.10.0.0", "1.2.3", "ip"}, expectsError: true},
+		{name: "string too long", args: []interface{}{"1.2.3.5.104.105", "1.2.3", "string"}, expectsError: true},
+		{name: "not an octet", args: []interface{}{"1.2.3.256.0.0.1", "1.2.3", "ip"}, expectsError: true},
+		{name: "unnamed objects", args: []interface{}{"1.2.3.1.2", "1.2.3", "int, int"}, expectsError: true},
+		{name: "implied not last", args: []interface{}{"1.2.3.1.2", "1.2.3", "a:implied, b:int"}, expectsError: true},
+		{name: "unknown type", args: []interface{}{"1.2.3.1", "1.2.3", "float"}, expectsError: true},
+		{name: "not a string", args: []interface{}{7, ifDescr}, expectsError: true},
+	}
+	library := NewLibrary()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call("oid_index", test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("oid_index(%q) got error: %v", test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("oid_index(%q) = %v, expected error", test.args, got)
+			case err == nil && !cmp.Equal(got, test.expected):
+				t.Errorf("oid_index(%q) = %v, expected %v", test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestOidIndexExpression(t *testing.T) {
+	// Eg: the interface of an entry of ipNetToMediaTable (ARP), which is indexed by ifIndex and address.
+	expression, err := oparse.Parse("oid_index(oid, '1.3.6.1.2.1.4.22.1.2', syntax='if_index:int, addr:ip').if_index")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, NewLibrary().Signatures()); err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	got, err := oparse.Eval(expression, oparse.Context{"oid": "1.3.6.1.2.1.4.22.1.2.3.10.0.0.1"}, NewLibrary().Call)
+	if err != nil || got != 3.0 {
+		t.Errorf("Eval(%v) = %v, %v, expected 3", expression, got, err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+
+	"github.com/golang/glog"
+)
+
+// Code to load functions from Go plugins.
+
+// registerSymbol is the name of the function which plugins export to add their functions.
+const registerSymbol = "Register"
+
+/*
+WithPlugins returns a library containing this library's functions and those of the Go plugins (.so
+files) in the given directory, eg: vendor-specific helpers which ship separately from the core binary.
+Each plugin must export a function
+
+	func Register(lib functions.Library) (functions.Library, error)
+
+which returns the library with the plugin's functions added (see With and WithArgNames), preferably in
+the vendor's namespace (see WithNamespace), so that plugins of different vendors cannot clash. Plugins are
+registered in order of their file names, so each sees the functions of those before it. Plugins must
+be built (with go build -buildmode=plugin) against the same version of Orismologer as the binary
+which loads them, and are only supported where the plugin package is (eg: Linux, with cgo).
+*/
+func (l Library) WithPlugins(dir string) (Library, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return Library{}, fmt.Errorf("could not load plugins: %v", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return Library{}, err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return Library{}, fmt.Errorf("could not open plugin %v: %v", path, err)
+		}
+		symbol, err := p.Lookup(registerSymbol)
+		if err != nil {
+			return Library{}, fmt.Errorf("could not load plugin %v: %v", path, err)
+		}
+		if l, err = l.register(path, symbol); err != nil {
+			return Library{}, err
+		}
+		glog.Infof("loaded functions from plugin %v", path)
+	}
+	return l, nil
+}
+
+// register calls the Register function of a plugin.
+func (l Library) register(path string, symbol plugin.Symbol) (Library, error) {
+	register, ok := symbol.(func(Library) (Library, error))
+	if !ok {
+		return Library{}, fmt.Errorf("%v of plugin %v is a %T, expected a func(functions.Library) (functions.Library, error)", registerSymbol, path, symbol)
+	}
+	registered, err := register(l)
+	if err != nil {
+		return Library{}, fmt.Errorf("could not register functions of plugin %v: %v", path, err)
+	}
+	return registered, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLibraryWithPlugins(t *testing.T) {
+	dir := t.TempDir()
+	// Other files are ignored.
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	l, err := NewLibrary().WithPlugins(dir)
+	if err != nil {
+		t.Fatalf("WithPlugins() of a directory without plugins got error: %v", err)
+	}
+	if !l.Contains("to_int") {
+		t.Errorf("WithPlugins() dropped existing functions")
+	}
+
+	if _, err := NewLibrary().WithPlugins(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("WithPlugins() of a missing directory got no error, expected an error")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "invalid.so"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if _, err := NewLibrary().WithPlugins(dir); err == nil {
+		t.Errorf("WithPlugins() of an invalid plugin got no error, expected an error")
+	}
+}
+
+func TestLibraryRegister(t *testing.T) {
+	// The plugins' Register functions, as they would be looked up.
+	register := func(l Library) (Library, error) {
+		return l.With(map[string]interface{}{
+			"shout": func(s string) string { return strings.ToUpper(s) },
+		})
+	}
+	l, err := NewLibrary().register("shout.so", register)
+	if err != nil {
+		t.Fatalf("register() got error: %v", err)
+	}
+	if got, err := l.Call("shout", "up"); err != nil || got != "UP" {
+		t.Errorf("Call(\"shout\", \"up\") = %v, %v, expected \"UP\", nil", got, err)
+	}
+	if !l.Contains("to_int") {
+		t.Errorf("register() dropped existing functions")
+	}
+
+	for name, symbol := range map[string]interface{}{
+		"wrong signature": func(l Library) Library { return l },
+		"not a function":  &l,
+		"failing":         func(l Library) (Library, error) { return l, errors.New("no") },
+		"clashing":        func(l Library) (Library, error) { return register(l) },
+	} {
+		if _, err := l.register(name+".so", symbol); err == nil {
+			t.Errorf("register() of %v plugin got no error, expected an error", name)
+		}
+	}
+}
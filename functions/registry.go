@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"sync"
+)
+
+// Code to change the functions available to expressions while they are evaluated.
+
+/*
+Registry holds a library to which functions may be registered while other goroutines call its
+functions, eg: by plugins loaded at runtime. Libraries themselves are never modified (their With
+methods return modified copies), so a Registry replaces its library with a modified copy on each
+change, and each call uses the library which was current when it began. A Registry is safe for
+concurrent use, and may be used wherever a library's functions are called, eg: by oparse.Eval.
+*/
+type Registry struct {
+	mu      sync.RWMutex // Guards library.
+	library Library
+}
+
+// NewRegistry returns a registry holding the given library.
+func NewRegistry(library Library) *Registry {
+	return &Registry{library: library}
+}
+
+// Library returns the current library, which later registrations do not change.
+func (r *Registry) Library() Library {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.library
+}
+
+/*
+Update replaces the library with the one returned by update, unless it returns an error, eg:
+r.Update(func(l Library) (Library, error) { return l.WithDoc("f", "Does f.") }). Updates are
+serialized, so none is lost, but update should be quick, as it delays other updates.
+*/
+func (r *Registry) Update(update func(Library) (Library, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	updated, err := update(r.library)
+	if err != nil {
+		return err
+	}
+	r.library = updated
+	return nil
+}
+
+// Register adds the given functions to the library (see Library.With).
+func (r *Registry) Register(functions map[string]interface{}) error {
+	return r.Update(func(l Library) (Library, error) { return l.With(functions) })
+}
+
+// Contains returns true if the current library has a function with the given name.
+func (r *Registry) Contains(funcName string) bool {
+	return r.Library().Contains(funcName)
+}
+
+// Call calls a function of the current library (see Library.Call).
+func (r *Registry) Call(funcName string, args ...interface{}) (interface{}, error) {
+	return r.Library().Call(funcName, args...)
+}
+
+// CallWithContext calls a function of the current library for an expression evaluated in the given context (see Library.CallWithContext).
+func (r *Registry) CallWithContext(cc CallContext, funcName string, args ...interface{}) (interface{}, error) {
+	return r.Library().CallWithContext(cc, funcName, args...)
+}
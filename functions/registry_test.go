@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Run with -race to check that registering functions does not race with calls.
+func TestRegistryConcurrent(t *testing.T) {
+	const registrations = 50
+	r := NewRegistry(NewLibrary())
+	var wg sync.WaitGroup
+	for i := 0; i < registrations; i++ {
+		wg.Add(2)
+		name := fmt.Sprintf("f%v", i)
+		go func() {
+			defer wg.Done()
+			if err := r.Register(map[string]interface{}{name: func(a int) int { return a }}); err != nil {
+				t.Errorf("Register(%q) got error: %v", name, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if got, err := r.Call("abs", -1.0); err != nil || got != 1.0 {
+				t.Errorf("Call(\"abs\", -1) = %v, %v, expected 1, nil", got, err)
+			}
+			if r.Contains(name) {
+				if _, err := r.CallWithContext(CallContext{}, name, 1); err != nil {
+					t.Errorf("CallWithContext(%q) got error: %v", name, err)
+				}
+			}
+			r.Library().List()
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < registrations; i++ {
+		if name := fmt.Sprintf("f%v", i); !r.Contains(name) {
+			t.Errorf("Contains(%q) = false after it was registered", name)
+		}
+	}
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	r := NewRegistry(NewLibrary())
+	before := r.Library()
+	if err := r.Register(map[string]interface{}{"double": func(a float64) float64 { return 2 * a }}); err != nil {
+		t.Fatalf("Register() got error: %v", err)
+	}
+	if before.Contains("double") {
+		t.Errorf("Register() modified a library returned before it")
+	}
+	if err := r.Register(map[string]interface{}{"double": func(a float64) float64 { return a }}); err == nil {
+		t.Errorf("Register() of a function already defined got no error")
+	}
+	if err := r.Update(func(l Library) (Library, error) { return Library{}, errors.New("failed") }); err == nil {
+		t.Errorf("Update() got no error from a failed update")
+	}
+	if got, err := r.Call("double", 2.0); err != nil || got != 4.0 {
+		t.Errorf("Call(\"double\", 2) = %v, %v, expected 4, nil (a failed update must not change the library)", got, err)
+	}
+}
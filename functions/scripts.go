@@ -0,0 +1,242 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/golang/glog"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Code to load functions from Starlark scripts.
+
+// maxScriptSteps limits the computation of each call of a script function, so that a looping script cannot stall polling.
+const maxScriptSteps = 1000000
+
+// scriptOptions are the Starlark dialect of scripts: loops and recursion are allowed, as calls are limited by maxScriptSteps.
+var scriptOptions = &syntax.FileOptions{Set: true, While: true, Recursion: true}
+
+var (
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+/*
+WithScripts returns a library containing this library's functions and those defined in the given
+Starlark (https://github.com/bazelbuild/starlark) files, eg: small parsing helpers, which can then be
+added without rebuilding Orismologer. Each top-level function whose name does not start with an
+underscore is added, taking keyword arguments named after its parameters, with their default values
+(see WithDefaults), and described by its docstring (see WithDoc), eg:
+
+	def octal_to_int(s):
+	    """Parses an octal string."""
+	    return int(s, 8)
+
+Arguments and results may be numbers, strings, bools, None (nil) and dicts with string keys (maps).
+Scripts cannot load other files, and each call is limited to maxScriptSteps steps of computation.
+*/
+func (l Library) WithScripts(files ...string) (Library, error) {
+	for _, file := range files {
+		thread := &starlark.Thread{Name: file, Print: scriptPrinter(file)}
+		globals, err := starlark.ExecFileOptions(scriptOptions, thread, file, nil, nil)
+		if err != nil {
+			return Library{}, fmt.Errorf("could not load script %v: %v", file, err)
+		}
+		globals.Freeze()
+		if l, err = l.withScriptFunctions(file, globals); err != nil {
+			return Library{}, err
+		}
+		glog.Infof("loaded functions from script %v", file)
+	}
+	return l, nil
+}
+
+// withScriptFunctions adds the exported functions among the globals of a script.
+func (l Library) withScriptFunctions(file string, globals starlark.StringDict) (Library, error) {
+	var names []string
+	scriptFunctions := map[string]interface{}{}
+	for _, name := range globals.Keys() {
+		fn, ok := globals[name].(*starlark.Function)
+		if !ok || strings.HasPrefix(name, "_") {
+			continue
+		}
+		if fn.HasVarargs() || fn.HasKwargs() || fn.NumKwonlyParams() > 0 {
+			return Library{}, fmt.Errorf("function %q of script %v must only have positional parameters", name, file)
+		}
+		names = append(names, name)
+		scriptFunctions[name] = scriptFunction(file, fn)
+	}
+	l, err := l.With(scriptFunctions)
+	if err != nil {
+		return Library{}, fmt.Errorf("could not add functions of script %v: %v", file, err)
+	}
+	for _, name := range names {
+		fn := globals[name].(*starlark.Function)
+		params := make([]string, fn.NumParams())
+		for i := range params {
+			params[i], _ = fn.Param(i)
+		}
+		if l, err = l.WithArgNames(name, params...); err != nil {
+			return Library{}, err
+		}
+		var defaults []interface{}
+		for i := range params {
+			if d := fn.ParamDefault(i); d != nil {
+				value, err := fromStarlark(d)
+				if err != nil {
+					return Library{}, fmt.Errorf("default of argument %q of function %q: %v", params[i], name, err)
+				}
+				defaults = append(defaults, value)
+			}
+		}
+		if l, err = l.WithDefaults(name, defaults...); err != nil {
+			return Library{}, err
+		}
+		if l, err = l.WithDoc(name, strings.TrimSpace(fn.Doc())); err != nil {
+			return Library{}, err
+		}
+	}
+	return l, nil
+}
+
+/*
+scriptFunction returns a Go function which calls the given Starlark function, taking one
+interface{} per parameter and returning (interface{}, error), so that it can be called (and
+validated) like any other library function.
+*/
+func scriptFunction(file string, fn *starlark.Function) interface{} {
+	in := make([]reflect.Type, fn.NumParams())
+	for i := range in {
+		in[i] = interfaceType
+	}
+	t := reflect.FuncOf(in, []reflect.Type{interfaceType, errorType}, false)
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		result, err := callScript(file, fn, args)
+		if err != nil {
+			return []reflect.Value{reflect.Zero(interfaceType), reflect.ValueOf(&err).Elem()}
+		}
+		return []reflect.Value{reflect.ValueOf(&result).Elem(), reflect.Zero(errorType)}
+	}).Interface()
+}
+
+func callScript(file string, fn *starlark.Function, args []reflect.Value) (interface{}, error) {
+	scriptArgs := make(starlark.Tuple, len(args))
+	for i, arg := range args {
+		var err error
+		if scriptArgs[i], err = toStarlark(arg.Interface()); err != nil {
+			return nil, fmt.Errorf("argument %v of function %q: %v", i+1, fn.Name(), err)
+		}
+	}
+	thread := &starlark.Thread{Name: file, Print: scriptPrinter(file)}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+	result, err := starlark.Call(thread, fn, scriptArgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	value, err := fromStarlark(result)
+	if err != nil {
+		return nil, fmt.Errorf("result of function %q: %v", fn.Name(), err)
+	}
+	return value, nil
+}
+
+// scriptPrinter logs the output of print statements in scripts.
+func scriptPrinter(file string) func(*starlark.Thread, string) {
+	return func(_ *starlark.Thread, msg string) {
+		glog.Infof("%v: %v", file, msg)
+	}
+}
+
+// toStarlark converts an argument of a function to a Starlark value.
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case *big.Int:
+		return starlark.MakeBigInt(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case map[string]interface{}:
+		dict := starlark.NewDict(len(v))
+		for key, element := range v {
+			converted, err := toStarlark(element)
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("values of type %T cannot be passed to scripts", value)
+}
+
+/*
+fromStarlark converts the result of a script function to a Go value: integers to an int, or to a
+uint64 or float64 if they do not fit, and dicts to a map[string]interface{}.
+*/
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok && int64(int(i)) == i {
+			return int(i), nil
+		}
+		if u, ok := v.Uint64(); ok {
+			return u, nil
+		}
+		return float64(v.Float()), nil
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.Dict:
+		converted := map[string]interface{}{}
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, but got %v", item[0].Type())
+			}
+			element, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			converted[string(key)] = element
+		}
+		return converted, nil
+	}
+	return nil, fmt.Errorf("values of type %v cannot be returned from scripts", value.Type())
+}
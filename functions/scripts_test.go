@@ -0,0 +1,148 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
+)
+
+const testScript = `
+def octal_to_int(s):
+    """Parses an octal string."""
+    return int(s, 8)
+
+def scale(value, factor = 10):
+    if value == None:
+        return None
+    return value * factor
+
+def describe(port):
+    return {"name": port["name"].upper(), "up": port["status"] == 1}
+
+def spin():
+    while True:
+        pass
+
+def _helper():
+    return 1
+
+constant = 42
+`
+
+// writeScript writes a script to a temporary file, returning its path.
+func writeScript(t *testing.T, name, script string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	return path
+}
+
+func TestLibraryWithScripts(t *testing.T) {
+	l, err := NewLibrary().WithScripts(writeScript(t, "test.star", testScript))
+	if err != nil {
+		t.Fatalf("WithScripts() got error: %v", err)
+	}
+	if !l.Contains("to_int") {
+		t.Errorf("WithScripts() dropped existing functions")
+	}
+	for _, name := range []string{"_helper", "constant"} {
+		if l.Contains(name) {
+			t.Errorf("WithScripts() added %q, expected only functions not starting with an underscore", name)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		funcName      string
+		args          []interface{}
+		expected      interface{}
+		expectedError bool
+	}{
+		{name: "string to int", funcName: "octal_to_int", args: []interface{}{"377"}, expected: 255},
+		{name: "float", funcName: "scale", args: []interface{}{1.5, 2}, expected: 3.0},
+		{name: "uint64", funcName: "scale", args: []interface{}{uint64(1) << 63, 1}, expected: uint64(1) << 63},
+		{name: "none", funcName: "scale", args: []interface{}{nil, 2}, expected: nil},
+		{name: "keyword args", funcName: "scale", args: []interface{}{oparse.KeywordArgs{"factor": 3, "value": 2}}, expected: 6},
+		{name: "default", funcName: "scale", args: []interface{}{2}, expected: 20},
+		{
+			name:     "maps",
+			funcName: "describe",
+			args:     []interface{}{map[string]interface{}{"name": "eth0", "status": int64(1)}},
+			expected: map[string]interface{}{"name": "ETH0", "up": true},
+		},
+		{name: "script error", funcName: "octal_to_int", args: []interface{}{"zz"}, expectedError: true},
+		{name: "unsupported argument", funcName: "octal_to_int", args: []interface{}{[]string{"377"}}, expectedError: true},
+		{name: "too many steps", funcName: "spin", expectedError: true},
+		{name: "wrong number of args", funcName: "scale", args: []interface{}{1, 2, 3}, expectedError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := l.Call(test.funcName, test.args...)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("Call(%q) = %v, expected an error", test.funcName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Call(%q) got error: %v", test.funcName, err)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("Call(%q) returned unexpected result (-expected +got):\n%v", test.funcName, diff)
+			}
+		})
+	}
+
+	signature := l.Signatures()["scale"]
+	if expected := []string{"value", "factor"}; !cmp.Equal(signature.Names, expected) {
+		t.Errorf("Signatures() names of scale = %v, expected %v", signature.Names, expected)
+	}
+	if s, err := l.Signature("octal_to_int"); err != nil || s.Doc != "Parses an octal string." {
+		t.Errorf("Signature(\"octal_to_int\") = %+v (error %v), expected the docstring as its doc", s, err)
+	}
+}
+
+func TestLibraryWithScriptsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{name: "syntax error", script: "def f(:\n    return 1\n"},
+		{name: "runtime error", script: "x = 1 // 0\n"},
+		{name: "load", script: "load('other.star', 'f')\n"},
+		{name: "clash", script: "def to_int(s):\n    return 1\n"},
+		{name: "varargs", script: "def f(*args):\n    return 1\n"},
+		{name: "kwargs", script: "def f(**kwargs):\n    return 1\n"},
+		{name: "unsupported default", script: "def f(x = []):\n    return x\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewLibrary().WithScripts(writeScript(t, "test.star", test.script)); err == nil {
+				t.Errorf("WithScripts() got no error, expected an error")
+			}
+		})
+	}
+	if _, err := NewLibrary().WithScripts(filepath.Join(t.TempDir(), "missing.star")); err == nil {
+		t.Errorf("WithScripts() of a missing script got no error, expected an error")
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/orismologer/oparse"
+)
+
+// Functions for describing the functions of a library to users.
+
+/*
+Signature describes a function of a library, eg: so that tools can show users what it expects. The
+kinds of its arguments and result, and the names of its arguments, are those used to validate
+expressions (see oparse.Signature).
+*/
+type Signature struct {
+	oparse.Signature
+	Name string
+	// Defaults are the default values of the last len(Defaults) arguments (see WithDefaults).
+	Defaults []interface{}
+	// Doc describes the function, or is empty if it is undocumented (see WithDoc).
+	Doc string
+	// ArgDocs describe the function's arguments, by name (see WithArgDoc).
+	ArgDocs map[string]string
+}
+
+// List returns the names of the library's functions, in alphabetical order.
+func (l Library) List() []string {
+	names := make([]string, 0, len(l.functions))
+	for name := range l.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Signature returns the signature of the named function.
+func (l Library) Signature(funcName string) (Signature, error) {
+	if !l.Contains(funcName) {
+		return Signature{}, fmt.Errorf("function %q undefined", funcName)
+	}
+	signature := l.signature(funcName)
+	// Only the arguments' current names, should they have been renamed since they were described.
+	argDocs := map[string]string{}
+	for _, name := range signature.Names {
+		if doc, ok := l.argDocs[funcName][name]; ok {
+			argDocs[name] = doc
+		}
+	}
+	return Signature{
+		Signature: signature,
+		Name:      funcName,
+		Defaults:  l.defaults[funcName],
+		Doc:       l.docs[funcName],
+		ArgDocs:   argDocs,
+	}, nil
+}
+
+/*
+Describe returns help for users on the named function: its signature (see Signature.String), followed
+by its description and those of its arguments, eg:
+
+	round(value any, digits any = 0) float
+	    Rounds a number (half away from zero) to the given number of digits after the point, ...
+
+	    digits: The number of digits after the point, or before it if negative.
+*/
+func (l Library) Describe(funcName string) (string, error) {
+	signature, err := l.Signature(funcName)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(signature.String())
+	if signature.Doc != "" {
+		fmt.Fprintf(&b, "\n    %v", indent(signature.Doc))
+	}
+	if len(signature.ArgDocs) > 0 {
+		b.WriteString("\n")
+	}
+	for _, name := range signature.Names {
+		if doc, ok := signature.ArgDocs[name]; ok {
+			fmt.Fprintf(&b, "\n    %v: %v", name, indent(doc))
+		}
+	}
+	return b.String(), nil
+}
+
+// indent indents the lines of a description after its first, to line up with it in help.
+func indent(doc string) string {
+	return strings.Replace(doc, "\n", "\n    ", -1)
+}
+
+// WithDoc returns a library in which the named function has the given description.
+func (l Library) WithDoc(funcName, doc string) (Library, error) {
+	if !l.Contains(funcName) {
+		return Library{}, fmt.Errorf("function %q undefined", funcName)
+	}
+	merged := map[string]string{funcName: doc}
+	for name, d := range l.docs {
+		if name != funcName {
+			merged[name] = d
+		}
+	}
+	l.docs = merged
+	return l, nil
+}
+
+/*
+WithArgDoc returns a library in which the named argument of the named function has the given
+description. The function must take keyword arguments (see WithArgNames).
+*/
+func (l Library) WithArgDoc(funcName, argName, doc string) (Library, error) {
+	if !l.Contains(funcName) {
+		return Library{}, fmt.Errorf("function %q undefined", funcName)
+	}
+	if indexOf(l.argNames[funcName], argName) < 0 {
+		return Library{}, fmt.Errorf("function %q has no argument %q", funcName, argName)
+	}
+	argDocs := map[string]string{argName: doc}
+	for name, d := range l.argDocs[funcName] {
+		if name != argName {
+			argDocs[name] = d
+		}
+	}
+	merged := map[string]map[string]string{funcName: argDocs}
+	for name, d := range l.argDocs {
+		if name != funcName {
+			merged[name] = d
+		}
+	}
+	l.argDocs = merged
+	return l, nil
+}
+
+/*
+String formats the signature as a declaration, eg:
+
+	time_since_epoch(value any, format string, units string = "s") int
+
+Arguments without names (which cannot be passed as keyword arguments) are listed by kind only.
+*/
+func (s Signature) String() string {
+	args := make([]string, len(s.Args))
+	firstDefault := len(s.Args) - len(s.Defaults)
+	for i, kind := range s.Args {
+		args[i] = kind.String()
+		if i < len(s.Names) {
+			args[i] = s.Names[i] + " " + args[i]
+		}
+		if i >= firstDefault {
+			args[i] += " = " + formatDefault(s.Defaults[i-firstDefault])
+		}
+	}
+	return fmt.Sprintf("%v(%v) %v", s.Name, strings.Join(args, ", "), s.Result)
+}
+
+// formatDefault formats a default value as it would be written in an expression.
+func formatDefault(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLibraryList(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"quotient": func(a, b uint64) float64 { return float64(a) / float64(b) },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	expected := []string{
+		"abs", "assert_range", "avg", "base64_decode", "bytes_to_int", "ceil", "clamp", "contains", "count", "counter_delta32",
+		"date_and_time", "delta", "floor", "hex_to_bytes", "hex_to_int", "join", "log", "log2", "lookup", "lower", "max", "min",
+		"octets_to_str", "oid_index", "percent", "pow", "quotient", "rate", "ratio", "replace", "round", "safe_div", "split", "sqrt",
+		"substr", "sum", "textfsm", "time_since_epoch", "to_bool", "to_int", "to_str", "to_uint64", "trim", "upper",
+	}
+	if diff := cmp.Diff(expected, l.List()); diff != "" {
+		t.Errorf("List() returned unexpected names (-expected +got):\n%v", diff)
+	}
+}
+
+func TestLibrarySignature(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"quotient": func(a, b uint64) float64 { return float64(a) / float64(b) },
+		"row":      func(up bool, name interface{}) map[string]interface{} { return nil },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	if l, err = l.WithArgNames("row", "up", "name"); err != nil {
+		t.Fatalf("WithArgNames() got error: %v", err)
+	}
+	if l, err = l.WithDefaults("row", nil); err != nil {
+		t.Fatalf("WithDefaults() got error: %v", err)
+	}
+	if l, err = l.WithDoc("quotient", "Divides a by b."); err != nil {
+		t.Fatalf("WithDoc() got error: %v", err)
+	}
+	tests := []struct {
+		funcName string
+		expected string
+		doc      string
+	}{
+		{
+			funcName: "time_since_epoch",
+			expected: `time_since_epoch(value any, format string, units string = "s") int`,
+			doc:      docs["time_since_epoch"],
+		},
+		{funcName: "quotient", expected: "quotient(uint, uint) float", doc: "Divides a by b."},
+		{funcName: "rate", expected: "rate(counter any, key string, bits any = 64) float", doc: docs["rate"]},
+		{funcName: "lookup", expected: "lookup(string) any", doc: docs["lookup"]},
+		{funcName: "hex_to_int", expected: "hex_to_int(value any) uint", doc: docs["hex_to_int"]},
+		{funcName: "row", expected: "row(up bool, name any = null) map"},
+	}
+	for _, test := range tests {
+		t.Run(test.funcName, func(t *testing.T) {
+			got, err := l.Signature(test.funcName)
+			if err != nil {
+				t.Fatalf("Signature(%q) got error: %v", test.funcName, err)
+			}
+			if got.String() != test.expected {
+				t.Errorf("Signature(%q) = %v, expected %v", test.funcName, got, test.expected)
+			}
+			if got.Doc != test.doc {
+				t.Errorf("Signature(%q).Doc = %q, expected %q", test.funcName, got.Doc, test.doc)
+			}
+			if diff := cmp.Diff(l.Signatures()[test.funcName], got.Signature); diff != "" {
+				t.Errorf("Signature(%q) differs from Signatures() (-expected +got):\n%v", test.funcName, diff)
+			}
+		})
+	}
+
+	if _, err := l.Signature("undefined"); err == nil {
+		t.Errorf("Signature(\"undefined\") got no error, expected an error")
+	}
+	if _, err := l.WithDoc("undefined", "Does nothing."); err == nil {
+		t.Errorf("WithDoc(\"undefined\") got no error, expected an error")
+	}
+	// Every registered function is documented.
+	for _, name := range NewLibrary().List() {
+		if s, _ := NewLibrary().Signature(name); s.Doc == "" {
+			t.Errorf("registered function %q has no doc", name)
+		}
+	}
+}
+
+func TestLibraryDescribe(t *testing.T) {
+	l, err := NewLibrary().With(map[string]interface{}{
+		"quotient": func(a, b uint64) float64 { return float64(a) / float64(b) },
+		"scale":    func(value float64, factor float64) float64 { return value * factor },
+	})
+	if err != nil {
+		t.Fatalf("With() got error: %v", err)
+	}
+	if l, err = l.WithArgNames("scale", "value", "factor"); err != nil {
+		t.Fatalf("WithArgNames() got error: %v", err)
+	}
+	if l, err = l.WithDoc("scale", "Multiplies a value by a factor,\neg: to convert units."); err != nil {
+		t.Fatalf("WithDoc() got error: %v", err)
+	}
+	if l, err = l.WithArgDoc("scale", "factor", "What to multiply by."); err != nil {
+		t.Fatalf("WithArgDoc() got error: %v", err)
+	}
+	tests := []struct {
+		funcName string
+		expected string
+	}{
+		{funcName: "quotient", expected: "quotient(uint, uint) float"},
+		{
+			funcName: "scale",
+			expected: "scale(value float, factor float) float\n" +
+				"    Multiplies a value by a factor,\n" +
+				"    eg: to convert units.\n" +
+				"\n" +
+				"    factor: What to multiply by.",
+		},
+		{
+			funcName: "round",
+			expected: "round(value any, digits any = 0) float\n" +
+				"    " + docs["round"] + "\n" +
+				"\n" +
+				"    digits: " + argDocs["round"]["digits"],
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.funcName, func(t *testing.T) {
+			got, err := l.Describe(test.funcName)
+			if err != nil {
+				t.Fatalf("Describe(%q) got error: %v", test.funcName, err)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("Describe(%q) returned unexpected help (-expected +got):\n%v", test.funcName, diff)
+			}
+		})
+	}
+
+	if _, err := l.Describe("undefined"); err == nil {
+		t.Errorf("Describe(\"undefined\") got no error, expected an error")
+	}
+	if _, err := l.WithArgDoc("undefined", "value", "A value."); err == nil {
+		t.Errorf("WithArgDoc(\"undefined\") got no error, expected an error")
+	}
+	if _, err := l.WithArgDoc("scale", "divisor", "A divisor."); err == nil {
+		t.Errorf("WithArgDoc() of an undefined argument got no error, expected an error")
+	}
+	if _, err := l.WithArgDoc("quotient", "a", "A number."); err == nil {
+		t.Errorf("WithArgDoc() of a function without argument names got no error, expected an error")
+	}
+	// Renamed arguments lose their descriptions.
+	renamed, err := l.WithArgNames("scale", "value", "multiplier")
+	if err != nil {
+		t.Fatalf("WithArgNames() got error: %v", err)
+	}
+	if s, _ := renamed.Signature("scale"); len(s.ArgDocs) != 0 {
+		t.Errorf("Signature(\"scale\").ArgDocs = %v after renaming its arguments, expected none", s.ArgDocs)
+	}
+	// Registered argument descriptions name arguments of their functions.
+	for funcName, descriptions := range argDocs {
+		for argName := range descriptions {
+			if indexOf(argNames[funcName], argName) < 0 {
+				t.Errorf("argDocs describes argument %q, which function %q does not have", argName, funcName)
+			}
+		}
+	}
+}
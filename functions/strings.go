@@ -0,0 +1,119 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+Implementations of string functions, eg: to normalize interface descriptions or model names. Strings
+are indexed by character (not byte), and expressions have no lists, so split returns a single field.
+*/
+
+// trim removes the given characters from both ends of a string, or whitespace if chars is empty.
+func trim(value, chars string) string {
+	if chars == "" {
+		return strings.TrimSpace(value)
+	}
+	return strings.Trim(value, chars)
+}
+
+func contains(value, substring string) bool {
+	return strings.Contains(value, substring)
+}
+
+func replace(value, old, new string) string {
+	return strings.Replace(value, old, new, -1)
+}
+
+/*
+split splits a string at each separator, returning the field at the given index, which counts from the
+end of the string if it is negative, eg: split('GigabitEthernet0/1', '/', -1) is "1".
+*/
+func split(value, separator string, index interface{}) (string, error) {
+	i, err := toIndex(index)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Split(value, separator)
+	if i < 0 {
+		i += len(fields)
+	}
+	if i < 0 || i >= len(fields) {
+		return "", fmt.Errorf("%q has %v fields separated by %q, so has no field %v", value, len(fields), separator, index)
+	}
+	return fields[i], nil
+}
+
+/*
+substr returns up to length characters of a string, starting at start, which counts from the end of the
+string if it is negative. A negative length returns the rest of the string.
+*/
+func substr(value string, start, length interface{}) (string, error) {
+	s, err := toIndex(start)
+	if err != nil {
+		return "", err
+	}
+	n, err := toIndex(length)
+	if err != nil {
+		return "", err
+	}
+	runes := []rune(value)
+	if s < 0 {
+		s += len(runes)
+	}
+	if s < 0 || s > len(runes) {
+		return "", fmt.Errorf("start %v is out of range for %q", start, value)
+	}
+	if n < 0 || s+n > len(runes) {
+		n = len(runes) - s
+	}
+	return string(runes[s : s+n]), nil
+}
+
+// join joins two strings with a separator, omitting nulls and empty strings, eg: join(alias, description, ' - ').
+func join(a, b interface{}, separator string) (string, error) {
+	var parts []string
+	for _, value := range []interface{}{a, b} {
+		if value == nil {
+			continue
+		}
+		s, err := toStr(value)
+		if err != nil {
+			return "", err
+		}
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, separator), nil
+}
+
+// toIndex converts a number which must be an integer to an int.
+func toIndex(value interface{}) (int, error) {
+	f, err := toNumber(value)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+		return 0, fmt.Errorf("index %v is not an integer", value)
+	}
+	return int(f), nil
+}
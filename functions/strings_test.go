@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/orismologer/oparse"
+)
+
+func TestLibraryStrings(t *testing.T) {
+	tests := []struct {
+		name         string
+		funcName     string
+		args         []interface{}
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "split", funcName: "split", args: []interface{}{"Cisco IOS XE, Version 16.9.3", ", ", 1.0}, expected: "Version 16.9.3"},
+		{name: "split from the end", funcName: "split", args: []interface{}{"GigabitEthernet0/0/1", "/", -1}, expected: "1"},
+		{name: "split without separators", funcName: "split", args: []interface{}{"eth0", ",", 0}, expected: "eth0"},
+		{name: "split out of range", funcName: "split", args: []interface{}{"a,b", ",", 2}, expectsError: true},
+		{name: "split from before the start", funcName: "split", args: []interface{}{"a,b", ",", -3}, expectsError: true},
+		{name: "split at a fractional index", funcName: "split", args: []interface{}{"a,b", ",", 0.5}, expectsError: true},
+		{name: "join", funcName: "join", args: []interface{}{"uplink", "to core", ": "}, expected: "uplink: to core"},
+		{name: "join with null", funcName: "join", args: []interface{}{nil, "to core", ": "}, expected: "to core"},
+		{name: "join with empty string", funcName: "join", args: []interface{}{"uplink", "", ": "}, expected: "uplink"},
+		{name: "join of a number", funcName: "join", args: []interface{}{"uplink", 1.0, ": "}, expectsError: true},
+		{name: "substr", funcName: "substr", args: []interface{}{"GigabitEthernet0/1", 0, 7}, expected: "Gigabit"},
+		{name: "substr to the end", funcName: "substr", args: []interface{}{"GigabitEthernet0/1", 15}, expected: "0/1"},
+		{name: "substr from the end", funcName: "substr", args: []interface{}{"GigabitEthernet0/1", -3, 1}, expected: "0"},
+		{name: "substr of characters", funcName: "substr", args: []interface{}{"Ünïcode", 1, 2}, expected: "nï"},
+		{name: "substr past the end", funcName: "substr", args: []interface{}{"eth0", 3, 10}, expected: "0"},
+		{name: "substr at the end", funcName: "substr", args: []interface{}{"eth0", 4}, expected: ""},
+		{name: "substr out of range", funcName: "substr", args: []interface{}{"eth0", 5}, expectsError: true},
+		{name: "substr with a string start", funcName: "substr", args: []interface{}{"eth0", "one"}, expectsError: true},
+		{name: "trim", funcName: "trim", args: []interface{}{"\t eth0 \n"}, expected: "eth0"},
+		{name: "trim characters", funcName: "trim", args: []interface{}{"\"eth0\"", "\""}, expected: "eth0"},
+		{name: "upper", funcName: "upper", args: []interface{}{"cisco"}, expected: "CISCO"},
+		{name: "lower", funcName: "lower", args: []interface{}{"CISCO"}, expected: "cisco"},
+		{name: "lower of a number", funcName: "lower", args: []interface{}{1.0}, expectsError: true},
+		{name: "replace", funcName: "replace", args: []interface{}{"Gi0/1 Gi0/2", "Gi", "GigabitEthernet"}, expected: "GigabitEthernet0/1 GigabitEthernet0/2"},
+		{name: "contains", funcName: "contains", args: []interface{}{"Cisco IOS XE", "IOS"}, expected: true},
+		{name: "does not contain", funcName: "contains", args: []interface{}{"Cisco IOS XE", "NX-OS"}, expected: false},
+	}
+	library := NewLibrary()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := library.Call(test.funcName, test.args...)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Call(%q, %v) got error: %v", test.funcName, test.args, err)
+			case err == nil && test.expectsError:
+				t.Errorf("Call(%q, %v) = %v, expected error", test.funcName, test.args, got)
+			case err == nil && got != test.expected:
+				t.Errorf("Call(%q, %v) = %q, expected %q", test.funcName, test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	// Eg: the version of a device from its sysDescr.
+	expression, err := oparse.Parse("lower(trim(split(replace(descr, 'Version', ','), ',', -1)))")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, NewLibrary().Signatures()); err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	got, err := oparse.Eval(expression, oparse.Context{"descr": "Cisco IOS Software, Version 15.2(4)M7"}, NewLibrary().Call)
+	if err != nil || got != "15.2(4)m7" {
+		t.Errorf("Eval(%v) = %v, %v, expected 15.2(4)m7", expression, got, err)
+	}
+}
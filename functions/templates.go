@@ -0,0 +1,471 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+/*
+Code to parse the semi-structured output of CLI commands (eg: `show environment`) with TextFSM
+templates (https://github.com/google/textfsm/wiki/TextFSM), so that CLI output can feed expressions.
+*/
+
+// templateExtension is the extension of the template files loaded by WithTemplates.
+const templateExtension = ".textfsm"
+
+// keySeparator separates the values of the Key values of a template in the keys of its records.
+const keySeparator = "|"
+
+var (
+	stateName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	// A reference to a value in a rule, eg: ${name} or $name, or an escaped dollar sign ($$).
+	valueReference = regexp.MustCompile(`\$\{(\w+)\}|\$(\w+)|\$\$`)
+)
+
+// template is a parsed TextFSM template.
+type template struct {
+	name   string
+	values []*templateValue
+	states map[string][]*templateRule
+}
+
+// templateValue is a Value of a template, which records have a field for.
+type templateValue struct {
+	name                                  string
+	regex                                 string // With a named group for the value, eg: (?P<name>\S+).
+	filldown, key, required, list, fillup bool
+}
+
+// templateRule is a rule of a state of a template, matching a line of output.
+type templateRule struct {
+	re        *regexp.Regexp
+	next      bool   // Whether to go on to the next line (Next), or apply the state's next rule to the same line (Continue).
+	record    string // "Record", "Clear", "Clearall" or "" (NoRecord).
+	isError   bool   // Whether matching lines fail parsing (Error), with the message err, if it is not empty.
+	err       string
+	nextState string // If not empty, the state to go on in.
+}
+
+/*
+WithTemplates returns a library whose textfsm function parses output with the TextFSM templates
+(.textfsm files) in the given directory, each named after its file without the extension, eg:
+`textfsm(output, 'cisco_envmon')` uses cisco_envmon.textfsm.
+*/
+func (l Library) WithTemplates(dir string) (Library, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return Library{}, fmt.Errorf("could not load templates: %v", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+templateExtension))
+	if err != nil {
+		return Library{}, err
+	}
+	templates := map[string]*template{}
+	for _, path := range paths {
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Library{}, fmt.Errorf("could not read template %v: %v", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), templateExtension)
+		t, err := parseTemplate(name, string(text))
+		if err != nil {
+			return Library{}, fmt.Errorf("could not parse template %v: %v", path, err)
+		}
+		templates[name] = t
+		glog.Infof("loaded template %v", path)
+	}
+	merged := map[string]interface{}{}
+	for name, f := range l.functions {
+		merged[name] = f
+	}
+	merged["textfsm"] = func(output, templateName string) (map[string]interface{}, error) {
+		return textfsm(templates, output, templateName)
+	}
+	l.functions, l.adapters = merged, adapters(merged)
+	return l, nil
+}
+
+// noTemplates is the textfsm function of a library without templates (see WithTemplates).
+func noTemplates(output, templateName string) (map[string]interface{}, error) {
+	return textfsm(nil, output, templateName)
+}
+
+/*
+textfsm parses output with the named template, returning its records by the values of the template's
+Key values (joined by keySeparator), or by their positions ("0", "1", ...) if it has none. Each record
+maps the template's values to the strings they matched, or to lists of them for List values.
+*/
+func textfsm(templates map[string]*template, output, templateName string) (map[string]interface{}, error) {
+	t, ok := templates[templateName]
+	if !ok && len(templates) == 0 {
+		return nil, fmt.Errorf("no template %q, as no templates are loaded", templateName)
+	}
+	if !ok {
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no template %q (templates: %v)", templateName, strings.Join(names, ", "))
+	}
+	records, err := t.parse(output)
+	if err != nil {
+		return nil, err
+	}
+	return t.keyed(records)
+}
+
+// parseTemplate parses the text of a TextFSM template: Value definitions, then a blank line, then states of rules.
+func parseTemplate(name, text string) (*template, error) {
+	t := &template{name: name, states: map[string][]*templateRule{}}
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if line == "" {
+			if len(t.values) > 0 {
+				break
+			}
+			continue
+		}
+		value, err := parseValue(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		for _, v := range t.values {
+			if v.name == value.name {
+				return nil, fmt.Errorf("line %v: value %q is defined twice", i+1, value.name)
+			}
+		}
+		t.values = append(t.values, value)
+	}
+	if len(t.values) == 0 {
+		return nil, fmt.Errorf("template defines no values")
+	}
+	state := ""
+	for i++; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			state = ""
+		case strings.HasPrefix(trimmed, "#"):
+		case state == "":
+			if !stateName.MatchString(line) {
+				return nil, fmt.Errorf("line %v: %q is not a state name", i+1, line)
+			}
+			if _, ok := t.states[line]; ok {
+				return nil, fmt.Errorf("line %v: state %q is defined twice", i+1, line)
+			}
+			state = line
+			t.states[state] = nil
+		default:
+			rule, err := t.parseRule(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", i+1, err)
+			}
+			t.states[state] = append(t.states[state], rule)
+		}
+	}
+	if _, ok := t.states["Start"]; !ok {
+		return nil, fmt.Errorf("template has no Start state")
+	}
+	for name, rules := range t.states {
+		for _, rule := range rules {
+			if _, ok := t.states[rule.nextState]; !ok && rule.nextState != "" && rule.nextState != "End" && rule.nextState != "EOF" {
+				return nil, fmt.Errorf("state %q goes on to undefined state %q", name, rule.nextState)
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseValue parses a Value definition, eg: `Value Required,Filldown name (\S+)`.
+func parseValue(line string) (*templateValue, error) {
+	if !strings.HasPrefix(line, "Value ") {
+		return nil, fmt.Errorf("expected a Value definition, got %q", line)
+	}
+	parts := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "Value ")), " ", 3)
+	v := &templateValue{}
+	var regex string
+	if len(parts) == 3 && !strings.HasPrefix(parts[1], "(") {
+		for _, option := range strings.Split(parts[0], ",") {
+			switch option {
+			case "Filldown":
+				v.filldown = true
+			case "Key":
+				v.key = true
+			case "Required":
+				v.required = true
+			case "List":
+				v.list = true
+			case "Fillup":
+				v.fillup = true
+			default:
+				return nil, fmt.Errorf("unknown option %q of value %q", option, parts[1])
+			}
+		}
+		v.name, regex = parts[1], parts[2]
+	} else if len(parts) >= 2 {
+		v.name, regex = parts[0], strings.Join(parts[1:], " ")
+	} else {
+		return nil, fmt.Errorf("value definition %q has no regex", line)
+	}
+	if !identifier.MatchString(v.name) {
+		return nil, fmt.Errorf("value name %q is not an identifier", v.name)
+	}
+	if !strings.HasPrefix(regex, "(") || !strings.HasSuffix(regex, ")") {
+		return nil, fmt.Errorf("regex %q of value %q must be in brackets", regex, v.name)
+	}
+	v.regex = "(?P<" + v.name + ">" + regex[1:]
+	if _, err := regexp.Compile(v.regex); err != nil {
+		return nil, fmt.Errorf("invalid regex of value %q: %v", v.name, err)
+	}
+	return v, nil
+}
+
+/*
+parseRule parses a rule, eg: `^Fan ${name} is ${status} -> Record`, whose regex may refer to the
+template's values, optionally followed by an action of a line operation (Next or Continue) and/or a
+record operation (NoRecord, Record, Clear or Clearall), joined by a dot, then a new state, or by Error
+and an optional quoted message.
+*/
+func (t *template) parseRule(line string) (*templateRule, error) {
+	if !strings.HasPrefix(line, "^") {
+		return nil, fmt.Errorf("rule %q does not start with ^", line)
+	}
+	rule := &templateRule{next: true}
+	pattern, action := line, ""
+	if i := strings.LastIndex(line, " -> "); i >= 0 {
+		pattern, action = line[:i], strings.TrimSpace(line[i+len(" -> "):])
+	}
+	var undefined []string
+	regex := valueReference.ReplaceAllStringFunc(pattern, func(reference string) string {
+		if reference == "$$" {
+			return `\$`
+		}
+		name := strings.Trim(reference, "${}")
+		for _, v := range t.values {
+			if v.name == name {
+				return v.regex
+			}
+		}
+		undefined = append(undefined, name)
+		return reference
+	})
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf("rule %q refers to undefined value %q", line, undefined[0])
+	}
+	var err error
+	if rule.re, err = regexp.Compile(regex); err != nil {
+		return nil, fmt.Errorf("invalid regex of rule %q: %v", line, err)
+	}
+	if action == "" {
+		return rule, nil
+	}
+	if action == "Error" || strings.HasPrefix(action, "Error ") {
+		rule.isError = true
+		if message := strings.TrimSpace(strings.TrimPrefix(action, "Error")); message != "" {
+			if rule.err, err = strconv.Unquote(message); err != nil {
+				return nil, fmt.Errorf("message %v of rule %q is not a quoted string", message, line)
+			}
+		}
+		return rule, nil
+	}
+	fields := strings.Fields(action)
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("invalid action %q of rule %q", action, line)
+	}
+	operations := strings.Split(fields[0], ".")
+	if len(operations) > 2 {
+		return nil, fmt.Errorf("invalid action %q of rule %q", action, line)
+	}
+	parsed := 0
+	for i, op := range operations {
+		switch {
+		case i == 0 && op == "Next":
+		case i == 0 && op == "Continue":
+			rule.next = false
+		case op == "NoRecord":
+		case op == "Record" || op == "Clear" || op == "Clearall":
+			rule.record = op
+		case i == 0 && len(operations) == 1:
+			continue // The new state.
+		default:
+			return nil, fmt.Errorf("invalid action %q of rule %q", action, line)
+		}
+		parsed++
+	}
+	switch {
+	case parsed == 0 && len(fields) == 1:
+		rule.nextState = fields[0]
+	case parsed > 0 && len(fields) == 2:
+		rule.nextState = fields[1]
+	case len(fields) == 2:
+		return nil, fmt.Errorf("invalid action %q of rule %q", action, line)
+	}
+	if !rule.next && rule.nextState != "" {
+		return nil, fmt.Errorf("rule %q cannot Continue in another state", line)
+	}
+	return rule, nil
+}
+
+// parse parses output with the template, returning its records, each of which maps values to what they matched.
+func (t *template) parse(output string) ([]map[string]interface{}, error) {
+	p := &templateParser{template: t, current: map[string]interface{}{}}
+	state := "Start"
+	for _, line := range strings.Split(strings.Replace(output, "\r\n", "\n", -1), "\n") {
+		for _, rule := range t.states[state] {
+			match := rule.re.FindStringSubmatchIndex(line)
+			if match == nil {
+				continue
+			}
+			if rule.isError {
+				if rule.err == "" {
+					return nil, fmt.Errorf("template %q does not expect line %q", t.name, line)
+				}
+				return nil, fmt.Errorf("template %q: %v (line %q)", t.name, rule.err, line)
+			}
+			// Values in groups which did not participate in the match (eg: optional ones) are not set.
+			for i, group := range rule.re.SubexpNames() {
+				if group != "" && match[2*i] >= 0 {
+					p.assign(group, line[match[2*i]:match[2*i+1]])
+				}
+			}
+			switch rule.record {
+			case "Record":
+				p.record()
+			case "Clear":
+				p.clear(false)
+			case "Clearall":
+				p.clear(true)
+			}
+			if rule.nextState != "" {
+				state = rule.nextState
+			}
+			if rule.next {
+				break
+			}
+		}
+		if state == "End" || state == "EOF" {
+			break
+		}
+	}
+	// Unless the template says otherwise, the last record ends with the output.
+	if _, ok := t.states["EOF"]; !ok && state != "End" {
+		p.record()
+	}
+	return p.records, nil
+}
+
+// keyed returns records keyed by the values of the template's Key values, or by their positions.
+func (t *template) keyed(records []map[string]interface{}) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for i, record := range records {
+		var keys []string
+		for _, v := range t.values {
+			if v.key {
+				keys = append(keys, fmt.Sprint(record[v.name]))
+			}
+		}
+		key := strconv.Itoa(i)
+		if len(keys) > 0 {
+			key = strings.Join(keys, keySeparator)
+		}
+		if _, ok := result[key]; ok {
+			return nil, fmt.Errorf("template %q parsed more than one record with key %q", t.name, key)
+		}
+		result[key] = record
+	}
+	return result, nil
+}
+
+// templateParser is the state of the parsing of output with a template.
+type templateParser struct {
+	template *template
+	current  map[string]interface{} // The values of the record being parsed, which are unset if absent.
+	records  []map[string]interface{}
+}
+
+// assign sets a value of the current record, adding to it if it is a List, and filling it up in previous records if it is Fillup.
+func (p *templateParser) assign(name, value string) {
+	for _, v := range p.template.values {
+		if v.name != name {
+			continue
+		}
+		if v.list {
+			list, _ := p.current[name].([]interface{})
+			p.current[name] = append(list, value)
+			return
+		}
+		p.current[name] = value
+		if v.fillup {
+			for i := len(p.records) - 1; i >= 0 && p.records[i][name] == ""; i-- {
+				p.records[i][name] = value
+			}
+		}
+	}
+}
+
+/*
+record adds the current record to the records, unless it has no values or lacks a Required value, and
+clears it for the next record. Unset values are empty strings (or lists).
+*/
+func (p *templateParser) record() {
+	if len(p.current) == 0 {
+		return
+	}
+	record := map[string]interface{}{}
+	for _, v := range p.template.values {
+		value, ok := p.current[v.name]
+		if v.required && !ok {
+			p.clear(false)
+			return
+		}
+		switch {
+		case ok:
+			record[v.name] = value
+		case v.list:
+			record[v.name] = []interface{}{}
+		default:
+			record[v.name] = ""
+		}
+	}
+	p.records = append(p.records, record)
+	p.clear(false)
+}
+
+// clear unsets the values of the current record, except those which are Filldown, unless all is true.
+func (p *templateParser) clear(all bool) {
+	for _, v := range p.template.values {
+		if all || !v.filldown {
+			delete(p.current, v.name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
+)
+
+const envmonTemplate = `# Parses show environment.
+Value Filldown slot (\d+)
+Value Key,Required name (\S+)
+Value status (OK|FAIL)
+Value List alarms (\w+)
+
+Start
+  ^Slot ${slot}
+  ^Power supplies -> Supplies
+  ^Unexpected -> Error "unexpected line"
+
+Supplies
+  ^  ${name} is ${status} -> Continue
+  ^  \S+ is \S+( alarm ${alarms})? -> Record
+  ^$$ -> Start
+`
+
+const envmonOutput = `Slot 1
+Power supplies
+  PSU1 is OK
+  PSU2 is FAIL alarm overheat
+$
+Slot 2
+Power supplies
+  PSU3 is OK
+`
+
+const versionTemplate = `Value version (\S+)
+Value uptime (.+)
+
+Start
+  ^Version ${version}
+  ^Uptime is ${uptime} -> Record End
+`
+
+// writeTemplates writes templates to a temporary directory, returning its path.
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	dir := t.TempDir()
+	for name, template := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(template), 0644); err != nil {
+			t.Fatalf("Could not set up test: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestLibraryWithTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"envmon.textfsm":  envmonTemplate,
+		"version.textfsm": versionTemplate,
+		"ignored.txt":     "not a template",
+	})
+	l, err := NewLibrary().WithTemplates(dir)
+	if err != nil {
+		t.Fatalf("WithTemplates() got error: %v", err)
+	}
+	tests := []struct {
+		name          string
+		args          []interface{}
+		expected      interface{}
+		expectedError bool
+	}{
+		{
+			name: "records by key",
+			args: []interface{}{envmonOutput, "envmon"},
+			expected: map[string]interface{}{
+				"PSU1": map[string]interface{}{"slot": "1", "name": "PSU1", "status": "OK", "alarms": []interface{}{}},
+				"PSU2": map[string]interface{}{"slot": "1", "name": "PSU2", "status": "FAIL", "alarms": []interface{}{"overheat"}},
+				"PSU3": map[string]interface{}{"slot": "2", "name": "PSU3", "status": "OK", "alarms": []interface{}{}},
+			},
+		},
+		{
+			name: "records by position",
+			args: []interface{}{"Version 15.2\nUptime is 3 weeks\nVersion 16.1\n", "version"},
+			expected: map[string]interface{}{
+				"0": map[string]interface{}{"version": "15.2", "uptime": "3 weeks"},
+			},
+		},
+		{name: "no records", args: []interface{}{"", "envmon"}, expected: map[string]interface{}{}},
+		{name: "error rule", args: []interface{}{"Unexpected", "envmon"}, expectedError: true},
+		{name: "duplicate keys", args: []interface{}{"Power supplies\n  PSU1 is OK\n  PSU1 is OK\n", "envmon"}, expectedError: true},
+		{name: "undefined template", args: []interface{}{envmonOutput, "ignored"}, expectedError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := l.Call("textfsm", test.args...)
+			switch {
+			case err != nil && !test.expectedError:
+				t.Errorf("textfsm() got error: %v", err)
+			case err == nil && test.expectedError:
+				t.Errorf("textfsm() = %v, expected an error", got)
+			case err == nil:
+				if diff := cmp.Diff(test.expected, got); diff != "" {
+					t.Errorf("textfsm() returned unexpected records (-expected +got):\n%v", diff)
+				}
+			}
+		})
+	}
+
+	expression, err := oparse.Parse("textfsm(output, 'envmon')['PSU2'].status")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if err := oparse.Validate(expression, l.Signatures()); err != nil {
+		t.Errorf("Validate() got error: %v", err)
+	}
+	if got, err := oparse.Eval(expression, oparse.Context{"output": envmonOutput}, l.Call); err != nil || got != "FAIL" {
+		t.Errorf("Eval() = %v (error %v), expected FAIL", got, err)
+	}
+	if _, err := NewLibrary().Call("textfsm", envmonOutput, "envmon"); err == nil {
+		t.Errorf("textfsm() of a library without templates got no error")
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "no values", template: "Start\n  ^x\n"},
+		{name: "no Start state", template: "Value a (x)\n\nOther\n  ^${a}\n"},
+		{name: "regex without brackets", template: "Value a x\n\nStart\n  ^${a}\n"},
+		{name: "invalid regex", template: "Value a ([)\n\nStart\n  ^${a}\n"},
+		{name: "unknown option", template: "Value Sometimes a (x)\n\nStart\n  ^${a}\n"},
+		{name: "value defined twice", template: "Value a (x)\nValue a (y)\n\nStart\n  ^${a}\n"},
+		{name: "undefined value", template: "Value a (x)\n\nStart\n  ^${b}\n"},
+		{name: "rule without ^", template: "Value a (x)\n\nStart\n  ${a}\n"},
+		{name: "undefined state", template: "Value a (x)\n\nStart\n  ^${a} -> Other\n"},
+		{name: "invalid action", template: "Value a (x)\n\nStart\n  ^${a} -> Record.Next\n"},
+		{name: "continue in another state", template: "Value a (x)\n\nStart\n  ^${a} -> Continue Start\n"},
+		{name: "unquoted error message", template: "Value a (x)\n\nStart\n  ^${a} -> Error oops\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseTemplate(test.name, test.template); err == nil {
+				t.Errorf("parseTemplate(%q) got no error, expected an error", test.template)
+			}
+		})
+	}
+	if _, err := NewLibrary().WithTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("WithTemplates() of a missing directory got no error")
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmiserver
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// GNMIVersion is the version of the gNMI specification implemented by the server.
+const GNMIVersion = "0.7.0"
+
+/*
+TargetMetadataKey is the gRPC metadata key with which clients may name a target in a Capabilities
+request (which, unlike other gNMI requests, has no prefix). Only models with at least one leaf
+supported for the target's vendor are then reported.
+*/
+const TargetMetadataKey = "target"
+
+const openConfigOrganization = "OpenConfig working group"
+
+/*
+models maps top-level OpenConfig containers to the names of the models which define them, where the
+name is not simply "openconfig-" followed by the container.
+*/
+var models = map[string]string{
+	"components":        "openconfig-platform",
+	"network-instances": "openconfig-network-instance",
+	"routing-policy":    "openconfig-routing-policy",
+	"interfaces":        "openconfig-interfaces",
+}
+
+// modelName returns the name of the OpenConfig model defining the given top-level container.
+func modelName(container string) string {
+	if name, ok := models[container]; ok {
+		return name
+	}
+	return "openconfig-" + container
+}
+
+/*
+Capabilities reports the OpenConfig models which Orismologer has mappings for, derived from the
+top-level containers of the OpenConfig tree. A model's version is the latest revision declared by
+any of its leaves. If the request names a target (see TargetMetadataKey), models are only reported
+if at least one of their leaves can be evaluated for the target's vendor. Requests on a connection
+dedicated to a target (see TargetNetwork) are treated as naming it, and may not name another.
+*/
+func (s *Server) Capabilities(ctx context.Context, req *gpb.CapabilityRequest) (*gpb.CapabilityResponse, error) {
+	named := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(TargetMetadataKey)) > 0 {
+		named = md.Get(TargetMetadataKey)[0]
+	}
+	target, err := requestTarget(ctx, named)
+	if err != nil {
+		return nil, err
+	}
+	vendor := ""
+	if target != "" {
+		if vendor, err = s.vendor(target); err != nil {
+			return nil, err
+		}
+	}
+	leaves, err := s.evaluator.Leaves("/")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not list mapped paths: %v", err)
+	}
+	versions := map[string]string{} // Model name -> latest revision.
+	for _, leaf := range leaves {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		name := modelName(strings.SplitN(strings.TrimPrefix(leaf, "/"), "/", 2)[0])
+		if vendor != "" {
+			supported, err := s.evaluator.Supported(leaf, vendor)
+			if err != nil {
+				glog.Infof("could not determine whether %q is supported for %q: %v", leaf, vendor, err)
+			}
+			if !supported {
+				continue
+			}
+		}
+		revisions, err := s.evaluator.Revisions(leaf)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not get revisions of %q: %v", leaf, err)
+		}
+		version := versions[name]
+		for _, revision := range revisions {
+			if compareVersions(revision, version) > 0 {
+				version = revision
+			}
+		}
+		versions[name] = version
+	}
+	resp := &gpb.CapabilityResponse{
+		SupportedEncodings: []gpb.Encoding{gpb.Encoding_JSON, gpb.Encoding_JSON_IETF, gpb.Encoding_PROTO},
+		GNMIVersion:        GNMIVersion,
+	}
+	for name, version := range versions {
+		resp.SupportedModels = append(resp.SupportedModels, &gpb.ModelData{
+			Name:         name,
+			Organization: openConfigOrganization,
+			Version:      version,
+		})
+	}
+	sort.Slice(resp.SupportedModels, func(i, j int) bool {
+		return resp.SupportedModels[i].GetName() < resp.SupportedModels[j].GetName()
+	})
+	return resp, nil
+}
+
+/*
+compareVersions compares two dotted version strings (eg: "0.4.1") numerically, returning -1, 0 or 1.
+Non-numeric components are compared as strings. The empty string precedes every other version.
+*/
+func compareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	if b == "" {
+		return 1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, xErr := strconv.Atoi(as[i])
+		y, yErr := strconv.Atoi(bs[i])
+		switch {
+		case xErr == nil && yErr == nil && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		case (xErr != nil || yErr != nil) && as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
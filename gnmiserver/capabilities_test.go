@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmiserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func TestCapabilities(t *testing.T) {
+	s := makeServer()
+	interfaces := &gpb.ModelData{Name: "openconfig-interfaces", Organization: openConfigOrganization}
+	platform := &gpb.ModelData{Name: "openconfig-platform", Organization: openConfigOrganization}
+	system := &gpb.ModelData{Name: "openconfig-system", Organization: openConfigOrganization, Version: "0.10.0"}
+	for _, test := range []struct {
+		name          string
+		target        string
+		expected      []*gpb.ModelData
+		expectedError codes.Code
+	}{
+		{name: "all models", expected: []*gpb.ModelData{interfaces, platform, system}},
+		{name: "models supported for target", target: "switch1", expected: []*gpb.ModelData{interfaces, system}},
+		{name: "nothing supported for target", target: "ap1"},
+		{name: "unknown target", target: "unknown", expectedError: codes.NotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.target != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(TargetMetadataKey, test.target))
+			}
+			got, err := s.Capabilities(ctx, &gpb.CapabilityRequest{})
+			if code := status.Code(err); code != test.expectedError {
+				t.Fatalf("Capabilities() got code %v (%v), expected %v", code, err, test.expectedError)
+			}
+			if err != nil {
+				return
+			}
+			expected := &gpb.CapabilityResponse{
+				SupportedModels:    test.expected,
+				SupportedEncodings: []gpb.Encoding{gpb.Encoding_JSON, gpb.Encoding_JSON_IETF, gpb.Encoding_PROTO},
+				GNMIVersion:        GNMIVersion,
+			}
+			if !proto.Equal(got, expected) {
+				t.Errorf("Capabilities() = %v, expected %v", got, expected)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "0.4.1", b: "0.4.1", expected: 0},
+		{a: "0.10.0", b: "0.4.1", expected: 1},
+		{a: "0.4", b: "0.4.1", expected: -1},
+		{a: "", b: "0.1.0", expected: -1},
+		{a: "1.0.0-beta", b: "1.0.0-alpha", expected: 1},
+	} {
+		if got := compareVersions(test.a, test.b); got != test.expected {
+			t.Errorf("compareVersions(%q, %q) = %d, expected %d", test.a, test.b, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package gnmiserver serves OpenConfig telemetry for devices which do not natively support it over
+gNMI, backed by Orismologer. This lets gNMI-only collectors query legacy devices.
+
+Requests name the device in the target field of their prefix, or, over a connection dedicated to one
+device (see TargetNetwork), default to that device. The device's vendor is looked up in an Inventory
+proto.
+*/
+package gnmiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/google/orismologer/orismologer"
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+/*
+Evaluator evaluates OpenConfig paths for a target, with any tags added by post-processors. It is
+implemented by *orismologer.Orismologer.
+*/
+type Evaluator interface {
+	EvalResult(openConfigPath, target, vendor string) (*orismologer.Result, error)
+	Leaves(root string) ([]string, error)
+	Supported(openConfigPath, vendor string) (bool, error)
+	Revisions(openConfigPath string) ([]string, error)
+	KeyVariables(openConfigPath string) (map[string]string, error)
+}
+
+/*
+TargetNetwork is the network of the peer address of connections dedicated to a single target (eg:
+dial-out sessions opened by a collector), whose address is the target's name. Requests on such
+connections which do not name a target are for that target.
+*/
+const TargetNetwork = "orismologer-target"
+
+// Server implements the gNMI service.
+type Server struct {
+	evaluator Evaluator
+	vendors   map[string]string // Target name -> vendor.
+	now       func() time.Time
+}
+
+var _ gpb.GNMIServer = (*Server)(nil)
+
+// NewServer returns a gNMI server which evaluates paths for the targets in the given inventory.
+func NewServer(evaluator Evaluator, inventory *pb.Inventory) *Server {
+	vendors := map[string]string{}
+	for _, target := range inventory.GetTargets() {
+		vendors[target.GetName()] = target.GetVendor()
+	}
+	return &Server{
+		evaluator: evaluator,
+		vendors:   vendors,
+		now:       time.Now,
+	}
+}
+
+func (s *Server) vendor(target string) (string, error) {
+	if target == "" {
+		return "", status.Error(codes.InvalidArgument, "request prefix must name a target")
+	}
+	vendor, ok := s.vendors[target]
+	if !ok {
+		return "", status.Errorf(codes.NotFound, "unknown target %q", target)
+	}
+	return vendor, nil
+}
+
+// peerTarget returns the target a connection is dedicated to (see TargetNetwork), if any.
+func peerTarget(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil && p.Addr.Network() == TargetNetwork {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+/*
+requestTarget returns the target of a request which names the given target, if any. Requests on a
+connection dedicated to a target (see TargetNetwork) are for that target, and may not name another,
+so that a session opened to one target cannot be used to query the others.
+*/
+func requestTarget(ctx context.Context, named string) (string, error) {
+	dedicated := peerTarget(ctx)
+	switch {
+	case dedicated == "":
+		return named, nil
+	case named != "" && named != dedicated:
+		return "", status.Errorf(codes.PermissionDenied, "connection is dedicated to target %q, so cannot query target %q", dedicated, named)
+	default:
+		return dedicated, nil
+	}
+}
+
+/*
+Get evaluates each requested path for the target named in the request prefix (see requestTarget). A path may name a leaf
+or an interior node, in which case every leaf beneath it which can be evaluated for the target is
+returned. Each requested path yields one notification. With the JSON_IETF encoding, each notification
+holds a single update with the requested node encoded per RFC 7951 (see EncodeIETF); otherwise each
+leaf is a separate update with a scalar value.
+*/
+func (s *Server) Get(ctx context.Context, req *gpb.GetRequest) (*gpb.GetResponse, error) {
+	target, err := requestTarget(ctx, req.GetPrefix().GetTarget())
+	if err != nil {
+		return nil, err
+	}
+	vendor, err := s.vendor(target)
+	if err != nil {
+		return nil, err
+	}
+	resp := &gpb.GetResponse{}
+	paths := req.GetPath()
+	if len(paths) == 0 {
+		paths = []*gpb.Path{{}}
+	}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		var notification *gpb.Notification
+		fullPath := joinPaths(req.GetPrefix(), path)
+		// Label profiles, so that the cost of slow paths or targets can be found with pprof -tagfocus.
+		pprof.Do(ctx, pprof.Labels("target", target, "oc_path", PathToString(fullPath)), func(context.Context) {
+			notification, err = s.get(fullPath, target, vendor, req.GetEncoding())
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.Notification = append(resp.Notification, notification)
+	}
+	return resp, nil
+}
+
+func (s *Server) get(path *gpb.Path, target, vendor string, encoding gpb.Encoding) (*gpb.Notification, error) {
+	ocPath := PathToString(path)
+	leaves, results, err := s.evaluate(path, target, vendor)
+	if err != nil {
+		return nil, err
+	}
+	notification := &gpb.Notification{
+		Timestamp: s.now().UnixNano(),
+		Prefix:    &gpb.Path{Target: target, Origin: path.GetOrigin()},
+	}
+	if encoding == gpb.Encoding_JSON_IETF {
+		// Native devices return a requested subtree as a single JSON value, which has no place for tags.
+		values := map[string]interface{}{}
+		for leaf, result := range results {
+			values[leaf] = result.Value
+		}
+		encoded, err := EncodeIETF(ocPath, values)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+		update := &gpb.Update{
+			Path: &gpb.Path{Elem: path.GetElem(), Element: path.GetElement()},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: encoded}},
+		}
+		notification.Update = append(notification.Update, update)
+		return notification, nil
+	}
+	for _, leaf := range leaves {
+		update, err := ResultUpdate(results[leaf])
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+		notification.Update = append(notification.Update, update)
+	}
+	return notification, nil
+}
+
+/*
+evaluate evaluates every leaf beneath the given path for a target, returning the paths of the leaves
+which could be evaluated (in order) and their results. Leaves dropped by post-processors are skipped
+silently, and a dropped leaf is not found. A path may select list entries by key (eg:
+/interfaces/interface[name=2]), in which case the results are of the selected entries (see leaves).
+*/
+func (s *Server) evaluate(path *gpb.Path, target, vendor string) ([]string, map[string]*orismologer.Result, error) {
+	ocPath := PathToString(path)
+	leaves, selections, err := s.leaves(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var evaluated []string
+	results := map[string]*orismologer.Result{}
+	for _, leaf := range leaves {
+		selected := selections[leaf]
+		result, err := s.evaluator.EvalResult(leaf, target, vendor)
+		if err == nil && selected != nil {
+			result, err = selected.apply(result)
+		}
+		if errors.Is(err, orismologer.ErrDropped) {
+			continue
+		}
+		if err != nil {
+			if len(leaves) == 1 && (leaf == ocPath || selected != nil && selected.path == ocPath) {
+				return nil, nil, status.Errorf(codes.Unavailable, "could not evaluate %q for target %q: %v", ocPath, target, err)
+			}
+			// Not every leaf in a subtree need be supported for every vendor.
+			glog.Infof("skipping %q for target %q: %v", leaf, target, err)
+			continue
+		}
+		if result == nil { // The selected entry does not exist.
+			continue
+		}
+		evaluated = append(evaluated, result.Path)
+		results[result.Path] = result
+	}
+	if len(evaluated) == 0 {
+		return nil, nil, status.Errorf(codes.NotFound, "no values under %q could be evaluated for target %q", ocPath, target)
+	}
+	return evaluated, results, nil
+}
+
+/*
+leaves returns the mapped leaves beneath the given path. Paths are matched as they are written in the
+mappings (eg: /interfaces/interface[name=name_value]), unless they select list entries by key (eg:
+/interfaces/interface[name=2]): then the leaves are those beneath the lists whose keys are bound to
+variables mapped to NocPath variables (see the map field of OpenConfigNode), each with the entries it
+selects.
+*/
+func (s *Server) leaves(path *gpb.Path) ([]string, map[string]*selection, error) {
+	ocPath := PathToString(path)
+	leaves, err := s.evaluator.Leaves(ocPath)
+	i := firstKeyed(path)
+	if err == nil || i < 0 {
+		if err != nil {
+			return nil, nil, status.Errorf(codes.NotFound, "path %q is not mapped: %v", ocPath, err)
+		}
+		return leaves, nil, nil
+	}
+	parent := PathToString(&gpb.Path{Elem: path.GetElem()[:i]})
+	candidates, err := s.evaluator.Leaves(parent)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.NotFound, "path %q is not mapped: %v", ocPath, err)
+	}
+	leaves = nil
+	selections := map[string]*selection{}
+	for _, leaf := range candidates {
+		selected, err := s.selection(path, leaf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if selected != nil {
+			leaves = append(leaves, leaf)
+			selections[leaf] = selected
+		}
+	}
+	if len(leaves) == 0 {
+		return nil, nil, status.Errorf(codes.NotFound, "path %q is not mapped", ocPath)
+	}
+	return leaves, selections, nil
+}
+
+// selection is the entry of a table leaf selected by the keys of a path.
+type selection struct {
+	path      string   // Of the leaf, with the keys of the entry, eg: /interfaces/interface[name=2]/state/mtu.
+	instances []string // Indices of the entry in the leaf's value, outermost list first.
+}
+
+/*
+selection returns the entry of the given leaf which is selected by the keys of a path, or nil if the
+leaf is not beneath the path. Keys must be bound to variables which are mapped to NocPath variables.
+*/
+func (s *Server) selection(path *gpb.Path, leaf string) (*selection, error) {
+	leafPath, err := StringToPath(leaf)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	elems := leafPath.GetElem()
+	if len(elems) < len(path.GetElem()) {
+		return nil, nil
+	}
+	var variables map[string]string
+	selected := &selection{}
+	for i, elem := range path.GetElem() {
+		if elems[i].GetName() != elem.GetName() {
+			return nil, nil
+		}
+		keys := make([]string, 0, len(elem.GetKey()))
+		for key := range elem.GetKey() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			variable, ok := elems[i].GetKey()[key]
+			if !ok {
+				return nil, nil
+			}
+			if variables == nil {
+				if variables, err = s.evaluator.KeyVariables(leaf); err != nil {
+					return nil, status.Errorf(codes.Internal, "%v", err)
+				}
+			}
+			if _, ok := variables[variable]; !ok {
+				list := PathToString(&gpb.Path{Elem: elems[:i+1]})
+				return nil, status.Errorf(codes.Unimplemented, "key %q of %q is not mapped to a NocPath variable, so cannot select list entries", key, list)
+			}
+			elems[i].Key[key] = elem.GetKey()[key]
+			selected.instances = append(selected.instances, elem.GetKey()[key])
+		}
+	}
+	selected.path = PathToString(leafPath)
+	return selected, nil
+}
+
+/*
+apply narrows the result of a table leaf, whose value is a map of its entries keyed by index (nested
+for nested lists), to the selected entry. It returns nil if there is no such entry.
+*/
+func (s *selection) apply(result *orismologer.Result) (*orismologer.Result, error) {
+	value := result.Value
+	for _, instance := range s.instances {
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("value of %q is not a table, so its entries cannot be selected", result.Path)
+		}
+		if value, ok = entries[instance]; !ok {
+			return nil, nil
+		}
+	}
+	selected := *result
+	selected.Path = s.path
+	selected.Value = value
+	return &selected, nil
+}
+
+// firstKeyed returns the index of the first element of a path which has keys, or -1 if none has.
+func firstKeyed(path *gpb.Path) int {
+	for i, elem := range path.GetElem() {
+		if len(elem.GetKey()) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Update returns a gNMI update setting the given OpenConfig leaf to a value produced by Orismologer.
+func Update(leaf string, value interface{}) (*gpb.Update, error) {
+	path, err := StringToPath(leaf)
+	if err != nil {
+		return nil, err
+	}
+	typedValue, err := TypedValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode value of %q: %v", leaf, err)
+	}
+	return &gpb.Update{Path: path, Val: typedValue}, nil
+}
+
+/*
+ResultUpdate is like Update, but also carries the tags added to the result by post-processors, as keys
+of the leaf's path element, eg: /system/state/hostname[site=lon]. gNMI updates have no other place for
+metadata, and collectors such as Telegraf turn path keys into tags.
+*/
+func ResultUpdate(result *orismologer.Result) (*gpb.Update, error) {
+	update, err := Update(result.Path, result.Value)
+	elems := update.GetPath().GetElem()
+	if err != nil || len(result.Tags) == 0 || len(elems) == 0 {
+		return update, err
+	}
+	leaf := elems[len(elems)-1]
+	if leaf.Key == nil {
+		leaf.Key = map[string]string{}
+	}
+	for key, value := range result.Tags {
+		leaf.Key[key] = value
+	}
+	return update, nil
+}
+
+/*
+TypedValue converts a value produced by Orismologer to a gNMI TypedValue. Whole numbers are
+encoded as integers, since Orismologer represents all numbers as floats during evaluation.
+*/
+func TypedValue(value interface{}) (*gpb.TypedValue, error) {
+	switch v := value.(type) {
+	case string:
+		return &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: v}}, nil
+	case bool:
+		return &gpb.TypedValue{Value: &gpb.TypedValue_BoolVal{BoolVal: v}}, nil
+	case int:
+		return &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: int64(v)}}, nil
+	case int64:
+		return &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: v}}, nil
+	case uint64:
+		return &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: v}}, nil
+	case []byte:
+		return &gpb.TypedValue{Value: &gpb.TypedValue_BytesVal{BytesVal: v}}, nil
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: int64(v)}}, nil
+		}
+		return &gpb.TypedValue{Value: &gpb.TypedValue_FloatVal{FloatVal: float32(v)}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// Float returns the value of a numeric TypedValue as a float64, or false if it is not numeric.
+func Float(value *gpb.TypedValue) (float64, bool) {
+	switch v := value.GetValue().(type) {
+	case *gpb.TypedValue_IntVal:
+		return float64(v.IntVal), true
+	case *gpb.TypedValue_UintVal:
+		return float64(v.UintVal), true
+	case *gpb.TypedValue_FloatVal:
+		return float64(v.FloatVal), true
+	case *gpb.TypedValue_DecimalVal:
+		return float64(v.DecimalVal.GetDigits()) / math.Pow10(int(v.DecimalVal.GetPrecision())), true
+	}
+	return 0, false
+}
+
+// Set is not supported: Orismologer only reads telemetry.
+func (s *Server) Set(ctx context.Context, req *gpb.SetRequest) (*gpb.SetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "Set is not supported")
+}
+
+// Subscribe is not yet supported.
+func (s *Server) Subscribe(stream gpb.GNMI_SubscribeServer) error {
+	return status.Error(codes.Unimplemented, "Subscribe is not supported")
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmiserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/google/orismologer/orismologer"
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// fakeEvaluator serves fixed values (or tagged results, or errors) for fixed leaves.
+type fakeEvaluator map[string]interface{}
+
+func (f fakeEvaluator) EvalResult(openConfigPath, target, vendor string) (*orismologer.Result, error) {
+	if vendor != "cisco" {
+		return nil, fmt.Errorf("unsupported vendor %q", vendor)
+	}
+	value, ok := f[openConfigPath]
+	if !ok {
+		return nil, fmt.Errorf("cannot evaluate %q", openConfigPath)
+	}
+	result := &orismologer.Result{Path: openConfigPath, Target: target, Vendor: vendor, Value: value}
+	switch v := value.(type) {
+	case error:
+		return nil, v
+	case *orismologer.Result:
+		result.Value, result.Tags = v.Value, v.Tags
+	}
+	return result, nil
+}
+
+func (f fakeEvaluator) Leaves(root string) ([]string, error) {
+	var leaves []string
+	for _, leaf := range []string{
+		"/components/component[name=name_value]/state/temperature",
+		"/interfaces/interface[name=name_value]/state/mtu",
+		"/interfaces/interface[name=name_value]/state/oper-status",
+		"/system/state/boot-time",
+		"/system/state/hostname",
+		"/system/state/broken",
+		"/system/state/dropped",
+	} {
+		if root == "/" || leaf == root || strings.HasPrefix(leaf, root+"/") {
+			leaves = append(leaves, leaf)
+		}
+	}
+	if len(leaves) == 0 {
+		return nil, fmt.Errorf("no such node %q", root)
+	}
+	return leaves, nil
+}
+
+func (f fakeEvaluator) Supported(openConfigPath, vendor string) (bool, error) {
+	_, ok := f[openConfigPath]
+	return ok && vendor == "cisco", nil
+}
+
+// KeyVariables maps the keys of interfaces, but not those of components.
+func (f fakeEvaluator) KeyVariables(openConfigPath string) (map[string]string, error) {
+	if strings.HasPrefix(openConfigPath, "/interfaces/") {
+		return map[string]string{"name_value": "interface_index"}, nil
+	}
+	return map[string]string{}, nil
+}
+
+func (f fakeEvaluator) Revisions(openConfigPath string) ([]string, error) {
+	if openConfigPath == "/system/state/boot-time" {
+		return []string{"0.4.1", "0.10.0"}, nil
+	}
+	return nil, nil
+}
+
+func makeServer() *Server {
+	s := NewServer(fakeEvaluator{
+		"/system/state/boot-time": 1545178344.0,
+		"/system/state/hostname":  &orismologer.Result{Value: "switch1", Tags: map[string]string{"site": "lon"}},
+		"/system/state/dropped":   orismologer.ErrDropped,
+		// Tables, keyed by interface index. Interface 2 has no oper-status.
+		"/interfaces/interface[name=name_value]/state/mtu":         map[string]interface{}{"1": 1500.0, "2": 9000.0},
+		"/interfaces/interface[name=name_value]/state/oper-status": map[string]interface{}{"1": "UP"},
+	}, &pb.Inventory{
+		Targets: []*pb.Target{
+			{Name: "switch1", Vendor: "cisco"},
+			{Name: "ap1", Vendor: "aruba"},
+		},
+	})
+	s.now = func() time.Time { return time.Unix(0, 42) }
+	return s
+}
+
+func mustPath(t *testing.T, s string) *gpb.Path {
+	path, err := StringToPath(s)
+	if err != nil {
+		t.Fatalf("StringToPath(%q) got error: %v", s, err)
+	}
+	return path
+}
+
+func TestGet(t *testing.T) {
+	s := makeServer()
+	req := &gpb.GetRequest{
+		Prefix: &gpb.Path{Target: "switch1", Elem: []*gpb.PathElem{{Name: "system"}}},
+		Path:   []*gpb.Path{mustPath(t, "/state/boot-time"), mustPath(t, "/state")},
+	}
+	got, err := s.Get(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Get() got error: %v", err)
+	}
+	prefix := &gpb.Path{Target: "switch1"}
+	expected := &gpb.GetResponse{
+		Notification: []*gpb.Notification{
+			{
+				Timestamp: 42,
+				Prefix:    prefix,
+				Update: []*gpb.Update{
+					{Path: mustPath(t, "/system/state/boot-time"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: 1545178344}}},
+				},
+			},
+			{
+				Timestamp: 42,
+				Prefix:    prefix,
+				Update: []*gpb.Update{
+					{Path: mustPath(t, "/system/state/boot-time"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: 1545178344}}},
+					// Tags are carried as keys, and the dropped leaf is skipped.
+					{Path: mustPath(t, "/system/state/hostname[site=lon]"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "switch1"}}},
+				},
+			},
+		},
+	}
+	if !proto.Equal(got, expected) {
+		t.Errorf("Get() = %v, expected %v", got, expected)
+	}
+}
+
+func TestGetIETF(t *testing.T) {
+	s := makeServer()
+	req := &gpb.GetRequest{
+		Prefix:   &gpb.Path{Target: "switch1"},
+		Path:     []*gpb.Path{mustPath(t, "/system/state")},
+		Encoding: gpb.Encoding_JSON_IETF,
+	}
+	got, err := s.Get(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Get() got error: %v", err)
+	}
+	expected := &gpb.GetResponse{
+		Notification: []*gpb.Notification{
+			{
+				Timestamp: 42,
+				Prefix:    &gpb.Path{Target: "switch1"},
+				Update: []*gpb.Update{
+					{
+						Path: mustPath(t, "/system/state"),
+						Val: &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{
+							JsonIetfVal: []byte(`{"openconfig-system:boot-time":"1545178344","openconfig-system:hostname":"switch1"}`),
+						}},
+					},
+				},
+			},
+		},
+	}
+	if !proto.Equal(got, expected) {
+		t.Errorf("Get() = %v, expected %v", got, expected)
+	}
+}
+
+func TestGetKeys(t *testing.T) {
+	s := makeServer()
+	for _, test := range []struct {
+		path     string
+		encoding gpb.Encoding
+		expected []*gpb.Update
+	}{
+		{
+			path: "/interfaces/interface[name=1]",
+			expected: []*gpb.Update{
+				{Path: mustPath(t, "/interfaces/interface[name=1]/state/mtu"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: 1500}}},
+				{Path: mustPath(t, "/interfaces/interface[name=1]/state/oper-status"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "UP"}}},
+			},
+		},
+		{
+			// Interface 2 has no oper-status, so only its mtu is returned.
+			path: "/interfaces/interface[name=2]/state",
+			expected: []*gpb.Update{
+				{Path: mustPath(t, "/interfaces/interface[name=2]/state/mtu"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: 9000}}},
+			},
+		},
+		{
+			path: "/interfaces/interface[name=2]/state/mtu",
+			expected: []*gpb.Update{
+				{Path: mustPath(t, "/interfaces/interface[name=2]/state/mtu"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: 9000}}},
+			},
+		},
+		{
+			path:     "/interfaces/interface[name=1]/state",
+			encoding: gpb.Encoding_JSON_IETF,
+			expected: []*gpb.Update{
+				{
+					Path: mustPath(t, "/interfaces/interface[name=1]/state"),
+					Val: &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{
+						JsonIetfVal: []byte(`{"openconfig-interfaces:mtu":"1500","openconfig-interfaces:oper-status":"UP"}`),
+					}},
+				},
+			},
+		},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			req := &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, test.path)}, Encoding: test.encoding}
+			got, err := s.Get(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Get() got error: %v", err)
+			}
+			expected := &gpb.GetResponse{
+				Notification: []*gpb.Notification{{Timestamp: 42, Prefix: &gpb.Path{Target: "switch1"}, Update: test.expected}},
+			}
+			if !proto.Equal(got, expected) {
+				t.Errorf("Get() = %v, expected %v", got, expected)
+			}
+		})
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	s := makeServer()
+	for _, test := range []struct {
+		name     string
+		req      *gpb.GetRequest
+		expected codes.Code
+	}{
+		{
+			name:     "no target",
+			req:      &gpb.GetRequest{Path: []*gpb.Path{mustPath(t, "/system")}},
+			expected: codes.InvalidArgument,
+		},
+		{
+			name:     "unknown target",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "unknown"}},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "unmapped path",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/network-instances")}},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "unmapped list selected by key",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/system/processes/process[pid=1]/state/name")}},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "list selected by a key it does not have",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/interfaces/interface[index=1]")}},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "list entry does not exist",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/interfaces/interface[name=3]")}},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "key not mapped to a NocPath variable",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/components/component[name=cpu0]/state/temperature")}},
+			expected: codes.Unimplemented,
+		},
+		{
+			name:     "leaf cannot be evaluated",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/system/state/broken")}},
+			expected: codes.Unavailable,
+		},
+		{
+			name:     "leaf dropped by post-processor",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "switch1"}, Path: []*gpb.Path{mustPath(t, "/system/state/dropped")}},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "nothing in subtree can be evaluated for vendor",
+			req:      &gpb.GetRequest{Prefix: &gpb.Path{Target: "ap1"}, Path: []*gpb.Path{mustPath(t, "/system")}},
+			expected: codes.NotFound,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.Get(context.Background(), test.req)
+			if got := status.Code(err); got != test.expected {
+				t.Errorf("Get() got code %v (%v), expected %v", got, err, test.expected)
+			}
+		})
+	}
+}
+
+func TestPathConversion(t *testing.T) {
+	for _, test := range []struct {
+		path          string
+		expectedElems int
+		expectedError bool
+	}{
+		{path: "/", expectedElems: 0},
+		{path: "/system/state/boot-time", expectedElems: 3},
+		{path: "/interfaces/interface[name=Ethernet1/1]/state", expectedElems: 3},
+		{path: "/a/b[k1=v1][k2=v2]/c", expectedElems: 3},
+		{path: "/a/b[k1=v1", expectedError: true},
+		{path: "/a/b[k1]/c", expectedError: true},
+		{path: "/a//b", expectedError: true},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			path, err := StringToPath(test.path)
+			switch {
+			case err != nil && !test.expectedError:
+				t.Fatalf("StringToPath(%q) got error: %v", test.path, err)
+			case err == nil && test.expectedError:
+				t.Fatalf("StringToPath(%q) = %v, expected error", test.path, path)
+			case err != nil:
+				return
+			}
+			if len(path.GetElem()) != test.expectedElems {
+				t.Errorf("StringToPath(%q) has %d elements, expected %d", test.path, len(path.GetElem()), test.expectedElems)
+			}
+			if got := PathToString(path); got != test.path {
+				t.Errorf("PathToString(StringToPath(%q)) = %q", test.path, got)
+			}
+		})
+	}
+}
+
+func TestFloat(t *testing.T) {
+	for _, test := range []struct {
+		value    *gpb.TypedValue
+		expected float64
+		ok       bool
+	}{
+		{value: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: -3}}, expected: -3, ok: true},
+		{value: &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: 3}}, expected: 3, ok: true},
+		{value: &gpb.TypedValue{Value: &gpb.TypedValue_FloatVal{FloatVal: 1.5}}, expected: 1.5, ok: true},
+		{value: &gpb.TypedValue{Value: &gpb.TypedValue_DecimalVal{DecimalVal: &gpb.Decimal64{Digits: 1234, Precision: 2}}}, expected: 12.34, ok: true},
+		{value: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "3"}}},
+	} {
+		if got, ok := Float(test.value); ok != test.ok || got != test.expected {
+			t.Errorf("Float(%v) = %v, %v, expected %v, %v", test.value, got, ok, test.expected, test.ok)
+		}
+	}
+}
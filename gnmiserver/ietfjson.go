@@ -0,0 +1,179 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmiserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+/*
+EncodeIETF encodes the given leaf values (keyed by OpenConfig path) as the RFC 7951 (JSON_IETF)
+encoding of the node at root, as a native device would return it. Leaves must lie beneath root.
+
+List entries are JSON arrays of objects including their key leaves, and the members of the top-level
+object are qualified with the name of the model defining them, eg: "openconfig-system:state". Only
+top-level members are qualified, since Orismologer does not know which leaves are augmentations.
+
+Orismologer evaluates all numbers as floats and does not know the YANG type of a leaf, so numbers
+are encoded as strings, as RFC 7951 requires for 64-bit integers and decimal64 (which most OpenConfig
+state counters are). Values of Go's narrower integer types are encoded as JSON numbers.
+*/
+func EncodeIETF(root string, values map[string]interface{}) ([]byte, error) {
+	rootPath, err := StringToPath(root)
+	if err != nil {
+		return nil, err
+	}
+	rootElems := rootPath.GetElem()
+	if value, ok := values[root]; ok && len(values) == 1 && len(rootElems) > 0 {
+		// A leaf is encoded as its bare value.
+		encoded, err := ietfValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode value of %q: %v", root, err)
+		}
+		return json.Marshal(encoded)
+	}
+	// Leaves are inserted beneath a parent object containing the root node, which is then unwrapped.
+	start := len(rootElems) - 1
+	if start < 0 {
+		start = 0
+	}
+	parent := map[string]interface{}{}
+	entries := map[string]map[string]interface{}{} // Path of list entry -> entry.
+	leaves := make([]string, 0, len(values))
+	for leaf := range values {
+		leaves = append(leaves, leaf)
+	}
+	sort.Strings(leaves)
+	for _, leaf := range leaves {
+		path, err := StringToPath(leaf)
+		if err != nil {
+			return nil, err
+		}
+		elems := path.GetElem()
+		if !hasPrefix(elems, rootElems) || len(elems) == len(rootElems) {
+			return nil, fmt.Errorf("leaf %q is not beneath %q", leaf, root)
+		}
+		encoded, err := ietfValue(values[leaf])
+		if err != nil {
+			return nil, fmt.Errorf("could not encode value of %q: %v", leaf, err)
+		}
+		object := parent
+		for i := start; i < len(elems); i++ {
+			elem := elems[i]
+			name := ietfName(elems, elem.GetName(), i == len(rootElems))
+			if i == len(elems)-1 {
+				object[name] = encoded
+				break
+			}
+			if len(elem.GetKey()) == 0 {
+				child, ok := object[name].(map[string]interface{})
+				if !ok {
+					child = map[string]interface{}{}
+					object[name] = child
+				}
+				object = child
+				continue
+			}
+			entryPath := PathToString(&gpb.Path{Elem: elems[:i+1]})
+			entry, ok := entries[entryPath]
+			if !ok {
+				entry = map[string]interface{}{}
+				for k, v := range elem.GetKey() {
+					entry[ietfName(elems, k, i+1 == len(rootElems))] = v
+				}
+				entries[entryPath] = entry
+				list, _ := object[name].([]interface{})
+				object[name] = append(list, entry)
+			}
+			object = entry
+		}
+	}
+	if len(rootElems) == 0 {
+		return json.Marshal(parent)
+	}
+	var value interface{}
+	for _, v := range parent {
+		value = v
+	}
+	if list, ok := value.([]interface{}); ok && len(rootElems[len(rootElems)-1].GetKey()) > 0 {
+		// The root names a single list entry.
+		value = list[0]
+	}
+	return json.Marshal(value)
+}
+
+// hasPrefix reports whether the elements of a path start with the given elements (with equal keys).
+func hasPrefix(elems, prefix []*gpb.PathElem) bool {
+	if len(elems) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if elems[i].GetName() != p.GetName() {
+			return false
+		}
+		for k, v := range p.GetKey() {
+			if elems[i].GetKey()[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/*
+ietfName returns the member name for a node of the path with the given elements, qualified with the
+name of the model which defines the path (eg: openconfig-system:state) if qualified is true.
+*/
+func ietfName(elems []*gpb.PathElem, name string, qualified bool) string {
+	if !qualified {
+		return name
+	}
+	return modelName(elems[0].GetName()) + ":" + name
+}
+
+// ietfValue converts a value produced by Orismologer to its RFC 7951 JSON representation.
+func ietfValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, bool, int8, int16, int32, uint8, uint16, uint32:
+		return v, nil
+	case int:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return strconv.Itoa(v), nil
+		}
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%v cannot be represented", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
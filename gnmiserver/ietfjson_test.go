@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmiserver
+
+import (
+	"testing"
+)
+
+func TestEncodeIETF(t *testing.T) {
+	interfaces := map[string]interface{}{
+		"/interfaces/interface[name=eth0]/state/counters/in-octets": 42.0,
+		"/interfaces/interface[name=eth0]/state/mtu":                uint16(1500),
+		"/interfaces/interface[name=eth1]/state/counters/in-octets": 7.0,
+	}
+	for _, test := range []struct {
+		name          string
+		root          string
+		values        map[string]interface{}
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "leaf",
+			root:     "/system/state/boot-time",
+			values:   map[string]interface{}{"/system/state/boot-time": 1545178344.0},
+			expected: `"1545178344"`,
+		},
+		{
+			name: "root",
+			root: "/",
+			values: map[string]interface{}{
+				"/system/state/boot-time":                                    1545178344.0,
+				"/system/state/hostname":                                     "switch1",
+				"/components/component[name=cpu0]/state/temperature/instant": 45.5,
+			},
+			expected: `{"openconfig-platform:components":{"component":[{"name":"cpu0","state":{"temperature":{"instant":"45.5"}}}]},` +
+				`"openconfig-system:system":{"state":{"boot-time":"1545178344","hostname":"switch1"}}}`,
+		},
+		{
+			name:     "container",
+			root:     "/system",
+			values:   map[string]interface{}{"/system/state/hostname": "switch1", "/system/state/up": true},
+			expected: `{"openconfig-system:state":{"hostname":"switch1","up":true}}`,
+		},
+		{
+			name:   "list",
+			root:   "/interfaces",
+			values: interfaces,
+			expected: `{"openconfig-interfaces:interface":[` +
+				`{"name":"eth0","state":{"counters":{"in-octets":"42"},"mtu":1500}},` +
+				`{"name":"eth1","state":{"counters":{"in-octets":"7"}}}]}`,
+		},
+		{
+			name:   "list without keys",
+			root:   "/interfaces/interface",
+			values: interfaces,
+			expected: `[{"openconfig-interfaces:name":"eth0","openconfig-interfaces:state":{"counters":{"in-octets":"42"},"mtu":1500}},` +
+				`{"openconfig-interfaces:name":"eth1","openconfig-interfaces:state":{"counters":{"in-octets":"7"}}}]`,
+		},
+		{
+			name: "list entry",
+			root: "/interfaces/interface[name=eth0]",
+			values: map[string]interface{}{
+				"/interfaces/interface[name=eth0]/state/counters/in-octets": 42.0,
+				"/interfaces/interface[name=eth0]/name":                     "eth0",
+			},
+			expected: `{"openconfig-interfaces:name":"eth0","openconfig-interfaces:state":{"counters":{"in-octets":"42"}}}`,
+		},
+		{
+			name:          "leaf outside root",
+			root:          "/system",
+			values:        map[string]interface{}{"/interfaces/interface[name=eth0]/state/mtu": 1500.0},
+			expectedError: true,
+		},
+		{
+			name:          "unsupported value",
+			root:          "/system",
+			values:        map[string]interface{}{"/system/state/boot-time": []string{"a"}},
+			expectedError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := EncodeIETF(test.root, test.values)
+			switch {
+			case err != nil && !test.expectedError:
+				t.Fatalf("EncodeIETF(%q) got error: %v", test.root, err)
+			case err == nil && test.expectedError:
+				t.Fatalf("EncodeIETF(%q) = %s, expected error", test.root, got)
+			case err == nil && string(got) != test.expected:
+				t.Errorf("EncodeIETF(%q) = %s, expected %s", test.root, got, test.expected)
+			}
+		})
+	}
+}
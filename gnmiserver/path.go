@@ -0,0 +1,112 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmiserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+/*
+PathToString converts a gNMI path to the string form used by Orismologer's OpenConfig tree, eg:
+/components/component[name=cpu0]/state. Keys are written in sorted order.
+*/
+func PathToString(path *gpb.Path) string {
+	var b strings.Builder
+	for _, elem := range path.GetElem() {
+		b.WriteString("/")
+		b.WriteString(elem.GetName())
+		keys := make([]string, 0, len(elem.GetKey()))
+		for k := range elem.GetKey() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "[%v=%v]", k, elem.GetKey()[k])
+		}
+	}
+	// Support the deprecated string elements used by older clients.
+	for _, element := range path.GetElement() {
+		b.WriteString("/")
+		b.WriteString(element)
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+/*
+StringToPath converts an OpenConfig path string (eg: /components/component[name=cpu0]/state) to a
+gNMI path. Key values may contain slashes, eg: /interfaces/interface[name=Ethernet1/1].
+*/
+func StringToPath(s string) (*gpb.Path, error) {
+	path := &gpb.Path{}
+	s = strings.TrimPrefix(s, "/")
+	for len(s) > 0 {
+		elem := &gpb.PathElem{}
+		end := strings.IndexAny(s, "/[")
+		if end < 0 {
+			end = len(s)
+		}
+		elem.Name = s[:end]
+		if elem.Name == "" {
+			return nil, fmt.Errorf("empty element in path %q", s)
+		}
+		s = s[end:]
+		for strings.HasPrefix(s, "[") {
+			closing := strings.Index(s, "]")
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated key in element %q", elem.Name)
+			}
+			kv := strings.SplitN(s[1:closing], "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid key %q in element %q", s[1:closing], elem.Name)
+			}
+			if elem.Key == nil {
+				elem.Key = map[string]string{}
+			}
+			elem.Key[kv[0]] = kv[1]
+			s = s[closing+1:]
+		}
+		path.Elem = append(path.Elem, elem)
+		if s != "" && !strings.HasPrefix(s, "/") {
+			return nil, fmt.Errorf("unexpected %q after element %q", s, elem.Name)
+		}
+		s = strings.TrimPrefix(s, "/")
+	}
+	return path, nil
+}
+
+// joinPaths returns a path with the elements of prefix followed by those of path.
+func joinPaths(prefix, path *gpb.Path) *gpb.Path {
+	joined := &gpb.Path{
+		Origin: path.GetOrigin(),
+		Target: prefix.GetTarget(),
+	}
+	if joined.Origin == "" {
+		joined.Origin = prefix.GetOrigin()
+	}
+	joined.Elem = append(joined.Elem, prefix.GetElem()...)
+	joined.Elem = append(joined.Elem, path.GetElem()...)
+	joined.Element = append(joined.Element, prefix.GetElement()...)
+	joined.Element = append(joined.Element, path.GetElement()...)
+	return joined
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package health periodically checks that the targets in an inventory are reachable, eg: by fetching
+sysUpTime over SNMP or reading an SSH server's banner. It tracks each target's state and probe
+latency, reports state changes as events, serves statuses as JSON and Prometheus metrics, and tells
+pollers (see collector.Scheduler) how far to back off from unhealthy targets.
+*/
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// State is the health of a target.
+type State int
+
+const (
+	// Unknown is the state of a target which has not been checked yet.
+	Unknown State = iota
+	Healthy
+	Unhealthy
+)
+
+func (s State) String() string {
+	switch s {
+	case Unknown:
+		return "unknown"
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, so that states are written to JSON by name.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Status is the result of the checks of a target so far.
+type Status struct {
+	Target string `json:"target"`
+	State  State  `json:"state"`
+	// LastCheck is when the target was last checked.
+	LastCheck time.Time `json:"last_check"`
+	// Latency is how long the last successful check took.
+	Latency time.Duration `json:"latency_ns"`
+	// Failures is the number of consecutive failed checks.
+	Failures int `json:"failures"`
+	// Error is the error of the last failed check, if the last check failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Event reports that a target's state changed.
+type Event struct {
+	From, To State
+	Status   Status
+}
+
+// Prober checks whether a target is reachable.
+type Prober interface {
+	Probe(ctx context.Context, target *pb.Target) error
+}
+
+// ProberFunc adapts a function to a Prober.
+type ProberFunc func(ctx context.Context, target *pb.Target) error
+
+// Probe implements Prober.
+func (f ProberFunc) Probe(ctx context.Context, target *pb.Target) error {
+	return f(ctx, target)
+}
+
+const (
+	defaultFailureThreshold = 3
+	defaultMaxBackoff       = 16
+)
+
+/*
+Checker checks each target in Inventory with every one of Probers once per Interval. A check
+succeeds if every probe does, within Timeout. A target becomes healthy on its first successful check,
+and unhealthy after FailureThreshold consecutive failed checks.
+*/
+type Checker struct {
+	Inventory *pb.Inventory
+	Probers   []Prober
+	Interval  time.Duration
+
+	// Timeout bounds each check. Defaults to Interval.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed checks after which a target is unhealthy.
+	// Defaults to 3.
+	FailureThreshold int
+
+	// MaxBackoff caps the factor returned by Backoff. Defaults to 16.
+	MaxBackoff int
+
+	// OnChange, if set, is called with each change of a target's state. Calls are serialized, and are
+	// made without holding the Checker's lock, so they may call its methods (eg: Statuses).
+	OnChange func(Event)
+
+	mu       sync.Mutex
+	statuses map[string]*Status
+	now      func() time.Time
+	notifyMu sync.Mutex // Serializes calls of OnChange.
+}
+
+var (
+	_ http.Handler         = (*Checker)(nil)
+	_ prometheus.Collector = (*Checker)(nil)
+)
+
+func (c *Checker) validate() error {
+	switch {
+	case len(c.Probers) == 0:
+		return fmt.Errorf("a health checker needs at least one prober")
+	case c.Interval <= 0:
+		return fmt.Errorf("interval must be positive, got %v", c.Interval)
+	case c.Timeout < 0 || c.FailureThreshold < 0 || c.MaxBackoff < 0:
+		return fmt.Errorf("timeout, failure threshold and maximum backoff must not be negative")
+	}
+	return nil
+}
+
+// Run checks every target once per interval until the context is cancelled, then returns its error.
+func (c *Checker) Run(ctx context.Context) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks every target once, concurrently, and returns when all checks are done.
+func (c *Checker) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range c.Inventory.GetTargets() {
+		wg.Add(1)
+		go func(target *pb.Target) {
+			defer wg.Done()
+			c.check(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) check(ctx context.Context, target *pb.Target) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = c.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := c.time()
+	var err error
+	for _, prober := range c.Probers {
+		if err = prober.Probe(ctx, target); err != nil {
+			break
+		}
+	}
+	c.record(target.GetName(), start, c.time().Sub(start), err)
+}
+
+func (c *Checker) time() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Checker) failureThreshold() int {
+	if c.FailureThreshold == 0 {
+		return defaultFailureThreshold
+	}
+	return c.FailureThreshold
+}
+
+// record updates a target's status with the result of a check, notifying OnChange of any change.
+func (c *Checker) record(target string, at time.Time, latency time.Duration, err error) {
+	event, changed := c.update(target, at, latency, err)
+	if !changed {
+		return
+	}
+	glog.Infof("target %q is %v (was %v): %v", target, event.To, event.From, event.Status.Error)
+	if c.OnChange != nil {
+		c.notifyMu.Lock()
+		defer c.notifyMu.Unlock()
+		c.OnChange(event)
+	}
+}
+
+// update updates a target's status, returning the event of the change of its state, if any.
+func (c *Checker) update(target string, at time.Time, latency time.Duration, err error) (Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.statuses == nil {
+		c.statuses = map[string]*Status{}
+	}
+	status, ok := c.statuses[target]
+	if !ok {
+		status = &Status{Target: target}
+		c.statuses[target] = status
+	}
+	from := status.State
+	status.LastCheck = at
+	if err == nil {
+		status.State, status.Latency, status.Failures, status.Error = Healthy, latency, 0, ""
+	} else {
+		status.Failures++
+		status.Error = err.Error()
+		if status.Failures >= c.failureThreshold() {
+			status.State = Unhealthy
+		}
+	}
+	if status.State == from {
+		return Event{}, false
+	}
+	return Event{From: from, To: status.State, Status: *status}, true
+}
+
+// Status returns the status of a target, or false if it has not been checked.
+func (c *Checker) Status(target string) (Status, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.statuses[target]
+	if !ok {
+		return Status{Target: target}, false
+	}
+	return *status, true
+}
+
+// Statuses returns the statuses of all targets checked so far, sorted by target.
+func (c *Checker) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	statuses := make([]Status, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Target < statuses[j].Target })
+	return statuses
+}
+
+/*
+Backoff returns the factor by which to stretch a target's polling interval: 1 unless the target is
+unhealthy, and otherwise doubling with each further failed check, up to MaxBackoff.
+*/
+func (c *Checker) Backoff(target string) int {
+	status, _ := c.Status(target)
+	if status.State != Unhealthy {
+		return 1
+	}
+	max := c.MaxBackoff
+	if max == 0 {
+		max = defaultMaxBackoff
+	}
+	factor := 2
+	for i := c.failureThreshold(); i < status.Failures && factor < max; i++ {
+		factor *= 2
+	}
+	if factor > max {
+		return max
+	}
+	return factor
+}
+
+// ServeHTTP serves the statuses of all targets as a JSON object: {"targets": [<Status>...]}.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Targets []Status `json:"targets"`
+	}{c.Statuses()}); err != nil {
+		glog.Warningf("could not write health statuses: %v", err)
+	}
+}
+
+var (
+	upDesc = prometheus.NewDesc("orismologer_target_up",
+		"Whether the target is healthy (1) or unhealthy (0).", []string{"target"}, nil)
+	latencyDesc = prometheus.NewDesc("orismologer_target_probe_latency_seconds",
+		"How long the target's last successful health check took.", []string{"target"}, nil)
+	failuresDesc = prometheus.NewDesc("orismologer_target_probe_failures",
+		"The number of consecutive failed health checks of the target.", []string{"target"}, nil)
+)
+
+// Describe implements prometheus.Collector.
+func (c *Checker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
+	ch <- latencyDesc
+	ch <- failuresDesc
+}
+
+// Collect implements prometheus.Collector. Targets in the unknown state are omitted.
+func (c *Checker) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range c.Statuses() {
+		if status.State == Unknown {
+			continue
+		}
+		up := 0.0
+		if status.State == Healthy {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up, status.Target)
+		ch <- prometheus.MustNewConstMetric(latencyDesc, prometheus.GaugeValue, status.Latency.Seconds(), status.Target)
+		ch <- prometheus.MustNewConstMetric(failuresDesc, prometheus.GaugeValue, float64(status.Failures), status.Target)
+	}
+}
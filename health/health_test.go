@@ -0,0 +1,195 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// reachable is a Prober which succeeds for the targets it is set to true for.
+type reachable struct {
+	mu      sync.Mutex
+	targets map[string]bool
+}
+
+func (r *reachable) set(target string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targets[target] = ok
+}
+
+func (r *reachable) Probe(ctx context.Context, target *pb.Target) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.targets[target.GetName()] {
+		return fmt.Errorf("%v is unreachable", target.GetName())
+	}
+	return nil
+}
+
+func TestChecker(t *testing.T) {
+	probe := &reachable{targets: map[string]bool{"switch1": true}}
+	var events []string
+	c := &Checker{
+		Inventory:        &pb.Inventory{Targets: []*pb.Target{{Name: "switch1"}, {Name: "switch2"}}},
+		Probers:          []Prober{probe},
+		Interval:         time.Minute,
+		FailureThreshold: 2,
+		MaxBackoff:       4,
+		OnChange: func(e Event) {
+			events = append(events, fmt.Sprintf("%v: %v -> %v", e.Status.Target, e.From, e.To))
+		},
+	}
+	check := func() {
+		c.Check(context.Background())
+	}
+
+	check()
+	if status, _ := c.Status("switch2"); status.State != Unknown || status.Failures != 1 {
+		t.Errorf("Status() after one failure = %+v, expected unknown with 1 failure", status)
+	}
+	check()
+	check()
+	check()
+	if status, _ := c.Status("switch2"); status.State != Unhealthy || status.Error == "" {
+		t.Errorf("Status() after repeated failures = %+v, expected unhealthy with an error", status)
+	}
+	if got := c.Backoff("switch1"); got != 1 {
+		t.Errorf("Backoff() of healthy target = %d, expected 1", got)
+	}
+	check()
+	if got := c.Backoff("switch2"); got != 4 {
+		t.Errorf("Backoff() of unhealthy target = %d, expected the maximum of 4", got)
+	}
+	if _, ok := c.Status("unknown"); ok {
+		t.Errorf("Status() of target never checked returned ok")
+	}
+
+	probe.set("switch2", true)
+	check()
+	if got := c.Backoff("switch2"); got != 1 {
+		t.Errorf("Backoff() of recovered target = %d, expected 1", got)
+	}
+	expected := []string{
+		"switch1: unknown -> healthy",
+		"switch2: unknown -> unhealthy",
+		"switch2: unhealthy -> healthy",
+	}
+	if !cmp.Equal(events, expected) {
+		t.Errorf("OnChange() got events %v, expected %v", events, expected)
+	}
+}
+
+func TestOnChangeMayCallChecker(t *testing.T) {
+	var c *Checker
+	var states []State
+	c = &Checker{
+		Inventory: &pb.Inventory{Targets: []*pb.Target{{Name: "switch1"}}},
+		Probers:   []Prober{&reachable{targets: map[string]bool{"switch1": true}}},
+		Interval:  time.Minute,
+		OnChange: func(e Event) {
+			// The new status is visible to the callback.
+			status, _ := c.Status(e.Status.Target)
+			states = append(states, status.State)
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Check(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Check() deadlocked calling OnChange()")
+	}
+	if expected := []State{Healthy}; !cmp.Equal(states, expected) {
+		t.Errorf("OnChange() saw states %v, expected %v", states, expected)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Checker{FailureThreshold: 1, MaxBackoff: 16}
+	for failures, expected := range []int{1, 2, 4, 8, 16, 16} {
+		c.statuses = map[string]*Status{"t": {State: Unhealthy, Failures: failures}}
+		if failures == 0 {
+			c.statuses["t"].State = Healthy
+		}
+		if got := c.Backoff("t"); got != expected {
+			t.Errorf("Backoff() after %d failures = %d, expected %d", failures, got, expected)
+		}
+	}
+}
+
+func TestCheckerOutputs(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := &Checker{
+		Inventory: &pb.Inventory{Targets: []*pb.Target{{Name: "switch1"}, {Name: "switch2"}}},
+		Probers:   []Prober{&reachable{targets: map[string]bool{"switch1": true}}},
+		Interval:  time.Minute,
+		now:       func() time.Time { return now },
+	}
+	c.Check(context.Background())
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/health", nil))
+	var got struct {
+		Targets []struct {
+			Target string
+			State  string
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("ServeHTTP() wrote invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if len(got.Targets) != 2 || got.Targets[0].State != "healthy" || got.Targets[1].State != "unknown" {
+		t.Errorf("ServeHTTP() wrote %s, expected switch1 healthy and switch2 unknown", rec.Body.String())
+	}
+
+	expected := `
+# HELP orismologer_target_up Whether the target is healthy (1) or unhealthy (0).
+# TYPE orismologer_target_up gauge
+orismologer_target_up{target="switch1"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "orismologer_target_up"); err != nil {
+		t.Errorf("Collect() got unexpected metrics: %v", err)
+	}
+}
+
+func TestRunValidation(t *testing.T) {
+	for _, c := range []*Checker{
+		{Interval: time.Second},
+		{Probers: []Prober{&SSHProber{}}},
+		{Probers: []Prober{&SSHProber{}}, Interval: time.Second, Timeout: -1},
+	} {
+		if err := c.Run(context.Background()); err == nil {
+			t.Errorf("Run() of %+v expected error, got none", c)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+const (
+	// sysUpTime is SNMPv2-MIB::sysUpTime.0, which every SNMP agent serves.
+	sysUpTime = "1.3.6.1.2.1.1.3.0"
+
+	// CommunityCredential is the key of a target's credentials holding its SNMP community.
+	CommunityCredential = "community"
+	defaultCommunity    = "public"
+)
+
+/*
+SNMPProber checks that a target's SNMP agent answers a get of sysUpTime. The target's address may
+omit the port, which defaults to 161. Its community is taken from its credentials (see
+CommunityCredential), and defaults to "public".
+*/
+type SNMPProber struct {
+	// Retries is the number of times a request is retried before the probe fails.
+	Retries int
+}
+
+// Probe implements Prober.
+func (p *SNMPProber) Probe(ctx context.Context, target *pb.Target) error {
+	host, port, err := hostPort(target.GetAddress(), 161)
+	if err != nil {
+		return err
+	}
+	community := target.GetCredentials()[CommunityCredential]
+	if community == "" {
+		community = defaultCommunity
+	}
+	timeout := gosnmp.Default.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline) / time.Duration(p.Retries+1)
+	}
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(port),
+		Community: community,
+		Version:   gosnmp.Version2c,
+		Timeout:   timeout,
+		Retries:   p.Retries,
+		Context:   ctx,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("could not connect to %v: %v", target.GetAddress(), err)
+	}
+	defer client.Conn.Close()
+	packet, err := client.Get([]string{sysUpTime})
+	if err != nil {
+		return fmt.Errorf("could not get sysUpTime from %v: %v", target.GetAddress(), err)
+	}
+	if packet.Error != gosnmp.NoError {
+		return fmt.Errorf("could not get sysUpTime from %v: %v", target.GetAddress(), packet.Error)
+	}
+	if len(packet.Variables) != 1 || packet.Variables[0].Type != gosnmp.TimeTicks {
+		return fmt.Errorf("unexpected response to a get of sysUpTime from %v: %v", target.GetAddress(), packet.Variables)
+	}
+	return nil
+}
+
+/*
+SSHProber checks that a target accepts TCP connections on its SSH port and sends an SSH
+identification string (RFC 4253 section 4.2). It does not authenticate.
+*/
+type SSHProber struct {
+	// Port is the SSH port. Defaults to 22.
+	Port int
+}
+
+// Probe implements Prober.
+func (p *SSHProber) Probe(ctx context.Context, target *pb.Target) error {
+	host, _, err := hostPort(target.GetAddress(), 0)
+	if err != nil {
+		return err
+	}
+	port := p.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not connect to %v: %v", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	// Servers may send other lines before the identification string.
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "SSH-") {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read SSH identification from %v: %v", addr, err)
+	}
+	return fmt.Errorf("%v closed the connection without identifying as an SSH server", addr)
+}
+
+// hostPort splits an address into a host and port, using the given default if it has no port.
+func hostPort(address string, defaultPort int) (string, int, error) {
+	if address == "" {
+		return "", 0, fmt.Errorf("target has no address")
+	}
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		// The address has no port (or is a bare IPv6 address).
+		return strings.Trim(address, "[]"), defaultPort, nil
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in address %q: %v", address, err)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// serveBanner accepts TCP connections, writes a banner to each and closes it.
+func serveBanner(t *testing.T, banner string) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestSSHProber(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	for _, test := range []struct {
+		name         string
+		port         int
+		expectsError bool
+	}{
+		{
+			name: "identifies as SSH",
+			port: serveBanner(t, "Welcome\r\nSSH-2.0-OpenSSH_8.0\r\n"),
+		},
+		{
+			name:         "not SSH",
+			port:         serveBanner(t, "220 smtp.example.com ESMTP\r\n"),
+			expectsError: true,
+		},
+		{
+			name:         "connection refused",
+			port:         closedPort,
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := (&SSHProber{Port: test.port}).Probe(ctx, &pb.Target{Address: "127.0.0.1:161"})
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Probe() got error: %v", err)
+			case err == nil && test.expectsError:
+				t.Errorf("Probe() expected error, got none")
+			}
+		})
+	}
+}
+
+func TestSNMPProberUnreachable(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	defer conn.Close() // Receives requests, but never answers.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	target := &pb.Target{Address: conn.LocalAddr().String(), Credentials: map[string]string{CommunityCredential: "c"}}
+	if err := (&SNMPProber{}).Probe(ctx, target); err == nil {
+		t.Errorf("Probe() of silent agent expected error, got none")
+	}
+	if err := (&SNMPProber{}).Probe(ctx, &pb.Target{}); err == nil {
+		t.Errorf("Probe() of target without address expected error, got none")
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	for _, test := range []struct {
+		address      string
+		host         string
+		port         int
+		expectsError bool
+	}{
+		{address: "switch1", host: "switch1", port: 161},
+		{address: "switch1:1161", host: "switch1", port: 1161},
+		{address: "[::1]:1161", host: "::1", port: 1161},
+		{address: "::1", host: "::1", port: 161},
+		{address: "switch1:snmp", expectsError: true},
+		{address: "", expectsError: true},
+	} {
+		host, port, err := hostPort(test.address, 161)
+		switch {
+		case err != nil && !test.expectsError:
+			t.Errorf("hostPort(%q) got error: %v", test.address, err)
+		case err == nil && test.expectsError:
+			t.Errorf("hostPort(%q) = %v, %v, expected error", test.address, host, port)
+		case err == nil && (host != test.host || port != test.port):
+			t.Errorf("hostPort(%q) = %v, %v, expected %v, %v", test.address, host, port, test.host, test.port)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package httpapi serves Orismologer over HTTP with JSON responses, for teams which would rather
+integrate via plain HTTP than gRPC or gNMI. Endpoints:
+
+	GET  /v1/get?path=<path>&target=<target>&vendor=<vendor>  {"path": ..., "value": ...}
+	GET  /v1/list?root=<path>                                {"leaves": [...]}
+	GET  /v1/coverage?root=<path>&vendor=<vendor>            {"supported": [...], "unsupported": [...]}
+	GET  /v1/stats?target=<target>&leaf=<path>&failing=true  {"stats": [...]}
+	POST /v1/validate                                        {"ok": ..., "findings": [...]}
+
+Every GET endpoint accepts an optional namespace parameter (see orismologer.Namespaces). Passing
+trace=true to /v1/get adds a "trace" member describing each step of the evaluation (see
+orismologer.Trace), and reports evaluation errors in the trace rather than as an error response. The stats
+endpoint lists the statistics of each (target, leaf) pair evaluated (see orismologer.LeafStats),
+optionally only those of a target or leaf, or those whose last evaluation failed. The validate
+endpoint takes a JSON object with "mappings" and "transformations" members, each holding the JSON
+form of the corresponding proto. Errors are returned as {"error": <message>}.
+*/
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/lint"
+	"github.com/google/orismologer/orismologer"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// maxBodySize limits the size of request bodies.
+const maxBodySize = 16 << 20
+
+/*
+AuthFunc authenticates a request, returning an error if it should be rejected. It is a hook for
+integrating with an organization's authentication scheme (eg: validating an OAuth token).
+*/
+type AuthFunc func(r *http.Request) error
+
+// BearerToken returns an AuthFunc accepting requests with an "Authorization: Bearer <token>" header.
+func BearerToken(token string) AuthFunc {
+	return func(r *http.Request) error {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return fmt.Errorf("invalid bearer token")
+		}
+		return nil
+	}
+}
+
+// Server is an http.Handler serving the Orismologer HTTP API.
+type Server struct {
+	namespaces *orismologer.Namespaces
+	auth       AuthFunc
+	functions  lint.FunctionSet
+	mux        *http.ServeMux
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// NewServer returns a server for the given namespaces. If auth is nil, requests are not authenticated.
+func NewServer(namespaces *orismologer.Namespaces, auth AuthFunc) *Server {
+	s := &Server{
+		namespaces: namespaces,
+		auth:       auth,
+		functions:  orismologer.Functions(),
+		mux:        http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/v1/get", s.method(http.MethodGet, s.get))
+	s.mux.HandleFunc("/v1/list", s.method(http.MethodGet, s.list))
+	s.mux.HandleFunc("/v1/coverage", s.method(http.MethodGet, s.coverage))
+	s.mux.HandleFunc("/v1/stats", s.method(http.MethodGet, s.stats))
+	s.mux.HandleFunc("/v1/validate", s.method(http.MethodPost, s.validate))
+	return s
+}
+
+/*
+Handle serves additional endpoints (eg: /v1/health, see health.Checker) alongside the API. Requests
+to them are authenticated like any other.
+*/
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.auth != nil {
+		if err := s.auth(r); err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// handler handles a request, returning the response to encode as JSON or an error.
+type handler func(r *http.Request) (interface{}, error)
+
+// statusError is an error with an HTTP status code.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e statusError) Error() string {
+	return e.err.Error()
+}
+
+func errorf(code int, format string, a ...interface{}) error {
+	return statusError{code: code, err: fmt.Errorf(format, a...)}
+}
+
+func (s *Server) method(method string, h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		resp, err := h(r)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if e, ok := err.(statusError); ok {
+				code = e.code
+			}
+			writeError(w, code, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		glog.Warningf("could not write response: %v", err)
+	}
+}
+
+func (s *Server) namespace(r *http.Request) (*orismologer.Orismologer, error) {
+	o, err := s.namespaces.Get(r.FormValue("namespace"))
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "%v", err)
+	}
+	return o, nil
+}
+
+func required(r *http.Request, names ...string) error {
+	for _, name := range names {
+		if r.FormValue(name) == "" {
+			return errorf(http.StatusBadRequest, "missing parameter %q", name)
+		}
+	}
+	return nil
+}
+
+type getResponse struct {
+	Path  string             `json:"path"`
+	Value interface{}        `json:"value"`
+	Tags  map[string]string  `json:"tags,omitempty"` // Added by post-processors (see orismologer.PostProcessor).
+	Trace *orismologer.Trace `json:"trace,omitempty"`
+}
+
+func (s *Server) get(r *http.Request) (interface{}, error) {
+	if err := required(r, "path", "target", "vendor"); err != nil {
+		return nil, err
+	}
+	o, err := s.namespace(r)
+	if err != nil {
+		return nil, err
+	}
+	path := r.FormValue("path")
+	if r.FormValue("trace") == "true" {
+		// The trace describes any failure, so the response is successful regardless.
+		value, trace, _ := o.EvalWithTrace(path, r.FormValue("target"), r.FormValue("vendor"))
+		return getResponse{Path: path, Value: value, Trace: trace}, nil
+	}
+	result, err := o.EvalResult(path, r.FormValue("target"), r.FormValue("vendor"))
+	if err == orismologer.ErrDropped {
+		return nil, errorf(http.StatusNotFound, "%q is not available: %v", path, err)
+	}
+	if err != nil {
+		return nil, errorf(http.StatusBadGateway, "could not evaluate %q: %v", path, err)
+	}
+	return getResponse{Path: path, Value: result.Value, Tags: result.Tags}, nil
+}
+
+type listResponse struct {
+	Leaves []string `json:"leaves"`
+}
+
+func (s *Server) list(r *http.Request) (interface{}, error) {
+	o, err := s.namespace(r)
+	if err != nil {
+		return nil, err
+	}
+	root := r.FormValue("root")
+	if root == "" {
+		root = "/"
+	}
+	leaves, err := o.Leaves(root)
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "path %q is not mapped: %v", root, err)
+	}
+	return listResponse{Leaves: leaves}, nil
+}
+
+type coverageResponse struct {
+	Supported   []string `json:"supported"`
+	Unsupported []string `json:"unsupported"`
+}
+
+func (s *Server) coverage(r *http.Request) (interface{}, error) {
+	if err := required(r, "vendor"); err != nil {
+		return nil, err
+	}
+	o, err := s.namespace(r)
+	if err != nil {
+		return nil, err
+	}
+	root := r.FormValue("root")
+	if root == "" {
+		root = "/"
+	}
+	supported, unsupported, err := o.Coverage(root, r.FormValue("vendor"))
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "path %q is not mapped: %v", root, err)
+	}
+	return coverageResponse{Supported: supported, Unsupported: unsupported}, nil
+}
+
+type statsResponse struct {
+	Stats []orismologer.LeafStats `json:"stats"`
+}
+
+func (s *Server) stats(r *http.Request) (interface{}, error) {
+	o, err := s.namespace(r)
+	if err != nil {
+		return nil, err
+	}
+	target, leaf, failing := r.FormValue("target"), r.FormValue("leaf"), r.FormValue("failing") == "true"
+	stats := []orismologer.LeafStats{}
+	for _, leafStats := range o.Stats() {
+		if target != "" && leafStats.Target != target || leaf != "" && leafStats.Leaf != leaf || failing && !leafStats.Failing() {
+			continue
+		}
+		stats = append(stats, leafStats)
+	}
+	return statsResponse{Stats: stats}, nil
+}
+
+type validateRequest struct {
+	Mappings        json.RawMessage `json:"mappings"`
+	Transformations json.RawMessage `json:"transformations"`
+}
+
+type validateResponse struct {
+	Ok       bool           `json:"ok"`
+	Findings []lint.Finding `json:"findings"`
+}
+
+func (s *Server) validate(r *http.Request) (interface{}, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "could not read request: %v", err)
+	}
+	var req validateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %v", err)
+	}
+	mappings := &pb.Mappings{}
+	if err := unmarshalProto(req.Mappings, mappings); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid mappings: %v", err)
+	}
+	transformations := &pb.Transformations{}
+	if err := unmarshalProto(req.Transformations, transformations); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid transformations: %v", err)
+	}
+	findings := lint.Lint(mappings, transformations, s.functions)
+	if findings == nil {
+		findings = []lint.Finding{}
+	}
+	return validateResponse{Ok: !lint.HasErrors(findings), Findings: findings}, nil
+}
+
+// unmarshalProto decodes the JSON form of a proto, if present.
+func unmarshalProto(data json.RawMessage, message proto.Message) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return jsonpb.UnmarshalString(string(data), message)
+}
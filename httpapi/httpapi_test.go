@@ -0,0 +1,281 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/fixtures"
+	"github.com/google/orismologer/orismologer"
+)
+
+func makeServer(t *testing.T, auth AuthFunc) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "httpapi")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	b := fixtures.New().
+		Vendor("cisco", "9").
+		Vendor("aruba", "14823").
+		Leaf("/system/state/up-time", "up_time").
+		Leaf("/system/state/hostname", "hostname").
+		Transformation("up_time", "to_int(up_time_cisco) / 100").
+		NocPath("up_time", "up_time_cisco", "1.3.6.1.4.1.9.1", "2000").
+		Transformation("hostname", "hostname_aruba").
+		NocPath("hostname", "hostname_aruba", "1.3.6.1.4.1.14823.2", "ap1")
+	mappingsFile, transformationsFile, vendorOidsFile, err := b.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	namespaces := orismologer.NewNamespaces()
+	if err := namespaces.Load(orismologer.DefaultNamespace, mappingsFile, transformationsFile, vendorOidsFile); err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	return NewServer(namespaces, auth), func() { os.RemoveAll(dir) }
+}
+
+func TestServer(t *testing.T) {
+	s, cleanup := makeServer(t, nil)
+	defer cleanup()
+	for _, test := range []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{
+			name:         "get",
+			url:          "/v1/get?path=/system/state/up-time&target=switch1&vendor=cisco",
+			expectedCode: http.StatusOK,
+			expected:     `{"path":"/system/state/up-time","value":20}`,
+		},
+		{
+			name:         "get without vendor",
+			url:          "/v1/get?path=/system/state/up-time&target=switch1",
+			expectedCode: http.StatusBadRequest,
+			expected:     `{"error":"missing parameter \"vendor\""}`,
+		},
+		{
+			name:         "get unsupported",
+			url:          "/v1/get?path=/system/state/up-time&target=ap1&vendor=aruba",
+			expectedCode: http.StatusBadGateway,
+		},
+		{
+			name:         "get unsupported with trace",
+			url:          "/v1/get?path=/system/state/up-time&target=ap1&vendor=aruba&trace=true",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "get unknown namespace",
+			url:          "/v1/get?path=/system/state/up-time&target=switch1&vendor=cisco&namespace=unknown",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "list",
+			url:          "/v1/list?root=/system",
+			expectedCode: http.StatusOK,
+			expected:     `{"leaves":["/system/state/up-time","/system/state/hostname"]}`,
+		},
+		{
+			name:         "list unmapped",
+			url:          "/v1/list?root=/interfaces",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "coverage",
+			url:          "/v1/coverage?vendor=aruba",
+			expectedCode: http.StatusOK,
+			expected:     `{"supported":["/system/state/hostname"],"unsupported":["/system/state/up-time"]}`,
+		},
+		{
+			name:         "validate",
+			method:       http.MethodPost,
+			url:          "/v1/validate",
+			body:         `{"mappings": {"nodes": [{"subpath": {"path": "/a"}, "bind": "a"}]}, "transformations": {"transformations": [{"bind": "a", "expressions": ["b"]}]}}`,
+			expectedCode: http.StatusOK,
+			expected:     `{"ok":false,"findings":[{"check":"unbound-variable","severity":"error","subject":"a","message":"expression ` + "`b`" + ` references undefined NocPath or transformation \"b\""}]}`,
+		},
+		{
+			name:         "validate invalid proto",
+			method:       http.MethodPost,
+			url:          "/v1/validate",
+			body:         `{"mappings": {"unknown": 1}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "wrong method",
+			url:          "/v1/validate",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(method, test.url, strings.NewReader(test.body)))
+			if w.Code != test.expectedCode {
+				t.Errorf("%v %v got status %v, expected %v: %v", method, test.url, w.Code, test.expectedCode, w.Body)
+			}
+			if test.expected == "" {
+				return
+			}
+			var got, expected interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v %v returned invalid JSON: %v", method, test.url, err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatalf("invalid expected JSON: %v", err)
+			}
+			if !cmp.Equal(got, expected) {
+				t.Errorf("%v %v = %v, expected %v", method, test.url, w.Body, test.expected)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	s, cleanup := makeServer(t, BearerToken("secret"))
+	defer cleanup()
+	for _, test := range []struct {
+		header       string
+		expectedCode int
+	}{
+		{header: "", expectedCode: http.StatusUnauthorized},
+		{header: "Bearer wrong", expectedCode: http.StatusUnauthorized},
+		{header: "Bearer secret", expectedCode: http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/list", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != test.expectedCode {
+			t.Errorf("Authorization %q got status %v, expected %v", test.header, w.Code, test.expectedCode)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	s, cleanup := makeServer(t, BearerToken("secret"))
+	defer cleanup()
+	s.Handle("/v1/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	for header, expectedCode := range map[string]int{"": http.StatusUnauthorized, "Bearer secret": http.StatusTeapot} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+		r.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != expectedCode {
+			t.Errorf("Authorization %q got status %v, expected %v", header, w.Code, expectedCode)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	s, cleanup := makeServer(t, nil)
+	defer cleanup()
+	for _, url := range []string{
+		"/v1/get?path=/system/state/up-time&target=switch1&vendor=cisco",
+		"/v1/get?path=/system/state/up-time&target=switch1&vendor=cisco",
+		"/v1/get?path=/system/state/up-time&target=ap1&vendor=aruba",
+		"/v1/get?path=/system/state/hostname&target=ap1&vendor=aruba",
+	} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+	for _, test := range []struct {
+		url      string
+		expected []string // Target and leaf of each result.
+	}{
+		{
+			url:      "/v1/stats",
+			expected: []string{"ap1 /system/state/hostname", "ap1 /system/state/up-time", "switch1 /system/state/up-time"},
+		},
+		{url: "/v1/stats?target=switch1", expected: []string{"switch1 /system/state/up-time"}},
+		{url: "/v1/stats?leaf=/system/state/hostname", expected: []string{"ap1 /system/state/hostname"}},
+		{url: "/v1/stats?failing=true", expected: []string{"ap1 /system/state/up-time"}},
+		{url: "/v1/stats?target=unknown", expected: []string{}},
+	} {
+		t.Run(test.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %v got status %v: %v", test.url, w.Code, w.Body)
+			}
+			var resp statsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("GET %v returned invalid JSON: %v", test.url, err)
+			}
+			got := []string{}
+			for _, stats := range resp.Stats {
+				got = append(got, stats.Target+" "+stats.Leaf)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("GET %v returned unexpected stats (-expected +got):\n%s", test.url, diff)
+			}
+		})
+	}
+}
+
+func TestGetPostProcessed(t *testing.T) {
+	s, cleanup := makeServer(t, nil)
+	defer cleanup()
+	o, err := s.namespaces.Get(orismologer.DefaultNamespace)
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	o.AddPostProcessor(orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		result.Tag("site", "lon1")
+		return result.Path != "/system/state/hostname", nil
+	}))
+	for _, test := range []struct {
+		url          string
+		expectedCode int
+		expected     string
+	}{
+		{
+			url:          "/v1/get?path=/system/state/up-time&target=switch1&vendor=cisco",
+			expectedCode: http.StatusOK,
+			expected:     `{"path":"/system/state/up-time","value":20,"tags":{"site":"lon1"}}`,
+		},
+		{
+			url:          "/v1/get?path=/system/state/hostname&target=ap1&vendor=aruba",
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+		if w.Code != test.expectedCode {
+			t.Errorf("GET %v got status %v, expected %v: %v", test.url, w.Code, test.expectedCode, w.Body)
+		}
+		if test.expected != "" && strings.TrimSpace(w.Body.String()) != test.expected {
+			t.Errorf("GET %v = %v, expected %v", test.url, w.Body, test.expected)
+		}
+	}
+}
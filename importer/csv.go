@@ -0,0 +1,292 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package importer converts mappings maintained outside of Orismologer (eg: in spreadsheets) into
+Mappings and Transformations protos.
+
+The CSV format has one row per (OpenConfig path, vendor) pair with the following columns:
+
+	oc_path, oid, expression, vendor
+
+The expression may refer to the value retrieved from the row's OID via the identifier `oid`. If the
+expression is empty the raw OID value is used. An optional header row matching the column names
+above is skipped.
+
+Vendors must be vendors or models of a VendorOids proto. The rows of a path become the expressions
+of its transformation, in order, and evaluation takes the first whose OID the target's vendor
+supports. Every vendor supports standard OIDs (those outside the vendor root), so the first row of a
+path with a standard OID is used for every vendor which has no earlier row: a later row for another
+vendor would never be used, and is an error unless it repeats the standard row's OID and expression
+(in which case it is skipped). List rows with vendor-specific OIDs first.
+
+Transformations and NocPaths are named after paths and vendors (see BindName), so paths or vendors
+which differ only in punctuation (eg: /a-b and /a_b) clash, which is an error.
+*/
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/orismologer/oparse"
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+const (
+	// OidVariable is the identifier by which CSV expressions refer to the row's OID.
+	OidVariable = "oid"
+
+	numColumns = 4
+)
+
+var (
+	header       = []string{"oc_path", "oid", "expression", "vendor"}
+	oidPattern   = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+	nonIdentChar = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// RowError describes a problem with a single row of an imported CSV file.
+type RowError struct {
+	Row int // The 1-based line the row starts on, counting comments, as displayed by spreadsheet tools.
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+// Errors collects the errors for every invalid row of an imported CSV file.
+type Errors []RowError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d invalid row(s):\n%v", len(e), strings.Join(msgs, "\n"))
+}
+
+// standardRow is the first row of a path with a standard OID, which every vendor supports.
+type standardRow struct {
+	row        int
+	oid        string
+	expression string
+}
+
+// derivation is the source of a name derived by BindName, eg: a path.
+type derivation struct {
+	row    int
+	source string
+}
+
+/*
+ImportCSV reads CSV rows from r and returns the equivalent Mappings and Transformations protos.
+Vendors are validated against vendorInfo. Every row is validated; if any are invalid the returned
+error is of type Errors and lists each of them.
+*/
+func ImportCSV(r io.Reader, vendorInfo *pb.VendorOids) (*pb.Mappings, *pb.Transformations, error) {
+	vendors := map[string]bool{}
+	for vendor := range vendorInfo.GetVendors() {
+		vendors[vendor] = true
+	}
+	for _, model := range vendorInfo.GetModels() {
+		vendors[model.GetName()] = true
+	}
+	root := vendorInfo.GetVendorRoot()
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Column counts are validated per row below.
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	mappings := &pb.Mappings{}
+	transformations := &pb.Transformations{}
+	nodes := map[string]*pb.OpenConfigNode{}
+	byBind := map[string]*pb.Transformation{}
+	seen := map[string]int{}
+	standard := map[string]standardRow{} // Path -> its first row with a standard OID.
+	derived := map[string]derivation{}   // Name -> what it was derived from.
+	var errs Errors
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			row := 0
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				row = parseErr.StartLine
+			}
+			errs = append(errs, RowError{row, err})
+			continue
+		}
+		row, _ := reader.FieldPos(0) // Comment and blank lines are skipped by the reader, so not counted by records.
+		if first && isHeader(record) {
+			continue
+		}
+		ocPath, oid, expressionString, vendor, err := parseRecord(record)
+		if err != nil {
+			errs = append(errs, RowError{row, err})
+			continue
+		}
+		if !vendors[vendor] {
+			errs = append(errs, RowError{row, fmt.Errorf("unknown vendor %q: it is neither a vendor nor a model of the VendorOids", vendor)})
+			continue
+		}
+		key := ocPath + "\x00" + vendor
+		if previous, ok := seen[key]; ok {
+			errs = append(errs, RowError{row, fmt.Errorf("path %q already mapped for vendor %q on row %d", ocPath, vendor, previous)})
+			continue
+		}
+		seen[key] = row
+		if previous, ok := standard[ocPath]; ok {
+			if oid == previous.oid && expressionString == previous.expression {
+				continue // The standard row already covers this vendor.
+			}
+			errs = append(errs, RowError{row, fmt.Errorf("path %q is mapped to standard OID %v on row %d, which every vendor supports, so this row would never be used: list rows with vendor-specific OIDs first", ocPath, previous.oid, previous.row)})
+			continue
+		}
+
+		bind := BindName(ocPath)
+		nocPathBind := bind + "_" + BindName(vendor)
+		if err := derive(derived, bind, fmt.Sprintf("path %q", ocPath), row); err != nil {
+			errs = append(errs, RowError{row, err})
+			continue
+		}
+		if err := derive(derived, nocPathBind, fmt.Sprintf("path %q and vendor %q", ocPath, vendor), row); err != nil {
+			errs = append(errs, RowError{row, err})
+			continue
+		}
+		expression, err := rewriteExpression(expressionString, nocPathBind)
+		if err != nil {
+			errs = append(errs, RowError{row, err})
+			continue
+		}
+		if !utils.HasOidPrefix(oid, root) {
+			standard[ocPath] = standardRow{row: row, oid: oid, expression: expressionString}
+		}
+
+		if _, ok := nodes[ocPath]; !ok {
+			node := &pb.OpenConfigNode{Subpath: &pb.OpenConfigPath{Path: ocPath}, Bind: bind}
+			nodes[ocPath] = node
+			mappings.Nodes = append(mappings.Nodes, node)
+		}
+		transformation, ok := byBind[bind]
+		if !ok {
+			transformation = &pb.Transformation{Bind: bind}
+			byBind[bind] = transformation
+			transformations.Transformations = append(transformations.Transformations, transformation)
+		}
+		transformation.Expressions = append(transformation.Expressions, expression)
+		transformation.NocPaths = append(transformation.NocPaths, &pb.NocPath{
+			Bind: nocPathBind,
+			Oids: []string{oid},
+		})
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return mappings, transformations, nil
+}
+
+/*
+derive records that a name was derived from the given source, returning an error if it was already
+derived from another, eg: "a_b" from both /a-b and /a_b.
+*/
+func derive(derived map[string]derivation, name, source string, row int) error {
+	previous, ok := derived[name]
+	switch {
+	case !ok:
+		derived[name] = derivation{row: row, source: source}
+	case previous.source != source:
+		return fmt.Errorf("%v clashes with %v on row %d: both are named %q", source, previous.source, previous.row, name)
+	}
+	return nil
+}
+
+// parseRecord validates a single CSV record and returns its fields.
+func parseRecord(record []string) (ocPath, oid, expression, vendor string, err error) {
+	if len(record) != numColumns {
+		return "", "", "", "", fmt.Errorf("expected %d columns (%v), got %d", numColumns, strings.Join(header, ", "), len(record))
+	}
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+	ocPath, oid, expression, vendor = record[0], record[1], record[2], record[3]
+	switch {
+	case !strings.HasPrefix(ocPath, "/") || len(ocPath) < 2:
+		return "", "", "", "", fmt.Errorf("OpenConfig path %q must be absolute (start with /)", ocPath)
+	case strings.Contains(ocPath, "//"):
+		return "", "", "", "", fmt.Errorf("invalid OpenConfig path %q", ocPath)
+	case !oidPattern.MatchString(oid):
+		return "", "", "", "", fmt.Errorf("OID %q is not in dot notation", oid)
+	case vendor == "":
+		return "", "", "", "", fmt.Errorf("vendor missing for path %q", ocPath)
+	}
+	return ocPath, oid, expression, vendor, nil
+}
+
+func isHeader(record []string) bool {
+	if len(record) != len(header) {
+		return false
+	}
+	for i, column := range header {
+		if strings.ToLower(strings.TrimSpace(record[i])) != column {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+rewriteExpression parses the given expression, replaces references to OidVariable with the given
+NocPath identifier and returns the result as a string. An empty expression yields the identifier.
+*/
+func rewriteExpression(expressionString, nocPathBind string) (string, error) {
+	if expressionString == "" {
+		return nocPathBind, nil
+	}
+	expression, err := oparse.Parse(expressionString)
+	if err != nil {
+		return "", err
+	}
+	variables, _ := expression.Identifiers()
+	usesOid := false
+	for _, variable := range variables {
+		if variable != OidVariable {
+			return "", fmt.Errorf("expression `%v` references %q; only %q may be used", expressionString, variable, OidVariable)
+		}
+		usesOid = true
+	}
+	if !usesOid {
+		return "", fmt.Errorf("expression `%v` does not reference %q", expressionString, OidVariable)
+	}
+	expression.RenameVariable(OidVariable, nocPathBind)
+	return expression.String(), nil
+}
+
+// BindName derives a transformation identifier from an OpenConfig path (or any other string).
+// eg: "/system/state/boot-time" -> "system_state_boot_time"
+func BindName(s string) string {
+	return strings.Trim(nonIdentChar.ReplaceAllString(s, "_"), "_")
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+var vendorInfo = &pb.VendorOids{
+	VendorRoot: "1.3.6.1.4.1",
+	Vendors:    map[string]string{"cisco": "9", "aruba": "14823", "cisco-ios": "99", "cisco_ios": "999"},
+	Models:     []*pb.DeviceModel{{Name: "aruba-7200", Vendor: "aruba"}},
+}
+
+func TestImportCSV(t *testing.T) {
+	const input = `oc_path,oid,expression,vendor
+/system/state/boot-time,1.3.6.1.4.1.9.9.168.1.1.10,"time_since_epoch(oid, 'ntp', 's')",cisco
+/system/state/boot-time,1.3.6.1.4.1.14823.2.2.1.2.1.6,,aruba
+# Comments are ignored.
+/system/memory/state/physical,1.3.6.1.4.1.14823.2.2.1.1.1.11.1.2,to_int(oid) * 1000,aruba
+# A standard OID covers the other vendors, so repeating it for another vendor adds nothing.
+/system/memory/state/physical,1.3.6.1.4.1.9.9.48.1.1.1.5,,cisco
+/system/memory/state/physical,1.3.6.1.2.1.25.2.3.1.5,,aruba-7200
+/system/memory/state/physical,1.3.6.1.2.1.25.2.3.1.5,,cisco-ios
+`
+	mappings, transformations, err := ImportCSV(strings.NewReader(input), vendorInfo)
+	if err != nil {
+		t.Fatalf("ImportCSV() got error: %v", err)
+	}
+	expectedMappings := &pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "system_state_boot_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/memory/state/physical"}, Bind: "system_memory_state_physical"},
+		},
+	}
+	expectedTransformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind: "system_state_boot_time",
+				Expressions: []string{
+					"time_since_epoch(system_state_boot_time_cisco, 'ntp', 's')",
+					"system_state_boot_time_aruba",
+				},
+				NocPaths: []*pb.NocPath{
+					{Bind: "system_state_boot_time_cisco", Oids: []string{"1.3.6.1.4.1.9.9.168.1.1.10"}},
+					{Bind: "system_state_boot_time_aruba", Oids: []string{"1.3.6.1.4.1.14823.2.2.1.2.1.6"}},
+				},
+			},
+			{
+				Bind: "system_memory_state_physical",
+				Expressions: []string{
+					"to_int(system_memory_state_physical_aruba) * 1000",
+					"system_memory_state_physical_cisco",
+					"system_memory_state_physical_aruba_7200",
+				},
+				NocPaths: []*pb.NocPath{
+					{Bind: "system_memory_state_physical_aruba", Oids: []string{"1.3.6.1.4.1.14823.2.2.1.1.1.11.1.2"}},
+					{Bind: "system_memory_state_physical_cisco", Oids: []string{"1.3.6.1.4.1.9.9.48.1.1.1.5"}},
+					{Bind: "system_memory_state_physical_aruba_7200", Oids: []string{"1.3.6.1.2.1.25.2.3.1.5"}},
+				},
+			},
+		},
+	}
+	if !proto.Equal(mappings, expectedMappings) {
+		t.Errorf("ImportCSV() mappings = %v, expected %v", mappings, expectedMappings)
+	}
+	if !proto.Equal(transformations, expectedTransformations) {
+		t.Errorf("ImportCSV() transformations = %v, expected %v", transformations, expectedTransformations)
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	const input = `/system/state/boot-time,1.3.6.1.2.1.1.3,,cisco
+system/relative,1.3.6.1.2.1.1.3,,cisco
+/system/bad-oid,iso.3.6,,cisco
+# Comments and blank lines are counted.
+
+/system/no-vendor,1.3.6.1.2.1.1.3,,
+/system/state/boot-time,1.3.6.1.2.1.1.3,,cisco
+/system/unparseable,1.3.6.1.2.1.1.3,oid +,cisco
+/system/other-variable,1.3.6.1.2.1.1.3,other * 2,cisco
+/system/too-few-columns,1.3.6.1.2.1.1.3
+/system/unknown-vendor,1.3.6.1.2.1.1.3,,juniper
+/system/standard,1.3.6.1.2.1.1.5,,aruba
+/system/standard,1.3.6.1.4.1.9.2.1.3,,cisco
+/system/standard,1.3.6.1.2.1.1.5,to_string(oid),cisco-ios
+/system/a-b,1.3.6.1.2.1.1.3,,cisco
+/system/a_b,1.3.6.1.2.1.1.3,,aruba
+/system/vendors,1.3.6.1.4.1.99.1,,cisco-ios
+/system/vendors,1.3.6.1.4.1.999.1,,cisco_ios
+`
+	_, _, err := ImportCSV(strings.NewReader(input), vendorInfo)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("ImportCSV() got error %v of type %T, expected Errors", err, err)
+	}
+	var gotRows []int
+	for _, rowErr := range errs {
+		gotRows = append(gotRows, rowErr.Row)
+	}
+	expectedRows := []int{2, 3, 6, 7, 8, 9, 10, 11, 13, 14, 16, 18}
+	if len(gotRows) != len(expectedRows) {
+		t.Fatalf("ImportCSV() reported errors for rows %v, expected %v", gotRows, expectedRows)
+	}
+	for i := range gotRows {
+		if gotRows[i] != expectedRows[i] {
+			t.Fatalf("ImportCSV() reported errors for rows %v, expected %v", gotRows, expectedRows)
+		}
+	}
+}
+
+func TestBindName(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{input: "/system/state/boot-time", expected: "system_state_boot_time"},
+		{input: "/components/component[name=cpu]/state", expected: "components_component_name_cpu_state"},
+		{input: "cisco", expected: "cisco"},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			if got := BindName(test.input); got != test.expected {
+				t.Errorf("BindName(%q) = %q, expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"github.com/google/orismologer/oparse"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+/*
+Kinds infers the kinds of the results of transformations without evaluating them (see oparse.Infer),
+eg: to check them against the YANG types of the leaves they are bound to (see
+octree.OcTree.ValidateTypes). NocPaths and constants may be of any kind, and transformations referenced
+by others are of their inferred kinds. A transformation is only included if each of its expressions
+infers to the same kind, or to null: transformations which call functions without signatures, or
+whose kind depends on their variables, are omitted. No kinds are inferred unless functions is a
+SignatureSet.
+*/
+func Kinds(transformations *pb.Transformations, functions FunctionSet) map[string]oparse.Kind {
+	kinds := map[string]oparse.Kind{}
+	signatures, ok := functions.(SignatureSet)
+	if !ok {
+		return kinds
+	}
+	var constants oparse.Context
+	if constantSet, ok := functions.(ConstantSet); ok {
+		constants = constantSet.Constants()
+	}
+	byName := map[string]*pb.Transformation{}
+	for _, t := range transformations.GetTransformations() {
+		byName[t.GetBind()] = t
+	}
+	k := &kindInferrer{
+		transformations: byName,
+		signatures:      signatures.Signatures(),
+		constants:       constants,
+		kinds:           kinds,
+		done:            map[string]bool{},
+		visiting:        map[string]bool{},
+	}
+	for name := range byName {
+		k.infer(name)
+	}
+	return kinds
+}
+
+type kindInferrer struct {
+	transformations map[string]*pb.Transformation
+	signatures      map[string]oparse.Signature
+	constants       oparse.Context
+	kinds           map[string]oparse.Kind // Of the transformations inferred so far.
+	done            map[string]bool        // Transformations inferred so far, whether or not they have a kind.
+	visiting        map[string]bool        // To break cycles of references.
+}
+
+// infer returns the kind of the named transformation, or false if it cannot be inferred.
+func (k *kindInferrer) infer(name string) (oparse.Kind, bool) {
+	if k.done[name] || k.visiting[name] {
+		kind, ok := k.kinds[name]
+		return kind, ok
+	}
+	k.visiting[name] = true
+	defer delete(k.visiting, name)
+	kind, ok := k.inferExpressions(k.transformations[name])
+	k.done[name] = true
+	if ok {
+		k.kinds[name] = kind
+	}
+	return kind, ok
+}
+
+func (k *kindInferrer) inferExpressions(t *pb.Transformation) (oparse.Kind, bool) {
+	nocPaths := map[string]bool{}
+	for _, nocPath := range t.GetNocPaths() {
+		nocPaths[nocPath.GetBind()] = true
+	}
+	kind := oparse.NullKind
+	for _, expressionString := range t.GetExpressions() {
+		expression, err := oparse.Parse(expressionString)
+		if err != nil {
+			return kind, false
+		}
+		variables := map[string]oparse.Kind{}
+		names, _ := expression.Identifiers()
+		for _, name := range names {
+			_, isConstant := k.constants[name]
+			_, isTransformation := k.transformations[name]
+			if isConstant || nocPaths[name] || !isTransformation {
+				continue
+			}
+			if variableKind, ok := k.infer(name); ok {
+				variables[name] = variableKind
+			}
+		}
+		expressionKind, err := oparse.Infer(expression, variables, k.signatures)
+		switch {
+		case err != nil, expressionKind == oparse.AnyKind:
+			return kind, false
+		case expressionKind == oparse.NullKind:
+			continue
+		case kind != oparse.NullKind && kind != expressionKind:
+			return kind, false
+		}
+		kind = expressionKind
+	}
+	return kind, kind != oparse.NullKind
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package lint checks Mappings and Transformations protos for likely mistakes, returning structured
+findings which can be printed by the CLI or consumed by CI integrations.
+*/
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/orismologer/oparse"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Severity indicates how serious a finding is.
+type Severity int
+
+const (
+	// Warning findings are likely, but not certainly, mistakes.
+	Warning Severity = iota
+
+	// Error findings will cause evaluation to fail.
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// MarshalText encodes the severity by name, eg: in JSON output.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Names of the checks performed by Lint.
+const (
+	CheckUnusedTransformation = "unused-transformation"
+	CheckUnusedNocPath        = "unused-noc-path"
+	CheckUnboundVariable      = "unbound-variable"
+	CheckUnboundLeaf          = "unbound-leaf"
+	CheckUndefinedFunction    = "undefined-function"
+	CheckDuplicateOid         = "duplicate-oid"
+	CheckMissingSample        = "missing-sample"
+	CheckMissingOid           = "missing-oid"
+	CheckUnparseable          = "unparseable-expression"
+	CheckSuspiciousExpression = "suspicious-expression"
+	CheckInvalidExpression    = "invalid-expression"
+)
+
+// Finding describes a single problem found in a configuration.
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+
+	// Subject identifies what the finding is about, eg: a transformation or OpenConfig path.
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%v: %v [%v]: %v", f.Severity, f.Subject, f.Check, f.Message)
+}
+
+// FunctionSet reports which functions may be called from expressions (eg: functions.Library).
+type FunctionSet interface {
+	Contains(funcName string) bool
+}
+
+/*
+SignatureSet is implemented by function sets which can describe the signatures of their functions
+(eg: functions.Library), so that expressions can be validated (see oparse.Validate).
+*/
+type SignatureSet interface {
+	Signatures() map[string]oparse.Signature
+}
+
+/*
+ConstantSet is implemented by function sets whose expressions may use named constants (see
+oparse.Options.Constants), so that constants are not reported as unbound variables.
+*/
+type ConstantSet interface {
+	Constants() oparse.Context
+}
+
+// HasErrors returns true if any of the given findings has Error severity.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	transformations map[string]*pb.Transformation
+	functions       FunctionSet
+	signatures      map[string]oparse.Signature // Nil unless functions is a SignatureSet.
+	constants       oparse.Context              // Nil unless functions is a ConstantSet.
+	referenced      map[string]bool
+	findings        []Finding
+}
+
+func (l *linter) report(check string, severity Severity, subject, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{
+		Check:    check,
+		Severity: severity,
+		Subject:  subject,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+/*
+Lint checks the given protos and returns its findings, ordered by subject. If functions is nil,
+function names used in expressions are not checked. If functions is a SignatureSet, expressions are
+also validated against the signatures of the functions they call. If functions is a ConstantSet, its
+constants may be used in expressions.
+*/
+func Lint(mappings *pb.Mappings, transformations *pb.Transformations, functions FunctionSet) []Finding {
+	l := &linter{
+		transformations: map[string]*pb.Transformation{},
+		functions:       functions,
+		referenced:      map[string]bool{},
+	}
+	if signatures, ok := functions.(SignatureSet); ok {
+		l.signatures = signatures.Signatures()
+	}
+	if constants, ok := functions.(ConstantSet); ok {
+		l.constants = constants.Constants()
+	}
+	for _, t := range transformations.GetTransformations() {
+		l.transformations[t.GetBind()] = t
+	}
+	for _, node := range mappings.GetNodes() {
+		l.lintNode("", node)
+	}
+	oids := map[string]string{} // OID -> NocPath which first declared it.
+	for _, t := range transformations.GetTransformations() {
+		l.lintTransformation(t, oids)
+	}
+	for _, t := range transformations.GetTransformations() {
+		if !l.referenced[t.GetBind()] {
+			l.report(CheckUnusedTransformation, Warning, t.GetBind(), "transformation is not referenced by any mapping or expression")
+		}
+	}
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		return l.findings[i].Subject < l.findings[j].Subject
+	})
+	return l.findings
+}
+
+func (l *linter) lintNode(parent string, node *pb.OpenConfigNode) {
+	path := node.GetSubpath().GetPath()
+	if !strings.HasPrefix(path, "/") {
+		path = parent + "/" + path
+	}
+	if bind := node.GetBind(); bind != "" {
+		l.referenced[bind] = true
+		if _, ok := l.transformations[bind]; !ok {
+			l.report(CheckUnboundLeaf, Error, path, "bound to undefined transformation %q", bind)
+		}
+	}
+	for _, child := range node.GetChildren() {
+		l.lintNode(path, child)
+	}
+}
+
+func (l *linter) lintTransformation(t *pb.Transformation, oids map[string]string) {
+	name := t.GetBind()
+	nocPaths := map[string]*pb.NocPath{}
+	for _, nocPath := range t.GetNocPaths() {
+		nocPaths[nocPath.GetBind()] = nocPath
+		subject := name + "." + nocPath.GetBind()
+		if len(nocPath.GetOids()) == 0 {
+			l.report(CheckMissingOid, Error, subject, "NocPath has no OIDs")
+		}
+		if len(nocPath.GetSamples()) == 0 {
+			l.report(CheckMissingSample, Warning, subject, "NocPath has no sample values")
+		}
+		for _, oid := range nocPath.GetOids() {
+			if other, ok := oids[oid]; ok {
+				l.report(CheckDuplicateOid, Warning, subject, "OID %v is also used by NocPath %q", oid, other)
+				continue
+			}
+			oids[oid] = subject
+		}
+	}
+	if len(t.GetExpressions()) == 0 {
+		l.report(CheckSuspiciousExpression, Error, name, "transformation has no expressions")
+	}
+
+	usedNocPaths := map[string]bool{}
+	for _, expressionString := range t.GetExpressions() {
+		expression, err := oparse.Parse(expressionString)
+		if err != nil {
+			l.report(CheckUnparseable, Error, name, "%v", err)
+			continue
+		}
+		variables, functionNames := expression.Identifiers()
+		if len(variables) == 0 {
+			l.report(CheckSuspiciousExpression, Warning, name, "expression `%v` is constant", expressionString)
+		}
+		if divisionByZero(expression) {
+			l.report(CheckSuspiciousExpression, Error, name, "expression `%v` divides by zero", expressionString)
+		}
+		for _, variable := range variables {
+			_, isNocPath := nocPaths[variable]
+			_, isTransformation := l.transformations[variable]
+			_, isConstant := l.constants[variable]
+			switch {
+			case isConstant: // Takes precedence, as in evaluation.
+			case isNocPath:
+				usedNocPaths[variable] = true
+			case isTransformation:
+				l.referenced[variable] = true
+			default:
+				l.report(CheckUnboundVariable, Error, name, "expression `%v` references undefined NocPath or transformation %q", expressionString, variable)
+			}
+		}
+		if l.functions == nil {
+			continue
+		}
+		defined := true
+		for _, functionName := range functionNames {
+			if !l.functions.Contains(functionName) {
+				l.report(CheckUndefinedFunction, Error, name, "expression `%v` calls undefined function %q", expressionString, functionName)
+				defined = false
+			}
+		}
+		// Calls of undefined functions are reported above.
+		if l.signatures != nil && defined {
+			if err := oparse.Validate(expression, l.signatures); err != nil {
+				l.report(CheckInvalidExpression, Error, name, "%v", err)
+			}
+		}
+	}
+	for _, nocPath := range t.GetNocPaths() {
+		if !usedNocPaths[nocPath.GetBind()] {
+			l.report(CheckUnusedNocPath, Warning, name+"."+nocPath.GetBind(), "NocPath is not referenced by any expression")
+		}
+	}
+}
+
+// divisionByZero returns true if the expression divides (or takes a modulo) by a literal zero.
+func divisionByZero(e *oparse.Expression) bool {
+	found := false
+	oparse.Inspect(e, func(node oparse.Node) bool {
+		if r, ok := node.(*oparse.OpFactor); ok && (r.Operator == oparse.OpDiv || r.Operator == oparse.OpMod) {
+			divisor := r.Factor
+			if divisor.Exponent == nil && divisor.Base.Number != nil && divisor.Base.Number.Float == 0 {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
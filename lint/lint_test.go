@@ -0,0 +1,230 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/functions"
+	"github.com/google/orismologer/oparse"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+type functionSet map[string]bool
+
+func (f functionSet) Contains(funcName string) bool {
+	return f[funcName]
+}
+
+func TestLint(t *testing.T) {
+	mappings := &pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{
+				Subpath: &pb.OpenConfigPath{Path: "/system"},
+				Children: []*pb.OpenConfigNode{
+					{Subpath: &pb.OpenConfigPath{Path: "state/boot-time"}, Bind: "boot_time"},
+					{Subpath: &pb.OpenConfigPath{Path: "state/hostname"}, Bind: "hostname"},
+				},
+			},
+		},
+	}
+	transformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind:        "boot_time",
+				Expressions: []string{"to_int(up_time) / 100", "unknown_func(up_time_typo)"},
+				NocPaths: []*pb.NocPath{
+					{Bind: "up_time", Oids: []string{"1.3.6.1.2.1.1.3"}, Samples: []string{"100"}},
+					{Bind: "unused", Oids: []string{"1.3.6.1.2.1.1.3"}, Samples: []string{"100"}},
+				},
+			},
+			{
+				Bind:        "orphan",
+				Expressions: []string{"1 / (2 / 0)", "'a' +", "2 % 0", "null ?? null[1 / 0]"},
+			},
+			{
+				Bind:        "z_no_samples",
+				Expressions: []string{"to_int(value)"},
+				NocPaths:    []*pb.NocPath{{Bind: "value"}},
+			},
+		},
+	}
+	expected := []Finding{
+		{Check: CheckUndefinedFunction, Severity: Error, Subject: "boot_time"},
+		{Check: CheckUnboundVariable, Severity: Error, Subject: "boot_time"},
+		{Check: CheckDuplicateOid, Severity: Warning, Subject: "boot_time.unused"},
+		{Check: CheckUnusedNocPath, Severity: Warning, Subject: "boot_time.unused"},
+		{Check: CheckSuspiciousExpression, Severity: Warning, Subject: "orphan"},
+		{Check: CheckSuspiciousExpression, Severity: Error, Subject: "orphan"},
+		{Check: CheckSuspiciousExpression, Severity: Warning, Subject: "orphan"},
+		{Check: CheckSuspiciousExpression, Severity: Error, Subject: "orphan"},
+		{Check: CheckSuspiciousExpression, Severity: Warning, Subject: "orphan"},
+		{Check: CheckSuspiciousExpression, Severity: Error, Subject: "orphan"},
+		{Check: CheckUnparseable, Severity: Error, Subject: "orphan"},
+		{Check: CheckUnusedTransformation, Severity: Warning, Subject: "orphan"},
+		{Check: CheckUnboundLeaf, Severity: Error, Subject: "/system/state/hostname"},
+		{Check: CheckUnusedTransformation, Severity: Warning, Subject: "z_no_samples"},
+		{Check: CheckMissingOid, Severity: Error, Subject: "z_no_samples.value"},
+		{Check: CheckMissingSample, Severity: Warning, Subject: "z_no_samples.value"},
+	}
+	got := Lint(mappings, transformations, functionSet{"to_int": true})
+	// Messages are for humans; compare everything else.
+	for i := range got {
+		got[i].Message = ""
+	}
+	// Findings are sorted by subject only, so compare as multisets within each subject.
+	less := func(a, b Finding) bool {
+		if a.Subject != b.Subject {
+			return a.Subject < b.Subject
+		}
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		return a.Severity < b.Severity
+	}
+	sort.Slice(got, func(i, j int) bool { return less(got[i], got[j]) })
+	sort.Slice(expected, func(i, j int) bool { return less(expected[i], expected[j]) })
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Lint() returned unexpected findings (-expected +got):\n%v", diff)
+	}
+	if !HasErrors(got) {
+		t.Errorf("HasErrors() = false, expected true")
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	mappings := &pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+		},
+	}
+	transformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind:        "boot_time",
+				Expressions: []string{"up_time / 100"},
+				NocPaths: []*pb.NocPath{
+					{Bind: "up_time", Oids: []string{"1.3.6.1.2.1.1.3"}, Samples: []string{"100"}},
+				},
+			},
+		},
+	}
+	if got := Lint(mappings, transformations, nil); len(got) != 0 {
+		t.Errorf("Lint() = %v, expected no findings", got)
+	}
+}
+
+func TestLintInvalidExpressions(t *testing.T) {
+	mappings := &pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+		},
+	}
+	transformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind:        "boot_time",
+				Expressions: []string{"to_int(up_time) / 100", "to_int(up_time, 100)", "'up' - up_time", "undefined(up_time)"},
+				NocPaths: []*pb.NocPath{
+					{Bind: "up_time", Oids: []string{"1.3.6.1.2.1.1.3"}, Samples: []string{"100"}},
+				},
+			},
+		},
+	}
+	expected := []Finding{
+		{Check: CheckInvalidExpression, Severity: Error, Subject: "boot_time"},
+		{Check: CheckInvalidExpression, Severity: Error, Subject: "boot_time"},
+		{Check: CheckUndefinedFunction, Severity: Error, Subject: "boot_time"},
+	}
+	got := Lint(mappings, transformations, functions.NewLibrary())
+	for i := range got {
+		got[i].Message = ""
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Lint() returned unexpected findings (-expected +got):\n%v", diff)
+	}
+}
+
+// constantSet is a function set which defines named constants.
+type constantSet struct {
+	functionSet
+	constants oparse.Context
+}
+
+func (c constantSet) Constants() oparse.Context {
+	return c.constants
+}
+
+func TestLintConstants(t *testing.T) {
+	mappings := &pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+		},
+	}
+	transformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind:        "boot_time",
+				Expressions: []string{"(ntp_time - NTP_EPOCH_OFFSET) * KILO", "ntp_time - UNDEFINED"},
+				NocPaths: []*pb.NocPath{
+					{Bind: "ntp_time", Oids: []string{"1.3.6.1.2.1.25.1.2"}, Samples: []string{"3800000000"}},
+				},
+			},
+		},
+	}
+	functions := constantSet{functionSet{}, oparse.Context{"NTP_EPOCH_OFFSET": 2208988800, "KILO": 1000}}
+	expected := []Finding{
+		{Check: CheckUnboundVariable, Severity: Error, Subject: "boot_time"},
+	}
+	got := Lint(mappings, transformations, functions)
+	for i := range got {
+		got[i].Message = ""
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Lint() returned unexpected findings (-expected +got):\n%v", diff)
+	}
+}
+
+func TestKinds(t *testing.T) {
+	nocPath := []*pb.NocPath{{Bind: "up_time", Oids: []string{"1.3.6.1.2.1.1.3"}}}
+	transformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{Bind: "seconds", Expressions: []string{"to_int(up_time) / 100"}, NocPaths: nocPath},
+			{Bind: "description", Expressions: []string{"upper(up_time)", "null"}, NocPaths: nocPath},
+			{Bind: "is_up", Expressions: []string{"seconds > 0"}},
+			{Bind: "raw", Expressions: []string{"up_time"}, NocPaths: nocPath},
+			{Bind: "mixed", Expressions: []string{"seconds", "description"}},
+			{Bind: "undefined", Expressions: []string{"undefined(up_time)"}, NocPaths: nocPath},
+			{Bind: "cycle", Expressions: []string{"cycle + 1"}},
+		},
+	}
+	expected := map[string]oparse.Kind{
+		"seconds":     oparse.FloatKind,
+		"description": oparse.StringKind,
+		"is_up":       oparse.BoolKind,
+	}
+	got := Kinds(transformations, functions.NewLibrary())
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Kinds() returned unexpected kinds (-expected +got):\n%v", diff)
+	}
+	if got := Kinds(transformations, functionSet{"to_int": true}); len(got) != 0 {
+		t.Errorf("Kinds() without signatures = %v, expected none", got)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mib
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// token is a lexical token of a MIB module. Quoted strings keep their quotes.
+type token struct {
+	text string
+	line int
+}
+
+/*
+tokenize splits a MIB module into tokens, dropping comments. Comments start with "--" and end at the
+end of the line or at the next "--".
+*/
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			i += 2
+			for i < len(runes) && runes[i] != '\n' {
+				if runes[i] == '-' && i+1 < len(runes) && runes[i+1] == '-' {
+					i += 2
+					break
+				}
+				i++
+			}
+		case c == '"':
+			start, startLine := i, line
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", startLine)
+			}
+			i++
+			tokens = append(tokens, token{text: string(runes[start:i]), line: startLine})
+		case c == ':' && strings.HasPrefix(string(runes[i:min(i+3, len(runes))]), "::="):
+			tokens = append(tokens, token{text: "::=", line: line})
+			i += 3
+		case c == '.' && i+1 < len(runes) && runes[i+1] == '.':
+			tokens = append(tokens, token{text: "..", line: line})
+			i += 2
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' ||
+				(runes[i] == '-' && !(i+1 < len(runes) && runes[i+1] == '-'))) {
+				i++
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), line: line})
+		case c == '\'':
+			// Binary or hex strings, eg: '0F'H.
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '\'' {
+				i++
+			}
+			i++
+			if i < len(runes) && (runes[i] == 'H' || runes[i] == 'h' || runes[i] == 'B' || runes[i] == 'b') {
+				i++
+			}
+			tokens = append(tokens, token{text: string(runes[start:min(i, len(runes))]), line: line})
+		default:
+			tokens = append(tokens, token{text: string(c), line: line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,390 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package mib parses SMIv2 (and most SMIv1) MIB modules, so that OIDs can be written symbolically, eg:
+IF-MIB::ifHCInOctets, and resolved to numeric OIDs. Only what is needed to name objects is parsed:
+module imports, OID assignments and the SYNTAX of objects. Well known roots such as mib-2 and
+enterprises are predefined, so SNMPv2-SMI need not be loaded.
+*/
+package mib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// numericArcRe matches OIDs starting with a numeric arc, with or without a leading dot.
+var numericArcRe = regexp.MustCompile(`^\.?[0-9]+(\.|$)`)
+
+/*
+IsSymbolic reports whether an OID starts with an object name rather than a number, eg:
+IF-MIB::ifDescr.index rather than 1.3.6.1.2.1.2.2.1.2.index.
+*/
+func IsSymbolic(oid string) bool {
+	return !numericArcRe.MatchString(oid)
+}
+
+// Object is a named node of the OID tree, eg: an OBJECT-TYPE.
+type Object struct {
+	Module string
+	Name   string
+	OID    string
+	// Syntax of an OBJECT-TYPE, eg: "Counter64" or "DisplayString". Empty for other nodes.
+	Syntax string
+}
+
+func (o *Object) String() string {
+	return fmt.Sprintf("%v::%v", o.Module, o.Name)
+}
+
+// definition is an OID assignment before resolution, eg: ifTable ::= { interfaces 2 }.
+type definition struct {
+	module string
+	name   string
+	parent string // Empty if the OID is fully numeric.
+	subIDs []int
+	syntax string
+}
+
+type module struct {
+	name        string
+	imports     map[string]string // Imported name -> module.
+	definitions map[string]*definition
+	types       map[string]string // Textual convention or type -> its underlying syntax.
+}
+
+// MIB is a set of loaded MIB modules. It is safe for concurrent use, eg: by the resolvers of several targets.
+type MIB struct {
+	mu       sync.Mutex // Guards modules, and resolved, which lookups fill in.
+	modules  map[string]*module
+	resolved map[*definition]string
+}
+
+// builtinModule is where the predefined roots live.
+const builtinModule = "SNMPv2-SMI"
+
+var builtins = []struct {
+	name string
+	oid  string
+}{
+	{"ccitt", "0"},
+	{"iso", "1"},
+	{"joint-iso-ccitt", "2"},
+	{"org", "1.3"},
+	{"dod", "1.3.6"},
+	{"internet", "1.3.6.1"},
+	{"directory", "1.3.6.1.1"},
+	{"mgmt", "1.3.6.1.2"},
+	{"mib-2", "1.3.6.1.2.1"},
+	{"transmission", "1.3.6.1.2.1.10"},
+	{"experimental", "1.3.6.1.3"},
+	{"private", "1.3.6.1.4"},
+	{"enterprises", "1.3.6.1.4.1"},
+	{"security", "1.3.6.1.5"},
+	{"snmpV2", "1.3.6.1.6"},
+	{"snmpDomains", "1.3.6.1.6.1"},
+	{"snmpProxys", "1.3.6.1.6.2"},
+	{"snmpModules", "1.3.6.1.6.3"},
+	{"zeroDotZero", "0.0"},
+}
+
+// New returns a MIB containing only the predefined roots.
+func New() *MIB {
+	m := &MIB{modules: map[string]*module{}, resolved: map[*definition]string{}}
+	smi := &module{name: builtinModule, imports: map[string]string{}, definitions: map[string]*definition{}, types: map[string]string{}}
+	for _, b := range builtins {
+		var subIDs []int
+		for _, s := range strings.Split(b.oid, ".") {
+			n, _ := strconv.Atoi(s)
+			subIDs = append(subIDs, n)
+		}
+		smi.definitions[b.name] = &definition{module: builtinModule, name: b.name, subIDs: subIDs}
+	}
+	m.modules[builtinModule] = smi
+	return m
+}
+
+// LoadDir parses every file in the given directory as a MIB module. Subdirectories are ignored.
+func (m *MIB) LoadDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read MIB directory: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if err := m.LoadFile(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFile parses the MIB modules in the given file.
+func (m *MIB) LoadFile(file string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not open MIB file: %v", err)
+	}
+	if err := m.Parse(string(src)); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+	return nil
+}
+
+// Parse parses the MIB modules in the given source. Loading a module again replaces it.
+func (m *MIB) Parse(src string) error {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return err
+	}
+	p := &parser{tokens: tokens}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for !p.done() {
+		mod, err := p.module()
+		if err != nil {
+			return err
+		}
+		if mod.name == builtinModule {
+			// Keep the predefined roots, which SNMPv2-SMI itself defines in terms of each other.
+			for name, d := range m.modules[builtinModule].definitions {
+				if _, ok := mod.definitions[name]; !ok {
+					mod.definitions[name] = d
+				}
+			}
+		}
+		m.modules[mod.name] = mod
+	}
+	m.resolved = map[*definition]string{}
+	return nil
+}
+
+/*
+Lookup returns the object with the given name, which may be qualified by its module, eg:
+"IF-MIB::ifDescr" or "ifDescr". Unqualified names must be unique among the loaded modules.
+*/
+func (m *MIB) Lookup(name string) (*Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.find(name)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := m.resolve(d, map[*definition]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Module: d.module, Name: d.name, OID: oid, Syntax: d.syntax}, nil
+}
+
+/*
+Resolve returns the numeric form of an OID which starts with an object name, eg: "IF-MIB::ifDescr.2" ->
+"1.3.6.1.2.1.2.2.1.2.2". Any suffix (eg: an instance, or a placeholder such as ".index") is kept.
+OIDs which are not symbolic are returned unchanged.
+*/
+func (m *MIB) Resolve(oid string) (string, error) {
+	if !IsSymbolic(oid) {
+		return oid, nil
+	}
+	name, suffix := oid, ""
+	if i := strings.Index(oid, "::"); i >= 0 {
+		if j := strings.Index(oid[i:], "."); j >= 0 {
+			name, suffix = oid[:i+j], oid[i+j:]
+		}
+	} else if j := strings.Index(oid, "."); j >= 0 {
+		name, suffix = oid[:j], oid[j:]
+	}
+	if suffix == "." || strings.Contains(suffix, "..") {
+		return "", fmt.Errorf("invalid suffix %q in OID %q", suffix, oid)
+	}
+	object, err := m.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return object.OID + suffix, nil
+}
+
+func (m *MIB) find(name string) (*definition, error) {
+	if i := strings.Index(name, "::"); i >= 0 {
+		moduleName, objectName := name[:i], name[i+2:]
+		mod, ok := m.modules[moduleName]
+		if !ok {
+			return nil, fmt.Errorf("MIB module %q is not loaded", moduleName)
+		}
+		d, ok := mod.definitions[objectName]
+		if !ok {
+			return nil, fmt.Errorf("MIB module %q does not define %q", moduleName, objectName)
+		}
+		return d, nil
+	}
+	var found []*definition
+	for _, mod := range m.modules {
+		if d, ok := mod.definitions[name]; ok {
+			found = append(found, d)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no loaded MIB module defines %q", name)
+	case 1:
+		return found[0], nil
+	default:
+		var modules []string
+		for _, d := range found {
+			modules = append(modules, d.module)
+		}
+		sort.Strings(modules)
+		return nil, fmt.Errorf("%q is defined by more than one module (%v); qualify it, eg: %v::%v",
+			name, strings.Join(modules, ", "), modules[0], name)
+	}
+}
+
+// parentOf finds the definition a module refers to by the given name.
+func (m *MIB) parentOf(mod *module, name string) (*definition, error) {
+	if d, ok := mod.definitions[name]; ok {
+		return d, nil
+	}
+	if from, ok := mod.imports[name]; ok {
+		if imported, ok := m.modules[from]; ok {
+			if d, ok := imported.definitions[name]; ok {
+				return d, nil
+			}
+		}
+	}
+	if d, ok := m.modules[builtinModule].definitions[name]; ok {
+		return d, nil
+	}
+	return m.find(name)
+}
+
+func (m *MIB) resolve(d *definition, visiting map[*definition]bool) (string, error) {
+	if oid, ok := m.resolved[d]; ok {
+		return oid, nil
+	}
+	if visiting[d] {
+		return "", fmt.Errorf("circular OID definition of %v::%v", d.module, d.name)
+	}
+	visiting[d] = true
+	var parts []string
+	if d.parent != "" {
+		parent, err := m.parentOf(m.modules[d.module], d.parent)
+		if err != nil {
+			return "", fmt.Errorf("could not resolve parent of %v::%v: %v", d.module, d.name, err)
+		}
+		oid, err := m.resolve(parent, visiting)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, oid)
+	}
+	for _, subID := range d.subIDs {
+		parts = append(parts, strconv.Itoa(subID))
+	}
+	oid := strings.Join(parts, ".")
+	m.resolved[d] = oid
+	return oid, nil
+}
+
+/*
+ResolveTransformations replaces symbolic OIDs in the NocPaths of the given transformations with their
+numeric forms.
+*/
+func (m *MIB) ResolveTransformations(transformations *pb.Transformations) error {
+	for _, transformation := range transformations.GetTransformations() {
+		for _, nocPath := range transformation.GetNocPaths() {
+			for i, oid := range nocPath.GetOids() {
+				resolved, err := m.Resolve(oid)
+				if err != nil {
+					return fmt.Errorf("could not resolve OID of NocPath %q: %v", nocPath.GetBind(), err)
+				}
+				nocPath.Oids[i] = resolved
+			}
+		}
+	}
+	return nil
+}
+
+// NocPath returns a NocPath for the named object, with its numeric OID and data type.
+func (m *MIB) NocPath(name, bind string) (*pb.NocPath, error) {
+	object, err := m.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.NocPath{
+		Bind:     bind,
+		Oids:     []string{object.OID},
+		DataType: m.DataType(object),
+	}, nil
+}
+
+// baseTypes maps SMI base types and common textual conventions to data types.
+var baseTypes = map[string]pb.DataType{
+	"INTEGER":             pb.DataType_INT,
+	"Integer32":           pb.DataType_INT,
+	"Unsigned32":          pb.DataType_UINT,
+	"Gauge32":             pb.DataType_UINT,
+	"Gauge":               pb.DataType_UINT,
+	"Counter32":           pb.DataType_UINT,
+	"Counter":             pb.DataType_UINT,
+	"Counter64":           pb.DataType_UINT,
+	"TimeTicks":           pb.DataType_UINT,
+	"OCTET":               pb.DataType_STRING,
+	"DisplayString":       pb.DataType_STRING,
+	"SnmpAdminString":     pb.DataType_STRING,
+	"OBJECT":              pb.DataType_STRING, // OBJECT IDENTIFIER.
+	"BITS":                pb.DataType_STRING,
+	"IpAddress":           pb.DataType_STRING,
+	"PhysAddress":         pb.DataType_STRING,
+	"MacAddress":          pb.DataType_STRING,
+	"Opaque":              pb.DataType_STRING,
+	"TruthValue":          pb.DataType_INT,
+	"DateAndTime":         pb.DataType_STRING,
+	"TimeStamp":           pb.DataType_UINT,
+	"InterfaceIndex":      pb.DataType_INT,
+	"CounterBasedGauge64": pb.DataType_UINT,
+}
+
+// DataType returns the data type of an object, following textual conventions to their base types.
+func (m *MIB) DataType(object *Object) pb.DataType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	syntax := object.Syntax
+	for i := 0; i < 10 && syntax != ""; i++ { // Bound the number of textual conventions followed.
+		if t, ok := baseTypes[syntax]; ok {
+			return t
+		}
+		next := ""
+		for _, mod := range m.modules {
+			if s, ok := mod.types[syntax]; ok {
+				next = s
+				break
+			}
+		}
+		syntax = next
+	}
+	return pb.DataType_UNDEFINED
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mib
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+const mibDir = "../testdata/mibs"
+
+func loadTestMIBs(t *testing.T) *MIB {
+	m := New()
+	if err := m.LoadDir(mibDir); err != nil {
+		t.Fatalf("LoadDir(%q) got error: %v", mibDir, err)
+	}
+	return m
+}
+
+func TestResolve(t *testing.T) {
+	m := loadTestMIBs(t)
+	for _, test := range []struct {
+		oid           string
+		expected      string
+		expectedError bool
+	}{
+		{oid: "1.3.6.1.2.1.1.3", expected: "1.3.6.1.2.1.1.3"},
+		{oid: "1.3.6.1.2.1.2.2.1.2.index", expected: "1.3.6.1.2.1.2.2.1.2.index"},
+		{oid: "sysUpTime", expected: "1.3.6.1.2.1.1.3"},
+		{oid: "SNMPv2-MIB::sysUpTime", expected: "1.3.6.1.2.1.1.3"},
+		{oid: "SNMPv2-MIB::sysUpTime.0", expected: "1.3.6.1.2.1.1.3.0"},
+		{oid: "IF-MIB::ifDescr", expected: "1.3.6.1.2.1.2.2.1.2"},
+		{oid: "IF-MIB::ifHCInOctets", expected: "1.3.6.1.2.1.31.1.1.1.6"},
+		{oid: "ifHCInOctets.12", expected: "1.3.6.1.2.1.31.1.1.1.6.12"},
+		{oid: "IF-MIB::linkDown", expected: "1.3.6.1.6.3.1.1.5.3"},
+		{oid: "enterprises", expected: "1.3.6.1.4.1"},
+		{oid: "IF-MIB::sysUpTime", expectedError: true},
+		{oid: "NO-SUCH-MIB::sysUpTime", expectedError: true},
+		{oid: "ifUnknown", expectedError: true},
+		{oid: "ifDescr.interface_index", expected: "1.3.6.1.2.1.2.2.1.2.interface_index"},
+		{oid: "ifDescr..1", expectedError: true},
+	} {
+		t.Run(test.oid, func(t *testing.T) {
+			got, err := m.Resolve(test.oid)
+			if err != nil && !test.expectedError {
+				t.Fatalf("Resolve(%q) got error: %v", test.oid, err)
+			}
+			if err == nil && test.expectedError {
+				t.Fatalf("Resolve(%q) = %q, expected error", test.oid, got)
+			}
+			if got != test.expected {
+				t.Errorf("Resolve(%q) = %q, expected %q", test.oid, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestLookupAmbiguous(t *testing.T) {
+	m := loadTestMIBs(t)
+	if err := m.Parse(`OTHER-MIB DEFINITIONS ::= BEGIN
+ifDescr OBJECT IDENTIFIER ::= { enterprises 9 1 }
+END`); err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if object, err := m.Lookup("ifDescr"); err == nil {
+		t.Errorf("Lookup(%q) = %v, expected error", "ifDescr", object)
+	}
+	object, err := m.Lookup("OTHER-MIB::ifDescr")
+	if err != nil {
+		t.Fatalf("Lookup(%q) got error: %v", "OTHER-MIB::ifDescr", err)
+	}
+	if object.OID != "1.3.6.1.4.1.9.1" {
+		t.Errorf("Lookup(%q).OID = %q, expected %q", "OTHER-MIB::ifDescr", object.OID, "1.3.6.1.4.1.9.1")
+	}
+}
+
+func TestLookupCircular(t *testing.T) {
+	m := New()
+	if err := m.Parse(`LOOP-MIB DEFINITIONS ::= BEGIN
+a OBJECT IDENTIFIER ::= { b 1 }
+b OBJECT IDENTIFIER ::= { a 1 }
+END`); err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if object, err := m.Lookup("a"); err == nil {
+		t.Errorf("Lookup(%q) = %v, expected error", "a", object)
+	}
+}
+
+func TestNocPath(t *testing.T) {
+	m := loadTestMIBs(t)
+	for _, test := range []struct {
+		name     string
+		expected *pb.NocPath
+	}{
+		{
+			name:     "IF-MIB::ifHCInOctets",
+			expected: &pb.NocPath{Bind: "in_octets", Oids: []string{"1.3.6.1.2.1.31.1.1.1.6"}, DataType: pb.DataType_UINT},
+		},
+		{
+			name:     "ifDescr",
+			expected: &pb.NocPath{Bind: "in_octets", Oids: []string{"1.3.6.1.2.1.2.2.1.2"}, DataType: pb.DataType_STRING},
+		},
+		{
+			// InterfaceIndex is a textual convention for Integer32.
+			name:     "ifIndex",
+			expected: &pb.NocPath{Bind: "in_octets", Oids: []string{"1.3.6.1.2.1.2.2.1.1"}, DataType: pb.DataType_INT},
+		},
+		{
+			name:     "ifTable",
+			expected: &pb.NocPath{Bind: "in_octets", Oids: []string{"1.3.6.1.2.1.2.2"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := m.NocPath(test.name, "in_octets")
+			if err != nil {
+				t.Fatalf("NocPath(%q) got error: %v", test.name, err)
+			}
+			if !proto.Equal(got, test.expected) {
+				t.Errorf("NocPath(%q) = %v, expected %v", test.name, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestResolveTransformations(t *testing.T) {
+	m := loadTestMIBs(t)
+	transformations := &pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind: "in_octets",
+				NocPaths: []*pb.NocPath{
+					{Bind: "octets", Oids: []string{"IF-MIB::ifHCInOctets", "1.3.6.1.2.1.2.2.1.10"}},
+				},
+			},
+		},
+	}
+	if err := m.ResolveTransformations(transformations); err != nil {
+		t.Fatalf("ResolveTransformations() got error: %v", err)
+	}
+	expected := []string{"1.3.6.1.2.1.31.1.1.1.6", "1.3.6.1.2.1.2.2.1.10"}
+	got := transformations.GetTransformations()[0].GetNocPaths()[0].GetOids()
+	if len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Errorf("ResolveTransformations() set OIDs %v, expected %v", got, expected)
+	}
+
+	transformations.Transformations[0].NocPaths[0].Oids = []string{"IF-MIB::ifUnknown"}
+	if err := m.ResolveTransformations(transformations); err == nil {
+		t.Errorf("ResolveTransformations() with unknown object succeeded, expected error")
+	}
+}
+
+func TestIsSymbolic(t *testing.T) {
+	for oid, expected := range map[string]bool{
+		"1.3.6.1":               false,
+		".1.3.6.1":              false,
+		"1":                     false,
+		"1.3.6.1.2.1.1.3.index": false,
+		"IF-MIB::ifDescr":       true,
+		"ifDescr.1":             true,
+		"ifDescr":               true,
+	} {
+		if got := IsSymbolic(oid); got != expected {
+			t.Errorf("IsSymbolic(%q) = %v, expected %v", oid, got, expected)
+		}
+	}
+}
+
+func TestLookupConcurrently(t *testing.T) {
+	m := loadTestMIBs(t)
+	var wg sync.WaitGroup
+	for _, name := range []string{"IF-MIB::ifDescr", "IF-MIB::ifHCInOctets", "sysUpTime", "IF-MIB::linkDown"} {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if _, err := m.Lookup(name); err != nil {
+					t.Errorf("Lookup(%q) got error: %v", name, err)
+				}
+			}(name)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mib
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// macros whose invocations assign OIDs, eg: ifDescr OBJECT-TYPE ... ::= { ifEntry 2 }.
+var macros = map[string]bool{
+	"OBJECT-TYPE":        true,
+	"MODULE-IDENTITY":    true,
+	"OBJECT-IDENTITY":    true,
+	"NOTIFICATION-TYPE":  true,
+	"OBJECT-GROUP":       true,
+	"NOTIFICATION-GROUP": true,
+	"MODULE-COMPLIANCE":  true,
+	"AGENT-CAPABILITIES": true,
+	"TRAP-TYPE":          true, // SMIv1.
+}
+
+// parser parses a sequence of MIB modules.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// peek returns the text of the token n places ahead, or "" past the end.
+func (p *parser) peek(n int) string {
+	if p.pos+n >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos+n].text
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 0
+	if len(p.tokens) > 0 {
+		line = p.tokens[min(p.pos, len(p.tokens)-1)].line
+	}
+	return fmt.Errorf("line %d: %v", line, fmt.Sprintf(format, args...))
+}
+
+// skipTo advances past the next occurrence of the given token.
+func (p *parser) skipTo(text string) error {
+	for ; !p.done(); p.pos++ {
+		if p.peek(0) == text {
+			p.pos++
+			return nil
+		}
+	}
+	return p.errorf("expected %q", text)
+}
+
+// module parses a module: NAME DEFINITIONS ::= BEGIN ... END.
+func (p *parser) module() (*module, error) {
+	mod := &module{
+		name:        p.peek(0),
+		imports:     map[string]string{},
+		definitions: map[string]*definition{},
+		types:       map[string]string{},
+	}
+	if err := p.skipTo("BEGIN"); err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.done():
+			return nil, p.errorf("module %v has no END", mod.name)
+		case p.peek(0) == "END":
+			p.pos++
+			return mod, nil
+		case p.peek(0) == "IMPORTS":
+			if err := p.imports(mod); err != nil {
+				return nil, err
+			}
+		case p.peek(0) == "EXPORTS":
+			if err := p.skipTo(";"); err != nil {
+				return nil, err
+			}
+		case p.peek(1) == "MACRO":
+			if err := p.skipTo("END"); err != nil {
+				return nil, err
+			}
+		case p.peek(1) == "::=":
+			p.typeAssignment(mod)
+		default:
+			if err := p.valueAssignment(mod); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// imports parses IMPORTS a, b FROM MODULE-A c FROM MODULE-B ;
+func (p *parser) imports(mod *module) error {
+	p.pos++
+	var names []string
+	for ; !p.done(); p.pos++ {
+		switch text := p.peek(0); text {
+		case ";":
+			p.pos++
+			return nil
+		case ",":
+		case "FROM":
+			p.pos++
+			for _, name := range names {
+				mod.imports[name] = p.peek(0)
+			}
+			names = nil
+		default:
+			names = append(names, text)
+		}
+	}
+	return p.errorf("unterminated IMPORTS in module %v", mod.name)
+}
+
+/*
+typeAssignment parses a type assignment, eg: DisplayString ::= TEXTUAL-CONVENTION ... SYNTAX OCTET
+STRING, recording its underlying syntax.
+*/
+func (p *parser) typeAssignment(mod *module) {
+	name := p.peek(0)
+	p.pos += 2
+	if p.peek(0) == "TEXTUAL-CONVENTION" {
+		for depth := 0; !p.done() && !p.startsAssignment(depth); p.pos++ {
+			depth += nesting(p.peek(0))
+			if depth == 0 && p.peek(0) == "SYNTAX" && mod.types[name] == "" {
+				mod.types[name] = p.peek(1)
+			}
+		}
+		return
+	}
+	// Skip tags, eg: Counter32 ::= [APPLICATION 1] IMPLICIT INTEGER (0..4294967295).
+	if p.peek(0) == "[" {
+		p.skipTo("]")
+	}
+	if p.peek(0) == "IMPLICIT" {
+		p.pos++
+	}
+	mod.types[name] = p.peek(0)
+	for depth := 0; !p.done() && !p.startsAssignment(depth); p.pos++ {
+		depth += nesting(p.peek(0))
+	}
+}
+
+// startsAssignment reports whether the current token starts an assignment or ends the module.
+func (p *parser) startsAssignment(depth int) bool {
+	if depth != 0 {
+		return false
+	}
+	next := p.peek(1)
+	return p.peek(0) == "END" || next == "::=" || next == "MACRO" || macros[next] ||
+		(next == "OBJECT" && p.peek(2) == "IDENTIFIER" && p.peek(3) == "::=")
+}
+
+// nesting returns the change in nesting depth caused by a token.
+func nesting(text string) int {
+	switch text {
+	case "{", "(":
+		return 1
+	case "}", ")":
+		return -1
+	}
+	return 0
+}
+
+/*
+valueAssignment parses a value assignment, eg: ifDescr OBJECT-TYPE SYNTAX DisplayString ... ::= {
+ifEntry 2 }, recording OID definitions.
+*/
+func (p *parser) valueAssignment(mod *module) error {
+	d := &definition{module: mod.name, name: p.peek(0)}
+	kind := p.peek(1)
+	enterprise := ""
+	p.pos++
+	for depth := 0; p.peek(0) != "::=" || depth != 0; p.pos++ {
+		if p.done() || (depth == 0 && p.peek(0) == "END") {
+			return p.errorf("expected ::= in definition of %v", d.name)
+		}
+		depth += nesting(p.peek(0))
+		if depth == 0 && kind == "OBJECT-TYPE" && p.peek(0) == "SYNTAX" && d.syntax == "" {
+			d.syntax = p.peek(1)
+		}
+		if depth == 0 && kind == "TRAP-TYPE" && p.peek(0) == "ENTERPRISE" {
+			enterprise = p.peek(1)
+		}
+	}
+	p.pos++
+	if kind == "TRAP-TYPE" {
+		// SMIv1 traps are numbered beneath their enterprise, eg: enterprise.0.n (RFC 3584).
+		n, err := strconv.Atoi(p.peek(0))
+		if err != nil {
+			return p.errorf("invalid trap number %q for %v", p.peek(0), d.name)
+		}
+		p.pos++
+		d.parent, d.subIDs = enterprise, []int{0, n}
+		mod.definitions[d.name] = d
+		return nil
+	}
+	if p.peek(0) != "{" {
+		// A value of some other type, eg: maxValue INTEGER ::= 42.
+		p.pos++
+		return nil
+	}
+	if err := p.oidValue(d); err != nil {
+		return err
+	}
+	mod.definitions[d.name] = d
+	return nil
+}
+
+// oidValue parses an OID value, eg: { ifEntry 2 } or { iso(1) org(3) dod(6) }.
+func (p *parser) oidValue(d *definition) error {
+	p.pos++
+	for first := true; p.peek(0) != "}"; first = false {
+		if p.done() {
+			return p.errorf("unterminated OID value for %v", d.name)
+		}
+		text := p.peek(0)
+		p.pos++
+		if n, err := strconv.Atoi(text); err == nil {
+			d.subIDs = append(d.subIDs, n)
+			continue
+		}
+		if p.peek(0) == "(" {
+			n, err := strconv.Atoi(p.peek(1))
+			if err != nil || p.peek(2) != ")" {
+				return p.errorf("invalid OID component %v%v%v%v for %v", text, p.peek(0), p.peek(1), p.peek(2), d.name)
+			}
+			p.pos += 3
+			if !first {
+				d.subIDs = append(d.subIDs, n)
+				continue
+			}
+		}
+		if !first {
+			return p.errorf("unexpected OID component %q for %v", text, d.name)
+		}
+		d.parent = text
+	}
+	p.pos++
+	if d.parent == "" && len(d.subIDs) == 0 {
+		return p.errorf("empty OID value for %v", d.name)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		src             string
+		expectedOids    map[string]string // Name -> OID.
+		expectedSyntax  map[string]string // Name -> syntax.
+		expectedImports map[string]string
+		expectsError    bool
+	}{
+		{
+			name: "object identifiers",
+			src: `TEST-MIB DEFINITIONS ::= BEGIN
+a OBJECT IDENTIFIER ::= { enterprises 42 }
+b OBJECT IDENTIFIER ::= { a 1 2 }
+c OBJECT IDENTIFIER ::= { iso(1) org(3) dod(6) }
+d OBJECT IDENTIFIER ::= { 1 3 6 1 }
+END`,
+			expectedOids: map[string]string{"a": "1.3.6.1.4.1.42", "b": "1.3.6.1.4.1.42.1.2", "c": "1.3.6", "d": "1.3.6.1"},
+		},
+		{
+			name: "macros and comments are skipped",
+			src: `TEST-MIB DEFINITIONS ::= BEGIN
+OBJECT-TYPE MACRO ::=
+BEGIN
+    TYPE NOTATION ::= "SYNTAX" Syntax
+    VALUE NOTATION ::= value(VALUE ObjectName)
+END
+-- a OBJECT IDENTIFIER ::= { enterprises 1 }
+a -- inline -- OBJECT-TYPE
+    SYNTAX  INTEGER { up(1), down(2) }
+    MAX-ACCESS read-only
+    STATUS current
+    DESCRIPTION "A -- string with ::= { tricky 1 } content"
+    ::= { enterprises 2 }
+END`,
+			expectedOids:   map[string]string{"a": "1.3.6.1.4.1.2"},
+			expectedSyntax: map[string]string{"a": "INTEGER"},
+		},
+		{
+			name: "imports",
+			src: `TEST-MIB DEFINITIONS ::= BEGIN
+IMPORTS
+    OBJECT-TYPE, enterprises FROM SNMPv2-SMI
+    DisplayString FROM SNMPv2-TC;
+END`,
+			expectedImports: map[string]string{"OBJECT-TYPE": "SNMPv2-SMI", "enterprises": "SNMPv2-SMI", "DisplayString": "SNMPv2-TC"},
+		},
+		{
+			name: "SMIv1 traps",
+			src: `TEST-MIB DEFINITIONS ::= BEGIN
+acme OBJECT IDENTIFIER ::= { enterprises 99 }
+fanFailure TRAP-TYPE
+    ENTERPRISE acme
+    VARIABLES { fanIndex }
+    DESCRIPTION "A fan failed."
+    ::= 4
+END`,
+			expectedOids: map[string]string{"fanFailure": "1.3.6.1.4.1.99.0.4"},
+		},
+		{
+			name: "non-OID values are ignored",
+			src: `TEST-MIB DEFINITIONS ::= BEGIN
+maxValue INTEGER ::= 42
+a OBJECT IDENTIFIER ::= { enterprises 1 }
+END`,
+			expectedOids: map[string]string{"a": "1.3.6.1.4.1.1"},
+		},
+		{
+			name: "multiple modules",
+			src: `A-MIB DEFINITIONS ::= BEGIN
+a OBJECT IDENTIFIER ::= { enterprises 1 }
+END
+B-MIB DEFINITIONS ::= BEGIN
+IMPORTS a FROM A-MIB;
+b OBJECT IDENTIFIER ::= { a 2 }
+END`,
+			expectedOids: map[string]string{"A-MIB::a": "1.3.6.1.4.1.1", "B-MIB::b": "1.3.6.1.4.1.1.2"},
+		},
+		{
+			name:         "missing END",
+			src:          `TEST-MIB DEFINITIONS ::= BEGIN a OBJECT IDENTIFIER ::= { enterprises 1 }`,
+			expectsError: true,
+		},
+		{
+			name:         "missing assignment",
+			src:          `TEST-MIB DEFINITIONS ::= BEGIN a OBJECT-TYPE SYNTAX Integer32 END`,
+			expectsError: true,
+		},
+		{
+			name:         "invalid OID component",
+			src:          `TEST-MIB DEFINITIONS ::= BEGIN a OBJECT IDENTIFIER ::= { enterprises b(x) } END`,
+			expectsError: true,
+		},
+		{
+			name:         "unterminated string",
+			src:          `TEST-MIB DEFINITIONS ::= BEGIN a OBJECT-TYPE DESCRIPTION "oops ::= { enterprises 1 } END`,
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := New()
+			err := m.Parse(test.src)
+			if err != nil && !test.expectsError {
+				t.Fatalf("Parse() got error: %v", err)
+			}
+			if err == nil && test.expectsError {
+				t.Fatalf("Parse() succeeded, expected error")
+			}
+			for name, expected := range test.expectedOids {
+				object, err := m.Lookup(name)
+				if err != nil {
+					t.Errorf("Lookup(%q) got error: %v", name, err)
+				} else if object.OID != expected {
+					t.Errorf("Lookup(%q).OID = %q, expected %q", name, object.OID, expected)
+				}
+			}
+			for name, expected := range test.expectedSyntax {
+				object, err := m.Lookup(name)
+				if err != nil {
+					t.Errorf("Lookup(%q) got error: %v", name, err)
+				} else if object.Syntax != expected {
+					t.Errorf("Lookup(%q).Syntax = %q, expected %q", name, object.Syntax, expected)
+				}
+			}
+			if test.expectedImports != nil {
+				got := m.modules["TEST-MIB"].imports
+				if !reflect.DeepEqual(got, test.expectedImports) {
+					t.Errorf("Parse() imports = %v, expected %v", got, test.expectedImports)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	src := "a ::= { b(1) 2 } -- comment\n\"multi\nline\" '0F'H 1..2 -- x -- c"
+	expected := []token{
+		{"a", 1}, {"::=", 1}, {"{", 1}, {"b", 1}, {"(", 1}, {"1", 1}, {")", 1}, {"2", 1}, {"}", 1},
+		{"\"multi\nline\"", 2}, {"'0F'H", 3}, {"1", 3}, {"..", 3}, {"2", 3}, {"c", 3},
+	}
+	got, err := tokenize(src)
+	if err != nil {
+		t.Fatalf("tokenize() got error: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("tokenize() = %v, expected %v", got, expected)
+	}
+}
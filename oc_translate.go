@@ -21,10 +21,39 @@ does not natively support OpenConfig.
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof" // Registers profiling handlers on http.DefaultServeMux, served by -pprof_addr.
+	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"flag"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/functions"
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/health"
+	"github.com/google/orismologer/httpapi"
+	"github.com/google/orismologer/importer"
+	"github.com/google/orismologer/lint"
+	"github.com/google/orismologer/mib"
+	"github.com/google/orismologer/octree"
+	"github.com/google/orismologer/oparse"
 	"github.com/google/orismologer/orismologer"
+	"github.com/google/orismologer/profiles/arista"
+	"github.com/google/orismologer/refactor"
+	"github.com/google/orismologer/rpcserver"
+	"github.com/google/orismologer/utils"
+	"github.com/google/orismologer/yanggen"
+	"github.com/openconfig/goyang/pkg/yang"
+	"google.golang.org/grpc"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
 )
 
 const (
@@ -34,9 +63,24 @@ const (
 )
 
 var (
+	mibDirFlag = flag.String("mib_dir", "", "a directory of MIB modules used to resolve symbolic OIDs "+
+		"(eg: IF-MIB::ifHCInOctets) in the config")
+	pluginDirFlag = flag.String("plugin_dir", "", "a directory of Go plugins (.so files) whose functions are "+
+		"added to those available to expressions (see functions.Library.WithPlugins)")
+	templateDirFlag = flag.String("template_dir", "", "a directory of TextFSM templates (.textfsm files) with "+
+		"which the textfsm function parses CLI output (see functions.Library.WithTemplates)")
+	schemaModulesFlag = flag.String("yang_modules", "", "comma-separated OpenConfig YANG modules (file or module "+
+		"names) against which the mapped paths are checked when the config is loaded")
+	schemaPathFlag = flag.String("yang_path", "", "comma-separated directories to search for the -yang_modules "+
+		"and their imports")
+	profilesFlag = flag.String("profiles", "", "comma-separated vendor profiles to include in the config, of: "+
+		strings.Join(profileNames(), ", ")+" (none if empty)")
+
 	printCommand = flag.NewFlagSet("print", flag.ExitOnError)
 	rootFlag     = printCommand.String("root", "root", "print the subtree rooted "+
 		"at the given node")
+	formatFlag = printCommand.String("format", "", "print the tree as json, yaml or dot (for Graphviz), with "+
+		"the transformations nodes are bound to, rather than as ASCII art")
 
 	getCommand = flag.NewFlagSet("get", flag.ExitOnError)
 	ocPathFlag = getCommand.String("path", "", "the OpenConfig path to resolve")
@@ -44,23 +88,242 @@ var (
 		"the OpenConfig path should be resolved")
 	vendorFlag = getCommand.String("vendor", "", "the vendor of the hardware "+
 		"target")
+	remoteFlag = getCommand.String("remote", "", "the address of an Orismologer service to "+
+		"resolve the path with, instead of the local config")
+	namespaceFlag = getCommand.String("namespace", "", "the config namespace to use on the remote service")
+
+	manifestCommand = flag.NewFlagSet("manifest", flag.ExitOnError)
+
+	describeCommand    = flag.NewFlagSet("describe", flag.ExitOnError)
+	describePathFlag   = describeCommand.String("path", "", "the OpenConfig leaf to describe")
+	describeVendorFlag = describeCommand.String("vendor", "", "mark NocPaths unsupported for this vendor (or model)")
+	describeTargetFlag = describeCommand.String("target", "", "the hardware target to evaluate the leaf for (with -live)")
+	liveFlag           = describeCommand.Bool("live", false, "evaluate the leaf, and print a trace of each step")
+	jsonFlag           = describeCommand.Bool("json", false, "print the trace as JSON (with -live)")
+
+	findCommand = flag.NewFlagSet("find", flag.ExitOnError)
+	patternFlag = findCommand.String("pattern", "", "a regular expression (eg: a substring, such as cpu) matching the OpenConfig paths to print")
+
+	oidCommand = flag.NewFlagSet("oid", flag.ExitOnError)
+	oidFlag    = oidCommand.String("oid", "", "the OID (of a NocPath, an instance or a table) to find the OpenConfig leaves derived from")
+
+	lintCommand = flag.NewFlagSet("lint", flag.ExitOnError)
+
+	functionsCommand = flag.NewFlagSet("functions", flag.ExitOnError)
+	functionNameFlag = functionsCommand.String("name", "", "the function to describe (all functions if empty)")
+
+	serveCommand  = flag.NewFlagSet("serve", flag.ExitOnError)
+	gnmiAddrFlag  = serveCommand.String("gnmi_addr", ":9339", "the address on which to serve gNMI")
+	inventoryFlag = serveCommand.String("inventory", "", "a text proto file containing an Inventory of targets")
+	httpAddrFlag  = serveCommand.String("http_addr", "", "the address on which to serve the HTTP API (disabled if empty)")
+	httpTokenFlag = serveCommand.String("http_token", "", "a bearer token (or secret reference, eg: "+
+		"secret:env:ORISMOLOGER_TOKEN) required by the HTTP API (no authentication if empty)")
+	pprofAddrFlag = serveCommand.String("pprof_addr", "", "the address on which to serve pprof profiles, eg: "+
+		"localhost:6060 (disabled if empty)")
+	healthIntervalFlag = serveCommand.Duration("health_interval", 0, "how often to check that targets are reachable "+
+		"(by SNMP get of sysUpTime); statuses are served at /v1/health by the HTTP API (disabled if zero)")
+	maxStringLengthFlag = serveCommand.Int("max_string_length", oparse.DefaultLimits.MaxStringLength, "the maximum length of a string "+
+		"produced by concatenation in an expression (unlimited if zero)")
+	maxCallsFlag = serveCommand.Int("max_function_calls", oparse.DefaultLimits.MaxCalls, "the maximum number of function calls made "+
+		"by an expression (unlimited if zero)")
+	expressionTimeoutFlag = serveCommand.Duration("expression_timeout", oparse.DefaultLimits.Timeout, "the maximum time taken to "+
+		"evaluate an expression (unlimited if zero)")
+	integerArithmeticFlag = serveCommand.Bool("integer_arithmetic", false, "whether to keep integer arithmetic in expressions "+
+		"exact (eg: for 64-bit counters), rather than representing every number as a float")
+	bigArithmeticFlag = serveCommand.Bool("big_arithmetic", false, "whether to evaluate expressions with arbitrary "+
+		"precision, so that no intermediate result overflows or loses precision (overrides -integer_arithmetic)")
+	numberFormatFlag = serveCommand.String("number_format", "%v", "how numbers concatenated with strings in expressions are "+
+		"formatted: %v, or %f, %e or %g with an optional precision (eg: %.2f; without one, as many digits as needed)")
+
+	mibCommand = flag.NewFlagSet("mib", flag.ExitOnError)
+	objectFlag = mibCommand.String("object", "", "the MIB object to generate a NocPath for, eg: IF-MIB::ifHCInOctets")
+	bindFlag   = mibCommand.String("bind", "", "the identifier to bind the generated NocPath to")
+
+	yangCommand   = flag.NewFlagSet("yang", flag.ExitOnError)
+	yangPathFlag  = yangCommand.String("path", "", "comma-separated directories to search for YANG modules and their imports")
+	modulesFlag   = yangCommand.String("modules", "", "comma-separated YANG modules (file or module names) to generate mappings for")
+	stateOnlyFlag = yangCommand.Bool("state_only", false, "omit configuration leaves")
+	yangOutFlag   = yangCommand.String("out", "", "where to write the generated Mappings text proto (stdout if empty)")
+
+	importCommand          = flag.NewFlagSet("import", flag.ExitOnError)
+	csvFlag                = importCommand.String("csv", "", "the CSV file to import")
+	mappingsOutFlag        = importCommand.String("mappings_out", "", "where to write the imported Mappings text proto")
+	transformationsOutFlag = importCommand.String("transformations_out", "", "where to write the imported Transformations text proto")
+
+	refactorCommand     = flag.NewFlagSet("refactor", flag.ExitOnError)
+	refactorFilesFlag   = refactorCommand.String("files", mappingsFile+","+transformationsFile, "comma-separated Mappings and Transformations text protos to rewrite")
+	renameVariablesFlag = refactorCommand.String("rename_variable", "", "comma-separated renames of bindings and references to them, eg: old=new")
+	renameFunctionsFlag = refactorCommand.String("rename_function", "", "comma-separated renames of functions called by expressions, eg: old=new")
+	wrapVariablesFlag   = refactorCommand.String("wrap_variable", "", "comma-separated variables to wrap in function calls, eg: up_time=to_int")
+	dryRunFlag          = refactorCommand.Bool("dry_run", false, "print the changes without writing them")
 )
 
 func printUsage() {
 	fmt.Println(`usage: orismologer <command> [<args>])
 	 print    Print an ASCII representation of the tree of OpenConfig nodes which Orismologer can resolve.
-	 get      Resolve an OpenConfig path for a given hardware target.`)
+	 get      Resolve an OpenConfig path for a given hardware target.
+	 find     Print the OpenConfig paths which match a regular expression, eg: those containing cpu.
+	 manifest Print the files, checksums and size of the loaded configuration.
+	 describe Print the transformations, expressions and NocPaths an OpenConfig leaf is evaluated with.
+	 oid      Print the OpenConfig leaves derived from an OID.
+	 serve    Serve OpenConfig paths for the targets in an inventory over gNMI, and the Orismologer gRPC service.
+	 lint     Check the mappings and transformations for likely mistakes. Exits with status 1 on errors.
+	 functions Print the signatures and descriptions of the functions available to expressions.
+	 import   Convert a CSV file (oc_path, oid, expression, vendor) to Mappings and Transformations text protos.
+	 refactor Rename bindings or functions, or wrap variables in function calls, across Mappings and Transformations files.
+	 yang     Generate a Mappings skeleton (every container, list and leaf) from OpenConfig YANG modules.
+	 mib      Print a NocPath text proto for a MIB object, resolved with the MIBs in -mib_dir.`)
+}
+
+// vendorProfiles are the vendor profiles which can be included with -profiles, keyed by vendor.
+var vendorProfiles = map[string]func(){
+	arista.Vendor: arista.Register,
+}
+
+// profileNames returns the vendors of the profiles which can be included with -profiles, sorted.
+func profileNames() []string {
+	var names []string
+	for name := range vendorProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerProfiles registers the vendor profiles named in a comma-separated list (see -profiles).
+func registerProfiles(names string) error {
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		register, ok := vendorProfiles[name]
+		if !ok {
+			return fmt.Errorf("unknown vendor profile %q; expected one of: %v", name, strings.Join(profileNames(), ", "))
+		}
+		register()
+	}
+	return nil
 }
 
 func main() {
 	flag.Usage = printUsage
 	flag.Parse()
+	if err := registerProfiles(*profilesFlag); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	o, err := orismologer.NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile)
+	if flag.Arg(0) == "import" {
+		importCommand.Parse(flag.Args()[1:])
+		if err := importCSV(*csvFlag, *mappingsOutFlag, *transformationsOutFlag); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "refactor" {
+		refactorCommand.Parse(flag.Args()[1:])
+		if err := refactorConfig(*refactorFilesFlag, *renameVariablesFlag, *renameFunctionsFlag, *wrapVariablesFlag, *dryRunFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var mibs *mib.MIB
+	if *mibDirFlag != "" {
+		mibs = mib.New()
+		if err := mibs.LoadDir(*mibDirFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if flag.Arg(0) == "mib" {
+		mibCommand.Parse(flag.Args()[1:])
+		nocPath, err := mibNocPath(mibs, *objectFlag, *bindFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(proto.MarshalTextString(nocPath))
+		return
+	}
+
+	var schema []*yang.Entry
+	if *schemaModulesFlag != "" {
+		var err error
+		if schema, err = loadYang(*schemaPathFlag, *schemaModulesFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if flag.Arg(0) == "yang" {
+		yangCommand.Parse(flag.Args()[1:])
+		if err := generateMappings(*yangPathFlag, *modulesFlag, *yangOutFlag, *stateOnlyFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "lint" {
+		lintCommand.Parse(flag.Args()[1:])
+		ok, err := lintConfig(mappingsFile, transformationsFile, mibs, schema, *pluginDirFlag, *templateDirFlag)
+		if err != nil {
+			fmt.Println(err)
+		}
+		if err != nil || !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "functions" {
+		functionsCommand.Parse(flag.Args()[1:])
+		if err := printFunctions(transformationsFile, *pluginDirFlag, *templateDirFlag, *functionNameFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "get" {
+		getCommand.Parse(flag.Args()[1:])
+		if *remoteFlag != "" {
+			result, err := remoteEval(*remoteFlag, *namespaceFlag, *ocPathFlag, *targetFlag, *vendorFlag)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(result)
+			return
+		}
+	}
+
+	o, err := orismologer.NewOrismologerWithMIBs(mappingsFile, transformationsFile, vendorOidsFile, mibs)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
+	if schema != nil {
+		if err := o.ValidateSchema(schema); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if *pluginDirFlag != "" || *templateDirFlag != "" {
+		library, err := functionLibrary(*pluginDirFlag, *templateDirFlag)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := o.SetFunctions(library); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
 	if len(flag.Args()) == 0 {
 		fmt.Println("Provide a command")
@@ -73,13 +336,83 @@ func main() {
 		printCommand.Parse(flag.Args()[1:])
 	case "get":
 		getCommand.Parse(flag.Args()[1:])
+	case "manifest":
+		manifestCommand.Parse(flag.Args()[1:])
+	case "describe":
+		describeCommand.Parse(flag.Args()[1:])
+	case "find":
+		findCommand.Parse(flag.Args()[1:])
+	case "oid":
+		oidCommand.Parse(flag.Args()[1:])
+	case "serve":
+		serveCommand.Parse(flag.Args()[1:])
 	default:
 		fmt.Printf("Unknown command %q\n", flag.Arg(0))
 		printUsage()
 	}
 
 	if printCommand.Parsed() {
-		o.PrintOcPaths(*rootFlag)
+		if *formatFlag == "" {
+			o.PrintOcPaths(*rootFlag)
+		} else {
+			exported, err := o.ExportOcPaths(*rootFlag, *formatFlag)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println(string(exported))
+		}
+	}
+
+	if serveCommand.Parsed() {
+		o.SetLimits(oparse.Limits{MaxStringLength: *maxStringLengthFlag, MaxCalls: *maxCallsFlag, Timeout: *expressionTimeoutFlag})
+		switch {
+		case *bigArithmeticFlag:
+			o.SetArithmetic(oparse.BigArithmetic)
+		case *integerArithmeticFlag:
+			o.SetArithmetic(oparse.IntegerArithmetic)
+		}
+		numberFormat, err := oparse.ParseNumberFormat(*numberFormatFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		o.SetNumberFormat(numberFormat)
+		if err := serve(o, *inventoryFlag, *gnmiAddrFlag, *httpAddrFlag, *httpTokenFlag, *pprofAddrFlag, *healthIntervalFlag); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	if manifestCommand.Parsed() {
+		fmt.Println(o.Manifest())
+	}
+
+	if findCommand.Parsed() {
+		paths, err := o.FindOcPaths(*patternFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+	}
+
+	if oidCommand.Parsed() {
+		if *oidFlag == "" {
+			fmt.Println("supply an OID")
+			os.Exit(1)
+		}
+		for _, path := range o.PathsForOid(*oidFlag) {
+			fmt.Println(path)
+		}
+	}
+
+	if describeCommand.Parsed() {
+		if err := describe(o, *describePathFlag, *describeTargetFlag, *describeVendorFlag, *liveFlag, *jsonFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 
 	if getCommand.Parsed() {
@@ -109,3 +442,325 @@ func main() {
 		}
 	}
 }
+
+/*
+describe prints how an OpenConfig leaf is evaluated. If live is set, the leaf is evaluated for the
+given target and a trace of the evaluation is printed, as JSON if asJSON is set.
+*/
+func describe(o *orismologer.Orismologer, ocPath, target, vendor string, live, asJSON bool) error {
+	if ocPath == "" {
+		return fmt.Errorf("supply an OpenConfig path")
+	}
+	if !live {
+		description, err := o.Describe(ocPath, vendor)
+		if err != nil {
+			return err
+		}
+		fmt.Print(description)
+		return nil
+	}
+	if target == "" || vendor == "" {
+		return fmt.Errorf("supply a hardware target and its vendor")
+	}
+	// The trace describes failures, so evaluation errors are not returned.
+	_, trace, _ := o.EvalWithTrace(ocPath, target, vendor)
+	if !asJSON {
+		fmt.Print(trace)
+		return nil
+	}
+	b, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// importCSV converts a CSV file to Mappings and Transformations text protos, for the vendors of the VendorOids.
+func importCSV(csvFile, mappingsOut, transformationsOut string) error {
+	if csvFile == "" || mappingsOut == "" || transformationsOut == "" {
+		return fmt.Errorf("supply -csv, -mappings_out and -transformations_out")
+	}
+	f, err := os.Open(csvFile)
+	if err != nil {
+		return fmt.Errorf("could not open CSV file: %v", err)
+	}
+	defer f.Close()
+	vendorInfo, err := utils.LoadVendorOids(vendorOidsFile)
+	if err != nil {
+		return err
+	}
+	mappings, transformations, err := importer.ImportCSV(f, vendorInfo)
+	if err != nil {
+		return err
+	}
+	if err := utils.SaveTextProto(mappingsOut, mappings); err != nil {
+		return err
+	}
+	return utils.SaveTextProto(transformationsOut, transformations)
+}
+
+/*
+refactorConfig applies rewrites, each given as comma-separated old=new pairs, to the comma-separated
+files, printing each change.
+*/
+func refactorConfig(files, renameVariables, renameFunctions, wrapVariables string, dryRun bool) error {
+	r := refactor.Refactoring{}
+	for _, rewrite := range []struct {
+		flag  string
+		value string
+		pairs *map[string]string
+	}{
+		{flag: "-rename_variable", value: renameVariables, pairs: &r.RenameVariables},
+		{flag: "-rename_function", value: renameFunctions, pairs: &r.RenameFunctions},
+		{flag: "-wrap_variable", value: wrapVariables, pairs: &r.WrapVariables},
+	} {
+		pairs, err := parsePairs(rewrite.value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %v", rewrite.flag, err)
+		}
+		*rewrite.pairs = pairs
+	}
+	changes, err := r.ApplyFiles(strings.Split(files, ","), dryRun)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	return err
+}
+
+// parsePairs parses comma-separated key=value pairs.
+func parsePairs(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	if s == "" {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not of the form key=value", pair)
+		}
+		if _, ok := pairs[parts[0]]; ok {
+			return nil, fmt.Errorf("%q is given more than once", parts[0])
+		}
+		pairs[parts[0]] = parts[1]
+	}
+	return pairs, nil
+}
+
+// loadYang loads the given comma-separated YANG modules, searching the comma-separated directories of yangPath.
+func loadYang(yangPath, modules string) ([]*yang.Entry, error) {
+	var paths []string
+	if yangPath != "" {
+		paths = strings.Split(yangPath, ",")
+	}
+	return yanggen.Load(paths, strings.Split(modules, ","))
+}
+
+// generateMappings writes a Mappings skeleton for the given comma-separated YANG modules.
+func generateMappings(yangPath, modules, out string, stateOnly bool) error {
+	if modules == "" {
+		return fmt.Errorf("supply YANG modules with -modules")
+	}
+	entries, err := loadYang(yangPath, modules)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("could not create %q: %v", out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return yanggen.Write(w, entries, yanggen.Options{StateOnly: stateOnly})
+}
+
+// mibNocPath returns a NocPath for the given MIB object, for pasting into a Transformations text proto.
+func mibNocPath(mibs *mib.MIB, object, bind string) (*pb.NocPath, error) {
+	if mibs == nil {
+		return nil, fmt.Errorf("supply a directory of MIB modules with -mib_dir")
+	}
+	if object == "" {
+		return nil, fmt.Errorf("supply a MIB object")
+	}
+	if bind == "" {
+		// Default to the object's name, eg: IF-MIB::ifHCInOctets -> ifHCInOctets.
+		bind = object[strings.LastIndex(object, ":")+1:]
+	}
+	return mibs.NocPath(object, bind)
+}
+
+/*
+lintConfig prints lint findings for the given files, returning false if any are errors. Symbolic OIDs
+are resolved first if mibs is not nil, so that duplicates are found regardless of how OIDs are written.
+*/
+func lintConfig(mappingsFile, transformationsFile string, mibs *mib.MIB, schema []*yang.Entry, pluginDir, templateDir string) (bool, error) {
+	mappings, err := utils.LoadMappings(mappingsFile)
+	if err != nil {
+		return false, err
+	}
+	transformations, err := utils.LoadTransformations(transformationsFile)
+	if err != nil {
+		return false, err
+	}
+	if mibs != nil {
+		if err := mibs.ResolveTransformations(transformations); err != nil {
+			return false, err
+		}
+	}
+	library, err := functionLibrary(pluginDir, templateDir)
+	if err != nil {
+		return false, err
+	}
+	if library, err = library.WithScripts(transformations.GetScripts()...); err != nil {
+		return false, err
+	}
+	findings := lint.Lint(mappings, transformations, library)
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	if schema != nil {
+		tree, err := octree.NewTreeWithSchema(mappings, schema)
+		if err != nil {
+			return false, err
+		}
+		if err := tree.ValidateTypes(schema, lint.Kinds(transformations, library)); err != nil {
+			return false, err
+		}
+	}
+	return !lint.HasErrors(findings), nil
+}
+
+/*
+printFunctions prints help on each function available to the expressions of the given transformations
+file (see functions.Library.Describe), or only on the named function if name is not empty.
+*/
+func printFunctions(transformationsFile, pluginDir, templateDir, name string) error {
+	transformations, err := utils.LoadTransformations(transformationsFile)
+	if err != nil {
+		return err
+	}
+	library, err := functionLibrary(pluginDir, templateDir)
+	if err != nil {
+		return err
+	}
+	if library, err = library.WithScripts(transformations.GetScripts()...); err != nil {
+		return err
+	}
+	names := library.List()
+	if name != "" {
+		names = []string{name}
+	}
+	for _, name := range names {
+		help, err := library.Describe(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(help)
+	}
+	return nil
+}
+
+/*
+functionLibrary returns the functions available to expressions, with those of any plugins in pluginDir,
+and the templates in templateDir.
+*/
+func functionLibrary(pluginDir, templateDir string) (functions.Library, error) {
+	library := orismologer.Functions()
+	var err error
+	if pluginDir != "" {
+		if library, err = library.WithPlugins(pluginDir); err != nil {
+			return functions.Library{}, err
+		}
+	}
+	if templateDir != "" {
+		if library, err = library.WithTemplates(templateDir); err != nil {
+			return functions.Library{}, err
+		}
+	}
+	return library, nil
+}
+
+/*
+serve serves gNMI and Orismologer service requests for the targets in the given inventory file, and
+optionally the HTTP API, pprof profiles and health checks of the targets, until an error occurs.
+*/
+func serve(o *orismologer.Orismologer, inventoryFile, gnmiAddr, httpAddr, httpToken, pprofAddr string, healthInterval time.Duration) error {
+	if inventoryFile == "" {
+		return fmt.Errorf("supply an inventory of targets")
+	}
+	inventory, err := utils.LoadInventory(inventoryFile, utils.DefaultSecrets())
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", gnmiAddr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %v: %v", gnmiAddr, err)
+	}
+	namespaces := orismologer.NewNamespaces()
+	namespaces.Set(orismologer.DefaultNamespace, o)
+	server := grpc.NewServer()
+	gpb.RegisterGNMIServer(server, gnmiserver.NewServer(namespaces.Namespace(orismologer.DefaultNamespace), inventory))
+	pb.RegisterOrismologerServer(server, rpcserver.NewServer(namespaces))
+	errs := make(chan error, 4)
+	var checker *health.Checker
+	if healthInterval > 0 {
+		checker = &health.Checker{
+			Inventory: inventory,
+			Probers:   []health.Prober{&health.SNMPProber{Retries: 1}},
+			Interval:  healthInterval,
+		}
+		go func() {
+			errs <- checker.Run(context.Background())
+		}()
+	}
+	if pprofAddr != "" {
+		go func() {
+			errs <- http.ListenAndServe(pprofAddr, nil)
+		}()
+	}
+	if httpAddr != "" {
+		var auth httpapi.AuthFunc
+		if httpToken != "" {
+			token, err := utils.DefaultSecrets().Resolve(httpToken)
+			if err != nil {
+				return err
+			}
+			auth = httpapi.BearerToken(token)
+		}
+		api := httpapi.NewServer(namespaces, auth)
+		if checker != nil {
+			api.Handle("/v1/health", checker)
+		}
+		go func() {
+			errs <- http.ListenAndServe(httpAddr, api)
+		}()
+	}
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	return <-errs
+}
+
+// remoteEval resolves an OpenConfig path with the Orismologer service at the given address.
+func remoteEval(addr, namespace, ocPath, target, vendor string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %v: %v", addr, err)
+	}
+	defer conn.Close()
+	resp, err := pb.NewOrismologerClient(conn).Eval(ctx, &pb.EvalRequest{
+		Namespace: namespace,
+		Path:      ocPath,
+		Target:    target,
+		Vendor:    vendor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rpcserver.FromValue(resp.GetValue()), nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package octree
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Code to export an OcTree, eg: for tools and UIs which display mappings but do not parse text protos.
+
+/*
+Node is an exported node of an OcTree (see Export), with the fields of its payload, if it has one.
+Nodes which are only structure (eg: "/grandmother/aunt" of a subpath "aunt/cousin") have just a name,
+a path and children.
+*/
+type Node struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path"`                // In "/parent/child" form.
+	Bind      string            `json:"bind,omitempty"`      // The transformation the node is bound to.
+	Revisions []string          `json:"revisions,omitempty"` // The OpenConfig revisions the node is valid for.
+	Map       map[string]string `json:"map,omitempty"`       // Path keys -> the variables they are bound to.
+	Children  []*Node           `json:"children,omitempty"`
+}
+
+// Export returns the subtree rooted at the given node, with children in the order they were defined.
+func (t *OcTree) Export(root string) (*Node, error) {
+	node, err := normalizePath(root)
+	if err != nil {
+		return nil, err
+	}
+	if !t.IsValid(node) {
+		return nil, fmt.Errorf("no such node in tree: %q", root)
+	}
+	return t.export(node), nil
+}
+
+func (t *OcTree) export(node string) *Node {
+	path := strings.TrimPrefix(node, RootName)
+	if path == "" {
+		path = pathSep
+	}
+	exported := &Node{Name: node[strings.LastIndex(node, pathSep)+1:], Path: path}
+	if payload, ok := t.payloads[node]; ok {
+		exported.Bind = payload.GetBind()
+		exported.Revisions = payload.GetSubpath().GetRevisions()
+		if len(payload.GetMap()) > 0 {
+			exported.Map = payload.GetMap()
+		}
+	}
+	for _, child := range t.graph.Neighbors(node) {
+		exported.Children = append(exported.Children, t.export(child))
+	}
+	return exported
+}
+
+// ToJSON returns the subtree rooted at the given node (see Export) as indented JSON.
+func (t *OcTree) ToJSON(root string) ([]byte, error) {
+	node, err := t.Export(root)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(node, "", "  ")
+}
+
+/*
+ToYAML returns the subtree rooted at the given node (see Export) as YAML, with the same fields as
+ToJSON. Strings are double quoted, so that values such as "1.0" or "no" are not read as numbers or
+bools.
+*/
+func (t *OcTree) ToYAML(root string) ([]byte, error) {
+	node, err := t.Export(root)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(yamlLines(node), "\n") + "\n"), nil
+}
+
+// yamlLines returns the lines of a node as a YAML mapping, unindented.
+func yamlLines(node *Node) []string {
+	lines := []string{
+		"name: " + yamlString(node.Name),
+		"path: " + yamlString(node.Path),
+	}
+	if node.Bind != "" {
+		lines = append(lines, "bind: "+yamlString(node.Bind))
+	}
+	if len(node.Revisions) > 0 {
+		lines = append(lines, "revisions:")
+		for _, revision := range node.Revisions {
+			lines = append(lines, "  - "+yamlString(revision))
+		}
+	}
+	if len(node.Map) > 0 {
+		lines = append(lines, "map:")
+		keys := make([]string, 0, len(node.Map))
+		for key := range node.Map {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			lines = append(lines, "  "+yamlString(key)+": "+yamlString(node.Map[key]))
+		}
+	}
+	if len(node.Children) > 0 {
+		lines = append(lines, "children:")
+		for _, child := range node.Children {
+			for i, line := range yamlLines(child) {
+				if i == 0 {
+					lines = append(lines, "  - "+line)
+				} else {
+					lines = append(lines, "    "+line)
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// yamlString quotes a string for YAML. JSON strings are valid YAML double quoted scalars.
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+/*
+ToDot renders the subtree rooted at the given node in the dot format of Graphviz, for visual review of
+which paths are covered by transformations, eg: `dot -Tsvg`. Nodes are identified by their paths and
+labelled with their names. Nodes bound to transformations are boxes, labelled with their binds too.
+Nodes which have no children but are not bound to transformations (ie: which cannot be resolved) are
+dashed and red.
+*/
+func (t *OcTree) ToDot(root string) (string, error) {
+	node, err := t.Export(root)
+	if err != nil {
+		return "", err
+	}
+	nodes := []string{"digraph {"}
+	var edges []string
+	var render func(node *Node)
+	render = func(node *Node) {
+		switch {
+		case node.Bind != "":
+			nodes = append(nodes, fmt.Sprintf("\t%q [label=%q, shape=box]", node.Path, node.Name+"\n"+node.Bind))
+		case len(node.Children) == 0:
+			nodes = append(nodes, fmt.Sprintf("\t%q [label=%q, style=dashed, color=red]", node.Path, node.Name))
+		default:
+			nodes = append(nodes, fmt.Sprintf("\t%q [label=%q]", node.Path, node.Name))
+		}
+		for _, child := range node.Children {
+			edges = append(edges, fmt.Sprintf("\t%q -> %q", node.Path, child.Path))
+			render(child)
+		}
+	}
+	render(node)
+	lines := append(append(nodes, edges...), "}")
+	return strings.Join(lines, "\n"), nil
+}
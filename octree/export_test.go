@@ -0,0 +1,208 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package octree
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func makeExportTree(t *testing.T) OcTree {
+	tree, err := NewTree(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{
+				Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface[name=if_name]"},
+				Map:     map[string]string{"name": "if_name"},
+				Children: []*pb.OpenConfigNode{
+					{
+						Subpath: &pb.OpenConfigPath{Path: "state/counters/in-octets", Revisions: []string{"1.0", "2.0"}},
+						Bind:    "in_octets",
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	return tree
+}
+
+func TestExport(t *testing.T) {
+	tree := makeExportTree(t)
+	inOctets := &Node{
+		Name:      "in-octets",
+		Path:      "/interfaces/interface[name=if_name]/state/counters/in-octets",
+		Bind:      "in_octets",
+		Revisions: []string{"1.0", "2.0"},
+	}
+	interfaceNode := &Node{
+		Name: "interface[name=if_name]",
+		Path: "/interfaces/interface[name=if_name]",
+		Map:  map[string]string{"name": "if_name"},
+		Children: []*Node{{
+			Name: "state",
+			Path: "/interfaces/interface[name=if_name]/state",
+			Children: []*Node{{
+				Name:     "counters",
+				Path:     "/interfaces/interface[name=if_name]/state/counters",
+				Children: []*Node{inOctets},
+			}},
+		}},
+	}
+	tests := []struct {
+		root          string
+		expected      *Node
+		expectedError bool
+	}{
+		{
+			root: "/",
+			expected: &Node{
+				Name: "root",
+				Path: "/",
+				Children: []*Node{{
+					Name:     "interfaces",
+					Path:     "/interfaces",
+					Children: []*Node{interfaceNode},
+				}},
+			},
+		},
+		{root: "/interfaces/interface[name=if_name]", expected: interfaceNode},
+		{root: "root/interfaces/interface[name=if_name]/state/counters/in-octets", expected: inOctets},
+		{root: "/interfaces/subinterface", expectedError: true},
+		{root: "//", expectedError: true},
+	}
+	for _, test := range tests {
+		got, err := tree.Export(test.root)
+		switch {
+		case err != nil && !test.expectedError:
+			t.Errorf("Export(%q) got error: %v", test.root, err)
+		case err == nil && test.expectedError:
+			t.Errorf("Export(%q) = %v, expected an error", test.root, got)
+		case err == nil:
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("Export(%q) returned unexpected nodes (-expected +got):\n%v", test.root, diff)
+			}
+		}
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	tree := makeExportTree(t)
+	got, err := tree.ToJSON("/interfaces/interface[name=if_name]/state")
+	if err != nil {
+		t.Fatalf("ToJSON() got error: %v", err)
+	}
+	expected := `{
+  "name": "state",
+  "path": "/interfaces/interface[name=if_name]/state",
+  "children": [
+    {
+      "name": "counters",
+      "path": "/interfaces/interface[name=if_name]/state/counters",
+      "children": [
+        {
+          "name": "in-octets",
+          "path": "/interfaces/interface[name=if_name]/state/counters/in-octets",
+          "bind": "in_octets",
+          "revisions": [
+            "1.0",
+            "2.0"
+          ]
+        }
+      ]
+    }
+  ]
+}`
+	if diff := cmp.Diff(expected, string(got)); diff != "" {
+		t.Errorf("ToJSON() returned unexpected JSON (-expected +got):\n%v", diff)
+	}
+	if _, err := tree.ToJSON("/missing"); err == nil {
+		t.Errorf("ToJSON() of a missing node got no error")
+	}
+}
+
+func TestToYAML(t *testing.T) {
+	tree := makeExportTree(t)
+	got, err := tree.ToYAML("/interfaces")
+	if err != nil {
+		t.Fatalf("ToYAML() got error: %v", err)
+	}
+	expected := `name: "interfaces"
+path: "/interfaces"
+children:
+  - name: "interface[name=if_name]"
+    path: "/interfaces/interface[name=if_name]"
+    map:
+      "name": "if_name"
+    children:
+      - name: "state"
+        path: "/interfaces/interface[name=if_name]/state"
+        children:
+          - name: "counters"
+            path: "/interfaces/interface[name=if_name]/state/counters"
+            children:
+              - name: "in-octets"
+                path: "/interfaces/interface[name=if_name]/state/counters/in-octets"
+                bind: "in_octets"
+                revisions:
+                  - "1.0"
+                  - "2.0"
+`
+	if diff := cmp.Diff(expected, string(got)); diff != "" {
+		t.Errorf("ToYAML() returned unexpected YAML (-expected +got):\n%v", diff)
+	}
+	if _, err := tree.ToYAML("/missing"); err == nil {
+		t.Errorf("ToYAML() of a missing node got no error")
+	}
+}
+
+func TestToDot(t *testing.T) {
+	tree := makeTree(t)
+	got, err := tree.ToDot("/")
+	if err != nil {
+		t.Fatalf("ToDot() got error: %v", err)
+	}
+	expected := `digraph {
+	"/" [label="root"]
+	"/paternal_grandfather" [label="paternal_grandfather"]
+	"/paternal_grandfather/father" [label="father"]
+	"/paternal_grandfather/father/child" [label="child", style=dashed, color=red]
+	"/paternal_grandfather/father/sibling" [label="sibling", style=dashed, color=red]
+	"/paternal_grandfather/paternal_aunt" [label="paternal_aunt", style=dashed, color=red]
+	"/grandmother" [label="grandmother"]
+	"/grandmother/aunt" [label="aunt"]
+	"/grandmother/aunt/cousin" [label="cousin\ncousin_t", shape=box]
+	"/" -> "/paternal_grandfather"
+	"/paternal_grandfather" -> "/paternal_grandfather/father"
+	"/paternal_grandfather/father" -> "/paternal_grandfather/father/child"
+	"/paternal_grandfather/father" -> "/paternal_grandfather/father/sibling"
+	"/paternal_grandfather" -> "/paternal_grandfather/paternal_aunt"
+	"/" -> "/grandmother"
+	"/grandmother" -> "/grandmother/aunt"
+	"/grandmother/aunt" -> "/grandmother/aunt/cousin"
+}`
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("ToDot() returned unexpected output (-expected +got):\n%v", diff)
+	}
+	if _, err := tree.ToDot("/missing"); err == nil {
+		t.Errorf("ToDot() of a missing node got no error")
+	}
+}
@@ -18,8 +18,10 @@ limitations under the License.
 package octree
 
 import (
+	"errors"
 	"fmt"
 	pb "github.com/google/orismologer/proto_out/proto"
+	"regexp"
 	"strings"
 )
 
@@ -37,6 +39,7 @@ The underlying representation is a graph (adjacency list), with a map of node pa
 type OcTree struct {
 	graph    *AdjList
 	payloads map[string]*pb.OpenConfigNode
+	oids     map[string][]string // OID -> the leaves derived from it (see IndexOids).
 }
 
 // NewTree creates and populates an OcTree from a Mappings proto.
@@ -154,6 +157,140 @@ func (t *OcTree) GetTransformationIdentifier(path string) (string, error) {
 	return payload.GetBind(), nil
 }
 
+// Revisions returns the OpenConfig revisions for which the given node is declared to be valid.
+func (t *OcTree) Revisions(path string) ([]string, error) {
+	node, err := normalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := t.getPayload(node)
+	if err != nil {
+		return nil, err
+	}
+	return payload.GetSubpath().GetRevisions(), nil
+}
+
+/*
+KeyVariables returns the NocPath variables which the variables of the keys of the given node and its
+ancestors are mapped to (see the map field of OpenConfigNode), keyed by the variables of the keys,
+eg: "name_value" -> "interface_index" for /interfaces/interface[name=name_value]/state/mtu.
+*/
+func (t *OcTree) KeyVariables(path string) (map[string]string, error) {
+	node, err := normalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if !t.IsValid(node) {
+		return nil, fmt.Errorf("no such node in tree: %q", path)
+	}
+	variables := map[string]string{}
+	for {
+		for key, variable := range t.payloads[node].GetMap() {
+			if _, ok := variables[key]; !ok { // Nearer nodes take precedence.
+				variables[key] = variable
+			}
+		}
+		i := strings.LastIndex(node, pathSep)
+		if i < 0 {
+			return variables, nil
+		}
+		node = node[:i]
+	}
+}
+
+/*
+SkipSubtree may be returned by a WalkFunc to skip the descendants of the node it was called for. It is
+not returned by Walk.
+*/
+var SkipSubtree = errors.New("skip this subtree")
+
+/*
+WalkFunc is called by Walk for each node, with its path (in "/parent/child" form) and its payload, which
+is nil for nodes which are only structure (eg: "/grandmother/aunt" of a subpath "aunt/cousin").
+*/
+type WalkFunc func(path string, payload *pb.OpenConfigNode) error
+
+/*
+Walk calls fn for each node in the subtree rooted at the given node, including the root itself. Nodes
+are visited depth-first, parents before their children and children in the order they were defined. If
+fn returns SkipSubtree, the node's descendants are skipped; if it returns any other error, the walk
+stops and Walk returns the error.
+*/
+func (t *OcTree) Walk(root string, fn WalkFunc) error {
+	node, err := normalizePath(root)
+	if err != nil {
+		return err
+	}
+	if !t.IsValid(node) {
+		return fmt.Errorf("no such node in tree: %q", root)
+	}
+	if err := t.walk(node, fn); err != SkipSubtree {
+		return err
+	}
+	return nil
+}
+
+func (t *OcTree) walk(node string, fn WalkFunc) error {
+	path := strings.TrimPrefix(node, RootName)
+	if path == "" {
+		path = pathSep
+	}
+	if err := fn(path, t.payloads[node]); err != nil {
+		return err
+	}
+	for _, child := range t.graph.Neighbors(node) {
+		if err := t.walk(child, fn); err != nil && err != SkipSubtree {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Leaves returns the paths (in "/parent/child" form) of the nodes in the subtree rooted at the given
+node which are bound to a transformation, including the root itself. Paths are ordered depth-first,
+in the order nodes were defined.
+*/
+func (t *OcTree) Leaves(root string) ([]string, error) {
+	node, err := normalizePath(root)
+	if err != nil {
+		return nil, err
+	}
+	if !t.IsValid(node) {
+		return nil, fmt.Errorf("no such node in tree: %q", root)
+	}
+	var leaves []string
+	err = t.Walk(node, func(path string, payload *pb.OpenConfigNode) error {
+		if payload.GetBind() != "" {
+			leaves = append(leaves, path)
+		}
+		return nil
+	})
+	return leaves, err
+}
+
+/*
+Find returns the paths (in "/parent/child" form) of the nodes whose paths match the given regular
+expression, eg: "cpu" for every node with "cpu" in its path, or "/state/[^/]*octets$" for counters of
+octets. Metacharacters of paths (eg: "[" of keys) must be escaped to be matched literally (see
+regexp.QuoteMeta). Paths are ordered depth-first, in the order nodes were defined; the root is not
+matched.
+*/
+func (t *OcTree) Find(pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	var found []string
+	err = t.Walk(RootName, func(path string, payload *pb.OpenConfigNode) error {
+		if path != pathSep && re.MatchString(path) {
+			found = append(found, path)
+		}
+		return nil
+	})
+	return found, err
+}
+
 // Print pretty prints a subtree rooted at the given node.
 func (t *OcTree) Print(root string) error {
 	if !t.IsValid(root) {
@@ -17,12 +17,15 @@ limitations under the License.
 package octree
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
 )
 
 func TestTreeBuildsMultiSegmentSubpathsCorrectly(t *testing.T) {
@@ -303,6 +306,254 @@ func TestGetTransformationIdentifier(t *testing.T) {
 	}
 }
 
+func TestLeaves(t *testing.T) {
+	tree := makeTree(t)
+	for _, test := range []struct {
+		root          string
+		expected      []string
+		expectedError bool
+	}{
+		{
+			root:     "/",
+			expected: []string{"/grandmother/aunt/cousin"},
+		},
+		{
+			root:     "/grandmother/aunt",
+			expected: []string{"/grandmother/aunt/cousin"},
+		},
+		{
+			root:     "root/grandmother/aunt/cousin",
+			expected: []string{"/grandmother/aunt/cousin"},
+		},
+		{
+			root: "/paternal_grandfather",
+		},
+		{
+			root:          "/invalid",
+			expectedError: true,
+		},
+	} {
+		t.Run(test.root, func(t *testing.T) {
+			got, err := tree.Leaves(test.root)
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("Leaves(%q): expected %v, got error: %v", test.root, test.expected, err)
+			case test.expectedError && err == nil:
+				t.Errorf("Leaves(%q): expected error, got %v", test.root, got)
+			case !cmp.Equal(got, test.expected):
+				t.Errorf("Leaves(%q): expected %v, got %v", test.root, test.expected, got)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	tree := makeTree(t)
+	for _, test := range []struct {
+		pattern       string
+		expected      []string
+		expectedError bool
+	}{
+		{
+			pattern:  "aunt",
+			expected: []string{"/paternal_grandfather/paternal_aunt", "/grandmother/aunt", "/grandmother/aunt/cousin"},
+		},
+		{
+			pattern:  "^/grandmother/[^/]+$",
+			expected: []string{"/grandmother/aunt"},
+		},
+		{
+			pattern:  "(?i)FATHER/",
+			expected: []string{"/paternal_grandfather/father", "/paternal_grandfather/father/child", "/paternal_grandfather/father/sibling", "/paternal_grandfather/paternal_aunt"},
+		},
+		{
+			pattern: "uncle",
+		},
+		{
+			pattern:       "[",
+			expectedError: true,
+		},
+	} {
+		t.Run(test.pattern, func(t *testing.T) {
+			got, err := tree.Find(test.pattern)
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("Find(%q): expected %v, got error: %v", test.pattern, test.expected, err)
+			case test.expectedError && err == nil:
+				t.Errorf("Find(%q): expected error, got %v", test.pattern, got)
+			case !cmp.Equal(got, test.expected):
+				t.Errorf("Find(%q): expected %v, got %v", test.pattern, test.expected, got)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tree := makeTree(t)
+	stop := errors.New("stop")
+	for _, test := range []struct {
+		name          string
+		root          string
+		result        map[string]error // The results of fn for the given paths, otherwise nil.
+		expected      []string         // The paths visited, marked with "*" if they have payloads.
+		expectedError error
+	}{
+		{
+			name: "all nodes",
+			root: "/",
+			expected: []string{
+				"/",
+				"/paternal_grandfather*",
+				"/paternal_grandfather/father*",
+				"/paternal_grandfather/father/child*",
+				"/paternal_grandfather/father/sibling*",
+				"/paternal_grandfather/paternal_aunt*",
+				"/grandmother*",
+				"/grandmother/aunt",
+				"/grandmother/aunt/cousin*",
+			},
+		},
+		{
+			name:     "subtree",
+			root:     "root/grandmother/aunt",
+			expected: []string{"/grandmother/aunt", "/grandmother/aunt/cousin*"},
+		},
+		{
+			name:     "skip subtree",
+			root:     "/",
+			result:   map[string]error{"/paternal_grandfather/father": SkipSubtree, "/grandmother/aunt/cousin": SkipSubtree},
+			expected: []string{"/", "/paternal_grandfather*", "/paternal_grandfather/father*", "/paternal_grandfather/paternal_aunt*", "/grandmother*", "/grandmother/aunt", "/grandmother/aunt/cousin*"},
+		},
+		{
+			name:     "skip root",
+			root:     "/grandmother",
+			result:   map[string]error{"/grandmother": SkipSubtree},
+			expected: []string{"/grandmother*"},
+		},
+		{
+			name:          "stop",
+			root:          "/",
+			result:        map[string]error{"/paternal_grandfather/father/child": stop},
+			expected:      []string{"/", "/paternal_grandfather*", "/paternal_grandfather/father*", "/paternal_grandfather/father/child*"},
+			expectedError: stop,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			err := tree.Walk(test.root, func(path string, payload *pb.OpenConfigNode) error {
+				if payload != nil {
+					got = append(got, path+"*")
+				} else {
+					got = append(got, path)
+				}
+				return test.result[path]
+			})
+			if err != test.expectedError {
+				t.Errorf("Walk(%q) returned error %v, expected %v", test.root, err, test.expectedError)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("Walk(%q) visited unexpected paths (-expected +got):\n%v", test.root, diff)
+			}
+		})
+	}
+	if err := tree.Walk("/invalid", func(string, *pb.OpenConfigNode) error { return nil }); err == nil {
+		t.Errorf("Walk(\"/invalid\") got no error")
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	tree := makeTree(t)
+	if got, err := tree.Revisions("/grandmother/aunt/cousin"); err != nil || len(got) != 0 {
+		t.Errorf("Revisions() = %v, %v, expected no revisions", got, err)
+	}
+	if got, err := tree.Revisions("/invalid"); err == nil {
+		t.Errorf("Revisions(\"/invalid\") = %v, expected error", got)
+	}
+}
+
+func TestKeyVariables(t *testing.T) {
+	tree, err := NewTree(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{
+				Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface[name=name_value]"},
+				Map:     map[string]string{"name_value": "interface_index"},
+				Children: []*pb.OpenConfigNode{
+					{
+						Subpath: &pb.OpenConfigPath{Path: "subinterfaces/subinterface[index=sub_value]"},
+						Map:     map[string]string{"sub_value": "sub_index"},
+						Children: []*pb.OpenConfigNode{
+							{Subpath: &pb.OpenConfigPath{Path: "state/mtu"}, Bind: "sub_mtu"},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	tests := []struct {
+		path          string
+		expected      map[string]string
+		expectedError bool
+	}{
+		{path: "/interfaces", expected: map[string]string{}},
+		{path: "/interfaces/interface[name=name_value]", expected: map[string]string{"name_value": "interface_index"}},
+		{
+			path:     "/interfaces/interface[name=name_value]/subinterfaces/subinterface[index=sub_value]/state/mtu",
+			expected: map[string]string{"name_value": "interface_index", "sub_value": "sub_index"},
+		},
+		{path: "/interfaces/interface", expectedError: true},
+	}
+	for _, test := range tests {
+		got, err := tree.KeyVariables(test.path)
+		switch {
+		case err != nil && !test.expectedError:
+			t.Errorf("KeyVariables(%q) got error: %v", test.path, err)
+		case err == nil && test.expectedError:
+			t.Errorf("KeyVariables(%q) = %v, expected an error", test.path, got)
+		case err == nil:
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("KeyVariables(%q) returned unexpected variables (-expected +got):\n%v", test.path, diff)
+			}
+		}
+	}
+}
+
+// makeBenchmarkTree builds the tree of the production mappings, which are representative in size.
+func makeBenchmarkTree(b *testing.B) OcTree {
+	mappings, err := utils.LoadMappings("../proto/mappings.pb")
+	if err != nil {
+		b.Fatalf("Error during benchmark set up: %v", err)
+	}
+	tree, err := NewTree(mappings)
+	if err != nil {
+		b.Fatalf("Error during benchmark set up: %v", err)
+	}
+	return tree
+}
+
+func BenchmarkGetTransformationIdentifier(b *testing.B) {
+	tree := makeBenchmarkTree(b)
+	const path = "/components/component[name=name_value]/cpu/utilization/state/avg"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.GetTransformationIdentifier(path); err != nil {
+			b.Fatalf("GetTransformationIdentifier(%q) got error: %v", path, err)
+		}
+	}
+}
+
+func BenchmarkLeaves(b *testing.B) {
+	tree := makeBenchmarkTree(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.Leaves("/"); err != nil {
+			b.Fatalf("Leaves() got error: %v", err)
+		}
+	}
+}
+
 func makeTree(t *testing.T) OcTree {
 	const mappingsFile = "../testdata/oc_tree_test_mappings.pb"
 	mappings, err := utils.LoadMappings(mappingsFile)
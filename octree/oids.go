@@ -0,0 +1,140 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package octree
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/orismologer/oparse"
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Code to find the OpenConfig leaves derived from an OID, eg: to debug a change to a device's MIB.
+
+/*
+IndexOids indexes the OIDs from which the tree's leaves are derived (see PathsForOid): those of the
+NocPaths of the transformations the leaves are bound to, and of the transformations their expressions
+reference, recursively. Expressions which cannot be parsed are skipped, as are lookups of other paths.
+Indexing again replaces the index, eg: after symbolic OIDs are resolved.
+*/
+func (t *OcTree) IndexOids(transformations *pb.Transformations) {
+	byName := map[string]*pb.Transformation{}
+	for _, transformation := range transformations.GetTransformations() {
+		byName[transformation.GetBind()] = transformation
+	}
+	index := oidIndex{transformations: byName, oids: map[string][]string{}}
+	t.oids = map[string][]string{}
+	leaves, _ := t.Leaves(RootName)
+	for _, leaf := range leaves {
+		bind, _ := t.GetTransformationIdentifier(leaf)
+		for _, oid := range index.of(bind, map[string]bool{}) {
+			t.oids[oid] = append(t.oids[oid], leaf)
+		}
+	}
+}
+
+/*
+PathsForOid returns the paths (in "/parent/child" form) of the leaves derived from the given OID, in
+alphabetical order. The OID may be that of a NocPath, an instance of one (eg: "1.3.6.1.2.1.2.2.1.10.3"
+for ifInOctets), or an ancestor of several (eg: "1.3.6.1.2.1.2.2" for the columns of ifTable). OIDs
+of NocPaths are compared without any named index, eg: "1.3.6.1.2.1.2.2.1.9.interface_index" is
+compared as "1.3.6.1.2.1.2.2.1.9". No paths are returned unless the tree was indexed (see IndexOids).
+*/
+func (t *OcTree) PathsForOid(oid string) []string {
+	oid = strings.TrimPrefix(oid, ".")
+	found := map[string]bool{}
+	for indexed, leaves := range t.oids {
+		if !utils.HasOidPrefix(oid, indexed) && !utils.HasOidPrefix(indexed, oid) {
+			continue
+		}
+		for _, leaf := range leaves {
+			found[leaf] = true
+		}
+	}
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// oidIndex finds the OIDs which transformations are derived from, remembering those of each transformation.
+type oidIndex struct {
+	transformations map[string]*pb.Transformation
+	oids            map[string][]string // Transformation -> OIDs, once found.
+}
+
+// of returns the OIDs which the named transformation is derived from, ignoring those it is visiting (ie: circular references).
+func (x oidIndex) of(name string, visiting map[string]bool) []string {
+	if oids, ok := x.oids[name]; ok {
+		return oids
+	}
+	transformation, ok := x.transformations[name]
+	if !ok || visiting[name] {
+		return nil
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	found := map[string]bool{}
+	nocPaths := map[string]bool{}
+	for _, nocPath := range transformation.GetNocPaths() {
+		nocPaths[nocPath.GetBind()] = true
+		for _, oid := range nocPath.GetOids() {
+			if object := oidObject(oid); object != "" {
+				found[object] = true
+			}
+		}
+	}
+	for _, expressionString := range transformation.GetExpressions() {
+		expression, err := oparse.Parse(expressionString)
+		if err != nil {
+			continue
+		}
+		variables, _ := expression.Identifiers()
+		for _, variable := range variables {
+			if nocPaths[variable] {
+				continue // NocPaths of the transformation take precedence over other transformations.
+			}
+			for _, oid := range x.of(variable, visiting) {
+				found[oid] = true
+			}
+		}
+	}
+	oids := make([]string, 0, len(found))
+	for oid := range found {
+		oids = append(oids, oid)
+	}
+	sort.Strings(oids)
+	x.oids[name] = oids
+	return oids
+}
+
+// oidObject returns the numeric OID of the object a NocPath's OID refers to, ie: without any named index, eg: ".1.3.6.index" -> "1.3.6".
+func oidObject(oid string) string {
+	arcs := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	for i, arc := range arcs {
+		if arc == "" || strings.Trim(arc, "0123456789") != "" {
+			return strings.Join(arcs[:i], ".")
+		}
+	}
+	return strings.Join(arcs, ".")
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package octree
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestPathsForOid(t *testing.T) {
+	tree := makeTree(t)
+	if got := tree.PathsForOid("1.3.6.1.2.1.2.2.1.10"); len(got) != 0 {
+		t.Errorf("PathsForOid() of an unindexed tree = %v, expected none", got)
+	}
+	tree.IndexOids(&pb.Transformations{
+		Transformations: []*pb.Transformation{
+			{
+				Bind:        "cousin_t",
+				Expressions: []string{"in_octets + speed", "in_octets ?? 0"},
+				NocPaths: []*pb.NocPath{
+					{Bind: "in_octets", Oids: []string{".1.3.6.1.2.1.2.2.1.10.if_index", "1.3.6.1.2.1.31.1.1.1.6"}},
+					{Bind: "speed_t", Oids: []string{"1.3.6.1.2.1.2.2.1.5"}}, // Not the transformation speed.
+				},
+			},
+			{
+				Bind:        "speed",
+				Expressions: []string{"high_speed * 1000000", "speed"}, // Circular.
+				NocPaths:    []*pb.NocPath{{Bind: "high_speed", Oids: []string{"1.3.6.1.2.1.31.1.1.1.15"}}},
+			},
+			{
+				Bind:        "unused",
+				Expressions: []string{"sys_up_time"},
+				NocPaths:    []*pb.NocPath{{Bind: "sys_up_time", Oids: []string{"1.3.6.1.2.1.1.3"}}},
+			},
+			{Bind: "invalid", Expressions: []string{"(("}},
+		},
+	})
+	cousin := []string{"/grandmother/aunt/cousin"}
+	for _, test := range []struct {
+		name     string
+		oid      string
+		expected []string
+	}{
+		{name: "NocPath", oid: "1.3.6.1.2.1.31.1.1.1.6", expected: cousin},
+		{name: "named index", oid: "1.3.6.1.2.1.2.2.1.10", expected: cousin},
+		{name: "leading dot", oid: ".1.3.6.1.2.1.2.2.1.10", expected: cousin},
+		{name: "instance", oid: "1.3.6.1.2.1.2.2.1.10.3", expected: cousin},
+		{name: "table", oid: "1.3.6.1.2.1.2.2", expected: cousin},
+		{name: "sub-transformation", oid: "1.3.6.1.2.1.31.1.1.1.15", expected: cousin},
+		{name: "unused NocPath of the transformation", oid: "1.3.6.1.2.1.2.2.1.5", expected: cousin},
+		{name: "unbound transformation", oid: "1.3.6.1.2.1.1.3", expected: []string{}},
+		{name: "sibling column", oid: "1.3.6.1.2.1.2.2.1.1", expected: []string{}},
+		{name: "prefix of an arc", oid: "1.3.6.1.2.1.2.2.1.100", expected: []string{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.expected, tree.PathsForOid(test.oid)); diff != "" {
+				t.Errorf("PathsForOid(%q) returned unexpected paths (-expected +got):\n%v", test.oid, diff)
+			}
+		})
+	}
+}
+
+func TestOidObject(t *testing.T) {
+	for _, test := range []struct {
+		oid      string
+		expected string
+	}{
+		{oid: "1.3.6.1.2.1.1.3", expected: "1.3.6.1.2.1.1.3"},
+		{oid: ".1.3.6.1.2.1.1.3.0", expected: "1.3.6.1.2.1.1.3.0"},
+		{oid: "1.3.6.1.2.1.2.2.1.9.interface_index", expected: "1.3.6.1.2.1.2.2.1.9"},
+		{oid: "1.3.6.index.7", expected: "1.3.6"},
+		{oid: "index", expected: ""},
+	} {
+		if got := oidObject(test.oid); got != test.expected {
+			t.Errorf("oidObject(%q) = %q, expected %q", test.oid, got, test.expected)
+		}
+	}
+}
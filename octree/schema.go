@@ -0,0 +1,232 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package octree
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/orismologer/oparse"
+	"github.com/openconfig/goyang/pkg/yang"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Code to check the paths of an OcTree against OpenConfig YANG modules, eg: to catch typos at load time.
+
+// keyPattern matches the names of the keys of a path segment, eg: "name" of "interface[name=if_name]".
+var keyPattern = regexp.MustCompile(`\[([^=\]]+)=`)
+
+/*
+NewTreeWithSchema is like NewTree, but also checks the tree against the given YANG module entries (eg:
+as loaded by yanggen.Load; see Validate). The tree is returned even if it does not match the schema.
+*/
+func NewTreeWithSchema(mappings *pb.Mappings, schema []*yang.Entry) (OcTree, error) {
+	t, err := NewTree(mappings)
+	if err != nil {
+		return t, err
+	}
+	return t, t.Validate(schema)
+}
+
+/*
+Validate checks that every path of the tree exists in the given YANG module entries, eg: that
+"/interfaces/interface/state/oper-staus" is a typo. It also checks that nodes are compatible with
+their YANG schema nodes: that nodes bound to transformations are leaves (or leaf-lists), that leaves
+have no children, and that keys (eg: "name" of "interface[name=if_name]") are keys of lists. Module
+prefixes of path elements (eg: "oc-if:interfaces") are ignored, and elements may be nested in choices
+and cases. Every mismatch is reported in the error, in the order nodes were defined.
+*/
+func (t *OcTree) Validate(schema []*yang.Entry) error {
+	v := t.validateSchema(schema)
+	if len(v.problems) > 0 {
+		return fmt.Errorf("paths do not match the YANG schema: %v", strings.Join(v.problems, "; "))
+	}
+	return nil
+}
+
+/*
+ValidateTypes checks that the transformations bound to leaves have results of the kinds the YANG types
+of the leaves expect, eg: that a leaf of type uint64 is not bound to a transformation which returns a
+string. kinds maps the binds of transformations to the kinds of their results (eg: as inferred by
+lint.Kinds); leaves bound to transformations missing from kinds are not checked, nor are leaves whose
+paths do not match the schema (see Validate). Numbers of any kind are compatible with any numeric YANG
+type, as ranges are not checked, and leaf-lists may also be bound to maps. Every mismatch is reported in
+the error, in the order nodes were defined.
+*/
+func (t *OcTree) ValidateTypes(schema []*yang.Entry, kinds map[string]oparse.Kind) error {
+	var problems []string
+	for _, leaf := range t.validateSchema(schema).leaves {
+		bind := t.payloads[leaf.node].GetBind()
+		kind, ok := kinds[bind]
+		if !ok || compatible(kind, leaf.entry.Type, leaf.entry.IsLeafList()) {
+			continue
+		}
+		path := strings.TrimPrefix(leaf.node, RootName)
+		problems = append(problems, fmt.Sprintf("%q of type %v is bound to %q, which returns a %v", path, typeName(leaf.entry.Type), bind, kind))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("transformations do not match the YANG types of their leaves: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// schemaValidation holds the results of checking a tree against a schema.
+type schemaValidation struct {
+	problems []string
+	leaves   []boundLeaf // The leaves bound to transformations, in the order they were defined.
+}
+
+// boundLeaf is a node of a tree bound to a transformation, with its YANG schema entry.
+type boundLeaf struct {
+	node  string
+	entry *yang.Entry
+}
+
+func (t *OcTree) validateSchema(schema []*yang.Entry) *schemaValidation {
+	// The top level nodes of all modules are children of the root.
+	root := &yang.Entry{Name: RootName, Kind: yang.DirectoryEntry, Dir: map[string]*yang.Entry{}}
+	for _, module := range schema {
+		for name, entry := range module.Dir {
+			root.Dir[name] = entry
+		}
+	}
+	v := &schemaValidation{}
+	for _, child := range t.graph.Neighbors(RootName) {
+		t.validate(child, root, v)
+	}
+	return v
+}
+
+func (t *OcTree) validate(node string, parent *yang.Entry, v *schemaValidation) {
+	path := strings.TrimPrefix(node, RootName)
+	name, keys := splitSegment(node[strings.LastIndex(node, pathSep)+1:])
+	entry := schemaChild(parent, name)
+	if entry == nil {
+		v.problems = append(v.problems, fmt.Sprintf("%q is not in the schema", path))
+		return
+	}
+	if len(keys) > 0 && !entry.IsList() {
+		v.problems = append(v.problems, fmt.Sprintf("%q has keys but is not a list", path))
+	}
+	for _, key := range keys {
+		if entry.IsList() && !contains(strings.Fields(entry.Key), key) {
+			v.problems = append(v.problems, fmt.Sprintf("%q is not a key of %q (keys: %v)", key, path, entry.Key))
+		}
+	}
+	children := t.graph.Neighbors(node)
+	payload, bound := t.payloads[node]
+	bound = bound && payload.GetBind() != ""
+	if entry.Kind == yang.LeafEntry {
+		if len(children) > 0 {
+			v.problems = append(v.problems, fmt.Sprintf("%q is a leaf, so cannot have children", path))
+		}
+		if bound {
+			v.leaves = append(v.leaves, boundLeaf{node: node, entry: entry})
+		}
+		return
+	}
+	if bound {
+		v.problems = append(v.problems, fmt.Sprintf("%q is bound to a transformation, but is not a leaf", path))
+	}
+	for _, child := range children {
+		t.validate(child, entry, v)
+	}
+}
+
+/*
+compatible returns whether a result of the given kind may be the value of a leaf of the given YANG
+type. Nulls (ie: no value) and results whose kinds are not known are compatible with any type, as are
+types which are not checked (eg: leafrefs, whose values are of the types of the leaves they refer to).
+*/
+func compatible(kind oparse.Kind, yangType *yang.YangType, isLeafList bool) bool {
+	if kind == oparse.NullKind || kind == oparse.AnyKind || yangType == nil {
+		return true
+	}
+	if kind == oparse.MapKind && isLeafList {
+		return true
+	}
+	switch yangType.Kind {
+	case yang.Yunion:
+		for _, member := range yangType.Type {
+			if compatible(kind, member, isLeafList) {
+				return true
+			}
+		}
+		return false
+	case yang.Ybool, yang.Yempty:
+		return kind == oparse.BoolKind
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yint64, yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64, yang.Ydecimal64:
+		return kind == oparse.FloatKind || kind == oparse.IntKind || kind == oparse.UintKind
+	case yang.Ystring, yang.Yenum, yang.Yidentityref, yang.Ybits, yang.Ybinary:
+		return kind == oparse.StringKind
+	}
+	return true
+}
+
+// typeName returns the name of a YANG type, with its base type if it is derived, eg: "yang:counter64 (uint64)".
+func typeName(yangType *yang.YangType) string {
+	base := yang.TypeKindToName[yangType.Kind]
+	if yangType.Name == "" || yangType.Name == base {
+		return base
+	}
+	return fmt.Sprintf("%v (%v)", yangType.Name, base)
+}
+
+// splitSegment returns the name and key names of a path segment, eg: "interface" and ["name"] for "interface[name=if_name]".
+func splitSegment(segment string) (string, []string) {
+	i := strings.Index(segment, "[")
+	if i < 0 {
+		return segment, nil
+	}
+	var keys []string
+	for _, match := range keyPattern.FindAllStringSubmatch(segment[i:], -1) {
+		keys = append(keys, match[1])
+	}
+	return segment[:i], keys
+}
+
+/*
+schemaChild returns the data node with the given name beneath an entry, or nil if there is none.
+Choices and cases do not appear in data paths, so their children are searched in their place.
+*/
+func schemaChild(entry *yang.Entry, name string) *yang.Entry {
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	if child, ok := entry.Dir[name]; ok && !child.IsChoice() && !child.IsCase() {
+		return child
+	}
+	for _, child := range entry.Dir {
+		if child.IsChoice() || child.IsCase() {
+			if c := schemaChild(child, name); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package octree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
+	"github.com/openconfig/goyang/pkg/yang"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func schemaDir(name string, kind yang.EntryKind, children ...*yang.Entry) *yang.Entry {
+	e := &yang.Entry{Name: name, Kind: kind, Dir: map[string]*yang.Entry{}}
+	for _, child := range children {
+		child.Parent = e
+		e.Dir[child.Name] = child
+	}
+	return e
+}
+
+func schemaLeaf(name string) *yang.Entry {
+	return &yang.Entry{Name: name, Kind: yang.LeafEntry, Type: &yang.YangType{Kind: yang.Ystring}}
+}
+
+// testSchema is a cut-down openconfig-interfaces and openconfig-system.
+func testSchema() []*yang.Entry {
+	interfaceList := schemaDir("interface", yang.DirectoryEntry,
+		schemaLeaf("name"),
+		schemaDir("state", yang.DirectoryEntry, schemaLeaf("oper-status"), schemaLeaf("mtu")),
+	)
+	interfaceList.Key = "name"
+	interfaceList.ListAttr = &yang.ListAttr{}
+	choice := schemaDir("address-type", yang.ChoiceEntry, schemaDir("ipv4", yang.CaseEntry, schemaLeaf("address")))
+	return []*yang.Entry{
+		schemaDir("openconfig-interfaces", yang.DirectoryEntry, schemaDir("interfaces", yang.DirectoryEntry, interfaceList)),
+		schemaDir("openconfig-system", yang.DirectoryEntry,
+			schemaDir("system", yang.DirectoryEntry, schemaDir("state", yang.DirectoryEntry, schemaLeaf("boot-time"), choice)),
+		),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []*pb.OpenConfigNode
+		expected []string // Substrings of the error, in order, or none if valid.
+	}{
+		{
+			name: "valid",
+			nodes: []*pb.OpenConfigNode{
+				{
+					Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface[name=if_name]"},
+					Children: []*pb.OpenConfigNode{
+						{Subpath: &pb.OpenConfigPath{Path: "state/oper-status"}, Bind: "oper_status"},
+						{Subpath: &pb.OpenConfigPath{Path: "oc-if:state/mtu"}, Bind: "mtu"},
+					},
+				},
+				{Subpath: &pb.OpenConfigPath{Path: "/system/state/address"}, Bind: "address"},
+				{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+			},
+		},
+		{
+			name: "typos",
+			nodes: []*pb.OpenConfigNode{
+				{Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface/state/oper-staus"}, Bind: "oper_status"},
+				{Subpath: &pb.OpenConfigPath{Path: "/sytem/state/boot-time"}, Bind: "boot_time"},
+			},
+			expected: []string{
+				`"/interfaces/interface/state/oper-staus" is not in the schema`,
+				`"/sytem" is not in the schema`,
+			},
+		},
+		{
+			name: "keys",
+			nodes: []*pb.OpenConfigNode{
+				{Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface[index=if_index]/state/mtu"}, Bind: "mtu"},
+				{Subpath: &pb.OpenConfigPath{Path: "/system/state[name=state_name]/boot-time"}, Bind: "boot_time"},
+			},
+			expected: []string{
+				`"index" is not a key of "/interfaces/interface[index=if_index]" (keys: name)`,
+				`"/system/state[name=state_name]" has keys but is not a list`,
+			},
+		},
+		{
+			name: "incompatible nodes",
+			nodes: []*pb.OpenConfigNode{
+				{
+					Subpath: &pb.OpenConfigPath{Path: "/system/state"},
+					Bind:    "system_state",
+					Children: []*pb.OpenConfigNode{
+						{Subpath: &pb.OpenConfigPath{Path: "boot-time/seconds"}, Bind: "boot_time"},
+					},
+				},
+			},
+			expected: []string{
+				`"/system/state" is bound to a transformation, but is not a leaf`,
+				`"/system/state/boot-time" is a leaf, so cannot have children`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := NewTreeWithSchema(&pb.Mappings{Nodes: test.nodes}, testSchema())
+			if len(test.expected) == 0 {
+				if err != nil {
+					t.Errorf("NewTreeWithSchema() got error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("NewTreeWithSchema() got no error, expected %v", test.expected)
+			}
+			message := err.Error()
+			for _, expected := range test.expected {
+				i := strings.Index(message, expected)
+				if i < 0 {
+					t.Fatalf("NewTreeWithSchema() got error %q, expected it to contain %q next", err, expected)
+				}
+				message = message[i+len(expected):]
+			}
+			if leaves, _ := tree.Leaves("/"); len(leaves) == 0 {
+				t.Errorf("NewTreeWithSchema() did not return the tree with the error")
+			}
+		})
+	}
+}
+
+func typedLeaf(name string, yangType *yang.YangType) *yang.Entry {
+	return &yang.Entry{Name: name, Kind: yang.LeafEntry, Type: yangType}
+}
+
+func TestValidateTypes(t *testing.T) {
+	addresses := typedLeaf("addresses", &yang.YangType{Kind: yang.Ystring})
+	addresses.ListAttr = &yang.ListAttr{}
+	schema := []*yang.Entry{
+		schemaDir("openconfig-system", yang.DirectoryEntry, schemaDir("system", yang.DirectoryEntry, schemaDir("state", yang.DirectoryEntry,
+			typedLeaf("boot-time", &yang.YangType{Name: "oc-types:timeticks64", Kind: yang.Yuint64}),
+			typedLeaf("hostname", &yang.YangType{Kind: yang.Ystring}),
+			typedLeaf("enabled", &yang.YangType{Kind: yang.Ybool}),
+			typedLeaf("timezone", &yang.YangType{Kind: yang.Yunion, Type: []*yang.YangType{{Kind: yang.Yuint8}, {Kind: yang.Ystring}}}),
+			typedLeaf("peer", &yang.YangType{Kind: yang.Yleafref}),
+			addresses,
+		))),
+	}
+	nodes := []*pb.OpenConfigNode{
+		{
+			Subpath: &pb.OpenConfigPath{Path: "/system/state"},
+			Children: []*pb.OpenConfigNode{
+				{Subpath: &pb.OpenConfigPath{Path: "boot-time"}, Bind: "boot_time"},
+				{Subpath: &pb.OpenConfigPath{Path: "hostname"}, Bind: "hostname"},
+				{Subpath: &pb.OpenConfigPath{Path: "enabled"}, Bind: "enabled"},
+				{Subpath: &pb.OpenConfigPath{Path: "timezone"}, Bind: "timezone"},
+				{Subpath: &pb.OpenConfigPath{Path: "peer"}, Bind: "peer"},
+				{Subpath: &pb.OpenConfigPath{Path: "addresses"}, Bind: "addresses"},
+				{Subpath: &pb.OpenConfigPath{Path: "missing"}, Bind: "missing"},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		kinds    map[string]oparse.Kind
+		expected []string // Substrings of the error, in order, or none if valid.
+	}{
+		{
+			name: "compatible",
+			kinds: map[string]oparse.Kind{
+				"boot_time": oparse.FloatKind,
+				"hostname":  oparse.StringKind,
+				"enabled":   oparse.BoolKind,
+				"timezone":  oparse.IntKind,
+				"peer":      oparse.StringKind,
+				"addresses": oparse.MapKind,
+				"missing":   oparse.BoolKind,
+			},
+		},
+		{
+			name: "unknown kinds",
+			kinds: map[string]oparse.Kind{
+				"boot_time": oparse.AnyKind,
+				"hostname":  oparse.NullKind,
+			},
+		},
+		{
+			name: "incompatible",
+			kinds: map[string]oparse.Kind{
+				"boot_time": oparse.StringKind,
+				"hostname":  oparse.FloatKind,
+				"enabled":   oparse.StringKind,
+				"timezone":  oparse.BoolKind,
+				"addresses": oparse.FloatKind,
+			},
+			expected: []string{
+				`"/system/state/boot-time" of type oc-types:timeticks64 (uint64) is bound to "boot_time", which returns a string`,
+				`"/system/state/hostname" of type string is bound to "hostname", which returns a float`,
+				`"/system/state/enabled" of type boolean is bound to "enabled", which returns a string`,
+				`"/system/state/timezone" of type union is bound to "timezone", which returns a bool`,
+				`"/system/state/addresses" of type string is bound to "addresses", which returns a float`,
+			},
+		},
+	}
+	tree, err := NewTree(&pb.Mappings{Nodes: nodes})
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := tree.ValidateTypes(schema, test.kinds)
+			if len(test.expected) == 0 {
+				if err != nil {
+					t.Errorf("ValidateTypes() got error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateTypes() got no error, expected %v", test.expected)
+			}
+			message := err.Error()
+			for _, expected := range test.expected {
+				i := strings.Index(message, expected)
+				if i < 0 {
+					t.Fatalf("ValidateTypes() got error %q, expected it to contain %q next", err, expected)
+				}
+				message = message[i+len(expected):]
+			}
+		})
+	}
+}
+
+func TestSplitSegment(t *testing.T) {
+	tests := []struct {
+		segment      string
+		expectedName string
+		expectedKeys []string
+	}{
+		{segment: "state", expectedName: "state"},
+		{segment: "interface[name=if_name]", expectedName: "interface", expectedKeys: []string{"name"}},
+		{segment: "neighbor[afi=afi_value][address=addr]", expectedName: "neighbor", expectedKeys: []string{"afi", "address"}},
+		{segment: "interface", expectedName: "interface"},
+	}
+	for _, test := range tests {
+		name, keys := splitSegment(test.segment)
+		if name != test.expectedName || !cmp.Equal(keys, test.expectedKeys) {
+			t.Errorf("splitSegment(%q) = %q, %v, expected %q, %v", test.segment, name, keys, test.expectedName, test.expectedKeys)
+		}
+	}
+}
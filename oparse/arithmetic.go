@@ -0,0 +1,446 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Arithmetic selects how numbers are represented when evaluating an expression.
+type Arithmetic int
+
+const (
+	/*
+		FloatArithmetic represents every number as a float64, which is only exact for integers of up to
+		53 bits. This is the default. Larger integers from variables and functions (eg: 64-bit counters)
+		are kept as int64 or uint64, so that they survive translation intact (eg: `to_uint64(octets)`),
+		and so is arithmetic on two such integers; arithmetic on an integer and a float is float arithmetic.
+	*/
+	FloatArithmetic Arithmetic = iota
+
+	/*
+		IntegerArithmetic keeps integers exact, eg: for 64-bit counters. Integers are represented as
+		int64, or as uint64 if they are too large for an int64. Arithmetic on integers falls back to
+		float64 only if the result is not an integer (eg: 7 / 2) or does not fit in 64 bits.
+	*/
+	IntegerArithmetic
+
+	/*
+		BigArithmetic represents every number as an arbitrary-precision rational (a *big.Rat), so that
+		arithmetic never overflows or loses precision, eg: when multiplying 64-bit counters. Only the
+		result of the expression, and the arguments of functions, are converted back: integers to int64
+		(or uint64 if they are too large for an int64), and other numbers (or integers too large for
+		64 bits) to float64. Raising to a power which is not an integer is approximated with floats.
+		Numbers are limited to maxBigBits bits.
+	*/
+	BigArithmetic
+)
+
+// Options configure the evaluation of an expression.
+type Options struct {
+	Limits     Limits
+	Arithmetic Arithmetic
+	// Constants are named constants (eg: MEGA), which take precedence over variables of the same name.
+	Constants Context
+	// NumberFormat formats numbers concatenated with strings. The zero value formats them as %v does.
+	NumberFormat NumberFormat
+}
+
+// Integers of magnitude up to maxExactFloat are exactly representable as float64s.
+const maxExactFloat = 1 << 53
+
+/*
+number converts a numeric value from a literal, variable or function to the representation used by
+the arithmetic mode. Non-numeric values are returned unchanged.
+*/
+func (ev *evaluation) number(value interface{}) interface{} {
+	if ev.arithmetic == BigArithmetic {
+		if r := toRat(value); r != nil {
+			return r
+		}
+		return value
+	}
+	if ev.arithmetic != IntegerArithmetic {
+		if n, ok := value.(int); ok {
+			if i := int64(n); i > maxExactFloat || i < -maxExactFloat {
+				return i
+			}
+			return float64(n)
+		}
+		return value
+	}
+	switch n := value.(type) {
+	case int:
+		return int64(n)
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n)
+		}
+	case float64:
+		// Literals are parsed as floats. Integral literals which are exactly representable as floats are
+		// treated as integers.
+		if n == math.Trunc(n) && math.Abs(n) <= maxExactFloat {
+			return int64(n)
+		}
+	}
+	return value
+}
+
+// isInteger returns true if the value is an integer in integer arithmetic.
+func isInteger(value interface{}) bool {
+	switch value.(type) {
+	case int64, uint64:
+		return true
+	}
+	return false
+}
+
+// toFloat returns the value of a float or integer as a float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func toBig(value interface{}) *big.Int {
+	switch n := value.(type) {
+	case int64:
+		return big.NewInt(n)
+	case uint64:
+		return new(big.Int).SetUint64(n)
+	}
+	return nil
+}
+
+// fromBig returns an integer as an int64 or uint64, or as a float64 if it does not fit in either.
+func fromBig(n *big.Int) interface{} {
+	switch {
+	case n.IsInt64():
+		return n.Int64()
+	case n.IsUint64():
+		return n.Uint64()
+	}
+	f, _ := new(big.Float).SetInt(n).Float64()
+	return f
+}
+
+// integers evaluates an arithmetic operator on two integers.
+func (o Operator) integers(l, r interface{}) (interface{}, error) {
+	a, b := toBig(l), toBig(r)
+	switch o {
+	case OpMul:
+		return fromBig(a.Mul(a, b)), nil
+	case OpAdd:
+		return fromBig(a.Add(a, b)), nil
+	case OpSub:
+		return fromBig(a.Sub(a, b)), nil
+	case OpDiv:
+		if b.Sign() == 0 {
+			return nil, errors.New("division by 0")
+		}
+		quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+		if remainder.Sign() == 0 {
+			return fromBig(quotient), nil
+		}
+		lFloat, _ := toFloat(l)
+		rFloat, _ := toFloat(r)
+		return lFloat / rFloat, nil
+	case OpMod:
+		if b.Sign() == 0 {
+			return nil, errors.New("modulo by 0")
+		}
+		// Like math.Mod, the result has the sign of the dividend.
+		return fromBig(a.Rem(a, b)), nil
+	}
+	return nil, fmt.Errorf("unsupported integer operator: %v", o)
+}
+
+// power raises a base to an exponent, keeping the result exact if both are integers and it fits.
+func power(base, exponent interface{}) (interface{}, error) {
+	if isRat(base) || isRat(exponent) {
+		if b, e := toRat(base), toRat(exponent); b != nil && e != nil {
+			return ratPower(b, e)
+		}
+	}
+	if isInteger(base) && isInteger(exponent) {
+		b, e := toBig(base), toBig(exponent)
+		// Any base other than -1, 0 or 1 overflows 64 bits with an exponent above 64.
+		if e.Sign() >= 0 && (e.Cmp(big.NewInt(64)) <= 0 || b.CmpAbs(big.NewInt(1)) <= 0) {
+			if e.Cmp(big.NewInt(64)) > 0 {
+				e.SetInt64(int64(2 + e.Bit(0))) // Same parity, so the same result for -1, 0 and 1.
+			}
+			return fromBig(new(big.Int).Exp(b, e, nil)), nil
+		}
+	}
+	b, bIsNumber := toFloat(base)
+	e, eIsNumber := toFloat(exponent)
+	if !bIsNumber || !eIsNumber {
+		return nil, fmt.Errorf("cannot raise %T to the power of %T", base, exponent)
+	}
+	return math.Pow(b, e), nil
+}
+
+// negate negates a float or an integer.
+func negate(value interface{}) (interface{}, error) {
+	if r, ok := value.(*big.Rat); ok {
+		return new(big.Rat).Neg(r), nil
+	}
+	if isInteger(value) {
+		n := toBig(value)
+		return fromBig(n.Neg(n)), nil
+	}
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %T", value)
+	}
+	return -n, nil
+}
+
+// maxShift is the largest shift count, as larger shifts overflow (or clear) any 64-bit integer.
+const maxShift = 64
+
+/*
+bitwise evaluates a bitwise operator. Floats must have integer values. The result is an integer if
+both operands are integers, and a float otherwise.
+*/
+func (o Operator) bitwise(l, r interface{}) (interface{}, error) {
+	a, err := bitwiseOperand(o, l)
+	if err != nil {
+		return nil, err
+	}
+	b, err := bitwiseOperand(o, r)
+	if err != nil {
+		return nil, err
+	}
+	switch o {
+	case OpBitwiseAnd:
+		a.And(a, b)
+	case OpBitwiseOr:
+		a.Or(a, b)
+	case OpBitwiseXor:
+		a.Xor(a, b)
+	case OpShl, OpShr:
+		if b.Sign() < 0 || b.Cmp(big.NewInt(maxShift)) > 0 {
+			return nil, fmt.Errorf("shift count %v is not between 0 and %d", b, maxShift)
+		}
+		if o == OpShl {
+			a.Lsh(a, uint(b.Uint64()))
+		} else {
+			a.Rsh(a, uint(b.Uint64()))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bitwise operator: %v", o)
+	}
+	if isInteger(l) && isInteger(r) {
+		return fromBig(a), nil
+	}
+	if isRat(l) && isRat(r) {
+		return new(big.Rat).SetInt(a), nil
+	}
+	f, _ := new(big.Float).SetInt(a).Float64()
+	return f, nil
+}
+
+func bitwiseOperand(o Operator, value interface{}) (*big.Int, error) {
+	if isInteger(value) {
+		return toBig(value), nil
+	}
+	if r, ok := value.(*big.Rat); ok {
+		if !r.IsInt() {
+			return nil, fmt.Errorf("operands of %v must be integers, got %v", o, ratString(r))
+		}
+		return new(big.Int).Set(r.Num()), nil
+	}
+	f, ok := value.(float64)
+	if !ok || f != math.Trunc(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("operands of %v must be integers, got %v", o, value)
+	}
+	i, _ := big.NewFloat(f).Int(nil)
+	return i, nil
+}
+
+// Functions for BigArithmetic.
+
+// maxBigBits is the largest size of the numerator or denominator of a number in BigArithmetic.
+const maxBigBits = 1 << 16
+
+// literal returns the value of a numeric literal in the arithmetic mode.
+func (ev *evaluation) literal(n *Number) interface{} {
+	switch ev.arithmetic {
+	case IntegerArithmetic:
+		if i, ok := n.integer(); ok {
+			return ev.number(i)
+		}
+	case BigArithmetic:
+		if r := n.rat(); r != nil {
+			return r
+		}
+	}
+	return ev.number(n.Float)
+}
+
+// rat returns the exact value of the literal, or nil if it cannot be represented exactly.
+func (n *Number) rat() *big.Rat {
+	if i, ok := n.integer(); ok {
+		return new(big.Rat).SetUint64(i)
+	}
+	r, ok := new(big.Rat).SetString(strings.Replace(n.Text, "_", "", -1))
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+/*
+toRat returns a number as a *big.Rat, or nil if it is not a number (or is not finite). Rats are
+returned as they are, so they must not be modified: every operation allocates its result.
+*/
+func toRat(value interface{}) *big.Rat {
+	switch n := value.(type) {
+	case *big.Rat:
+		return n
+	case int:
+		return new(big.Rat).SetInt64(int64(n))
+	case int64:
+		return new(big.Rat).SetInt64(n)
+	case uint64:
+		return new(big.Rat).SetUint64(n)
+	case float64:
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil
+		}
+		return new(big.Rat).SetFloat64(n)
+	}
+	return nil
+}
+
+func isRat(value interface{}) bool {
+	_, ok := value.(*big.Rat)
+	return ok
+}
+
+/*
+fromRat converts a number from BigArithmetic back to the types of the other modes: an integer to an
+int64 or uint64, or to a float64 if it does not fit in either, and any other number to a float64.
+Values other than rats are returned as they are.
+*/
+func fromRat(value interface{}) interface{} {
+	r, ok := value.(*big.Rat)
+	if !ok {
+		return value
+	}
+	if r.IsInt() {
+		return fromBig(r.Num())
+	}
+	f, _ := r.Float64()
+	return f
+}
+
+// ratString formats a rat for concatenation: integers exactly, and other numbers as float64s.
+func ratString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	f, _ := r.Float64()
+	return fmt.Sprint(f)
+}
+
+// rats evaluates an arithmetic operator on two rats.
+func (o Operator) rats(a, b *big.Rat) (interface{}, error) {
+	switch o {
+	case OpMul:
+		return new(big.Rat).Mul(a, b), nil
+	case OpAdd:
+		return new(big.Rat).Add(a, b), nil
+	case OpSub:
+		return new(big.Rat).Sub(a, b), nil
+	case OpDiv:
+		if b.Sign() == 0 {
+			return nil, errors.New("division by 0")
+		}
+		return new(big.Rat).Quo(a, b), nil
+	case OpMod:
+		if b.Sign() == 0 {
+			return nil, errors.New("modulo by 0")
+		}
+		// Like math.Mod, the result has the sign of the dividend: a - b * trunc(a / b).
+		q := new(big.Rat).Quo(a, b)
+		truncated := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+		return new(big.Rat).Sub(a, truncated.Mul(truncated, b)), nil
+	}
+	return nil, fmt.Errorf("unsupported operator: %v", o)
+}
+
+// ratPower raises a rat to a rat, exactly if the exponent is an integer.
+func ratPower(base, exponent *big.Rat) (interface{}, error) {
+	if !exponent.IsInt() {
+		b, _ := base.Float64()
+		e, _ := exponent.Float64()
+		result := toRat(math.Pow(b, e))
+		if result == nil {
+			return nil, fmt.Errorf("%v to the power of %v is not a finite number", ratString(base), ratString(exponent))
+		}
+		return result, nil
+	}
+	e := exponent.Num()
+	if base.Sign() == 0 && e.Sign() < 0 {
+		return nil, errors.New("division by 0")
+	}
+	bits := base.Num().BitLen()
+	if d := base.Denom().BitLen(); d > bits {
+		bits = d
+	}
+	// A base other than -1, 0 or 1 has at least as many bits as the exponent, times the bits of the base, less one.
+	if base.Num().CmpAbs(base.Denom()) != 0 && base.Sign() != 0 && (!e.IsInt64() || abs(e.Int64())*int64(bits-1) > maxBigBits) {
+		return nil, limitError{fmt.Errorf("%v to the power of %v exceeds the limit of %d bits", ratString(base), e, maxBigBits)}
+	}
+	// The parity of the exponent is all that matters for -1, 0 and 1.
+	if !e.IsInt64() || abs(e.Int64()) > maxBigBits {
+		e = big.NewInt(2 + int64(e.Bit(0)))
+	}
+	num := new(big.Int).Exp(base.Num(), new(big.Int).Abs(e), nil)
+	denom := new(big.Int).Exp(base.Denom(), new(big.Int).Abs(e), nil)
+	if e.Sign() < 0 {
+		num, denom = denom, num
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// checkRat returns a limitError if a number is too large for BigArithmetic.
+func checkRat(r *big.Rat) error {
+	if r.Num().BitLen() > maxBigBits || r.Denom().BitLen() > maxBigBits {
+		return limitError{fmt.Errorf("number exceeds the limit of %d bits", maxBigBits)}
+	}
+	return nil
+}
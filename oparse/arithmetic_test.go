@@ -0,0 +1,383 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		context          Context
+		arithmetic       Arithmetic
+		expected         interface{}
+		expectedError    bool
+	}{
+		{
+			name:             "float arithmetic by default",
+			expressionString: "a - b",
+			context:          Context{"a": 1 << 53, "b": 1},
+			expected:         float64(1<<53 - 1),
+		},
+		{
+			name:             "float arithmetic converts 64-bit variables",
+			expressionString: "a + b",
+			context:          Context{"a": uint64(1 << 53), "b": int64(-1)},
+			expected:         float64(1<<53 - 1),
+		},
+		{
+			name:             "float arithmetic keeps integers beyond 53 bits",
+			expressionString: "a",
+			context:          Context{"a": uint64(math.MaxUint64)},
+			expected:         uint64(math.MaxUint64),
+		},
+		{
+			name:             "float arithmetic on integers beyond 53 bits and floats",
+			expressionString: "a * 0.5",
+			context:          Context{"a": uint64(1<<53 + 2)},
+			expected:         float64(1<<52 + 1),
+		},
+		{
+			name:             "counter delta",
+			expressionString: "curr - prev",
+			context:          Context{"curr": uint64(math.MaxUint64), "prev": uint64(math.MaxUint64 - 615)},
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(615),
+		},
+		{
+			name:             "exact beyond 53 bits",
+			expressionString: "a + 1",
+			context:          Context{"a": int64(1 << 53)},
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(1<<53 + 1),
+		},
+		{
+			name:             "promotion to uint64",
+			expressionString: "octets * 8",
+			context:          Context{"octets": int64(1 << 60)},
+			arithmetic:       IntegerArithmetic,
+			expected:         uint64(1 << 63),
+		},
+		{
+			name:             "overflow falls back to float",
+			expressionString: "a * a",
+			context:          Context{"a": 1 << 40},
+			arithmetic:       IntegerArithmetic,
+			expected:         float64(1 << 80),
+		},
+		{
+			name:             "exact division",
+			expressionString: "a / 8",
+			context:          Context{"a": uint64(math.MaxUint64 - 7)},
+			arithmetic:       IntegerArithmetic,
+			expected:         int64((math.MaxUint64 - 7) / 8),
+		},
+		{
+			name:             "inexact division falls back to float",
+			expressionString: "7 / 2",
+			arithmetic:       IntegerArithmetic,
+			expected:         3.5,
+		},
+		{
+			name:             "division by zero",
+			expressionString: "7 / 0",
+			arithmetic:       IntegerArithmetic,
+			expectedError:    true,
+		},
+		{
+			name:             "modulo",
+			expressionString: "-7 % 3",
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(-1),
+		},
+		{
+			name:             "64-bit hexadecimal literal",
+			expressionString: "0xFFFFFFFFFFFFFFFF - a",
+			context:          Context{"a": 1},
+			arithmetic:       IntegerArithmetic,
+			expected:         uint64(math.MaxUint64 - 1),
+		},
+		{
+			name:             "64-bit mask",
+			expressionString: "a & 0xFFFFFFFF00000000",
+			context:          Context{"a": uint64(math.MaxUint64)},
+			arithmetic:       IntegerArithmetic,
+			expected:         uint64(0xFFFFFFFF00000000),
+		},
+		{
+			name:             "shift into the top bit",
+			expressionString: "1 << 63 | a >> 32",
+			context:          Context{"a": uint64(1 << 40)},
+			arithmetic:       IntegerArithmetic,
+			expected:         uint64(1<<63 | 1<<8),
+		},
+		{
+			name:             "exclusive or",
+			expressionString: "a ~ -1",
+			context:          Context{"a": 0x0F},
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(^0x0F),
+		},
+		{
+			name:             "integral float literal",
+			expressionString: "1e3 + 2.0",
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(1002),
+		},
+		{
+			name:             "integer and float",
+			expressionString: "a + 0.5",
+			context:          Context{"a": 1},
+			arithmetic:       IntegerArithmetic,
+			expected:         1.5,
+		},
+		{
+			name:             "power",
+			expressionString: "2 ^ 63",
+			arithmetic:       IntegerArithmetic,
+			expected:         uint64(1 << 63),
+		},
+		{
+			name:             "power overflows",
+			expressionString: "2 ^ 64",
+			arithmetic:       IntegerArithmetic,
+			expected:         float64(1 << 64),
+		},
+		{
+			name:             "large power of -1",
+			expressionString: "(-1) ^ 1000001",
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(-1),
+		},
+		{
+			name:             "negative power",
+			expressionString: "2 ^ -1",
+			arithmetic:       IntegerArithmetic,
+			expectedError:    true, // The exponent must be a value, so needs brackets.
+		},
+		{
+			name:             "negative power in brackets",
+			expressionString: "2 ^ (-1)",
+			arithmetic:       IntegerArithmetic,
+			expected:         0.5,
+		},
+		{
+			name:             "negated minimum int64",
+			expressionString: "-a",
+			context:          Context{"a": int64(math.MinInt64)},
+			arithmetic:       IntegerArithmetic,
+			expected:         uint64(1 << 63),
+		},
+		{
+			name:             "exact comparison",
+			expressionString: "a > b",
+			context:          Context{"a": int64(1<<53 + 1), "b": int64(1 << 53)},
+			arithmetic:       IntegerArithmetic,
+			expected:         true,
+		},
+		{
+			name:             "comparison of integer and float",
+			expressionString: "a < 1.5",
+			context:          Context{"a": uint64(1)},
+			arithmetic:       IntegerArithmetic,
+			expected:         true,
+		},
+		{
+			name:             "concatenation",
+			expressionString: "'in: ' + a",
+			context:          Context{"a": uint64(math.MaxUint64)},
+			arithmetic:       IntegerArithmetic,
+			expected:         "in: 18446744073709551615",
+		},
+		{
+			name:             "function result",
+			expressionString: "to_int('42') * 2",
+			arithmetic:       IntegerArithmetic,
+			expected:         int64(84),
+		},
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return 42, nil
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			var got interface{}
+			if err == nil {
+				got, err = EvalWithOptions(expression, test.context, caller, Options{Arithmetic: test.arithmetic})
+			}
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("%v: got `%v`, expected no error", test.name, err)
+			case test.expectedError && err == nil:
+				t.Errorf("%v: got no error, expected error", test.name)
+			case !cmp.Equal(test.expected, got) && err == nil:
+				t.Errorf("%v: got `%v` (%T), expected `%v` (%T)", test.name, got, got, test.expected, test.expected)
+			}
+		})
+	}
+}
+
+func TestBigArithmetic(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		context          Context
+		expected         interface{}
+		expectedError    bool
+	}{
+		{
+			name:             "intermediate results beyond 64 bits",
+			expressionString: "octets * 8 * 1000 / 1000 / 8",
+			context:          Context{"octets": uint64(math.MaxUint64)},
+			expected:         uint64(math.MaxUint64),
+		},
+		{
+			name:             "exact fractions",
+			expressionString: "(a / 3) * 3",
+			context:          Context{"a": int64(1<<62 + 1)},
+			expected:         int64(1<<62 + 1),
+		},
+		{
+			name:             "exact decimal literals",
+			expressionString: "0.1 + 0.2 == 0.3",
+			expected:         true,
+		},
+		{
+			name:             "literals beyond 64 bits",
+			expressionString: "100000000000000000000 - 99999999999999999999",
+			expected:         int64(1),
+		},
+		{
+			name:             "result beyond 64 bits is a float",
+			expressionString: "a * a",
+			context:          Context{"a": uint64(1 << 40)},
+			expected:         float64(1 << 80),
+		},
+		{
+			name:             "result which is not an integer is a float",
+			expressionString: "7 / 2",
+			expected:         3.5,
+		},
+		{
+			name:             "negative results",
+			expressionString: "-a - 1",
+			context:          Context{"a": uint64(math.MaxInt64)},
+			expected:         int64(math.MinInt64),
+		},
+		{
+			name:             "modulo has the sign of the dividend",
+			expressionString: "-7.5 % 2",
+			expected:         -1.5,
+		},
+		{
+			name:             "integer powers are exact",
+			expressionString: "2 ^ 100 / 2 ^ 98 + 2 ^ (-1)",
+			expected:         4.5,
+		},
+		{
+			name:             "fractional powers are approximate",
+			expressionString: "2 ^ 0.5",
+			expected:         math.Sqrt2,
+		},
+		{
+			name:             "powers of one",
+			expressionString: "(-1) ^ 1000000001",
+			expected:         int64(-1),
+		},
+		{
+			name:             "power exceeding the size limit",
+			expressionString: "try 10 ^ 100000 else 0",
+			expectedError:    true,
+		},
+		{
+			name:             "product exceeding the size limit",
+			expressionString: "let x = 2 ^ 60000; x * x",
+			expectedError:    true,
+		},
+		{
+			name:             "bitwise operators",
+			expressionString: "(a << 8 | 0xFF) >> 4",
+			context:          Context{"a": uint64(math.MaxUint64)},
+			expected:         float64(1 << 68),
+		},
+		{
+			name:             "bitwise operands must be integers",
+			expressionString: "1.5 & 1",
+			expectedError:    true,
+		},
+		{
+			name:             "comparison",
+			expressionString: "a + 1 > a && a == 18446744073709551615 && a < 1e20",
+			context:          Context{"a": uint64(math.MaxUint64)},
+			expected:         true,
+		},
+		{
+			name:             "concatenation",
+			expressionString: "'in: ' + (a + 1) + ' ' + 1 / 4",
+			context:          Context{"a": uint64(math.MaxUint64)},
+			expected:         "in: 18446744073709551616 0.25",
+		},
+		{
+			name:             "division by zero",
+			expressionString: "1 / (a - a)",
+			context:          Context{"a": 1},
+			expectedError:    true,
+		},
+		{
+			name:             "function arguments and results",
+			expressionString: "f(a * 2) * 3",
+			context:          Context{"a": int64(1 << 40)},
+			expected:         int64(3 << 41),
+		},
+	}
+	// The caller returns its first argument, which must have been converted from BigArithmetic.
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		if _, ok := args[0].(int64); !ok {
+			return nil, fmt.Errorf("got argument of type %T, expected int64", args[0])
+		}
+		return args[0], nil
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			options := Options{Arithmetic: BigArithmetic}
+			got, err := EvalWithOptions(expression, test.context, caller, options)
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("%v: got `%v`, expected no error", test.name, err)
+			case test.expectedError && err == nil:
+				t.Errorf("%v: got no error, expected error", test.name)
+			case !cmp.Equal(test.expected, got) && err == nil:
+				t.Errorf("%v: got `%v` (%T), expected `%v` (%T)", test.name, got, got, test.expected, test.expected)
+			}
+			compiled, compiledErr := expression.Compile().Eval(test.context, caller, options)
+			if (compiledErr != nil) != (err != nil) || !cmp.Equal(compiled, got) {
+				t.Errorf("%v: compiled expression got `%v` (error %v), expected `%v` (error %v)", test.name, compiled, compiledErr, got, err)
+			}
+		})
+	}
+}
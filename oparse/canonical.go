@@ -0,0 +1,103 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "strconv"
+
+/*
+Canonical returns the expression in a normalized form, so that expressions which differ only in
+formatting have the same canonical form. As for String, operators are separated by single spaces and
+strings are single-quoted where possible. In addition, numbers are written in decimal without
+redundant digits (eg: 0x1F, 31.0 and 3_1 become 31) and brackets around single values are removed.
+*/
+func (e *Expression) Canonical() string {
+	// Canonicalize a copy, leaving the expression as it is.
+	c, err := Parse(e.String())
+	if err != nil {
+		return e.String()
+	}
+	walk(c, func(v *Value) {
+		switch {
+		case v.Number != nil:
+			number := &Value{Number: &Number{Text: v.Number.canonical(), Float: v.Number.Float}}
+			if len(v.Members) == 0 {
+				*v = *number
+				break
+			}
+			// Members of a number need brackets, once it is written without its dot (eg: .0.x is (0).x).
+			*v = Value{Subexpression: valueExpression(number), Members: v.Members}
+		case v.Subexpression != nil:
+			inner := v.Subexpression.value()
+			// Members of a literal or of a negation would apply to something else without the brackets, and
+			// the fallback of a try or the body of a let would extend further.
+			if inner != nil && inner.Try == nil && inner.Let == nil && (len(v.Members) == 0 || inner.Variable != nil || inner.Function != nil) {
+				members := v.Members
+				*v = *inner
+				v.Members = append(append([]*Member{}, inner.Members...), members...)
+			}
+		}
+	})
+	return c.String()
+}
+
+// Equal returns true if two expressions have the same canonical form (see Expression.Canonical).
+func Equal(a, b *Expression) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Canonical() == b.Canonical()
+}
+
+// canonical returns the number in decimal, without redundant digits.
+func (n *Number) canonical() string {
+	if i, ok := n.integer(); ok {
+		return strconv.FormatUint(i, 10)
+	}
+	return strconv.FormatFloat(n.Float, 'g', -1, 64)
+}
+
+// value returns the value the expression consists of, or nil if it is more than a single value.
+func (e *Expression) value() *Value {
+	if len(e.Right) > 0 || e.Then != nil {
+		return nil
+	}
+	d := e.Left
+	if len(d.Right) > 0 {
+		return nil
+	}
+	c := d.Left
+	if len(c.Right) > 0 {
+		return nil
+	}
+	comparison := c.Left
+	if comparison.Right != nil {
+		return nil
+	}
+	bitOr := comparison.Left
+	if len(bitOr.Right) > 0 || len(bitOr.Left.Right) > 0 || len(bitOr.Left.Left.Right) > 0 {
+		return nil
+	}
+	shift := bitOr.Left.Left.Left
+	if len(shift.Right) > 0 || len(shift.Left.Right) > 0 || len(shift.Left.Left.Right) > 0 {
+		return nil
+	}
+	factor := shift.Left.Left.Left
+	if factor.Negated || factor.Exponent != nil {
+		return nil
+	}
+	return factor.Base
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		expected         string
+	}{
+		{
+			name:             "spacing",
+			expressionString: "a+b*  c",
+			expected:         "a + b * c",
+		},
+		{
+			name:             "quotes",
+			expressionString: `"up" + 'down'`,
+			expected:         "'up' + 'down'",
+		},
+		{
+			name:             "numbers",
+			expressionString: "0x1F + 0o17 + 0b1010 + 1_000 + 017 + 1e3 + 2.50 + 1e-7",
+			expected:         "31 + 15 + 10 + 1000 + 17 + 1000 + 2.5 + 1e-07",
+		},
+		{
+			name:             "members of numbers",
+			expressionString: ".0.x + 1e3.y + (1).z",
+			expected:         "(0).x + (1000).y + (1).z",
+		},
+		{
+			name:             "64-bit integer",
+			expressionString: "0xFFFFFFFFFFFFFFFF",
+			expected:         "18446744073709551615",
+		},
+		{
+			name:             "brackets around single values",
+			expressionString: "((a)) + (f(b)) * (2) - ((c.d)).e",
+			expected:         "a + f(b) * 2 - c.d.e",
+		},
+		{
+			name:             "brackets which are needed",
+			expressionString: "(a + b) * c - (-d) ^ 2 + (!up).x + (1).y",
+			expected:         "(a + b) * c - (-d) ^ 2 + (!up).x + (1).y",
+		},
+		{
+			name:             "nested expressions",
+			expressionString: "up ? f((0x10), (k)) : row[(k)]",
+			expected:         "up ? f(16, k) : row[k]",
+		},
+		{
+			name:             "try",
+			expressionString: "(try (a) else 0x1) + 1",
+			expected:         "(try a else 1) + 1",
+		},
+		{
+			name:             "let",
+			expressionString: "(let x = (0x1); (x)) + 1",
+			expected:         "(let x = 1; x) + 1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			before := expression.String()
+			if got := expression.Canonical(); got != test.expected {
+				t.Errorf("Canonical(%q) = %q, expected %q", test.expressionString, got, test.expected)
+			}
+			if after := expression.String(); after != before {
+				t.Errorf("Canonical(%q) modified the expression: %q, expected %q", test.expressionString, after, before)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: "a+1", b: "a + 1", expected: true},
+		{a: "(x) & 0xFF", b: "x & 255", expected: true},
+		{a: "\"s\"", b: "'s'", expected: true},
+		{a: "a + b", b: "b + a", expected: false},
+		{a: "a + b * c", b: "(a + b) * c", expected: false},
+		{a: "row.a", b: "row['a']", expected: false},
+	}
+	for _, test := range tests {
+		a, err := Parse(test.a)
+		if err != nil {
+			t.Fatalf("Parse(%q) got error: %v", test.a, err)
+		}
+		b, err := Parse(test.b)
+		if err != nil {
+			t.Fatalf("Parse(%q) got error: %v", test.b, err)
+		}
+		if got := Equal(a, b); got != test.expected {
+			t.Errorf("Equal(%q, %q) = %v, expected %v", test.a, test.b, got, test.expected)
+		}
+	}
+	if !Equal(nil, nil) {
+		t.Errorf("Equal(nil, nil) = false, expected true")
+	}
+}
@@ -0,0 +1,421 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// Functions for compiling parsed expressions, for repeated evaluation.
+
+// step evaluates a node of a compiled expression.
+type step func(ev *evaluation) (interface{}, error)
+
+/*
+Program is an expression compiled for repeated evaluation (see Expression.Compile). It is safe for
+concurrent use.
+*/
+type Program struct {
+	source string // The expression, for error messages.
+	run    step
+}
+
+/*
+Compile lowers the expression into a chain of closures, which evaluates to the same results as Eval
+without walking the levels of the grammar AST which do not apply an operator, eg: the nine levels
+above each operand of an addition. Literals are converted once, at compile time.
+*/
+func (e *Expression) Compile() *Program {
+	return &Program{source: e.String(), run: compileExpression(e)}
+}
+
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the program (see EvalWithOptions).
+func (p *Program) Eval(ctx Context, caller FunctionCaller, options Options) (interface{}, error) {
+	return p.evaluate(newEvaluation(ctx, caller, options))
+}
+
+// EvalWithResolver evaluates the program, resolving variables when they are referenced (see EvalWithResolver).
+func (p *Program) EvalWithResolver(resolver VariableResolver, caller FunctionCaller, options Options) (interface{}, error) {
+	ev := newEvaluation(Context{}, caller, options)
+	ev.resolver = resolver
+	return p.evaluate(ev)
+}
+
+func (p *Program) evaluate(ev *evaluation) (interface{}, error) {
+	result, err := p.run(ev)
+	ev.release()
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate expression `%v`: %v", p.source, err)
+	}
+	result = fromRat(result)
+	if glog.V(1) {
+		glog.Infof("Evaluated expression: %v = %v", p.source, result)
+	}
+	return result, nil
+}
+
+func compileExpression(e *Expression) step {
+	if e.Left == nil { // Can be nil if the expression is empty (ie: "").
+		return func(ev *evaluation) (interface{}, error) { return nil, nil }
+	}
+	operands := []step{compileDisjunction(e.Left)}
+	for _, r := range e.Right {
+		operands = append(operands, compileDisjunction(r.Disjunction))
+	}
+	condition := operands[0]
+	if len(operands) > 1 {
+		// Coalescing: the first operand which is not null.
+		condition = func(ev *evaluation) (interface{}, error) {
+			for _, operand := range operands {
+				l, err := operand(ev)
+				if err != nil || l != nil {
+					return l, err
+				}
+			}
+			return nil, nil
+		}
+	}
+	if e.Then == nil {
+		return condition
+	}
+	then, otherwise := compileExpression(e.Then), compileExpression(e.Else)
+	return func(ev *evaluation) (interface{}, error) {
+		c, err := condition(ev)
+		if err != nil {
+			return nil, err
+		}
+		b, err := boolean(c, "?")
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return then(ev)
+		}
+		return otherwise(ev)
+	}
+}
+
+func compileDisjunction(d *Disjunction) step {
+	operands := []step{compileConjunction(d.Left)}
+	for _, r := range d.Right {
+		operands = append(operands, compileConjunction(r.Conjunction))
+	}
+	return compileLogical(operands, "||", true)
+}
+
+func compileConjunction(c *Conjunction) step {
+	operands := []step{compileComparison(c.Left)}
+	for _, r := range c.Right {
+		operands = append(operands, compileComparison(r.Comparison))
+	}
+	return compileLogical(operands, "&&", false)
+}
+
+// compileLogical evaluates operands until one is the given result, eg: true for ||.
+func compileLogical(operands []step, operator string, result bool) step {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return func(ev *evaluation) (interface{}, error) {
+		for _, operand := range operands {
+			value, err := operand(ev)
+			if err != nil {
+				return nil, err
+			}
+			b, err := boolean(value, operator)
+			if err != nil {
+				return nil, err
+			}
+			if b == result {
+				return result, nil
+			}
+		}
+		return !result, nil
+	}
+}
+
+func compileComparison(c *Comparison) step {
+	left := compileBitOr(c.Left)
+	if c.Right == nil {
+		return left
+	}
+	return compileOperators(left, []Operator{c.Right.Operator}, []step{compileBitOr(c.Right.BitOr)}, false)
+}
+
+func compileBitOr(b *BitOr) step {
+	var operators []Operator
+	var operands []step
+	for _, r := range b.Right {
+		operators, operands = append(operators, r.Operator), append(operands, compileBitXor(r.BitXor))
+	}
+	return compileOperators(compileBitXor(b.Left), operators, operands, false)
+}
+
+func compileBitXor(b *BitXor) step {
+	var operators []Operator
+	var operands []step
+	for _, r := range b.Right {
+		operators, operands = append(operators, r.Operator), append(operands, compileBitAnd(r.BitAnd))
+	}
+	return compileOperators(compileBitAnd(b.Left), operators, operands, false)
+}
+
+func compileBitAnd(b *BitAnd) step {
+	var operators []Operator
+	var operands []step
+	for _, r := range b.Right {
+		operators, operands = append(operators, r.Operator), append(operands, compileShift(r.Shift))
+	}
+	return compileOperators(compileShift(b.Left), operators, operands, false)
+}
+
+func compileShift(s *Shift) step {
+	var operators []Operator
+	var operands []step
+	for _, r := range s.Right {
+		operators, operands = append(operators, r.Operator), append(operands, compileSum(r.Sum))
+	}
+	return compileOperators(compileSum(s.Left), operators, operands, false)
+}
+
+func compileSum(s *Sum) step {
+	var operators []Operator
+	var operands []step
+	for _, r := range s.Right {
+		operators, operands = append(operators, r.Operator), append(operands, compileTerm(r.Term))
+	}
+	return compileOperators(compileTerm(s.Left), operators, operands, true)
+}
+
+func compileTerm(t *Term) step {
+	var operators []Operator
+	var operands []step
+	for _, r := range t.Right {
+		operators, operands = append(operators, r.Operator), append(operands, compileFactor(r.Factor))
+	}
+	return compileOperators(compileFactor(t.Left), operators, operands, true)
+}
+
+/*
+compileOperators applies left-associative operators to operands. If check is true, each intermediate
+result is checked against the limits, as for arithmetic (see evaluation.check).
+*/
+func compileOperators(left step, operators []Operator, operands []step, check bool) step {
+	if len(operators) == 0 {
+		return left
+	}
+	return func(ev *evaluation) (interface{}, error) {
+		l, err := left(ev)
+		if err != nil {
+			return nil, err
+		}
+		for i, operand := range operands {
+			r, err := operand(ev)
+			if err != nil {
+				return nil, err
+			}
+			if l, err = operators[i].eval(ev, l, r); err != nil {
+				return nil, err
+			}
+			if check {
+				if err := ev.check(l); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return l, nil
+	}
+}
+
+func compileFactor(f *Factor) step {
+	base := compileValue(f.Base)
+	if f.Exponent == nil && !f.Negated {
+		return base
+	}
+	var exponent step
+	if f.Exponent != nil {
+		exponent = compileValue(f.Exponent)
+	}
+	return func(ev *evaluation) (interface{}, error) {
+		b, err := base(ev)
+		if err != nil {
+			return nil, err
+		}
+		if exponent != nil {
+			e, err := exponent(ev)
+			if err != nil {
+				return nil, err
+			}
+			if b, err = power(b, e); err != nil {
+				return nil, err
+			}
+		}
+		if f.Negated {
+			return negate(b)
+		}
+		return b, nil
+	}
+}
+
+func compileValue(v *Value) step {
+	operand := compileOperand(v)
+	for _, m := range v.Members {
+		operand = compileMember(operand, m)
+	}
+	return operand
+}
+
+func compileOperand(v *Value) step {
+	switch {
+	case v.Number != nil:
+		var float interface{} = v.Number.Float // Boxed once, rather than on every evaluation.
+		integer, isInteger := v.Number.integer()
+		rat := v.Number.rat() // Never modified, so shared by every evaluation.
+		return func(ev *evaluation) (interface{}, error) {
+			switch {
+			case ev.arithmetic == FloatArithmetic:
+				return float, nil
+			case isInteger && ev.arithmetic == IntegerArithmetic:
+				return ev.number(integer), nil
+			case rat != nil && ev.arithmetic == BigArithmetic:
+				return rat, nil
+			}
+			return ev.number(float), nil
+		}
+	case v.StrLiteral != nil:
+		var literal interface{} = *v.StrLiteral
+		return func(ev *evaluation) (interface{}, error) { return literal, nil }
+	case v.Variable != nil:
+		name := *v.Variable
+		return func(ev *evaluation) (interface{}, error) { return ev.variable(name) }
+	case v.Boolean != nil:
+		literal := bool(*v.Boolean)
+		return func(ev *evaluation) (interface{}, error) { return literal, nil }
+	case v.Not != nil:
+		operand := compileValue(v.Not)
+		return func(ev *evaluation) (interface{}, error) {
+			value, err := operand(ev)
+			if err != nil {
+				return nil, err
+			}
+			b, err := boolean(value, "!")
+			if err != nil {
+				return nil, err
+			}
+			return !b, nil
+		}
+	case v.Try != nil:
+		body, fallback := compileExpression(v.Try.Body), compileExpression(v.Try.Fallback)
+		return func(ev *evaluation) (interface{}, error) {
+			result, err := body(ev)
+			if _, ok := err.(limitError); err == nil || ok {
+				return result, err
+			}
+			return fallback(ev)
+		}
+	case v.Let != nil:
+		name := v.Let.Name
+		value, body := compileExpression(v.Let.Value), compileExpression(v.Let.Body)
+		return func(ev *evaluation) (interface{}, error) {
+			bound, err := value(ev)
+			if err != nil {
+				return nil, err
+			}
+			return ev.bind(name, bound, func() (interface{}, error) { return body(ev) })
+		}
+	case v.Function != nil:
+		return compileFunction(v.Function)
+	case v.Subexpression != nil:
+		return compileExpression(v.Subexpression)
+	}
+	return func(ev *evaluation) (interface{}, error) { return nil, nil } // Null.
+}
+
+func compileFunction(f *Function) step {
+	name := f.Name
+	var args []step
+	var keywords []string // The keywords of the keyword arguments, which follow the positional ones.
+	for _, arg := range f.Args {
+		args = append(args, compileExpression(&arg.Value))
+		if arg.Name != "" {
+			keywords = append(keywords, arg.Name)
+		}
+	}
+	positional := len(args) - len(keywords)
+	return func(ev *evaluation) (interface{}, error) {
+		depth := len(ev.args)
+		var keywordArgs KeywordArgs
+		for i, arg := range args {
+			value, err := arg(ev)
+			if err != nil {
+				ev.popArgs(depth)
+				return nil, err
+			}
+			if i < positional {
+				ev.pushArg(value)
+				continue
+			}
+			if keywordArgs == nil {
+				keywordArgs = make(KeywordArgs, len(keywords))
+			}
+			keywordArgs[keywords[i-positional]] = value
+		}
+		if keywordArgs != nil {
+			ev.pushArg(keywordArgs)
+		}
+		result, err := ev.callArgs(name, depth)
+		if err != nil {
+			return nil, err
+		}
+		return ev.number(result), nil
+	}
+}
+
+func compileMember(container step, m *Member) step {
+	if m.Name != nil {
+		key := *m.Name
+		return func(ev *evaluation) (interface{}, error) {
+			c, err := container(ev)
+			if err != nil {
+				return nil, err
+			}
+			return ev.member(c, key)
+		}
+	}
+	key := compileExpression(m.Key)
+	return func(ev *evaluation) (interface{}, error) {
+		c, err := container(ev)
+		if err != nil {
+			return nil, err
+		}
+		k, err := key(ev)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("key %v of a map must be a string, got %T", k, k)
+		}
+		return ev.member(c, s)
+	}
+}
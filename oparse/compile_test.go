@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompile(t *testing.T) {
+	expressions := []string{
+		"1+2*3+4/2",
+		"-2 ^ 2 - 7 % 4",
+		"1 << 4 | 3 & 5 ~ 1 >> 1",
+		"0x10 + 1e3",
+		"9007199254740993 + 1",
+		"'speed: ' + s + ' Mbps'",
+		"'a' + 'b' + 'c' + 'd'",
+		"a > 1 && b == 'x' || !c",
+		"false && missing || true",
+		"true || missing",
+		"a > 1 ? b : missing",
+		"a < 1 ? missing : (b + 'y')",
+		"1 ? 2 : 3",
+		"null ?? n ?? a",
+		"m.a + m['b'] + m[b]",
+		"m.missing ?? m.a",
+		"n.a",
+		"m[a]",
+		"a.b",
+		"f(a, g(b), 'c') + 1",
+		"f(a, x=g(b), y='c') + 1",
+		"f()",
+		"missing",
+		"i + 1",
+		"u + 1",
+		"a / 0",
+		"s + s + s + s",
+		"g(1) + g(2) + g(3)",
+		"try missing else a + 1",
+		"try i + 1 else try 'a' - 1 else b",
+		"try g(1) + g(2) + g(3) else 0",
+		"let x = a * 2; x + x",
+		"let a = b; let b = a + 'y'; a + b",
+		"(let x = 1; x) + x",
+		"let x = s + s; x + x",
+	}
+	ctx := Context{
+		"a": 3,
+		"b": "x",
+		"c": false,
+		"s": strings.Repeat("s", 8),
+		"m": map[string]int{"a": 1, "b": 2, "x": 3},
+		"n": nil,
+		"i": int64(math.MaxInt64),
+		"u": uint64(1),
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return len(args), nil
+	}
+	options := []Options{
+		{},
+		{Arithmetic: IntegerArithmetic},
+		{Arithmetic: BigArithmetic},
+		{Limits: Limits{MaxStringLength: 20, MaxCalls: 2}},
+	}
+	for _, expressionString := range expressions {
+		expression, err := Parse(expressionString)
+		if err != nil {
+			t.Fatalf("Parse(%q) got error: %v", expressionString, err)
+		}
+		program := expression.Compile()
+		for _, o := range options {
+			expected, expectedErr := EvalWithOptions(expression, ctx, caller, o)
+			got, err := program.Eval(ctx, caller, o)
+			switch {
+			case expectedErr == nil && err != nil:
+				t.Errorf("Compile(%q).Eval(%+v) got error `%v`, expected %v", expressionString, o, err, expected)
+			case expectedErr != nil && err == nil:
+				t.Errorf("Compile(%q).Eval(%+v) got %v, expected error `%v`", expressionString, o, got, expectedErr)
+			case !cmp.Equal(expected, got):
+				t.Errorf("Compile(%q).Eval(%+v) got %v (%T), expected %v (%T)", expressionString, o, got, got, expected, expected)
+			}
+		}
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	ctx := Context{
+		"boot_time":            1545178344,
+		"last_change_relative": 50,
+		"system_up_time_100":   "2000000000",
+		"system_time":          "dfc4 0b68 8147 af78",
+		"up_time":              "2000000000",
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return 1.0, nil
+	}
+	for _, bm := range benchmarkExpressions {
+		expression, err := Parse(bm.expression)
+		if err != nil {
+			b.Fatalf("Parse(%q) got error: %v", bm.expression, err)
+		}
+		program := expression.Compile()
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := program.Eval(ctx, caller, Options{}); err != nil {
+					b.Fatalf("Compile(%q).Eval got error: %v", bm.expression, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Functions for folding constant sub-expressions.
+
+/*
+Fold returns a copy of the expression in which constant sub-expressions, ie: those without variables or
+function calls, are replaced by their values, eg: `x * (1000 * 1000)` becomes `x * 1000000`. Named
+constants (see Options.Constants) are constant too, eg: `x * MEGA`. Sub-expressions are evaluated with
+the given options, so an expression should be folded with the options it will be evaluated with.
+Sub-expressions which fail to evaluate (eg: `1 / 0`), or whose values cannot be written as literals
+(eg: maps), are left as they are, so that they fail (or are handled) when the expression is evaluated.
+*/
+func (e *Expression) Fold(options Options) *Expression {
+	// Fold a copy, leaving the expression as it is.
+	folded, err := Parse(e.String())
+	if err != nil {
+		return e
+	}
+	Walk(folded, folder{options: options, bound: folded.bound()})
+	return folded
+}
+
+// folder is a Visitor which replaces the constant nodes it visits by literals.
+type folder struct {
+	options Options
+	bound   map[*Value]bool // References to the bindings of lets, which are not constant.
+}
+
+// evaluable is implemented by the nodes which can be replaced by literals.
+type evaluable interface {
+	Node
+	eval(ev *evaluation) (interface{}, error)
+}
+
+func (f folder) Visit(node Node) Visitor {
+	n, ok := node.(evaluable)
+	if !ok || !f.constant(n) {
+		return f
+	}
+	if !foldable(n) {
+		return nil // A literal already, as is everything within it.
+	}
+	value, err := n.eval(newEvaluation(nil, nil, f.options))
+	if err != nil {
+		return f
+	}
+	literal, ok := f.literal(value)
+	if !ok || !replace(n, literal) {
+		return f
+	}
+	return nil
+}
+
+// constant returns true if the node does not call functions or use variables other than named constants.
+func (f folder) constant(node Node) bool {
+	constant := true
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *Function:
+			constant = false
+		case *Value:
+			if n.Variable != nil && (f.bound[n] || !f.isConstant(*n.Variable)) {
+				constant = false
+			}
+		}
+		return constant
+	})
+	return constant
+}
+
+func (f folder) isConstant(name string) bool {
+	_, ok := f.options.Constants[name]
+	return ok
+}
+
+// foldable returns true if the node is not a single literal, ie: folding it would change it.
+func foldable(node Node) bool {
+	foldable := false
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *OpDisjunction, *OpConjunction, *OpComparison, *OpBitOr, *OpBitXor, *OpBitAnd, *OpShift, *OpSum, *OpTerm, *OpFactor:
+			foldable = true
+		case *Expression:
+			foldable = foldable || n.Then != nil
+		case *Factor:
+			foldable = foldable || n.Negated || n.Exponent != nil
+		case *Value:
+			foldable = foldable || n.Variable != nil || n.Not != nil || n.Try != nil || n.Let != nil || n.Subexpression != nil || len(n.Members) > 0
+		}
+		return !foldable
+	})
+	return foldable
+}
+
+/*
+literal returns an expression consisting of the given value as a literal, or false if the value cannot
+be written as one.
+*/
+func (f folder) literal(value interface{}) (*Expression, bool) {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		text = "null"
+	case bool:
+		text = strconv.FormatBool(v)
+	case string:
+		text = (&Value{StrLiteral: &v}).operandString()
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case uint64:
+		text = strconv.FormatUint(v, 10)
+	case *big.Rat:
+		if !v.IsInt() {
+			return nil, false // Not exactly representable as a literal.
+		}
+		text = v.Num().String()
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, false
+		}
+		format := byte('g')
+		if v == math.Trunc(v) && math.Abs(v) < maxExactFloat {
+			format = 'f' // Integers in decimal, eg: 1000000 rather than 1e+06.
+		}
+		text = strconv.FormatFloat(v, format, -1, 64)
+		// Integral floats must remain floats in IntegerArithmetic (see Number.integer).
+		if f.options.Arithmetic == IntegerArithmetic && !strings.ContainsAny(text, ".e") {
+			text += ".0"
+		}
+	default:
+		return nil, false
+	}
+	literal, err := Parse(text)
+	return literal, err == nil
+}
+
+/*
+replace replaces a node by the node at the same level of the given literal expression, returning false
+if the node is not of a level which can be replaced.
+*/
+func replace(node Node, literal *Expression) bool {
+	disjunction := literal.Left
+	conjunction := disjunction.Left
+	comparison := conjunction.Left
+	bitOr := comparison.Left
+	bitXor := bitOr.Left
+	bitAnd := bitXor.Left
+	shift := bitAnd.Left
+	sum := shift.Left
+	term := sum.Left
+	factor := term.Left
+	switch n := node.(type) {
+	case *Expression:
+		*n = *literal
+	case *Disjunction:
+		*n = *disjunction
+	case *Conjunction:
+		*n = *conjunction
+	case *Comparison:
+		*n = *comparison
+	case *BitOr:
+		*n = *bitOr
+	case *BitXor:
+		*n = *bitXor
+	case *BitAnd:
+		*n = *bitAnd
+	case *Shift:
+		*n = *shift
+	case *Sum:
+		*n = *sum
+	case *Term:
+		*n = *term
+	case *Factor:
+		*n = *factor
+	case *Value:
+		if factor.Negated { // Negative numbers need brackets to be values, eg: `a ^ (-1)`.
+			*n = Value{Subexpression: literal}
+		} else {
+			*n = *factor.Base
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "testing"
+
+func TestFold(t *testing.T) {
+	constants := Context{
+		"KILO":             1000,
+		"MEGA":             1000000,
+		"NTP_EPOCH_OFFSET": 2208988800,
+		"UNIT":             "Mbps",
+		"UNITS":            map[string]interface{}{"kB": 1024},
+	}
+	tests := []struct {
+		name             string
+		expressionString string
+		arithmetic       Arithmetic
+		expected         string
+	}{
+		{
+			name:             "arithmetic",
+			expressionString: "x * (1000 * 1000)",
+			expected:         "x * 1000000",
+		},
+		{
+			name:             "named constants",
+			expressionString: "(seconds - NTP_EPOCH_OFFSET) * KILO + MEGA / KILO",
+			expected:         "(seconds - 2208988800) * 1000 + 1000",
+		},
+		{
+			name:             "whole expression",
+			expressionString: "1 << 4 | 1 == 17 ? 'a' + UNIT : null",
+			expected:         "'aMbps'",
+		},
+		{
+			name:             "left-associative operators",
+			expressionString: "x + 1 + 2",
+			expected:         "x + 1 + 2",
+		},
+		{
+			name:             "negative values",
+			expressionString: "x ^ (0 - 1) - (2 - 3)",
+			expected:         "x ^ (-1) - -1",
+		},
+		{
+			name:             "functions are not constant",
+			expressionString: "f(1 + 1) + f(1)",
+			expected:         "f(2) + f(1)",
+		},
+		{
+			name:             "nested expressions",
+			expressionString: "up ? row[UNIT + '_in'] : (x ?? 1 + 1)",
+			expected:         "up ? row['Mbps_in'] : (x ?? 2)",
+		},
+		{
+			name:             "members of map constants",
+			expressionString: "x * UNITS.kB + UNITS.MB",
+			expected:         "x * 1024 + null",
+		},
+		{
+			name:             "map constants are not literals",
+			expressionString: "UNITS[x]",
+			expected:         "UNITS[x]",
+		},
+		{
+			name:             "errors are left to evaluation",
+			expressionString: "try 'a' - 1 else x",
+			expected:         "try 'a' - 1 else x",
+		},
+		{
+			name:             "literals are left as they are",
+			expressionString: "x + 0x10",
+			expected:         "x + 0x10",
+		},
+		{
+			name:             "let",
+			expressionString: "let y = 2 * KILO; y * x",
+			expected:         "let y = 2000; y * x",
+		},
+		{
+			name:             "let bindings shadow constants",
+			expressionString: "let KILO = x; KILO * MEGA",
+			expected:         "let KILO = x; KILO * 1000000",
+		},
+		{
+			name:             "integer arithmetic",
+			expressionString: "x + 7 / 2 + 7 / 2 * 2 + 2 * 2",
+			arithmetic:       IntegerArithmetic,
+			expected:         "x + 3.5 + 7.0 + 4",
+		},
+		{
+			name:             "big arithmetic",
+			expressionString: "x * (2 ^ 64 * 2) + 1 / 4",
+			arithmetic:       BigArithmetic,
+			expected:         "x * 36893488147419103232 + 1 / 4",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			options := Options{Arithmetic: test.arithmetic, Constants: constants}
+			before := expression.String()
+			folded := expression.Fold(options)
+			if got := folded.String(); got != test.expected {
+				t.Errorf("Fold(%q) = %q, expected %q", test.expressionString, got, test.expected)
+			}
+			if after := expression.String(); after != before {
+				t.Errorf("Fold(%q) modified the expression: %q, expected %q", test.expressionString, after, before)
+			}
+			// Folding does not change the result.
+			ctx := Context{"x": 2, "seconds": 2208988801, "up": false, "row": map[string]int{}}
+			caller := func(funcName string, args ...interface{}) (interface{}, error) { return args[0], nil }
+			expected, expectedErr := EvalWithOptions(expression, ctx, caller, options)
+			got, err := EvalWithOptions(folded, ctx, caller, options)
+			if (err != nil) != (expectedErr != nil) || got != expected {
+				t.Errorf("Fold(%q) evaluates to %v (error %v), expected %v (error %v)", test.expressionString, got, err, expected, expectedErr)
+			}
+		})
+	}
+}
+
+func TestConstants(t *testing.T) {
+	expression, err := Parse("MEGA + x")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	options := Options{Constants: Context{"MEGA": 1000000}}
+	// Named constants take precedence over variables, as they would once folded.
+	got, err := EvalWithOptions(expression, Context{"MEGA": 1, "x": 1}, nil, options)
+	if err != nil || got != 1000001.0 {
+		t.Errorf("EvalWithOptions() = %v (error %v), expected 1000001", got, err)
+	}
+}
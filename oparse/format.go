@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Functions for formatting numbers which are concatenated with strings.
+
+/*
+NumberFormat controls how numbers are formatted when they are concatenated with strings (see Options),
+eg: so that a string leaf built from a counter stays "42000000" rather than becoming "4.2e+07" once
+the counter grows. Integers in IntegerArithmetic and BigArithmetic are always formatted as digits.
+*/
+type NumberFormat struct {
+	/*
+		Verb is a format of strconv.FormatFloat: 'f' (eg: 42000000.5), 'e' (eg: 4.20000005e+07) or 'g'
+		('e' for large exponents, 'f' otherwise), or 0 to format numbers as %v does.
+	*/
+	Verb byte
+	// Precision is the number of digits (after the point, for 'f' and 'e'), or -1 for as many as needed.
+	Precision int
+}
+
+/*
+ParseNumberFormat parses a number format written as a Printf verb: "%v", or "%f", "%e" or "%g" with an
+optional precision, eg: "%.2f". Unlike Printf, a verb without a precision uses as many digits as are
+needed to represent each number exactly, eg: "%f" formats 0.5 as "0.5", and 42000000 as "42000000".
+*/
+func ParseNumberFormat(s string) (NumberFormat, error) {
+	if s == "%v" {
+		return NumberFormat{}, nil
+	}
+	if len(s) < 2 || s[0] != '%' || !strings.ContainsRune("feg", rune(s[len(s)-1])) {
+		return NumberFormat{}, fmt.Errorf("number format %q must be %%v, %%f, %%e or %%g, with an optional precision (eg: %%.2f)", s)
+	}
+	f := NumberFormat{Verb: s[len(s)-1], Precision: -1}
+	if precision := s[1 : len(s)-1]; precision != "" {
+		p, err := strconv.Atoi(strings.TrimPrefix(precision, "."))
+		if err != nil || !strings.HasPrefix(precision, ".") || p < 0 {
+			return NumberFormat{}, fmt.Errorf("invalid precision %q in number format %q", precision, s)
+		}
+		f.Precision = p
+	}
+	return f, nil
+}
+
+// String returns the format as ParseNumberFormat parses it.
+func (f NumberFormat) String() string {
+	switch {
+	case f.Verb == 0:
+		return "%v"
+	case f.Precision < 0:
+		return "%" + string(f.Verb)
+	}
+	return fmt.Sprintf("%%.%d%c", f.Precision, f.Verb)
+}
+
+func (f NumberFormat) format(n float64) string {
+	if f.Verb == 0 {
+		return fmt.Sprint(n)
+	}
+	return strconv.FormatFloat(n, f.Verb, f.Precision, 64)
+}
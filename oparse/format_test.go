@@ -0,0 +1,127 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "testing"
+
+func TestParseNumberFormat(t *testing.T) {
+	tests := []struct {
+		format        string
+		expected      NumberFormat
+		expectedError bool
+	}{
+		{format: "%v", expected: NumberFormat{}},
+		{format: "%f", expected: NumberFormat{Verb: 'f', Precision: -1}},
+		{format: "%.2f", expected: NumberFormat{Verb: 'f', Precision: 2}},
+		{format: "%.0e", expected: NumberFormat{Verb: 'e', Precision: 0}},
+		{format: "%.12g", expected: NumberFormat{Verb: 'g', Precision: 12}},
+		{format: "", expectedError: true},
+		{format: "f", expectedError: true},
+		{format: "%d", expectedError: true},
+		{format: "%2f", expectedError: true},
+		{format: "%.f", expectedError: true},
+		{format: "%.-1f", expectedError: true},
+		{format: "%.2f%%", expectedError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			got, err := ParseNumberFormat(test.format)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("ParseNumberFormat(%q) = %+v, expected an error", test.format, got)
+				}
+				return
+			}
+			if err != nil || got != test.expected {
+				t.Errorf("ParseNumberFormat(%q) = %+v (error %v), expected %+v", test.format, got, err, test.expected)
+			}
+			if s := got.String(); s != test.format {
+				t.Errorf("ParseNumberFormat(%q).String() = %q, expected %q", test.format, s, test.format)
+			}
+		})
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		format           string
+		arithmetic       Arithmetic
+		expected         string
+	}{
+		{
+			name:             "default",
+			expressionString: "'' + x + ' ' + y",
+			format:           "%v",
+			expected:         "4.2e+07 0.125",
+		},
+		{
+			name:             "exact",
+			expressionString: "'' + x + ' ' + y",
+			format:           "%f",
+			expected:         "42000000 0.125",
+		},
+		{
+			name:             "precision",
+			expressionString: "'' + x + ' ' + y",
+			format:           "%.2f",
+			expected:         "42000000.00 0.12",
+		},
+		{
+			name:             "exponent",
+			expressionString: "y + ' ' + x",
+			format:           "%.1e",
+			expected:         "1.2e-01 4.2e+07",
+		},
+		{
+			name:             "integers are digits",
+			expressionString: "'' + x + ' ' + 7 / 2",
+			format:           "%.2f",
+			arithmetic:       IntegerArithmetic,
+			expected:         "42000000 3.50",
+		},
+		{
+			name:             "big integers are digits",
+			expressionString: "'' + x * 2 ^ 64 + ' ' + 1 / 3",
+			format:           "%.3f",
+			arithmetic:       BigArithmetic,
+			expected:         "774763251095801167872000000 0.333",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			format, err := ParseNumberFormat(test.format)
+			if err != nil {
+				t.Fatalf("ParseNumberFormat(%q) got error: %v", test.format, err)
+			}
+			ctx := Context{"x": 42000000, "y": 0.125}
+			options := Options{Arithmetic: test.arithmetic, NumberFormat: format}
+			got, err := EvalWithOptions(expression, ctx, nil, options)
+			if err != nil || got != test.expected {
+				t.Errorf("EvalWithOptions(%q) = %v (error %v), expected %q", test.expressionString, got, err, test.expected)
+			}
+			if got, err := expression.Compile().Eval(ctx, nil, options); err != nil || got != test.expected {
+				t.Errorf("Compile(%q).Eval = %v (error %v), expected %q", test.expressionString, got, err, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Run with eg: go test ./oparse -run '^$' -fuzz FuzzEval -fuzztime 1m
+
+// fuzzSeeds exercise every rule of the grammar.
+var fuzzSeeds = []string{
+	"1+2*3+4/2 - -5 % 3",
+	"-2 ^ 0.5 ^ a",
+	"1 << 63 | 3 & 5 ~ u >> 1",
+	"0x10 + 1e3 + 9007199254740993",
+	"'a' + \"b\" + s",
+	"a > 1 && b == 'x' || !c",
+	"a != 1 ? b : (c ?? null)",
+	"m.a + m['b'] + m[b]",
+	"f(a, g(b), 'c').x",
+	"f(a, x=g(b), y='c')",
+	"try 'a' - 1 else let x = a / 100; x * (x + 1)",
+	"a |> f |> g(1)",
+	"(((((a)))))",
+	"i + i * i - u",
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		expression, err := Parse(input)
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("Parse(%q) got error of type %T, expected a *ParseError", input, err)
+			}
+			return
+		}
+		// An expression's string is an equivalent expression, and so are its rewrites.
+		for _, s := range []string{expression.String(), expression.Canonical(), expression.Fold(Options{}).String()} {
+			reparsed, err := Parse(s)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error on reparsing %q: %v", input, s, err)
+			}
+			if got := reparsed.String(); got != s {
+				t.Fatalf("Parse(%q) reparsed %q as %q", input, s, got)
+			}
+		}
+		expression.Identifiers()
+		expression.OptionalVariables()
+		expression.RequiredVariables()
+	})
+}
+
+func FuzzEval(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	ctx := Context{
+		"a": 3,
+		"b": "x",
+		"c": false,
+		"s": "s",
+		"m": map[string]int{"a": 1, "b": 2, "x": 3},
+		"i": int64(math.MinInt64),
+		"u": uint64(math.MaxUint64),
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return map[string]interface{}{"x": 1}, nil
+		}
+		return args[0], nil
+	}
+	limits := Limits{MaxStringLength: 1 << 10, MaxCalls: 100, Timeout: time.Second}
+	f.Fuzz(func(t *testing.T, input string) {
+		expression, err := Parse(input)
+		if err != nil {
+			return
+		}
+		program := expression.Compile()
+		for _, arithmetic := range []Arithmetic{FloatArithmetic, IntegerArithmetic, BigArithmetic} {
+			options := Options{Limits: limits, Arithmetic: arithmetic}
+			expected, expectedErr := EvalWithOptions(expression, ctx, caller, options)
+			got, err := program.Eval(ctx, caller, options)
+			if (err != nil) != (expectedErr != nil) {
+				t.Fatalf("Compile(%q).Eval() got error %v, expected error %v", input, err, expectedErr)
+			}
+			// NaN is not equal to itself.
+			if f, ok := expected.(float64); err == nil && !(ok && math.IsNaN(f)) && !cmp.Equal(expected, got) {
+				t.Fatalf("Compile(%q).Eval() got %v, expected %v", input, got, expected)
+			}
+		}
+	})
+}
@@ -0,0 +1,631 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"fmt"
+)
+
+// Functions for parsing tokens into the grammar AST.
+
+/*
+parser is a recursive descent parser, with a function for each node of the grammar AST. The grammar is
+documented by the struct tags of the nodes, in Participle's notation, and the parser builds the same
+AST as Participle would from them (this is tested), looking at most two tokens ahead. Quoted strings
+are only ever string literals, never operators or keywords, eg: `1 '+' 2` is not an addition.
+*/
+type parser struct {
+	tokens  []token      // Ending with a tokenEOF.
+	next    int          // The index of the next token.
+	deepest *syntaxError // The furthest error backtracked from, if any (see backtrack).
+}
+
+// parse parses tokens into an expression, which is not desugared (see Expression.desugar).
+func parse(tokens []token) (*Expression, error) {
+	p := &parser{tokens: tokens}
+	if p.peek(0).kind == tokenEOF {
+		return nil, p.unexpected("an expression")
+	}
+	expression, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek(0).kind != tokenEOF {
+		if p.deepest != nil && p.deepest.offset > p.peek(0).start {
+			return nil, p.deepest
+		}
+		return nil, p.unexpected("an operator")
+	}
+	return expression, nil
+}
+
+// peek returns the token n tokens ahead, or the tokenEOF at the end.
+func (p *parser) peek(n int) token {
+	if p.next+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.next+n]
+}
+
+// is returns true if the token n tokens ahead is the given punctuation.
+func (p *parser) is(n int, punct string) bool {
+	t := p.peek(n)
+	return t.kind == tokenPunct && t.text == punct
+}
+
+// isIdent returns true if the token n tokens ahead is the given identifier.
+func (p *parser) isIdent(n int, name string) bool {
+	t := p.peek(n)
+	return t.kind == tokenIdent && t.text == name
+}
+
+// expect skips the given punctuation, or returns an error if it is not the next token.
+func (p *parser) expect(punct string) error {
+	if !p.is(0, punct) {
+		return p.unexpected(fmt.Sprintf("%q", punct))
+	}
+	p.next++
+	return nil
+}
+
+// ident returns the next token, which must be an identifier.
+func (p *parser) ident() (string, error) {
+	if t := p.peek(0); t.kind != tokenIdent {
+		return "", p.unexpected("a name")
+	}
+	p.next++
+	return p.tokens[p.next-1].text, nil
+}
+
+// unexpected returns an error for the next token, which is not what was expected.
+func (p *parser) unexpected(expected string) *syntaxError {
+	t := p.peek(0)
+	return &syntaxError{offset: t.start, message: fmt.Sprintf("unexpected %v (expected %v)", t, expected)}
+}
+
+/*
+backtrack is called with the error of an optional or repeated part of the grammar, starting at the
+given token, which failed after matching its first token (eg: `+ )` of `(a + )`). As in Participle,
+which looks one token ahead, the part is then not matched: parsing resumes from its start, so that the
+enclosing part reports the error (eg: at "+", expecting ")"). The error is kept in case the input then
+ends before it (see parse), eg: so that `1 +` is reported at its end rather than at "+". Errors after
+the second token of the part (eg: at ")" of `(a + -)`), or other than syntax errors (eg: of limits),
+are returned.
+*/
+func (p *parser) backtrack(start int, err error) error {
+	syntaxErr, ok := err.(*syntaxError)
+	if !ok || start+1 < len(p.tokens) && syntaxErr.offset > p.tokens[start+1].start {
+		return err
+	}
+	if p.deepest == nil || syntaxErr.offset > p.deepest.offset {
+		p.deepest = syntaxErr
+	}
+	p.next = start
+	return nil
+}
+
+func (p *parser) expression() (*Expression, error) {
+	left, err := p.disjunction()
+	if err != nil {
+		return nil, err
+	}
+	e := &Expression{Left: left}
+	for p.is(0, "?") && p.is(1, "?") {
+		start := p.next
+		p.next += 2
+		right, err := p.disjunction()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		e.Right = append(e.Right, &OpDisjunction{Operator: OpCoalesce, Disjunction: right})
+	}
+	for p.is(0, "|") && p.is(1, ">") {
+		p.next += 2
+		pipe, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		e.Pipes = append(e.Pipes, pipe)
+	}
+	if !p.is(0, "?") {
+		return e, nil
+	}
+	start := p.next
+	p.next++
+	if e.Then, err = p.expression(); err != nil {
+		return e, p.backtrack(start, err)
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if e.Else, err = p.expression(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *parser) pipe() (*Pipe, error) {
+	if p.isCall(0) {
+		function, err := p.function()
+		if err != nil {
+			return nil, err
+		}
+		return &Pipe{Function: function}, nil
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	return &Pipe{Name: &name}, nil
+}
+
+func (p *parser) disjunction() (*Disjunction, error) {
+	left, err := p.conjunction()
+	if err != nil {
+		return nil, err
+	}
+	d := &Disjunction{Left: left}
+	for p.is(0, "|") && p.is(1, "|") {
+		start := p.next
+		p.next += 2
+		right, err := p.conjunction()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		d.Right = append(d.Right, &OpConjunction{Operator: OpOr, Conjunction: right})
+	}
+	return d, nil
+}
+
+func (p *parser) conjunction() (*Conjunction, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	c := &Conjunction{Left: left}
+	for p.is(0, "&") && p.is(1, "&") {
+		start := p.next
+		p.next += 2
+		right, err := p.comparison()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		c.Right = append(c.Right, &OpComparison{Operator: OpAnd, Comparison: right})
+	}
+	return c, nil
+}
+
+func (p *parser) comparison() (*Comparison, error) {
+	left, err := p.bitOr()
+	if err != nil {
+		return nil, err
+	}
+	c := &Comparison{Left: left}
+	var operator Operator
+	switch {
+	case p.is(0, "=") && p.is(1, "="):
+		operator = OpEq
+	case p.is(0, "!") && p.is(1, "="):
+		operator = OpNe
+	case p.is(0, "<") && p.is(1, "="):
+		operator = OpLe
+	case p.is(0, ">") && p.is(1, "="):
+		operator = OpGe
+	case p.is(0, "<"):
+		operator = OpLt
+	case p.is(0, ">"):
+		operator = OpGt
+	default:
+		return c, nil
+	}
+	start := p.next
+	p.next += len(operator.String()) // A token per character of the operator.
+	right, err := p.bitOr()
+	if err != nil {
+		return c, p.backtrack(start, err)
+	}
+	c.Right = &OpBitOr{Operator: operator, BitOr: right}
+	return c, nil
+}
+
+// A bitwise or is a single |, which is not part of a logical or (||) or a pipe (|>).
+func (p *parser) bitOr() (*BitOr, error) {
+	left, err := p.bitXor()
+	if err != nil {
+		return nil, err
+	}
+	b := &BitOr{Left: left}
+	for p.is(0, "|") && !p.is(1, "|") && !p.is(1, ">") {
+		start := p.next
+		p.next++
+		right, err := p.bitXor()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		b.Right = append(b.Right, &OpBitXor{Operator: OpBitwiseOr, BitXor: right})
+	}
+	return b, nil
+}
+
+func (p *parser) bitXor() (*BitXor, error) {
+	left, err := p.bitAnd()
+	if err != nil {
+		return nil, err
+	}
+	b := &BitXor{Left: left}
+	for p.is(0, "~") {
+		start := p.next
+		p.next++
+		right, err := p.bitAnd()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		b.Right = append(b.Right, &OpBitAnd{Operator: OpBitwiseXor, BitAnd: right})
+	}
+	return b, nil
+}
+
+// A bitwise and is a single &, which is not part of a logical and (&&).
+func (p *parser) bitAnd() (*BitAnd, error) {
+	left, err := p.shift()
+	if err != nil {
+		return nil, err
+	}
+	b := &BitAnd{Left: left}
+	for p.is(0, "&") && !p.is(1, "&") {
+		start := p.next
+		p.next++
+		right, err := p.shift()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		b.Right = append(b.Right, &OpShift{Operator: OpBitwiseAnd, Shift: right})
+	}
+	return b, nil
+}
+
+func (p *parser) shift() (*Shift, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	s := &Shift{Left: left}
+	for {
+		var operator Operator
+		switch {
+		case p.is(0, "<") && p.is(1, "<"):
+			operator = OpShl
+		case p.is(0, ">") && p.is(1, ">"):
+			operator = OpShr
+		default:
+			return s, nil
+		}
+		start := p.next
+		p.next += 2
+		right, err := p.sum()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+		s.Right = append(s.Right, &OpSum{Operator: operator, Sum: right})
+	}
+}
+
+func (p *parser) sum() (*Sum, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	s := &Sum{Left: left}
+	for p.is(0, "+") || p.is(0, "-") {
+		start := p.next
+		operator := operatorMap[p.peek(0).text]
+		p.next++
+		right, err := p.term()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		s.Right = append(s.Right, &OpTerm{Operator: operator, Term: right})
+	}
+	return s, nil
+}
+
+func (p *parser) term() (*Term, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	t := &Term{Left: left}
+	for p.is(0, "*") || p.is(0, "/") || p.is(0, "%") {
+		start := p.next
+		operator := operatorMap[p.peek(0).text]
+		p.next++
+		right, err := p.factor()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		t.Right = append(t.Right, &OpFactor{Operator: operator, Factor: right})
+	}
+	return t, nil
+}
+
+func (p *parser) factor() (*Factor, error) {
+	f := &Factor{}
+	if p.is(0, "-") {
+		f.Negated = true
+		p.next++
+	}
+	var err error
+	if f.Base, err = p.value(); err != nil {
+		return nil, err
+	}
+	if p.is(0, "^") {
+		start := p.next
+		p.next++
+		if f.Exponent, err = p.value(); err != nil {
+			return f, p.backtrack(start, err)
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) value() (*Value, error) {
+	v := &Value{}
+	t := p.peek(0)
+	var err error
+	switch {
+	case t.kind == tokenInt || t.kind == tokenFloat:
+		v.Number = &Number{}
+		if err := v.Number.Capture([]string{t.text}); err != nil {
+			return nil, &syntaxError{offset: t.start, message: err.Error()}
+		}
+		p.next++
+	case t.kind == tokenString:
+		text := t.text
+		v.StrLiteral = &text
+		p.next++
+	case p.is(1, ".") && p.isCall(0):
+		// A namespaced call, whose namespace may be any name, even a keyword (eg: `null.f()`).
+		if v.Function, err = p.function(); err != nil {
+			return nil, err
+		}
+	case p.isIdent(0, "true") || p.isIdent(0, "false"):
+		b := Boolean(t.text == "true")
+		v.Boolean = &b
+		p.next++
+	case p.isIdent(0, "null"):
+		v.Null = true
+		p.next++
+	case p.is(0, "!"):
+		p.next++
+		if v.Not, err = p.value(); err != nil {
+			return nil, err
+		}
+	case p.isIdent(0, "try") && p.startsExpression(1):
+		if v.Try, err = p.try(); err != nil {
+			return nil, err
+		}
+	case p.isIdent(0, "let") && p.peek(1).kind == tokenIdent:
+		if v.Let, err = p.let(); err != nil {
+			return nil, err
+		}
+	case t.kind == tokenIdent && p.is(1, "("):
+		if v.Function, err = p.function(); err != nil {
+			return nil, err
+		}
+	case t.kind == tokenIdent:
+		name := t.text
+		v.Variable = &name
+		p.next++
+	case p.is(0, "("):
+		p.next++
+		if v.Subexpression, err = p.expression(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.unexpected("a value")
+	}
+	for p.is(0, ".") || p.is(0, "[") {
+		start := p.next
+		member, err := p.member()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		v.Members = append(v.Members, member)
+	}
+	return v, nil
+}
+
+/*
+startsExpression returns true if the token n tokens ahead can start an expression, so that `try` is a
+keyword before it, and a name before anything else (eg: in `try != 1`, or `try()`).
+*/
+func (p *parser) startsExpression(n int) bool {
+	switch t := p.peek(n); t.kind {
+	case tokenIdent, tokenInt, tokenFloat, tokenString:
+		return true
+	case tokenPunct:
+		return t.text == "(" && !p.is(n+1, ")") || t.text == "-" || t.text == "!" && !p.is(n+1, "=")
+	}
+	return false
+}
+
+func (p *parser) member() (*Member, error) {
+	if p.is(0, ".") {
+		p.next++
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		return &Member{Name: &name}, nil
+	}
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	key, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return &Member{Key: key}, nil
+}
+
+func (p *parser) try() (*Try, error) {
+	p.next++ // try
+	body, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isIdent(0, "else") {
+		return nil, p.unexpected(`"else"`)
+	}
+	p.next++
+	fallback, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &Try{Body: body, Fallback: fallback}, nil
+}
+
+func (p *parser) let() (*Let, error) {
+	p.next++ // let
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	body, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &Let{Name: name, Value: value, Body: body}, nil
+}
+
+/*
+isCall returns true if the tokens n tokens ahead start a function call: a name, or a name qualified by
+namespaces (eg: `cisco.parse_envmon`), followed by "(". A member of a variable cannot be called, so a
+qualified name before "(" is always that of a function.
+*/
+func (p *parser) isCall(n int) bool {
+	if p.peek(n).kind != tokenIdent {
+		return false
+	}
+	for n++; p.is(n, ".") && p.peek(n+1).kind == tokenIdent; n += 2 {
+	}
+	return p.is(n, "(")
+}
+
+// functionName returns the name of the function called next, with its namespaces (see isCall).
+func (p *parser) functionName() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	for p.is(0, ".") && p.peek(1).kind == tokenIdent {
+		name += "." + p.peek(1).text
+		p.next += 2
+	}
+	return name, nil
+}
+
+func (p *parser) function() (*Function, error) {
+	name, err := p.functionName()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	f := &Function{Name: name}
+	for !p.is(0, ")") {
+		start := p.next
+		if len(f.Args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, p.unexpected(`"," or ")"`)
+			}
+		}
+		arg, err := p.arg()
+		if err != nil {
+			if err := p.backtrack(start, err); err != nil {
+				return nil, err
+			}
+			return nil, p.unexpected(`")"`)
+		}
+		f.Args = append(f.Args, arg)
+	}
+	p.next++ // )
+	return f, nil
+}
+
+func (p *parser) arg() (*Arg, error) {
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	arg := &Arg{Value: *value}
+	if p.is(0, "=") {
+		start := p.next
+		p.next++
+		if arg.Keyword, err = p.expression(); err != nil {
+			return arg, p.backtrack(start, err)
+		}
+	}
+	return arg, nil
+}
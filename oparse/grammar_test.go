@@ -0,0 +1,196 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/alecthomas/participle"
+	participlelexer "github.com/alecthomas/participle/lexer"
+	"github.com/google/go-cmp/cmp"
+)
+
+// stringMarker prefixes the values of string literals lexed by quotedStrings.
+const stringMarker = "\x00"
+
+/*
+quotedStrings is Participle's default lexer, except that string literals cannot match the operators
+and keywords of the grammar, which Participle matches by value (eg: `1 '+' 2` would be an addition),
+but the hand-written parser does not, and that the qualified names of functions (eg: `a.b(`) are
+single identifiers, as Participle cannot look far enough ahead to tell them from members.
+*/
+type quotedStrings struct{}
+
+func (quotedStrings) Lex(r io.Reader) (participlelexer.Lexer, error) {
+	l, err := participlelexer.TextScannerLexer.Lex(r)
+	return &quotedStringTokens{Lexer: l}, err
+}
+
+func (quotedStrings) Symbols() map[string]rune {
+	return participlelexer.TextScannerLexer.Symbols()
+}
+
+type quotedStringTokens struct {
+	participlelexer.Lexer
+	pending []participlelexer.Token // Tokens read ahead, to find qualified names.
+}
+
+func (l *quotedStringTokens) Next() (participlelexer.Token, error) {
+	token, err := l.next()
+	if err != nil || token.Type != scanner.Ident {
+		return token, err
+	}
+	var ahead []participlelexer.Token
+	for {
+		dot, err := l.next()
+		if err != nil {
+			return token, err
+		}
+		ahead = append(ahead, dot)
+		if dot.Type != '.' {
+			break
+		}
+		name, err := l.next()
+		if err != nil {
+			return token, err
+		}
+		ahead = append(ahead, name)
+		if name.Type != scanner.Ident {
+			break
+		}
+	}
+	// Each dot was followed by a name if an odd number of tokens were read.
+	if last := ahead[len(ahead)-1]; last.Type == '(' && len(ahead)%2 == 1 {
+		for _, t := range ahead[:len(ahead)-1] {
+			token.Value += t.Value
+		}
+		ahead = ahead[len(ahead)-1:]
+	}
+	l.pending = append(ahead, l.pending...)
+	return token, nil
+}
+
+func (l *quotedStringTokens) next() (participlelexer.Token, error) {
+	if len(l.pending) > 0 {
+		token := l.pending[0]
+		l.pending = l.pending[1:]
+		return token, nil
+	}
+	token, err := l.Lexer.Next()
+	if token.Type == scanner.String || token.Type == scanner.Char {
+		token.Value = stringMarker + token.Value
+	}
+	return token, err
+}
+
+// participleParse parses an expression with a parser built by Participle from the grammar's struct tags.
+func participleParse(input string) (*Expression, error) {
+	expression := &Expression{}
+	parser, err := participle.Build(expression, participle.Lexer(quotedStrings{}))
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.ParseString(input, expression); err != nil {
+		return nil, err
+	}
+	if err := expression.desugar(); err != nil {
+		return nil, err
+	}
+	Inspect(expression, func(n Node) bool {
+		if v, ok := n.(*Value); ok && v.StrLiteral != nil {
+			*v.StrLiteral = strings.TrimPrefix(*v.StrLiteral, stringMarker)
+		}
+		return true
+	})
+	return expression, nil
+}
+
+// compatibilityInputs are valid and invalid expressions on which the parsers might differ.
+var compatibilityInputs = []string{
+	// Lexing.
+	"a /* comment */ + b // comment",
+	"a /* unterminated",
+	"a\n\t+\r\nb",
+	"\uFEFFa + \uFEFF",
+	"_a1 + αβ + a٣",
+	"1_000 + 0x_1F + 0o17 + 0b1010 + 017 + 08.5 + .5 + 1. + 1e3 + 1E-3 + 0x1p4 + 0x1.8p1",
+	"09", "0x", "0b12", "0o8", "1e", "0x1.8", "0b1.0", "0x1e3", "1__0", "1_", "0_x1", "1_0.5",
+	"1e400", "18446744073709551615", "18446744073709551616", "0xFFFFFFFFFFFFFFFFFF",
+	"1..2", "1.a", "a.5",
+	`"a\tb\x41\101é\U0001F600\"\\"`, `'a\tb\\'`, `"\q"`, `"\400"`, `"\x4"`, `"\'"`,
+	`'a"b'`, `'a\"b'`, `'it\'s'`, `''`, `'ab`, "'a\nb'", "`raw`",
+	"a\x00", "a\xff", "a   b", "a $ b", "a # b",
+	// Operators, which are split into single characters.
+	"a & & b | | c", "a < < 1 > > 2", "a = = b", "a ! = b", "a < = b", "a > = b", "a ? ? b",
+	"a | > f", "a <- 1", "a <<= 1", "a >>= 1", "a < b < c", "a == b == c", "a ! b", "a = b",
+	"a | -b", "a | !b", "a & -b", "a ~ b ~ c", "--a", "- -a", "-(-a)", "2 ^ -1", "2 ^ 3 ^ 4",
+	"!!a", "!-a", "a + !", "1 +", "+ 1", "a ? b", "a ? b : c ? d : e", "a ?? b ? c : d", "a ? ?b : c",
+	// Values and members.
+	"true.x", "x.true", "null(1)", "true(1)", "a.b.c[d][e.f]", "a.", "a[", "a[]", "a[b", "(a)", "()", "(a",
+	"'a'[b]", "1.5.x", "f(a).b['c']",
+	// Functions, and keyword arguments.
+	"f()", "f(,)", "f(1,)", "f(1 2)", "f(1,,2)", "f((1, 2))", "f(a=1)", "f(a = 1, b=g(c=2))",
+	"f(a==1)", "f(a= =1)", "f(a=)", "f(=1)", "f(a=1, 2)", "f(a=1, a=2)", "f(1=2)", "f(a.b=1)",
+	"f(a < b == c)", "f(a |> g = 1)", "f(", "f(1",
+	// Namespaced functions.
+	"a.f(1)", "a.b.f()", "a.f", "a.f + b.g(c.d)", "a . f(1)", "a.f(1).x", "x.a.f(1)", "f(1).a.g(2)", "a.(1)", "a.1(2)",
+	"null.f()", "true.f(1)", "try.f(1)", "let.f()", "try a.f() else b.g()", "x |> a.f()", "x |> a.f", "a.f(b=1)",
+	// Pipelines.
+	"a |> f |> g(1, b=2) |> h()", "a |> 1", "a |>", "a |> f(", "a |> true", "a |> f ?? b", "a ?? b |> f ? c : d",
+	// Keywords, which are also names.
+	"try a else b", "try", "try + 1", "try - 1", "try != 1", "try !a else b", "try !", "try (1)", "try(1)", "try()",
+	"try a", "try else else else", "try try a else b else c", "f(try)", "try.x", "x.try",
+	"let", "let + 1", "let != 1", "let(1)", "let x", "let x + 1", "let x = 1", "let x = 1;", "let x = 1; x",
+	"let true = 1; true", "let x = let y = 2; y; x", "else", "else + 1",
+	// Whole inputs.
+	"", " ", "// comment", ")", "a b", "a)", "a]", "1 + 2 3",
+}
+
+func TestParseCompatibility(t *testing.T) {
+	for _, input := range append(append([]string{}, fuzzSeeds...), compatibilityInputs...) {
+		checkCompatibility(t, input)
+	}
+}
+
+// Run with eg: go test ./oparse -run '^$' -fuzz FuzzParseCompatibility -fuzztime 1m
+func FuzzParseCompatibility(f *testing.F) {
+	for _, seed := range append(append([]string{}, fuzzSeeds...), compatibilityInputs...) {
+		f.Add(seed)
+	}
+	f.Fuzz(checkCompatibility)
+}
+
+// checkCompatibility checks that the hand-written parser parses an input as Participle's does.
+func checkCompatibility(t *testing.T, input string) {
+	expected, expectedErr := participleParse(input)
+	got, err := ParseWithLimits(input, ParseLimits{})
+	if expectedErr != nil && strings.Contains(expectedErr.Error(), "in octal literal") && !strings.Contains(strings.ToLower(input), "0o") {
+		// Participle's scanner follows Go, in which literals with a leading zero are octal, so 09 is invalid.
+		return
+	}
+	switch {
+	case (err != nil) != (expectedErr != nil):
+		t.Errorf("Parse(%q) got error %v, expected error %v", input, err, expectedErr)
+	case err == nil:
+		if diff := cmp.Diff(expected, got); diff != "" {
+			t.Errorf("Parse(%q) returned unexpected expression (-expected +got):\n%v", input, diff)
+		}
+	}
+}
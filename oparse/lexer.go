@@ -0,0 +1,360 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Functions for splitting expressions into tokens.
+
+// tokenKind is the kind of a token.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenPunct // A single character which is not part of any other token, eg: + or (.
+)
+
+/*
+token is a lexical token of an expression. The lexer follows the conventions of Go source (and of the
+text/scanner package, which expressions were lexed with before), eg: for numbers, escapes in strings,
+and comments, which are skipped. Multi-character operators are split into single characters, so that
+eg: `a & & b` is the same as `a && b`.
+*/
+type token struct {
+	kind  tokenKind
+	text  string // The token as written, or the value of a string literal.
+	start int    // The byte offset of the token in the input.
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexer splits an expression into tokens.
+type lexer struct {
+	input  string
+	offset int // The byte offset of the next character.
+}
+
+// syntaxError is an error at a byte offset of the input, which is converted to a ParseError.
+type syntaxError struct {
+	offset  int
+	message string
+}
+
+func (e *syntaxError) Error() string {
+	return e.message
+}
+
+func (l *lexer) errorf(offset int, format string, args ...interface{}) *syntaxError {
+	return &syntaxError{offset: offset, message: fmt.Sprintf(format, args...)}
+}
+
+// byteOrderMark is ignored at the start of an expression.
+const byteOrderMark = "\uFEFF"
+
+// lex returns the tokens of the input, ending with a tokenEOF.
+func lex(input string) ([]token, error) {
+	l := &lexer{input: input}
+	if err := l.checkEncoding(); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(input, byteOrderMark) {
+		l.offset = len(byteOrderMark)
+	}
+	// Most tokens are a character or two, so this rarely grows.
+	tokens := make([]token, 0, len(input)/2+1)
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+		if t.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// checkEncoding returns an error if the input is not valid UTF-8, or contains a NUL character.
+func (l *lexer) checkEncoding() error {
+	for offset := 0; offset < len(l.input); {
+		r, width := utf8.DecodeRuneInString(l.input[offset:])
+		switch {
+		case r == utf8.RuneError && width == 1:
+			return l.errorf(offset, "invalid UTF-8 encoding")
+		case r == 0:
+			return l.errorf(offset, "invalid character NUL")
+		}
+		offset += width
+	}
+	return nil
+}
+
+// peek returns the character at the given offset, or -1 at the end of the input.
+func (l *lexer) peek(offset int) rune {
+	if offset >= len(l.input) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[offset:])
+	return r
+}
+
+// next returns the token at the lexer's offset, skipping any whitespace and comments before it.
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	start := l.offset
+	r := l.peek(start)
+	switch {
+	case r < 0:
+		return token{kind: tokenEOF, start: start}, nil
+	case r == '_' || unicode.IsLetter(r):
+		l.offset = strings.IndexFunc(l.input[start:], func(r rune) bool {
+			return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if l.offset < 0 {
+			l.offset = len(l.input)
+		} else {
+			l.offset += start
+		}
+		return token{kind: tokenIdent, text: l.input[start:l.offset], start: start}, nil
+	case isDecimal(r) || r == '.' && isDecimal(l.peek(start+1)):
+		return l.number()
+	case r == '"' || r == '\'':
+		return l.string(r)
+	case r == '`':
+		return token{}, l.errorf(start, "raw string literals are not supported")
+	}
+	l.offset += utf8.RuneLen(r)
+	return token{kind: tokenPunct, text: l.input[start:l.offset], start: start}, nil
+}
+
+// skip skips whitespace and comments, ie: from // to the end of the line, or between /* and */.
+func (l *lexer) skip() error {
+	for l.offset < len(l.input) {
+		switch rest := l.input[l.offset:]; {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			l.offset++
+		case strings.HasPrefix(rest, "//"):
+			if end := strings.IndexByte(rest, '\n'); end >= 0 {
+				l.offset += end
+			} else {
+				l.offset = len(l.input)
+			}
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return l.errorf(len(l.input), "comment not terminated")
+			}
+			l.offset += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isDecimal(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+func isHex(r rune) bool {
+	return isDecimal(r) || 'a' <= lower(r) && lower(r) <= 'f'
+}
+
+// lower returns the lower case of an ASCII letter.
+func lower(r rune) rune {
+	return ('a' - 'A') | r
+}
+
+/*
+number returns a numeric literal: a decimal, hexadecimal, octal or binary integer, or a decimal or
+hexadecimal float, as in Go, eg: 1_000, 0x1F or 1.5e3. Unlike in Go, a leading zero does not make a
+literal octal, eg: 017 is 17 and 09 is 9. Its value is only computed when it is parsed (see
+Number.Capture).
+*/
+func (l *lexer) number() (token, error) {
+	start := l.offset
+	base, prefix := 10, rune(0) // The prefix is one of 0 (decimal), 'x', 'o' or 'b'.
+	digits, separated := false, false
+	var invalid rune // The first digit which is invalid in the base, if any.
+	kind := tokenInt
+	scan := func(base int) {
+		for r := l.peek(l.offset); isDecimal(r) || base == 16 && isHex(r) || r == '_'; r = l.peek(l.offset) {
+			if r == '_' {
+				separated = true
+			} else {
+				digits = true
+				if base <= 10 && r >= rune('0'+base) && invalid == 0 {
+					invalid = r
+				}
+			}
+			l.offset++
+		}
+	}
+
+	if l.peek(l.offset) != '.' {
+		if l.peek(l.offset) == '0' {
+			l.offset++
+			switch lower(l.peek(l.offset)) {
+			case 'x':
+				base, prefix = 16, 'x'
+				l.offset++
+			case 'o':
+				base, prefix = 8, 'o'
+				l.offset++
+			case 'b':
+				base, prefix = 2, 'b'
+				l.offset++
+			default:
+				digits = true // The leading 0 of a decimal literal.
+			}
+		}
+		scan(base)
+	}
+	if l.peek(l.offset) == '.' {
+		l.offset++
+		kind = tokenFloat
+		if prefix == 'o' || prefix == 'b' {
+			return token{}, l.errorf(l.offset, "invalid radix point in %v", literalName(prefix))
+		}
+		scan(base)
+	}
+	if !digits {
+		return token{}, l.errorf(l.offset, "%v has no digits", literalName(prefix))
+	}
+
+	if e := lower(l.peek(l.offset)); e == 'e' || e == 'p' {
+		switch {
+		case e == 'e' && prefix != 0:
+			return token{}, l.errorf(l.offset, "%q exponent requires decimal mantissa", l.peek(l.offset))
+		case e == 'p' && prefix != 'x':
+			return token{}, l.errorf(l.offset, "%q exponent requires hexadecimal mantissa", l.peek(l.offset))
+		}
+		l.offset++
+		kind = tokenFloat
+		if r := l.peek(l.offset); r == '+' || r == '-' {
+			l.offset++
+		}
+		digits = false
+		scan(10)
+		if !digits {
+			return token{}, l.errorf(l.offset, "exponent has no digits")
+		}
+	} else if prefix == 'x' && kind == tokenFloat {
+		return token{}, l.errorf(l.offset, "hexadecimal mantissa requires a 'p' exponent")
+	}
+
+	if kind == tokenInt && invalid != 0 {
+		return token{}, l.errorf(l.offset, "invalid digit %q in %v", invalid, literalName(prefix))
+	}
+	text := l.input[start:l.offset]
+	if separated && !validSeparators(text) {
+		return token{}, l.errorf(l.offset, "'_' must separate successive digits")
+	}
+	return token{kind: kind, text: text, start: start}, nil
+}
+
+func literalName(prefix rune) string {
+	switch prefix {
+	case 'x':
+		return "hexadecimal literal"
+	case 'o':
+		return "octal literal"
+	case 'b':
+		return "binary literal"
+	}
+	return "decimal literal"
+}
+
+// validSeparators returns true if every _ in a numeric literal is between digits (or after a prefix).
+func validSeparators(text string) bool {
+	hex := false
+	previous := '.' // A digit ('0'), a separator ('_'), or anything else ('.').
+	if len(text) >= 2 && text[0] == '0' && strings.ContainsRune("xXoObB", rune(text[1])) {
+		hex = lower(rune(text[1])) == 'x'
+		previous, text = '0', text[2:] // A prefix counts as a digit.
+	}
+	for _, r := range text {
+		switch {
+		case r == '_':
+			if previous != '0' {
+				return false
+			}
+		case isDecimal(r) || hex && isHex(r):
+			r = '0'
+		default:
+			if previous == '_' {
+				return false
+			}
+			r = '.'
+		}
+		previous = r
+	}
+	return previous != '_'
+}
+
+/*
+string returns a string literal, in double or single quotes, with the escapes of Go's interpreted
+string literals, eg: "a\tb". A single quoted string cannot contain double quotes, even escaped ones.
+*/
+func (l *lexer) string(quote rune) (token, error) {
+	start := l.offset
+	l.offset++
+	for {
+		switch r := l.peek(l.offset); {
+		case r < 0 || r == '\n':
+			return token{}, l.errorf(l.offset, "literal not terminated")
+		case r == '\\':
+			if next := l.peek(l.offset + 1); next == '\'' || next == '"' && quote == '\'' {
+				return token{}, l.errorf(l.offset+1, "invalid char escape")
+			}
+			l.offset++ // Skip the escaped character, which may be the quote.
+			if l.offset < len(l.input) {
+				l.offset += utf8.RuneLen(l.peek(l.offset))
+			}
+		case r == quote:
+			l.offset++
+			body := l.input[start+1 : l.offset-1]
+			value, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return token{}, l.errorf(start, "invalid string literal %v", l.input[start:l.offset])
+			}
+			return token{kind: tokenString, text: value, start: start}, nil
+		default:
+			l.offset += utf8.RuneLen(r)
+		}
+	}
+}
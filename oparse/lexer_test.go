@@ -0,0 +1,167 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      []string // The text of each token before the tokenEOF.
+		expectedKinds []tokenKind
+		expectsError  bool
+	}{
+		{
+			name:          "identifiers and operators",
+			input:         "to_int(x1)&&!é",
+			expected:      []string{"to_int", "(", "x1", ")", "&", "&", "!", "é"},
+			expectedKinds: []tokenKind{tokenIdent, tokenPunct, tokenIdent, tokenPunct, tokenPunct, tokenPunct, tokenPunct, tokenIdent},
+		},
+		{
+			name:          "numbers",
+			input:         "1 1_000 0x1F 0o17 0b1 017 09 1.5 .5 1. 1e3 0x1p-2",
+			expected:      []string{"1", "1_000", "0x1F", "0o17", "0b1", "017", "09", "1.5", ".5", "1.", "1e3", "0x1p-2"},
+			expectedKinds: []tokenKind{tokenInt, tokenInt, tokenInt, tokenInt, tokenInt, tokenInt, tokenInt, tokenFloat, tokenFloat, tokenFloat, tokenFloat, tokenFloat},
+		},
+		{
+			name:          "members are not floats",
+			input:         "a.b[1]",
+			expected:      []string{"a", ".", "b", "[", "1", "]"},
+			expectedKinds: []tokenKind{tokenIdent, tokenPunct, tokenIdent, tokenPunct, tokenInt, tokenPunct},
+		},
+		{
+			name:          "strings",
+			input:         `"a\"b" 'c\td' '' "é\x41"`,
+			expected:      []string{`a"b`, "c\td", "", "éA"},
+			expectedKinds: []tokenKind{tokenString, tokenString, tokenString, tokenString},
+		},
+		{
+			name:          "whitespace and comments",
+			input:         " a\t/* b */+\r\n// c\nd // e",
+			expected:      []string{"a", "+", "d"},
+			expectedKinds: []tokenKind{tokenIdent, tokenPunct, tokenIdent},
+		},
+		{
+			name:          "byte order mark",
+			input:         "\uFEFFa",
+			expected:      []string{"a"},
+			expectedKinds: []tokenKind{tokenIdent},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:         "unterminated string",
+			input:        "'a",
+			expectsError: true,
+		},
+		{
+			name:         "newline in string",
+			input:        "'a\nb'",
+			expectsError: true,
+		},
+		{
+			name:         "invalid escape",
+			input:        `"\q"`,
+			expectsError: true,
+		},
+		{
+			name:         "escaped single quote",
+			input:        `'it\'s'`,
+			expectsError: true,
+		},
+		{
+			name:         "double quote in single quoted string",
+			input:        `'a"b'`,
+			expectsError: true,
+		},
+		{
+			name:         "raw string",
+			input:        "`a`",
+			expectsError: true,
+		},
+		{
+			name:         "unterminated comment",
+			input:        "a /* b",
+			expectsError: true,
+		},
+		{
+			name:         "invalid octal digit",
+			input:        "0o9",
+			expectsError: true,
+		},
+		{
+			name:         "prefix without digits",
+			input:        "0x",
+			expectsError: true,
+		},
+		{
+			name:         "exponent without digits",
+			input:        "1e",
+			expectsError: true,
+		},
+		{
+			name:         "misplaced separator",
+			input:        "1__0",
+			expectsError: true,
+		},
+		{
+			name:         "NUL",
+			input:        "a\x00",
+			expectsError: true,
+		},
+		{
+			name:         "invalid UTF-8",
+			input:        "a\xff",
+			expectsError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := lex(test.input)
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("lex(%q) got no error, expected an error", test.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lex(%q) got error: %v", test.input, err)
+			}
+			if last := tokens[len(tokens)-1]; last.kind != tokenEOF || last.start != len(test.input) {
+				t.Errorf("lex(%q) ended with %v at %d, expected the end of the expression at %d", test.input, last, last.start, len(test.input))
+			}
+			var got []string
+			var gotKinds []tokenKind
+			for _, token := range tokens[:len(tokens)-1] {
+				got, gotKinds = append(got, token.text), append(gotKinds, token.kind)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("lex(%q) returned unexpected tokens (-expected +got):\n%v", test.input, diff)
+			}
+			if diff := cmp.Diff(test.expectedKinds, gotKinds); diff != "" {
+				t.Errorf("lex(%q) returned unexpected kinds of tokens (-expected +got):\n%v", test.input, diff)
+			}
+		})
+	}
+}
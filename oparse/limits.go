@@ -0,0 +1,268 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"text/scanner"
+	"time"
+)
+
+/*
+Limits guard the evaluation of an expression. Zero values mean no limit. Limits are checked between
+steps of the evaluation, so a single slow function call is not interrupted, but no further steps are
+taken once it returns.
+*/
+type Limits struct {
+	MaxStringLength int           // Maximum length of a string produced by concatenation.
+	MaxCalls        int           // Maximum number of function calls.
+	Timeout         time.Duration // Maximum time taken to evaluate the expression.
+}
+
+// DefaultLimits are generous limits suitable for collectors shared by many configs.
+var DefaultLimits = Limits{
+	MaxStringLength: 1 << 20,
+	MaxCalls:        1000,
+	Timeout:         time.Second,
+}
+
+/*
+ParseLimits guard the parsing of an expression, so that a malformed or malicious expression cannot
+exhaust the stack or the time of a shared process. Zero values mean no limit.
+*/
+type ParseLimits struct {
+	MaxLength int // Maximum length of an expression, in bytes.
+	/*
+		Maximum depth of nesting, where brackets (including those of function calls and members), and
+		the bodies of conditional, try, let, ! and |> expressions each nest one level deeper.
+	*/
+	MaxDepth int
+}
+
+// DefaultParseLimits are the limits of Parse, which are far beyond those of any sensible expression.
+var DefaultParseLimits = ParseLimits{
+	MaxLength: 1 << 16,
+	MaxDepth:  256,
+}
+
+/*
+check returns a ParseError if the input exceeds the limits. The depth of the input is found by
+scanning its tokens, before it is parsed.
+*/
+func (l ParseLimits) check(input string) error {
+	if l.MaxLength > 0 && len(input) > l.MaxLength {
+		return &ParseError{Input: input, Message: fmt.Sprintf("expression of length %d exceeds the limit of %d", len(input), l.MaxLength)}
+	}
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	var s scanner.Scanner
+	s.Init(strings.NewReader(input))
+	s.Error = func(*scanner.Scanner, string) {} // Errors are left to the parser.
+	depth := 0
+	var brackets []int // The depth outside of each open bracket.
+	for token := s.Scan(); token != scanner.EOF; token = s.Scan() {
+		switch {
+		case token == '(' || token == '[':
+			brackets = append(brackets, depth)
+			depth++
+		case token == ')' || token == ']':
+			// Anything nested since the bracket was opened (eg: the body of a try) ends with it.
+			if len(brackets) > 0 {
+				depth, brackets = brackets[len(brackets)-1], brackets[:len(brackets)-1]
+			}
+		case token == '?' && s.Peek() == '?', token == '!' && s.Peek() == '=':
+			s.Scan() // ?? and != do not nest.
+		case token == '?' || token == '!' || token == '|' && s.Peek() == '>':
+			depth++
+		case token == scanner.Ident && (s.TokenText() == "try" || s.TokenText() == "let"):
+			depth++
+		}
+		if depth > l.MaxDepth {
+			return &ParseError{
+				Input:   input,
+				Line:    s.Position.Line,
+				Column:  s.Position.Column,
+				Message: fmt.Sprintf("expression exceeds the limit of %d levels of nesting", l.MaxDepth),
+			}
+		}
+	}
+	return nil
+}
+
+// limitError is returned if evaluation exceeds a limit. Unlike other errors, it cannot be caught by try.
+type limitError struct {
+	error
+}
+
+// evaluation holds the state of the evaluation of an expression.
+type evaluation struct {
+	ctx          Context // Also holds the values of resolved variables, if there is a resolver.
+	constants    Context
+	bindings     *binding // The innermost binding of a let, if any.
+	resolver     VariableResolver
+	caller       FunctionCaller
+	limits       Limits
+	arithmetic   Arithmetic
+	numberFormat NumberFormat
+	calls        int
+	deadline     time.Time       // Zero if there is no timeout.
+	cancel       context.Context // Nil unless the evaluation can be cancelled (see EvalContext).
+	args         []interface{}   // A stack of the arguments of the function calls being evaluated (see pushArg).
+}
+
+// evaluations are reused by later evaluations (see release), so that their stacks of arguments are too.
+var evaluations = sync.Pool{New: func() interface{} { return &evaluation{} }}
+
+func newEvaluation(ctx Context, caller FunctionCaller, options Options) *evaluation {
+	ev := evaluations.Get().(*evaluation)
+	*ev = evaluation{
+		ctx:          ctx,
+		constants:    options.Constants,
+		caller:       caller,
+		limits:       options.Limits,
+		arithmetic:   options.Arithmetic,
+		numberFormat: options.NumberFormat,
+		args:         ev.args[:0],
+	}
+	if options.Limits.Timeout > 0 {
+		ev.deadline = time.Now().Add(options.Limits.Timeout)
+	}
+	return ev
+}
+
+// release returns the evaluation to the pool once it is finished. It must not be used afterwards.
+func (ev *evaluation) release() {
+	*ev = evaluation{args: ev.args[:0]}
+	evaluations.Put(ev)
+}
+
+/*
+pushArg pushes an argument of a function call onto the evaluation's stack, rather than allocating a
+slice for each call. The arguments of a call are those pushed since the call began (see callArgs).
+*/
+func (ev *evaluation) pushArg(arg interface{}) {
+	ev.args = append(ev.args, arg)
+}
+
+/*
+callArgs calls a function with the arguments pushed from the given depth of the stack onwards, then
+pops them, so that the stack is as it was before they were pushed.
+*/
+func (ev *evaluation) callArgs(name string, depth int) (interface{}, error) {
+	defer ev.popArgs(depth)
+	return ev.call(name, ev.args[depth:]...)
+}
+
+// popArgs pops the arguments from the given depth of the stack onwards, eg: if evaluating one fails.
+func (ev *evaluation) popArgs(depth int) {
+	for i := depth; i < len(ev.args); i++ {
+		ev.args[i] = nil // Values are not kept alive by the pool.
+	}
+	ev.args = ev.args[:depth]
+}
+
+// binding is the binding of a name to a value by a let, within the scope of any enclosing bindings.
+type binding struct {
+	name   string
+	value  interface{}
+	parent *binding
+}
+
+// bind evaluates the body of a let with the name bound to the value.
+func (ev *evaluation) bind(name string, value interface{}, body func() (interface{}, error)) (interface{}, error) {
+	parent := ev.bindings
+	ev.bindings = &binding{name: name, value: value, parent: parent}
+	defer func() { ev.bindings = parent }()
+	return body()
+}
+
+// call calls a function, subject to the limits.
+func (ev *evaluation) call(name string, args ...interface{}) (interface{}, error) {
+	ev.calls++
+	if ev.limits.MaxCalls > 0 && ev.calls > ev.limits.MaxCalls {
+		return nil, limitError{fmt.Errorf("exceeded the limit of %d function calls", ev.limits.MaxCalls)}
+	}
+	if err := ev.check(nil); err != nil {
+		return nil, err
+	}
+	if ev.arithmetic == BigArithmetic {
+		args = bigArgs(args)
+	}
+	result, err := ev.caller(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result, ev.check(result)
+}
+
+/*
+resolve resolves a variable. The time taken is not counted against the time limit, as it is spent
+fetching data rather than evaluating the expression, as when populating a context beforehand.
+*/
+func (ev *evaluation) resolve(name string) (interface{}, error) {
+	start := time.Now()
+	value, err := ev.resolver(name)
+	if !ev.deadline.IsZero() {
+		ev.deadline = ev.deadline.Add(time.Since(start))
+	}
+	return value, err
+}
+
+// bigArgs converts the arguments of a function from BigArithmetic (see fromRat).
+func bigArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if keywords, ok := arg.(KeywordArgs); ok {
+			convertedKeywords := KeywordArgs{}
+			for name, value := range keywords {
+				convertedKeywords[name] = fromRat(value)
+			}
+			arg = convertedKeywords
+		}
+		converted[i] = fromRat(arg)
+	}
+	return converted
+}
+
+// check checks an intermediate result, and the time taken so far, against the limits.
+func (ev *evaluation) check(result interface{}) error {
+	if r, ok := result.(*big.Rat); ok {
+		if err := checkRat(r); err != nil {
+			return err
+		}
+	}
+	if s, ok := result.(string); ok && ev.limits.MaxStringLength > 0 && len(s) > ev.limits.MaxStringLength {
+		return limitError{fmt.Errorf("string of length %d exceeds the limit of %d", len(s), ev.limits.MaxStringLength)}
+	}
+	if !ev.deadline.IsZero() && time.Now().After(ev.deadline) {
+		return limitError{fmt.Errorf("exceeded the time limit of %v", ev.limits.Timeout)}
+	}
+	if ev.cancel != nil && ev.cancel.Err() != nil {
+		return cancelled(ev.cancel)
+	}
+	return nil
+}
+
+// cancelled returns the error of an evaluation whose context is done. Like a limitError, try cannot catch it.
+func cancelled(ctx context.Context) error {
+	return limitError{fmt.Errorf("evaluation was cancelled: %v", ctx.Err())}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalWithLimits(t *testing.T) {
+	caller := func(name string, args ...interface{}) (interface{}, error) {
+		switch name {
+		case "slow":
+			time.Sleep(20 * time.Millisecond)
+		case "long":
+			return strings.Repeat("x", 100), nil
+		case "replace":
+			return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+		}
+		return args[0], nil
+	}
+	for _, test := range []struct {
+		name         string
+		expression   string
+		limits       Limits
+		expected     interface{}
+		expectsError bool
+	}{
+		{
+			name:       "no limits",
+			expression: "f(f(f(1))) + slow(1)",
+			expected:   2.0,
+		},
+		{
+			name:       "within call limit",
+			expression: "f(f(1))",
+			limits:     Limits{MaxCalls: 2},
+			expected:   1.0,
+		},
+		{
+			name:         "exceeds call limit",
+			expression:   "f(f(f(1)))",
+			limits:       Limits{MaxCalls: 2},
+			expectsError: true,
+		},
+		{
+			name:       "within string limit",
+			expression: "'ab' + 'cd'",
+			limits:     Limits{MaxStringLength: 4},
+			expected:   "abcd",
+		},
+		{
+			name:         "concatenation exceeds string limit",
+			expression:   "'ab' + 'cd' + 'e'",
+			limits:       Limits{MaxStringLength: 4},
+			expectsError: true,
+		},
+		{
+			name:         "concatenation in function argument exceeds string limit",
+			expression:   "f(long(1) + 'y')",
+			limits:       Limits{MaxStringLength: 100},
+			expectsError: true,
+		},
+		{
+			name:       "function result within string limit",
+			expression: "replace('ab', 'a', 'aaaa')",
+			limits:     Limits{MaxStringLength: 5},
+			expected:   "aaaab",
+		},
+		{
+			name:         "function result exceeds string limit",
+			expression:   "replace(replace('ab', 'a', 'aaaa'), 'a', 'aaaa')",
+			limits:       Limits{MaxStringLength: 10},
+			expectsError: true,
+		},
+		{
+			name:       "within time limit",
+			expression: "slow(1) + 1",
+			limits:     Limits{Timeout: time.Second},
+			expected:   2.0,
+		},
+		{
+			name:         "exceeds time limit",
+			expression:   "slow(1) + 1",
+			limits:       Limits{Timeout: time.Millisecond},
+			expectsError: true,
+		},
+		{
+			name:         "limits are not caught by try",
+			expression:   "try f(f(f(1))) else 0",
+			limits:       Limits{MaxCalls: 2},
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expression)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expression, err)
+			}
+			got, err := EvalWithLimits(expression, Context{}, caller, test.limits)
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("EvalWithLimits() = %v, expected error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalWithLimits() got error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("EvalWithLimits() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestEvalWithResolverLimits(t *testing.T) {
+	resolver := func(name string) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return 1, nil
+	}
+	caller := func(name string, args ...interface{}) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return args[0], nil
+	}
+	limits := Limits{Timeout: 10 * time.Millisecond}
+	// Resolving variables does not count against the time limit.
+	expression, err := Parse("a + b + 1")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if got, err := EvalWithResolver(expression, resolver, caller, Options{Limits: limits}); err != nil || got != 3.0 {
+		t.Errorf("EvalWithResolver() = %v, %v, expected 3", got, err)
+	}
+	expression, err = Parse("f(a) + 1")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if got, err := EvalWithResolver(expression, resolver, caller, Options{Limits: limits}); err == nil {
+		t.Errorf("EvalWithResolver() = %v, expected error", got)
+	}
+}
+
+func TestParseWithLimits(t *testing.T) {
+	nested := func(open, operand, close string, depth int) string {
+		return strings.Repeat(open, depth) + operand + strings.Repeat(close, depth)
+	}
+	for _, test := range []struct {
+		name           string
+		expression     string
+		limits         ParseLimits
+		expectedColumn int
+		expectsError   bool
+	}{
+		{
+			name:       "no limits",
+			expression: nested("(", "1", ")", 1000),
+		},
+		{
+			name:       "within length limit",
+			expression: "a + b",
+			limits:     ParseLimits{MaxLength: 5},
+		},
+		{
+			name:         "exceeds length limit",
+			expression:   "a + bc",
+			limits:       ParseLimits{MaxLength: 5},
+			expectsError: true,
+		},
+		{
+			name:       "within depth limit",
+			expression: "(a + (b)) * f(c[(d)], (e)) ?? !(f != g)",
+			limits:     ParseLimits{MaxDepth: 3},
+		},
+		{
+			name:           "brackets exceed depth limit",
+			expression:     "(a + ((b)))",
+			limits:         ParseLimits{MaxDepth: 2},
+			expectedColumn: 7,
+			expectsError:   true,
+		},
+		{
+			name:           "calls exceed depth limit",
+			expression:     "f(a, g(h(b)))",
+			limits:         ParseLimits{MaxDepth: 2},
+			expectedColumn: 9,
+			expectsError:   true,
+		},
+		{
+			name:       "siblings are not nested",
+			expression: "(a) + (b) + (c) + try d else e + try f else g",
+			limits:     ParseLimits{MaxDepth: 2},
+		},
+		{
+			name:           "prefix operators exceed depth limit",
+			expression:     "!!!a",
+			limits:         ParseLimits{MaxDepth: 2},
+			expectedColumn: 3,
+			expectsError:   true,
+		},
+		{
+			name:           "keywords exceed depth limit",
+			expression:     "(try let x = 1; x else a)",
+			limits:         ParseLimits{MaxDepth: 2},
+			expectedColumn: 6,
+			expectsError:   true,
+		},
+		{
+			name:         "conditional expressions exceed depth limit",
+			expression:   "a ? b : c ? d : e ? f : g",
+			limits:       ParseLimits{MaxDepth: 2},
+			expectsError: true,
+		},
+		{
+			name:         "pipelines exceed depth limit",
+			expression:   "a |> f |> g |> h",
+			limits:       ParseLimits{MaxDepth: 2},
+			expectsError: true,
+		},
+		{
+			name:       "brackets in strings are not nested",
+			expression: "'((((' + \"[[[[\"",
+			limits:     ParseLimits{MaxDepth: 1},
+		},
+		{
+			name:         "default limits",
+			expression:   nested("f(", "1", ")", 1000),
+			limits:       DefaultParseLimits,
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseWithLimits(test.expression, test.limits)
+			switch {
+			case test.expectsError && err == nil:
+				t.Errorf("ParseWithLimits(%q) got no error, expected one", test.expression)
+			case !test.expectsError && err != nil:
+				t.Errorf("ParseWithLimits(%q) got error: %v", test.expression, err)
+			case test.expectedColumn > 0:
+				parseError, ok := err.(*ParseError)
+				if !ok || parseError.Column != test.expectedColumn {
+					t.Errorf("ParseWithLimits(%q) got error %v, expected a *ParseError at column %d", test.expression, err, test.expectedColumn)
+				}
+			}
+		})
+	}
+}
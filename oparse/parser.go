@@ -16,25 +16,33 @@ limitations under the License.
 
 /*
 Package oparse parses simple expressions in orismologer protos.
-Basic arithmetic, variables, function calls, string literals, nested expressions, and string
+Basic arithmetic, bitwise operations, comparisons, boolean logic, conditional expressions, variables
+(including maps, with member access), function calls, string literals, nested expressions, and string
 concatenation are supported.
-Based on the version originally published at:
+The grammar is based on the version originally published at:
 https://github.com/alecthomas/participle/blob/master/_examples/expr/main.go
+and is still written in Participle's notation, in the struct tags of the nodes of the grammar AST, but
+expressions are parsed by a hand-written parser (see grammar.go), which builds the same AST without
+building a parser from the struct tags by reflection on every call of Parse.
 */
 package oparse
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/alecthomas/participle"
 	"github.com/golang/glog"
 )
 
-// Operator represents an arithmetic (or string interpolation) operator, eg: +.
+// Operator represents an arithmetic, comparison, logical (or string interpolation) operator, eg: +.
 type Operator int
 
 const (
@@ -49,51 +57,198 @@ const (
 
 	// OpSub represents a subtraction symbol (-).
 	OpSub
+
+	// OpAnd represents a logical and (&&).
+	OpAnd
+
+	// OpOr represents a logical or (||).
+	OpOr
+
+	// OpEq represents an equality comparison (==).
+	OpEq
+
+	// OpNe represents an inequality comparison (!=).
+	OpNe
+
+	// OpLt represents a less than comparison (<).
+	OpLt
+
+	// OpLe represents a less than or equal comparison (<=).
+	OpLe
+
+	// OpGt represents a greater than comparison (>).
+	OpGt
+
+	// OpGe represents a greater than or equal comparison (>=).
+	OpGe
+
+	// OpMod represents a modulo symbol (%).
+	OpMod
+
+	// OpBitwiseAnd represents a bitwise and (&).
+	OpBitwiseAnd
+
+	// OpBitwiseOr represents a bitwise or (|).
+	OpBitwiseOr
+
+	// OpBitwiseXor represents a bitwise exclusive or (~).
+	OpBitwiseXor
+
+	// OpShl represents a left shift (<<).
+	OpShl
+
+	// OpShr represents a right shift (>>).
+	OpShr
+
+	// OpCoalesce represents a null coalescing operator (??).
+	OpCoalesce
 )
 
-var operatorMap = map[string]Operator{"+": OpAdd, "-": OpSub, "*": OpMul, "/": OpDiv}
+var operatorMap = map[string]Operator{
+	"+": OpAdd, "-": OpSub, "*": OpMul, "/": OpDiv, "%": OpMod,
+	"&&": OpAnd, "||": OpOr,
+	"==": OpEq, "!=": OpNe, "<": OpLt, "<=": OpLe, ">": OpGt, ">=": OpGe,
+	"&": OpBitwiseAnd, "|": OpBitwiseOr, "~": OpBitwiseXor, "<<": OpShl, ">>": OpShr,
+	"??": OpCoalesce,
+}
+
+/*
+Capture implements Participle's Capture interface, for the Participle parser which tests check the
+hand-written one against. Participle's lexer splits operators into single characters, so a
+multi-character operator (eg: &&) is captured as several strings.
+*/
+func (o *Operator) Capture(s []string) error {
+	op, ok := operatorMap[strings.Join(s, "")]
+	if !ok {
+		return fmt.Errorf("unsupported operator %q", strings.Join(s, ""))
+	}
+	*o = op
+	return nil
+}
+
+// Boolean is a boolean literal, ie: true or false.
+type Boolean bool
 
 // Capture implements Participle's Capture interface.
-func (o *Operator) Capture(s []string) error {
-	*o = operatorMap[s[0]]
+func (b *Boolean) Capture(s []string) error {
+	*b = s[0] == "true"
+	return nil
+}
+
+/*
+Number is a numeric literal: a decimal integer or float, or a hexadecimal (eg: 0x1F), octal (eg: 0o17)
+or binary (eg: 0b1010) integer. A leading zero does not make a literal octal, ie: 017 is 17 and 09
+is 9.
+*/
+type Number struct {
+	Text  string  // The literal as written.
+	Float float64 // The value of the literal.
+}
+
+// Capture implements Participle's Capture interface. The hand-written parser uses it too, to set the value.
+func (n *Number) Capture(s []string) error {
+	n.Text = s[0]
+	if i, ok := n.integer(); ok {
+		n.Float = float64(i)
+		return nil
+	}
+	f, err := strconv.ParseFloat(n.Text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", n.Text)
+	}
+	n.Float = f
 	return nil
 }
 
-// Arg captures a function argument as an identifier optionally followed by a comma.
+// integer returns the exact value of an integer literal, or false if it is not an integer literal.
+func (n *Number) integer() (uint64, bool) {
+	text := strings.Replace(n.Text, "_", "", -1)
+	base := 10
+	if len(text) > 1 && text[0] == '0' && strings.ContainsRune("xXoObB", rune(text[1])) {
+		base = 0 // Implied by the prefix.
+	}
+	i, err := strconv.ParseUint(text, base, 64)
+	return i, err == nil
+}
+
+/*
+Arg captures a function argument. A keyword argument (eg: `units='ms'`) is parsed as a value followed
+by "=" and the keyword's value, and is then moved to Name and Value (see Expression.desugar), as the
+keyword cannot be told apart from a variable until the "=" is reached.
+*/
 type Arg struct {
-	Value     Expression `@@` // nolint: govet
-	Separator *string    `[ "," ]`
+	Value   Expression  `@@` // nolint: govet
+	Keyword *Expression `[ "=" @@ ]`
+	Name    string      // The keyword of a keyword argument, or empty for a positional argument.
 }
 
 // Function captures a function call as an identifier followed by a matched pair of brackets which
-// contain 0 or more arguments.
+// contain 0 or more arguments, separated by commas. The identifier may be qualified by namespaces, eg:
+// `cisco.parse_envmon(x)`, in which case Name is the whole dotted name (see parser.isCall).
 type Function struct {
 	Name  string `@Ident`
 	Open  string `"("`
-	Args  []*Arg `{ @@ }`
+	Args  []*Arg `[ @@ { "," @@ } ]`
 	Close string `")"`
 }
 
 // Value captures a value, which is either a literal of some kind (eg: a string or a number) or
 // something that evaluates to one (eg: a function call, or a nested expression).
 type Value struct {
-	// NB: All numeric values will be represented as floats, to simplify parsing.
-	Number        *float64    `@(Float|Int)`
+	// NB: All numeric values will be represented as floats, to simplify parsing, unless evaluated with
+	// IntegerArithmetic.
+	Number        *Number     `( @(Float|Int)`
 	StrLiteral    *string     `| @(String|Char)`
+	Boolean       *Boolean    `| @("true" | "false")`
+	Null          bool        `| @"null"`
+	Not           *Value      `| "!" @@`
+	Try           *Try        `| @@`
+	Let           *Let        `| @@`
 	Function      *Function   `| @@`
 	Variable      *string     `| @Ident`
-	Subexpression *Expression `| "(" @@ ")"`
+	Subexpression *Expression `| "(" @@ ")" )`
+	Members       []*Member   `{ @@ }`
+}
+
+// Member captures access to a member of a map, by name (eg: row.name) or by key (eg: row["name"]).
+type Member struct {
+	Name *string     `  "." @Ident`
+	Key  *Expression `| "[" @@ "]"`
+}
+
+/*
+Try captures an expression with a fallback, which is only evaluated if the expression fails, eg: to
+fall back from a vendor OID to a standard one with `try to_int(vendor_oid) else std_oid`. The
+fallback extends as far to the right as possible, as for the branches of a conditional expression.
+*/
+type Try struct {
+	Body     *Expression `"try" @@`
+	Fallback *Expression `"else" @@`
+}
+
+/*
+Let captures a local binding of the value of an expression to a name, for use in the body which follows
+it, eg: `let x = oid_a / 100; x * (x + 1)`, so the value is only computed once. Within the body, the
+name refers to the value rather than to any variable of the same name. As for a try, the body extends
+as far to the right as possible.
+*/
+type Let struct {
+	Name  string      `"let" @Ident "="`
+	Value *Expression `@@ ";"`
+	Body  *Expression `@@`
 }
 
-// Factor captures a base and an exponent.
+// Factor captures an optionally negated base and an exponent. Exponentiation binds tighter than
+// negation, ie: -2 ^ 2 is -4.
 type Factor struct {
+	Negated  bool   `[ @"-" ]`
 	Base     *Value `@@`
 	Exponent *Value `[ "^" @@ ]`
 }
 
-// OpFactor captures a multiplication or division operator followed by a factor.
+// OpFactor captures a multiplication, division or modulo operator followed by a factor.
 type OpFactor struct {
-	Operator Operator `@("*" | "/")`
+	Operator Operator `@("*" | "/" | "%")`
 	Factor   *Factor  `@@`
 }
 
@@ -109,13 +264,126 @@ type OpTerm struct {
 	Term     *Term    `@@`
 }
 
-// Expression is the top level node in the grammar AST. It represents the complete expression to be
-// parsed and evaluated.
-type Expression struct {
+// Sum captures a Term followed by an OpTerm.
+type Sum struct {
 	Left  *Term     `@@`
 	Right []*OpTerm `{ @@ }`
 }
 
+// OpSum captures a shift operator followed by a sum.
+type OpSum struct {
+	Operator Operator `@("<" "<" | ">" ">")`
+	Sum      *Sum     `@@`
+}
+
+// Shift captures a Sum followed by an OpSum.
+type Shift struct {
+	Left  *Sum     `@@`
+	Right []*OpSum `{ @@ }`
+}
+
+// OpShift captures a bitwise and operator followed by a shift.
+type OpShift struct {
+	Operator Operator `@"&"`
+	Shift    *Shift   `@@`
+}
+
+// BitAnd captures a Shift followed by an OpShift.
+type BitAnd struct {
+	Left  *Shift     `@@`
+	Right []*OpShift `{ @@ }`
+}
+
+// OpBitAnd captures a bitwise exclusive or operator followed by a bitwise and.
+type OpBitAnd struct {
+	Operator Operator `@"~"`
+	BitAnd   *BitAnd  `@@`
+}
+
+// BitXor captures a BitAnd followed by an OpBitAnd.
+type BitXor struct {
+	Left  *BitAnd     `@@`
+	Right []*OpBitAnd `{ @@ }`
+}
+
+// OpBitXor captures a bitwise or operator followed by a bitwise exclusive or.
+type OpBitXor struct {
+	Operator Operator `@"|"`
+	BitXor   *BitXor  `@@`
+}
+
+// BitOr captures a BitXor followed by an OpBitXor.
+type BitOr struct {
+	Left  *BitXor     `@@`
+	Right []*OpBitXor `{ @@ }`
+}
+
+// OpBitOr captures a comparison operator followed by a bitwise or.
+type OpBitOr struct {
+	Operator Operator `@("=" "=" | "!" "=" | "<" "=" | ">" "=" | "<" | ">")`
+	BitOr    *BitOr   `@@`
+}
+
+// Comparison captures a BitOr, optionally compared to another. Comparisons cannot be chained.
+type Comparison struct {
+	Left  *BitOr   `@@`
+	Right *OpBitOr `[ @@ ]`
+}
+
+// OpComparison captures a logical and operator followed by a comparison.
+type OpComparison struct {
+	Operator   Operator    `@("&" "&")`
+	Comparison *Comparison `@@`
+}
+
+// Conjunction captures a Comparison followed by an OpComparison.
+type Conjunction struct {
+	Left  *Comparison     `@@`
+	Right []*OpComparison `{ @@ }`
+}
+
+// OpConjunction captures a logical or operator followed by a conjunction.
+type OpConjunction struct {
+	Operator    Operator     `@("|" "|")`
+	Conjunction *Conjunction `@@`
+}
+
+// Disjunction captures a Conjunction followed by an OpConjunction.
+type Disjunction struct {
+	Left  *Conjunction     `@@`
+	Right []*OpConjunction `{ @@ }`
+}
+
+// OpDisjunction captures a coalescing operator followed by a disjunction.
+type OpDisjunction struct {
+	Operator    Operator     `@("?" "?")`
+	Disjunction *Disjunction `@@`
+}
+
+/*
+Pipe captures a stage of a pipeline, ie: a function which the value before it is passed to as its first
+argument, eg: `|> to_int` or `|> time_since_epoch('ntp', 's')`.
+*/
+type Pipe struct {
+	Function *Function `"|" ">" ( @@`
+	Name     *string   `| @Ident )`
+}
+
+/*
+Expression is the top level node in the grammar AST. It represents the complete expression to be
+parsed and evaluated: a Disjunction followed by an OpDisjunction, optionally piped through functions
+(eg: `value |> to_int |> to_str`), and optionally used as the condition of a conditional expression
+(eg: `up ? speed : 0`). Pipes are only set while parsing, as Parse desugars pipelines to nested calls
+(eg: `to_str(to_int(value))`).
+*/
+type Expression struct {
+	Left  *Disjunction     `@@`
+	Right []*OpDisjunction `{ @@ }`
+	Pipes []*Pipe          `{ @@ }`
+	Then  *Expression      `[ "?" @@`
+	Else  *Expression      `  ":" @@ ]`
+}
+
 // Functions for displaying parsed expressions. Useful for debugging.
 
 func (o Operator) String() string {
@@ -124,10 +392,40 @@ func (o Operator) String() string {
 		return "*"
 	case OpDiv:
 		return "/"
+	case OpMod:
+		return "%"
 	case OpSub:
 		return "-"
 	case OpAdd:
 		return "+"
+	case OpAnd:
+		return "&&"
+	case OpOr:
+		return "||"
+	case OpEq:
+		return "=="
+	case OpNe:
+		return "!="
+	case OpLt:
+		return "<"
+	case OpLe:
+		return "<="
+	case OpGt:
+		return ">"
+	case OpGe:
+		return ">="
+	case OpBitwiseAnd:
+		return "&"
+	case OpBitwiseOr:
+		return "|"
+	case OpBitwiseXor:
+		return "~"
+	case OpShl:
+		return "<<"
+	case OpShr:
+		return ">>"
+	case OpCoalesce:
+		return "??"
 	}
 	glog.Error("Got unsupported operator while parsing expression")
 	return "?"
@@ -136,19 +434,49 @@ func (o Operator) String() string {
 func (f *Function) String() string {
 	var args []string
 	for _, arg := range f.Args {
-		args = append(args, arg.Value.String())
+		args = append(args, arg.String())
 	}
 	return fmt.Sprintf("%v(%v)", f.Name, strings.Join(args, ", "))
 }
 
+func (a *Arg) String() string {
+	if a.Name != "" {
+		return a.Name + "=" + a.Value.String()
+	}
+	return a.Value.String()
+}
+
 func (v *Value) String() string {
+	out := v.operandString()
+	for _, m := range v.Members {
+		out += m.String()
+	}
+	return out
+}
+
+// operandString returns the value without any member accesses.
+func (v *Value) operandString() string {
 	switch {
 	case v.Number != nil:
-		return fmt.Sprintf("%g", *v.Number)
+		return v.Number.Text
 	case v.StrLiteral != nil:
+		// Prefer single quotes, as configs do, so expressions can be embedded in text protos as is.
+		if !strings.ContainsAny(*v.StrLiteral, "'\\\n") {
+			return "'" + *v.StrLiteral + "'"
+		}
 		return fmt.Sprintf("%q", *v.StrLiteral)
+	case v.Boolean != nil:
+		return strconv.FormatBool(bool(*v.Boolean))
+	case v.Null:
+		return "null"
+	case v.Not != nil:
+		return "!" + v.Not.String()
 	case v.Variable != nil:
 		return *v.Variable
+	case v.Try != nil:
+		return v.Try.String()
+	case v.Let != nil:
+		return v.Let.String()
 	case v.Function != nil:
 		return v.Function.String()
 	case v.Subexpression != nil:
@@ -158,11 +486,29 @@ func (v *Value) String() string {
 	}
 }
 
+func (t *Try) String() string {
+	return "try " + t.Body.String() + " else " + t.Fallback.String()
+}
+
+func (l *Let) String() string {
+	return "let " + l.Name + " = " + l.Value.String() + "; " + l.Body.String()
+}
+
+func (m *Member) String() string {
+	if m.Name != nil {
+		return "." + *m.Name
+	}
+	return "[" + m.Key.String() + "]"
+}
+
 func (f *Factor) String() string {
 	out := f.Base.String()
 	if f.Exponent != nil {
 		out += " ^ " + f.Exponent.String()
 	}
+	if f.Negated {
+		out = "-" + out
+	}
 	return out
 }
 
@@ -182,27 +528,147 @@ func (o *OpTerm) String() string {
 	return fmt.Sprintf("%s %s", o.Operator, o.Term)
 }
 
+func (s *Sum) String() string {
+	out := []string{s.Left.String()}
+	for _, r := range s.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpSum) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.Sum)
+}
+
+func (s *Shift) String() string {
+	out := []string{s.Left.String()}
+	for _, r := range s.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpShift) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.Shift)
+}
+
+func (b *BitAnd) String() string {
+	out := []string{b.Left.String()}
+	for _, r := range b.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpBitAnd) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.BitAnd)
+}
+
+func (b *BitXor) String() string {
+	out := []string{b.Left.String()}
+	for _, r := range b.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpBitXor) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.BitXor)
+}
+
+func (b *BitOr) String() string {
+	out := []string{b.Left.String()}
+	for _, r := range b.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpBitOr) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.BitOr)
+}
+
+func (c *Comparison) String() string {
+	if c.Right == nil {
+		return c.Left.String()
+	}
+	return c.Left.String() + " " + c.Right.String()
+}
+
+func (o *OpComparison) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.Comparison)
+}
+
+func (c *Conjunction) String() string {
+	out := []string{c.Left.String()}
+	for _, r := range c.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpConjunction) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.Conjunction)
+}
+
+func (d *Disjunction) String() string {
+	out := []string{d.Left.String()}
+	for _, r := range d.Right {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, " ")
+}
+
+func (o *OpDisjunction) String() string {
+	return fmt.Sprintf("%s %s", o.Operator, o.Disjunction)
+}
+
 func (e *Expression) String() string {
 	out := []string{e.Left.String()}
 	for _, r := range e.Right {
 		out = append(out, r.String())
 	}
+	if e.Then != nil {
+		out = append(out, "?", e.Then.String(), ":", e.Else.String())
+	}
 	return strings.Join(out, " ")
 }
 
 // Functions for actually evaluating parsed expressions.
 
-func (o Operator) eval(l, r interface{}) (interface{}, error) {
+func (o Operator) eval(ev *evaluation, l, r interface{}) (interface{}, error) {
 	_, lIsInt := l.(int)
 	_, rIsInt := r.(int)
-	// Because of earlier handling we can assume that all numeric values are represented as floats.
-	// ie: We should never get an int here.
+	// Because of earlier handling (see evaluation.number), numeric values should never be ints here. If
+	// one is, fail the expression rather than the process.
 	if lIsInt || rIsInt {
-		log.Fatal("Evaluated parser output contained an int. That should not have happened.")
+		return nil, fmt.Errorf("operand of %v is an unconverted int (%T %v %T), which is a bug in oparse", o, l, o, r)
+	}
+
+	switch o {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		return o.compare(l, r)
+	case OpBitwiseAnd, OpBitwiseOr, OpBitwiseXor, OpShl, OpShr:
+		return o.bitwise(l, r)
+	case OpAnd, OpOr, OpCoalesce:
+		return nil, fmt.Errorf("operator %v must be evaluated with short-circuiting", o)
+	}
+
+	if l == nil || r == nil {
+		return nil, fmt.Errorf("operand of %v is null", o)
+	}
+	if isInteger(l) && isInteger(r) {
+		return o.integers(l, r)
+	}
+	if isRat(l) || isRat(r) {
+		if a, b := toRat(l), toRat(r); a != nil && b != nil {
+			return o.rats(a, b)
+		}
 	}
 
-	lFloat, lIsFloat := l.(float64)
-	rFloat, rIsFloat := r.(float64)
+	// Arithmetic on an integer and a float is float arithmetic.
+	lFloat, lIsFloat := toFloat(l)
+	rFloat, rIsFloat := toFloat(r)
 	_, lIsString := l.(string)
 	_, rIsString := r.(string)
 
@@ -216,6 +682,11 @@ func (o Operator) eval(l, r interface{}) (interface{}, error) {
 				return nil, errors.New("division by 0")
 			}
 			return lFloat / rFloat, nil
+		case OpMod:
+			if rFloat == 0 {
+				return nil, errors.New("modulo by 0")
+			}
+			return math.Mod(lFloat, rFloat), nil
 		case OpAdd:
 			return lFloat + rFloat, nil
 		case OpSub:
@@ -226,7 +697,7 @@ func (o Operator) eval(l, r interface{}) (interface{}, error) {
 
 	if lIsString || rIsString {
 		if o == OpAdd {
-			return fmt.Sprint(l) + fmt.Sprint(r), nil
+			return ev.text(l) + ev.text(r), nil
 		}
 		return nil, fmt.Errorf("unsupported string operator (use '+' for concatenation): %v", o)
 	}
@@ -234,118 +705,562 @@ func (o Operator) eval(l, r interface{}) (interface{}, error) {
 	return nil, errors.New("unsupported type (only floats and strings are supported)")
 }
 
-func (f *Function) eval(ctx Context, caller FunctionCaller) (interface{}, error) {
-	var args []interface{}
+// compare evaluates a comparison operator. Only values of the same type can be compared.
+func (o Operator) compare(l, r interface{}) (interface{}, error) {
+	if l == nil || r == nil {
+		// Null is only equal to null, and cannot be ordered.
+		if o != OpEq && o != OpNe {
+			return nil, fmt.Errorf("cannot compare null with %v", o)
+		}
+		return (l == nil && r == nil) == (o == OpEq), nil
+	}
+	var c int // -1, 0 or 1 if l is less than, equal to or greater than r.
+	switch lValue := l.(type) {
+	case float64, int64, uint64, *big.Rat:
+		if isRat(l) || isRat(r) {
+			if a, b := toRat(l), toRat(r); a != nil && b != nil {
+				c = a.Cmp(b)
+				break
+			}
+		}
+		if isInteger(l) && isInteger(r) {
+			c = toBig(l).Cmp(toBig(r))
+			break
+		}
+		lFloat, _ := toFloat(lValue)
+		rFloat, ok := toFloat(r)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		switch {
+		case lFloat < rFloat:
+			c = -1
+		case lFloat > rFloat:
+			c = 1
+		}
+	case string:
+		rValue, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		c = strings.Compare(lValue, rValue)
+	case bool:
+		rValue, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		if o != OpEq && o != OpNe {
+			return nil, fmt.Errorf("unsupported boolean operator (use '==' or '!='): %v", o)
+		}
+		if lValue != rValue {
+			c = 1
+		}
+	default:
+		return nil, fmt.Errorf("cannot compare %T and %T", l, r)
+	}
+	switch o {
+	case OpEq:
+		return c == 0, nil
+	case OpNe:
+		return c != 0, nil
+	case OpLt:
+		return c < 0, nil
+	case OpLe:
+		return c <= 0, nil
+	case OpGt:
+		return c > 0, nil
+	case OpGe:
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("unsupported comparison operator: %v", o)
+}
+
+// text formats an operand of a concatenation, with the number format of the evaluation for non-integers.
+func (ev *evaluation) text(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return ev.numberFormat.format(v)
+	case *big.Rat:
+		if v.IsInt() {
+			return v.Num().String()
+		}
+		f, _ := v.Float64()
+		return ev.numberFormat.format(f)
+	}
+	return fmt.Sprint(value)
+}
+
+// boolean asserts that the operand of a logical operator is a bool.
+func boolean(value interface{}, operator string) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("operand of %v must be a boolean, got %T", operator, value)
+	}
+	return b, nil
+}
+
+func (f *Function) eval(ev *evaluation) (interface{}, error) {
+	depth := len(ev.args)
+	var keywords KeywordArgs
 	for _, arg := range f.Args {
-		argEval, err := arg.Value.eval(ctx, caller)
+		argEval, err := arg.Value.eval(ev)
 		if err != nil {
+			ev.popArgs(depth)
 			return nil, err
 		}
-		args = append(args, argEval)
+		if arg.Name == "" {
+			ev.pushArg(argEval)
+			continue
+		}
+		if keywords == nil {
+			keywords = KeywordArgs{}
+		}
+		keywords[arg.Name] = argEval
 	}
-	result, err := caller(f.Name, args...)
+	if keywords != nil {
+		ev.pushArg(keywords)
+	}
+	result, err := ev.callArgs(f.Name, depth)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert any int output to float, to simplify parsing.
-	resultInt, resultIsInt := result.(int)
-	if resultIsInt {
-		return float64(resultInt), nil
+	// Convert any numeric output to the representation used by the arithmetic mode, to simplify parsing.
+	return ev.number(result), nil
+}
+
+func (v *Value) eval(ev *evaluation) (interface{}, error) {
+	value, err := v.evalOperand(ev)
+	for _, m := range v.Members {
+		if err != nil {
+			break
+		}
+		value, err = m.eval(ev, value)
 	}
-	return result, nil
+	return value, err
 }
 
-func (v *Value) eval(ctx Context, caller FunctionCaller) (interface{}, error) {
+// evalOperand evaluates the value without any member accesses.
+func (v *Value) evalOperand(ev *evaluation) (interface{}, error) {
 	switch {
 	case v.Number != nil:
-		return *v.Number, nil
+		return ev.literal(v.Number), nil
 	case v.StrLiteral != nil:
 		return *v.StrLiteral, nil
 	case v.Variable != nil:
-		value, ok := ctx[*v.Variable]
-		if !ok {
-			return nil, errors.New("no such variable " + *v.Variable)
-		}
-		// Attempt to cast to float, then string, then fail.
-		valueInt, ok := value.(int)
-		if ok {
-			return float64(valueInt), nil
-		}
-		valueFloat, ok := value.(float64)
-		if ok {
-			return valueFloat, nil
+		return ev.variable(*v.Variable)
+	case v.Boolean != nil:
+		return bool(*v.Boolean), nil
+	case v.Null:
+		return nil, nil
+	case v.Not != nil:
+		operand, err := v.Not.eval(ev)
+		if err != nil {
+			return nil, err
 		}
-		valueString, ok := value.(string)
-		if ok {
-			return valueString, nil
+		b, err := boolean(operand, "!")
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("could not cast variable `%v` to float or string", *v.Variable)
+		return !b, nil
+	case v.Try != nil:
+		return v.Try.eval(ev)
+	case v.Let != nil:
+		return v.Let.eval(ev)
 	case v.Function != nil:
-		return v.Function.eval(ctx, caller)
+		return v.Function.eval(ev)
 	case v.Subexpression != nil:
-		return v.Subexpression.eval(ctx, caller)
+		return v.Subexpression.eval(ev)
 	default:
 		return nil, nil
 	}
 }
 
-func (f *Factor) eval(ctx Context, caller FunctionCaller) (interface{}, error) {
-	b, err := f.Base.eval(ctx, caller)
+// eval evaluates the body, or the fallback if the body fails for any reason other than exceeding a limit.
+func (t *Try) eval(ev *evaluation) (interface{}, error) {
+	result, err := t.Body.eval(ev)
+	if _, ok := err.(limitError); err == nil || ok {
+		return result, err
+	}
+	if glog.V(1) {
+		glog.Infof("evaluating fallback of `%v`: %v", t, err)
+	}
+	return t.Fallback.eval(ev)
+}
+
+// eval evaluates the body with the name bound to the value.
+func (l *Let) eval(ev *evaluation) (interface{}, error) {
+	value, err := l.Value.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	return ev.bind(l.Name, value, func() (interface{}, error) { return l.Body.eval(ev) })
+}
+
+// eval returns the member of the given map (see evaluation.member).
+func (m *Member) eval(ev *evaluation, container interface{}) (interface{}, error) {
+	var key string
+	if m.Name != nil {
+		key = *m.Name
+	} else {
+		k, err := m.Key.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if key, ok = k.(string); !ok {
+			return nil, fmt.Errorf("key %v of a map must be a string, got %T", k, k)
+		}
+	}
+	return ev.member(container, key)
+}
+
+/*
+variable returns the value bound to a name by a let, or else the value of a named constant or of a
+variable from the context, or from the resolver if there is one. Each variable is only resolved once
+per evaluation.
+*/
+func (ev *evaluation) variable(name string) (interface{}, error) {
+	for b := ev.bindings; b != nil; b = b.parent {
+		if b.name == name {
+			return b.value, nil
+		}
+	}
+	value, ok := ev.constants[name]
+	if !ok {
+		value, ok = ev.ctx[name]
+	}
+	if !ok {
+		if ev.resolver == nil {
+			return nil, fmt.Errorf("no such variable %v (defined variables: %v)", name, ev.defined())
+		}
+		var err error
+		if value, err = ev.resolve(name); err != nil {
+			return nil, fmt.Errorf("could not resolve variable %v: %v", name, err)
+		}
+		ev.ctx[name] = value
+	}
+	value, ok = ev.cast(value)
+	if !ok {
+		return nil, fmt.Errorf("could not cast variable `%v` to float, string, bool, map or list", name)
+	}
+	return value, nil
+}
+
+/*
+defined returns a sorted, comma-separated list of the names of the variables which are defined, ie:
+those bound by lets, named constants, and variables from the context (but not those a resolver could
+resolve), eg: to point out a misspelt variable.
+*/
+func (ev *evaluation) defined() string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for b := ev.bindings; b != nil; b = b.parent {
+		add(b.name)
+	}
+	for name := range ev.constants {
+		add(name)
+	}
+	for name := range ev.ctx {
+		add(name)
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// member returns the member of the given map, or null if the map is null or has no such member.
+func (ev *evaluation) member(container interface{}, key string) (interface{}, error) {
+	if container == nil {
+		return nil, nil
+	}
+	c := reflect.ValueOf(container)
+	if c.Kind() != reflect.Map || c.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("cannot get member %q of %T", key, container)
+	}
+	member := c.MapIndex(reflect.ValueOf(key).Convert(c.Type().Key()))
+	if !member.IsValid() {
+		return nil, nil
+	}
+	value, ok := ev.cast(member.Interface())
+	if !ok {
+		return nil, fmt.Errorf("could not cast member %q to float, string, bool, map or list", key)
+	}
+	return value, nil
+}
+
+/*
+cast converts a value from the context (or a member of one) to a type supported by expressions,
+returning false if it is not supported. Integers of any width are numbers, octet strings (ie: []byte)
+are strings, and types defined on numbers, strings or bools are converted to them.
+*/
+func (ev *evaluation) cast(value interface{}) (interface{}, bool) {
+	// Attempt to cast to a number, then string, then bool, then list, then map, then fail. Nil is null.
+	switch value.(type) {
+	case nil:
+		return nil, true
+	case int, float64, string, bool:
+		return ev.number(value), true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Integers which floats cannot represent exactly are kept, even in FloatArithmetic.
+		if n := v.Int(); ev.arithmetic != FloatArithmetic || n > maxExactFloat || n < -maxExactFloat {
+			return ev.number(n), true
+		}
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n := v.Uint(); ev.arithmetic != FloatArithmetic || n > maxExactFloat {
+			return ev.number(n), true
+		}
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return ev.number(v.Float()), true
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true
+		}
+		return value, true // Lists (eg: a walked table column) can only be passed to functions, eg: sum.
+	case reflect.Map:
+		return value, true
+	}
+	return nil, false
+}
+
+func (f *Factor) eval(ev *evaluation) (interface{}, error) {
+	b, err := f.Base.eval(ev)
 	if err != nil {
 		return nil, err
 	}
 
 	if f.Exponent != nil {
-		exponentEval, err := f.Exponent.eval(ctx, caller)
+		exponentEval, err := f.Exponent.eval(ev)
 		if err != nil {
 			return nil, err
 		}
-		return math.Pow(b.(float64), exponentEval.(float64)), nil
+		if b, err = power(b, exponentEval); err != nil {
+			return nil, err
+		}
+	}
+	if f.Negated {
+		return negate(b)
 	}
 	return b, nil
 }
 
-func (t *Term) eval(ctx Context, caller FunctionCaller) (interface{}, error) {
-	n, err := t.Left.eval(ctx, caller)
+func (t *Term) eval(ev *evaluation) (interface{}, error) {
+	n, err := t.Left.eval(ev)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, r := range t.Right {
-		rFactorEval, err := r.Factor.eval(ctx, caller)
+		rFactorEval, err := r.Factor.eval(ev)
 		if err != nil {
 			return nil, err
 		}
 
-		n, err = r.Operator.eval(n, rFactorEval)
+		n, err = r.Operator.eval(ev, n, rFactorEval)
 		if err != nil {
 			return nil, err
 		}
+		if err := ev.check(n); err != nil {
+			return nil, err
+		}
 	}
 	return n, nil
 }
 
-func (e *Expression) eval(ctx Context, caller FunctionCaller) (interface{}, error) {
-	l, err := e.Left.eval(ctx, caller)
+func (s *Sum) eval(ev *evaluation) (interface{}, error) {
+	l, err := s.Left.eval(ev)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, r := range e.Right {
-		rEval, err := r.Term.eval(ctx, caller)
+	for _, r := range s.Right {
+		rEval, err := r.Term.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+
+		l, err = r.Operator.eval(ev, l, rEval)
+		if err != nil {
+			return nil, err
+		}
+		if err := ev.check(l); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (s *Shift) eval(ev *evaluation) (interface{}, error) {
+	l, err := s.Left.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range s.Right {
+		rEval, err := r.Sum.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+		if l, err = r.Operator.eval(ev, l, rEval); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (b *BitAnd) eval(ev *evaluation) (interface{}, error) {
+	l, err := b.Left.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range b.Right {
+		rEval, err := r.Shift.eval(ev)
 		if err != nil {
 			return nil, err
 		}
+		if l, err = r.Operator.eval(ev, l, rEval); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
 
-		l, err = r.Operator.eval(l, rEval)
+func (b *BitXor) eval(ev *evaluation) (interface{}, error) {
+	l, err := b.Left.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range b.Right {
+		rEval, err := r.BitAnd.eval(ev)
 		if err != nil {
 			return nil, err
 		}
+		if l, err = r.Operator.eval(ev, l, rEval); err != nil {
+			return nil, err
+		}
 	}
 	return l, nil
 }
 
+func (b *BitOr) eval(ev *evaluation) (interface{}, error) {
+	l, err := b.Left.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range b.Right {
+		rEval, err := r.BitXor.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+		if l, err = r.Operator.eval(ev, l, rEval); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (c *Comparison) eval(ev *evaluation) (interface{}, error) {
+	l, err := c.Left.eval(ev)
+	if err != nil || c.Right == nil {
+		return l, err
+	}
+	r, err := c.Right.BitOr.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	return c.Right.Operator.eval(ev, l, r)
+}
+
+// eval evaluates a conjunction, only evaluating as many comparisons as needed to find the result.
+func (c *Conjunction) eval(ev *evaluation) (interface{}, error) {
+	l, err := c.Left.eval(ev)
+	if err != nil || len(c.Right) == 0 {
+		return l, err
+	}
+	b, err := boolean(l, "&&")
+	for _, r := range c.Right {
+		if err != nil || !b {
+			break
+		}
+		if l, err = r.Comparison.eval(ev); err != nil {
+			return nil, err
+		}
+		b, err = boolean(l, "&&")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// eval evaluates an expression, only evaluating the branch of a conditional expression which is taken.
+func (e *Expression) eval(ev *evaluation) (interface{}, error) {
+	condition, err := e.coalesce(ev)
+	if err != nil || e.Then == nil {
+		return condition, err
+	}
+	b, err := boolean(condition, "?")
+	if err != nil {
+		return nil, err
+	}
+	if b {
+		return e.Then.eval(ev)
+	}
+	return e.Else.eval(ev)
+}
+
+// coalesce evaluates the disjunctions in turn, returning the first which is not null.
+func (e *Expression) coalesce(ev *evaluation) (interface{}, error) {
+	l, err := e.Left.eval(ev)
+	for _, r := range e.Right {
+		if err != nil || l != nil {
+			break
+		}
+		l, err = r.Disjunction.eval(ev)
+	}
+	return l, err
+}
+
+// eval evaluates a disjunction, only evaluating as many conjunctions as needed to find the result.
+func (d *Disjunction) eval(ev *evaluation) (interface{}, error) {
+	l, err := d.Left.eval(ev)
+	if err != nil || len(d.Right) == 0 {
+		return l, err
+	}
+	b, err := boolean(l, "||")
+	for _, r := range d.Right {
+		if err != nil || b {
+			break
+		}
+		if l, err = r.Conjunction.eval(ev); err != nil {
+			return nil, err
+		}
+		b, err = boolean(l, "||")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
 // Functions for returning information about expressions.
 
 func (f *Function) identifiers() (variables []string, functions []string) {
@@ -363,9 +1278,32 @@ func (v *Value) identifiers() (variables []string, functions []string) {
 	case v.Variable != nil:
 		variables = append(variables, *v.Variable)
 	case v.Function != nil:
-		return v.Function.identifiers()
+		variables, functions = v.Function.identifiers()
+	case v.Not != nil:
+		variables, functions = v.Not.identifiers()
+	case v.Try != nil:
+		variables, functions = v.Try.Body.Identifiers()
+		fallbackVars, fallbackFuncs := v.Try.Fallback.Identifiers()
+		variables = append(variables, fallbackVars...)
+		functions = append(functions, fallbackFuncs...)
+	case v.Let != nil:
+		variables, functions = v.Let.Value.Identifiers()
+		bodyVars, bodyFuncs := v.Let.Body.Identifiers()
+		for _, variable := range bodyVars {
+			if variable != v.Let.Name { // References to the binding are not variables.
+				variables = append(variables, variable)
+			}
+		}
+		functions = append(functions, bodyFuncs...)
 	case v.Subexpression != nil:
-		return v.Subexpression.Identifiers()
+		variables, functions = v.Subexpression.Identifiers()
+	}
+	for _, m := range v.Members {
+		if m.Key != nil {
+			keyVars, keyFuncs := m.Key.Identifiers()
+			variables = append(variables, keyVars...)
+			functions = append(functions, keyFuncs...)
+		}
 	}
 	return variables, functions
 }
@@ -390,55 +1328,415 @@ func (t *Term) identifiers() (variables []string, functions []string) {
 	return variables, functions
 }
 
+func (s *Sum) identifiers() (variables []string, functions []string) {
+	variables, functions = s.Left.identifiers()
+	for _, r := range s.Right {
+		opTermVars, opTermFuncs := r.Term.identifiers()
+		variables = append(variables, opTermVars...)
+		functions = append(functions, opTermFuncs...)
+	}
+	return variables, functions
+}
+
+func (s *Shift) identifiers() (variables []string, functions []string) {
+	variables, functions = s.Left.identifiers()
+	for _, r := range s.Right {
+		rVars, rFuncs := r.Sum.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
+func (b *BitAnd) identifiers() (variables []string, functions []string) {
+	variables, functions = b.Left.identifiers()
+	for _, r := range b.Right {
+		rVars, rFuncs := r.Shift.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
+func (b *BitXor) identifiers() (variables []string, functions []string) {
+	variables, functions = b.Left.identifiers()
+	for _, r := range b.Right {
+		rVars, rFuncs := r.BitAnd.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
+func (b *BitOr) identifiers() (variables []string, functions []string) {
+	variables, functions = b.Left.identifiers()
+	for _, r := range b.Right {
+		rVars, rFuncs := r.BitXor.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
+func (c *Comparison) identifiers() (variables []string, functions []string) {
+	variables, functions = c.Left.identifiers()
+	if c.Right != nil {
+		rVars, rFuncs := c.Right.BitOr.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
+func (c *Conjunction) identifiers() (variables []string, functions []string) {
+	variables, functions = c.Left.identifiers()
+	for _, r := range c.Right {
+		rVars, rFuncs := r.Comparison.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
+func (d *Disjunction) identifiers() (variables []string, functions []string) {
+	variables, functions = d.Left.identifiers()
+	for _, r := range d.Right {
+		rVars, rFuncs := r.Conjunction.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	return variables, functions
+}
+
 // Identifiers returns the names of the variables and functions in the given expression.
 func (e *Expression) Identifiers() (variables []string, functions []string) {
 	if e.Left != nil { // Can be nil if the expression is empty (ie: "").
 		variables, functions = e.Left.identifiers()
 	}
 	for _, r := range e.Right {
-		opTermVars, opTermFuncs := r.Term.identifiers()
-		variables = append(variables, opTermVars...)
-		functions = append(functions, opTermFuncs...)
+		rVars, rFuncs := r.Disjunction.identifiers()
+		variables = append(variables, rVars...)
+		functions = append(functions, rFuncs...)
+	}
+	for _, branch := range []*Expression{e.Then, e.Else} {
+		if branch != nil {
+			branchVars, branchFuncs := branch.Identifiers()
+			variables = append(variables, branchVars...)
+			functions = append(functions, branchFuncs...)
+		}
 	}
 	return variables, functions
 }
 
-// Context maps variable names to the values they should be replaced by in expressions.
+/*
+OptionalVariables returns the variables which only appear in the left operands of coalescing operators
+(eg: hc_counter in `hc_counter ?? counter`), so the expression can be evaluated with them set to null.
+*/
+func (e *Expression) OptionalVariables() []string {
+	return e.unrequiredVariables(e.shielded(false))
+}
+
+/*
+RequiredVariables returns the variables without which the expression cannot be evaluated, ie: those
+which appear outside the left operands of coalescing operators (see OptionalVariables) and outside the
+bodies of try expressions, which fall back if a variable cannot be resolved.
+*/
+func (e *Expression) RequiredVariables() []string {
+	unrequired := map[string]bool{}
+	for _, variable := range e.unrequiredVariables(e.shielded(true)) {
+		unrequired[variable] = true
+	}
+	var required []string
+	e.references(func(v *Value) {
+		if !unrequired[*v.Variable] {
+			required = append(required, *v.Variable)
+			unrequired[*v.Variable] = true // Only return each variable once.
+		}
+	})
+	return required
+}
+
+/*
+shielded returns the values within the left operands of coalescing operators and, if tried is true,
+within the bodies of try expressions.
+*/
+func (e *Expression) shielded(tried bool) map[*Value]bool {
+	shielded := map[*Value]bool{}
+	shield := func(v *Value) { shielded[v] = true }
+	expressions(e, func(x *Expression) {
+		if len(x.Right) == 0 {
+			return
+		}
+		walk(x.Left, shield)
+		for _, r := range x.Right[:len(x.Right)-1] {
+			walk(r.Disjunction, shield)
+		}
+	})
+	if tried {
+		walk(e, func(v *Value) {
+			if v.Try != nil {
+				walk(v.Try.Body, shield)
+			}
+		})
+	}
+	return shielded
+}
+
+// unrequiredVariables returns the variables which only appear in the given values.
+func (e *Expression) unrequiredVariables(shielded map[*Value]bool) []string {
+	var variables []string
+	required := map[string]bool{}
+	e.references(func(v *Value) {
+		variables = append(variables, *v.Variable)
+		required[*v.Variable] = required[*v.Variable] || !shielded[v]
+	})
+	var unrequired []string
+	for _, variable := range variables {
+		if !required[variable] {
+			unrequired = append(unrequired, variable)
+			required[variable] = true // Only return each variable once.
+		}
+	}
+	return unrequired
+}
+
+/*
+Context maps variable names to the values they should be replaced by in expressions. Values may be
+numbers of any type (eg: uint64 counters), strings, octet strings ([]byte), bools, maps with string
+keys, lists (slices, which expressions can only pass to functions), or nil.
+*/
 type Context map[string]interface{}
 
+/*
+KeywordArgs are the keyword arguments of a function call, by keyword, eg: `units='ms'` in
+`time_since_epoch(t, units='ms')`. A call with keyword arguments passes them to the FunctionCaller
+after its positional arguments, as a single KeywordArgs.
+*/
+type KeywordArgs map[string]interface{}
+
+/*
+VariableResolver returns the value of the variable with the given name, for evaluating expressions
+whose variables are only fetched if they are referenced (see EvalWithResolver).
+*/
+type VariableResolver func(name string) (interface{}, error)
+
 /*
 FunctionCaller defines a function which can call another function given its name as a string and any
-arguments.
+arguments. The slice of arguments is reused once the call returns, so it must not be kept (although
+the arguments themselves may be).
 */
 type FunctionCaller func(string, ...interface{}) (interface{}, error)
 
+/*
+ContextFunctionCaller is like FunctionCaller, but is also passed the context of the evaluation (see
+EvalContext), eg: to abandon a slow call once the context is done.
+*/
+type ContextFunctionCaller func(ctx context.Context, name string, args ...interface{}) (interface{}, error)
+
+/*
+ParseError is returned by Parse if a string is not a valid expression. Line and Column locate the
+offending character (both start at 1), and are 0 if its position is unknown.
+*/
+type ParseError struct {
+	Input   string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("could not parse string %q: %v", e.Input, e.Message)
+	}
+	return fmt.Sprintf("could not parse string %q at %d:%d: %v\n%v", e.Input, e.Line, e.Column, e.Message, e.Context())
+}
+
+/*
+Context returns the line of the input containing the offending character, and a caret pointing to
+it on the next line, eg:
+
+	to_int(a +) / 100
+	         ^
+*/
+func (e *ParseError) Context() string {
+	lines := strings.Split(e.Input, "\n")
+	if e.Line < 1 || e.Line > len(lines) || e.Column < 1 {
+		return ""
+	}
+	line := []rune(lines[e.Line-1])
+	caret := make([]rune, e.Column)
+	for i := range caret {
+		// Keep tabs, so that the caret lines up however tabs are displayed.
+		if i < len(line) && line[i] == '\t' {
+			caret[i] = '\t'
+		} else {
+			caret[i] = ' '
+		}
+	}
+	caret[e.Column-1] = '^'
+	return string(line) + "\n" + string(caret)
+}
+
 /*
 Parse is a convenience function which parses a string and returns the resulting expression, which
-can then be evaluated.
+can then be evaluated. If the string is not a valid expression, or exceeds DefaultParseLimits, the
+error is a *ParseError.
 */
 func Parse(input string) (*Expression, error) {
-	expression := &Expression{}
-	parser, err := participle.Build(expression)
+	return ParseWithLimits(input, DefaultParseLimits)
+}
+
+// ParseWithLimits is like Parse, but fails if the input exceeds the given limits.
+func ParseWithLimits(input string, limits ParseLimits) (*Expression, error) {
+	if err := limits.check(input); err != nil {
+		return nil, err
+	}
+	tokens, err := lex(input)
 	if err != nil {
-		return nil, fmt.Errorf("could not build parser (try checking the grammar): %v", err)
+		return nil, newParseError(input, err)
 	}
-
-	if err = parser.ParseString(input, expression); err != nil {
-		return nil, fmt.Errorf("could not parse string %q: %v", input, err)
+	expression, err := parse(tokens)
+	if err != nil {
+		return nil, newParseError(input, err)
+	}
+	if err = expression.desugar(); err != nil {
+		return nil, &ParseError{Input: input, Message: err.Error()}
 	}
 	return expression, nil
 }
 
+/*
+desugar replaces the pipelines of the expression, and of every expression within it, by calls, and
+moves the keywords of keyword arguments to their names, returning an error if a keyword is not a name
+or is repeated, or if a positional argument follows a keyword argument.
+*/
+func (e *Expression) desugar() error {
+	var err error
+	Inspect(e, func(n Node) bool {
+		if f, ok := n.(*Function); ok && err == nil {
+			err = f.desugar()
+		}
+		// Expressions are desugared before their children are inspected, which include their pipelines.
+		if x, ok := n.(*Expression); ok && len(x.Pipes) > 0 {
+			piped := &Expression{Left: x.Left, Right: x.Right}
+			for _, pipe := range x.Pipes {
+				function := pipe.Function
+				if function == nil {
+					function = &Function{Name: *pipe.Name, Open: "(", Close: ")"}
+				}
+				function.Args = append([]*Arg{{Value: *piped}}, function.Args...)
+				piped = valueExpression(&Value{Function: function})
+			}
+			x.Left, x.Right, x.Pipes = piped.Left, nil, nil
+		}
+		return true
+	})
+	return err
+}
+
+func (f *Function) desugar() error {
+	keywords := map[string]bool{}
+	for _, arg := range f.Args {
+		if arg.Keyword == nil {
+			if len(keywords) > 0 {
+				return fmt.Errorf("positional argument `%v` of function %q follows a keyword argument", &arg.Value, f.Name)
+			}
+			continue
+		}
+		keyword := arg.Value.value()
+		if len(arg.Value.Pipes) > 0 || keyword == nil || keyword.Variable == nil || len(keyword.Members) > 0 {
+			return fmt.Errorf("keyword `%v` of function %q must be a name", &arg.Value, f.Name)
+		}
+		name := *keyword.Variable
+		if keywords[name] {
+			return fmt.Errorf("keyword %q is repeated in call of function %q", name, f.Name)
+		}
+		keywords[name] = true
+		arg.Name, arg.Value, arg.Keyword = name, *arg.Keyword, nil
+	}
+	return nil
+}
+
+// newParseError converts a syntax error to a ParseError, locating its offset by line and column.
+func newParseError(input string, err error) *ParseError {
+	parseError := &ParseError{Input: input, Message: err.Error()}
+	if syntax, ok := err.(*syntaxError); ok {
+		before := input[:syntax.offset]
+		parseError.Line = strings.Count(before, "\n") + 1
+		parseError.Column = utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	}
+	return parseError
+}
+
 /*
 Eval is a convenience function which evaluates a parsed expression and returns the result.
-The ctx parameter is a map containing variable definitions. Note that all numeric variable values
-are cast to float64.
+The ctx parameter is a map containing variable definitions. Numbers are evaluated with
+FloatArithmetic: int64 and uint64 variable values stay exact, as does arithmetic on two of them, but
+other numbers (including literals) are float64s. See Options.Arithmetic (and EvalWithOptions) for
+arithmetic which keeps every integer exact.
 */
 func Eval(expression *Expression, ctx Context, caller FunctionCaller) (interface{}, error) {
-	result, err := expression.eval(ctx, caller)
+	return EvalWithOptions(expression, ctx, caller, Options{})
+}
+
+/*
+EvalWithLimits is like Eval, but fails if evaluation exceeds the given limits, so that a malformed or
+malicious expression cannot exhaust the resources of a shared process.
+*/
+func EvalWithLimits(expression *Expression, ctx Context, caller FunctionCaller, limits Limits) (interface{}, error) {
+	return EvalWithOptions(expression, ctx, caller, Options{Limits: limits})
+}
+
+/*
+EvalWithOptions is like Eval, but evaluates the expression with the given options, eg: to keep
+integer arithmetic exact (see IntegerArithmetic).
+*/
+func EvalWithOptions(expression *Expression, ctx Context, caller FunctionCaller, options Options) (interface{}, error) {
+	return evaluate(expression, newEvaluation(ctx, caller, options))
+}
+
+/*
+EvalWithResolver is like EvalWithOptions, but gets the values of variables from the resolver when
+they are first referenced, rather than from a context populated beforehand. Variables which are not
+referenced (eg: in a branch of a conditional expression which is not taken, or after a short-circuited
+operator) are never resolved.
+*/
+func EvalWithResolver(expression *Expression, resolver VariableResolver, caller FunctionCaller, options Options) (interface{}, error) {
+	ev := newEvaluation(Context{}, caller, options)
+	ev.resolver = resolver
+	return evaluate(expression, ev)
+}
+
+/*
+EvalContext is like Eval, but stops evaluating the expression once the context is done, eg: when the
+deadline of a collection passes, and passes the context to each function call. The context is checked
+between steps of the evaluation, as limits are (see Limits), and like exceeding a limit, cancellation
+cannot be caught by try.
+*/
+func EvalContext(ctx context.Context, expression *Expression, vars Context, caller ContextFunctionCaller) (interface{}, error) {
+	if ctx.Err() != nil { // Eg: if the deadline passed while fetching the variables.
+		return nil, fmt.Errorf("could not evaluate expression `%v`: %v", expression, cancelled(ctx))
+	}
+	var withContext FunctionCaller
+	if caller != nil {
+		withContext = func(name string, args ...interface{}) (interface{}, error) {
+			return caller(ctx, name, args...)
+		}
+	}
+	ev := newEvaluation(vars, withContext, Options{})
+	ev.cancel = ctx
+	return evaluate(expression, ev)
+}
+
+func evaluate(expression *Expression, ev *evaluation) (interface{}, error) {
+	result, err := expression.eval(ev)
+	ev.release()
 	if err != nil {
 		return nil, fmt.Errorf("could not evaluate expression `%v`: %v", expression, err)
 	}
-	glog.Infof("Evaluated expression: %v = %v", expression, result)
+	result = fromRat(result)
+	if glog.V(1) { // Checked first, so that the arguments are not even allocated otherwise.
+		glog.Infof("Evaluated expression: %v = %v", expression, result)
+	}
 	return result, nil
 }
@@ -17,7 +17,12 @@ limitations under the License.
 package oparse
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -32,6 +37,111 @@ func TestParse(t *testing.T) {
 			name:          "empty expression",
 			expectedError: true,
 		},
+		{
+			name:             "invalid binary literal",
+			expressionString: "0b102",
+			expectedError:    true,
+		},
+		{
+			name:             "hexadecimal literal without digits",
+			expressionString: "0x",
+			expectedError:    true,
+		},
+		{
+			name:             "leading zero",
+			expressionString: "017",
+		},
+		{
+			name:             "leading zero with digits which are not octal",
+			expressionString: "09 + 019",
+		},
+		{
+			name:             "octal literal with digits which are not octal",
+			expressionString: "0o19",
+			expectedError:    true,
+		},
+		{
+			name:             "try without else",
+			expressionString: "try a",
+			expectedError:    true,
+		},
+		{
+			name:             "else without try",
+			expressionString: "a else b",
+			expectedError:    true,
+		},
+		{
+			name:             "let without body",
+			expressionString: "let x = 1;",
+			expectedError:    true,
+		},
+		{
+			name:             "let without semicolon",
+			expressionString: "let x = 1 x",
+			expectedError:    true,
+		},
+		{
+			name:             "arguments without a comma",
+			expressionString: "f(1 2)",
+			expectedError:    true,
+		},
+		{
+			name:             "trailing comma",
+			expressionString: "f(a, b,)",
+			expectedError:    true,
+		},
+		{
+			name:             "leading comma",
+			expressionString: "f(, a)",
+			expectedError:    true,
+		},
+		{
+			name:             "repeated comma",
+			expressionString: "f(a,, b)",
+			expectedError:    true,
+		},
+		{
+			name:             "lone comma",
+			expressionString: "f(,)",
+			expectedError:    true,
+		},
+		{
+			name:             "trailing tokens",
+			expressionString: "f(a) b",
+			expectedError:    true,
+		},
+		{
+			name:             "call without arguments",
+			expressionString: "f()",
+		},
+		{
+			name:             "keyword arguments",
+			expressionString: "time_since_epoch(ts, format='ntp', units = 'ms')",
+		},
+		{
+			name:             "comparison in an argument",
+			expressionString: "f(a == 1, b=c == 2)",
+		},
+		{
+			name:             "keyword which is not a name",
+			expressionString: "f(a.b='ntp')",
+			expectedError:    true,
+		},
+		{
+			name:             "repeated keyword",
+			expressionString: "f(a=1, a=2)",
+			expectedError:    true,
+		},
+		{
+			name:             "positional argument after a keyword argument",
+			expressionString: "f(a=1, 2)",
+			expectedError:    true,
+		},
+		{
+			name:             "keyword argument outside of a call",
+			expressionString: "a = 1",
+			expectedError:    true,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -46,6 +156,150 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseError(t *testing.T) {
+	for _, test := range []struct {
+		input           string
+		expectedLine    int
+		expectedColumn  int
+		expectedContext string
+	}{
+		{
+			input:           "to_int(a +) / 100",
+			expectedLine:    1,
+			expectedColumn:  10,
+			expectedContext: "to_int(a +) / 100\n         ^",
+		},
+		{
+			input:           "(1 + )",
+			expectedLine:    1,
+			expectedColumn:  4,
+			expectedContext: "(1 + )\n   ^",
+		},
+		{
+			input:           "(1 + -)",
+			expectedLine:    1,
+			expectedColumn:  7,
+			expectedContext: "(1 + -)\n      ^",
+		},
+		{
+			input:           "f(1,)",
+			expectedLine:    1,
+			expectedColumn:  4,
+			expectedContext: "f(1,)\n   ^",
+		},
+		{
+			input:           "f(1,\n\t2 $ 3)",
+			expectedLine:    2,
+			expectedColumn:  4,
+			expectedContext: "\t2 $ 3)\n\t  ^",
+		},
+		{
+			input:           "1 +",
+			expectedLine:    1,
+			expectedColumn:  4,
+			expectedContext: "1 +\n   ^",
+		},
+		{
+			input:           "'unterminated",
+			expectedLine:    1,
+			expectedColumn:  14,
+			expectedContext: "'unterminated\n             ^",
+		},
+		{
+			input:           "",
+			expectedLine:    1,
+			expectedColumn:  1,
+			expectedContext: "\n^",
+		},
+	} {
+		_, err := Parse(test.input)
+		parseError, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Parse(%q) got error %v, expected a ParseError", test.input, err)
+			continue
+		}
+		if parseError.Line != test.expectedLine || parseError.Column != test.expectedColumn {
+			t.Errorf("Parse(%q) got error at %d:%d, expected %d:%d", test.input, parseError.Line, parseError.Column, test.expectedLine, test.expectedColumn)
+		}
+		if got := parseError.Context(); got != test.expectedContext {
+			t.Errorf("Parse(%q) got error context:\n%v\nexpected:\n%v", test.input, got, test.expectedContext)
+		}
+	}
+}
+
+func TestParsePipelines(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		expected         string
+		expectedError    bool
+	}{
+		{
+			name:             "chain",
+			expressionString: "value |> to_int |> to_str",
+			expected:         "to_str(to_int(value))",
+		},
+		{
+			name:             "function with arguments",
+			expressionString: "t |> time_since_epoch('ntp', 's') |> to_int",
+			expected:         "to_int(time_since_epoch(t, 'ntp', 's'))",
+		},
+		{
+			name:             "function with keyword arguments",
+			expressionString: "t |> time_since_epoch(format='ntp', units='s')",
+			expected:         "time_since_epoch(t, format='ntp', units='s')",
+		},
+		{
+			name:             "operators bind more tightly",
+			expressionString: "a + b * c |> f",
+			expected:         "f(a + b * c)",
+		},
+		{
+			name:             "bitwise and logical or",
+			expressionString: "a | b || c |> f",
+			expected:         "f(a | b || c)",
+		},
+		{
+			name:             "coalescing and conditional",
+			expressionString: "a ?? b |> f ? c : d |> g",
+			expected:         "f(a ?? b) ? c : g(d)",
+		},
+		{
+			name:             "nested pipelines",
+			expressionString: "f(x |> g, (y |> h(1)) + 1)[k |> to_str]",
+			expected:         "f(g(x), (h(y, 1)) + 1)[to_str(k)]",
+		},
+		{
+			name:             "pipeline in a pipeline stage",
+			expressionString: "x |> f(y |> g) |> h",
+			expected:         "h(f(x, g(y)))",
+		},
+		{
+			name:             "missing function",
+			expressionString: "x |>",
+			expectedError:    true,
+		},
+		{
+			name:             "piping into a value",
+			expressionString: "x |> 1",
+			expectedError:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			switch {
+			case err == nil && test.expectedError:
+				t.Errorf("Parse(%q) = %v, expected error", test.expressionString, expression)
+			case err != nil && !test.expectedError:
+				t.Errorf("Parse(%q) got error: %v", test.expressionString, err)
+			case err == nil && expression.String() != test.expected:
+				t.Errorf("Parse(%q) = %q, expected %q", test.expressionString, expression, test.expected)
+			}
+		})
+	}
+}
+
 func TestEval(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -70,6 +324,127 @@ func TestEval(t *testing.T) {
 			expressionString: "(10 + 1) * 1000",
 			expected:         11000.0,
 		},
+		{
+			name:             "hexadecimal, octal and binary literals",
+			expressionString: "0x1F + 0o17 + 0b1010",
+			expected:         56.0,
+		},
+		{
+			name:             "leading zero is not octal",
+			expressionString: "017",
+			expected:         17.0,
+		},
+		{
+			name:             "leading zero with digits which are not octal",
+			expressionString: "09 + 019",
+			expected:         28.0,
+		},
+		{
+			name:             "digit separators",
+			expressionString: "0xFF_FF + 1_000",
+			expected:         66535.0,
+		},
+		{
+			name:             "bitwise and",
+			expressionString: "status & 0x0F",
+			context:          Context{"status": 0x5A},
+			expected:         10.0,
+		},
+		{
+			name:             "bitwise precedence",
+			expressionString: "1 | 6 ~ 3 & 2",
+			expected:         5.0, // 1 | (6 ~ (3 & 2))
+		},
+		{
+			name:             "shifts bind looser than arithmetic",
+			expressionString: "1 << 2 + 1 >> 1",
+			expected:         4.0,
+		},
+		{
+			name:             "bitwise operators bind tighter than comparisons",
+			expressionString: "flags & 4 == 4 && flags | 1 != flags",
+			context:          Context{"flags": 6},
+			expected:         true,
+		},
+		{
+			name:             "shift of a negative number",
+			expressionString: "-8 >> 1",
+			expected:         -4.0,
+		},
+		{
+			name:             "bitwise operator on a fraction",
+			expressionString: "1.5 & 1",
+			expectedError:    true,
+		},
+		{
+			name:             "bitwise operator on a string",
+			expressionString: "'a' | 1",
+			expectedError:    true,
+		},
+		{
+			name:             "shift count too large",
+			expressionString: "1 << 65",
+			expectedError:    true,
+		},
+		{
+			name:             "negative shift count",
+			expressionString: "1 >> (-1)",
+			expectedError:    true,
+		},
+		{
+			name:             "modulo",
+			expressionString: "17 % 5 * 2 + 1",
+			expected:         5.0,
+		},
+		{
+			name:             "modulo of a fraction",
+			expressionString: "7.5 % 2",
+			expected:         1.5,
+		},
+		{
+			name:             "modulo by zero",
+			expressionString: "i % 0",
+			context:          Context{"i": 10},
+			expectedError:    true,
+		},
+		{
+			name:             "modulo of a string",
+			expressionString: "'a' % 2",
+			expectedError:    true,
+		},
+		{
+			name:             "negated variable",
+			expressionString: "-x * 2",
+			context:          Context{"x": 3},
+			expected:         -6.0,
+		},
+		{
+			name:             "negated subexpression",
+			expressionString: "-(a + b)",
+			context:          Context{"a": 1, "b": 2},
+			expected:         -3.0,
+		},
+		{
+			name:             "negated operand",
+			expressionString: "10 - -x / -2",
+			context:          Context{"x": 4},
+			expected:         8.0,
+		},
+		{
+			name:             "negation binds looser than exponentiation",
+			expressionString: "-2 ^ 2",
+			expected:         -4.0,
+		},
+		{
+			name:             "negated string",
+			expressionString: "-'a'",
+			expectedError:    true,
+		},
+		{
+			name:             "double negation",
+			expressionString: "--1",
+			expectedError:    true,
+		},
 		{
 			name:             "division by zero",
 			expressionString: "100 / 0",
@@ -106,6 +481,42 @@ func TestEval(t *testing.T) {
 			context:          Context{"boot_time": 10, "last_change_relative": 5},
 			expected:         15000.0,
 		},
+		{
+			name:             "64-bit integer variables",
+			expressionString: "counter - i",
+			context:          Context{"counter": uint64(1 << 40), "i": int64(1)},
+			expected:         float64(1<<40 - 1),
+		},
+		{
+			name:             "integer variables of other widths",
+			expressionString: "a + b + c + d",
+			context:          Context{"a": int32(-1), "b": uint32(2), "c": uint(3), "d": float32(0.5)},
+			expected:         4.5,
+		},
+		{
+			name:             "octet string variable",
+			expressionString: "mac + '!'",
+			context:          Context{"mac": []byte{0x61, 0x62}},
+			expected:         "ab!",
+		},
+		{
+			name:             "variable of a type defined on an integer",
+			expressionString: "d / 1000",
+			context:          Context{"d": time.Microsecond},
+			expected:         1.0,
+		},
+		{
+			name:             "variable of an unsupported type",
+			expressionString: "a",
+			context:          Context{"a": struct{}{}},
+			expectedError:    true,
+		},
+		{
+			name:             "list variable",
+			expressionString: "a",
+			context:          Context{"a": []int{1}},
+			expected:         []int{1},
+		},
 
 		// Strings
 		{
@@ -235,88 +646,746 @@ func TestEval(t *testing.T) {
 			expressionString: "'The answer is ' + (41 + myfunc(100))",
 			expected:         "The answer is 42",
 		},
-	}
-	// Dummy function caller which returns 1 for any function name.
-	caller := func(funcName string, args ...interface{}) (interface{}, error) {
-		return 1, nil
-	}
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			expression, err := Parse(test.expressionString)
-			var got interface{}
-			if err == nil {
-				got, err = Eval(expression, test.context, caller)
-			}
-			switch {
-			case !test.expectedError && err != nil:
-				t.Errorf("%v: got `%v`, expected no error", test.name, err)
-			case test.expectedError && err == nil:
-				t.Errorf("%v: got no error, expected error", test.name)
-			case !cmp.Equal(test.expected, got) && err == nil:
-				t.Errorf("%v: got `%v`, expected `%v`", test.name, got, test.expected)
-			}
-		})
-	}
-}
 
-func TestIdentifiers(t *testing.T) {
-	tests := []struct {
-		name             string
-		expressionString string
-		expectedVars     []string
-		expectedFuncs    []string
-	}{
+		// Booleans
 		{
-			name:             "no identifiers",
-			expressionString: "1 + 3 - 4",
+			name:             "boolean literal",
+			expressionString: "true",
+			expected:         true,
 		},
 		{
-			name:             "one variable",
-			expressionString: "i",
-			expectedVars:     []string{"i"},
+			name:             "not",
+			expressionString: "!false",
+			expected:         true,
 		},
 		{
-			name:             "one func",
-			expressionString: "func()",
-			expectedFuncs:    []string{"func"},
+			name:             "and binds tighter than or",
+			expressionString: "true || false && false",
+			expected:         true,
 		},
 		{
-			name:             "one func, one var",
-			expressionString: "i + func()",
-			expectedFuncs:    []string{"func"},
-			expectedVars:     []string{"i"},
+			name:             "brackets around or",
+			expressionString: "(true || false) && false",
+			expected:         false,
 		},
 		{
-			name:             "var in func",
-			expressionString: "func(i)",
-			expectedFuncs:    []string{"func"},
-			expectedVars:     []string{"i"},
+			name:             "numeric comparison",
+			expressionString: "i * 2 >= 20 && i != 11",
+			context:          Context{"i": 10},
+			expected:         true,
 		},
 		{
-			name:             "arithmetic containing a var in a func",
-			expressionString: "func(i+1)",
-			expectedFuncs:    []string{"func"},
-			expectedVars:     []string{"i"},
+			name:             "string comparison",
+			expressionString: "s == 'up' || s < 'b'",
+			context:          Context{"s": "down"},
+			expected:         false,
 		},
 		{
-			name:             "complex",
-			expressionString: "i + j + func(s, t) * myfunc(q + another(1+3))",
-			expectedFuncs:    []string{"func", "myfunc", "another"},
-			expectedVars:     []string{"i", "j", "s", "t", "q"},
+			name:             "boolean variable",
+			expressionString: "!enabled || i > 1",
+			context:          Context{"enabled": true, "i": 10},
+			expected:         true,
 		},
 		{
-			name:             "start with a bracket",
-			expressionString: "(boot_time + to_int(last_change_relative)) * 1000",
-			expectedFuncs:    []string{"to_int"},
-			expectedVars:     []string{"boot_time", "last_change_relative"},
+			name:             "and short-circuits",
+			expressionString: "false && missing",
+			expected:         false,
 		},
-	}
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			expression, err := Parse(test.expressionString)
-			gotVars, gotFuncs := expression.Identifiers()
-			switch {
-			case err != nil:
+		{
+			name:             "or short-circuits",
+			expressionString: "true || 1 / 0 > 1",
+			expected:         true,
+		},
+		{
+			name:             "and of non-booleans",
+			expressionString: "1 && true",
+			expectedError:    true,
+		},
+		{
+			name:             "not of a number",
+			expressionString: "!1",
+			expectedError:    true,
+		},
+		{
+			name:             "comparison of mismatched types",
+			expressionString: "1 == '1'",
+			expectedError:    true,
+		},
+		{
+			name:             "ordering of booleans",
+			expressionString: "true < false",
+			expectedError:    true,
+		},
+		{
+			name:             "chained comparison",
+			expressionString: "1 < 2 < 3",
+			expectedError:    true,
+		},
+
+		// Maps
+		{
+			name:             "member access",
+			expressionString: "row.in_octets * 8",
+			context:          Context{"row": map[string]interface{}{"in_octets": 100}},
+			expected:         800.0,
+		},
+		{
+			name:             "member access by key",
+			expressionString: "row['if-name'] + ': ' + row[field]",
+			context:          Context{"row": map[string]interface{}{"if-name": "eth0", "status": "up"}, "field": "status"},
+			expected:         "eth0: up",
+		},
+		{
+			name:             "nested members",
+			expressionString: "!device.interfaces.eth0.up",
+			context:          Context{"device": map[string]interface{}{"interfaces": map[string]interface{}{"eth0": map[string]interface{}{"up": false}}}},
+			expected:         true,
+		},
+		{
+			name:             "member of a map of strings",
+			expressionString: "row.descr",
+			context:          Context{"row": map[string]string{"descr": "uplink"}},
+			expected:         "uplink",
+		},
+		{
+			name:             "member of a function result",
+			expressionString: "f().a",
+			expected:         1.0,
+		},
+		{
+			name:             "missing member",
+			expressionString: "row.out_octets",
+			context:          Context{"row": map[string]interface{}{"in_octets": 100}},
+			expected:         nil,
+		},
+		{
+			name:             "member of a number",
+			expressionString: "i.a",
+			context:          Context{"i": 10},
+			expectedError:    true,
+		},
+		{
+			name:             "non-string key",
+			expressionString: "row[1]",
+			context:          Context{"row": map[string]interface{}{"1": 100}},
+			expectedError:    true,
+		},
+		{
+			name:             "member of an unsupported type",
+			expressionString: "row.a",
+			context:          Context{"row": map[string]interface{}{"a": make(chan int)}},
+			expectedError:    true,
+		},
+
+		// Conditional expressions
+		{
+			name:             "conditional",
+			expressionString: "up ? speed * 1000 : 0",
+			context:          Context{"up": true, "speed": 10},
+			expected:         10000.0,
+		},
+		{
+			name:             "conditional with comparison",
+			expressionString: "to_int(status) == 1 ? 'up' : 'down'",
+			context:          Context{"status": "1"},
+			expected:         "up",
+		},
+		{
+			name:             "nested conditionals",
+			expressionString: "i < 0 ? 'negative' : i == 0 ? 'zero' : 'positive'",
+			context:          Context{"i": 0},
+			expected:         "zero",
+		},
+		{
+			name:             "conditional in subexpression",
+			expressionString: "'speed: ' + (hc ? high_speed : speed)",
+			context:          Context{"hc": false, "speed": 100},
+			expected:         "speed: 100",
+		},
+		{
+			name:             "conditional only evaluates the branch taken",
+			expressionString: "true ? 1 : missing / 0",
+			expected:         1.0,
+		},
+		{
+			name:             "conditional with non-boolean condition",
+			expressionString: "1 ? 2 : 3",
+			expectedError:    true,
+		},
+		{
+			name:             "conditional without else",
+			expressionString: "true ? 1",
+			expectedError:    true,
+		},
+
+		// Null and coalescing
+		{
+			name:             "null",
+			expressionString: "null",
+			expected:         nil,
+		},
+		{
+			name:             "null variable",
+			expressionString: "i",
+			context:          Context{"i": nil},
+			expected:         nil,
+		},
+		{
+			name:             "coalesce null",
+			expressionString: "hc_counter ?? counter",
+			context:          Context{"hc_counter": nil, "counter": 10},
+			expected:         10.0,
+		},
+		{
+			name:             "coalesce only evaluates operands until one is not null",
+			expressionString: "hc_counter ?? missing / 0",
+			context:          Context{"hc_counter": 10},
+			expected:         10.0,
+		},
+		{
+			name:             "coalesce chain",
+			expressionString: "null ?? row.b ?? row.a ?? 0",
+			context:          Context{"row": map[string]interface{}{"a": 1}},
+			expected:         1.0,
+		},
+		{
+			name:             "coalesce keeps false",
+			expressionString: "false ?? true",
+			expected:         false,
+		},
+		{
+			name:             "coalesce binds looser than arithmetic",
+			expressionString: "a * 2 ?? 0",
+			context:          Context{"a": 3},
+			expected:         6.0,
+		},
+		{
+			name:             "coalesce as a condition",
+			expressionString: "up ?? false ? 'up' : 'down'",
+			context:          Context{"up": nil},
+			expected:         "down",
+		},
+		{
+			name:             "member of null",
+			expressionString: "row.a.b ?? 'none'",
+			context:          Context{"row": map[string]interface{}{}},
+			expected:         "none",
+		},
+		{
+			name:             "null equals null",
+			expressionString: "i == null",
+			context:          Context{"i": nil},
+			expected:         true,
+		},
+		{
+			name:             "null does not equal zero",
+			expressionString: "0 != null",
+			expected:         true,
+		},
+		{
+			name:             "null cannot be ordered",
+			expressionString: "null < 1",
+			expectedError:    true,
+		},
+		{
+			name:             "arithmetic on null",
+			expressionString: "i + 1",
+			context:          Context{"i": nil},
+			expectedError:    true,
+		},
+		{
+			name:             "concatenation with null",
+			expressionString: "'speed: ' + i",
+			context:          Context{"i": nil},
+			expectedError:    true,
+		},
+		{
+			name:             "errors are not coalesced",
+			expressionString: "missing ?? 1",
+			expectedError:    true,
+		},
+		// Try
+		{
+			name:             "try",
+			expressionString: "try a else missing",
+			context:          Context{"a": 1},
+			expected:         1.0,
+		},
+		{
+			name:             "try falls back",
+			expressionString: "try missing else a + 1",
+			context:          Context{"a": 1},
+			expected:         2.0,
+		},
+		{
+			name:             "try falls back on errors of operators",
+			expressionString: "try 'a' - 1 else 0",
+			expected:         0.0,
+		},
+		{
+			name:             "try does not fall back on null",
+			expressionString: "try i else 1",
+			context:          Context{"i": nil},
+			expected:         nil,
+		},
+		{
+			name:             "chained try",
+			expressionString: "try missing else try i + 1 else 'c'",
+			context:          Context{"i": nil},
+			expected:         "c",
+		},
+		{
+			name:             "try in brackets",
+			expressionString: "(try missing else 1) * 8",
+			expected:         8.0,
+		},
+		{
+			name:             "error in fallback",
+			expressionString: "try missing else also_missing",
+			expectedError:    true,
+		},
+		// Let
+		{
+			name:             "let",
+			expressionString: "let x = a / 100; x * (x + 1)",
+			context:          Context{"a": 200},
+			expected:         6.0,
+		},
+		{
+			name:             "let shadows variables",
+			expressionString: "let a = a + 1; a * 2",
+			context:          Context{"a": 1},
+			expected:         4.0,
+		},
+		{
+			name:             "nested lets",
+			expressionString: "let x = 2; let y = x * 3; (let x = y; x) + x",
+			expected:         8.0,
+		},
+		{
+			name:             "let binding is local",
+			expressionString: "(let x = 1; x) + x",
+			expectedError:    true,
+		},
+		{
+			name:             "let in function arguments",
+			expressionString: "to_int(let x = 2; x)",
+			expected:         1.0,
+		},
+		{
+			name:             "let binding is evaluated once",
+			expressionString: "let x = to_int(s); x + x",
+			context:          Context{"s": "1"},
+			expected:         2.0,
+		},
+		{
+			name:             "error in let binding",
+			expressionString: "let x = missing; 1",
+			expectedError:    true,
+		},
+	}
+	// Dummy function caller which returns 1 for any function name, except f, which returns a map.
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		if funcName == "f" {
+			return map[string]interface{}{"a": 1}, nil
+		}
+		return 1, nil
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			var got interface{}
+			if err == nil {
+				got, err = Eval(expression, test.context, caller)
+			}
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("%v: got `%v`, expected no error", test.name, err)
+			case test.expectedError && err == nil:
+				t.Errorf("%v: got no error, expected error", test.name)
+			case !cmp.Equal(test.expected, got) && err == nil:
+				t.Errorf("%v: got `%v`, expected `%v`", test.name, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestOperatorEvalInt(t *testing.T) {
+	// Ints are converted before operators are evaluated, so an int is a bug, which must not be fatal.
+	for _, o := range []Operator{OpAdd, OpMul, OpEq, OpBitwiseAnd} {
+		if got, err := o.eval(&evaluation{}, 1, 2.0); err == nil {
+			t.Errorf("%v.eval(1, 2.0) = %v, expected error", o, got)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		expressionString string
+		expectedArgs     []string
+	}{
+		{expressionString: "f()"},
+		{expressionString: "f(a)", expectedArgs: []string{"a"}},
+		{expressionString: "f(a,b , c)", expectedArgs: []string{"a", "b", "c"}},
+		// Without commas, these would be ambiguous.
+		{expressionString: "f(1 -2)", expectedArgs: []string{"1 - 2"}},
+		{expressionString: "f(a, (b))", expectedArgs: []string{"a", "(b)"}},
+		{expressionString: "f(g(a, b), c)", expectedArgs: []string{"g(a, b)", "c"}},
+		{expressionString: "f(a ? b : c, d)", expectedArgs: []string{"a ? b : c", "d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.expressionString, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			var got []string
+			for _, arg := range expression.value().Function.Args {
+				got = append(got, arg.String())
+			}
+			if !cmp.Equal(got, test.expectedArgs) {
+				t.Errorf("Parse(%q) got args %q, expected %q", test.expressionString, got, test.expectedArgs)
+			}
+		})
+	}
+}
+
+func TestEvalKeywordArgs(t *testing.T) {
+	expression, err := Parse("f(a, units='ms', format=to_str(b))")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	if got, expected := expression.String(), "f(a, units='ms', format=to_str(b))"; got != expected {
+		t.Errorf("String() = %q, expected %q", got, expected)
+	}
+	var got []interface{}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		if funcName == "f" {
+			got = append([]interface{}{}, args...) // The slice is reused once the call returns.
+		}
+		return args[0], nil
+	}
+	expected := []interface{}{1.0, KeywordArgs{"units": "ms", "format": "x"}}
+	if _, err := Eval(expression, Context{"a": 1, "b": "x"}, caller); err != nil || !cmp.Equal(got, expected) {
+		t.Errorf("Eval() called f with %v (error %v), expected %v", got, err, expected)
+	}
+	got = nil
+	if _, err := expression.Compile().Eval(Context{"a": 1, "b": "x"}, caller, Options{}); err != nil || !cmp.Equal(got, expected) {
+		t.Errorf("Compile().Eval() called f with %v (error %v), expected %v", got, err, expected)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	type key struct{}
+	tests := []struct {
+		name             string
+		expressionString string
+		cancelBefore     bool
+		cancelAfterCalls int // Cancels the context once f has been called this many times, if not zero.
+		expected         interface{}
+		expectedCalls    int
+		expectedError    bool
+	}{
+		{
+			name:             "not cancelled",
+			expressionString: "f(1) + f(2) + x",
+			expected:         6.0,
+			expectedCalls:    2,
+		},
+		{
+			name:             "cancelled before evaluation",
+			expressionString: "x",
+			cancelBefore:     true,
+			expectedError:    true,
+		},
+		{
+			name:             "cancelled between calls",
+			expressionString: "f(1) + f(2)",
+			cancelAfterCalls: 1,
+			expectedCalls:    1,
+			expectedError:    true,
+		},
+		{
+			name:             "cancellation is not caught by try",
+			expressionString: "try f(1) + f(2) else 0",
+			cancelAfterCalls: 1,
+			expectedCalls:    1,
+			expectedError:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "poll"))
+			defer cancel()
+			if test.cancelBefore {
+				cancel()
+			}
+			calls := 0
+			caller := func(ctx context.Context, funcName string, args ...interface{}) (interface{}, error) {
+				if ctx.Value(key{}) != "poll" {
+					return nil, errors.New("not called with the context of the evaluation")
+				}
+				if calls++; calls == test.cancelAfterCalls {
+					cancel()
+				}
+				return args[0], nil
+			}
+			got, err := EvalContext(ctx, expression, Context{"x": 3}, caller)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("EvalContext(%q) = %v, expected an error", test.expressionString, got)
+				}
+			} else if err != nil || got != test.expected {
+				t.Errorf("EvalContext(%q) = %v (error %v), expected %v", test.expressionString, got, err, test.expected)
+			}
+			if calls != test.expectedCalls {
+				t.Errorf("EvalContext(%q) made %d calls, expected %d", test.expressionString, calls, test.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestEvalNestedCalls(t *testing.T) {
+	// The arguments of nested calls share a stack, which must be unwound even if an argument fails.
+	expression, err := Parse("f(1, g(2, h(3)), try g(x, 4) else h(5), g(f(), h(6, k=7)))")
+	if err != nil {
+		t.Fatalf("Parse() got error: %v", err)
+	}
+	var got []string
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		got = append(got, fmt.Sprintf("%v%v", funcName, args))
+		return funcName, nil
+	}
+	expected := []string{
+		"h[3]", "g[2 h]", "h[5]", "f[]", "h[6 map[k:7]]", "g[f h]", "f[1 g h g]",
+	}
+	if _, err := Eval(expression, Context{}, caller); err != nil || !cmp.Equal(got, expected) {
+		t.Errorf("Eval() made calls %v (error %v), expected %v", got, err, expected)
+	}
+	got = nil
+	if _, err := expression.Compile().Eval(Context{}, caller, Options{}); err != nil || !cmp.Equal(got, expected) {
+		t.Errorf("Compile().Eval() made calls %v (error %v), expected %v", got, err, expected)
+	}
+}
+
+func TestEvalMissingVariable(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		context          Context
+		constants        Context
+		expectedError    string
+	}{
+		{
+			name:             "defined variables",
+			expressionString: "let x = 1; x + in_octest",
+			context:          Context{"out_octets": 2, "in_octets": 1},
+			constants:        Context{"KILO": 1000},
+			expectedError:    "no such variable in_octest (defined variables: KILO, in_octets, out_octets, x)",
+		},
+		{
+			name:             "no defined variables",
+			expressionString: "a",
+			expectedError:    "no such variable a (defined variables: none)",
+		},
+		{
+			name:             "bindings out of scope are not defined",
+			expressionString: "(let x = 1; x) + (let y = 2; z)",
+			expectedError:    "no such variable z (defined variables: y)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			_, err = EvalWithOptions(expression, test.context, nil, Options{Constants: test.constants})
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("EvalWithOptions(%q) got error `%v`, expected it to contain `%v`", test.expressionString, err, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestEvalWithResolver(t *testing.T) {
+	values := map[string]interface{}{"a": 1, "b": "x", "c": true, "m": map[string]int{"k": 2}}
+	tests := []struct {
+		name             string
+		expressionString string
+		expected         interface{}
+		expectedResolved []string
+		expectedError    bool
+	}{
+		{
+			name:             "variables are resolved once",
+			expressionString: "a + a * a",
+			expected:         2.0,
+			expectedResolved: []string{"a"},
+		},
+		{
+			name:             "branch not taken",
+			expressionString: "c ? a : failing",
+			expected:         1.0,
+			expectedResolved: []string{"c", "a"},
+		},
+		{
+			name:             "short-circuited operators",
+			expressionString: "c || failing ? b ?? failing : failing",
+			expected:         "x",
+			expectedResolved: []string{"c", "b"},
+		},
+		{
+			name:             "member",
+			expressionString: "m.k + m['k']",
+			expected:         4.0,
+			expectedResolved: []string{"m"},
+		},
+		{
+			name:             "resolution error",
+			expressionString: "a + failing",
+			expectedError:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			for _, compiled := range []bool{false, true} {
+				var resolved []string
+				resolver := func(name string) (interface{}, error) {
+					resolved = append(resolved, name)
+					value, ok := values[name]
+					if !ok {
+						return nil, fmt.Errorf("could not fetch %v", name)
+					}
+					return value, nil
+				}
+				var got interface{}
+				if compiled {
+					got, err = expression.Compile().EvalWithResolver(resolver, nil, Options{})
+				} else {
+					got, err = EvalWithResolver(expression, resolver, nil, Options{})
+				}
+				switch {
+				case !test.expectedError && err != nil:
+					t.Errorf("%v (compiled: %v): got `%v`, expected no error", test.name, compiled, err)
+				case test.expectedError && err == nil:
+					t.Errorf("%v (compiled: %v): got no error, expected error", test.name, compiled)
+				case err == nil && (!cmp.Equal(test.expected, got) || !cmp.Equal(test.expectedResolved, resolved)):
+					t.Errorf("%v (compiled: %v): got `%v`, resolving %v, expected `%v`, resolving %v", test.name, compiled, got, resolved, test.expected, test.expectedResolved)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		expectedVars     []string
+		expectedFuncs    []string
+	}{
+		{
+			name:             "no identifiers",
+			expressionString: "1 + 3 - 4",
+		},
+		{
+			name:             "one variable",
+			expressionString: "i",
+			expectedVars:     []string{"i"},
+		},
+		{
+			name:             "one func",
+			expressionString: "func()",
+			expectedFuncs:    []string{"func"},
+		},
+		{
+			name:             "one func, one var",
+			expressionString: "i + func()",
+			expectedFuncs:    []string{"func"},
+			expectedVars:     []string{"i"},
+		},
+		{
+			name:             "var in func",
+			expressionString: "func(i)",
+			expectedFuncs:    []string{"func"},
+			expectedVars:     []string{"i"},
+		},
+		{
+			name:             "arithmetic containing a var in a func",
+			expressionString: "func(i+1)",
+			expectedFuncs:    []string{"func"},
+			expectedVars:     []string{"i"},
+		},
+		{
+			name:             "namespaced func",
+			expressionString: "cisco.parse_envmon(s.t) + vendor.x.f()",
+			expectedFuncs:    []string{"cisco.parse_envmon", "vendor.x.f"},
+			expectedVars:     []string{"s"},
+		},
+		{
+			name:             "complex",
+			expressionString: "i + j + func(s, t) * myfunc(q + another(1+3))",
+			expectedFuncs:    []string{"func", "myfunc", "another"},
+			expectedVars:     []string{"i", "j", "s", "t", "q"},
+		},
+		{
+			name:             "logical operators",
+			expressionString: "!up && speed(i) > 0 || j == 'x'",
+			expectedFuncs:    []string{"speed"},
+			expectedVars:     []string{"up", "i", "j"},
+		},
+		{
+			name:             "conditional",
+			expressionString: "up ? f(i) : j",
+			expectedFuncs:    []string{"f"},
+			expectedVars:     []string{"up", "i", "j"},
+		},
+		{
+			name:             "bitwise operators",
+			expressionString: "a << 1 | f(b) & c ~ d >> 2",
+			expectedFuncs:    []string{"f"},
+			expectedVars:     []string{"a", "b", "c", "d"},
+		},
+		{
+			name:             "members",
+			expressionString: "row.a + row[key(k)]",
+			expectedFuncs:    []string{"key"},
+			expectedVars:     []string{"row", "row", "k"},
+		},
+		{
+			name:             "coalescing",
+			expressionString: "a ?? f(b) ?? null",
+			expectedFuncs:    []string{"f"},
+			expectedVars:     []string{"a", "b"},
+		},
+		{
+			name:             "start with a bracket",
+			expressionString: "(boot_time + to_int(last_change_relative)) * 1000",
+			expectedFuncs:    []string{"to_int"},
+			expectedVars:     []string{"boot_time", "last_change_relative"},
+		},
+		{
+			name:             "let",
+			expressionString: "let x = to_int(a); x + b + (let b = 1; b)",
+			expectedFuncs:    []string{"to_int"},
+			expectedVars:     []string{"a", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			gotVars, gotFuncs := expression.Identifiers()
+			switch {
+			case err != nil:
 				t.Errorf("Identifiers(%q) got error: %v", test.expressionString, err)
 			case !cmp.Equal(gotVars, test.expectedVars):
 				t.Errorf("Identifiers(%q) got vars: %v; expected: %v", test.expressionString, gotVars, test.expectedVars)
@@ -326,3 +1395,228 @@ func TestIdentifiers(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionalVariables(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		expected         []string
+	}{
+		{
+			name:             "no coalescing",
+			expressionString: "a + b",
+		},
+		{
+			name:             "coalescing",
+			expressionString: "hc_counter ?? counter",
+			expected:         []string{"hc_counter"},
+		},
+		{
+			name:             "chain",
+			expressionString: "a ?? b * c ?? d",
+			expected:         []string{"a", "b", "c"},
+		},
+		{
+			name:             "also required elsewhere",
+			expressionString: "(a ?? b) + a",
+		},
+		{
+			name:             "repeated",
+			expressionString: "(a ?? 0) + (a ?? b)",
+			expected:         []string{"a"},
+		},
+		{
+			name:             "nested in a function and a branch",
+			expressionString: "up ? f(a ?? 0) : (b.x ?? c)",
+			expected:         []string{"a", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			if got := expression.OptionalVariables(); !cmp.Equal(got, test.expected) {
+				t.Errorf("OptionalVariables(%q) got: %v; expected: %v", test.expressionString, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestRequiredVariables(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		expected         []string
+	}{
+		{
+			name:             "all required",
+			expressionString: "a + b * a",
+			expected:         []string{"a", "b"},
+		},
+		{
+			name:             "coalescing",
+			expressionString: "a ?? b",
+			expected:         []string{"b"},
+		},
+		{
+			name:             "try",
+			expressionString: "try to_int(vendor) else standard",
+			expected:         []string{"standard"},
+		},
+		{
+			name:             "also required elsewhere",
+			expressionString: "(try a else b) + a",
+			expected:         []string{"a", "b"},
+		},
+		{
+			name:             "nested",
+			expressionString: "up ? f(try a ?? b else c) : d",
+			expected:         []string{"up", "c", "d"},
+		},
+		{
+			name:             "let",
+			expressionString: "let x = a; try x + b else x",
+			expected:         []string{"a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			if got := expression.RequiredVariables(); !cmp.Equal(got, test.expected) {
+				t.Errorf("RequiredVariables(%q) got: %v; expected: %v", test.expressionString, got, test.expected)
+			}
+		})
+	}
+}
+
+// benchmarkExpressions are representative of the expressions in proto/transformations.pb.
+var benchmarkExpressions = []struct {
+	name       string
+	expression string
+}{
+	{name: "arithmetic", expression: "(boot_time + last_change_relative) * 1000"},
+	{name: "function", expression: "to_int(system_up_time_100) / 100"},
+	{name: "nested functions", expression: "time_since_epoch(system_time, 'ntp', 's') - to_int(up_time) / 100"},
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, bm := range benchmarkExpressions {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Parse(bm.expression); err != nil {
+					b.Fatalf("Parse(%q) got error: %v", bm.expression, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	ctx := Context{
+		"boot_time":            1545178344,
+		"last_change_relative": 50,
+		"system_up_time_100":   "2000000000",
+		"system_time":          "dfc4 0b68 8147 af78",
+		"up_time":              "2000000000",
+	}
+	// A trivial caller, so that only the cost of evaluation is measured.
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return 1.0, nil
+	}
+	for _, bm := range benchmarkExpressions {
+		expression, err := Parse(bm.expression)
+		if err != nil {
+			b.Fatalf("Parse(%q) got error: %v", bm.expression, err)
+		}
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Eval(expression, ctx, caller); err != nil {
+					b.Fatalf("Eval(%q) got error: %v", bm.expression, err)
+				}
+			}
+		})
+	}
+}
+
+/*
+subtreeExpressions are the expressions of the leaves of a subtree (here, the state and counters of an
+interface), which a poll of the subtree evaluates for every row of a table.
+*/
+var subtreeExpressions = []string{
+	"name + '/' + index",
+	"admin_status == 1",
+	"oper_status == 1 ? 'UP' : 'DOWN'",
+	"to_int(mtu)",
+	"high_speed * 1000000",
+	"last_change / 100",
+	"in_octets * 8",
+	"out_octets * 8",
+	"(in_ucast_pkts ?? 0) + (in_multicast_pkts ?? 0) + (in_broadcast_pkts ?? 0)",
+	"in_errors + in_discards",
+}
+
+// BenchmarkEvalSubtree measures a poll of a subtree of 64 rows, ie: the cost per row is 1/64 of it.
+func BenchmarkEvalSubtree(b *testing.B) {
+	var rows []Context
+	for i := 0; i < 64; i++ {
+		rows = append(rows, Context{
+			"name":              "GigabitEthernet0/0",
+			"index":             i,
+			"admin_status":      1,
+			"oper_status":       i % 2,
+			"mtu":               "1500",
+			"high_speed":        uint32(10000),
+			"last_change":       uint32(123456 + i),
+			"in_octets":         uint64(1234567890 + i),
+			"out_octets":        uint64(987654321 + i),
+			"in_ucast_pkts":     uint64(1000000 + i),
+			"in_multicast_pkts": uint64(1000 + i),
+			"in_broadcast_pkts": nil,
+			"in_errors":         uint32(i),
+			"in_discards":       uint32(2 * i),
+		})
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return 1500, nil
+	}
+	var expressions []*Expression
+	var programs []*Program
+	for _, s := range subtreeExpressions {
+		expression, err := Parse(s)
+		if err != nil {
+			b.Fatalf("Parse(%q) got error: %v", s, err)
+		}
+		expressions, programs = append(expressions, expression), append(programs, expression.Compile())
+	}
+	b.Run("interpreted", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, ctx := range rows {
+				for _, expression := range expressions {
+					if _, err := Eval(expression, ctx, caller); err != nil {
+						b.Fatalf("Eval(%q) got error: %v", expression, err)
+					}
+				}
+			}
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, ctx := range rows {
+				for _, program := range programs {
+					if _, err := program.Eval(ctx, caller, Options{}); err != nil {
+						b.Fatalf("Compile(%q).Eval got error: %v", program, err)
+					}
+				}
+			}
+		}
+	})
+}
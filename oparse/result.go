@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Kind is the type of the result of an expression.
+type Kind int
+
+const (
+	// NullKind is the kind of null.
+	NullKind Kind = iota
+
+	// FloatKind is the kind of a float64.
+	FloatKind
+
+	// IntKind is the kind of an int64, eg: an integer in IntegerArithmetic.
+	IntKind
+
+	// UintKind is the kind of a uint64, ie: an integer too large for an int64.
+	UintKind
+
+	// StringKind is the kind of a string.
+	StringKind
+
+	// BoolKind is the kind of a bool.
+	BoolKind
+
+	// MapKind is the kind of a map, eg: a table row.
+	MapKind
+
+	/*
+		AnyKind stands for any kind when the kind is not known before evaluation, eg: of a variable. It is
+		only used by Validate, and by signatures of functions which accept or return any kind.
+	*/
+	AnyKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NullKind:
+		return "null"
+	case FloatKind:
+		return "float"
+	case IntKind:
+		return "int"
+	case UintKind:
+		return "uint"
+	case StringKind:
+		return "string"
+	case BoolKind:
+		return "bool"
+	case MapKind:
+		return "map"
+	case AnyKind:
+		return "any"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+/*
+Result is the result of an expression together with its kind, so that callers can tell integers from
+floats (eg: to produce correctly typed OpenConfig leaves) without type assertions. It is not named
+Value, as Value is the node of the grammar AST.
+*/
+type Result struct {
+	kind  Kind
+	value interface{}
+}
+
+/*
+NewResult returns the result for a value produced by evaluating an expression (see Eval). An error is
+returned if the value is not of a supported kind, eg: a function returned a slice.
+*/
+func NewResult(value interface{}) (Result, error) {
+	switch v := value.(type) {
+	case nil:
+		return Result{kind: NullKind}, nil
+	case float64:
+		return Result{kind: FloatKind, value: v}, nil
+	case int:
+		return Result{kind: IntKind, value: int64(v)}, nil
+	case int64:
+		return Result{kind: IntKind, value: v}, nil
+	case uint64:
+		return Result{kind: UintKind, value: v}, nil
+	case string:
+		return Result{kind: StringKind, value: v}, nil
+	case bool:
+		return Result{kind: BoolKind, value: v}, nil
+	}
+	if reflect.TypeOf(value).Kind() == reflect.Map {
+		return Result{kind: MapKind, value: value}, nil
+	}
+	return Result{}, fmt.Errorf("unsupported result type %T", value)
+}
+
+// EvalResult is like EvalWithOptions, but returns the result with its kind.
+func EvalResult(expression *Expression, ctx Context, caller FunctionCaller, options Options) (Result, error) {
+	value, err := EvalWithOptions(expression, ctx, caller, options)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := NewResult(value)
+	if err != nil {
+		return Result{}, fmt.Errorf("could not evaluate expression `%v`: %v", expression, err)
+	}
+	return result, nil
+}
+
+// Kind returns the kind of the result.
+func (r Result) Kind() Kind {
+	return r.kind
+}
+
+// Interface returns the result as a float64, int64, uint64, string, bool or map, or nil if it is null.
+func (r Result) Interface() interface{} {
+	return r.value
+}
+
+// IsNull returns true if the result is null.
+func (r Result) IsNull() bool {
+	return r.kind == NullKind
+}
+
+// Float returns a numeric result as a float64, or false if it is not numeric.
+func (r Result) Float() (float64, bool) {
+	return toFloat(r.value)
+}
+
+// Int returns an integer result as an int64, or false if it is not an integer or does not fit.
+func (r Result) Int() (int64, bool) {
+	switch v := r.value.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+// Uint returns an integer result as a uint64, or false if it is not a non-negative integer.
+func (r Result) Uint() (uint64, bool) {
+	switch v := r.value.(type) {
+	case int64:
+		if v >= 0 {
+			return uint64(v), true
+		}
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Bool returns a boolean result, or false if it is not a boolean.
+func (r Result) Bool() (value bool, ok bool) {
+	value, ok = r.value.(bool)
+	return value, ok
+}
+
+// String returns a string result as is, and any other result formatted as text (eg: "<null>").
+func (r Result) String() string {
+	switch v := r.value.(type) {
+	case nil:
+		return "<null>"
+	case string:
+		return v
+	}
+	return fmt.Sprint(r.value)
+}
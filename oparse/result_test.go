@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvalResult(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		context          Context
+		arithmetic       Arithmetic
+		expectedKind     Kind
+		expectedString   string
+		expectedError    bool
+	}{
+		{
+			name:             "float",
+			expressionString: "7 / 2",
+			expectedKind:     FloatKind,
+			expectedString:   "3.5",
+		},
+		{
+			name:             "integers are floats by default",
+			expressionString: "1 + 2",
+			expectedKind:     FloatKind,
+			expectedString:   "3",
+		},
+		{
+			name:             "int",
+			expressionString: "1 - 2",
+			arithmetic:       IntegerArithmetic,
+			expectedKind:     IntKind,
+			expectedString:   "-1",
+		},
+		{
+			name:             "uint",
+			expressionString: "a + 1",
+			context:          Context{"a": uint64(math.MaxUint64 - 1)},
+			arithmetic:       IntegerArithmetic,
+			expectedKind:     UintKind,
+			expectedString:   "18446744073709551615",
+		},
+		{
+			name:             "string",
+			expressionString: "'a' + 'b'",
+			expectedKind:     StringKind,
+			expectedString:   "ab",
+		},
+		{
+			name:             "bool",
+			expressionString: "1 < 2",
+			expectedKind:     BoolKind,
+			expectedString:   "true",
+		},
+		{
+			name:             "null",
+			expressionString: "null",
+			expectedKind:     NullKind,
+			expectedString:   "<null>",
+		},
+		{
+			name:             "map",
+			expressionString: "row",
+			context:          Context{"row": map[string]int{"a": 1}},
+			expectedKind:     MapKind,
+			expectedString:   "map[a:1]",
+		},
+		{
+			name:             "unsupported function result",
+			expressionString: "f()",
+			expectedError:    true,
+		},
+		{
+			name:             "evaluation error",
+			expressionString: "missing",
+			expectedError:    true,
+		},
+	}
+	caller := func(funcName string, args ...interface{}) (interface{}, error) {
+		return []byte("a"), nil
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			var got Result
+			if err == nil {
+				got, err = EvalResult(expression, test.context, caller, Options{Arithmetic: test.arithmetic})
+			}
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("%v: got `%v`, expected no error", test.name, err)
+			case test.expectedError && err == nil:
+				t.Errorf("%v: got no error, expected error", test.name)
+			case err == nil && (got.Kind() != test.expectedKind || got.String() != test.expectedString):
+				t.Errorf("%v: got %v `%v`, expected %v `%v`", test.name, got.Kind(), got, test.expectedKind, test.expectedString)
+			}
+		})
+	}
+}
+
+func TestResultAccessors(t *testing.T) {
+	tests := []struct {
+		value         interface{}
+		expectedFloat interface{} // nil if not a float.
+		expectedInt   interface{}
+		expectedUint  interface{}
+		expectedBool  interface{}
+	}{
+		{value: 1.5, expectedFloat: 1.5},
+		{value: int64(-1), expectedFloat: -1.0, expectedInt: int64(-1)},
+		{value: 2, expectedFloat: 2.0, expectedInt: int64(2), expectedUint: uint64(2)},
+		{value: uint64(math.MaxUint64), expectedFloat: float64(math.MaxUint64), expectedUint: uint64(math.MaxUint64)},
+		{value: true, expectedBool: true},
+		{value: "1"},
+		{value: nil},
+	}
+	for _, test := range tests {
+		result, err := NewResult(test.value)
+		if err != nil {
+			t.Fatalf("NewResult(%v) got error: %v", test.value, err)
+		}
+		for _, accessor := range []struct {
+			name     string
+			expected interface{}
+			get      func() (interface{}, bool)
+		}{
+			{"Float", test.expectedFloat, func() (interface{}, bool) { return result.Float() }},
+			{"Int", test.expectedInt, func() (interface{}, bool) { return result.Int() }},
+			{"Uint", test.expectedUint, func() (interface{}, bool) { return result.Uint() }},
+			{"Bool", test.expectedBool, func() (interface{}, bool) { return result.Bool() }},
+		} {
+			got, ok := accessor.get()
+			switch {
+			case ok != (accessor.expected != nil):
+				t.Errorf("%v(%v) got ok %v", accessor.name, test.value, ok)
+			case ok && got != accessor.expected:
+				t.Errorf("%v(%v) = %v (%T), expected %v (%T)", accessor.name, test.value, got, got, accessor.expected, accessor.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "fmt"
+
+// Functions for rewriting parsed expressions, eg: to rename variables across many transformations.
+
+// walk calls visit for every value within a node, visiting the values within a value first.
+func walk(node Node, visit func(v *Value)) {
+	var ancestors []Node // The nodes being visited, innermost last.
+	Inspect(node, func(n Node) bool {
+		if n != nil {
+			ancestors = append(ancestors, n)
+			return true
+		}
+		// The children of the innermost node have been visited.
+		if v, ok := ancestors[len(ancestors)-1].(*Value); ok {
+			visit(v)
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+		return true
+	})
+}
+
+// expressions calls visit for every expression within a node, including the node itself.
+func expressions(node Node, visit func(e *Expression)) {
+	Inspect(node, func(n Node) bool {
+		if e, ok := n.(*Expression); ok {
+			visit(e)
+		}
+		return true
+	})
+}
+
+/*
+references calls visit for every value which references a variable, other than references to the
+bindings of lets (eg: x in `let x = a; x + 1`).
+*/
+func (e *Expression) references(visit func(v *Value)) {
+	bound := e.bound()
+	walk(e, func(v *Value) {
+		if v.Variable != nil && !bound[v] {
+			visit(v)
+		}
+	})
+}
+
+// bound returns the values which reference the bindings of lets, rather than variables.
+func (e *Expression) bound() map[*Value]bool {
+	bound := map[*Value]bool{}
+	walk(e, func(v *Value) {
+		if v.Let == nil {
+			return
+		}
+		// Within the body, the name refers to this binding or to an inner binding of the same name.
+		walk(v.Let.Body, func(r *Value) {
+			if r.Variable != nil && *r.Variable == v.Let.Name {
+				bound[r] = true
+			}
+		})
+	})
+	return bound
+}
+
+/*
+RenameVariable renames every reference to a variable, returning the number of references renamed.
+Nothing is renamed if a let binding the new name would capture a reference (see Captures).
+*/
+func (e *Expression) RenameVariable(from, to string) int {
+	if e.Captures(from, to) {
+		return 0
+	}
+	renamed := 0
+	e.references(func(v *Value) {
+		if *v.Variable == from {
+			name := to
+			v.Variable = &name
+			renamed++
+		}
+	})
+	return renamed
+}
+
+/*
+Captures reports whether renaming a variable would change what a reference to it refers to, because the
+reference is within the body of a let binding the new name, eg: renaming a to y in `let y = 2; a + y`.
+*/
+func (e *Expression) Captures(from, to string) bool {
+	bound := e.bound()
+	captured := false
+	walk(e, func(v *Value) {
+		if v.Let == nil || v.Let.Name != to {
+			return
+		}
+		walk(v.Let.Body, func(r *Value) {
+			if r.Variable != nil && *r.Variable == from && !bound[r] {
+				captured = true
+			}
+		})
+	})
+	return captured
+}
+
+// RenameFunction renames every call to a function, returning the number of calls renamed.
+func (e *Expression) RenameFunction(from, to string) int {
+	renamed := 0
+	walk(e, func(v *Value) {
+		if v.Function != nil && v.Function.Name == from {
+			v.Function.Name = to
+			renamed++
+		}
+	})
+	return renamed
+}
+
+/*
+WrapVariable replaces every reference to a variable with a call to the given function with the
+variable as its argument (eg: `x` becomes `to_int(x)`), returning the number of references wrapped.
+Members of the variable are accessed on the result of the call, eg: `row.name` becomes `to_int(row).name`.
+*/
+func (e *Expression) WrapVariable(variable, function string) int {
+	wrapped := 0
+	e.references(func(v *Value) {
+		if *v.Variable == variable {
+			arg := &Value{Variable: v.Variable}
+			*v = Value{Function: call(function, valueExpression(arg)), Members: v.Members}
+			wrapped++
+		}
+	})
+	return wrapped
+}
+
+// Wrap returns an expression calling the given function with this expression as its argument.
+func (e *Expression) Wrap(function string) *Expression {
+	return valueExpression(&Value{Function: call(function, e)})
+}
+
+// valueExpression returns an expression consisting of a single value.
+func valueExpression(v *Value) *Expression {
+	sum := &Sum{Left: &Term{Left: &Factor{Base: v}}}
+	bitOr := &BitOr{Left: &BitXor{Left: &BitAnd{Left: &Shift{Left: sum}}}}
+	return &Expression{Left: &Disjunction{Left: &Conjunction{Left: &Comparison{Left: bitOr}}}}
+}
+
+func call(function string, arg *Expression) *Function {
+	return &Function{Name: function, Open: "(", Args: []*Arg{{Value: *arg}}, Close: ")"}
+}
+
+/*
+Rewrite parses an expression, applies a rewrite to it (which returns the number of changes it made,
+eg: see RenameVariable) and returns the rewritten expression. The input is returned unchanged, rather
+than reformatted, if the rewrite made no changes.
+*/
+func Rewrite(input string, rewrite func(e *Expression) int) (string, int, error) {
+	expression, err := Parse(input)
+	if err != nil {
+		return "", 0, err
+	}
+	changes := rewrite(expression)
+	if changes == 0 {
+		return input, 0, nil
+	}
+	output := expression.String()
+	if _, err := Parse(output); err != nil {
+		return "", 0, fmt.Errorf("rewrite of %q produced invalid expression %q: %v", input, output, err)
+	}
+	return output, changes, nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		input           string
+		rewrite         func(e *Expression) int
+		expected        string
+		expectedChanges int
+		expectsError    bool
+	}{
+		{
+			name:            "rename variable",
+			input:           "time_since_epoch(up_time, 'ntp', 's') - up_time ^ up_time",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("up_time", "system_up_time") },
+			expected:        "time_since_epoch(system_up_time, 'ntp', 's') - system_up_time ^ system_up_time",
+			expectedChanges: 3,
+		},
+		{
+			name:            "rename variable in subexpression",
+			input:           "(boot_time + last_change) * 1000000",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("boot_time", "boot") },
+			expected:        "(boot + last_change) * 1000000",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename variable in logical expression",
+			input:           "!up && speed>=1000||admin_up",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("up", "oper_up") },
+			expected:        "!oper_up && speed >= 1000 || admin_up",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename variable in conditional",
+			input:           "hc?high_speed:speed*1000000",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("speed", "if_speed") },
+			expected:        "hc ? high_speed : if_speed * 1000000",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename negated variable",
+			input:           "-offset*2",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("offset", "utc_offset") },
+			expected:        "-utc_offset * 2",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename keeps literals as written",
+			input:           "f(0x1F, 1e6, 1_000)",
+			rewrite:         func(e *Expression) int { return e.RenameFunction("f", "g") },
+			expected:        "g(0x1F, 1e6, 1_000)",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename variable in bitwise expression",
+			input:           "(flags&0x3)<<4|mode",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("flags", "status") },
+			expected:        "(status & 0x3) << 4 | mode",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename variable with members",
+			input:           "row.row + row[row.key]",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("row", "if_row") },
+			expected:        "if_row.row + if_row[if_row.key]",
+			expectedChanges: 3,
+		},
+		{
+			name:            "rename variable in coalescing expression",
+			input:           "hc_counter??counter??null",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("counter", "if_counter") },
+			expected:        "hc_counter ?? if_counter ?? null",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename function",
+			input:           "to_int(to_int(a) + b)",
+			rewrite:         func(e *Expression) int { return e.RenameFunction("to_int", "int") },
+			expected:        "int(int(a) + b)",
+			expectedChanges: 2,
+		},
+		{
+			name:            "rename does not touch functions of the same name",
+			input:           "to_int(to_int)",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("to_int", "x") },
+			expected:        "to_int(x)",
+			expectedChanges: 1,
+		},
+		{
+			name:            "rename does not touch let bindings",
+			input:           "let a = a + 1; a + (let b = a; b)",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("a", "x") },
+			expected:        "let a = x + 1; a + (let b = a; b)",
+			expectedChanges: 1,
+		},
+		{
+			name:     "rename captured by a let binding the new name is not applied",
+			input:    "let y = 2; a + y",
+			rewrite:  func(e *Expression) int { return e.RenameVariable("a", "y") },
+			expected: "let y = 2; a + y",
+		},
+		{
+			name:            "rename outside the body of a let binding the new name",
+			input:           "(let y = a; y) + a",
+			rewrite:         func(e *Expression) int { return e.RenameVariable("a", "y") },
+			expected:        "(let y = y; y) + y",
+			expectedChanges: 2,
+		},
+		{
+			name:            "wrap variable in let binding",
+			input:           "let x = b; x + b",
+			rewrite:         func(e *Expression) int { return e.WrapVariable("b", "to_int") },
+			expected:        "let x = to_int(b); x + to_int(b)",
+			expectedChanges: 2,
+		},
+		{
+			name:            "wrap variable",
+			input:           "a * 100 + f(a)",
+			rewrite:         func(e *Expression) int { return e.WrapVariable("a", "to_int") },
+			expected:        "to_int(a) * 100 + f(to_int(a))",
+			expectedChanges: 2,
+		},
+		{
+			name:            "wrap variable keeps members accessed by name",
+			input:           "row.name + 1",
+			rewrite:         func(e *Expression) int { return e.WrapVariable("row", "to_int") },
+			expected:        "to_int(row).name + 1",
+			expectedChanges: 1,
+		},
+		{
+			name:            "wrap variable keeps members accessed by key",
+			input:           "row['a'] + row[b]",
+			rewrite:         func(e *Expression) int { return e.WrapVariable("row", "to_int") },
+			expected:        "to_int(row)['a'] + to_int(row)[b]",
+			expectedChanges: 2,
+		},
+		{
+			name:  "wrap expression",
+			input: "a + 'b'",
+			rewrite: func(e *Expression) int {
+				*e = *e.Wrap("to_str")
+				return 1
+			},
+			expected:        "to_str(a + 'b')",
+			expectedChanges: 1,
+		},
+		{
+			name:     "unchanged expression keeps its formatting",
+			input:    "a+b",
+			rewrite:  func(e *Expression) int { return e.RenameVariable("c", "d") },
+			expected: "a+b",
+		},
+		{
+			name:         "invalid expression",
+			input:        "a +",
+			rewrite:      func(e *Expression) int { return e.RenameVariable("a", "b") },
+			expectsError: true,
+		},
+		{
+			name:         "invalid new name",
+			input:        "a",
+			rewrite:      func(e *Expression) int { return e.RenameVariable("a", "not valid") },
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, changes, err := Rewrite(test.input, test.rewrite)
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("Rewrite(%q) = %q, expected error", test.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rewrite(%q) got error: %v", test.input, err)
+			}
+			if got != test.expected || changes != test.expectedChanges {
+				t.Errorf("Rewrite(%q) = %q, %d, expected %q, %d", test.input, got, changes, test.expected, test.expectedChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "fmt"
+
+// Signature describes the kinds of the arguments and result of a function, for Validate.
+type Signature struct {
+	Args   []Kind
+	Result Kind
+	// Names are the names of the arguments, if the function takes keyword arguments (see KeywordArgs).
+	Names []string
+	// Optional is the number of trailing arguments which calls may omit, as they have default values.
+	Optional int
+}
+
+/*
+Validate checks an expression for errors which would occur whatever the values of its variables, eg:
+calls of undefined functions, calls with the wrong number or kinds of arguments, and operators
+applied to operands of the wrong kinds (eg: `'a' - 1`). The expression is not evaluated. The kinds
+of variables are not known, so they are assumed to be valid.
+*/
+func Validate(expression *Expression, signatures map[string]Signature) error {
+	_, err := Infer(expression, nil, signatures)
+	return err
+}
+
+/*
+Infer is a dry run of an expression: it infers the kind of its result from the kinds of its variables,
+rather than from their values, eg: to check mappings before any data is collected. Like Validate, it
+returns an error for any operator or function applied to operands of the wrong kinds, which here
+include those which only the kinds of the variables rule out (eg: `x - 1`, if x is a string).
+Variables whose kinds are not given may be of any kind. Numeric variables, literals and the results
+of arithmetic are floats, as in FloatArithmetic.
+*/
+func Infer(expression *Expression, kinds map[string]Kind, signatures map[string]Signature) (Kind, error) {
+	kind, err := checker{signatures: signatures, kinds: kinds}.expression(expression)
+	if err != nil {
+		return kind, fmt.Errorf("invalid expression `%v`: %v", expression, err)
+	}
+	return kind, nil
+}
+
+// checker infers the kinds of the nodes of an expression, returning an error if they are invalid.
+type checker struct {
+	signatures map[string]Signature
+	kinds      map[string]Kind // The kinds of variables. Others may be of any kind.
+	bindings   *binding        // The innermost binding of a let, if any, to the kind of its value.
+}
+
+func (c checker) expression(e *Expression) (Kind, error) {
+	if e.Left == nil { // Can be nil if the expression is empty (ie: "").
+		return NullKind, nil
+	}
+	kind, err := c.disjunction(e.Left)
+	if err != nil {
+		return kind, err
+	}
+	for _, r := range e.Right {
+		rKind, err := c.disjunction(r.Disjunction)
+		if err != nil {
+			return rKind, err
+		}
+		if kind == NullKind {
+			kind = rKind // The right operand is always the result.
+		} else {
+			kind = join(kind, rKind)
+		}
+	}
+	if e.Then == nil {
+		return kind, nil
+	}
+	if err := logical(kind, "?"); err != nil {
+		return kind, err
+	}
+	thenKind, err := c.expression(e.Then)
+	if err != nil {
+		return thenKind, err
+	}
+	elseKind, err := c.expression(e.Else)
+	return join(thenKind, elseKind), err
+}
+
+func (c checker) disjunction(d *Disjunction) (Kind, error) {
+	kind, err := c.conjunction(d.Left)
+	if err != nil || len(d.Right) == 0 {
+		return kind, err
+	}
+	if err := logical(kind, "||"); err != nil {
+		return kind, err
+	}
+	for _, r := range d.Right {
+		if kind, err = c.conjunction(r.Conjunction); err != nil {
+			return kind, err
+		}
+		if err := logical(kind, "||"); err != nil {
+			return kind, err
+		}
+	}
+	return BoolKind, nil
+}
+
+func (c checker) conjunction(conjunction *Conjunction) (Kind, error) {
+	kind, err := c.comparison(conjunction.Left)
+	if err != nil || len(conjunction.Right) == 0 {
+		return kind, err
+	}
+	if err := logical(kind, "&&"); err != nil {
+		return kind, err
+	}
+	for _, r := range conjunction.Right {
+		if kind, err = c.comparison(r.Comparison); err != nil {
+			return kind, err
+		}
+		if err := logical(kind, "&&"); err != nil {
+			return kind, err
+		}
+	}
+	return BoolKind, nil
+}
+
+func (c checker) comparison(comparison *Comparison) (Kind, error) {
+	l, err := c.bitOr(comparison.Left)
+	if err != nil || comparison.Right == nil {
+		return l, err
+	}
+	r, err := c.bitOr(comparison.Right.BitOr)
+	if err != nil {
+		return r, err
+	}
+	return binary(comparison.Right.Operator, l, r)
+}
+
+func (c checker) bitOr(b *BitOr) (Kind, error) {
+	kind, err := c.bitXor(b.Left)
+	for _, r := range b.Right {
+		if err != nil {
+			break
+		}
+		var rKind Kind
+		if rKind, err = c.bitXor(r.BitXor); err == nil {
+			kind, err = binary(r.Operator, kind, rKind)
+		}
+	}
+	return kind, err
+}
+
+func (c checker) bitXor(b *BitXor) (Kind, error) {
+	kind, err := c.bitAnd(b.Left)
+	for _, r := range b.Right {
+		if err != nil {
+			break
+		}
+		var rKind Kind
+		if rKind, err = c.bitAnd(r.BitAnd); err == nil {
+			kind, err = binary(r.Operator, kind, rKind)
+		}
+	}
+	return kind, err
+}
+
+func (c checker) bitAnd(b *BitAnd) (Kind, error) {
+	kind, err := c.shift(b.Left)
+	for _, r := range b.Right {
+		if err != nil {
+			break
+		}
+		var rKind Kind
+		if rKind, err = c.shift(r.Shift); err == nil {
+			kind, err = binary(r.Operator, kind, rKind)
+		}
+	}
+	return kind, err
+}
+
+func (c checker) shift(s *Shift) (Kind, error) {
+	kind, err := c.sum(s.Left)
+	for _, r := range s.Right {
+		if err != nil {
+			break
+		}
+		var rKind Kind
+		if rKind, err = c.sum(r.Sum); err == nil {
+			kind, err = binary(r.Operator, kind, rKind)
+		}
+	}
+	return kind, err
+}
+
+func (c checker) sum(s *Sum) (Kind, error) {
+	kind, err := c.term(s.Left)
+	for _, r := range s.Right {
+		if err != nil {
+			break
+		}
+		var rKind Kind
+		if rKind, err = c.term(r.Term); err == nil {
+			kind, err = binary(r.Operator, kind, rKind)
+		}
+	}
+	return kind, err
+}
+
+func (c checker) term(t *Term) (Kind, error) {
+	kind, err := c.factor(t.Left)
+	for _, r := range t.Right {
+		if err != nil {
+			break
+		}
+		var rKind Kind
+		if rKind, err = c.factor(r.Factor); err == nil {
+			kind, err = binary(r.Operator, kind, rKind)
+		}
+	}
+	return kind, err
+}
+
+func (c checker) factor(f *Factor) (Kind, error) {
+	kind, err := c.value(f.Base)
+	if err != nil {
+		return kind, err
+	}
+	if f.Exponent != nil {
+		exponent, err := c.value(f.Exponent)
+		if err != nil {
+			return exponent, err
+		}
+		if !isNumeric(kind) || !isNumeric(exponent) {
+			return kind, fmt.Errorf("cannot raise %v to the power of %v", kind, exponent)
+		}
+		kind = FloatKind
+	}
+	if f.Negated && !isNumeric(kind) {
+		return kind, fmt.Errorf("cannot negate %v", kind)
+	}
+	return kind, nil
+}
+
+func (c checker) value(v *Value) (Kind, error) {
+	kind, err := c.operand(v)
+	for _, m := range v.Members {
+		if err != nil {
+			break
+		}
+		if kind != MapKind && kind != AnyKind && kind != NullKind {
+			return kind, fmt.Errorf("cannot get member %v of %v", m, kind)
+		}
+		if m.Key != nil {
+			var key Kind
+			if key, err = c.expression(m.Key); err == nil && key != StringKind && key != AnyKind {
+				err = fmt.Errorf("key %v of a map must be a string, got %v", m.Key, key)
+			}
+		}
+		kind = AnyKind
+	}
+	return kind, err
+}
+
+// operand infers the kind of a value without any member accesses.
+func (c checker) operand(v *Value) (Kind, error) {
+	switch {
+	case v.Number != nil:
+		return FloatKind, nil
+	case v.StrLiteral != nil:
+		return StringKind, nil
+	case v.Boolean != nil:
+		return BoolKind, nil
+	case v.Null:
+		return NullKind, nil
+	case v.Variable != nil:
+		return c.variable(*v.Variable), nil
+	case v.Not != nil:
+		kind, err := c.value(v.Not)
+		if err != nil {
+			return kind, err
+		}
+		return BoolKind, logical(kind, "!")
+	case v.Try != nil:
+		// The body is checked too, as errors which occur whatever the values of variables leave only the fallback.
+		body, err := c.expression(v.Try.Body)
+		if err != nil {
+			return body, err
+		}
+		fallback, err := c.expression(v.Try.Fallback)
+		return join(body, fallback), err
+	case v.Let != nil:
+		kind, err := c.expression(v.Let.Value)
+		if err != nil {
+			return kind, err
+		}
+		body := c
+		body.bindings = &binding{name: v.Let.Name, value: kind, parent: c.bindings}
+		return body.expression(v.Let.Body)
+	case v.Function != nil:
+		return c.function(v.Function)
+	case v.Subexpression != nil:
+		return c.expression(v.Subexpression)
+	}
+	return NullKind, nil
+}
+
+// variable returns the kind of the value bound to a name by a let, or else of the variable.
+func (c checker) variable(name string) Kind {
+	for b := c.bindings; b != nil; b = b.parent {
+		if b.name == name {
+			return b.value.(Kind)
+		}
+	}
+	kind, ok := c.kinds[name]
+	switch {
+	case !ok:
+		return AnyKind
+	case kind == IntKind || kind == UintKind:
+		return FloatKind // Integers from variables are converted to floats, as in FloatArithmetic.
+	}
+	return kind
+}
+
+func (c checker) function(f *Function) (Kind, error) {
+	signature, ok := c.signatures[f.Name]
+	if !ok {
+		return AnyKind, fmt.Errorf("function %q is not defined", f.Name)
+	}
+	required := len(signature.Args) - signature.Optional
+	switch {
+	case signature.Optional > 0 && (len(f.Args) < required || len(f.Args) > len(signature.Args)):
+		return AnyKind, fmt.Errorf("function %q expects %v to %v arguments, but got %v", f.Name, required, len(signature.Args), len(f.Args))
+	case signature.Optional == 0 && len(f.Args) != len(signature.Args):
+		return AnyKind, fmt.Errorf("function %q expects %v arguments, but got %v", f.Name, len(signature.Args), len(f.Args))
+	}
+	given := map[int]bool{}
+	for i, arg := range f.Args {
+		kind, err := c.expression(&arg.Value)
+		if err != nil {
+			return kind, err
+		}
+		if arg.Name != "" {
+			if i, err = signature.index(f.Name, arg.Name); err != nil {
+				return AnyKind, err
+			}
+		}
+		if given[i] {
+			return AnyKind, fmt.Errorf("argument %v of function %q is given twice", i+1, f.Name)
+		}
+		given[i] = true
+		if !assignable(kind, signature.Args[i]) {
+			return kind, fmt.Errorf("argument %v of function %q must be %v, but got %v", i+1, f.Name, signature.Args[i], kind)
+		}
+	}
+	for i := 0; i < required; i++ {
+		if !given[i] {
+			return AnyKind, fmt.Errorf("argument %v of function %q is missing", i+1, f.Name)
+		}
+	}
+	return signature.Result, nil
+}
+
+// index returns the position of the argument with the given name.
+func (s Signature) index(funcName, name string) (int, error) {
+	if len(s.Names) == 0 {
+		return 0, fmt.Errorf("function %q does not take keyword arguments", funcName)
+	}
+	for i, n := range s.Names {
+		if n == name && i < len(s.Args) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("function %q has no argument %q", funcName, name)
+}
+
+// binary infers the kind of the result of a binary operator, mirroring Operator.eval.
+func binary(o Operator, l, r Kind) (Kind, error) {
+	switch o {
+	case OpEq, OpNe:
+		if l == AnyKind || r == AnyKind || l == NullKind || r == NullKind || l == r || isNumeric(l) && isNumeric(r) {
+			return BoolKind, nil
+		}
+	case OpLt, OpLe, OpGt, OpGe:
+		if (l == StringKind || l == AnyKind) && (r == StringKind || r == AnyKind) || isNumeric(l) && isNumeric(r) {
+			return BoolKind, nil
+		}
+	case OpAdd:
+		switch {
+		case l == NullKind || r == NullKind:
+		case l == StringKind || r == StringKind:
+			return StringKind, nil // Concatenation.
+		case l == AnyKind || r == AnyKind:
+			return AnyKind, nil // Either arithmetic or concatenation.
+		case isNumeric(l) && isNumeric(r):
+			return FloatKind, nil
+		}
+	default:
+		if isNumeric(l) && isNumeric(r) {
+			return FloatKind, nil
+		}
+	}
+	return AnyKind, fmt.Errorf("cannot apply %v to %v and %v", o, l, r)
+}
+
+// logical returns an error if a value of the given kind cannot be an operand of a logical operator.
+func logical(kind Kind, operator string) error {
+	if kind != BoolKind && kind != AnyKind {
+		return fmt.Errorf("operand of %v must be a boolean, got %v", operator, kind)
+	}
+	return nil
+}
+
+// isNumeric returns true if values of the kind may be numbers.
+func isNumeric(kind Kind) bool {
+	switch kind {
+	case FloatKind, IntKind, UintKind, AnyKind:
+		return true
+	}
+	return false
+}
+
+// assignable returns true if a value of the given kind may be passed where the other is expected.
+func assignable(kind, to Kind) bool {
+	return kind == to || kind == AnyKind || to == AnyKind || isNumeric(kind) && isNumeric(to)
+}
+
+// join returns the kind of a value which is of one of the given kinds.
+func join(a, b Kind) Kind {
+	switch {
+	case a == b:
+		return a
+	case a != AnyKind && b != AnyKind && isNumeric(a) && isNumeric(b):
+		return FloatKind
+	}
+	return AnyKind
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	signatures := map[string]Signature{
+		"to_int":           {Args: []Kind{AnyKind}, Result: IntKind},
+		"to_str":           {Args: []Kind{AnyKind}, Result: StringKind},
+		"time_since_epoch": {Args: []Kind{AnyKind, StringKind, StringKind}, Result: IntKind},
+		"row":              {Result: MapKind},
+		"anything":         {Result: AnyKind},
+		"format":           {Args: []Kind{AnyKind, StringKind}, Result: StringKind, Names: []string{"value", "layout"}},
+		"round":            {Args: []Kind{FloatKind, FloatKind}, Result: FloatKind, Names: []string{"value", "digits"}, Optional: 1},
+	}
+	tests := []struct {
+		name             string
+		expressionString string
+		expectedError    bool
+	}{
+		{name: "arithmetic", expressionString: "(boot_time + to_int(last_change)) * 1000"},
+		{name: "concatenation", expressionString: "'speed: ' + to_int(s) + ' Mbps'"},
+		{name: "function with string arguments", expressionString: "time_since_epoch(t, 'ntp', 's') - to_int(up) / 100"},
+		{name: "variables may be anything", expressionString: "a - b == c && !d ? e.f : g[h]"},
+		{name: "comparison of strings", expressionString: "to_str(a) < 'b'"},
+		{name: "equality with null", expressionString: "to_int(a) != null"},
+		{name: "coalescing", expressionString: "null ?? to_int(a) ?? 0"},
+		{name: "member of a map", expressionString: "row().a + 1"},
+		{name: "result of any kind", expressionString: "anything() - anything().a"},
+		{name: "undefined function", expressionString: "undefined(a)", expectedError: true},
+		{name: "too few arguments", expressionString: "time_since_epoch(t, 'ntp')", expectedError: true},
+		{name: "too many arguments", expressionString: "to_int(a, b)", expectedError: true},
+		{name: "argument of the wrong kind", expressionString: "time_since_epoch(t, 1, 's')", expectedError: true},
+		{name: "subtraction of a string", expressionString: "'a' - 1", expectedError: true},
+		{name: "arithmetic on a boolean", expressionString: "(a > 1) * 2", expectedError: true},
+		{name: "arithmetic on null", expressionString: "null + 1", expectedError: true},
+		{name: "bitwise operator on a string", expressionString: "to_str(a) & 1", expectedError: true},
+		{name: "comparison of a string and a number", expressionString: "to_str(a) == to_int(b)", expectedError: true},
+		{name: "ordering of booleans", expressionString: "true < false", expectedError: true},
+		{name: "logical operator on a number", expressionString: "a && 1", expectedError: true},
+		{name: "negation of a string", expressionString: "!'a'", expectedError: true},
+		{name: "condition which is not a boolean", expressionString: "to_int(a) ? 1 : 2", expectedError: true},
+		{name: "error in a branch", expressionString: "a ? 1 : 'b' - 1", expectedError: true},
+		{name: "member of a number", expressionString: "to_int(a).b", expectedError: true},
+		{name: "key which is not a string", expressionString: "row()[1]", expectedError: true},
+		{name: "error in an argument", expressionString: "to_int(-'a')", expectedError: true},
+		{name: "try", expressionString: "(try to_int(a) else to_int(b)) * 8"},
+		{name: "error in the body of a try", expressionString: "try 'a' - 1 else 0", expectedError: true},
+		{name: "error in a fallback", expressionString: "try a else undefined(b)", expectedError: true},
+		{name: "let", expressionString: "let x = to_int(a); x * 8"},
+		{name: "keyword arguments", expressionString: "format(layout='%d', value=to_int(a))"},
+		{name: "keyword argument after positional arguments", expressionString: "format(a, layout='%d')"},
+		{name: "unknown keyword", expressionString: "format(a, units='%d')", expectedError: true},
+		{name: "keyword given as a positional argument", expressionString: "format(a, value=b)", expectedError: true},
+		{name: "keyword argument of the wrong kind", expressionString: "format(a, layout=1)", expectedError: true},
+		{name: "function without keywords", expressionString: "to_int(value=a)", expectedError: true},
+		{name: "optional argument omitted", expressionString: "round(a) * 2"},
+		{name: "optional argument given", expressionString: "round(a, 2)"},
+		{name: "optional argument omitted with keywords", expressionString: "round(value=a)"},
+		{name: "required argument omitted with keywords", expressionString: "round(digits=2)", expectedError: true},
+		{name: "too many arguments with optional arguments", expressionString: "round(a, 2, 3)", expectedError: true},
+		{name: "error in a let binding", expressionString: "let x = 'a' - 1; x", expectedError: true},
+		{name: "error in the body of a let", expressionString: "let x = a; undefined(x)", expectedError: true},
+		{name: "binding of the wrong kind", expressionString: "let x = to_str(a); x - 1", expectedError: true},
+		{name: "binding shadowing a function result", expressionString: "let x = to_str(a); (let x = 1; x - 1) + x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			err = Validate(expression, signatures)
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("Validate(%q) got error: %v", test.expressionString, err)
+			case test.expectedError && err == nil:
+				t.Errorf("Validate(%q) got no error, expected error", test.expressionString)
+			}
+		})
+	}
+}
+
+func TestInfer(t *testing.T) {
+	signatures := map[string]Signature{
+		"to_int": {Args: []Kind{AnyKind}, Result: IntKind},
+		"row":    {Result: MapKind},
+	}
+	kinds := map[string]Kind{
+		"name":    StringKind,
+		"octets":  UintKind,
+		"up":      BoolKind,
+		"entry":   MapKind,
+		"missing": NullKind,
+	}
+	tests := []struct {
+		name             string
+		expressionString string
+		expected         Kind
+		expectedError    bool
+	}{
+		{name: "variable", expressionString: "name", expected: StringKind},
+		{name: "arithmetic", expressionString: "octets * 8", expected: FloatKind},
+		{name: "function", expressionString: "to_int(name)", expected: IntKind},
+		{name: "concatenation", expressionString: "name + octets", expected: StringKind},
+		{name: "comparison", expressionString: "octets > 0", expected: BoolKind},
+		{name: "conditional", expressionString: "up ? name : 'down'", expected: StringKind},
+		{name: "conditional of different kinds", expressionString: "up ? name : octets", expected: AnyKind},
+		{name: "coalescing", expressionString: "missing ?? octets", expected: FloatKind},
+		{name: "member", expressionString: "entry.name", expected: AnyKind},
+		{name: "unknown variable", expressionString: "other", expected: AnyKind},
+		{name: "let", expressionString: "let x = up; !x", expected: BoolKind},
+		{name: "let shadowing a variable", expressionString: "let name = octets; name * 8", expected: FloatKind},
+		{name: "arithmetic on a string variable", expressionString: "name - 1", expectedError: true},
+		{name: "arithmetic on a null variable", expressionString: "missing * 8", expectedError: true},
+		{name: "logical operator on a number variable", expressionString: "up && octets", expectedError: true},
+		{name: "member of a string variable", expressionString: "name.x", expectedError: true},
+		{name: "comparison of a string and a number", expressionString: "name == octets", expectedError: true},
+		{name: "mismatch in a binding", expressionString: "let x = name; x * 8", expectedError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			got, err := Infer(expression, kinds, signatures)
+			switch {
+			case !test.expectedError && err != nil:
+				t.Errorf("Infer(%q) got error: %v", test.expressionString, err)
+			case test.expectedError && err == nil:
+				t.Errorf("Infer(%q) = %v, expected error", test.expressionString, got)
+			case !test.expectedError && got != test.expected:
+				t.Errorf("Infer(%q) = %v, expected %v", test.expressionString, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+// Functions for traversing parsed expressions, eg: for linting or dependency analysis.
+
+/*
+Node is a node of a parsed expression: an *Expression, *Disjunction, *Conjunction, *Comparison,
+*BitOr, *BitXor, *BitAnd, *Shift, *Sum, *Term, *Factor, *Value, *Function or *Member, or one of the
+operator nodes which pair an operator with its right operand (eg: *OpTerm).
+*/
+type Node interface {
+	String() string
+}
+
+/*
+Visitor is called by Walk for each node. If Visit returns a non-nil visitor w, Walk visits the
+children of the node with w, followed by a call of w.Visit(nil).
+*/
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+/*
+Walk traverses an expression in depth-first order, starting by calling visitor.Visit(node). The
+children of a node are visited in the order they appear in the expression.
+*/
+func Walk(node Node, visitor Visitor) {
+	if visitor = visitor.Visit(node); visitor == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Expression:
+		if n.Left != nil { // Can be nil if the expression is empty (ie: "").
+			Walk(n.Left, visitor)
+		}
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+		if n.Then != nil {
+			Walk(n.Then, visitor)
+			Walk(n.Else, visitor)
+		}
+	case *OpDisjunction:
+		Walk(n.Disjunction, visitor)
+	case *Disjunction:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpConjunction:
+		Walk(n.Conjunction, visitor)
+	case *Conjunction:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpComparison:
+		Walk(n.Comparison, visitor)
+	case *Comparison:
+		Walk(n.Left, visitor)
+		if n.Right != nil {
+			Walk(n.Right, visitor)
+		}
+	case *OpBitOr:
+		Walk(n.BitOr, visitor)
+	case *BitOr:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpBitXor:
+		Walk(n.BitXor, visitor)
+	case *BitXor:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpBitAnd:
+		Walk(n.BitAnd, visitor)
+	case *BitAnd:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpShift:
+		Walk(n.Shift, visitor)
+	case *Shift:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpSum:
+		Walk(n.Sum, visitor)
+	case *Sum:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpTerm:
+		Walk(n.Term, visitor)
+	case *Term:
+		Walk(n.Left, visitor)
+		for _, r := range n.Right {
+			Walk(r, visitor)
+		}
+	case *OpFactor:
+		Walk(n.Factor, visitor)
+	case *Factor:
+		Walk(n.Base, visitor)
+		if n.Exponent != nil {
+			Walk(n.Exponent, visitor)
+		}
+	case *Value:
+		switch {
+		case n.Not != nil:
+			Walk(n.Not, visitor)
+		case n.Try != nil:
+			Walk(n.Try, visitor)
+		case n.Let != nil:
+			Walk(n.Let, visitor)
+		case n.Function != nil:
+			Walk(n.Function, visitor)
+		case n.Subexpression != nil:
+			Walk(n.Subexpression, visitor)
+		}
+		for _, m := range n.Members {
+			Walk(m, visitor)
+		}
+	case *Try:
+		Walk(n.Body, visitor)
+		Walk(n.Fallback, visitor)
+	case *Let:
+		Walk(n.Value, visitor)
+		Walk(n.Body, visitor)
+	case *Function:
+		for _, arg := range n.Args {
+			Walk(&arg.Value, visitor)
+		}
+	case *Member:
+		if n.Key != nil {
+			Walk(n.Key, visitor)
+		}
+	}
+	visitor.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/*
+Inspect traverses an expression in depth-first order (see Walk), calling f for each node. If f
+returns false, the children of the node are not visited. After the children of a node are visited,
+f is called with nil.
+*/
+func Inspect(node Node, f func(Node) bool) {
+	Walk(node, inspector(f))
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oparse
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name             string
+		expressionString string
+		skipFunctions    bool
+		expectedValues   []string
+		expectedOps      []string
+	}{
+		{
+			name:             "single value",
+			expressionString: "a",
+			expectedValues:   []string{"a"},
+		},
+		{
+			name:             "operators in order",
+			expressionString: "a + b * c - d",
+			expectedValues:   []string{"a", "b", "c", "d"},
+			expectedOps:      []string{"+ b * c", "* c", "- d"},
+		},
+		{
+			name:             "every level",
+			expressionString: "up ? x ?? !y || a && b == c | d ~ e & f << g ^ h % i : row[k].m",
+			expectedValues: []string{
+				"up", "x", "y", "!y", "a", "b", "c", "d", "e", "f", "g", "h", "i", "k", "row[k].m",
+			},
+			expectedOps: []string{
+				"?? !y || a && b == c | d ~ e & f << g ^ h % i", "|| a && b == c | d ~ e & f << g ^ h % i",
+				"&& b == c | d ~ e & f << g ^ h % i", "== c | d ~ e & f << g ^ h % i", "| d ~ e & f << g ^ h % i",
+				"~ e & f << g ^ h % i", "& f << g ^ h % i", "<< g ^ h % i", "% i",
+			},
+		},
+		{
+			name:             "try",
+			expressionString: "try a else b + 1",
+			expectedValues:   []string{"a", "b", "1", "try a else b + 1"},
+			expectedOps:      []string{"+ 1"},
+		},
+		{
+			name:             "let",
+			expressionString: "let x = a; x + 1",
+			expectedValues:   []string{"a", "x", "1", "let x = a; x + 1"},
+			expectedOps:      []string{"+ 1"},
+		},
+		{
+			name:             "function arguments",
+			expressionString: "f(a, (b))",
+			expectedValues:   []string{"a", "b", "(b)", "f(a, (b))"},
+		},
+		{
+			name:             "skip children",
+			expressionString: "f(a, (b)) + c",
+			skipFunctions:    true,
+			expectedValues:   []string{"f(a, (b))", "c"},
+			expectedOps:      []string{"+ c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := Parse(test.expressionString)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+			}
+			var values, ops []string
+			var stack []Node
+			Inspect(expression, func(node Node) bool {
+				if node == nil {
+					// Values are recorded once their children have been visited.
+					if v, ok := stack[len(stack)-1].(*Value); ok {
+						values = append(values, v.String())
+					}
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				switch n := node.(type) {
+				case *OpDisjunction, *OpConjunction, *OpComparison, *OpBitOr, *OpBitXor, *OpBitAnd, *OpShift, *OpSum, *OpTerm, *OpFactor:
+					ops = append(ops, n.String())
+				case *Value:
+					if test.skipFunctions && n.Function != nil {
+						values = append(values, n.String())
+						return false
+					}
+				}
+				stack = append(stack, node)
+				return true
+			})
+			if len(stack) != 0 {
+				t.Errorf("Inspect(%q) did not call f with nil after every node: %v", test.expressionString, stack)
+			}
+			if !cmp.Equal(values, test.expectedValues) {
+				t.Errorf("Inspect(%q) got values: %v; expected: %v", test.expressionString, values, test.expectedValues)
+			}
+			if !cmp.Equal(ops, test.expectedOps) {
+				t.Errorf("Inspect(%q) got operators: %v; expected: %v", test.expressionString, ops, test.expectedOps)
+			}
+		})
+	}
+}
+
+// depthVisitor records the depth of the deepest node it visits.
+type depthVisitor struct {
+	depth    int
+	maxDepth *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	if v.depth > *v.maxDepth {
+		*v.maxDepth = v.depth
+	}
+	return depthVisitor{depth: v.depth + 1, maxDepth: v.maxDepth}
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		expressionString string
+		expected         int
+	}{
+		// Expression, Disjunction, Conjunction, Comparison, BitOr, BitXor, BitAnd, Shift, Sum, Term, Factor, Value.
+		{expressionString: "a", expected: 11},
+		{expressionString: "a + b * c", expected: 13}, // Via an OpSum and an OpTerm.
+		{expressionString: "(a)", expected: 23},
+	}
+	for _, test := range tests {
+		expression, err := Parse(test.expressionString)
+		if err != nil {
+			t.Fatalf("Parse(%q) got error: %v", test.expressionString, err)
+		}
+		got := 0
+		Walk(expression, depthVisitor{maxDepth: &got})
+		if got != test.expected {
+			t.Errorf("Walk(%q) got depth %v; expected %v", test.expressionString, got, test.expected)
+		}
+	}
+}
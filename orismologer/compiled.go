@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"sync"
+
+	"github.com/google/orismologer/oparse"
+)
+
+// compiledExpression is an expression of a transformation, parsed and compiled once for all evaluations.
+type compiledExpression struct {
+	program   *oparse.Program
+	variables []string
+	optional  []string // Variables which may be null (see oparse.Expression.OptionalVariables).
+	required  []string // Variables which must be resolved (see oparse.Expression.RequiredVariables).
+	functions []string
+}
+
+/*
+expressionCache holds the compiled expressions of transformations, keyed by expression string, so
+that leaves polled repeatedly are not parsed on every evaluation. Constant sub-expressions are folded
+with the options expressions are evaluated with (see oparse.Expression.Fold). It is safe for concurrent
+use.
+*/
+type expressionCache struct {
+	options     oparse.Options
+	expressions sync.Map // string -> *compiledExpression.
+}
+
+func newExpressionCache(options oparse.Options) *expressionCache {
+	return &expressionCache{options: options}
+}
+
+/*
+compile returns the compiled form of the given expression, parsing it if it is not cached. Expressions
+which cannot be parsed are not cached.
+*/
+func (c *expressionCache) compile(expressionString string) (*compiledExpression, error) {
+	if compiled, ok := c.expressions.Load(expressionString); ok {
+		return compiled.(*compiledExpression), nil
+	}
+	expression, err := oparse.Parse(expressionString)
+	if err != nil {
+		return nil, err
+	}
+	expression = expression.Fold(c.options)
+	variables, functionNames := expression.Identifiers()
+	compiled := &compiledExpression{
+		program:   expression.Compile(),
+		variables: c.variables(variables),
+		optional:  c.variables(expression.OptionalVariables()),
+		required:  c.variables(expression.RequiredVariables()),
+		functions: functionNames,
+	}
+	c.expressions.Store(expressionString, compiled)
+	return compiled, nil
+}
+
+// variables returns the given variables, without any named constants which could not be folded.
+func (c *expressionCache) variables(variables []string) []string {
+	var filtered []string
+	for _, variable := range variables {
+		if _, ok := c.options.Constants[variable]; !ok {
+			filtered = append(filtered, variable)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
+)
+
+func TestExpressionCache(t *testing.T) {
+	cache := newExpressionCache(oparse.Options{Constants: oparse.Context{"KILO": 1000, "UNITS": map[string]int{}}})
+	first, err := cache.compile("a ?? to_int(b) + c")
+	if err != nil {
+		t.Fatalf("compile got error: %v", err)
+	}
+	if second, err := cache.compile("a ?? to_int(b) + c"); err != nil || second != first {
+		t.Errorf("compile of a cached expression got %p (error %v), expected %p", second, err, first)
+	}
+	if got, expected := first.required, []string{"b", "c"}; !cmp.Equal(got, expected) {
+		t.Errorf("required = %v, expected %v", got, expected)
+	}
+	if got, expected := first.functions, []string{"to_int"}; !cmp.Equal(got, expected) {
+		t.Errorf("functions = %v, expected %v", got, expected)
+	}
+	if _, err := cache.compile("a +"); err == nil {
+		t.Errorf("compile of an invalid expression got no error")
+	}
+	if _, ok := cache.expressions.Load("a +"); ok {
+		t.Errorf("invalid expression was cached")
+	}
+	compiled, err := cache.compile("a * KILO / UNITS[b]")
+	if err != nil {
+		t.Fatalf("compile got error: %v", err)
+	}
+	if got, expected := compiled.program.String(), "a * 1000 / UNITS[b]"; got != expected {
+		t.Errorf("compile folded %q, expected %q", got, expected)
+	}
+	if got, expected := compiled.variables, []string{"a", "b"}; !cmp.Equal(got, expected) {
+		t.Errorf("variables = %v, expected %v", got, expected)
+	}
+}
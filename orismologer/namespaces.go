@@ -0,0 +1,226 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultNamespace is the namespace used when a request does not name one.
+const DefaultNamespace = "default"
+
+/*
+Namespaces holds independent Orismologer instances (ie: config sets) under names, eg: one per
+business unit, so they can be served from one process without sharing a mapping space.
+It is safe for concurrent use; namespaces may be replaced (eg: reloaded) while others are in use.
+*/
+type Namespaces struct {
+	mu        sync.RWMutex
+	instances map[string]*Orismologer
+}
+
+// NewNamespaces returns an empty set of namespaces.
+func NewNamespaces() *Namespaces {
+	return &Namespaces{instances: map[string]*Orismologer{}}
+}
+
+/*
+Load builds an Orismologer instance from the given files (see NewOrismologer) and stores it under the
+given name, replacing any existing instance. On error the existing instance is left in place.
+*/
+func (n *Namespaces) Load(name, mappingsFile, transformationsFile, vendorOidsFile string) error {
+	o, err := NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile)
+	if err != nil {
+		return fmt.Errorf("could not load namespace %q: %v", name, err)
+	}
+	n.Set(name, o)
+	return nil
+}
+
+// Set stores an Orismologer instance under the given name, replacing any existing instance.
+func (n *Namespaces) Set(name string, o *Orismologer) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.instances[name] = o
+}
+
+// Remove deletes the named namespace, if it exists. An empty name means DefaultNamespace.
+func (n *Namespaces) Remove(name string) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.instances, name)
+}
+
+// Get returns the Orismologer instance for the given namespace. An empty name means DefaultNamespace.
+func (n *Namespaces) Get(name string) (*Orismologer, error) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	o, ok := n.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("no such namespace %q", name)
+	}
+	return o, nil
+}
+
+// Names returns the names of all namespaces, sorted.
+func (n *Namespaces) Names() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	names := make([]string, 0, len(n.instances))
+	for name := range n.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Eval evaluates an OpenConfig path (see Orismologer.Eval) using the config of the given namespace.
+func (n *Namespaces) Eval(namespace, openConfigPath, target, vendor string) (interface{}, error) {
+	o, err := n.Get(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return o.Eval(openConfigPath, target, vendor)
+}
+
+/*
+Reload rebuilds the named namespace from the files its config was loaded from (see Manifest), keeping
+its resolvers (see SetResolver and SetBatchResolver), post-processors, functions (see SetFunctions) and
+evaluation options (see SetLimits and SetArithmetic). Scripts are reloaded too. On error the existing
+instance is left in place.
+*/
+func (n *Namespaces) Reload(name string) error {
+	o, err := n.Get(name)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, role := range configRoles {
+		file, ok := o.Manifest().File(role)
+		if !ok {
+			return fmt.Errorf("namespace %q was not loaded from files (no %v file)", name, role)
+		}
+		files = append(files, file.Path)
+	}
+	reloaded, err := NewOrismologerWithMIBs(files[0], files[1], files[2], o.MIBs())
+	if err != nil {
+		return fmt.Errorf("could not reload namespace %q: %v", name, err)
+	}
+	// Hooks set by the embedding program are not part of the config.
+	reloaded.nocPathResolver = o.nocPathResolver
+	reloaded.postProcessors = o.postProcessors
+	reloaded.evalOptions = o.evalOptions
+	reloaded.batchResolver = o.batchResolver
+	if err := reloaded.SetFunctions(o.library); err != nil {
+		return fmt.Errorf("could not reload namespace %q: %v", name, err)
+	}
+	n.Set(name, reloaded)
+	return nil
+}
+
+/*
+Namespace returns a view of the named namespace which always uses its current instance, so that
+long-lived users (eg: servers) see reloads.
+*/
+func (n *Namespaces) Namespace(name string) Namespace {
+	return Namespace{namespaces: n, name: name}
+}
+
+// Namespace is a view of a single namespace. See Namespaces.Namespace.
+type Namespace struct {
+	namespaces *Namespaces
+	name       string
+}
+
+// Eval implements Orismologer.Eval for the namespace.
+func (n Namespace) Eval(openConfigPath, target, vendor string) (interface{}, error) {
+	return n.namespaces.Eval(n.name, openConfigPath, target, vendor)
+}
+
+// EvalResult implements Orismologer.EvalResult for the namespace.
+func (n Namespace) EvalResult(openConfigPath, target, vendor string) (*Result, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return nil, err
+	}
+	return o.EvalResult(openConfigPath, target, vendor)
+}
+
+// EvalBatch implements Orismologer.EvalBatch for the namespace.
+func (n Namespace) EvalBatch(leaves []string, target, vendor string) (map[string]interface{}, map[string]error, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return o.EvalBatch(leaves, target, vendor)
+}
+
+// EvalBatchResults implements Orismologer.EvalBatchResults for the namespace.
+func (n Namespace) EvalBatchResults(leaves []string, target, vendor string) (map[string]*Result, map[string]error, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return o.EvalBatchResults(leaves, target, vendor)
+}
+
+// Leaves implements Orismologer.Leaves for the namespace.
+func (n Namespace) Leaves(root string) ([]string, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return nil, err
+	}
+	return o.Leaves(root)
+}
+
+// Supported implements Orismologer.Supported for the namespace.
+func (n Namespace) Supported(openConfigPath, vendor string) (bool, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return false, err
+	}
+	return o.Supported(openConfigPath, vendor)
+}
+
+// Revisions implements Orismologer.Revisions for the namespace.
+func (n Namespace) Revisions(openConfigPath string) ([]string, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return nil, err
+	}
+	return o.Revisions(openConfigPath)
+}
+
+// KeyVariables implements Orismologer.KeyVariables for the namespace.
+func (n Namespace) KeyVariables(openConfigPath string) (map[string]string, error) {
+	o, err := n.namespaces.Get(n.name)
+	if err != nil {
+		return nil, err
+	}
+	return o.KeyVariables(openConfigPath)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestNamespaces(t *testing.T) {
+	makeNamespace := func(bind string) *Orismologer {
+		o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+			Nodes: []*pb.OpenConfigNode{
+				{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: bind},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Could not set up test: %v", err)
+		}
+		return o
+	}
+	n := NewNamespaces()
+	n.Set("", makeNamespace("boot_time"))
+	n.Set("unit_b", makeNamespace("system_up_time"))
+
+	if got, expected := n.Names(), []string{DefaultNamespace, "unit_b"}; !cmp.Equal(got, expected) {
+		t.Errorf("Names() = %v, expected %v", got, expected)
+	}
+	for _, test := range []struct {
+		namespace    string
+		expected     interface{}
+		expectsError bool
+	}{
+		{
+			namespace: "",
+			expected:  100.0,
+		},
+		{
+			namespace: DefaultNamespace,
+			expected:  100.0,
+		},
+		{
+			namespace: "unit_b",
+			expected:  20000000.0,
+		},
+		{
+			namespace:    "unknown",
+			expectsError: true,
+		},
+	} {
+		t.Run(test.namespace, func(t *testing.T) {
+			got, err := n.Eval(test.namespace, "/system/state/boot-time", "target", "cisco")
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Eval(%q) got error: %v", test.namespace, err)
+			case err == nil && test.expectsError:
+				t.Errorf("Eval(%q) = %v, expected error", test.namespace, got)
+			case err == nil && !cmp.Equal(got, test.expected):
+				t.Errorf("Eval(%q) = %v, expected %v", test.namespace, got, test.expected)
+			}
+		})
+	}
+
+	n.Remove("unit_b")
+	if _, err := n.Get("unit_b"); err == nil {
+		t.Errorf("Get() of removed namespace expected error, got none")
+	}
+	n.Remove("")
+	if _, err := n.Get(DefaultNamespace); err == nil {
+		t.Errorf("Get() of the default namespace removed as \"\" expected error, got none")
+	}
+	if err := n.Load("broken", "missing.pb", "missing.pb", "missing.pb"); err == nil {
+		t.Errorf("Load() of missing files expected error, got none")
+	}
+}
+
+func TestNamespacesReload(t *testing.T) {
+	n := NewNamespaces()
+	if err := n.Load("", "../proto/mappings.pb", "../proto/transformations.pb", "../proto/vendor_oids.pb"); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	view := n.Namespace(DefaultNamespace)
+	before, err := n.Get(DefaultNamespace)
+	if err != nil {
+		t.Fatalf("Get() got error: %v", err)
+	}
+	before.AddPostProcessor(PostProcessorFunc(func(result *Result) (bool, error) {
+		return false, nil
+	}))
+	library, err := Functions().With(map[string]interface{}{
+		"double": func(f float64) float64 { return 2 * f },
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if err := before.SetFunctions(library); err != nil {
+		t.Fatalf("SetFunctions() got error: %v", err)
+	}
+	if err := n.Reload(DefaultNamespace); err != nil {
+		t.Fatalf("Reload() got error: %v", err)
+	}
+	after, err := n.Get(DefaultNamespace)
+	if err != nil {
+		t.Fatalf("Get() got error: %v", err)
+	}
+	if before == after {
+		t.Errorf("Reload() did not replace the instance")
+	}
+	if len(after.postProcessors) != 1 {
+		t.Errorf("Reload() kept %d post-processors, expected 1", len(after.postProcessors))
+	}
+	if !after.functions.Contains("double") {
+		t.Errorf("Reload() dropped the functions set by SetFunctions")
+	}
+	if leaves, err := view.Leaves("/"); err != nil || len(leaves) == 0 {
+		t.Errorf("Namespace().Leaves() = %v, %v, expected leaves", leaves, err)
+	}
+	if file, _ := after.Manifest().File(utils.RoleVendorOids); file.Path != "../proto/vendor_oids.pb" {
+		t.Errorf("Reload() loaded vendor OIDs from %q, expected ../proto/vendor_oids.pb", file.Path)
+	}
+
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	n.Set("in_memory", o)
+	if err := n.Reload("in_memory"); err == nil {
+		t.Errorf("Reload() of namespace not loaded from files expected error, got none")
+	}
+	o.manifest = &utils.Manifest{Files: []utils.ManifestFile{{Path: "a.pb"}, {Path: "b.pb"}, {Path: "c.pb"}}}
+	if err := n.Reload("in_memory"); err == nil {
+		t.Errorf("Reload() of namespace with files of unknown roles expected error, got none")
+	}
+	if err := n.Reload("unknown"); err == nil {
+		t.Errorf("Reload() of unknown namespace expected error, got none")
+	}
+}
@@ -21,13 +21,19 @@ package orismologer
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/orismologer/functions"
+	"github.com/google/orismologer/lint"
+	"github.com/google/orismologer/mib"
 	"github.com/google/orismologer/octree"
 	"github.com/google/orismologer/oparse"
+	"github.com/google/orismologer/profiles"
 	"github.com/google/orismologer/utils"
+	"github.com/openconfig/goyang/pkg/yang"
 
 	pb "github.com/google/orismologer/proto_out/proto"
 )
@@ -37,24 +43,49 @@ type nocPathResolver func(*pb.NocPath, string) (interface{}, error)
 type functionLibrary interface {
 	Contains(funcName string) bool
 	Call(funcName string, args ...interface{}) (interface{}, error)
+	// CallWithContext calls a function for an expression evaluated for a target (see functions.CallContext).
+	CallWithContext(cc functions.CallContext, funcName string, args ...interface{}) (interface{}, error)
 }
 
 // Orismologer translates non-OpenConfig telemetry sources (eg: SNMP OIDs) to OpenConfig paths.
 type Orismologer struct {
 	mappings        octree.OcTree
 	transformations transformationMap
-	vendorInfo      *pb.VendorOids
+	vendors         *vendorRegistry
 	nocPathResolver nocPathResolver
+	resolvers       map[string]nocPathResolver // Vendor -> resolver, for vendors with their own.
 	functions       functionLibrary
+	library         functions.Library // The functions given to SetFunctions, before those of scripts are added.
+	scripts         []string          // The scripts of the config, which define functions (see functions.Library.WithScripts).
+	manifest        *utils.Manifest
+	mibs            *mib.MIB
+	stats           *leafStats
+	postProcessors  []PostProcessor
+	evalOptions     oparse.Options
+	batchResolver   BatchResolver
+	expressions     *expressionCache
 }
 
+// configRoles are the roles of the files instances are loaded from, in the order NewOrismologer takes them.
+var configRoles = []string{utils.RoleMappings, utils.RoleTransformations, utils.RoleVendorOids}
+
 /*
 NewOrismologer builds an Orismologer instance from the text protos in the given files.
 mappingsFile should contain a Mappings proto.
 transformationFile should contain a Transformations proto.
 vendorOidsFile should contain a VendorOids proto.
+Vendor profiles registered with the profiles package are included.
 */
 func NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile string) (*Orismologer, error) {
+	return NewOrismologerWithMIBs(mappingsFile, transformationsFile, vendorOidsFile, nil)
+}
+
+/*
+NewOrismologerWithMIBs is like NewOrismologer, but symbolic OIDs in NocPaths (eg:
+IF-MIB::ifHCInOctets) are resolved to numeric OIDs using the given MIBs at load time. mibs may be nil,
+in which case all OIDs must be numeric.
+*/
+func NewOrismologerWithMIBs(mappingsFile, transformationsFile, vendorOidsFile string, mibs *mib.MIB) (*Orismologer, error) {
 	mappings, err := utils.LoadMappings(mappingsFile)
 	if err != nil {
 		return nil, err
@@ -67,7 +98,59 @@ func NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile string) (*
 	if err != nil {
 		return nil, err
 	}
-	return newOrismologer(mappings, transformations, vendorOids)
+	vendorProfiles := profiles.All()
+	if err := mergeProfiles(transformations, vendorOids, vendorProfiles); err != nil {
+		return nil, err
+	}
+	if err := resolveOids(transformations, mibs); err != nil {
+		return nil, err
+	}
+	manifest, err := utils.NewManifest(mappings, transformations, mappingsFile, transformationsFile, vendorOidsFile)
+	if err != nil {
+		return nil, err
+	}
+	for i, role := range configRoles {
+		manifest.Files[i].Role = role
+	}
+	o, err := newOrismologer(mappings, transformations, vendorOids)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.useProfiles(vendorProfiles); err != nil {
+		return nil, err
+	}
+	o.scripts = transformations.GetScripts()
+	if err := o.SetFunctions(o.library); err != nil {
+		return nil, err
+	}
+	for _, profile := range vendorProfiles {
+		manifest.Profiles = append(manifest.Profiles, profile.Vendor)
+	}
+	o.manifest = manifest
+	o.mibs = mibs
+	return o, nil
+}
+
+// resolveOids replaces symbolic OIDs in the given transformations with numeric OIDs.
+func resolveOids(transformations *pb.Transformations, mibs *mib.MIB) error {
+	if mibs != nil {
+		return mibs.ResolveTransformations(transformations)
+	}
+	for _, transformation := range transformations.GetTransformations() {
+		for _, nocPath := range transformation.GetNocPaths() {
+			for _, oid := range nocPath.GetOids() {
+				if mib.IsSymbolic(oid) {
+					return fmt.Errorf("NocPath %q has symbolic OID %q, but no MIBs are loaded", nocPath.GetBind(), oid)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// MIBs returns the MIBs used to resolve symbolic OIDs, or nil if none were given.
+func (o *Orismologer) MIBs() *mib.MIB {
+	return o.mibs
 }
 
 func newOrismologer(mappings *pb.Mappings, transformations *pb.Transformations, vendorInfo *pb.VendorOids) (*Orismologer, error) {
@@ -75,16 +158,27 @@ func newOrismologer(mappings *pb.Mappings, transformations *pb.Transformations,
 	if err != nil {
 		return nil, err
 	}
+	t.IndexOids(transformations)
 	transformationMap, err := makeTransformationMap(transformations)
 	if err != nil {
 		return nil, err
 	}
+	vendors, err := newVendorRegistry(vendorInfo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vendor OIDs: %v", err)
+	}
+	evalOptions := oparse.Options{Limits: oparse.DefaultLimits}
+	library := functions.NewLibrary()
 	return &Orismologer{
 		mappings:        t,
 		transformations: transformationMap,
-		vendorInfo:      vendorInfo,
+		vendors:         vendors,
 		nocPathResolver: resolve,
-		functions:       functions.NewLibrary(),
+		functions:       library,
+		library:         library,
+		stats:           newLeafStats(),
+		evalOptions:     evalOptions,
+		expressions:     newExpressionCache(evalOptions),
 	}, nil
 }
 
@@ -100,6 +194,137 @@ func makeTransformationMap(transformations *pb.Transformations) (transformationM
 	return transformationMap, nil
 }
 
+/*
+SetResolver replaces the default resolver of NocPaths, eg: with a client for real devices or with a
+simulated fleet (see the simulation package). Resolvers of vendor profiles still take precedence for
+their vendors. It must not be called concurrently with evaluation.
+*/
+func (o *Orismologer) SetResolver(resolver func(nocPath *pb.NocPath, target string) (interface{}, error)) {
+	o.nocPathResolver = resolver
+}
+
+/*
+SetFunctions sets the functions available to expressions, which default to those of Functions, eg: to
+add the functions of plugins (see functions.Library.WithPlugins). The functions of the config's scripts
+are added to them. It must not be called concurrently with evaluation.
+*/
+func (o *Orismologer) SetFunctions(library functions.Library) error {
+	withScripts, err := library.WithScripts(o.scripts...)
+	if err != nil {
+		return err
+	}
+	o.library, o.functions = library, withScripts
+	return nil
+}
+
+/*
+SetLimits sets the limits on the evaluation of each expression (see oparse.Limits), which default to
+oparse.DefaultLimits. It must not be called concurrently with evaluation.
+*/
+func (o *Orismologer) SetLimits(limits oparse.Limits) {
+	o.evalOptions.Limits = limits
+}
+
+/*
+SetArithmetic sets how numbers are represented when evaluating expressions (see oparse.Arithmetic),
+eg: oparse.IntegerArithmetic to keep 64-bit counters exact. It must not be called concurrently with
+evaluation.
+*/
+func (o *Orismologer) SetArithmetic(arithmetic oparse.Arithmetic) {
+	o.evalOptions.Arithmetic = arithmetic
+	o.expressions = newExpressionCache(o.evalOptions) // Constants were folded with the old arithmetic.
+}
+
+/*
+SetNumberFormat sets how numbers concatenated with strings in expressions are formatted (see
+oparse.NumberFormat), eg: so that string leaves do not switch to exponents as values grow. It must not
+be called concurrently with evaluation.
+*/
+func (o *Orismologer) SetNumberFormat(format oparse.NumberFormat) {
+	o.evalOptions.NumberFormat = format
+	o.expressions = newExpressionCache(o.evalOptions) // Constant concatenations were folded with the old format.
+}
+
+/*
+SetConstants sets named constants which expressions may use in place of magic numbers, eg: MEGA or
+NTP_EPOCH_OFFSET. Constant sub-expressions are folded when expressions are first evaluated (see
+oparse.Expression.Fold). Constants take precedence over NocPaths and transformations of the same name.
+It must not be called concurrently with evaluation.
+*/
+func (o *Orismologer) SetConstants(constants oparse.Context) {
+	o.evalOptions.Constants = constants
+	o.expressions = newExpressionCache(o.evalOptions)
+}
+
+/*
+Manifest describes the configuration files this Orismologer instance was built from. It is nil if
+the instance was not built from files.
+*/
+func (o *Orismologer) Manifest() *utils.Manifest {
+	return o.manifest
+}
+
+/*
+Leaves returns the OpenConfig paths in the subtree rooted at the given path which are bound to a
+transformation (ie: which can be passed to Eval).
+*/
+func (o *Orismologer) Leaves(root string) ([]string, error) {
+	return o.mappings.Leaves(root)
+}
+
+/*
+PathsForOid returns the OpenConfig leaves derived from the given OID (via their transformations, and
+those they reference), eg: to find the leaves affected by a change to a device's MIB (see
+octree.OcTree.PathsForOid).
+*/
+func (o *Orismologer) PathsForOid(oid string) []string {
+	return o.mappings.PathsForOid(oid)
+}
+
+/*
+FindOcPaths returns the OpenConfig paths which match the given regular expression, eg: "cpu" (see
+octree.OcTree.Find).
+*/
+func (o *Orismologer) FindOcPaths(pattern string) ([]string, error) {
+	return o.mappings.Find(pattern)
+}
+
+/*
+ExportOcPaths returns the tree of OpenConfig paths rooted at the given node, with the transformations
+they are bound to, in the given format: "json", "yaml" (see octree.OcTree.Export) or "dot", which
+Graphviz renders with the leaves lacking transformations highlighted (see octree.OcTree.ToDot).
+*/
+func (o *Orismologer) ExportOcPaths(root, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return o.mappings.ToJSON(root)
+	case "yaml":
+		return o.mappings.ToYAML(root)
+	case "dot":
+		dot, err := o.mappings.ToDot(root)
+		return []byte(dot), err
+	}
+	return nil, fmt.Errorf("unknown format %q; expected json, yaml or dot", format)
+}
+
+/*
+ValidateSchema checks that the mapped OpenConfig paths exist in the given YANG module entries (eg: as
+loaded by yanggen.Load), and that only leaves are bound to transformations (see octree.OcTree.Validate).
+If they do, it also checks that the kinds of the results of transformations, where they can be inferred
+from the signatures of their functions, match the YANG types of the leaves they are bound to (see
+lint.Kinds and octree.OcTree.ValidateTypes).
+*/
+func (o *Orismologer) ValidateSchema(schema []*yang.Entry) error {
+	if err := o.mappings.Validate(schema); err != nil {
+		return err
+	}
+	transformations := &pb.Transformations{}
+	for _, t := range o.transformations {
+		transformations.Transformations = append(transformations.Transformations, t)
+	}
+	return o.mappings.ValidateTypes(schema, lint.Kinds(transformations, o.functions))
+}
+
 // PrintOcPaths pretty prints the tree of OpenConfig paths defined for this Orismologer instance.
 func (o *Orismologer) PrintOcPaths(root string) error {
 	return o.mappings.Print(root)
@@ -108,10 +333,65 @@ func (o *Orismologer) PrintOcPaths(root string) error {
 /*
 Eval retrieves the current value of a given OpenConfig path for a target which does not natively
 support OpenConfig.
-The vendor name is used to identify dependencies for the target (eg: which OIDs it supports).
+The vendor name is used to identify dependencies for the target (eg: which OIDs it supports). The
+name of a model defined in the VendorOids proto may be given instead, for finer-grained support.
 */
 // TODO: Support a dry run, to validate mappings and transformations protos.
 func (o *Orismologer) Eval(openConfigPath, target, vendor string) (interface{}, error) {
+	result, err := o.EvalResult(openConfigPath, target, vendor)
+	if err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+/*
+EvalWithTrace is like Eval, but also returns a trace of the evaluation's steps (see Trace). A trace
+is returned even if evaluation fails, to help find out why.
+*/
+func (o *Orismologer) EvalWithTrace(openConfigPath, target, vendor string) (interface{}, *Trace, error) {
+	start := time.Now()
+	trace := &Trace{Path: openConfigPath, Target: target, Vendor: vendor}
+	value, err := func() (interface{}, error) {
+		transformation, err := o.transformation(openConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		trace.Transformation = newTransformationTrace(transformation.GetBind())
+		result, err := o.evalLeaf(transformation, openConfigPath, target, vendor, trace.Transformation)
+		if err != nil {
+			return nil, err
+		}
+		return result.Value, nil
+	}()
+	trace.Value = value
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	trace.Duration = time.Since(start)
+	return value, trace, err
+}
+
+/*
+evalLeaf evaluates the transformation bound to a leaf and post-processes the value, recording the
+evaluation's statistics.
+*/
+func (o *Orismologer) evalLeaf(transformation *pb.Transformation, openConfigPath, target, vendor string, trace *TransformationTrace) (*Result, error) {
+	start := time.Now()
+	value, err := o.eval(transformation, target, vendor, []string{openConfigPath}, trace)
+	var result *Result
+	if err == nil {
+		result, err = o.postProcess(&Result{Path: openConfigPath, Target: target, Vendor: vendor, Value: value})
+	}
+	if result != nil {
+		value = result.Value
+	}
+	o.stats.record(target, openConfigPath, value, err, start, time.Since(start))
+	return result, err
+}
+
+// transformation returns the transformation bound to an OpenConfig path.
+func (o *Orismologer) transformation(openConfigPath string) (*pb.Transformation, error) {
 	transformationName, err := o.mappings.GetTransformationIdentifier(openConfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to identify a transformation for path %q: %v", openConfigPath, err)
@@ -121,33 +401,133 @@ func (o *Orismologer) Eval(openConfigPath, target, vendor string) (interface{},
 		return nil, fmt.Errorf("could not locate transformation %q for path %q", transformationName, openConfigPath)
 	}
 	glog.Infof("found transformation %q for path %q", transformationName, openConfigPath)
-	return o.eval(transformation, target, vendor)
+	return transformation, nil
+}
+
+/*
+Supported reports whether the given OpenConfig path can be evaluated for the given vendor (or
+model), without retrieving any data. A path is supported if at least one expression of its
+transformation has all of its variables supported, recursively.
+*/
+func (o *Orismologer) Supported(openConfigPath, vendor string) (bool, error) {
+	transformation, err := o.transformation(openConfigPath)
+	if err != nil {
+		return false, err
+	}
+	return o.supported(transformation, vendor, map[string]bool{}), nil
+}
+
+func (o *Orismologer) supported(transformation *pb.Transformation, vendor string, visiting map[string]bool) bool {
+	name := transformation.GetBind()
+	if visiting[name] {
+		return false // Circular reference.
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	nocPaths := map[string]*pb.NocPath{}
+	for _, nocPath := range transformation.GetNocPaths() {
+		nocPaths[nocPath.GetBind()] = nocPath
+	}
+	for _, expressionString := range transformation.GetExpressions() {
+		compiled, err := o.parseAndValidateExpression(expressionString)
+		if err != nil {
+			continue
+		}
+		if o.supportedVariables(compiled.required, nocPaths, vendor, visiting) {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedVariables reports whether every variable of an expression is supported for the vendor.
+func (o *Orismologer) supportedVariables(variables []string, nocPaths map[string]*pb.NocPath, vendor string, visiting map[string]bool) bool {
+	for _, variable := range variables {
+		nocPath := nocPaths[variable]
+		subTransformation := o.transformations[variable]
+		switch {
+		case nocPath != nil:
+			if !o.canResolve(nocPath, vendor) {
+				return false
+			}
+		case subTransformation != nil:
+			if !o.supported(subTransformation, vendor, visiting) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Coverage partitions the leaves beneath the given OpenConfig path into those which are supported for
+the given vendor (or model) and those which are not (see Supported).
+*/
+func (o *Orismologer) Coverage(root, vendor string) (supported, unsupported []string, err error) {
+	leaves, err := o.Leaves(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, leaf := range leaves {
+		if ok, err := o.Supported(leaf, vendor); err == nil && ok {
+			supported = append(supported, leaf)
+		} else {
+			unsupported = append(unsupported, leaf)
+		}
+	}
+	return supported, unsupported, nil
+}
+
+// Revisions returns the OpenConfig revisions for which the given path is declared to be valid.
+func (o *Orismologer) Revisions(openConfigPath string) ([]string, error) {
+	return o.mappings.Revisions(openConfigPath)
+}
+
+/*
+KeyVariables returns the NocPath variables which the variables of the keys of the given OpenConfig
+path are mapped to, eg: "name_value" -> "interface_index" for
+/interfaces/interface[name=name_value]/state/mtu.
+*/
+func (o *Orismologer) KeyVariables(openConfigPath string) (map[string]string, error) {
+	return o.mappings.KeyVariables(openConfigPath)
 }
 
 /*
 eval parses and evaluates a Transformation proto's Expressions field, resolving any variables used
 in expressions to their associated Transformations and recursively evaluating those until a final
 value is obtained by resolving a NocPath. If a transformation defines multiple expressions then the
-output of the first one that successfully evaluates is returned.
+output of the first one that successfully evaluates to a value other than null is returned.
 
-NocPaths are resolved using the function given to the Orismologer instance at instantiation.
+NocPaths are resolved using the function given to the Orismologer instance at instantiation. lookups
+are the OpenConfig paths being evaluated, outermost first, which expressions cannot look up again (see
+lookup). If trace is not nil, the steps of the evaluation are recorded in it.
 */
 // TODO: Eval paths with keys, eg: thing/name[name=value]
 // TODO: Safeguard against really long paths, and circular references.
-func (o *Orismologer) eval(transformation *pb.Transformation, target string, vendor string) (interface{}, error) {
+func (o *Orismologer) eval(transformation *pb.Transformation, target string, vendor string, lookups []string, trace *TransformationTrace) (interface{}, error) {
+	defer trace.finish()
 	transformationName := transformation.GetBind()
 	glog.Infof("evaluating transformation %q for target %q of vendor %q", transformationName, target, vendor)
 	nocPaths := o.getNocPaths(transformation)
 	// Try to eval each expression defined for this transformation, taking the first that works.
 	for _, expressionString := range transformation.GetExpressions() {
 		glog.Infof("evaluating expression `%v`", expressionString)
-		expression, variables, _, err := o.parseAndValidateExpression(expressionString)
+		step := trace.expression(expressionString)
+		compiled, err := o.parseAndValidateExpression(expressionString)
 		if err != nil {
 			glog.Errorf("%v", err)
+			step.parseError(err)
 			continue
 		}
-		values, err := o.evalVariables(variables, nocPaths, target, vendor)
-		if err != nil {
+		// Evaluate the expression, resolving the variables it references as they are needed.
+		variables := o.variableResolver(compiled, nocPaths, target, vendor, lookups, step)
+		transformationResult, err := compiled.program.EvalWithResolver(variables.resolve, o.caller(target, vendor, lookups, step), o.evalOptions)
+		if err != nil && variables.err != nil { // Unless the failure was caught, eg: by a try.
+			err = variables.err
+			step.finish(nil, err)
 			if unresolvableNocPathError, ok := err.(unresolvableNocPathError); ok {
 				glog.Info(unresolvableNocPathError.msg) // This is not an error we need to surface to the user.
 			} else {
@@ -156,18 +536,71 @@ func (o *Orismologer) eval(transformation *pb.Transformation, target string, ven
 			glog.Infof("could not evaluate all variables for expression `%v`, continuing to next expression", expressionString)
 			continue
 		}
-
-		// Evaluate the expression, passing in the values of the variables it uses.
-		transformationResult, err := oparse.Eval(expression, values, o.functions.Call)
+		step.finish(transformationResult, err)
 		if err != nil {
 			return nil, err
 		}
+		if transformationResult == nil {
+			glog.Infof("expression `%v` evaluated to null, continuing to next expression", expressionString)
+			continue
+		}
 		return transformationResult, nil
 	}
 	return nil, fmt.Errorf("none of the expressions of transformation %q could be evaluated (see logs for details)", transformationName)
 }
 
 // getNocPaths returns a map of all the NocPaths defined in the given transformation.
+/*
+caller returns the function caller of expressions evaluated for the given target, which evaluates
+lookups itself (see lookup). Functions are called in the context of the target, and of the time at
+which the caller is created, before the values of the expression are collected.
+*/
+func (o *Orismologer) caller(target, vendor string, lookups []string, trace *ExpressionTrace) oparse.FunctionCaller {
+	cc := functions.CallContext{Target: target, Vendor: vendor, Time: time.Now()}
+	return func(funcName string, args ...interface{}) (interface{}, error) {
+		if funcName == lookupFunction {
+			return o.lookup(args, target, vendor, lookups, trace)
+		}
+		return o.functions.CallWithContext(cc, funcName, args...)
+	}
+}
+
+// lookupFunction is the name of the function which evaluates another OpenConfig path (see lookup).
+const lookupFunction = "lookup"
+
+/*
+lookup evaluates the OpenConfig path given as the argument of a call of lookup, for the same target,
+so that derived leaves (eg: utilization, from a rate and the speed) can reuse mapped paths rather than
+duplicate their NocPaths. The value is that of the path's transformation, before post-processing.
+Looking up a path which is already being evaluated (eg: the path itself) is an error.
+*/
+func (o *Orismologer) lookup(args []interface{}, target, vendor string, lookups []string, trace *ExpressionTrace) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("function %q expects 1 argument, but got %v", lookupFunction, len(args))
+	}
+	path, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("argument 1 of function %q must be a string, but got %T", lookupFunction, args[0])
+	}
+	for _, l := range lookups {
+		if l == path {
+			return nil, fmt.Errorf("circular lookup of %q (evaluating %v)", path, strings.Join(lookups, " -> "))
+		}
+	}
+	glog.Infof("looking up %q", path)
+	step := trace.variable(path)
+	transformation, err := o.transformation(path)
+	var value interface{}
+	if err == nil {
+		value, err = o.eval(transformation, target, vendor, append(lookups[:len(lookups):len(lookups)], path), step.lookup(transformation.GetBind()))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not look up %q: %v", path, err)
+	}
+	step.finish(value, err)
+	return value, err
+}
+
 func (o *Orismologer) getNocPaths(transformation *pb.Transformation) map[string]*pb.NocPath {
 	transformationName := transformation.GetBind()
 	paths := map[string]*pb.NocPath{}
@@ -184,52 +617,97 @@ func (o *Orismologer) getNocPaths(transformation *pb.Transformation) map[string]
 }
 
 /*
-Returns the expression parsed from the given string and any variables and function names used in it.
+Returns the expression parsed and compiled from the given string, with any variables and function names
+used in it. Expressions are compiled once per instance (see expressionCache).
 */
-func (o *Orismologer) parseAndValidateExpression(expressionString string) (*oparse.Expression, []string, []string, error) {
-	expression, err := oparse.Parse(expressionString)
+func (o *Orismologer) parseAndValidateExpression(expressionString string) (*compiledExpression, error) {
+	compiled, err := o.expressions.compile(expressionString)
 	if err != nil {
 		glog.Errorf("could not parse expression `%v`", expressionString)
-		return nil, nil, nil, err
+		return nil, err
 	}
-	variables, functionNames := expression.Identifiers()
-	for _, functionName := range functionNames {
-		if !o.functions.Contains(functionName) {
-			return nil, nil, nil, fmt.Errorf("function %q is not defined", functionName)
+	for _, functionName := range compiled.functions {
+		// Lookups are evaluated by Orismologer itself, rather than by the library (see lookup).
+		if functionName != lookupFunction && !o.functions.Contains(functionName) {
+			return nil, fmt.Errorf("function %q is not defined", functionName)
 		}
 	}
-	return expression, variables, functionNames, nil
+	return compiled, nil
 }
 
 /*
-Evaluates each of the given variables, returning an error if one or more cannot be evaluated.
+variableResolver resolves the variables of an expression when they are referenced (see
+oparse.VariableResolver), so that NocPaths and sub-transformations which an expression does not need
+(eg: in a branch which is not taken) are not evaluated.
 */
-func (o *Orismologer) evalVariables(variables []string, nocPaths map[string]*pb.NocPath, target string, vendor string) (map[string]interface{}, error) {
-	values := oparse.Context{}
-	for _, variable := range variables {
-		glog.Infof("evaluating variable %q", variable)
-		var value interface{}
-		var err error
-		nocPath := nocPaths[variable]
-		transformation := o.transformations[variable]
-		switch {
-		case nocPath != nil:
-			value, err = o.handleNocPath(nocPath, target, vendor)
-			if err != nil {
-				return nil, err
-			}
-		case transformation != nil:
-			value, err = o.eval(transformation, target, vendor)
-			if err != nil {
-				return nil, fmt.Errorf("could not evaluate sub-transformation %q: %v", variable, err)
-			}
-		default:
-			return nil, fmt.Errorf("NocPath or sub-transformation %q is undefined", variable)
+type variableResolver struct {
+	o        *Orismologer
+	optional map[string]bool
+	nocPaths map[string]*pb.NocPath
+	target   string
+	vendor   string
+	lookups  []string // The OpenConfig paths being evaluated (see Orismologer.eval).
+	trace    *ExpressionTrace
+	err      error // The first error resolving a variable which is not optional.
+}
+
+func (o *Orismologer) variableResolver(compiled *compiledExpression, nocPaths map[string]*pb.NocPath, target string, vendor string, lookups []string, trace *ExpressionTrace) *variableResolver {
+	optional := map[string]bool{}
+	for _, variable := range compiled.optional {
+		optional[variable] = true
+	}
+	return &variableResolver{o: o, optional: optional, nocPaths: nocPaths, target: target, vendor: vendor, lookups: lookups, trace: trace}
+}
+
+/*
+resolve evaluates the given variable. Optional variables (ie: those only used where null is handled,
+eg: `hc_counter ?? counter`) which cannot be evaluated are null instead.
+*/
+func (r *variableResolver) resolve(variable string) (interface{}, error) {
+	glog.Infof("evaluating variable %q", variable)
+	step := r.trace.variable(variable)
+	var value interface{}
+	var err error
+	nocPath := r.nocPaths[variable]
+	transformation := r.o.transformations[variable]
+	switch {
+	case nocPath != nil:
+		step.nocPath(nocPath)
+		value, err = r.o.handleNocPath(nocPath, r.target, r.vendor)
+	case transformation != nil:
+		value, err = r.o.eval(transformation, r.target, r.vendor, r.lookups, step.transformation(variable))
+		if err != nil {
+			err = fmt.Errorf("could not evaluate sub-transformation %q: %v", variable, err)
+		}
+	default:
+		err = fmt.Errorf("NocPath or sub-transformation %q is undefined (NocPaths of the transformation: %v)", variable, r.defined())
+	}
+	step.finish(value, err)
+	if err != nil && r.optional[variable] {
+		glog.Infof("optional variable %q is null: %v", variable, err)
+		value, err = nil, nil
+	}
+	if err != nil {
+		if r.err == nil {
+			r.err = err
 		}
-		glog.Infof("evaluated variable %q = %v", variable, value)
-		values[variable] = value
+		return nil, err
+	}
+	glog.Infof("evaluated variable %q = %v", variable, value)
+	return value, nil
+}
+
+// defined returns a sorted, comma-separated list of the binds of the NocPaths of the transformation.
+func (r *variableResolver) defined() string {
+	var binds []string
+	for bind := range r.nocPaths {
+		binds = append(binds, bind)
+	}
+	if len(binds) == 0 {
+		return "none"
 	}
-	return values, nil
+	sort.Strings(binds)
+	return strings.Join(binds, ", ")
 }
 
 // Gets a value for the given NocPath for the given target.
@@ -240,7 +718,11 @@ func (o *Orismologer) handleNocPath(nocPath *pb.NocPath, target string, vendor s
 			fmt.Sprintf("ignoring NocPath %q as it cannot be resolved for vendor %q", pathName, vendor),
 		}
 	}
-	value, err := o.nocPathResolver(nocPath, target)
+	resolver := o.nocPathResolver
+	if r, ok := o.resolvers[o.vendors.vendor(vendor)]; ok {
+		resolver = r
+	}
+	value, err := resolver(nocPath, target)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve NocPath %q for target %q (this NocPath should normally be resolvable for this target): %v", pathName, target, err)
 	}
@@ -255,23 +737,22 @@ func (f unresolvableNocPathError) Error() string {
 	return f.msg
 }
 
-// canResolve returns true if the given target supports the given NocPath.
+// canResolve returns true if the given vendor (or model) supports the given NocPath.
 func (o *Orismologer) canResolve(nocPath *pb.NocPath, vendor string) bool {
 	// NB: Currently assumes NocPaths are OIDs only.
-	vendorRoot := o.vendorInfo.GetVendorRoot()
-	for _, oid := range nocPath.GetOids() {
-		if !strings.HasPrefix(oid, vendorRoot) {
-			return true
-		}
-		vendorOid, ok := o.vendorInfo.GetVendors()[vendor]
-		if !ok {
-			return false
-		}
-		if strings.HasPrefix(oid, vendorRoot+"."+vendorOid) {
-			return true
-		}
+	return o.vendors.canResolve(nocPath.GetOids(), vendor)
+}
+
+/*
+Model returns the name and vendor of the hardware model which reports the given sysObjectID, as
+defined in the VendorOids proto. The model name can be passed to Eval in place of a vendor name.
+*/
+func (o *Orismologer) Model(sysObjectID string) (model string, vendor string, err error) {
+	model, vendor, ok := o.vendors.model(sysObjectID)
+	if !ok {
+		return "", "", fmt.Errorf("no model registered for sysObjectID %q", sysObjectID)
 	}
-	return false
+	return model, vendor, nil
 }
 
 /*
@@ -18,11 +18,18 @@ package orismologer
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/functions"
+	"github.com/google/orismologer/mib"
+	"github.com/google/orismologer/oparse"
 	"github.com/google/orismologer/utils"
 
 	pb "github.com/google/orismologer/proto_out/proto"
@@ -91,6 +98,62 @@ func TestCanResolve(t *testing.T) {
 			target:   "aruba",
 			expected: true,
 		},
+		{
+			name: "enterprise number is a prefix of another",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.99.1"},
+			},
+			target:   "cisco",
+			expected: false,
+		},
+		{
+			name: "nested enterprise arc",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.11.2.14.11.5.1.9.6.1"},
+			},
+			target:   "aruba",
+			expected: true,
+		},
+		{
+			name: "sibling of nested enterprise arc",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.11.2.3.1"},
+			},
+			target:   "aruba",
+			expected: false,
+		},
+		{
+			name: "model inherits vendor OIDs",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.14823.2.2.1.2.1.6"},
+			},
+			target:   "aruba-7200",
+			expected: true,
+		},
+		{
+			name: "model lacks vendor OID",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.14823.2.2.1.20.1"},
+			},
+			target:   "aruba-7200",
+			expected: false,
+		},
+		{
+			name: "model restricted to supported arcs",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.9.9.48.1.1.1.5.1"},
+			},
+			target:   "cisco-asr",
+			expected: false,
+		},
+		{
+			name: "model supported arc",
+			nocPath: &pb.NocPath{
+				Oids: []string{"1.3.6.1.4.1.9.9.168.1.1.10"},
+			},
+			target:   "cisco-asr",
+			expected: true,
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			if got, want := o.canResolve(test.nocPath, test.target), test.expected; got != want {
@@ -100,6 +163,89 @@ func TestCanResolve(t *testing.T) {
 	}
 }
 
+func TestModel(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, test := range []struct {
+		sysObjectID    string
+		expectedModel  string
+		expectedVendor string
+		expectsError   bool
+	}{
+		{
+			sysObjectID:    "1.3.6.1.4.1.14823.1.1.32",
+			expectedModel:  "aruba-7200",
+			expectedVendor: "aruba",
+		},
+		{
+			sysObjectID:    ".1.3.6.1.4.1.9.1.1639",
+			expectedModel:  "cisco-asr",
+			expectedVendor: "cisco",
+		},
+		{
+			sysObjectID:  "1.3.6.1.4.1.9.1.1",
+			expectsError: true,
+		},
+	} {
+		t.Run(test.sysObjectID, func(t *testing.T) {
+			model, vendor, err := o.Model(test.sysObjectID)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Model(%q) got error: %v", test.sysObjectID, err)
+			case err == nil && test.expectsError:
+				t.Errorf("Model(%q) = %q, %q, expected error", test.sysObjectID, model, vendor)
+			case model != test.expectedModel || vendor != test.expectedVendor:
+				t.Errorf("Model(%q) = %q, %q, expected %q, %q", test.sysObjectID, model, vendor, test.expectedModel, test.expectedVendor)
+			}
+		})
+	}
+}
+
+func TestNewVendorRegistryErrors(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		vendorOids *pb.VendorOids
+	}{
+		{
+			name: "model of unknown vendor",
+			vendorOids: &pb.VendorOids{
+				Models: []*pb.DeviceModel{{Name: "m", Vendor: "unknown"}},
+			},
+		},
+		{
+			name: "model clashes with vendor",
+			vendorOids: &pb.VendorOids{
+				Vendors: map[string]string{"cisco": "9"},
+				Models:  []*pb.DeviceModel{{Name: "cisco", Vendor: "cisco"}},
+			},
+		},
+		{
+			name: "duplicate sysObjectID",
+			vendorOids: &pb.VendorOids{
+				Vendors: map[string]string{"cisco": "9"},
+				Models: []*pb.DeviceModel{
+					{Name: "a", Vendor: "cisco", SysObjectIds: []string{"1.2.3"}},
+					{Name: "b", Vendor: "cisco", SysObjectIds: []string{"1.2.3"}},
+				},
+			},
+		},
+		{
+			name: "arcs for unknown vendor",
+			vendorOids: &pb.VendorOids{
+				VendorArcs: map[string]*pb.EnterpriseArcs{"unknown": {Arcs: []string{"1"}}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newVendorRegistry(test.vendorOids); err == nil {
+				t.Errorf("newVendorRegistry() expected error, got none")
+			}
+		})
+	}
+}
+
 func TestGetNocPaths(t *testing.T) {
 	o, err := makeTestOrismologer()
 	if err != nil {
@@ -195,7 +341,7 @@ func TestEval(t *testing.T) {
 		testName := test.transformationName + "_" + test.vendor
 		t.Run(testName, func(t *testing.T) {
 			transformation := o.transformations[test.transformationName]
-			got, err := o.eval(transformation, "target", test.vendor)
+			got, err := o.eval(transformation, "target", test.vendor, nil, nil)
 			switch {
 			case err != nil && !test.expectsError:
 				t.Errorf("eval(), got error: %v", err)
@@ -208,7 +354,493 @@ func TestEval(t *testing.T) {
 	}
 }
 
+func TestEvalOptionalVariables(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	// cpu_name is only supported for aruba.
+	o.transformations["cpu_label"] = &pb.Transformation{
+		Bind:        "cpu_label",
+		Expressions: []string{"cpu_name ?? 'unknown'"},
+	}
+	o.transformations["cpu_label_or_next"] = &pb.Transformation{
+		Bind:        "cpu_label_or_next",
+		Expressions: []string{"cpu_name ?? null", "'next'"},
+	}
+	o.transformations["cpu_label_try"] = &pb.Transformation{
+		Bind:        "cpu_label_try",
+		Expressions: []string{"try cpu_name + '' else 'unknown'"},
+	}
+	o.transformations["cpu_label_required"] = &pb.Transformation{
+		Bind:        "cpu_label_required",
+		Expressions: []string{"(cpu_name ?? 'unknown') + cpu_name"},
+	}
+	for _, test := range []struct {
+		transformationName string
+		vendor             string
+		expected           interface{}
+		expectsError       bool
+	}{
+		{transformationName: "cpu_label", vendor: "aruba", expected: "Network Processor CPU10"},
+		{transformationName: "cpu_label", vendor: "cisco", expected: "unknown"},
+		{transformationName: "cpu_label_or_next", vendor: "aruba", expected: "Network Processor CPU10"},
+		{transformationName: "cpu_label_or_next", vendor: "cisco", expected: "next"},
+		{transformationName: "cpu_label_try", vendor: "aruba", expected: "Network Processor CPU10"},
+		{transformationName: "cpu_label_try", vendor: "cisco", expected: "unknown"},
+		{transformationName: "cpu_label_required", vendor: "cisco", expectsError: true},
+	} {
+		t.Run(test.transformationName+"_"+test.vendor, func(t *testing.T) {
+			transformation := o.transformations[test.transformationName]
+			got, err := o.eval(transformation, "target", test.vendor, nil, nil)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("eval(), got error: %v", err)
+			case err == nil && test.expectsError:
+				t.Errorf("eval(), expected error, got: %v", got)
+			case err == nil && !test.expectsError && !cmp.Equal(got, test.expected):
+				t.Errorf("eval() = %v, expected: %v", got, test.expected)
+			}
+			if supported := o.supported(transformation, test.vendor, map[string]bool{}); supported == test.expectsError {
+				t.Errorf("supported() = %v, expected %v", supported, !test.expectsError)
+			}
+		})
+	}
+}
+
+func TestEvalLazyVariables(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	// cpu_name is only supported for aruba, so it must not be resolved for cisco.
+	o.transformations["cpu_label_lazy"] = &pb.Transformation{
+		Bind:        "cpu_label_lazy",
+		Expressions: []string{"vendor == 'aruba' ? cpu_name : 'unknown'"},
+		NocPaths:    []*pb.NocPath{{Bind: "vendor", Oids: []string{"1.3.6.1.2.1.1.1.0"}, Samples: []string{"cisco"}}},
+	}
+	trace := newTransformationTrace("cpu_label_lazy")
+	got, err := o.eval(o.transformations["cpu_label_lazy"], "target", "cisco", nil, trace)
+	if err != nil || got != "unknown" {
+		t.Fatalf("eval() = %v, %v, expected unknown", got, err)
+	}
+	var resolved []string
+	for _, v := range trace.Expressions[0].Variables {
+		resolved = append(resolved, v.Name)
+	}
+	if expected := []string{"vendor"}; !cmp.Equal(resolved, expected) {
+		t.Errorf("eval() resolved %v, expected %v", resolved, expected)
+	}
+}
+
+func TestEvalUndefinedVariable(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	o.transformations["cpu_label_typo"] = &pb.Transformation{
+		Bind:        "cpu_label_typo",
+		Expressions: []string{"vendro + ': ' + model"},
+		NocPaths: []*pb.NocPath{
+			{Bind: "vendor", Oids: []string{"1.3.6.1.2.1.1.1.0"}, Samples: []string{"cisco"}},
+			{Bind: "model", Oids: []string{"1.3.6.1.2.1.47.1.1.1.1.13.1"}, Samples: []string{"ASR9K"}},
+		},
+	}
+	trace := newTransformationTrace("cpu_label_typo")
+	if got, err := o.eval(o.transformations["cpu_label_typo"], "target", "cisco", nil, trace); err == nil {
+		t.Fatalf("eval() = %v, expected error", got)
+	}
+	expected := `NocPath or sub-transformation "vendro" is undefined (NocPaths of the transformation: model, vendor)`
+	if got := trace.Expressions[0].Error; !strings.Contains(got, expected) {
+		t.Errorf("eval() traced error %q, expected it to contain %q", got, expected)
+	}
+}
+
+func TestSetResolver(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	var targets []string
+	o.SetResolver(func(nocPath *pb.NocPath, target string) (interface{}, error) {
+		targets = append(targets, target)
+		return "Route Processor CPU0", nil
+	})
+	got, err := o.eval(o.transformations["cpu_name"], "router", "aruba", nil, nil)
+	if err != nil {
+		t.Fatalf("eval() got error: %v", err)
+	}
+	if got != "Route Processor CPU0" {
+		t.Errorf("eval() = %v, expected the resolver's value", got)
+	}
+	if !cmp.Equal(targets, []string{"router"}) {
+		t.Errorf("resolver was called for targets %v, expected [router]", targets)
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if o.evalOptions.Limits != oparse.DefaultLimits {
+		t.Errorf("limits = %+v, expected the defaults %+v", o.evalOptions.Limits, oparse.DefaultLimits)
+	}
+	o.SetLimits(oparse.Limits{Timeout: time.Nanosecond})
+	// Expressions calling functions take longer than a nanosecond.
+	if got, err := o.eval(o.transformations["boot_time"], "target", "cisco", nil, nil); err == nil {
+		t.Errorf("eval() = %v, expected error", got)
+	}
+	if _, err := o.eval(o.transformations["cpu_name"], "target", "aruba", nil, nil); err != nil {
+		t.Errorf("eval() got error: %v", err)
+	}
+}
+
+func TestSetArithmetic(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	for _, test := range []struct {
+		arithmetic oparse.Arithmetic
+		expected   interface{}
+	}{
+		{arithmetic: oparse.FloatArithmetic, expected: 20000000.0},
+		{arithmetic: oparse.IntegerArithmetic, expected: int64(20000000)},
+		{arithmetic: oparse.BigArithmetic, expected: int64(20000000)},
+	} {
+		o.SetArithmetic(test.arithmetic)
+		got, err := o.eval(o.transformations["system_up_time"], "target", "cisco", nil, nil)
+		if err != nil {
+			t.Errorf("eval() with arithmetic %v got error: %v", test.arithmetic, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("eval() with arithmetic %v = %v (%T), expected %v (%T)", test.arithmetic, got, got, test.expected, test.expected)
+		}
+	}
+}
+
+func TestSetConstants(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	o.transformations["system_up_time_kilo"] = &pb.Transformation{
+		Bind:        "system_up_time_kilo",
+		Expressions: []string{"system_up_time / (KILO * UNITS.s)"},
+	}
+	transformation := o.transformations["system_up_time_kilo"]
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err == nil {
+		t.Errorf("eval() without constants = %v, expected error", got)
+	}
+	o.SetConstants(oparse.Context{"KILO": 1000, "UNITS": map[string]int{"s": 1}})
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err != nil || got != 20000.0 {
+		t.Errorf("eval() = %v (error %v), expected 20000", got, err)
+	}
+	if !o.supported(transformation, "cisco", map[string]bool{}) {
+		t.Errorf("supported() = false, expected true")
+	}
+}
+
+func TestSetNumberFormat(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	o.transformations["system_up_time_text"] = &pb.Transformation{
+		Bind:        "system_up_time_text",
+		Expressions: []string{"system_up_time + ' ticks'"},
+	}
+	transformation := o.transformations["system_up_time_text"]
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err != nil || got != "2e+07 ticks" {
+		t.Errorf("eval() = %v (error %v), expected 2e+07 ticks", got, err)
+	}
+	o.SetNumberFormat(oparse.NumberFormat{Verb: 'f', Precision: -1})
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err != nil || got != "20000000 ticks" {
+		t.Errorf("eval() = %v (error %v), expected 20000000 ticks", got, err)
+	}
+}
+
+func TestSetFunctions(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	o.transformations["system_up_time_doubled"] = &pb.Transformation{
+		Bind:        "system_up_time_doubled",
+		Expressions: []string{"double(system_up_time)"},
+	}
+	transformation := o.transformations["system_up_time_doubled"]
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err == nil {
+		t.Errorf("eval() of an undefined function = %v, expected error", got)
+	}
+	library, err := functions.NewLibrary().With(map[string]interface{}{
+		"double": func(f float64) float64 { return 2 * f },
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if err := o.SetFunctions(library); err != nil {
+		t.Fatalf("SetFunctions() got error: %v", err)
+	}
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err != nil || got != 40000000.0 {
+		t.Errorf("eval() = %v (error %v), expected 40000000", got, err)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	o, err := makeTestOrismologer()
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	script := filepath.Join(t.TempDir(), "ticks.star")
+	if err := ioutil.WriteFile(script, []byte("def ticks(t):\n    return '%d ticks' % int(t)\n"), 0644); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	o.scripts = []string{script}
+	o.transformations["system_up_time_ticks"] = &pb.Transformation{
+		Bind:        "system_up_time_ticks",
+		Expressions: []string{"ticks(t=system_up_time)"},
+	}
+	transformation := o.transformations["system_up_time_ticks"]
+	if err := o.SetFunctions(functions.NewLibrary()); err != nil {
+		t.Fatalf("SetFunctions() got error: %v", err)
+	}
+	if got, err := o.eval(transformation, "target", "cisco", nil, nil); err != nil || got != "20000000 ticks" {
+		t.Errorf("eval() = %v (error %v), expected 20000000 ticks", got, err)
+	}
+
+	// Scripts' functions must not clash with the library's.
+	library, err := functions.NewLibrary().With(map[string]interface{}{
+		"ticks": func(s string) string { return s },
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if err := o.SetFunctions(library); err == nil {
+		t.Errorf("SetFunctions() of a library clashing with a script got no error, expected an error")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/up-time"}, Bind: "system_up_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/up-time-ms"}, Bind: "up_time_ms"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/fallback"}, Bind: "fallback"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/self"}, Bind: "self"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/a"}, Bind: "a"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/b"}, Bind: "b"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/c"}, Bind: "c"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	for name, expression := range map[string]string{
+		"up_time_ms": "lookup('/system/state/up-time') * 1000",
+		"fallback":   "try lookup('/system/state/unmapped') else -1",
+		"self":       "lookup('/system/state/self')",
+		"a":          "lookup('/system/state/b')",
+		"b":          "c", // Through a sub-transformation.
+		"c":          "lookup('/system/state/a')",
+	} {
+		o.transformations[name] = &pb.Transformation{Bind: name, Expressions: []string{expression}}
+	}
+	for _, test := range []struct {
+		path          string
+		expected      interface{}
+		expectedError string
+	}{
+		{path: "/system/state/up-time-ms", expected: 20000000000.0},
+		{path: "/system/state/fallback", expected: -1.0},
+		{path: "/system/state/self", expectedError: "circular lookup"},
+		// The circular lookup fails sub-transformation c, so b has no expression which can be evaluated.
+		{path: "/system/state/a", expectedError: `transformation "b" could be evaluated`},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			got, err := o.Eval(test.path, "target", "cisco")
+			switch {
+			case err != nil && (test.expectedError == "" || !strings.Contains(err.Error(), test.expectedError)):
+				t.Errorf("Eval() got error: %v, expected error: %v", err, test.expectedError)
+			case err == nil && test.expectedError != "":
+				t.Errorf("Eval() = %v, expected error: %v", got, test.expectedError)
+			case err == nil && got != test.expected:
+				t.Errorf("Eval() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+
+	_, trace, err := o.EvalWithTrace("/system/state/up-time-ms", "target", "cisco")
+	if err != nil {
+		t.Fatalf("EvalWithTrace() got error: %v", err)
+	}
+	step := trace.Transformation.Expressions[0].Variables[0]
+	if step.Name != "/system/state/up-time" || step.Source != SourceLookup || step.Value != 20000000.0 || step.Transformation.GetName() != "system_up_time" {
+		t.Errorf("EvalWithTrace() recorded lookup %+v, expected /system/state/up-time from transformation system_up_time = 20000000", step)
+	}
+	if got := trace.String(); !strings.Contains(got, "lookup /system/state/up-time (") {
+		t.Errorf("Trace.String() = %q, expected it to show the lookup", got)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/components/component/name"}, Bind: "cpu_name"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/memory/state/physical"}, Bind: "total_memory_B"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/memory/state/unbound"}, Bind: "undefined"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	for _, test := range []struct {
+		path         string
+		vendor       string
+		expected     bool
+		expectsError bool
+	}{
+		{path: "/components/component/name", vendor: "aruba", expected: true},
+		{path: "/components/component/name", vendor: "cisco", expected: false},
+		{path: "/system/state/boot-time", vendor: "cisco", expected: true},
+		{path: "/system/state/boot-time", vendor: "unknown", expected: false},
+		// Cisco's expression calls an undefined function.
+		{path: "/system/memory/state/physical", vendor: "cisco", expected: false},
+		{path: "/system/memory/state/physical", vendor: "aruba", expected: true},
+		{path: "/system/memory/state/unbound", vendor: "aruba", expectsError: true},
+		{path: "/invalid", vendor: "aruba", expectsError: true},
+	} {
+		t.Run(test.path+"_"+test.vendor, func(t *testing.T) {
+			got, err := o.Supported(test.path, test.vendor)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Supported() got error: %v", err)
+			case err == nil && test.expectsError:
+				t.Errorf("Supported() = %v, expected error", got)
+			case got != test.expected:
+				t.Errorf("Supported() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestPathsForOid(t *testing.T) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/up-time"}, Bind: "system_up_time"},
+			{
+				Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface[name=name_value]/state/last-change"},
+				Bind:    "last_change_absolute",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	for _, test := range []struct {
+		oid      string
+		expected []string
+	}{
+		// Last change is derived from boot time, which is derived from the system time and sysUpTime.
+		{oid: "1.3.6.1.4.1.9.9.168.1.1.10.0", expected: []string{"/interfaces/interface[name=name_value]/state/last-change", "/system/state/boot-time"}},
+		{oid: "1.3.6.1.2.1.2.2.1.9", expected: []string{"/interfaces/interface[name=name_value]/state/last-change"}},
+		{oid: "1.3.6.1.2.1.1.3", expected: []string{"/interfaces/interface[name=name_value]/state/last-change", "/system/state/boot-time", "/system/state/up-time"}},
+		{oid: "1.3.6.1.2.1.1.5", expected: []string{}},
+	} {
+		if diff := cmp.Diff(test.expected, o.PathsForOid(test.oid)); diff != "" {
+			t.Errorf("PathsForOid(%q) returned unexpected paths (-expected +got):\n%v", test.oid, diff)
+		}
+	}
+}
+
+func TestResolveOids(t *testing.T) {
+	mibs := mib.New()
+	if err := mibs.LoadDir("../testdata/mibs"); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	for _, test := range []struct {
+		name         string
+		oid          string
+		mibs         *mib.MIB
+		expected     string
+		expectsError bool
+	}{
+		{name: "numeric without MIBs", oid: "1.3.6.1.2.1.2.2.1.2.index", expected: "1.3.6.1.2.1.2.2.1.2.index"},
+		{name: "symbolic without MIBs", oid: "IF-MIB::ifDescr.index", expectsError: true},
+		{name: "symbolic", oid: "IF-MIB::ifDescr.index", mibs: mibs, expected: "1.3.6.1.2.1.2.2.1.2.index"},
+		{name: "unknown object", oid: "IF-MIB::ifUnknown", mibs: mibs, expectsError: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			transformations := &pb.Transformations{
+				Transformations: []*pb.Transformation{
+					{Bind: "descr", NocPaths: []*pb.NocPath{{Bind: "descr_oid", Oids: []string{test.oid}}}},
+				},
+			}
+			err := resolveOids(transformations, test.mibs)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Fatalf("resolveOids() got error: %v", err)
+			case err == nil && test.expectsError:
+				t.Fatalf("resolveOids() succeeded, expected error")
+			case err != nil:
+				return
+			}
+			if got := transformations.GetTransformations()[0].GetNocPaths()[0].GetOids()[0]; got != test.expected {
+				t.Errorf("resolveOids() set OID %q, expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+/*
+BenchmarkEval measures full path evaluation: tree lookup, transformation selection, NocPath resolution
+with the default resolver (which replays NocPath samples), parsing and evaluation of expressions and
+library calls.
+*/
+func BenchmarkEval(b *testing.B) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/up-time"}, Bind: "system_up_time"},
+			{
+				Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface[name=name_value]/state/last-change"},
+				Bind:    "last_change_absolute",
+			},
+		},
+	})
+	if err != nil {
+		b.Fatalf("Could not set up benchmark: %v", err)
+	}
+	for _, bm := range []struct {
+		name   string
+		path   string
+		vendor string
+	}{
+		{name: "single transformation", path: "/system/state/up-time", vendor: "cisco"},
+		{name: "time conversion", path: "/system/state/boot-time", vendor: "cisco"},
+		{name: "nested transformations", path: "/interfaces/interface[name=name_value]/state/last-change", vendor: "cisco"},
+		{name: "vendor fallback", path: "/system/state/boot-time", vendor: "aruba"},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := o.Eval(bm.path, "target", bm.vendor); err != nil {
+					b.Fatalf("Eval(%q) got error: %v", bm.path, err)
+				}
+			}
+		})
+	}
+}
+
 func makeTestOrismologer() (*Orismologer, error) {
+	return makeTestOrismologerWithMappings(&pb.Mappings{})
+}
+
+func makeTestOrismologerWithMappings(mappings *pb.Mappings) (*Orismologer, error) {
 	const transformationsFile = "../testdata/orismologer_test_transformations.pb"
 	transformations, err := utils.LoadTransformations(transformationsFile)
 	if err != nil {
@@ -220,8 +852,25 @@ func makeTestOrismologer() (*Orismologer, error) {
 			"cisco": "9",
 			"aruba": "14823",
 		},
+		VendorArcs: map[string]*pb.EnterpriseArcs{
+			"aruba": {Arcs: []string{"11.2.14"}},
+		},
+		Models: []*pb.DeviceModel{
+			{
+				Name:            "aruba-7200",
+				Vendor:          "aruba",
+				SysObjectIds:    []string{"1.3.6.1.4.1.14823.1.1.32"},
+				UnsupportedArcs: []string{"14823.2.2.1.20"},
+			},
+			{
+				Name:          "cisco-asr",
+				Vendor:        "cisco",
+				SysObjectIds:  []string{"1.3.6.1.4.1.9.1.1639"},
+				SupportedArcs: []string{"9.9.168"},
+			},
+		},
 	}
-	o, err := newOrismologer(&pb.Mappings{}, transformations, vendorInfo)
+	o, err := newOrismologer(mappings, transformations, vendorInfo)
 	if err != nil {
 		return &Orismologer{}, fmt.Errorf("could not create Orismologer: %v", err)
 	}
@@ -256,11 +905,22 @@ func (l dummyLibrary) Call(funcName string, args ...interface{}) (interface{}, e
 		return args[0].(string), nil
 	case "time_since_epoch":
 		return 20000100, nil
+	case "sum":
+		sum := 0
+		for _, value := range args[0].(map[string]interface{}) {
+			i, _ := strconv.Atoi(value.(string))
+			sum += i
+		}
+		return sum, nil
 	default:
 		return nil, fmt.Errorf("function %q undefined", funcName)
 	}
 }
 
+func (l dummyLibrary) CallWithContext(cc functions.CallContext, funcName string, args ...interface{}) (interface{}, error) {
+	return l.Call(funcName, args...)
+}
+
 func (l dummyLibrary) Contains(funcName string) (contains bool) {
 	defer func() {
 		if r := recover(); r != nil {
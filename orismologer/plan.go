@@ -0,0 +1,258 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// DefaultMaxVarbinds is the number of OIDs per get PDU used if a plan is not given a limit.
+const DefaultMaxVarbinds = 32
+
+/*
+Plan is a minimal set of SNMP operations fetching every NocPath needed to evaluate some leaves for a
+target: scalar OIDs are merged into multi-varbind get PDUs, and table OIDs (those with a variable
+arc, eg: 1.3.6.1.2.1.2.2.1.9.interface_index) become walks of their columns. Walks within other walks,
+and gets within walks, are dropped.
+*/
+type Plan struct {
+	Target string     `json:"target"`
+	Vendor string     `json:"vendor"`
+	Gets   [][]string `json:"gets"`  // OIDs to get, one PDU per element.
+	Walks  []string   `json:"walks"` // Subtrees to walk, sorted.
+}
+
+/*
+BatchResolver executes plans, eg: with one SNMP request per PDU. It returns the values fetched keyed
+by OID; OIDs which could not be fetched are omitted. See Orismologer.SetBatchResolver.
+*/
+type BatchResolver interface {
+	Execute(plan *Plan) (map[string]interface{}, error)
+}
+
+/*
+SetBatchResolver sets the resolver EvalBatch feeds plans to. It must not be called concurrently
+with evaluation.
+*/
+func (o *Orismologer) SetBatchResolver(resolver BatchResolver) {
+	o.batchResolver = resolver
+}
+
+/*
+Plan computes the operations needed to evaluate the given leaves for a target. For each leaf it
+follows the first expression which is supported for the vendor (see Supported), which is the one
+evaluation will use unless fetching a value fails, and for each NocPath it takes the first OID the
+vendor supports. maxVarbinds limits the OIDs per get PDU (DefaultMaxVarbinds if not positive).
+*/
+func (o *Orismologer) Plan(leaves []string, target, vendor string, maxVarbinds int) (*Plan, error) {
+	if maxVarbinds <= 0 {
+		maxVarbinds = DefaultMaxVarbinds
+	}
+	oids := map[string]bool{}
+	for _, leaf := range leaves {
+		transformation, err := o.transformation(leaf)
+		if err != nil {
+			return nil, err
+		}
+		o.planTransformation(transformation, vendor, oids, map[string]bool{})
+	}
+
+	plan := &Plan{Target: target, Vendor: vendor}
+	var gets []string
+	for oid := range oids {
+		if column, ok := tableColumn(oid); ok {
+			plan.Walks = append(plan.Walks, column)
+		} else {
+			gets = append(gets, oid)
+		}
+	}
+	plan.Walks = outermost(plan.Walks)
+	sort.Strings(gets)
+	var pdu []string
+	for _, oid := range gets {
+		if hasAnyOidPrefix(oid, plan.Walks) {
+			continue
+		}
+		if len(pdu) == maxVarbinds {
+			plan.Gets = append(plan.Gets, pdu)
+			pdu = nil
+		}
+		pdu = append(pdu, oid)
+	}
+	if len(pdu) > 0 {
+		plan.Gets = append(plan.Gets, pdu)
+	}
+	return plan, nil
+}
+
+// planTransformation adds the OIDs of the NocPaths the transformation will be evaluated with.
+func (o *Orismologer) planTransformation(transformation *pb.Transformation, vendor string, oids map[string]bool, visiting map[string]bool) {
+	name := transformation.GetBind()
+	if visiting[name] {
+		return
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	nocPaths := o.getNocPaths(transformation)
+	for _, expressionString := range transformation.GetExpressions() {
+		compiled, err := o.parseAndValidateExpression(expressionString)
+		if err != nil || !o.supportedVariables(compiled.required, nocPaths, vendor, visiting) {
+			continue
+		}
+		for _, variable := range compiled.variables {
+			if nocPath, ok := nocPaths[variable]; ok {
+				if oid, ok := o.vendorOid(nocPath, vendor); ok {
+					oids[oid] = true
+				}
+			} else if subTransformation, ok := o.transformations[variable]; ok {
+				o.planTransformation(subTransformation, vendor, oids, visiting)
+			}
+		}
+		return
+	}
+}
+
+// vendorOid returns the first of a NocPath's OIDs supported by the vendor.
+func (o *Orismologer) vendorOid(nocPath *pb.NocPath, vendor string) (string, bool) {
+	for _, oid := range nocPath.GetOids() {
+		if o.vendors.canResolve([]string{oid}, vendor) {
+			return oid, true
+		}
+	}
+	return "", false
+}
+
+/*
+tableColumn returns the column of a table OID, ie: its arcs up to the first which is a variable
+rather than a number.
+*/
+func tableColumn(oid string) (string, bool) {
+	arcs := strings.Split(oid, ".")
+	for i, arc := range arcs {
+		if strings.Trim(arc, "0123456789") != "" || arc == "" {
+			return strings.Join(arcs[:i], "."), true
+		}
+	}
+	return "", false
+}
+
+// outermost returns the given OID subtrees, sorted, without those contained by others.
+func outermost(subtrees []string) []string {
+	sort.Strings(subtrees)
+	var result []string
+	for _, subtree := range subtrees {
+		if !hasAnyOidPrefix(subtree, result) {
+			result = append(result, subtree)
+		}
+	}
+	return result
+}
+
+/*
+EvalBatch evaluates leaves for a target with a single plan (see Plan) executed by the batch resolver,
+rather than resolving each NocPath separately. NocPaths are resolved from the values fetched, by the
+first of their OIDs which was fetched (see fetchedValue): a table NocPath resolves to the rows walked
+of its column, keyed by index. Values are keyed by leaf, as are the errors of leaves which could not
+be evaluated; err is only set if the plan could not be made or executed. Without a batch resolver,
+each leaf is evaluated by Eval.
+*/
+func (o *Orismologer) EvalBatch(leaves []string, target, vendor string) (values map[string]interface{}, errs map[string]error, err error) {
+	results, errs, err := o.EvalBatchResults(leaves, target, vendor)
+	if err != nil {
+		return nil, nil, err
+	}
+	values = map[string]interface{}{}
+	for leaf, result := range results {
+		values[leaf] = result.Value
+	}
+	return values, errs, nil
+}
+
+/*
+EvalBatchResults is like EvalBatch, but returns the leaves' values with any tags added by
+post-processors (see EvalResult). Leaves dropped by post-processors have the error ErrDropped.
+*/
+func (o *Orismologer) EvalBatchResults(leaves []string, target, vendor string) (results map[string]*Result, errs map[string]error, err error) {
+	results, errs = map[string]*Result{}, map[string]error{}
+	evaluator := o
+	if o.batchResolver != nil {
+		plan, err := o.Plan(leaves, target, vendor, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		fetched, err := o.batchResolver.Execute(plan)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not execute plan for target %q: %v", target, err)
+		}
+		// A copy of this instance resolving NocPaths from the values fetched, in place of any other resolver.
+		batch := *o
+		batch.resolvers = nil
+		batch.nocPathResolver = func(nocPath *pb.NocPath, target string) (interface{}, error) {
+			for _, oid := range nocPath.GetOids() {
+				if value, ok := fetchedValue(oid, fetched); ok {
+					return value, nil
+				}
+			}
+			return nil, fmt.Errorf("no value was fetched for any of the OIDs %v", nocPath.GetOids())
+		}
+		evaluator = &batch
+	}
+	for _, leaf := range leaves {
+		result, err := evaluator.EvalResult(leaf, target, vendor)
+		if err != nil {
+			errs[leaf] = err
+			continue
+		}
+		results[leaf] = result
+	}
+	return results, errs, nil
+}
+
+/*
+fetchedValue returns the value fetched for an OID. The value of a table OID (eg:
+1.3.6.1.2.1.2.2.1.9.interface_index) is a map of the instances walked of its column, keyed by their
+indices, ie: the arcs the index variable stands for, eg: "3" for 1.3.6.1.2.1.2.2.1.9.3. Any arcs after
+the variable (eg: 1.3.6.1.2.1.2.2.1.9.index.1) must match the end of an instance, and are not part of
+its index. ok is false if nothing was fetched for the OID.
+*/
+func fetchedValue(oid string, fetched map[string]interface{}) (interface{}, bool) {
+	column, ok := tableColumn(oid)
+	if !ok {
+		value, ok := fetched[oid]
+		return value, ok
+	}
+	// The arcs after the index variable, if any, eg: ".1".
+	suffix := ""
+	if rest := strings.SplitN(strings.TrimPrefix(oid, column+"."), ".", 2); len(rest) == 2 {
+		suffix = "." + rest[1]
+	}
+	rows := map[string]interface{}{}
+	for instance, value := range fetched {
+		if !strings.HasPrefix(instance, column+".") || !strings.HasSuffix(instance, suffix) {
+			continue
+		}
+		if index := strings.TrimSuffix(strings.TrimPrefix(instance, column+"."), suffix); index != "" {
+			rows[index] = value
+		}
+	}
+	return rows, len(rows) > 0
+}
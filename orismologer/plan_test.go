@@ -0,0 +1,245 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func makePlanTestOrismologer(t *testing.T) *Orismologer {
+	t.Helper()
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/components/component/name"}, Bind: "cpu_name"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/up-time"}, Bind: "system_up_time"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/memory/state/physical"}, Bind: "total_memory_B"},
+			{Subpath: &pb.OpenConfigPath{Path: "/interfaces/interface/state/last-change"}, Bind: "last_change_absolute"},
+			{Subpath: &pb.OpenConfigPath{Path: "/system/cpus/state/load-sum"}, Bind: "cpu_load_sum"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	// A leaf aggregating a table column: hrProcessorLoad, indexed by hrDeviceIndex.
+	o.transformations["cpu_load_sum"] = &pb.Transformation{
+		Bind:        "cpu_load_sum",
+		Expressions: []string{"sum(cpu_loads)"},
+		NocPaths:    []*pb.NocPath{{Bind: "cpu_loads", Oids: []string{"1.3.6.1.2.1.25.3.3.1.2.device_index"}}},
+	}
+	return o
+}
+
+func TestPlan(t *testing.T) {
+	o := makePlanTestOrismologer(t)
+	for _, test := range []struct {
+		name         string
+		leaves       []string
+		vendor       string
+		maxVarbinds  int
+		expected     *Plan
+		expectsError bool
+	}{
+		{
+			name:   "scalars share a PDU",
+			leaves: []string{"/system/state/boot-time", "/system/state/up-time"},
+			vendor: "cisco",
+			expected: &Plan{
+				Target: "target",
+				Vendor: "cisco",
+				// The up time is needed by both leaves, but fetched once.
+				Gets: [][]string{{"1.3.6.1.2.1.1.3", "1.3.6.1.4.1.9.9.168.1.1.10"}},
+			},
+		},
+		{
+			name: "PDUs are limited",
+			leaves: []string{
+				"/components/component/name",
+				"/system/state/boot-time",
+				"/system/memory/state/physical",
+				"/interfaces/interface/state/last-change",
+			},
+			vendor:      "aruba",
+			maxVarbinds: 2,
+			expected: &Plan{
+				Target: "target",
+				Vendor: "aruba",
+				Gets: [][]string{
+					{"1.3.6.1.2.1.1.3", "1.3.6.1.4.1.14823.2.2.1.1.1.11.1.2"},
+					{"1.3.6.1.4.1.14823.2.2.1.2.1.6"},
+				},
+				Walks: []string{"1.3.6.1.2.1.2.2.1.9", "1.3.6.1.4.1.14823.2.2.1.1.1.9.1.2"},
+			},
+		},
+		{
+			name:     "unsupported leaf",
+			leaves:   []string{"/components/component/name"},
+			vendor:   "cisco",
+			expected: &Plan{Target: "target", Vendor: "cisco"},
+		},
+		{
+			name:         "unmapped leaf",
+			leaves:       []string{"/unmapped"},
+			vendor:       "cisco",
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := o.Plan(test.leaves, "target", test.vendor, test.maxVarbinds)
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("Plan() = %+v, expected error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Plan() got error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("Plan() returned unexpected plan (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTableColumn(t *testing.T) {
+	for _, test := range []struct {
+		oid      string
+		expected string
+		isTable  bool
+	}{
+		{oid: "1.3.6.1.2.1.1.3", isTable: false},
+		{oid: "1.3.6.1.2.1.2.2.1.9.interface_index", expected: "1.3.6.1.2.1.2.2.1.9", isTable: true},
+		{oid: "1.3.6.1.2.1.2.2.1.9.index.1", expected: "1.3.6.1.2.1.2.2.1.9", isTable: true},
+	} {
+		got, isTable := tableColumn(test.oid)
+		if got != test.expected || isTable != test.isTable {
+			t.Errorf("tableColumn(%q) = %q, %v, expected %q, %v", test.oid, got, isTable, test.expected, test.isTable)
+		}
+	}
+}
+
+func TestOutermost(t *testing.T) {
+	got := outermost([]string{"1.3.6.1.2.1.2.2.1.9", "1.3.6.1.2.1.2.2", "1.3.6.1.2.1.2.20", "1.3.6.1.2.1.2.2"})
+	expected := []string{"1.3.6.1.2.1.2.2", "1.3.6.1.2.1.2.20"}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("outermost() returned unexpected subtrees (-expected +got):\n%s", diff)
+	}
+}
+
+// fakeBatchResolver returns fixed values, and records the plans it executes.
+type fakeBatchResolver struct {
+	values map[string]interface{}
+	err    error
+	plans  []*Plan
+}
+
+func (r *fakeBatchResolver) Execute(plan *Plan) (map[string]interface{}, error) {
+	r.plans = append(r.plans, plan)
+	return r.values, r.err
+}
+
+func TestEvalBatch(t *testing.T) {
+	o := makePlanTestOrismologer(t)
+	o.SetResolver(func(nocPath *pb.NocPath, target string) (interface{}, error) {
+		return nil, errors.New("NocPaths should be resolved from the batch")
+	})
+	resolver := &fakeBatchResolver{values: map[string]interface{}{
+		"1.3.6.1.2.1.1.3":               "1000",
+		"1.3.6.1.4.1.14823.2.2.1.2.1.6": "2018-12-18 15:15:59",
+		// Instances walked of the column of hrProcessorLoad.
+		"1.3.6.1.2.1.25.3.3.1.2.196608": "10",
+		"1.3.6.1.2.1.25.3.3.1.2.196609": "21",
+	}}
+	o.SetBatchResolver(resolver)
+	leaves := []string{"/system/state/up-time", "/system/state/boot-time", "/system/memory/state/physical", "/system/cpus/state/load-sum"}
+	values, errs, err := o.EvalBatch(leaves, "ap1", "aruba")
+	if err != nil {
+		t.Fatalf("EvalBatch() got error: %v", err)
+	}
+	if len(resolver.plans) != 1 {
+		t.Errorf("EvalBatch() executed %d plans, expected 1", len(resolver.plans))
+	} else if walks := resolver.plans[0].Walks; !cmp.Equal(walks, []string{"1.3.6.1.2.1.25.3.3.1.2"}) {
+		t.Errorf("EvalBatch() executed a plan walking %v, expected the column of the CPU loads", walks)
+	}
+	expected := map[string]interface{}{
+		"/system/state/up-time":       10.0,
+		"/system/state/boot-time":     20000090.0,
+		"/system/cpus/state/load-sum": 31.0,
+	}
+	if diff := cmp.Diff(expected, values); diff != "" {
+		t.Errorf("EvalBatch() returned unexpected values (-expected +got):\n%s", diff)
+	}
+	if _, ok := errs["/system/memory/state/physical"]; !ok || len(errs) != 1 {
+		t.Errorf("EvalBatch() returned errors %v, expected one for the leaf which was not fetched", errs)
+	}
+
+	resolver.err = errors.New("timeout")
+	if _, _, err := o.EvalBatch(leaves, "ap1", "aruba"); err == nil {
+		t.Errorf("EvalBatch() with failing resolver expected error, got none")
+	}
+}
+
+func TestFetchedValue(t *testing.T) {
+	fetched := map[string]interface{}{
+		"1.3.6.1.2.1.1.3":          "1000",
+		"1.3.6.1.2.1.2.2.1.9.1":    "50",
+		"1.3.6.1.2.1.2.2.1.9.2":    "60",
+		"1.3.6.1.2.1.2.2.1.10.1":   "70", // Another column.
+		"1.3.6.1.2.1.4.20.1.2.1.2": "3",  // An index of several arcs.
+		"1.3.6.1.2.1.4.20.1.2.1.3": "4",
+	}
+	for _, test := range []struct {
+		oid      string
+		expected interface{}
+		ok       bool
+	}{
+		{oid: "1.3.6.1.2.1.1.3", expected: "1000", ok: true},
+		{oid: "1.3.6.1.2.1.1.5"},
+		{oid: "1.3.6.1.2.1.2.2.1.9.interface_index", expected: map[string]interface{}{"1": "50", "2": "60"}, ok: true},
+		{oid: "1.3.6.1.2.1.4.20.1.2.address", expected: map[string]interface{}{"1.2": "3", "1.3": "4"}, ok: true},
+		{oid: "1.3.6.1.2.1.4.20.1.2.prefix.3", expected: map[string]interface{}{"1": "4"}, ok: true},
+		{oid: "1.3.6.1.2.1.2.2.1.11.interface_index"},
+	} {
+		got, ok := fetchedValue(test.oid, fetched)
+		if ok != test.ok {
+			t.Errorf("fetchedValue(%q) returned ok %v, expected %v", test.oid, ok, test.ok)
+		} else if ok {
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("fetchedValue(%q) returned unexpected value (-expected +got):\n%s", test.oid, diff)
+			}
+		}
+	}
+}
+
+func TestEvalBatchWithoutBatchResolver(t *testing.T) {
+	o := makePlanTestOrismologer(t)
+	values, errs, err := o.EvalBatch([]string{"/system/state/up-time", "/components/component/name"}, "switch1", "cisco")
+	if err != nil {
+		t.Fatalf("EvalBatch() got error: %v", err)
+	}
+	if values["/system/state/up-time"] != 20000000.0 {
+		t.Errorf("EvalBatch() = %v, expected the up time from its sample", values)
+	}
+	if _, ok := errs["/components/component/name"]; !ok {
+		t.Errorf("EvalBatch() returned errors %v, expected one for the unsupported leaf", errs)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/orismologer/oparse"
+)
+
+/*
+ErrDropped is returned when a post-processor drops a leaf's value. Dropping is deliberate, so callers
+streaming values should skip the leaf silently (see errors.Is), rather than report a failure.
+*/
+var ErrDropped = errors.New("value dropped by post-processor")
+
+// Result is a leaf value produced by evaluation, as seen and modified by post-processors.
+type Result struct {
+	Path   string
+	Target string
+	Vendor string
+	Value  interface{}
+	Tags   map[string]string // Annotations added by post-processors, eg: a site or data classification.
+}
+
+// Tag sets a tag of the result.
+func (r *Result) Tag(key, value string) {
+	if r.Tags == nil {
+		r.Tags = map[string]string{}
+	}
+	r.Tags[key] = value
+}
+
+/*
+Typed returns the value with its kind (eg: to tell integers from floats when encoding a leaf). An error
+is returned if the value is not of a kind produced by expressions.
+*/
+func (r *Result) Typed() (oparse.Result, error) {
+	return oparse.NewResult(r.Value)
+}
+
+/*
+PostProcessor is invoked for each leaf value after it is produced and before it is returned or
+streamed. It may transform the value, tag it, or drop it (by returning false), allowing site-specific
+redaction, rounding or enrichment without modifying transformations.
+*/
+type PostProcessor interface {
+	Process(result *Result) (keep bool, err error)
+}
+
+// PostProcessorFunc adapts a function to the PostProcessor interface.
+type PostProcessorFunc func(result *Result) (bool, error)
+
+// Process implements PostProcessor.
+func (f PostProcessorFunc) Process(result *Result) (bool, error) {
+	return f(result)
+}
+
+/*
+AddPostProcessor appends post-processors, which run in the order added. It must not be called
+concurrently with evaluation.
+*/
+func (o *Orismologer) AddPostProcessor(processors ...PostProcessor) {
+	o.postProcessors = append(o.postProcessors, processors...)
+}
+
+/*
+EvalResult is like Eval, but returns the leaf's value with any tags added by post-processors. If a
+post-processor drops the value, ErrDropped is returned.
+*/
+func (o *Orismologer) EvalResult(openConfigPath, target, vendor string) (*Result, error) {
+	transformation, err := o.transformation(openConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return o.evalLeaf(transformation, openConfigPath, target, vendor, nil)
+}
+
+// postProcess runs the post-processors over a result.
+func (o *Orismologer) postProcess(result *Result) (*Result, error) {
+	for _, processor := range o.postProcessors {
+		keep, err := processor.Process(result)
+		if err != nil {
+			return nil, fmt.Errorf("could not post-process %q for target %q: %v", result.Path, result.Target, err)
+		}
+		if !keep {
+			return nil, ErrDropped
+		}
+	}
+	return result, nil
+}
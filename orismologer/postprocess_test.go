@@ -0,0 +1,135 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/oparse"
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestPostProcessors(t *testing.T) {
+	const leaf = "/components/component/name"
+	upper := PostProcessorFunc(func(result *Result) (bool, error) {
+		result.Value = "cpu: " + result.Value.(string)
+		result.Tag("vendor", result.Vendor)
+		return true, nil
+	})
+	dropSwitches := PostProcessorFunc(func(result *Result) (bool, error) {
+		return result.Target != "switch1", nil
+	})
+	failing := PostProcessorFunc(func(result *Result) (bool, error) {
+		return false, errors.New("broken")
+	})
+	for _, test := range []struct {
+		name         string
+		processors   []PostProcessor
+		target       string
+		expected     *Result
+		expectedErr  error
+		expectsError bool
+	}{
+		{
+			name:     "no post-processors",
+			target:   "ap1",
+			expected: &Result{Path: leaf, Target: "ap1", Vendor: "aruba", Value: "Network Processor CPU10"},
+		},
+		{
+			name:       "transform and tag",
+			processors: []PostProcessor{upper, dropSwitches},
+			target:     "ap1",
+			expected: &Result{
+				Path:   leaf,
+				Target: "ap1",
+				Vendor: "aruba",
+				Value:  "cpu: Network Processor CPU10",
+				Tags:   map[string]string{"vendor": "aruba"},
+			},
+		},
+		{
+			name:         "drop",
+			processors:   []PostProcessor{upper, dropSwitches},
+			target:       "switch1",
+			expectedErr:  ErrDropped,
+			expectsError: true,
+		},
+		{
+			name:         "error",
+			processors:   []PostProcessor{failing, upper},
+			target:       "ap1",
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+				Nodes: []*pb.OpenConfigNode{
+					{Subpath: &pb.OpenConfigPath{Path: leaf}, Bind: "cpu_name"},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Could not set up test: %v", err)
+			}
+			o.AddPostProcessor(test.processors...)
+			got, err := o.EvalResult(leaf, test.target, "aruba")
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("EvalResult() = %+v, expected error", got)
+				}
+				if test.expectedErr != nil && err != test.expectedErr {
+					t.Errorf("EvalResult() got error %v, expected %v", err, test.expectedErr)
+				}
+				// Eval and EvalWithTrace agree.
+				if _, err := o.Eval(leaf, test.target, "aruba"); err == nil {
+					t.Errorf("Eval() expected error, got none")
+				}
+				if _, trace, _ := o.EvalWithTrace(leaf, test.target, "aruba"); trace.Error == "" {
+					t.Errorf("EvalWithTrace() expected an error in the trace, got none")
+				}
+				if _, errs, _ := o.EvalBatchResults([]string{leaf}, test.target, "aruba"); test.expectedErr != nil && errs[leaf] != test.expectedErr {
+					t.Errorf("EvalBatchResults() got errors %v, expected %v", errs, test.expectedErr)
+				}
+				// Drops are not failures.
+				if stats := o.Stats(); test.expectedErr == ErrDropped && (stats[0].Drops != 4 || stats[0].Failures != 0 || stats[0].SuccessRate != 0) {
+					t.Errorf("Stats() = %+v, expected 4 drops", stats[0])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalResult() got error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("EvalResult() returned unexpected result (-expected +got):\n%s", diff)
+			}
+			if typed, err := got.Typed(); err != nil || typed.Kind() != oparse.StringKind || typed.String() != test.expected.Value {
+				t.Errorf("Typed() = %v `%v`, %v, expected string `%v`", typed.Kind(), typed, err, test.expected.Value)
+			}
+			if value, err := o.Eval(leaf, test.target, "aruba"); err != nil || value != test.expected.Value {
+				t.Errorf("Eval() = %v, %v, expected %v", value, err, test.expected.Value)
+			}
+			if value, _, err := o.EvalWithTrace(leaf, test.target, "aruba"); err != nil || value != test.expected.Value {
+				t.Errorf("EvalWithTrace() = %v, %v, expected %v", value, err, test.expected.Value)
+			}
+			results, _, err := o.EvalBatchResults([]string{leaf}, test.target, "aruba")
+			if diff := cmp.Diff(test.expected, results[leaf]); err != nil || diff != "" {
+				t.Errorf("EvalBatchResults() returned unexpected result (-expected +got), error %v:\n%s", err, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/functions"
+	"github.com/google/orismologer/profiles"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+/*
+mergeProfiles adds the transformations and vendor OIDs of the given profiles to those loaded from
+files. Profiles' protos are copied, so that resolving symbolic OIDs does not modify them.
+*/
+func mergeProfiles(transformations *pb.Transformations, vendorOids *pb.VendorOids, vendorProfiles []*profiles.Profile) error {
+	for _, profile := range vendorProfiles {
+		for _, transformation := range profile.Transformations.GetTransformations() {
+			transformations.Transformations = append(transformations.Transformations, proto.Clone(transformation).(*pb.Transformation))
+		}
+		if err := mergeVendorOids(vendorOids, profile.VendorOids); err != nil {
+			return fmt.Errorf("could not include profile of %q: %v", profile.Vendor, err)
+		}
+	}
+	return nil
+}
+
+// mergeVendorOids adds the vendors, enterprise arcs and models of src to dst.
+func mergeVendorOids(dst, src *pb.VendorOids) error {
+	if src == nil {
+		return nil
+	}
+	if root := src.GetVendorRoot(); root != "" && dst.GetVendorRoot() != "" && root != dst.GetVendorRoot() {
+		return fmt.Errorf("vendor root %q differs from %q", root, dst.GetVendorRoot())
+	} else if dst.GetVendorRoot() == "" {
+		dst.VendorRoot = root
+	}
+	for vendor, arc := range src.GetVendors() {
+		if existing, ok := dst.GetVendors()[vendor]; ok && existing != arc {
+			return fmt.Errorf("vendor %q has enterprise arc %q, but %q is already declared", vendor, arc, existing)
+		}
+		if dst.Vendors == nil {
+			dst.Vendors = map[string]string{}
+		}
+		dst.Vendors[vendor] = arc
+	}
+	for vendor, arcs := range src.GetVendorArcs() {
+		if dst.VendorArcs == nil {
+			dst.VendorArcs = map[string]*pb.EnterpriseArcs{}
+		}
+		if dst.VendorArcs[vendor] == nil {
+			dst.VendorArcs[vendor] = &pb.EnterpriseArcs{}
+		}
+		dst.VendorArcs[vendor].Arcs = append(dst.VendorArcs[vendor].Arcs, arcs.GetArcs()...)
+	}
+	for _, model := range src.GetModels() {
+		dst.Models = append(dst.Models, proto.Clone(model).(*pb.DeviceModel))
+	}
+	return nil
+}
+
+/*
+Functions returns the functions available to expressions in instances loaded from files: the
+standard library and the functions of registered profiles. If profiles' functions clash (in which
+case instances cannot be loaded either), only the standard library is returned.
+*/
+func Functions() functions.Library {
+	library, err := profileFunctions(profiles.All())
+	if err != nil {
+		glog.Errorf("%v", err)
+		return functions.NewLibrary()
+	}
+	return library
+}
+
+func profileFunctions(vendorProfiles []*profiles.Profile) (functions.Library, error) {
+	library := functions.NewLibrary()
+	for _, profile := range vendorProfiles {
+		var err error
+		if library, err = library.With(profile.Functions); err != nil {
+			return functions.Library{}, fmt.Errorf("could not include functions of profile %q: %v", profile.Vendor, err)
+		}
+	}
+	return library, nil
+}
+
+// useProfiles adds the functions and resolvers of the given profiles to this instance.
+func (o *Orismologer) useProfiles(vendorProfiles []*profiles.Profile) error {
+	library, err := profileFunctions(vendorProfiles)
+	if err != nil {
+		return err
+	}
+	for _, profile := range vendorProfiles {
+		if profile.Resolver == nil {
+			continue
+		}
+		if o.vendors.vendor(profile.Vendor) != profile.Vendor {
+			return fmt.Errorf("profile of unknown vendor %q has a resolver", profile.Vendor)
+		}
+		if o.resolvers == nil {
+			o.resolvers = map[string]nocPathResolver{}
+		}
+		o.resolvers[profile.Vendor] = nocPathResolver(profile.Resolver)
+	}
+	o.functions, o.library = library, library
+	return nil
+}
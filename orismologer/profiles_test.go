@@ -0,0 +1,119 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/orismologer/profiles"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestProfiles(t *testing.T) {
+	acme := &profiles.Profile{
+		Vendor: "acme",
+		VendorOids: &pb.VendorOids{
+			VendorRoot: "1.3.6.1.4.1",
+			Vendors:    map[string]string{"acme": "99999"},
+			Models:     []*pb.DeviceModel{{Name: "acme-1", Vendor: "acme"}},
+		},
+		Transformations: &pb.Transformations{
+			Transformations: []*pb.Transformation{
+				{
+					Bind:        "acme_hostname",
+					Expressions: []string{"shout(name)"},
+					NocPaths:    []*pb.NocPath{{Bind: "name", Oids: []string{"1.3.6.1.4.1.99999.1"}}},
+				},
+			},
+		},
+		Functions: map[string]interface{}{"shout": strings.ToUpper},
+		Resolver: func(nocPath *pb.NocPath, target string) (interface{}, error) {
+			return target, nil
+		},
+	}
+	transformations := &pb.Transformations{}
+	vendorOids := &pb.VendorOids{VendorRoot: "1.3.6.1.4.1", Vendors: map[string]string{"cisco": "9"}}
+	if err := mergeProfiles(transformations, vendorOids, []*profiles.Profile{acme}); err != nil {
+		t.Fatalf("mergeProfiles() got error: %v", err)
+	}
+	o, err := newOrismologer(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/hostname"}, Bind: "acme_hostname"},
+		},
+	}, transformations, vendorOids)
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	if err := o.useProfiles([]*profiles.Profile{acme}); err != nil {
+		t.Fatalf("useProfiles() got error: %v", err)
+	}
+	for _, vendor := range []string{"acme", "acme-1"} {
+		if got, err := o.Eval("/system/state/hostname", "switch1", vendor); err != nil || got != "SWITCH1" {
+			t.Errorf("Eval() for %q = %v, %v, expected \"SWITCH1\", nil", vendor, got, err)
+		}
+	}
+	if _, err := o.Eval("/system/state/hostname", "switch1", "cisco"); err == nil {
+		t.Errorf("Eval() for vendor without the profile's OIDs expected error, got none")
+	}
+	if got := len(acme.Transformations.GetTransformations()); got != 1 {
+		t.Errorf("mergeProfiles() modified the profile")
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		profile *profiles.Profile
+	}{
+		{
+			name:    "different vendor root",
+			profile: &profiles.Profile{Vendor: "acme", VendorOids: &pb.VendorOids{VendorRoot: "1.3.6.1.4.2"}},
+		},
+		{
+			name:    "conflicting enterprise arc",
+			profile: &profiles.Profile{Vendor: "cisco", VendorOids: &pb.VendorOids{Vendors: map[string]string{"cisco": "10"}}},
+		},
+		{
+			name:    "clashing function",
+			profile: &profiles.Profile{Vendor: "cisco", Functions: map[string]interface{}{"to_int": strings.ToUpper}},
+		},
+		{
+			name: "resolver for unknown vendor",
+			profile: &profiles.Profile{Vendor: "acme", Resolver: func(*pb.NocPath, string) (interface{}, error) {
+				return nil, nil
+			}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			vendorOids := &pb.VendorOids{VendorRoot: "1.3.6.1.4.1", Vendors: map[string]string{"cisco": "9"}}
+			vendorProfiles := []*profiles.Profile{test.profile}
+			err := mergeProfiles(&pb.Transformations{}, vendorOids, vendorProfiles)
+			if err == nil {
+				var o *Orismologer
+				if o, err = newOrismologer(&pb.Mappings{}, &pb.Transformations{}, vendorOids); err != nil {
+					t.Fatalf("Could not set up test: %v", err)
+				}
+				err = o.useProfiles(vendorProfiles)
+			}
+			if err == nil {
+				t.Errorf("including profile expected error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+LeafStats summarizes the evaluations of an OpenConfig leaf for a target, so that operators can find
+translations which fail silently, eg: because a device stopped returning an OID.
+*/
+type LeafStats struct {
+	Target        string        `json:"target"`
+	Leaf          string        `json:"leaf"`
+	Evaluations   int64         `json:"evaluations"`
+	Failures      int64         `json:"failures"`
+	Drops         int64         `json:"drops"`        // Evaluations whose values were dropped by post-processors.
+	SuccessRate   float64       `json:"success_rate"` // Fraction of evaluations which succeeded, and were not dropped.
+	LastValue     interface{}   `json:"last_value,omitempty"`
+	LastError     string        `json:"last_error,omitempty"` // The error of the last evaluation, if it failed.
+	LastEvaluated time.Time     `json:"last_evaluated"`
+	LastSuccess   time.Time     `json:"last_success,omitempty"`
+	LastLatency   time.Duration `json:"last_latency_ns"`
+	MeanLatency   time.Duration `json:"mean_latency_ns"`
+	MaxLatency    time.Duration `json:"max_latency_ns"`
+}
+
+// Failing reports whether the last evaluation failed.
+func (s LeafStats) Failing() bool {
+	return s.LastError != ""
+}
+
+type statsKey struct {
+	target string
+	leaf   string
+}
+
+// leafStats records the LeafStats of every evaluated leaf. It is safe for concurrent use.
+type leafStats struct {
+	mu           sync.Mutex
+	leaves       map[statsKey]*LeafStats
+	totalLatency map[statsKey]time.Duration
+}
+
+func newLeafStats() *leafStats {
+	return &leafStats{leaves: map[statsKey]*LeafStats{}, totalLatency: map[statsKey]time.Duration{}}
+}
+
+func (l *leafStats) record(target, leaf string, value interface{}, err error, start time.Time, latency time.Duration) {
+	key := statsKey{target: target, leaf: leaf}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats, ok := l.leaves[key]
+	if !ok {
+		stats = &LeafStats{Target: target, Leaf: leaf}
+		l.leaves[key] = stats
+	}
+	stats.Evaluations++
+	stats.LastEvaluated = start
+	stats.LastLatency = latency
+	if latency > stats.MaxLatency {
+		stats.MaxLatency = latency
+	}
+	l.totalLatency[key] += latency
+	stats.MeanLatency = l.totalLatency[key] / time.Duration(stats.Evaluations)
+	switch {
+	case errors.Is(err, ErrDropped):
+		stats.Drops++
+		stats.LastError = ""
+	case err != nil:
+		stats.Failures++
+		stats.LastError = err.Error()
+	default:
+		stats.LastValue = value
+		stats.LastError = ""
+		stats.LastSuccess = start
+	}
+	stats.SuccessRate = float64(stats.Evaluations-stats.Failures-stats.Drops) / float64(stats.Evaluations)
+}
+
+func (l *leafStats) all() []LeafStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	all := make([]LeafStats, 0, len(l.leaves))
+	for _, stats := range l.leaves {
+		all = append(all, *stats)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Target != all[j].Target {
+			return all[i].Target < all[j].Target
+		}
+		return all[i].Leaf < all[j].Leaf
+	})
+	return all
+}
+
+func (l *leafStats) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leaves = map[statsKey]*LeafStats{}
+	l.totalLatency = map[statsKey]time.Duration{}
+}
+
+/*
+Stats returns the statistics of every (target, leaf) pair evaluated by Eval or EvalWithTrace, sorted
+by target and then leaf. Paths which are not mapped are not recorded. Statistics are kept for the
+lifetime of the instance, so a reloaded namespace starts afresh.
+*/
+func (o *Orismologer) Stats() []LeafStats {
+	return o.stats.all()
+}
+
+// ResetStats forgets all statistics.
+func (o *Orismologer) ResetStats() {
+	o.stats.reset()
+}
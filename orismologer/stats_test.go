@@ -0,0 +1,115 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestStats(t *testing.T) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/components/component/name"}, Bind: "cpu_name"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	const leaf = "/components/component/name"
+	o.Eval(leaf, "ap1", "aruba")
+	o.Eval(leaf, "ap1", "aruba")
+	o.EvalWithTrace(leaf, "ap1", "aruba")
+	o.Eval(leaf, "switch1", "cisco") // No expression is supported for cisco.
+	o.Eval("/unmapped", "switch1", "cisco")
+
+	stats := o.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("Stats() returned %d entries, expected 2: %v", len(stats), stats)
+	}
+	ap1, switch1 := stats[0], stats[1]
+	if ap1.Target != "ap1" || ap1.Leaf != leaf || ap1.Evaluations != 3 || ap1.Failures != 0 || ap1.SuccessRate != 1 {
+		t.Errorf("Stats() for ap1 = %+v, expected 3 successful evaluations", ap1)
+	}
+	if ap1.LastValue != "Network Processor CPU10" || ap1.Failing() || ap1.LastSuccess.IsZero() {
+		t.Errorf("Stats() for ap1 = %+v, expected a last value and no error", ap1)
+	}
+	if ap1.MaxLatency < ap1.MeanLatency || ap1.MeanLatency <= 0 {
+		t.Errorf("Stats() for ap1 has mean latency %v and max latency %v", ap1.MeanLatency, ap1.MaxLatency)
+	}
+	if switch1.Target != "switch1" || switch1.Evaluations != 1 || switch1.Failures != 1 || switch1.SuccessRate != 0 {
+		t.Errorf("Stats() for switch1 = %+v, expected 1 failed evaluation", switch1)
+	}
+	if !switch1.Failing() || !switch1.LastSuccess.IsZero() {
+		t.Errorf("Stats() for switch1 = %+v, expected it to be failing", switch1)
+	}
+
+	o.ResetStats()
+	if stats := o.Stats(); len(stats) != 0 {
+		t.Errorf("Stats() after ResetStats() = %v, expected none", stats)
+	}
+}
+
+func TestLeafStatsRecord(t *testing.T) {
+	l := newLeafStats()
+	start := time.Unix(1000, 0)
+	l.record("t", "/a", 1, nil, start, 10*time.Millisecond)
+	l.record("t", "/a", nil, errors.New("timeout"), start.Add(time.Minute), 30*time.Millisecond)
+	got := l.all()[0]
+	expected := LeafStats{
+		Target:        "t",
+		Leaf:          "/a",
+		Evaluations:   2,
+		Failures:      1,
+		SuccessRate:   0.5,
+		LastValue:     1,
+		LastError:     "timeout",
+		LastEvaluated: start.Add(time.Minute),
+		LastSuccess:   start,
+		LastLatency:   30 * time.Millisecond,
+		MeanLatency:   20 * time.Millisecond,
+		MaxLatency:    30 * time.Millisecond,
+	}
+	if got != expected {
+		t.Errorf("record() = %+v, expected %+v", got, expected)
+	}
+
+	// Values dropped by post-processors are neither failures nor successes.
+	l.record("t", "/d", 1, nil, start, time.Millisecond)
+	l.record("t", "/d", 2, ErrDropped, start.Add(time.Minute), time.Millisecond)
+	if got := l.all()[1]; got.Drops != 1 || got.Failures != 0 || got.SuccessRate != 0.5 || got.LastValue != 1 || got.Failing() {
+		t.Errorf("record() of a drop = %+v, expected 1 drop after 1 success", got)
+	}
+
+	// Recording is safe for concurrent use.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.record("t", "/b", 1, nil, start, time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	if got := l.all()[1].Evaluations; got != 10 {
+		t.Errorf("concurrent record() counted %d evaluations, expected 10", got)
+	}
+}
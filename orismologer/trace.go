@@ -0,0 +1,290 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Sources of a variable's value.
+const (
+	SourceNocPath        = "noc_path"
+	SourceTransformation = "transformation"
+	SourceLookup         = "lookup"
+)
+
+/*
+Trace records the steps of an evaluation: each transformation entered, each expression tried and
+each variable resolved, with their results and timings. Traces are encoded to JSON for debugging UIs;
+String renders them for people.
+*/
+type Trace struct {
+	Path           string               `json:"path"`
+	Target         string               `json:"target"`
+	Vendor         string               `json:"vendor"`
+	Transformation *TransformationTrace `json:"transformation,omitempty"`
+	Value          interface{}          `json:"value,omitempty"`
+	Error          string               `json:"error,omitempty"`
+	Duration       time.Duration        `json:"duration_ns"`
+}
+
+// TransformationTrace records the evaluation of a transformation.
+type TransformationTrace struct {
+	Name        string             `json:"name"`
+	Expressions []*ExpressionTrace `json:"expressions"`
+	Duration    time.Duration      `json:"duration_ns"`
+
+	start time.Time
+}
+
+/*
+ExpressionTrace records an attempt to evaluate one of a transformation's expressions. ParseError is
+set if the expression could not be parsed (or uses undefined functions), in which case it has no
+variables.
+*/
+type ExpressionTrace struct {
+	Expression string           `json:"expression"`
+	ParseError string           `json:"parse_error,omitempty"`
+	Variables  []*VariableTrace `json:"variables,omitempty"`
+	Value      interface{}      `json:"value,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Duration   time.Duration    `json:"duration_ns"`
+
+	start time.Time
+}
+
+/*
+VariableTrace records the resolution of a variable used by an expression, either from a NocPath (see
+SourceNocPath) or by evaluating a sub-transformation (see SourceTransformation), or the evaluation of
+an OpenConfig path looked up by the expression (see SourceLookup), named by the path.
+*/
+type VariableTrace struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	// OIDs are the OIDs of the NocPath the variable was resolved from.
+	OIDs []string `json:"oids,omitempty"`
+	// Transformation is the trace of the sub-transformation the variable was resolved from.
+	Transformation *TransformationTrace `json:"transformation,omitempty"`
+	Value          interface{}          `json:"value,omitempty"`
+	Error          string               `json:"error,omitempty"`
+	Duration       time.Duration        `json:"duration_ns"`
+
+	start time.Time
+}
+
+// The methods below are no-ops on nil receivers, so that evaluation need not check whether it is traced.
+
+// GetName returns the name of the transformation, or the empty string if t is nil.
+func (t *TransformationTrace) GetName() string {
+	if t == nil {
+		return ""
+	}
+	return t.Name
+}
+
+func newTransformationTrace(name string) *TransformationTrace {
+	return &TransformationTrace{Name: name, start: time.Now()}
+}
+
+func (t *TransformationTrace) finish() {
+	if t != nil {
+		t.Duration = time.Since(t.start)
+	}
+}
+
+// expression records an attempt to evaluate an expression of the transformation.
+func (t *TransformationTrace) expression(expression string) *ExpressionTrace {
+	if t == nil {
+		return nil
+	}
+	e := &ExpressionTrace{Expression: expression, start: time.Now()}
+	t.Expressions = append(t.Expressions, e)
+	return e
+}
+
+func (e *ExpressionTrace) parseError(err error) {
+	if e != nil {
+		e.ParseError = err.Error()
+		e.Duration = time.Since(e.start)
+	}
+}
+
+func (e *ExpressionTrace) finish(value interface{}, err error) {
+	if e == nil {
+		return
+	}
+	e.Value = value
+	if err != nil {
+		e.Error = err.Error()
+	}
+	e.Duration = time.Since(e.start)
+}
+
+// variable records the resolution of a variable used by the expression.
+func (e *ExpressionTrace) variable(name string) *VariableTrace {
+	if e == nil {
+		return nil
+	}
+	v := &VariableTrace{Name: name, start: time.Now()}
+	e.Variables = append(e.Variables, v)
+	return v
+}
+
+func (v *VariableTrace) nocPath(nocPath *pb.NocPath) {
+	if v != nil {
+		v.Source = SourceNocPath
+		v.OIDs = nocPath.GetOids()
+	}
+}
+
+// transformation records that the variable is resolved by a sub-transformation, returning its trace.
+func (v *VariableTrace) transformation(name string) *TransformationTrace {
+	if v == nil {
+		return nil
+	}
+	v.Source = SourceTransformation
+	v.Transformation = newTransformationTrace(name)
+	return v.Transformation
+}
+
+// lookup records that the path is looked up, by evaluating the given transformation, returning its trace.
+func (v *VariableTrace) lookup(name string) *TransformationTrace {
+	if v == nil {
+		return nil
+	}
+	v.Source = SourceLookup
+	v.Transformation = newTransformationTrace(name)
+	return v.Transformation
+}
+
+func (v *VariableTrace) finish(value interface{}, err error) {
+	if v == nil {
+		return
+	}
+	v.Value = value
+	if err != nil {
+		v.Error = err.Error()
+	}
+	v.Duration = time.Since(v.start)
+}
+
+// String renders the trace as an indented tree.
+func (t *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v for target %q of vendor %q (%v)\n", t.Path, t.Target, t.Vendor, t.Duration)
+	if t.Transformation != nil {
+		t.Transformation.write(&b, "  ")
+	}
+	if t.Error != "" {
+		fmt.Fprintf(&b, "error: %v\n", t.Error)
+	} else {
+		fmt.Fprintf(&b, "value: %v\n", t.Value)
+	}
+	return b.String()
+}
+
+func (t *TransformationTrace) write(b *strings.Builder, indent string) {
+	fmt.Fprintf(b, "%vtransformation %v (%v)\n", indent, t.Name, t.Duration)
+	for _, e := range t.Expressions {
+		fmt.Fprintf(b, "%v  expression `%v` (%v)", indent, e.Expression, e.Duration)
+		switch {
+		case e.ParseError != "":
+			fmt.Fprintf(b, ": invalid: %v\n", e.ParseError)
+		case e.Error != "":
+			fmt.Fprintf(b, ": failed: %v\n", e.Error)
+		default:
+			fmt.Fprintf(b, " = %v\n", e.Value)
+		}
+		for _, v := range e.Variables {
+			if v.Source == SourceLookup {
+				fmt.Fprintf(b, "%v    lookup %v", indent, v.Name)
+			} else {
+				fmt.Fprintf(b, "%v    variable %v from %v", indent, v.Name, v.Source)
+			}
+			if len(v.OIDs) > 0 {
+				fmt.Fprintf(b, " %v", strings.Join(v.OIDs, ", "))
+			}
+			if v.Error != "" {
+				fmt.Fprintf(b, " (%v): failed: %v\n", v.Duration, v.Error)
+			} else {
+				fmt.Fprintf(b, " (%v) = %v\n", v.Duration, v.Value)
+			}
+			if v.Transformation != nil {
+				v.Transformation.write(b, indent+"      ")
+			}
+		}
+	}
+}
+
+/*
+Describe renders, without evaluating anything, the transformation an OpenConfig leaf is bound to:
+its expressions and their variables, recursively, marking NocPaths which the given vendor (or model)
+does not support.
+*/
+func (o *Orismologer) Describe(openConfigPath, vendor string) (string, error) {
+	transformation, err := o.transformation(openConfigPath)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n", openConfigPath)
+	o.describe(&b, transformation, vendor, "  ", map[string]bool{})
+	return b.String(), nil
+}
+
+func (o *Orismologer) describe(b *strings.Builder, transformation *pb.Transformation, vendor, indent string, visiting map[string]bool) {
+	name := transformation.GetBind()
+	if visiting[name] {
+		fmt.Fprintf(b, "%vtransformation %v (circular reference)\n", indent, name)
+		return
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	fmt.Fprintf(b, "%vtransformation %v\n", indent, name)
+	nocPaths := o.getNocPaths(transformation)
+	for _, expressionString := range transformation.GetExpressions() {
+		fmt.Fprintf(b, "%v  expression `%v`\n", indent, expressionString)
+		compiled, err := o.parseAndValidateExpression(expressionString)
+		if err != nil {
+			fmt.Fprintf(b, "%v    invalid: %v\n", indent, err)
+			continue
+		}
+		variables := append([]string(nil), compiled.variables...) // Sorted without changing the cache.
+		sort.Strings(variables)
+		for _, variable := range variables {
+			nocPath, sub := nocPaths[variable], o.transformations[variable]
+			switch {
+			case nocPath != nil:
+				supported := ""
+				if vendor != "" && !o.canResolve(nocPath, vendor) {
+					supported = fmt.Sprintf(" (unsupported for %v)", vendor)
+				}
+				fmt.Fprintf(b, "%v    variable %v from NocPath %v%v\n", indent, variable, strings.Join(nocPath.GetOids(), ", "), supported)
+			case sub != nil:
+				fmt.Fprintf(b, "%v    variable %v from\n", indent, variable)
+				o.describe(b, sub, vendor, indent+"      ", visiting)
+			default:
+				fmt.Fprintf(b, "%v    variable %v is undefined\n", indent, variable)
+			}
+		}
+	}
+}
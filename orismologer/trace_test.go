@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestEvalWithTrace(t *testing.T) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	value, trace, err := o.EvalWithTrace("/system/state/boot-time", "target", "cisco")
+	if err != nil || value != 100.0 {
+		t.Fatalf("EvalWithTrace() = %v, %v, expected 100", value, err)
+	}
+	if trace.Value != value || trace.Error != "" || trace.Transformation.GetName() != "boot_time" {
+		t.Errorf("EvalWithTrace() returned trace %+v, expected the value of transformation boot_time", trace)
+	}
+	expressions := trace.Transformation.Expressions
+	if len(expressions) != 2 {
+		t.Fatalf("trace has %d expressions, expected 2: %v", len(expressions), trace)
+	}
+	// The first expression needs an Aruba OID.
+	if first := expressions[0]; first.Error == "" || first.Value != nil {
+		t.Errorf("first expression trace = %+v, expected an error", first)
+	}
+	second := expressions[1]
+	if second.Error != "" || second.Value != 100.0 {
+		t.Errorf("second expression trace = %+v, expected value 100", second)
+	}
+	variables := map[string]*VariableTrace{}
+	for _, v := range second.Variables {
+		variables[v.Name] = v
+	}
+	if v := variables["system_time_cisco"]; v == nil || v.Source != SourceNocPath || len(v.OIDs) != 1 || v.Value != "dfc4 0b68 8147 af78" {
+		t.Errorf("variable trace = %+v, expected system_time_cisco resolved from its NocPath", v)
+	}
+	v := variables["system_up_time"]
+	if v == nil || v.Source != SourceTransformation || v.Value != 20000000.0 {
+		t.Fatalf("variable trace = %+v, expected system_up_time evaluated by its transformation", v)
+	}
+	if sub := v.Transformation; sub.GetName() != "system_up_time" || len(sub.Expressions) != 1 || sub.Expressions[0].Value != 20000000.0 {
+		t.Errorf("sub-transformation trace = %+v, expected system_up_time's expression", sub)
+	}
+
+	if _, err := json.Marshal(trace); err != nil {
+		t.Errorf("could not encode trace as JSON: %v", err)
+	}
+	for _, expected := range []string{"transformation boot_time", "variable system_up_time from transformation", "value: 100"} {
+		if !strings.Contains(trace.String(), expected) {
+			t.Errorf("String() = %q, expected it to contain %q", trace.String(), expected)
+		}
+	}
+
+	_, trace, err = o.EvalWithTrace("/system/state/unmapped", "target", "cisco")
+	if err == nil || trace == nil || trace.Error == "" {
+		t.Errorf("EvalWithTrace() of unmapped path = %+v, %v, expected a trace of the error", trace, err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	o, err := makeTestOrismologerWithMappings(&pb.Mappings{
+		Nodes: []*pb.OpenConfigNode{
+			{Subpath: &pb.OpenConfigPath{Path: "/system/state/boot-time"}, Bind: "boot_time"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	got, err := o.Describe("/system/state/boot-time", "cisco")
+	if err != nil {
+		t.Fatalf("Describe() got error: %v", err)
+	}
+	for _, expected := range []string{
+		"transformation boot_time",
+		"variable system_time_aruba from NocPath 1.3.6.1.4.1.14823.2.2.1.2.1.6 (unsupported for cisco)",
+		"variable system_up_time from\n",
+		"variable system_up_time_100 from NocPath 1.3.6.1.2.1.1.3\n",
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Describe() = %q, expected it to contain %q", got, expected)
+		}
+	}
+	if _, err := o.Describe("/system/state/unmapped", "cisco"); err == nil {
+		t.Errorf("Describe() of unmapped path expected error, got none")
+	}
+}
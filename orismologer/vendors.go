@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orismologer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// platform describes the enterprise OIDs supported by a vendor or by one of its models.
+type platform struct {
+	vendor      string
+	supported   []string // Absolute OID prefixes.
+	unsupported []string // Absolute OID prefixes.
+}
+
+// vendorRegistry indexes a VendorOids proto by vendor name, model name and sysObjectID.
+type vendorRegistry struct {
+	root         string
+	platforms    map[string]*platform
+	sysObjectIDs map[string]string // sysObjectID -> model name.
+}
+
+func newVendorRegistry(vendorInfo *pb.VendorOids) (*vendorRegistry, error) {
+	root := vendorInfo.GetVendorRoot()
+	r := &vendorRegistry{
+		root:         root,
+		platforms:    map[string]*platform{},
+		sysObjectIDs: map[string]string{},
+	}
+	for vendor, arc := range vendorInfo.GetVendors() {
+		p := &platform{vendor: vendor, supported: []string{r.absolute(arc)}}
+		for _, arc := range vendorInfo.GetVendorArcs()[vendor].GetArcs() {
+			p.supported = append(p.supported, r.absolute(arc))
+		}
+		r.platforms[vendor] = p
+	}
+	for vendor := range vendorInfo.GetVendorArcs() {
+		if _, ok := r.platforms[vendor]; !ok {
+			return nil, fmt.Errorf("enterprise arcs given for unknown vendor %q", vendor)
+		}
+	}
+	for _, model := range vendorInfo.GetModels() {
+		name := model.GetName()
+		if name == "" {
+			return nil, fmt.Errorf("model of vendor %q has no name", model.GetVendor())
+		}
+		if _, ok := r.platforms[name]; ok {
+			return nil, fmt.Errorf("model %q is defined more than once, or clashes with a vendor name", name)
+		}
+		vendor, ok := r.platforms[model.GetVendor()]
+		if !ok {
+			return nil, fmt.Errorf("model %q has unknown vendor %q", name, model.GetVendor())
+		}
+		p := &platform{vendor: vendor.vendor, supported: vendor.supported}
+		if len(model.GetSupportedArcs()) > 0 {
+			p.supported = nil
+			for _, arc := range model.GetSupportedArcs() {
+				p.supported = append(p.supported, r.absolute(arc))
+			}
+		}
+		for _, arc := range model.GetUnsupportedArcs() {
+			p.unsupported = append(p.unsupported, r.absolute(arc))
+		}
+		r.platforms[name] = p
+		for _, id := range model.GetSysObjectIds() {
+			if other, ok := r.sysObjectIDs[id]; ok {
+				return nil, fmt.Errorf("sysObjectID %q is claimed by models %q and %q", id, other, name)
+			}
+			r.sysObjectIDs[id] = name
+		}
+	}
+	return r, nil
+}
+
+func (r *vendorRegistry) absolute(arc string) string {
+	return r.root + "." + arc
+}
+
+/*
+canResolve returns true if at least one of the given OIDs is supported by the given vendor or
+model. OIDs outside the vendor root (eg: standard MIBs) are assumed to be supported by everyone.
+*/
+func (r *vendorRegistry) canResolve(oids []string, vendorOrModel string) bool {
+	for _, oid := range oids {
+		if !utils.HasOidPrefix(oid, r.root) {
+			return true
+		}
+		p, ok := r.platforms[vendorOrModel]
+		if !ok {
+			return false
+		}
+		if hasAnyOidPrefix(oid, p.supported) && !hasAnyOidPrefix(oid, p.unsupported) {
+			return true
+		}
+	}
+	return false
+}
+
+// vendor returns the vendor of the given vendor or model, or the empty string if it is unknown.
+func (r *vendorRegistry) vendor(vendorOrModel string) string {
+	if p, ok := r.platforms[vendorOrModel]; ok {
+		return p.vendor
+	}
+	return ""
+}
+
+// model returns the model name and vendor registered for the given sysObjectID.
+func (r *vendorRegistry) model(sysObjectID string) (model string, vendor string, ok bool) {
+	model, ok = r.sysObjectIDs[strings.TrimPrefix(sysObjectID, ".")]
+	if !ok {
+		return "", "", false
+	}
+	return model, r.platforms[model].vendor, true
+}
+
+func hasAnyOidPrefix(oid string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if utils.HasOidPrefix(oid, prefix) {
+			return true
+		}
+	}
+	return false
+}
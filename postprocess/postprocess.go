@@ -0,0 +1,97 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package postprocess provides common post-processors (see orismologer.PostProcessor), each applying
+to the leaves whose paths match a regular expression (or to every leaf, if it is nil). eg:
+
+	o.AddPostProcessor(
+		postprocess.Drop(regexp.MustCompile(`/config/`)),
+		postprocess.Redact(regexp.MustCompile(`/snmp-community`), "<redacted>"),
+		postprocess.Round(regexp.MustCompile(`/temperature/`), 1),
+		postprocess.Tag(nil, "site", "lon1"),
+	)
+*/
+package postprocess
+
+import (
+	"math"
+	"regexp"
+
+	"github.com/google/orismologer/orismologer"
+)
+
+// matches reports whether a leaf is matched by the given expression; nil matches every leaf.
+func matches(leaves *regexp.Regexp, result *orismologer.Result) bool {
+	return leaves == nil || leaves.MatchString(result.Path)
+}
+
+// Drop drops the values of matching leaves.
+func Drop(leaves *regexp.Regexp) orismologer.PostProcessor {
+	return orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		return !matches(leaves, result), nil
+	})
+}
+
+// Redact replaces the values of matching leaves.
+func Redact(leaves *regexp.Regexp, replacement interface{}) orismologer.PostProcessor {
+	return orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		if matches(leaves, result) {
+			result.Value = replacement
+		}
+		return true, nil
+	})
+}
+
+/*
+Round rounds the numeric values of matching leaves to the given number of decimal places (which may
+be negative, eg: -3 rounds to thousands). Other values are left alone.
+*/
+func Round(leaves *regexp.Regexp, places int) orismologer.PostProcessor {
+	scale := math.Pow(10, float64(places))
+	return orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		if !matches(leaves, result) {
+			return true, nil
+		}
+		if value, ok := result.Value.(float64); ok {
+			result.Value = math.Round(value*scale) / scale
+		}
+		return true, nil
+	})
+}
+
+// Tag tags the values of matching leaves.
+func Tag(leaves *regexp.Regexp, key, value string) orismologer.PostProcessor {
+	return orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		if matches(leaves, result) {
+			result.Tag(key, value)
+		}
+		return true, nil
+	})
+}
+
+/*
+TargetTags tags the values of every leaf of a target with the target's tags, given keyed by target,
+eg: to enrich values with the site or owner of a device from an asset database.
+*/
+func TargetTags(tags map[string]map[string]string) orismologer.PostProcessor {
+	return orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		for key, value := range tags[result.Target] {
+			result.Tag(key, value)
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postprocess
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/orismologer"
+)
+
+func TestPostProcessors(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		processor    orismologer.PostProcessor
+		result       orismologer.Result
+		expected     orismologer.Result
+		expectedKeep bool
+	}{
+		{
+			name:      "drop matching leaf",
+			processor: Drop(regexp.MustCompile(`/config/`)),
+			result:    orismologer.Result{Path: "/system/config/hostname", Value: "a"},
+			expected:  orismologer.Result{Path: "/system/config/hostname", Value: "a"},
+		},
+		{
+			name:         "drop keeps other leaves",
+			processor:    Drop(regexp.MustCompile(`/config/`)),
+			result:       orismologer.Result{Path: "/system/state/hostname", Value: "a"},
+			expected:     orismologer.Result{Path: "/system/state/hostname", Value: "a"},
+			expectedKeep: true,
+		},
+		{
+			name:         "redact",
+			processor:    Redact(regexp.MustCompile(`/community$`), "<redacted>"),
+			result:       orismologer.Result{Path: "/snmp/community", Value: "public"},
+			expected:     orismologer.Result{Path: "/snmp/community", Value: "<redacted>"},
+			expectedKeep: true,
+		},
+		{
+			name:         "round",
+			processor:    Round(nil, 1),
+			result:       orismologer.Result{Path: "/a", Value: 21.46},
+			expected:     orismologer.Result{Path: "/a", Value: 21.5},
+			expectedKeep: true,
+		},
+		{
+			name:         "round to thousands",
+			processor:    Round(nil, -3),
+			result:       orismologer.Result{Path: "/a", Value: 123456.0},
+			expected:     orismologer.Result{Path: "/a", Value: 123000.0},
+			expectedKeep: true,
+		},
+		{
+			name:         "round ignores strings",
+			processor:    Round(nil, 1),
+			result:       orismologer.Result{Path: "/a", Value: "21.46"},
+			expected:     orismologer.Result{Path: "/a", Value: "21.46"},
+			expectedKeep: true,
+		},
+		{
+			name:         "tag",
+			processor:    Tag(regexp.MustCompile(`^/system`), "site", "lon1"),
+			result:       orismologer.Result{Path: "/system/state/hostname", Value: "a"},
+			expected:     orismologer.Result{Path: "/system/state/hostname", Value: "a", Tags: map[string]string{"site": "lon1"}},
+			expectedKeep: true,
+		},
+		{
+			name: "target tags",
+			processor: TargetTags(map[string]map[string]string{
+				"switch1": {"owner": "netops"},
+			}),
+			result:       orismologer.Result{Path: "/a", Target: "switch1", Value: 1.0},
+			expected:     orismologer.Result{Path: "/a", Target: "switch1", Value: 1.0, Tags: map[string]string{"owner": "netops"}},
+			expectedKeep: true,
+		},
+		{
+			name: "target tags for untagged target",
+			processor: TargetTags(map[string]map[string]string{
+				"switch1": {"owner": "netops"},
+			}),
+			result:       orismologer.Result{Path: "/a", Target: "switch2", Value: 1.0},
+			expected:     orismologer.Result{Path: "/a", Target: "switch2", Value: 1.0},
+			expectedKeep: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.result
+			keep, err := test.processor.Process(&result)
+			if err != nil {
+				t.Fatalf("Process() got error: %v", err)
+			}
+			if keep != test.expectedKeep {
+				t.Errorf("Process() = %v, expected %v", keep, test.expectedKeep)
+			}
+			if diff := cmp.Diff(test.expected, result); diff != "" {
+				t.Errorf("Process() left unexpected result (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
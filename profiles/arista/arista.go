@@ -0,0 +1,69 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package arista provides a vendor profile for Arista Networks devices running EOS, which is included in
+Orismologer instances loaded after Register is called.
+*/
+package arista
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/google/orismologer/profiles"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Vendor is the vendor name of Arista devices.
+const Vendor = "arista"
+
+// enterprise is Arista's IANA private enterprise number.
+const enterprise = "30065"
+
+// versionRe matches the EOS version in sysDescr, eg: "Arista Networks EOS version 4.20.1F running on ...".
+var versionRe = regexp.MustCompile(`EOS version (\S+)`)
+
+var register sync.Once
+
+// Register registers the profile with the profiles package. It may be called more than once.
+func Register() {
+	register.Do(func() { profiles.Register(profile()) })
+}
+
+func profile() *profiles.Profile {
+	return &profiles.Profile{
+		Vendor: Vendor,
+		VendorOids: &pb.VendorOids{
+			VendorRoot: "1.3.6.1.4.1",
+			Vendors:    map[string]string{Vendor: enterprise},
+		},
+		Functions: map[string]interface{}{
+			"eos_version": eosVersion,
+		},
+	}
+}
+
+// eosVersion extracts the EOS software version from an Arista device's sysDescr.
+func eosVersion(sysDescr string) (string, error) {
+	match := versionRe.FindStringSubmatch(sysDescr)
+	if match == nil {
+		return "", fmt.Errorf("no EOS version in sysDescr %q", sysDescr)
+	}
+	return match[1], nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arista
+
+import (
+	"testing"
+
+	"github.com/google/orismologer/profiles"
+)
+
+func TestRegister(t *testing.T) {
+	if _, ok := profiles.Lookup(Vendor); ok {
+		t.Fatalf("Lookup(%q) returned true before Register, expected the profile not to be registered", Vendor)
+	}
+	Register()
+	Register() // Does not panic.
+	profile, ok := profiles.Lookup(Vendor)
+	if !ok {
+		t.Fatalf("Lookup(%q) returned false, expected the profile to be registered", Vendor)
+	}
+	if got := profile.VendorOids.GetVendors()[Vendor]; got != enterprise {
+		t.Errorf("profile declares enterprise %q, expected %q", got, enterprise)
+	}
+}
+
+func TestEOSVersion(t *testing.T) {
+	for _, test := range []struct {
+		sysDescr     string
+		expected     string
+		expectsError bool
+	}{
+		{
+			sysDescr: "Arista Networks EOS version 4.20.1F running on an Arista Networks DCS-7050SX-64",
+			expected: "4.20.1F",
+		},
+		{
+			sysDescr:     "Cisco IOS Software",
+			expectsError: true,
+		},
+	} {
+		got, err := eosVersion(test.sysDescr)
+		switch {
+		case err != nil && !test.expectsError:
+			t.Errorf("eosVersion(%q) got error: %v", test.sysDescr, err)
+		case err == nil && test.expectsError:
+			t.Errorf("eosVersion(%q) = %q, expected error", test.sysDescr, got)
+		case err == nil && got != test.expected:
+			t.Errorf("eosVersion(%q) = %q, expected %q", test.sysDescr, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package profiles is a registry of vendor profiles: vendor support (enterprise OIDs, models,
+transformations, functions and resolver quirks) distributed as Go packages. A profile package registers
+its profile when asked to, rather than when imported, so that programs choose which vendors they
+support, eg:
+
+	arista.Register()
+
+and Orismologer instances loaded from files afterwards include every registered profile (see
+orismologer.NewOrismologer).
+*/
+package profiles
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Resolver retrieves the value of a NocPath from a target.
+type Resolver func(nocPath *pb.NocPath, target string) (interface{}, error)
+
+// Profile describes the support for a vendor's devices.
+type Profile struct {
+	// Vendor is the vendor supported, as named in VendorOids and passed to Eval.
+	Vendor string
+
+	// VendorOids is merged into the loaded VendorOids. It may be nil if the vendor is declared there.
+	VendorOids *pb.VendorOids
+
+	// Transformations are added to the loaded transformations.
+	Transformations *pb.Transformations
+
+	// Functions are added to the functions available to expressions, keyed by name.
+	Functions map[string]interface{}
+
+	// Resolver, if set, resolves NocPaths for targets of the vendor (and its models) in place of the
+	// default resolver, for devices which need special handling.
+	Resolver Resolver
+}
+
+var (
+	mu       sync.RWMutex
+	profiles = map[string]*Profile{} // Vendor -> profile.
+)
+
+/*
+Register registers a vendor profile. It is meant to be called by the profile's package (eg: by
+arista.Register), and panics if the profile has no vendor or the vendor already has a profile.
+*/
+func Register(profile *Profile) {
+	mu.Lock()
+	defer mu.Unlock()
+	if profile.Vendor == "" {
+		panic("profiles: Register of a profile without a vendor")
+	}
+	if _, ok := profiles[profile.Vendor]; ok {
+		panic(fmt.Sprintf("profiles: Register called twice for vendor %q", profile.Vendor))
+	}
+	profiles[profile.Vendor] = profile
+}
+
+// Lookup returns the profile registered for a vendor.
+func Lookup(vendor string) (*Profile, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	profile, ok := profiles[vendor]
+	return profile, ok
+}
+
+// All returns every registered profile, sorted by vendor.
+func All() []*Profile {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]*Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		all = append(all, profile)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Vendor < all[j].Vendor })
+	return all
+}
+
+// unregister removes a vendor's profile, for tests.
+func unregister(vendor string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(profiles, vendor)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profiles
+
+import (
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	Register(&Profile{Vendor: "zeta"})
+	Register(&Profile{Vendor: "alpha"})
+	defer unregister("zeta")
+	defer unregister("alpha")
+
+	if _, ok := Lookup("alpha"); !ok {
+		t.Errorf("Lookup() of registered profile returned false")
+	}
+	if _, ok := Lookup("unknown"); ok {
+		t.Errorf("Lookup() of unregistered profile returned true")
+	}
+	all := All()
+	if len(all) != 2 || all[0].Vendor != "alpha" || all[1].Vendor != "zeta" {
+		t.Errorf("All() = %v, expected the profiles sorted by vendor", all)
+	}
+
+	for _, profile := range []*Profile{{Vendor: "alpha"}, {}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%+v) expected panic, got none", profile)
+				}
+			}()
+			Register(profile)
+		}()
+	}
+}
@@ -19,3 +19,12 @@ vendor_root: "1.3.6.1.4.1"
 
 vendors { key: "cisco" value: "9" }
 vendors { key: "aruba" value: "14823" }
+
+# Hardware models may be declared where support differs within a vendor, eg:
+#
+# models {
+#   name: "aruba-7200"
+#   vendor: "aruba"
+#   sys_object_ids: "1.3.6.1.4.1.14823.1.1.32"
+#   unsupported_arcs: "14823.2.2.1.20"
+# }
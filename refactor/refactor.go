@@ -0,0 +1,281 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package refactor applies expression rewrites (see oparse.Rewrite) across Mappings and Transformations
+text proto files, eg: to rename a binding everywhere it is defined and referenced. Files are edited in
+place, field by field, so comments and formatting outside the edited fields are kept.
+*/
+package refactor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/orismologer/oparse"
+)
+
+var (
+	identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// The name of a function, which may be qualified by namespaces, eg: cisco.parse_envmon.
+	functionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+	// A bind, expressions or value field with its double quoted value, which may contain escapes.
+	field = regexp.MustCompile(`\b(bind|expressions|value)(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	// The start of an entry of the map of a mapping, whose values are variables, eg: map { key: "name" value: "if_name" }.
+	mapEntry = regexp.MustCompile(`\bmap\s*:?\s*[{<]`)
+)
+
+/*
+Refactoring describes the rewrites to apply. Each map is keyed by an existing name. Renaming a
+variable renames bindings of transformations, NocPaths and mappings as well as references to them,
+including the variables path keys are mapped to (the values of a mapping's map).
+*/
+type Refactoring struct {
+	RenameVariables map[string]string // New names of variables.
+	RenameFunctions map[string]string // New names of functions.
+	WrapVariables   map[string]string // Functions to wrap references to variables in, eg: x -> to_int(x).
+}
+
+// Change describes a rewritten field.
+type Change struct {
+	File string
+	Line int
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%v:%d: %v -> %v", c.File, c.Line, c.Old, c.New)
+}
+
+// validate checks that every name is an identifier, or a function name qualified by namespaces.
+func (r Refactoring) validate() error {
+	for _, rewrites := range []struct {
+		names    map[string]string
+		from, to *regexp.Regexp
+	}{
+		{names: r.RenameVariables, from: identifier, to: identifier},
+		{names: r.RenameFunctions, from: functionName, to: functionName},
+		{names: r.WrapVariables, from: identifier, to: functionName},
+	} {
+		for from, to := range rewrites.names {
+			if !rewrites.from.MatchString(from) {
+				return fmt.Errorf("%q is not a valid identifier", from)
+			}
+			if !rewrites.to.MatchString(to) {
+				return fmt.Errorf("%q is not a valid identifier", to)
+			}
+		}
+	}
+	// Renames are applied one at a time, so chains (eg: a -> b, b -> c) would depend on their order.
+	for _, renames := range []map[string]string{r.RenameVariables, r.RenameFunctions} {
+		for from, to := range renames {
+			if _, ok := renames[to]; ok && to != from {
+				return fmt.Errorf("cannot rename %q to %q, which is also renamed", from, to)
+			}
+		}
+	}
+	if len(r.RenameVariables)+len(r.RenameFunctions)+len(r.WrapVariables) == 0 {
+		return fmt.Errorf("no rewrites given")
+	}
+	return nil
+}
+
+/*
+rewrite applies the refactoring to a parsed expression. Renaming a variable to a name bound by a let
+around a reference to it is an error, and leaves the expression unchanged.
+*/
+func (r Refactoring) rewrite(e *oparse.Expression) (int, error) {
+	for from, to := range r.RenameVariables {
+		if e.Captures(from, to) {
+			return 0, fmt.Errorf("cannot rename %q to %q, which is bound by a let around a reference to %q", from, to, from)
+		}
+	}
+	changes := 0
+	// Wrap first, so that wrapping refers to variables by their old names.
+	for variable, function := range r.WrapVariables {
+		changes += e.WrapVariable(variable, function)
+	}
+	for from, to := range r.RenameVariables {
+		changes += e.RenameVariable(from, to)
+	}
+	for from, to := range r.RenameFunctions {
+		changes += e.RenameFunction(from, to)
+	}
+	return changes, nil
+}
+
+/*
+Apply applies the refactoring to the contents of a text proto file, returning the new contents and
+the changes made. Lines which are comments are left alone. Value fields are only rewritten within the
+entries of maps of mappings, which may be written on one line or several.
+*/
+func (r Refactoring) Apply(file, text string) (string, []Change, error) {
+	if err := r.validate(); err != nil {
+		return "", nil, err
+	}
+	var changes []Change
+	lines := strings.Split(text, "\n")
+	inMapEntry := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		// Whether the line is within a map entry, and whether the entry continues on the next line.
+		lineInMapEntry := inMapEntry
+		if start := mapEntry.FindStringIndex(line); start != nil {
+			lineInMapEntry = true
+			inMapEntry = !strings.ContainsAny(line[start[1]:], "}>")
+		} else if inMapEntry && strings.ContainsAny(line, "}>") {
+			inMapEntry = false
+		}
+		var err error
+		lines[i] = field.ReplaceAllStringFunc(line, func(match string) string {
+			if err != nil {
+				return match
+			}
+			groups := field.FindStringSubmatch(match)
+			name, separator, quoted := groups[1], groups[2], groups[3]
+			var value string
+			value, err = unquote(quoted)
+			if err != nil {
+				err = fmt.Errorf("%v:%d: %v", file, i+1, err)
+				return match
+			}
+			rewritten := value
+			switch name {
+			case "bind", "value":
+				if to, ok := r.RenameVariables[value]; ok && (name == "bind" || lineInMapEntry) {
+					rewritten = to
+				}
+			case "expressions":
+				var rewriteErr error
+				rewritten, _, err = oparse.Rewrite(value, func(e *oparse.Expression) int {
+					var changes int
+					changes, rewriteErr = r.rewrite(e)
+					return changes
+				})
+				if err == nil {
+					err = rewriteErr
+				}
+				if err != nil {
+					err = fmt.Errorf("%v:%d: %v", file, i+1, err)
+					return match
+				}
+			}
+			if rewritten == value {
+				return match
+			}
+			changes = append(changes, Change{File: file, Line: i + 1, Old: value, New: rewritten})
+			return name + separator + quote(rewritten)
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return strings.Join(lines, "\n"), changes, nil
+}
+
+/*
+ApplyFiles applies the refactoring to text proto files, returning the changes made. Files are only
+written if every file can be rewritten and dryRun is false. Renaming a variable to a name which is
+already bound in any of the files, or by a let around a reference to the variable, is an error.
+*/
+func (r Refactoring) ApplyFiles(files []string, dryRun bool) ([]Change, error) {
+	contents := map[string]string{}
+	bound := map[string]bool{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %q: %v", file, err)
+		}
+		contents[file] = string(data)
+		for _, match := range field.FindAllStringSubmatch(string(data), -1) {
+			if match[1] == "bind" {
+				bound[match[3]] = true
+			}
+		}
+	}
+	var renamed []string
+	for from := range r.RenameVariables {
+		renamed = append(renamed, from)
+	}
+	sort.Strings(renamed)
+	for _, from := range renamed {
+		if to := r.RenameVariables[from]; bound[to] && to != from {
+			return nil, fmt.Errorf("cannot rename %q to %q, which is already bound", from, to)
+		}
+	}
+
+	var changes []Change
+	rewritten := map[string]string{}
+	for _, file := range files {
+		text, fileChanges, err := r.Apply(file, contents[file])
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, fileChanges...)
+		if len(fileChanges) > 0 {
+			rewritten[file] = text
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+	for _, file := range files {
+		text, ok := rewritten[file]
+		if !ok {
+			continue
+		}
+		if err := writeFile(file, text); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// writeFile replaces a file's contents, keeping its permissions.
+func writeFile(file, text string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("could not write %q: %v", file, err)
+	}
+	if err := ioutil.WriteFile(file, []byte(text), info.Mode()); err != nil {
+		return fmt.Errorf("could not write %q: %v", file, err)
+	}
+	return nil
+}
+
+// unquote decodes the contents of a double quoted text proto string.
+func unquote(s string) (string, error) {
+	// Go does not allow escaped single quotes within double quoted strings, but text protos do.
+	value, err := strconv.Unquote(`"` + strings.Replace(s, `\'`, `'`, -1) + `"`)
+	if err != nil {
+		return "", fmt.Errorf("could not unquote %q: %v", s, err)
+	}
+	return value, nil
+}
+
+// quote encodes a string as a double quoted text proto string.
+func quote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(s) + `"`
+}
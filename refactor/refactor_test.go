@@ -0,0 +1,289 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package refactor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/utils"
+)
+
+const transformations = `# Uptime transformations.
+# bind: "up_time" is documented here.
+
+transformations {
+  bind: "up_time"
+  expressions: "to_int(up_time_cisco) / 100"  # Centiseconds.
+
+  noc_paths {
+    bind: "up_time_cisco"
+    oids: "1.3.6.1.2.1.1.3"
+  }
+}
+
+transformations {
+  bind: "boot_time"
+  expressions: "time_since_epoch(now, 'ntp', 's') - up_time"
+}
+`
+
+const mappings = `nodes {
+  subpath {path: "/system/state/up-time"}
+  bind: "up_time"
+}
+`
+
+func TestApply(t *testing.T) {
+	r := Refactoring{
+		RenameVariables: map[string]string{"up_time": "system_up_time"},
+		RenameFunctions: map[string]string{"time_since_epoch": "epoch"},
+		WrapVariables:   map[string]string{"now": "to_str"},
+	}
+	got, changes, err := r.Apply("transformations.pb", transformations)
+	if err != nil {
+		t.Fatalf("Apply() got error: %v", err)
+	}
+	expected := `# Uptime transformations.
+# bind: "up_time" is documented here.
+
+transformations {
+  bind: "system_up_time"
+  expressions: "to_int(up_time_cisco) / 100"  # Centiseconds.
+
+  noc_paths {
+    bind: "up_time_cisco"
+    oids: "1.3.6.1.2.1.1.3"
+  }
+}
+
+transformations {
+  bind: "boot_time"
+  expressions: "epoch(to_str(now), 'ntp', 's') - system_up_time"
+}
+`
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Apply() returned unexpected text (-expected +got):\n%s", diff)
+	}
+	expectedChanges := []Change{
+		{File: "transformations.pb", Line: 5, Old: "up_time", New: "system_up_time"},
+		{
+			File: "transformations.pb",
+			Line: 16,
+			Old:  "time_since_epoch(now, 'ntp', 's') - up_time",
+			New:  "epoch(to_str(now), 'ntp', 's') - system_up_time",
+		},
+	}
+	if diff := cmp.Diff(expectedChanges, changes); diff != "" {
+		t.Errorf("Apply() returned unexpected changes (-expected +got):\n%s", diff)
+	}
+}
+
+func TestApplyNamespaces(t *testing.T) {
+	r := Refactoring{
+		RenameFunctions: map[string]string{"to_int": "cisco.to_int", "vendor.f": "g"},
+		WrapVariables:   map[string]string{"a": "cisco.to_str"},
+	}
+	got, _, err := r.Apply("file", `expressions: "to_int(a) + vendor.f(b)"`)
+	if err != nil {
+		t.Fatalf("Apply() got error: %v", err)
+	}
+	if expected := `expressions: "cisco.to_int(cisco.to_str(a)) + g(b)"`; got != expected {
+		t.Errorf("Apply() = %v, expected %v", got, expected)
+	}
+}
+
+func TestApplyEscapes(t *testing.T) {
+	r := Refactoring{RenameVariables: map[string]string{"a": "b"}}
+	got, _, err := r.Apply("file", `expressions: "a + \"it's\""`)
+	if err != nil {
+		t.Fatalf("Apply() got error: %v", err)
+	}
+	if expected := `expressions: "b + \"it's\""`; got != expected {
+		t.Errorf("Apply() = %v, expected %v", got, expected)
+	}
+}
+
+func TestApplyMapValues(t *testing.T) {
+	r := Refactoring{RenameVariables: map[string]string{"if_name": "interface_name"}}
+	text := `nodes {
+  subpath {path: "/interfaces/interface[name=if_name]"}
+  map { key: "name" value: "if_name" }
+  children {
+    subpath {path: "subinterfaces/subinterface[index=sub_index]"}
+    map {
+      key: "index"
+      value: "if_name"
+    }
+  }
+}
+vendors { key: "cisco" value: "if_name" }
+transformations {
+  bind: "mtu"
+  expressions: "to_int(mtu_value)"
+  noc_paths {
+    bind: "if_name"
+    oids: "1.3.6.1.2.1.31.1.1.1.1.if_index"
+  }
+}`
+	got, changes, err := r.Apply("file", text)
+	if err != nil {
+		t.Fatalf("Apply() got error: %v", err)
+	}
+	// Values outside the maps of mappings are not variables.
+	expected := `nodes {
+  subpath {path: "/interfaces/interface[name=if_name]"}
+  map { key: "name" value: "interface_name" }
+  children {
+    subpath {path: "subinterfaces/subinterface[index=sub_index]"}
+    map {
+      key: "index"
+      value: "interface_name"
+    }
+  }
+}
+vendors { key: "cisco" value: "if_name" }
+transformations {
+  bind: "mtu"
+  expressions: "to_int(mtu_value)"
+  noc_paths {
+    bind: "interface_name"
+    oids: "1.3.6.1.2.1.31.1.1.1.1.if_index"
+  }
+}`
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Apply() returned unexpected text (-expected +got):\n%s", diff)
+	}
+	var lines []int
+	for _, change := range changes {
+		lines = append(lines, change.Line)
+	}
+	if expected := []int{3, 8, 17}; !cmp.Equal(lines, expected) {
+		t.Errorf("Apply() changed lines %v, expected %v", lines, expected)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		refactoring Refactoring
+		text        string
+	}{
+		{name: "no rewrites", text: transformations},
+		{
+			name:        "invalid identifier",
+			refactoring: Refactoring{RenameVariables: map[string]string{"up_time": "up-time"}},
+			text:        transformations,
+		},
+		{
+			name:        "qualified variable",
+			refactoring: Refactoring{RenameVariables: map[string]string{"up_time": "system.up_time"}},
+			text:        transformations,
+		},
+		{
+			name:        "invalid function name",
+			refactoring: Refactoring{RenameFunctions: map[string]string{"to_int": "cisco..to_int"}},
+			text:        transformations,
+		},
+		{
+			name:        "chained renames",
+			refactoring: Refactoring{RenameFunctions: map[string]string{"a": "b", "b": "c"}},
+			text:        transformations,
+		},
+		{
+			name:        "invalid expression",
+			refactoring: Refactoring{RenameVariables: map[string]string{"a": "b"}},
+			text:        `expressions: "a +"`,
+		},
+		{
+			name:        "rename captured by let",
+			refactoring: Refactoring{RenameVariables: map[string]string{"a": "y"}},
+			text:        `expressions: "let y = 2; a + y"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := test.refactoring.Apply("file", test.text); err == nil {
+				t.Errorf("Apply() expected error, got none")
+			}
+		})
+	}
+}
+
+func TestApplyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "refactor")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	transformationsFile := filepath.Join(dir, "transformations.pb")
+	mappingsFile := filepath.Join(dir, "mappings.pb")
+	files := []string{mappingsFile, transformationsFile}
+	for file, text := range map[string]string{transformationsFile: transformations, mappingsFile: mappings} {
+		if err := ioutil.WriteFile(file, []byte(text), 0644); err != nil {
+			t.Fatalf("Error during test set up: %v", err)
+		}
+	}
+
+	clash := Refactoring{RenameVariables: map[string]string{"up_time": "boot_time"}}
+	if _, err := clash.ApplyFiles(files, false); err == nil {
+		t.Errorf("ApplyFiles() renaming to a bound name expected error, got none")
+	}
+	letFile := filepath.Join(dir, "let.pb")
+	if err := ioutil.WriteFile(letFile, []byte(`transformations { bind: "up_days" expressions: "let days = 86400; up_time / days" }`), 0644); err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	captured := Refactoring{RenameVariables: map[string]string{"up_time": "days"}}
+	if _, err := captured.ApplyFiles(append([]string{letFile}, files...), false); err == nil {
+		t.Errorf("ApplyFiles() renaming to a name bound by a let expected error, got none")
+	}
+	if data, _ := ioutil.ReadFile(mappingsFile); string(data) != mappings {
+		t.Errorf("ApplyFiles() which failed modified %v", mappingsFile)
+	}
+
+	r := Refactoring{RenameVariables: map[string]string{"up_time": "system_up_time"}}
+	changes, err := r.ApplyFiles(files, true)
+	if err != nil {
+		t.Fatalf("ApplyFiles() dry run got error: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("ApplyFiles() dry run made %d changes, expected 3: %v", len(changes), changes)
+	}
+	if data, _ := ioutil.ReadFile(mappingsFile); string(data) != mappings {
+		t.Errorf("ApplyFiles() dry run modified %v", mappingsFile)
+	}
+
+	if _, err := r.ApplyFiles(files, false); err != nil {
+		t.Fatalf("ApplyFiles() got error: %v", err)
+	}
+	loadedMappings, err := utils.LoadMappings(mappingsFile)
+	if err != nil {
+		t.Fatalf("LoadMappings() got error: %v", err)
+	}
+	if got := loadedMappings.GetNodes()[0].GetBind(); got != "system_up_time" {
+		t.Errorf("mapping is bound to %q, expected %q", got, "system_up_time")
+	}
+	loadedTransformations, err := utils.LoadTransformations(transformationsFile)
+	if err != nil {
+		t.Fatalf("LoadTransformations() got error: %v", err)
+	}
+	if got := loadedTransformations.GetTransformations()[0].GetBind(); got != "system_up_time" {
+		t.Errorf("transformation is bound to %q, expected %q", got, "system_up_time")
+	}
+}
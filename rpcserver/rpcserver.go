@@ -0,0 +1,205 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package rpcserver implements the Orismologer gRPC service (see proto/service.proto), so that
+Orismologer can run as a shared central service which many collectors and the CLI talk to remotely.
+*/
+package rpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/orismologer/lint"
+	"github.com/google/orismologer/orismologer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Server implements the Orismologer gRPC service over a set of config namespaces.
+type Server struct {
+	namespaces *orismologer.Namespaces
+	functions  lint.FunctionSet
+}
+
+var _ pb.OrismologerServer = (*Server)(nil)
+
+// NewServer returns a server for the given namespaces.
+func NewServer(namespaces *orismologer.Namespaces) *Server {
+	return &Server{
+		namespaces: namespaces,
+		functions:  orismologer.Functions(),
+	}
+}
+
+func (s *Server) namespace(name string) (*orismologer.Orismologer, error) {
+	o, err := s.namespaces.Get(name)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	}
+	return o, nil
+}
+
+/*
+Eval evaluates an OpenConfig leaf for a target, with any tags added by post-processors. A leaf
+dropped by a post-processor is not found.
+*/
+func (s *Server) Eval(ctx context.Context, req *pb.EvalRequest) (*pb.EvalResponse, error) {
+	o, err := s.namespace(req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	result, err := o.EvalResult(req.GetPath(), req.GetTarget(), req.GetVendor())
+	if errors.Is(err, orismologer.ErrDropped) {
+		return nil, status.Errorf(codes.NotFound, "%q is not available for target %q: %v", req.GetPath(), req.GetTarget(), err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not evaluate %q for target %q: %v", req.GetPath(), req.GetTarget(), err)
+	}
+	value, err := ToValue(result.Value)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not encode value of %q: %v", req.GetPath(), err)
+	}
+	return &pb.EvalResponse{Value: value, Tags: result.Tags}, nil
+}
+
+/*
+EvalSubtree evaluates every leaf beneath an OpenConfig path for a target. Leaves which cannot be
+evaluated are reported with the reason, rather than failing the request, and leaves dropped by
+post-processors are omitted.
+*/
+func (s *Server) EvalSubtree(ctx context.Context, req *pb.EvalSubtreeRequest) (*pb.EvalSubtreeResponse, error) {
+	o, err := s.namespace(req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := o.Leaves(req.GetRoot())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "path %q is not mapped: %v", req.GetRoot(), err)
+	}
+	resp := &pb.EvalSubtreeResponse{}
+	for _, leaf := range leaves {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		result := &pb.EvalSubtreeResponse_Leaf{Path: leaf}
+		evaluated, err := o.EvalResult(leaf, req.GetTarget(), req.GetVendor())
+		if errors.Is(err, orismologer.ErrDropped) {
+			continue
+		}
+		if err == nil {
+			var v *pb.Value
+			if v, err = ToValue(evaluated.Value); err == nil {
+				result.Result = &pb.EvalSubtreeResponse_Leaf_Value{Value: v}
+				result.Tags = evaluated.Tags
+			}
+		}
+		if err != nil {
+			result.Result = &pb.EvalSubtreeResponse_Leaf_Error{Error: err.Error()}
+		}
+		resp.Leaves = append(resp.Leaves, result)
+	}
+	return resp, nil
+}
+
+// Validate lints candidate Mappings and Transformations.
+func (s *Server) Validate(ctx context.Context, req *pb.ValidateRequest) (*pb.ValidateResponse, error) {
+	findings := lint.Lint(req.GetMappings(), req.GetTransformations(), s.functions)
+	resp := &pb.ValidateResponse{Ok: !lint.HasErrors(findings)}
+	for _, finding := range findings {
+		resp.Findings = append(resp.Findings, &pb.ValidateResponse_Finding{
+			Check:    finding.Check,
+			Severity: finding.Severity.String(),
+			Subject:  finding.Subject,
+			Message:  finding.Message,
+		})
+	}
+	return resp, nil
+}
+
+// Coverage reports which leaves beneath an OpenConfig path are supported for a vendor.
+func (s *Server) Coverage(ctx context.Context, req *pb.CoverageRequest) (*pb.CoverageResponse, error) {
+	o, err := s.namespace(req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	supported, unsupported, err := o.Coverage(req.GetRoot(), req.GetVendor())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "path %q is not mapped: %v", req.GetRoot(), err)
+	}
+	return &pb.CoverageResponse{Supported: supported, Unsupported: unsupported}, nil
+}
+
+// Reload reloads a namespace's config from the files it was loaded from.
+func (s *Server) Reload(ctx context.Context, req *pb.ReloadRequest) (*pb.ReloadResponse, error) {
+	if _, err := s.namespace(req.GetNamespace()); err != nil {
+		return nil, err
+	}
+	if err := s.namespaces.Reload(req.GetNamespace()); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	o, err := s.namespace(req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReloadResponse{Checksum: o.Manifest().Checksum}, nil
+}
+
+// ToValue converts a value produced by Orismologer to a Value proto.
+func ToValue(value interface{}) (*pb.Value, error) {
+	switch v := value.(type) {
+	case string:
+		return &pb.Value{Value: &pb.Value_StringVal{StringVal: v}}, nil
+	case float64:
+		return &pb.Value{Value: &pb.Value_DoubleVal{DoubleVal: v}}, nil
+	case int:
+		return &pb.Value{Value: &pb.Value_IntVal{IntVal: int64(v)}}, nil
+	case int64:
+		return &pb.Value{Value: &pb.Value_IntVal{IntVal: v}}, nil
+	case uint64:
+		return &pb.Value{Value: &pb.Value_UintVal{UintVal: v}}, nil
+	case bool:
+		return &pb.Value{Value: &pb.Value_BoolVal{BoolVal: v}}, nil
+	case []byte:
+		return &pb.Value{Value: &pb.Value_BytesVal{BytesVal: v}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// FromValue converts a Value proto back to the Go value Orismologer produced.
+func FromValue(value *pb.Value) interface{} {
+	switch v := value.GetValue().(type) {
+	case *pb.Value_StringVal:
+		return v.StringVal
+	case *pb.Value_DoubleVal:
+		return v.DoubleVal
+	case *pb.Value_IntVal:
+		return v.IntVal
+	case *pb.Value_UintVal:
+		return v.UintVal
+	case *pb.Value_BoolVal:
+		return v.BoolVal
+	case *pb.Value_BytesVal:
+		return v.BytesVal
+	default:
+		return nil
+	}
+}
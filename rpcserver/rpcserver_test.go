@@ -0,0 +1,243 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpcserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/fixtures"
+	"github.com/google/orismologer/orismologer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func testConfig() *fixtures.Builder {
+	return fixtures.New().
+		Vendor("cisco", "9").
+		Vendor("aruba", "14823").
+		Leaf("/system/state/up-time", "up_time").
+		Leaf("/system/state/hostname", "hostname").
+		Transformation("up_time", "to_int(up_time_cisco) / 100").
+		NocPath("up_time", "up_time_cisco", "1.3.6.1.4.1.9.1", "2000").
+		Transformation("hostname", "hostname_aruba", "hostname_cisco").
+		NocPath("hostname", "hostname_aruba", "1.3.6.1.4.1.14823.2", "ap1").
+		NocPath("hostname", "hostname_cisco", "1.3.6.1.4.1.9.2")
+}
+
+// makeServer returns a server whose default namespace is loaded from files in a temporary directory.
+func makeServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "rpcserver")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	mappingsFile, transformationsFile, vendorOidsFile, err := testConfig().WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	namespaces := orismologer.NewNamespaces()
+	if err := namespaces.Load(orismologer.DefaultNamespace, mappingsFile, transformationsFile, vendorOidsFile); err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	return NewServer(namespaces), func() { os.RemoveAll(dir) }
+}
+
+func TestEval(t *testing.T) {
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	for _, test := range []struct {
+		name     string
+		req      *pb.EvalRequest
+		expected interface{}
+		code     codes.Code
+	}{
+		{
+			name:     "leaf",
+			req:      &pb.EvalRequest{Path: "/system/state/up-time", Target: "switch1", Vendor: "cisco"},
+			expected: 20.0,
+		},
+		{
+			name: "unsupported vendor",
+			req:  &pb.EvalRequest{Path: "/system/state/up-time", Target: "ap1", Vendor: "aruba"},
+			code: codes.Unavailable,
+		},
+		{
+			name: "unknown namespace",
+			req:  &pb.EvalRequest{Namespace: "unknown", Path: "/system/state/up-time"},
+			code: codes.NotFound,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.Eval(context.Background(), test.req)
+			if code := status.Code(err); code != test.code {
+				t.Fatalf("Eval() got code %v (%v), expected %v", code, err, test.code)
+			}
+			if err == nil && !cmp.Equal(FromValue(resp.GetValue()), test.expected) {
+				t.Errorf("Eval() = %v, expected %v", FromValue(resp.GetValue()), test.expected)
+			}
+		})
+	}
+}
+
+func TestEvalSubtree(t *testing.T) {
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	got, err := s.EvalSubtree(context.Background(), &pb.EvalSubtreeRequest{Root: "/system", Target: "ap1", Vendor: "aruba"})
+	if err != nil {
+		t.Fatalf("EvalSubtree() got error: %v", err)
+	}
+	if len(got.GetLeaves()) != 2 {
+		t.Fatalf("EvalSubtree() returned %d leaves, expected 2: %v", len(got.GetLeaves()), got)
+	}
+	for _, leaf := range got.GetLeaves() {
+		switch leaf.GetPath() {
+		case "/system/state/hostname":
+			if FromValue(leaf.GetValue()) != "ap1" {
+				t.Errorf("EvalSubtree() %v = %v, expected %q", leaf.GetPath(), leaf, "ap1")
+			}
+		case "/system/state/up-time":
+			if leaf.GetError() == "" {
+				t.Errorf("EvalSubtree() %v = %v, expected error", leaf.GetPath(), leaf)
+			}
+		default:
+			t.Errorf("EvalSubtree() returned unexpected leaf %v", leaf)
+		}
+	}
+}
+
+func TestEvalPostProcessed(t *testing.T) {
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	o, err := s.namespaces.Get(orismologer.DefaultNamespace)
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	o.AddPostProcessor(orismologer.PostProcessorFunc(func(result *orismologer.Result) (bool, error) {
+		result.Tag("site", "lon")
+		return result.Path != "/system/state/up-time", nil
+	}))
+
+	resp, err := s.Eval(context.Background(), &pb.EvalRequest{Path: "/system/state/hostname", Target: "ap1", Vendor: "aruba"})
+	if err != nil {
+		t.Fatalf("Eval() got error: %v", err)
+	}
+	if expected := map[string]string{"site": "lon"}; !cmp.Equal(resp.GetTags(), expected) {
+		t.Errorf("Eval() returned tags %v, expected %v", resp.GetTags(), expected)
+	}
+	if _, err := s.Eval(context.Background(), &pb.EvalRequest{Path: "/system/state/up-time", Target: "switch1", Vendor: "cisco"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Eval() of a dropped leaf got error %v, expected code %v", err, codes.NotFound)
+	}
+
+	got, err := s.EvalSubtree(context.Background(), &pb.EvalSubtreeRequest{Root: "/system", Target: "ap1", Vendor: "aruba"})
+	if err != nil {
+		t.Fatalf("EvalSubtree() got error: %v", err)
+	}
+	// The up time cannot be evaluated for aruba, so is reported rather than dropped.
+	if len(got.GetLeaves()) != 2 || got.GetLeaves()[1].GetTags()["site"] != "lon" {
+		t.Errorf("EvalSubtree() = %v, expected 2 leaves, the hostname tagged", got)
+	}
+	got, err = s.EvalSubtree(context.Background(), &pb.EvalSubtreeRequest{Root: "/system", Target: "switch1", Vendor: "cisco"})
+	if err != nil {
+		t.Fatalf("EvalSubtree() got error: %v", err)
+	}
+	for _, leaf := range got.GetLeaves() {
+		if leaf.GetPath() == "/system/state/up-time" {
+			t.Errorf("EvalSubtree() returned the dropped leaf %v", leaf)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	b := testConfig().Transformation("up_time", "undefined_variable")
+	got, err := s.Validate(context.Background(), &pb.ValidateRequest{Mappings: b.Mappings(), Transformations: b.Transformations()})
+	if err != nil {
+		t.Fatalf("Validate() got error: %v", err)
+	}
+	if got.GetOk() || len(got.GetFindings()) == 0 {
+		t.Errorf("Validate() = %v, expected errors", got)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	got, err := s.Coverage(context.Background(), &pb.CoverageRequest{Root: "/", Vendor: "aruba"})
+	if err != nil {
+		t.Fatalf("Coverage() got error: %v", err)
+	}
+	expected := &pb.CoverageResponse{
+		Supported:   []string{"/system/state/hostname"},
+		Unsupported: []string{"/system/state/up-time"},
+	}
+	if !proto.Equal(got, expected) {
+		t.Errorf("Coverage() = %v, expected %v", got, expected)
+	}
+}
+
+func TestReloadOverGRPC(t *testing.T) {
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterOrismologerServer(server, s)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("Dial() got error: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewOrismologerClient(conn)
+
+	got, err := client.Reload(context.Background(), &pb.ReloadRequest{})
+	if err != nil {
+		t.Fatalf("Reload() got error: %v", err)
+	}
+	if got.GetChecksum() == "" {
+		t.Errorf("Reload() returned no checksum")
+	}
+	if _, err := client.Reload(context.Background(), &pb.ReloadRequest{Namespace: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Reload() of unknown namespace got %v, expected code %v", err, codes.NotFound)
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	for _, value := range []interface{}{"a", 1.5, int64(-1), uint64(1 << 63), true, []byte{0, 0xff}} {
+		v, err := ToValue(value)
+		if err != nil {
+			t.Errorf("ToValue(%v) got error: %v", value, err)
+			continue
+		}
+		if got := FromValue(v); !cmp.Equal(got, value) {
+			t.Errorf("FromValue(ToValue(%v)) = %v (%T), expected %v (%T)", value, got, got, value, value)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package simulation provides an in-memory fleet of fake targets with scripted OID and CLI responses
+and failure modes (latency, timeouts, partial tables, unreachable devices), so that the scheduler,
+caches and streaming subsystems can be exercised end to end, and soak tested, without hardware. eg:
+
+	fleet := simulation.Generate(100, 1, func(i int) *simulation.Device {
+		return &simulation.Device{
+			Vendor: "cisco",
+			OIDs: map[string]simulation.Response{
+				"1.3.6.1.2.1.1.3":         simulation.Counter(0, 100, 32),
+				"1.3.6.1.2.1.2.2.1.10.1": simulation.Counter(math.MaxUint32-10, 7, 32),
+			},
+			Faults: simulation.Faults{TimeoutRate: 0.01, Timeout: 10 * time.Millisecond},
+		}
+	})
+	o.SetResolver(fleet.Resolve)
+	scheduler := &collector.Scheduler{Evaluator: o, Inventory: fleet.Inventory(), ...}
+
+Responses are strings, as with values read from real devices.
+*/
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/orismologer/orismologer"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Errors returned by simulated devices, which are not wrapped so callers can compare them.
+var (
+	// ErrTimeout is returned for requests to devices which are down or which time out.
+	ErrTimeout = errors.New("request timed out")
+	// ErrNoSuchObject is returned for OIDs and commands a device has no response for.
+	ErrNoSuchObject = errors.New("no such object")
+)
+
+/*
+Response produces a device's response to a request, given the number of times the same OID or
+command has been requested before (starting from 0).
+*/
+type Response func(request int) (string, error)
+
+// Static returns a Response which is always the given value.
+func Static(value string) Response {
+	return func(int) (string, error) {
+		return value, nil
+	}
+}
+
+// Sequence returns a Response which cycles through the given values.
+func Sequence(values ...string) Response {
+	return func(request int) (string, error) {
+		if len(values) == 0 {
+			return "", ErrNoSuchObject
+		}
+		return values[request%len(values)], nil
+	}
+}
+
+/*
+Counter returns a Response which starts at start and grows by increment with each request, wrapping
+as an SNMP counter of the given number of bits (32 or 64) would.
+*/
+func Counter(start, increment uint64, bits uint) Response {
+	return func(request int) (string, error) {
+		value := start + increment*uint64(request)
+		if bits < 64 {
+			value &= 1<<bits - 1
+		}
+		return strconv.FormatUint(value, 10), nil
+	}
+}
+
+// Failing returns a Response which always fails with the given error.
+func Failing(err error) Response {
+	return func(int) (string, error) {
+		return "", err
+	}
+}
+
+// Faults describes how a device misbehaves. The zero value is a device which always responds at once.
+type Faults struct {
+	Latency     time.Duration // Delay before every response.
+	TimeoutRate float64       // Probability [0, 1] that a request times out.
+	Timeout     time.Duration // How long a request which times out takes to fail.
+	/*
+		Probability [0, 1] that an OID is missing from a response, as when a device returns a partial
+		table. Commands are unaffected.
+	*/
+	MissingRate float64
+	Down        bool // Whether every request times out, ie: the device is unreachable.
+}
+
+// Device is a simulated target. Its fields must not be modified once it belongs to a Fleet.
+type Device struct {
+	Name        string
+	Vendor      string
+	Address     string
+	OIDs        map[string]Response // Responses to dot-notation OIDs, including any instance suffix.
+	Commands    map[string]Response // Responses to CLI commands.
+	Faults      Faults
+	Credentials map[string]string
+}
+
+/*
+Fleet is a collection of simulated devices. Randomised faults are drawn from a single seeded source,
+so a fleet given the same seed and the same sequence of requests misbehaves identically. It is safe
+for concurrent use.
+*/
+type Fleet struct {
+	devices map[string]*Device
+	names   []string
+
+	mu         sync.Mutex
+	rand       *rand.Rand
+	requests   map[string]int // Requests made so far, keyed by target and then OID or command.
+	operations map[string]int // Round trips made so far (eg: PDUs sent), keyed by target.
+	down       map[string]bool
+}
+
+// NewFleet returns a fleet of the given devices, which must have unique names.
+func NewFleet(seed int64, devices ...*Device) (*Fleet, error) {
+	f := &Fleet{
+		devices:    map[string]*Device{},
+		rand:       rand.New(rand.NewSource(seed)),
+		requests:   map[string]int{},
+		operations: map[string]int{},
+		down:       map[string]bool{},
+	}
+	for _, device := range devices {
+		if device.Name == "" {
+			return nil, errors.New("device has no name")
+		}
+		if _, ok := f.devices[device.Name]; ok {
+			return nil, fmt.Errorf("device %q is defined more than once", device.Name)
+		}
+		f.devices[device.Name] = device
+		f.names = append(f.names, device.Name)
+		f.down[device.Name] = device.Faults.Down
+	}
+	sort.Strings(f.names)
+	return f, nil
+}
+
+/*
+Generate returns a fleet of n devices built by the given function. Devices without names are named
+"device-<i>".
+*/
+func Generate(n int, seed int64, device func(i int) *Device) *Fleet {
+	devices := make([]*Device, n)
+	for i := range devices {
+		devices[i] = device(i)
+		if devices[i].Name == "" {
+			devices[i].Name = fmt.Sprintf("device-%d", i)
+		}
+	}
+	f, err := NewFleet(seed, devices...)
+	if err != nil {
+		// Only generated names are unique by construction.
+		panic(fmt.Sprintf("could not generate fleet: %v", err))
+	}
+	return f
+}
+
+/*
+SampleResponses returns static responses to the OIDs of every NocPath in the given transformations,
+using each NocPath's first sample. NocPaths without samples are omitted.
+*/
+func SampleResponses(transformations *pb.Transformations) map[string]Response {
+	responses := map[string]Response{}
+	for _, transformation := range transformations.GetTransformations() {
+		for _, nocPath := range transformation.GetNocPaths() {
+			if len(nocPath.GetSamples()) == 0 {
+				continue
+			}
+			for _, oid := range nocPath.GetOids() {
+				responses[oid] = Static(nocPath.GetSamples()[0])
+			}
+		}
+	}
+	return responses
+}
+
+// Inventory returns an inventory of the fleet's devices, sorted by name.
+func (f *Fleet) Inventory() *pb.Inventory {
+	inventory := &pb.Inventory{}
+	for _, name := range f.names {
+		device := f.devices[name]
+		inventory.Targets = append(inventory.Targets, &pb.Target{
+			Name:        device.Name,
+			Vendor:      device.Vendor,
+			Address:     device.Address,
+			Credentials: device.Credentials,
+		})
+	}
+	return inventory
+}
+
+// Device returns the device of the given name, or nil if there is none.
+func (f *Fleet) Device(name string) *Device {
+	return f.devices[name]
+}
+
+// SetDown marks a device as unreachable, or as reachable again, overriding its Faults.
+func (f *Fleet) SetDown(name string, down bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.devices[name]; !ok {
+		return fmt.Errorf("no such device %q", name)
+	}
+	f.down[name] = down
+	return nil
+}
+
+// Requests returns the number of times the given OID or command has been requested from a target.
+func (f *Fleet) Requests(target, request string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[target+"\x00"+request]
+}
+
+/*
+Operations returns the number of round trips made to a target, eg: a get of several OIDs counts
+once. Compare with Requests to see the effect of batching (see orismologer.Plan).
+*/
+func (f *Fleet) Operations(target string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.operations[target]
+}
+
+/*
+Resolve resolves a NocPath against the simulated target, trying its OIDs in order. Its signature
+matches Orismologer's NocPath resolvers (see Orismologer.SetResolver).
+*/
+func (f *Fleet) Resolve(nocPath *pb.NocPath, target string) (interface{}, error) {
+	device, err := f.reachable(context.Background(), target)
+	if err != nil {
+		return nil, err
+	}
+	for _, oid := range nocPath.GetOids() {
+		response, ok := device.OIDs[oid]
+		if !ok {
+			continue
+		}
+		request, missing := f.request(device, oid, device.Faults.MissingRate)
+		if missing {
+			continue
+		}
+		return response(request)
+	}
+	return nil, ErrNoSuchObject
+}
+
+// Get returns the target's response to a single OID.
+func (f *Fleet) Get(ctx context.Context, target, oid string) (string, error) {
+	device, err := f.reachable(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	response, ok := device.OIDs[oid]
+	if !ok {
+		return "", ErrNoSuchObject
+	}
+	request, missing := f.request(device, oid, device.Faults.MissingRate)
+	if missing {
+		return "", ErrNoSuchObject
+	}
+	return response(request)
+}
+
+/*
+Walk returns the target's responses to every OID under the given prefix, keyed by OID. With a
+MissingRate, rows are dropped at random, as with partial tables.
+*/
+func (f *Fleet) Walk(ctx context.Context, target, prefix string) (map[string]string, error) {
+	device, err := f.reachable(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	rows := map[string]string{}
+	for oid, response := range device.OIDs {
+		if oid != prefix && !strings.HasPrefix(oid, prefix+".") {
+			continue
+		}
+		request, missing := f.request(device, oid, device.Faults.MissingRate)
+		if missing {
+			continue
+		}
+		value, err := response(request)
+		if err != nil {
+			return nil, err
+		}
+		rows[oid] = value
+	}
+	return rows, nil
+}
+
+/*
+Execute executes a plan with one round trip per get PDU and per walk, so a fleet can stand in for an
+orismologer.BatchResolver. OIDs the target has no (or a failing) response for are omitted. It fails if
+any round trip times out.
+*/
+func (f *Fleet) Execute(plan *orismologer.Plan) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, pdu := range plan.Gets {
+		device, err := f.reachable(context.Background(), plan.Target)
+		if err != nil {
+			return nil, err
+		}
+		for _, oid := range pdu {
+			response, ok := device.OIDs[oid]
+			if !ok {
+				continue
+			}
+			request, missing := f.request(device, oid, device.Faults.MissingRate)
+			if missing {
+				continue
+			}
+			if value, err := response(request); err == nil {
+				values[oid] = value
+			}
+		}
+	}
+	for _, walk := range plan.Walks {
+		rows, err := f.Walk(context.Background(), plan.Target, walk)
+		if err != nil {
+			return nil, err
+		}
+		for oid, value := range rows {
+			values[oid] = value
+		}
+	}
+	return values, nil
+}
+
+// Exec returns the target's output for a CLI command.
+func (f *Fleet) Exec(ctx context.Context, target, command string) (string, error) {
+	device, err := f.reachable(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	response, ok := device.Commands[command]
+	if !ok {
+		return "", ErrNoSuchObject
+	}
+	request, _ := f.request(device, command, 0)
+	return response(request)
+}
+
+/*
+Probe checks that a target is reachable, so a fleet can stand in for a health.Prober. It fails for
+devices which are down or which time out.
+*/
+func (f *Fleet) Probe(ctx context.Context, target *pb.Target) error {
+	_, err := f.reachable(ctx, target.GetName())
+	return err
+}
+
+/*
+reachable looks up a device and simulates its latency and timeouts, returning an error if the
+request fails or ctx is done first.
+*/
+func (f *Fleet) reachable(ctx context.Context, target string) (*Device, error) {
+	device, ok := f.devices[target]
+	if !ok {
+		return nil, fmt.Errorf("no such target %q", target)
+	}
+	f.mu.Lock()
+	f.operations[target]++
+	timeout := f.down[target] || device.Faults.TimeoutRate > 0 && f.rand.Float64() < device.Faults.TimeoutRate
+	f.mu.Unlock()
+	delay := device.Faults.Latency
+	if timeout {
+		delay = device.Faults.Timeout
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if timeout {
+		return nil, ErrTimeout
+	}
+	return device, nil
+}
+
+/*
+request counts a request to a device, returning how many came before it and whether the response
+should be dropped, given the probability of that.
+*/
+func (f *Fleet) request(device *Device, request string, missingRate float64) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if missingRate > 0 && f.rand.Float64() < missingRate {
+		return 0, true
+	}
+	key := device.Name + "\x00" + request
+	n := f.requests[key]
+	f.requests[key]++
+	return n, false
+}
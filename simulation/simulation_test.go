@@ -0,0 +1,433 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulation
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/orismologer/collector"
+	"github.com/google/orismologer/fixtures"
+	"github.com/google/orismologer/orismologer"
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func responses(t *testing.T, response Response, n int) []string {
+	t.Helper()
+	var values []string
+	for i := 0; i < n; i++ {
+		value, err := response(i)
+		if err != nil {
+			t.Fatalf("response(%d) got error: %v", i, err)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestResponses(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		response Response
+		expected []string
+	}{
+		{name: "static", response: Static("x"), expected: []string{"x", "x", "x"}},
+		{name: "sequence", response: Sequence("a", "b"), expected: []string{"a", "b", "a"}},
+		{name: "counter", response: Counter(10, 5, 64), expected: []string{"10", "15", "20"}},
+		{
+			name:     "32 bit counter wraps",
+			response: Counter(math.MaxUint32-1, 2, 32),
+			expected: []string{"4294967294", "0", "2"},
+		},
+		{
+			name:     "64 bit counter wraps",
+			response: Counter(math.MaxUint64, 1, 64),
+			expected: []string{"18446744073709551615", "0", "1"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := responses(t, test.response, len(test.expected))
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("responses differ (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewFleet(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		devices      []*Device
+		expectsError bool
+	}{
+		{name: "valid", devices: []*Device{{Name: "a"}, {Name: "b"}}},
+		{name: "no name", devices: []*Device{{}}, expectsError: true},
+		{name: "duplicate name", devices: []*Device{{Name: "a"}, {Name: "a"}}, expectsError: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewFleet(1, test.devices...)
+			if test.expectsError && err == nil {
+				t.Errorf("NewFleet() expected error, got none")
+			}
+			if !test.expectsError && err != nil {
+				t.Errorf("NewFleet() got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestInventory(t *testing.T) {
+	fleet := Generate(3, 1, func(i int) *Device {
+		return &Device{Vendor: "cisco", Address: "10.0.0." + strconv.Itoa(i)}
+	})
+	expected := &pb.Inventory{Targets: []*pb.Target{
+		{Name: "device-0", Vendor: "cisco", Address: "10.0.0.0"},
+		{Name: "device-1", Vendor: "cisco", Address: "10.0.0.1"},
+		{Name: "device-2", Vendor: "cisco", Address: "10.0.0.2"},
+	}}
+	if got := fleet.Inventory(); !proto.Equal(got, expected) {
+		t.Errorf("Inventory() = %v, expected %v", got, expected)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fleet, err := NewFleet(1, &Device{
+		Name: "router",
+		OIDs: map[string]Response{
+			"1.2.2":   Counter(0, 1, 32),
+			"1.2.3.1": Failing(errors.New("bad value")),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewFleet() got error: %v", err)
+	}
+	for _, test := range []struct {
+		name         string
+		target       string
+		oids         []string
+		expected     interface{}
+		expectsError bool
+	}{
+		{name: "first OID", target: "router", oids: []string{"1.2.2", "1.2.3.1"}, expected: "0"},
+		{name: "falls back to later OIDs", target: "router", oids: []string{"1.9", "1.2.2"}, expected: "1"},
+		{name: "no such OID", target: "router", oids: []string{"1.9"}, expectsError: true},
+		{name: "failing response", target: "router", oids: []string{"1.2.3.1"}, expectsError: true},
+		{name: "no such target", target: "switch", oids: []string{"1.2.2"}, expectsError: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := fleet.Resolve(&pb.NocPath{Bind: "x", Oids: test.oids}, test.target)
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("Resolve() expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() got error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("Resolve() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+	if got := fleet.Requests("router", "1.2.2"); got != 2 {
+		t.Errorf("Requests() = %d, expected 2", got)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	fleet, err := NewFleet(1,
+		&Device{Name: "down", OIDs: map[string]Response{"1.1": Static("x")}, Faults: Faults{Down: true}},
+		&Device{Name: "flaky", OIDs: map[string]Response{"1.1": Static("x")}, Faults: Faults{TimeoutRate: 0.5}},
+		&Device{Name: "slow", OIDs: map[string]Response{"1.1": Static("x")}, Faults: Faults{Latency: 20 * time.Millisecond}},
+		&Device{Name: "hung", OIDs: map[string]Response{"1.1": Static("x")}, Faults: Faults{Down: true, Timeout: time.Hour}},
+	)
+	if err != nil {
+		t.Fatalf("NewFleet() got error: %v", err)
+	}
+
+	if _, err := fleet.Get(ctx, "down", "1.1"); err != ErrTimeout {
+		t.Errorf("Get() from a device which is down got error %v, expected %v", err, ErrTimeout)
+	}
+	if err := fleet.SetDown("down", false); err != nil {
+		t.Fatalf("SetDown() got error: %v", err)
+	}
+	if _, err := fleet.Get(ctx, "down", "1.1"); err != nil {
+		t.Errorf("Get() from a device which is back up got error: %v", err)
+	}
+	if err := fleet.SetDown("unknown", true); err == nil {
+		t.Errorf("SetDown() for an unknown device expected error, got none")
+	}
+
+	timeouts := 0
+	const requests = 1000
+	for i := 0; i < requests; i++ {
+		if _, err := fleet.Get(ctx, "flaky", "1.1"); err == ErrTimeout {
+			timeouts++
+		}
+	}
+	if timeouts < requests/3 || timeouts > requests*2/3 {
+		t.Errorf("%d of %d requests timed out, expected about half", timeouts, requests)
+	}
+
+	start := time.Now()
+	if _, err := fleet.Get(ctx, "slow", "1.1"); err != nil {
+		t.Errorf("Get() from a slow device got error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Get() from a slow device took %v, expected at least 20ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := fleet.Probe(ctx, &pb.Target{Name: "hung"}); err != context.DeadlineExceeded {
+		t.Errorf("Probe() of a hung device got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFaultsAreDeterministic(t *testing.T) {
+	outcomes := func() []bool {
+		fleet := Generate(1, 42, func(int) *Device {
+			return &Device{OIDs: map[string]Response{"1.1": Static("x")}, Faults: Faults{TimeoutRate: 0.3}}
+		})
+		var results []bool
+		for i := 0; i < 50; i++ {
+			_, err := fleet.Get(context.Background(), "device-0", "1.1")
+			results = append(results, err == nil)
+		}
+		return results
+	}
+	if diff := cmp.Diff(outcomes(), outcomes()); diff != "" {
+		t.Errorf("fleets with the same seed behaved differently (-first +second):\n%s", diff)
+	}
+}
+
+func TestWalkPartialTables(t *testing.T) {
+	oids := map[string]Response{"1.3.9": Static("other")}
+	const rows = 200
+	for i := 0; i < rows; i++ {
+		oids["1.3.1."+strconv.Itoa(i)] = Static(strconv.Itoa(i))
+	}
+	fleet, err := NewFleet(1,
+		&Device{Name: "complete", OIDs: oids},
+		&Device{Name: "partial", OIDs: oids, Faults: Faults{MissingRate: 0.25}},
+	)
+	if err != nil {
+		t.Fatalf("NewFleet() got error: %v", err)
+	}
+	complete, err := fleet.Walk(context.Background(), "complete", "1.3.1")
+	if err != nil {
+		t.Fatalf("Walk() got error: %v", err)
+	}
+	if len(complete) != rows {
+		t.Errorf("Walk() of a complete table returned %d rows, expected %d", len(complete), rows)
+	}
+	partial, err := fleet.Walk(context.Background(), "partial", "1.3.1")
+	if err != nil {
+		t.Fatalf("Walk() got error: %v", err)
+	}
+	if len(partial) < rows/2 || len(partial) >= rows {
+		t.Errorf("Walk() of a partial table returned %d of %d rows, expected about 3/4", len(partial), rows)
+	}
+	for oid, value := range partial {
+		if !strings.HasSuffix(oid, "."+value) {
+			t.Errorf("Walk() returned %q for OID %q", value, oid)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	fleet, err := NewFleet(1, &Device{
+		Name:     "router",
+		Commands: map[string]Response{"show version": Sequence("v1", "v2")},
+	})
+	if err != nil {
+		t.Fatalf("NewFleet() got error: %v", err)
+	}
+	for _, expected := range []string{"v1", "v2", "v1"} {
+		got, err := fleet.Exec(context.Background(), "router", "show version")
+		if err != nil {
+			t.Fatalf("Exec() got error: %v", err)
+		}
+		if got != expected {
+			t.Errorf("Exec() = %q, expected %q", got, expected)
+		}
+	}
+	if _, err := fleet.Exec(context.Background(), "router", "show clock"); err != ErrNoSuchObject {
+		t.Errorf("Exec() of an unknown command got error %v, expected %v", err, ErrNoSuchObject)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simulation")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b := fixtures.New().
+		Vendor("cisco", "9").
+		Leaf("/system/state/up-time", "up_time").
+		Leaf("/system/state/hostname", "hostname").
+		Leaf("/system/state/domain-name", "domain_name").
+		Transformation("up_time", "to_int(up_time_ticks) / 100").
+		NocPath("up_time", "up_time_ticks", "1.3.6.1.2.1.1.3.0", "0").
+		Transformation("hostname", "sys_name").
+		NocPath("hostname", "sys_name", "1.3.6.1.2.1.1.5.0", "").
+		Transformation("domain_name", "domain").
+		NocPath("domain_name", "domain", "1.3.6.1.4.1.9.2.1.4.0", "")
+	mappingsFile, transformationsFile, vendorOidsFile, err := b.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("WriteFiles() got error: %v", err)
+	}
+	o, err := orismologer.NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile)
+	if err != nil {
+		t.Fatalf("NewOrismologer() got error: %v", err)
+	}
+	fleet, err := NewFleet(1, &Device{Name: "router", Vendor: "cisco", OIDs: map[string]Response{
+		"1.3.6.1.2.1.1.3.0":     Static("4200"),
+		"1.3.6.1.2.1.1.5.0":     Static("router"),
+		"1.3.6.1.4.1.9.2.1.4.0": Static("example.com"),
+	}})
+	if err != nil {
+		t.Fatalf("NewFleet() got error: %v", err)
+	}
+	o.SetResolver(fleet.Resolve)
+	o.SetBatchResolver(fleet)
+	leaves := []string{"/system/state/up-time", "/system/state/hostname", "/system/state/domain-name"}
+	values, errs, err := o.EvalBatch(leaves, "router", "cisco")
+	if err != nil || len(errs) > 0 {
+		t.Fatalf("EvalBatch() got errors: %v, %v", err, errs)
+	}
+	expected := map[string]interface{}{
+		"/system/state/up-time":     42.0,
+		"/system/state/hostname":    "router",
+		"/system/state/domain-name": "example.com",
+	}
+	if diff := cmp.Diff(expected, values); diff != "" {
+		t.Errorf("EvalBatch() returned unexpected values (-expected +got):\n%s", diff)
+	}
+	if got := fleet.Operations("router"); got != 1 {
+		t.Errorf("EvalBatch() made %d round trips, expected 1", got)
+	}
+}
+
+// valueSink records the last value of each leaf sent for each target.
+type valueSink struct {
+	mu     sync.Mutex
+	values map[string]map[string]uint64
+	sends  int
+}
+
+func (s *valueSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sends++
+	target := notification.GetPrefix().GetTarget()
+	if s.values[target] == nil {
+		s.values[target] = map[string]uint64{}
+	}
+	for _, update := range notification.GetUpdate() {
+		s.values[target][update.GetPath().GetElem()[0].GetName()] = update.GetVal().GetUintVal() + uint64(update.GetVal().GetIntVal())
+	}
+	return nil
+}
+
+func (s *valueSink) Close() error {
+	return nil
+}
+
+// TestSoak polls a fleet with the collector while devices time out and counters wrap.
+func TestSoak(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simulation")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b := fixtures.New().
+		Vendor("cisco", "9").
+		Leaf("/system/state/counter", "counter").
+		Transformation("counter", "to_int(in_octets)").
+		NocPath("counter", "in_octets", "1.3.6.1.2.1.2.2.1.10.1", "0")
+	mappingsFile, transformationsFile, vendorOidsFile, err := b.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("WriteFiles() got error: %v", err)
+	}
+	o, err := orismologer.NewOrismologer(mappingsFile, transformationsFile, vendorOidsFile)
+	if err != nil {
+		t.Fatalf("NewOrismologer() got error: %v", err)
+	}
+
+	const devices = 50
+	fleet := Generate(devices, 1, func(i int) *Device {
+		return &Device{
+			Vendor: "cisco",
+			OIDs:   map[string]Response{"1.3.6.1.2.1.2.2.1.10.1": Counter(math.MaxUint8-2, 1, 8)},
+			Faults: Faults{TimeoutRate: 0.2, Timeout: time.Millisecond, Latency: time.Millisecond},
+		}
+	})
+	o.SetResolver(fleet.Resolve)
+	recorder := &valueSink{values: map[string]map[string]uint64{}}
+	s := &collector.Scheduler{
+		Evaluator: o,
+		Inventory: fleet.Inventory(),
+		Paths:     []string{"/system"},
+		Interval:  10 * time.Millisecond,
+		Workers:   8,
+		Sink:      recorder,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run() got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	if recorder.sends < devices*2 {
+		t.Errorf("%d notifications were sent, expected at least %d", recorder.sends, devices*2)
+	}
+	wrapped := 0
+	for _, target := range fleet.Inventory().GetTargets() {
+		name := target.GetName()
+		requests := fleet.Requests(name, "1.3.6.1.2.1.2.2.1.10.1")
+		if requests == 0 {
+			t.Errorf("target %q was never polled", name)
+			continue
+		}
+		// The last value sent is the counter's value at the last request.
+		expected := uint64(math.MaxUint8-2+requests-1) & math.MaxUint8
+		if got, ok := recorder.values[name]["system"]; ok && got != expected {
+			t.Errorf("target %q last sent %d, expected %d after %d requests", name, got, expected, requests)
+		}
+		if requests > 3 {
+			wrapped++
+		}
+	}
+	if wrapped == 0 {
+		t.Errorf("no counters wrapped")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/gnmiserver"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+/*
+Filter is a Sink which reduces the volume of updates passed on to another Sink, by dropping updates
+which do not differ meaningfully from the last value sent for the same target and leaf. A Filter
+should wrap the sink of a single subscription (eg: a Poller), since it remembers what that sink has
+been sent. Notifications left without updates or deletes are not sent at all.
+*/
+type Filter struct {
+	Sink Sink
+
+	// SuppressUnchanged drops updates whose value equals the last value sent.
+	SuppressUnchanged bool
+
+	// Deadbands maps leaves to the smallest change in their numeric value which is sent, eg:
+	// {"/interfaces/interface/state/counters/in-octets": 1e6}. Leaves may be given with keys (to
+	// apply to a single list entry) or without (to apply to every entry). Changes are measured from
+	// the last value sent, so slow drift is still reported once it adds up.
+	Deadbands map[string]float64
+
+	// Heartbeat, if set, sends a leaf's value even if it would be dropped when it was last sent at
+	// least this long ago, so that consumers can tell a steady value from a silent target.
+	Heartbeat time.Duration
+
+	mu   sync.Mutex
+	last map[string]map[string]sent // Target -> leaf -> the last value sent.
+	now  func() time.Time
+}
+
+type sent struct {
+	value *gpb.TypedValue
+	at    time.Time
+}
+
+// Send implements Sink.
+func (f *Filter) Send(ctx context.Context, notification *gpb.Notification) error {
+	if filtered := f.filter(notification); filtered != nil {
+		return f.Sink.Send(ctx, filtered)
+	}
+	return nil
+}
+
+// Close closes the underlying sink.
+func (f *Filter) Close() error {
+	return f.Sink.Close()
+}
+
+// filter returns a copy of the notification holding only the updates to send, or nil if none remain.
+func (f *Filter) filter(notification *gpb.Notification) *gpb.Notification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.last == nil {
+		f.last = map[string]map[string]sent{}
+	}
+	now := time.Now()
+	if f.now != nil {
+		now = f.now()
+	}
+	target := notification.GetPrefix().GetTarget()
+	if f.last[target] == nil {
+		f.last[target] = map[string]sent{}
+	}
+	last := f.last[target]
+	prefix := gnmiserver.PathToString(notification.GetPrefix())
+	if prefix == "/" {
+		prefix = ""
+	}
+	filtered := proto.Clone(notification).(*gpb.Notification)
+	filtered.Update = nil
+	for _, del := range notification.GetDelete() {
+		// Deleted leaves are sent in full when they reappear.
+		deleted := strings.TrimSuffix(prefix+gnmiserver.PathToString(del), "/")
+		for leaf := range last {
+			if leaf == deleted || strings.HasPrefix(leaf, deleted+"/") {
+				delete(last, leaf)
+			}
+		}
+	}
+	for _, update := range notification.GetUpdate() {
+		leaf := prefix + gnmiserver.PathToString(update.GetPath())
+		if previous, ok := last[leaf]; ok && f.drop(leaf, update.GetVal(), previous, now) {
+			continue
+		}
+		last[leaf] = sent{value: update.GetVal(), at: now}
+		filtered.Update = append(filtered.Update, update)
+	}
+	if len(filtered.GetUpdate()) == 0 && len(filtered.GetDelete()) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+// drop returns whether an update to a leaf need not be sent, given the last value sent for it.
+func (f *Filter) drop(leaf string, value *gpb.TypedValue, last sent, now time.Time) bool {
+	if f.Heartbeat > 0 && now.Sub(last.at) >= f.Heartbeat {
+		return false
+	}
+	if f.SuppressUnchanged && proto.Equal(value, last.value) {
+		return true
+	}
+	deadband, ok := f.deadband(leaf)
+	if !ok {
+		return false
+	}
+	x, xOK := gnmiserver.Float(value)
+	y, yOK := gnmiserver.Float(last.value)
+	return xOK && yOK && math.Abs(x-y) < deadband
+}
+
+// deadband returns the deadband of a leaf, preferring one given for the leaf's exact keys.
+func (f *Filter) deadband(leaf string) (float64, bool) {
+	if deadband, ok := f.Deadbands[leaf]; ok {
+		return deadband, true
+	}
+	path, err := gnmiserver.StringToPath(leaf)
+	if err != nil {
+		return 0, false
+	}
+	for _, elem := range path.GetElem() {
+		elem.Key = nil
+	}
+	deadband, ok := f.Deadbands[gnmiserver.PathToString(path)]
+	return deadband, ok
+}
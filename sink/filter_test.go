@@ -0,0 +1,143 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func intUpdate(elems []*gpb.PathElem, v int64) *gpb.Update {
+	return &gpb.Update{Path: &gpb.Path{Elem: elems}, Val: &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: v}}}
+}
+
+func TestFilter(t *testing.T) {
+	inOctets := func(name string) []*gpb.PathElem {
+		return []*gpb.PathElem{
+			{Name: "interfaces"},
+			{Name: "interface", Key: map[string]string{"name": name}},
+			{Name: "state"}, {Name: "counters"}, {Name: "in-octets"},
+		}
+	}
+	mtu := []*gpb.PathElem{{Name: "interfaces"}, {Name: "interface", Key: map[string]string{"name": "eth0"}}, {Name: "state"}, {Name: "mtu"}}
+	hostname := &gpb.Update{
+		Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}},
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "switch1"}},
+	}
+
+	s := &recordingSink{}
+	now := time.Unix(0, 0)
+	f := &Filter{
+		Sink:              s,
+		SuppressUnchanged: true,
+		Deadbands: map[string]float64{
+			"/interfaces/interface/state/counters/in-octets":            1000,
+			"/interfaces/interface[name=eth1]/state/counters/in-octets": 10,
+		},
+		Heartbeat: time.Hour,
+		now:       func() time.Time { return now },
+	}
+	for _, test := range []struct {
+		name     string
+		target   string
+		updates  []*gpb.Update
+		deletes  []*gpb.Path
+		expected int // Updates sent, or -1 if no notification is sent.
+	}{
+		{
+			name:     "first values are sent",
+			target:   "switch1",
+			updates:  []*gpb.Update{hostname, intUpdate(inOctets("eth0"), 0), intUpdate(inOctets("eth1"), 0), intUpdate(mtu, 1500)},
+			expected: 4,
+		},
+		{
+			name:     "unchanged values are suppressed",
+			target:   "switch1",
+			updates:  []*gpb.Update{hostname, intUpdate(mtu, 1500)},
+			expected: -1,
+		},
+		{
+			name:     "other targets are tracked separately",
+			target:   "switch2",
+			updates:  []*gpb.Update{hostname},
+			expected: 1,
+		},
+		{
+			name:     "changes within the deadband are suppressed",
+			target:   "switch1",
+			updates:  []*gpb.Update{intUpdate(inOctets("eth0"), 999), intUpdate(inOctets("eth1"), 9)},
+			expected: -1,
+		},
+		{
+			name:     "deadbands for exact keys take precedence",
+			target:   "switch1",
+			updates:  []*gpb.Update{intUpdate(inOctets("eth0"), 500), intUpdate(inOctets("eth1"), 10)},
+			expected: 1,
+		},
+		{
+			name:     "drift from the last value sent adds up",
+			target:   "switch1",
+			updates:  []*gpb.Update{intUpdate(inOctets("eth0"), 1000)},
+			expected: 1,
+		},
+		{
+			name:     "leaves without a deadband are sent on any change",
+			target:   "switch1",
+			updates:  []*gpb.Update{intUpdate(mtu, 1501)},
+			expected: 1,
+		},
+		{
+			name:     "deletes are sent and forget the last values",
+			target:   "switch1",
+			deletes:  []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "interfaces"}}}},
+			expected: 0,
+		},
+		{
+			name:     "deleted leaves are sent when they reappear",
+			target:   "switch1",
+			updates:  []*gpb.Update{intUpdate(mtu, 1501), hostname},
+			expected: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			before := len(s.notifications)
+			notification := &gpb.Notification{Prefix: &gpb.Path{Target: test.target}, Update: test.updates, Delete: test.deletes}
+			if err := f.Send(context.Background(), notification); err != nil {
+				t.Fatalf("Send() got error: %v", err)
+			}
+			switch {
+			case test.expected < 0 && len(s.notifications) != before:
+				t.Errorf("Send() passed on %v, expected nothing", s.notifications[before])
+			case test.expected >= 0 && len(s.notifications) != before+1:
+				t.Errorf("Send() passed on %d notifications, expected 1", len(s.notifications)-before)
+			case test.expected >= 0 && len(s.notifications[before].GetUpdate()) != test.expected:
+				t.Errorf("Send() passed on %v, expected %d updates", s.notifications[before], test.expected)
+			}
+		})
+	}
+
+	now = now.Add(time.Hour)
+	if err := f.Send(context.Background(), &gpb.Notification{Prefix: &gpb.Path{Target: "switch2"}, Update: []*gpb.Update{hostname}}); err != nil {
+		t.Fatalf("Send() got error: %v", err)
+	}
+	if got := s.notifications[len(s.notifications)-1]; got.GetPrefix().GetTarget() != "switch2" {
+		t.Errorf("Send() did not pass on an unchanged value after the heartbeat interval")
+	}
+}
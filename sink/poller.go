@@ -0,0 +1,170 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"runtime/pprof"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/orismologer"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+/*
+Evaluator evaluates OpenConfig paths for a target, with any tags added by post-processors. It is
+implemented by *orismologer.Orismologer.
+*/
+type Evaluator interface {
+	EvalResult(openConfigPath, target, vendor string) (*orismologer.Result, error)
+	Leaves(root string) ([]string, error)
+}
+
+/*
+BatchEvaluator evaluates many leaves for a target at once, eg: fetching their NocPaths with a single
+plan (see orismologer.Orismologer.EvalBatchResults). Collect uses it when an Evaluator implements it.
+*/
+type BatchEvaluator interface {
+	EvalBatchResults(leaves []string, target, vendor string) (results map[string]*orismologer.Result, errs map[string]error, err error)
+}
+
+/*
+Poller periodically evaluates OpenConfig paths (leaves or subtrees) for each target in an inventory,
+and sends one notification per target per interval to a sink.
+*/
+type Poller struct {
+	Evaluator Evaluator
+	Inventory *pb.Inventory
+	Paths     []string
+	Interval  time.Duration
+	Sink      Sink
+
+	now func() time.Time
+}
+
+/*
+Run polls until the context is cancelled, then returns the context's error. Leaves which cannot be
+evaluated for a target, and failures to send, are logged and skipped.
+*/
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		p.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll evaluates the paths for every target once, and sends the results.
+func (p *Poller) Poll(ctx context.Context) {
+	for _, target := range p.Inventory.GetTargets() {
+		if ctx.Err() != nil {
+			return
+		}
+		var notification *gpb.Notification
+		// Label profiles, so that the cost of slow targets can be found with pprof -tagfocus.
+		pprof.Do(ctx, pprof.Labels("target", target.GetName()), func(context.Context) {
+			notification = p.notification(target)
+		})
+		if len(notification.GetUpdate()) == 0 {
+			continue
+		}
+		if err := p.Sink.Send(ctx, notification); err != nil {
+			glog.Warningf("could not send updates for target %q: %v", target.GetName(), err)
+		}
+	}
+}
+
+func (p *Poller) notification(target *pb.Target) *gpb.Notification {
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	return Collect(p.Evaluator, target, p.Paths, now())
+}
+
+/*
+Collect evaluates OpenConfig paths (leaves or subtrees) for a target, returning a notification with
+the given timestamp holding an update per leaf, carrying the tags added by post-processors (see
+gnmiserver.ResultUpdate). Leaves which cannot be evaluated are logged and skipped, and leaves dropped
+by post-processors are skipped silently.
+*/
+func Collect(evaluator Evaluator, target *pb.Target, paths []string, timestamp time.Time) *gpb.Notification {
+	notification := &gpb.Notification{
+		Timestamp: timestamp.UnixNano(),
+		Prefix:    &gpb.Path{Target: target.GetName()},
+	}
+	var leaves []string
+	for _, path := range paths {
+		pathLeaves, err := evaluator.Leaves(path)
+		if err != nil {
+			glog.Warningf("path %q is not mapped: %v", path, err)
+			continue
+		}
+		leaves = append(leaves, pathLeaves...)
+	}
+	results, errs := evalLeaves(evaluator, leaves, target)
+	for _, leaf := range leaves {
+		result, ok := results[leaf]
+		if !ok {
+			if !errors.Is(errs[leaf], orismologer.ErrDropped) {
+				glog.V(1).Infof("skipping %q for target %q: %v", leaf, target.GetName(), errs[leaf])
+			}
+			continue
+		}
+		update, err := gnmiserver.ResultUpdate(result)
+		if err != nil {
+			glog.Warningf("skipping %q for target %q: %v", leaf, target.GetName(), err)
+			continue
+		}
+		notification.Update = append(notification.Update, update)
+	}
+	return notification
+}
+
+/*
+evalLeaves evaluates leaves for a target, at once if the evaluator is a BatchEvaluator, returning the
+results of those evaluated and the errors of the others.
+*/
+func evalLeaves(evaluator Evaluator, leaves []string, target *pb.Target) (map[string]*orismologer.Result, map[string]error) {
+	if batch, ok := evaluator.(BatchEvaluator); ok {
+		results, errs, err := batch.EvalBatchResults(leaves, target.GetName(), target.GetVendor())
+		if err == nil {
+			return results, errs
+		}
+		glog.Warningf("could not evaluate leaves for target %q at once, evaluating them separately: %v", target.GetName(), err)
+	}
+	results, errs := map[string]*orismologer.Result{}, map[string]error{}
+	for _, leaf := range leaves {
+		result, err := evaluator.EvalResult(leaf, target.GetName(), target.GetVendor())
+		if err != nil {
+			errs[leaf] = err
+			continue
+		}
+		results[leaf] = result
+	}
+	return results, errs
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/orismologer"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// fakeEvaluator serves fixed values (or tagged results, or errors) for fixed leaves, for Cisco targets only.
+type fakeEvaluator map[string]interface{}
+
+func (f fakeEvaluator) EvalResult(openConfigPath, target, vendor string) (*orismologer.Result, error) {
+	if vendor != "cisco" {
+		return nil, fmt.Errorf("unsupported vendor %q", vendor)
+	}
+	value, ok := f[openConfigPath]
+	if !ok {
+		return nil, fmt.Errorf("cannot evaluate %q", openConfigPath)
+	}
+	result := &orismologer.Result{Path: openConfigPath, Target: target, Vendor: vendor, Value: value}
+	switch v := value.(type) {
+	case error:
+		return nil, v
+	case *orismologer.Result:
+		result.Value, result.Tags = v.Value, v.Tags
+	}
+	return result, nil
+}
+
+func (f fakeEvaluator) Leaves(root string) ([]string, error) {
+	var leaves []string
+	for _, leaf := range []string{"/system/state/boot-time", "/system/state/hostname", "/system/state/broken", "/system/state/dropped"} {
+		if leaf == root || strings.HasPrefix(leaf, root+"/") {
+			leaves = append(leaves, leaf)
+		}
+	}
+	if len(leaves) == 0 {
+		return nil, fmt.Errorf("no such node %q", root)
+	}
+	return leaves, nil
+}
+
+// recordingSink records the notifications sent to it.
+type recordingSink struct {
+	notifications []*gpb.Notification
+}
+
+func (s *recordingSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	s.notifications = append(s.notifications, notification)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestPoll(t *testing.T) {
+	s := &recordingSink{}
+	p := &Poller{
+		Evaluator: fakeEvaluator{
+			"/system/state/boot-time": 1545178344.0,
+			"/system/state/hostname":  &orismologer.Result{Value: "switch1", Tags: map[string]string{"site": "lon"}},
+			"/system/state/dropped":   orismologer.ErrDropped,
+		},
+		Inventory: &pb.Inventory{
+			Targets: []*pb.Target{
+				{Name: "switch1", Vendor: "cisco"},
+				{Name: "ap1", Vendor: "aruba"},
+			},
+		},
+		Paths:    []string{"/system/state/boot-time", "/system/state/hostname", "/system/state/dropped", "/interfaces"},
+		Interval: time.Minute,
+		Sink:     s,
+		now:      func() time.Time { return time.Unix(0, 42) },
+	}
+	p.Poll(context.Background())
+	expected := []*gpb.Notification{
+		{
+			Timestamp: 42,
+			Prefix:    &gpb.Path{Target: "switch1"},
+			Update: []*gpb.Update{
+				{
+					Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "boot-time"}}},
+					Val:  &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: 1545178344}},
+				},
+				// Tags are carried as keys, and the dropped leaf is skipped.
+				{
+					Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname", Key: map[string]string{"site": "lon"}}}},
+					Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "switch1"}},
+				},
+			},
+		},
+	}
+	if len(s.notifications) != len(expected) {
+		t.Fatalf("Poll() sent %d notifications, expected %d: %v", len(s.notifications), len(expected), s.notifications)
+	}
+	for i := range expected {
+		if !proto.Equal(s.notifications[i], expected[i]) {
+			t.Errorf("Poll() sent %v, expected %v", s.notifications[i], expected[i])
+		}
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := &Poller{
+		Evaluator: fakeEvaluator{},
+		Inventory: &pb.Inventory{},
+		Interval:  time.Hour,
+		Sink:      &recordingSink{},
+	}
+	if err := p.Run(ctx); err != context.Canceled {
+		t.Errorf("Run() = %v, expected %v", err, context.Canceled)
+	}
+}
+
+// batchEvaluator evaluates leaves at once, failing if told to.
+type batchEvaluator struct {
+	fakeEvaluator
+	batches int
+	err     error
+}
+
+func (b *batchEvaluator) EvalBatchResults(leaves []string, target, vendor string) (map[string]*orismologer.Result, map[string]error, error) {
+	b.batches++
+	if b.err != nil {
+		return nil, nil, b.err
+	}
+	results, errs := map[string]*orismologer.Result{}, map[string]error{}
+	for _, leaf := range leaves {
+		if result, err := b.EvalResult(leaf, target, vendor); err != nil {
+			errs[leaf] = err
+		} else {
+			results[leaf] = result
+		}
+	}
+	return results, errs, nil
+}
+
+func TestCollectBatch(t *testing.T) {
+	target := &pb.Target{Name: "switch1", Vendor: "cisco"}
+	for _, test := range []struct {
+		name string
+		err  error
+	}{
+		{name: "batch"},
+		{name: "falls back to separate evaluations", err: fmt.Errorf("timeout")},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			evaluator := &batchEvaluator{
+				fakeEvaluator: fakeEvaluator{"/system/state/boot-time": 1545178344.0, "/system/state/hostname": "switch1"},
+				err:           test.err,
+			}
+			notification := Collect(evaluator, target, []string{"/system"}, time.Unix(0, 42))
+			if evaluator.batches != 1 {
+				t.Errorf("Collect() evaluated %d batches, expected 1", evaluator.batches)
+			}
+			if len(notification.GetUpdate()) != 2 {
+				t.Errorf("Collect() = %v, expected 2 updates", notification)
+			}
+		})
+	}
+}
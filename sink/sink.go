@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package sink streams timestamped telemetry updates, as gNMI notifications, into message queues such
+as Kafka and Google Cloud Pub/Sub, so that Orismologer can feed existing streaming telemetry
+pipelines. A Poller periodically evaluates OpenConfig paths for a set of targets and pushes the
+results into a Sink.
+
+Sinks do not depend on a particular client library. Instead, they publish through small interfaces
+(KafkaProducer, PubSubPublisher) which are easily implemented by wrapping a client, eg:
+github.com/segmentio/kafka-go's Writer or cloud.google.com/go/pubsub's Topic.
+*/
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// Encoding is the wire format of published notifications.
+type Encoding int
+
+const (
+	// ProtoEncoding encodes notifications as binary gNMI Notification protos.
+	ProtoEncoding Encoding = iota
+	// JSONEncoding encodes notifications as gNMI Notification protos in JSON form.
+	JSONEncoding
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case ProtoEncoding:
+		return "proto"
+	case JSONEncoding:
+		return "json"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+// Encode serializes a notification in the given encoding.
+func Encode(notification *gpb.Notification, encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case ProtoEncoding:
+		return proto.Marshal(notification)
+	case JSONEncoding:
+		var b bytes.Buffer
+		if err := (&jsonpb.Marshaler{}).Marshal(&b, notification); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %v", encoding)
+	}
+}
+
+// Sink receives telemetry updates.
+type Sink interface {
+	Send(ctx context.Context, notification *gpb.Notification) error
+	Close() error
+}
+
+// KafkaProducer publishes a message to a Kafka topic.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+/*
+KafkaSink publishes notifications to a Kafka topic. Messages are keyed by target, so that all updates
+for a device land in the same partition, in order. Close closes the producer if it is an io.Closer.
+*/
+type KafkaSink struct {
+	Producer KafkaProducer
+	Topic    string
+	Encoding Encoding
+}
+
+// Send implements Sink.
+func (s *KafkaSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	value, err := Encode(notification, s.Encoding)
+	if err != nil {
+		return fmt.Errorf("could not encode notification: %v", err)
+	}
+	key := []byte(notification.GetPrefix().GetTarget())
+	if err := s.Producer.Produce(ctx, s.Topic, key, value); err != nil {
+		return fmt.Errorf("could not publish to Kafka topic %q: %v", s.Topic, err)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *KafkaSink) Close() error {
+	return closeIfCloser(s.Producer)
+}
+
+// PubSubPublisher publishes a message with attributes to a Pub/Sub topic.
+type PubSubPublisher interface {
+	Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) error
+}
+
+/*
+PubSubSink publishes notifications to a Google Cloud Pub/Sub topic. Messages carry "target" and
+"encoding" attributes, so subscribers can filter and decode them without parsing the payload. Close
+closes the publisher if it is an io.Closer.
+*/
+type PubSubSink struct {
+	Publisher PubSubPublisher
+	Topic     string
+	Encoding  Encoding
+}
+
+// Send implements Sink.
+func (s *PubSubSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	data, err := Encode(notification, s.Encoding)
+	if err != nil {
+		return fmt.Errorf("could not encode notification: %v", err)
+	}
+	attributes := map[string]string{
+		"target":   notification.GetPrefix().GetTarget(),
+		"encoding": s.Encoding.String(),
+	}
+	if err := s.Publisher.Publish(ctx, s.Topic, data, attributes); err != nil {
+		return fmt.Errorf("could not publish to Pub/Sub topic %q: %v", s.Topic, err)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *PubSubSink) Close() error {
+	return closeIfCloser(s.Publisher)
+}
+
+func closeIfCloser(v interface{}) error {
+	if closer, ok := v.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var testNotification = &gpb.Notification{
+	Timestamp: 42,
+	Prefix:    &gpb.Path{Target: "switch1"},
+	Update: []*gpb.Update{
+		{
+			Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "switch1"}},
+		},
+	},
+}
+
+type message struct {
+	topic      string
+	key        string
+	data       []byte
+	attributes map[string]string
+}
+
+// fakeClient records published messages. It implements KafkaProducer and PubSubPublisher.
+type fakeClient struct {
+	messages []message
+	err      error
+	closed   bool
+}
+
+func (c *fakeClient) Produce(ctx context.Context, topic string, key, value []byte) error {
+	c.messages = append(c.messages, message{topic: topic, key: string(key), data: value})
+	return c.err
+}
+
+func (c *fakeClient) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) error {
+	c.messages = append(c.messages, message{topic: topic, data: data, attributes: attributes})
+	return c.err
+}
+
+func (c *fakeClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestEncode(t *testing.T) {
+	data, err := Encode(testNotification, ProtoEncoding)
+	if err != nil {
+		t.Fatalf("Encode(proto) got error: %v", err)
+	}
+	got := &gpb.Notification{}
+	if err := proto.Unmarshal(data, got); err != nil || !proto.Equal(got, testNotification) {
+		t.Errorf("Encode(proto) round trip = %v, %v, expected %v", got, err, testNotification)
+	}
+
+	data, err = Encode(testNotification, JSONEncoding)
+	if err != nil {
+		t.Fatalf("Encode(json) got error: %v", err)
+	}
+	got = &gpb.Notification{}
+	if err := jsonpb.UnmarshalString(string(data), got); err != nil || !proto.Equal(got, testNotification) {
+		t.Errorf("Encode(json) round trip = %v, %v, expected %v", got, err, testNotification)
+	}
+
+	if _, err := Encode(testNotification, Encoding(42)); err == nil {
+		t.Errorf("Encode() with unknown encoding expected error, got none")
+	}
+}
+
+func TestKafkaSink(t *testing.T) {
+	client := &fakeClient{}
+	s := &KafkaSink{Producer: client, Topic: "telemetry", Encoding: JSONEncoding}
+	if err := s.Send(context.Background(), testNotification); err != nil {
+		t.Fatalf("Send() got error: %v", err)
+	}
+	if len(client.messages) != 1 {
+		t.Fatalf("Send() published %d messages, expected 1", len(client.messages))
+	}
+	m := client.messages[0]
+	if m.topic != "telemetry" || m.key != "switch1" || !strings.Contains(string(m.data), `"stringVal":"switch1"`) {
+		t.Errorf("Send() published %+v", m)
+	}
+	if err := s.Close(); err != nil || !client.closed {
+		t.Errorf("Close() = %v, closed producer: %v", err, client.closed)
+	}
+
+	client.err = errors.New("broker unavailable")
+	if err := s.Send(context.Background(), testNotification); err == nil {
+		t.Errorf("Send() with failing producer expected error, got none")
+	}
+}
+
+func TestPubSubSink(t *testing.T) {
+	client := &fakeClient{}
+	s := &PubSubSink{Publisher: client, Topic: "projects/p/topics/telemetry"}
+	if err := s.Send(context.Background(), testNotification); err != nil {
+		t.Fatalf("Send() got error: %v", err)
+	}
+	if len(client.messages) != 1 {
+		t.Fatalf("Send() published %d messages, expected 1", len(client.messages))
+	}
+	m := client.messages[0]
+	expectedAttributes := map[string]string{"target": "switch1", "encoding": "proto"}
+	if m.topic != "projects/p/topics/telemetry" || !cmp.Equal(m.attributes, expectedAttributes) {
+		t.Errorf("Send() published %+v", m)
+	}
+	if err := s.Close(); err != nil || !client.closed {
+		t.Errorf("Close() = %v, closed publisher: %v", err, client.closed)
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package store persists collector state across restarts, eg: previous counter samples used to compute
+rates, and the results of capability discovery. State is kept in named buckets of a key-value Store,
+which may be in memory or on disk.
+*/
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets used by Orismologer, so that users of a shared Store do not collide.
+const (
+	RateBucket       = "rate"
+	CapabilityBucket = "capabilities"
+)
+
+// Store is a key-value store, partitioned into buckets. Implementations are safe for concurrent use.
+type Store interface {
+	// Get returns the value of a key, or false if the key is not set.
+	Get(bucket, key string) ([]byte, bool, error)
+	Put(bucket, key string, value []byte) error
+	// Delete removes a key. Deleting a key which is not set is not an error.
+	Delete(bucket, key string) error
+	// ForEach calls f for each key in a bucket, in key order, until f returns an error.
+	ForEach(bucket string, f func(key string, value []byte) error) error
+	Close() error
+}
+
+// Memory is a Store which keeps state in memory, ie: which does not persist across restarts.
+type Memory struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]map[string][]byte{}}
+}
+
+// Get implements Store.
+func (m *Memory) Get(bucket, key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.buckets[bucket][key]
+	return copyBytes(value), ok, nil
+}
+
+// Put implements Store.
+func (m *Memory) Put(bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = map[string][]byte{}
+	}
+	m.buckets[bucket][key] = copyBytes(value)
+	return nil
+}
+
+// Delete implements Store.
+func (m *Memory) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+// ForEach implements Store.
+func (m *Memory) ForEach(bucket string, f func(key string, value []byte) error) error {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.buckets[bucket]))
+	for key := range m.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		values[key] = copyBytes(m.buckets[bucket][key])
+	}
+	m.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := f(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Store.
+func (m *Memory) Close() error {
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// Bolt is a Store which keeps state on disk in a bbolt database file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+var _ Store = (*Bolt)(nil)
+
+/*
+OpenBolt opens (creating if necessary) the database in the given file. A database may only be open
+in one process at a time; OpenBolt fails rather than waiting if another process has it open.
+*/
+func OpenBolt(file string) (*Bolt, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open state database %q: %v", file, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Get implements Store.
+func (b *Bolt) Get(bucket, key string) ([]byte, bool, error) {
+	var value []byte
+	var ok bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if bkt := tx.Bucket([]byte(bucket)); bkt != nil {
+			// Values are only valid during the transaction.
+			if v := bkt.Get([]byte(key)); v != nil {
+				value, ok = copyBytes(v), true
+			}
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+// Put implements Store.
+func (b *Bolt) Put(bucket, key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			value = []byte{} // bbolt does not store nil values.
+		}
+		return bkt.Put([]byte(key), value)
+	})
+}
+
+// Delete implements Store.
+func (b *Bolt) Delete(bucket, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if bkt := tx.Bucket([]byte(bucket)); bkt != nil {
+			return bkt.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+// ForEach implements Store.
+func (b *Bolt) ForEach(bucket string, f func(key string, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			return f(string(k), copyBytes(v))
+		})
+	})
+}
+
+// Close implements Store.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+/*
+Cache stores JSON-encoded values in a bucket of a Store, each expiring a fixed time after it was put.
+A zero TTL means values never expire. Expired values are treated as absent, and removed by Prune.
+*/
+type Cache struct {
+	store  Store
+	bucket string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// entry is the stored form of a cached value.
+type entry struct {
+	Expires int64           `json:"expires,omitempty"` // Unix nanoseconds; 0 if the value never expires.
+	Value   json.RawMessage `json:"value"`
+}
+
+// NewCache returns a Cache of values in the given bucket of a Store.
+func NewCache(store Store, bucket string, ttl time.Duration) *Cache {
+	return &Cache{store: store, bucket: bucket, ttl: ttl, now: time.Now}
+}
+
+// Get decodes the value of a key into value, returning false if the key is not set or has expired.
+func (c *Cache) Get(key string, value interface{}) (bool, error) {
+	e, ok, err := c.entry(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal(e.Value, value); err != nil {
+		return false, fmt.Errorf("could not decode cached value of %q: %v", key, err)
+	}
+	return true, nil
+}
+
+func (c *Cache) entry(key string) (*entry, bool, error) {
+	b, ok, err := c.store.Get(c.bucket, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	e := &entry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, false, fmt.Errorf("could not decode cache entry %q: %v", key, err)
+	}
+	if c.expired(e) {
+		return nil, false, nil
+	}
+	return e, true, nil
+}
+
+func (c *Cache) expired(e *entry) bool {
+	return e.Expires != 0 && c.now().UnixNano() >= e.Expires
+}
+
+// Put sets the value of a key, encoded as JSON.
+func (c *Cache) Put(key string, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("could not encode value of %q: %v", key, err)
+	}
+	e := entry{Value: encoded}
+	if c.ttl > 0 {
+		e.Expires = c.now().Add(c.ttl).UnixNano()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return c.store.Put(c.bucket, key, b)
+}
+
+// Delete removes a key.
+func (c *Cache) Delete(key string) error {
+	return c.store.Delete(c.bucket, key)
+}
+
+// Prune removes expired (and undecodable) entries, returning how many were removed.
+func (c *Cache) Prune() (int, error) {
+	var stale []string
+	err := c.store.ForEach(c.bucket, func(key string, value []byte) error {
+		e := &entry{}
+		if err := json.Unmarshal(value, e); err != nil || c.expired(e) {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range stale {
+		if err := c.store.Delete(c.bucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
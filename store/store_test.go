@@ -0,0 +1,176 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func openBolt(t *testing.T, file string) *Bolt {
+	t.Helper()
+	b, err := OpenBolt(file)
+	if err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	return b
+}
+
+func TestStores(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T) Store { return NewMemory() },
+		},
+		{
+			name: "bolt",
+			open: func(t *testing.T) Store { return openBolt(t, filepath.Join(t.TempDir(), "state.db")) },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := test.open(t)
+			defer s.Close()
+
+			if _, ok, err := s.Get(RateBucket, "missing"); ok || err != nil {
+				t.Errorf("Get() of missing key = %v, %v, expected false, nil", ok, err)
+			}
+			value := []byte("b")
+			for key, v := range map[string][]byte{"b": value, "a": []byte("a"), "empty": nil} {
+				if err := s.Put(RateBucket, key, v); err != nil {
+					t.Fatalf("Put(%q) got error: %v", key, err)
+				}
+			}
+			value[0] = 'x' // The store must not alias the caller's slice.
+			if got, ok, err := s.Get(RateBucket, "b"); err != nil || !ok || string(got) != "b" {
+				t.Errorf("Get() = %q, %v, %v, expected \"b\", true, nil", got, ok, err)
+			}
+			if _, ok, _ := s.Get(CapabilityBucket, "b"); ok {
+				t.Errorf("Get() found key in a different bucket")
+			}
+
+			var keys []string
+			if err := s.ForEach(RateBucket, func(key string, value []byte) error {
+				keys = append(keys, key)
+				return nil
+			}); err != nil {
+				t.Errorf("ForEach() got error: %v", err)
+			}
+			if expected := []string{"a", "b", "empty"}; !cmp.Equal(keys, expected) {
+				t.Errorf("ForEach() visited %v, expected %v", keys, expected)
+			}
+			stop := errors.New("stop")
+			if err := s.ForEach(RateBucket, func(string, []byte) error { return stop }); err != stop {
+				t.Errorf("ForEach() = %v, expected the callback's error", err)
+			}
+			if err := s.ForEach("unknown", func(string, []byte) error { return stop }); err != nil {
+				t.Errorf("ForEach() of unknown bucket got error: %v", err)
+			}
+
+			if err := s.Delete(RateBucket, "b"); err != nil {
+				t.Errorf("Delete() got error: %v", err)
+			}
+			if _, ok, _ := s.Get(RateBucket, "b"); ok {
+				t.Errorf("Get() found deleted key")
+			}
+			if err := s.Delete("unknown", "b"); err != nil {
+				t.Errorf("Delete() from unknown bucket got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBoltPersists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.db")
+	b := openBolt(t, file)
+	if err := b.Put(RateBucket, "switch1/in_octets", []byte("42")); err != nil {
+		t.Fatalf("Put() got error: %v", err)
+	}
+	if _, err := OpenBolt(file); err == nil {
+		t.Errorf("OpenBolt() of a database already open expected error, got none")
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() got error: %v", err)
+	}
+
+	b = openBolt(t, file)
+	defer b.Close()
+	if got, ok, err := b.Get(RateBucket, "switch1/in_octets"); err != nil || !ok || string(got) != "42" {
+		t.Errorf("Get() after reopening = %q, %v, %v, expected \"42\", true, nil", got, ok, err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	type capabilities struct {
+		Models []string
+	}
+	now := time.Unix(1000, 0)
+	s := NewMemory()
+	c := NewCache(s, CapabilityBucket, time.Minute)
+	c.now = func() time.Time { return now }
+
+	expected := capabilities{Models: []string{"openconfig-system"}}
+	if err := c.Put("switch1", expected); err != nil {
+		t.Fatalf("Put() got error: %v", err)
+	}
+	if err := s.Put(CapabilityBucket, "corrupt", []byte("{")); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+
+	var got capabilities
+	if ok, err := c.Get("switch1", &got); err != nil || !ok || !cmp.Equal(got, expected) {
+		t.Errorf("Get() = %v, %v, %v, expected %v, true, nil", got, ok, err, expected)
+	}
+	if _, err := c.Get("corrupt", &got); err == nil {
+		t.Errorf("Get() of corrupt entry expected error, got none")
+	}
+	if ok, err := c.Get("missing", &got); ok || err != nil {
+		t.Errorf("Get() of missing key = %v, %v, expected false, nil", ok, err)
+	}
+
+	now = now.Add(time.Minute)
+	if ok, err := c.Get("switch1", &got); ok || err != nil {
+		t.Errorf("Get() of expired key = %v, %v, expected false, nil", ok, err)
+	}
+	if n, err := c.Prune(); err != nil || n != 2 {
+		t.Errorf("Prune() = %v, %v, expected 2, nil", n, err)
+	}
+	if _, ok, _ := s.Get(CapabilityBucket, "switch1"); ok {
+		t.Errorf("Prune() did not remove expired entry")
+	}
+
+	forever := NewCache(s, "unsupported", 0)
+	if err := forever.Put("switch1/1.3.6.1.4.1.9.9.109", true); err != nil {
+		t.Fatalf("Put() got error: %v", err)
+	}
+	var unsupported bool
+	if ok, err := forever.Get("switch1/1.3.6.1.4.1.9.9.109", &unsupported); err != nil || !ok || !unsupported {
+		t.Errorf("Get() without TTL = %v, %v, %v, expected true, true, nil", unsupported, ok, err)
+	}
+	if err := forever.Delete("switch1/1.3.6.1.4.1.9.9.109"); err != nil {
+		t.Errorf("Delete() got error: %v", err)
+	}
+	if ok, _ := forever.Get("switch1/1.3.6.1.4.1.9.9.109", &unsupported); ok {
+		t.Errorf("Get() found deleted key")
+	}
+}
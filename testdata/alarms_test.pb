@@ -0,0 +1,35 @@
+# Copyright 2019 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+# https://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# proto-file: proto/alarms.proto
+# proto-message: Alarms
+
+alarms {
+  id: "cpu-high"
+  path: "/components/component/cpu/utilization/state/instant"
+  comparison: GREATER
+  threshold: 90
+  hysteresis: 5
+  severity: MAJOR
+  text: "CPU utilization is {value}%"
+}
+
+alarms {
+  id: "link-down"
+  path: "/interfaces/interface/state/oper-status"
+  comparison: EQUAL
+  value: "DOWN"
+  severity: MINOR
+  text: "Interface is down"
+}
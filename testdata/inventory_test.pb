@@ -0,0 +1,24 @@
+# Copyright 2019 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+# https://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# proto-file: proto/inventory.proto
+# proto-message: Inventory
+
+targets {
+  name: "switch1"
+  address: "192.0.2.1"
+  vendor: "cisco"
+  credentials { key: "community" value: "secret:env:ORISMOLOGER_TEST_COMMUNITY" }
+  credentials { key: "username" value: "monitoring" }
+}
@@ -0,0 +1,66 @@
+# Copyright 2019 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+# https://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# proto-file: proto/traps.proto
+# proto-message: TrapMappings
+
+# linkDown
+traps {
+  trap_oid: "1.3.6.1.6.3.1.1.5.3"
+
+  updates {
+    path: "/interfaces/interface[name={if_descr}]/state/oper-status"
+    transformation {
+      bind: "link_down_oper_status"
+      expressions: "\"DOWN\""
+      noc_paths {
+        bind: "if_descr"
+        oids: "1.3.6.1.2.1.2.2.1.2"  # ifDescr
+      }
+    }
+  }
+
+  updates {
+    path: "/interfaces/interface[name={if_descr}]/state/admin-status"
+    transformation {
+      bind: "link_down_admin_status"
+      expressions: "to_int(if_admin_status)"
+      noc_paths {
+        bind: "if_admin_status"
+        oids: "1.3.6.1.2.1.2.2.1.7"  # ifAdminStatus
+      }
+      noc_paths {
+        bind: "if_descr"
+        oids: "1.3.6.1.2.1.2.2.1.2"  # ifDescr
+      }
+    }
+  }
+}
+
+# coldStart
+traps {
+  trap_oid: "1.3.6.1.6.3.1.1.5.1"
+
+  updates {
+    path: "/system/state/up-time"
+    transformation {
+      bind: "cold_start_up_time"
+      expressions: "to_int(sys_up_time) / 100"
+      noc_paths {
+        bind: "sys_up_time"
+        oids: "1.3.6.1.2.1.1.3"  # sysUpTime
+      }
+    }
+  }
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traps
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gosnmp/gosnmp"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+const (
+	// snmpTrapOID is the varbind carrying the trap's OID in SNMPv2c and SNMPv3 traps and informs.
+	snmpTrapOID = "1.3.6.1.6.3.1.1.4.1.0"
+	// snmpTraps is the prefix of the OIDs of the generic SNMPv1 traps (see RFC 3584).
+	snmpTraps = "1.3.6.1.6.3.1.1.5"
+	// enterpriseSpecific is the generic trap number of SNMPv1 enterprise specific traps.
+	enterpriseSpecific = 6
+)
+
+/*
+Listener receives SNMP traps and informs over UDP and passes them to a Handler. Informs are
+acknowledged. Senders are identified by matching their address against the addresses of the targets
+in an inventory; traps from other senders are named by their IP address.
+*/
+type Listener struct {
+	handler  *Handler
+	targets  map[string]string // Host -> target name.
+	listener *gosnmp.TrapListener
+	now      func() time.Time
+}
+
+// NewListener returns a listener which passes traps to the given handler.
+func NewListener(handler *Handler, inventory *pb.Inventory) *Listener {
+	targets := map[string]string{}
+	for _, target := range inventory.GetTargets() {
+		host := target.GetAddress()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		targets[host] = target.GetName()
+	}
+	l := &Listener{
+		handler:  handler,
+		targets:  targets,
+		listener: gosnmp.NewTrapListener(),
+		now:      time.Now,
+	}
+	l.listener.Params = gosnmp.Default
+	l.listener.OnNewTrap = l.onTrap
+	return l
+}
+
+// Listen receives traps on the given UDP address (eg: ":162") until Close is called.
+func (l *Listener) Listen(addr string) error {
+	return l.listener.Listen(addr)
+}
+
+// Close stops listening.
+func (l *Listener) Close() {
+	l.listener.Close()
+}
+
+func (l *Listener) onTrap(packet *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	target := addr.IP.String()
+	if name, ok := l.targets[target]; ok {
+		target = name
+	}
+	trap, err := trapFromPacket(packet, target, l.now())
+	if err != nil {
+		glog.Warningf("ignoring trap from %v: %v", addr, err)
+		return
+	}
+	if err := l.handler.Handle(context.Background(), trap); err != nil {
+		glog.Warningf("could not handle trap %v from %q: %v", trap.OID, target, err)
+	}
+}
+
+// trapFromPacket converts an SNMP trap or inform packet to a Trap.
+func trapFromPacket(packet *gosnmp.SnmpPacket, target string, now time.Time) (Trap, error) {
+	trap := Trap{
+		Target:    target,
+		Varbinds:  map[string]interface{}{},
+		Timestamp: now,
+	}
+	for _, pdu := range packet.Variables {
+		oid := normalizeOid(pdu.Name)
+		if oid == snmpTrapOID {
+			trapOID, ok := pdu.Value.(string)
+			if !ok {
+				return Trap{}, fmt.Errorf("snmpTrapOID.0 has unexpected type %T", pdu.Value)
+			}
+			trap.OID = normalizeOid(trapOID)
+			continue
+		}
+		trap.Varbinds[oid] = varbindValue(pdu)
+	}
+	if packet.PDUType == gosnmp.Trap {
+		// SNMPv1 traps identify themselves in their header.
+		if packet.GenericTrap == enterpriseSpecific {
+			trap.OID = fmt.Sprintf("%v.0.%d", normalizeOid(packet.Enterprise), packet.SpecificTrap)
+		} else {
+			trap.OID = fmt.Sprintf("%v.%d", snmpTraps, packet.GenericTrap+1)
+		}
+	}
+	if trap.OID == "" {
+		return Trap{}, fmt.Errorf("trap has no snmpTrapOID.0 varbind")
+	}
+	return trap, nil
+}
+
+/*
+varbindValue converts a varbind's value to a string, the form in which transformations receive
+polled values.
+*/
+func varbindValue(pdu gosnmp.SnmpPDU) interface{} {
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		if pdu.Type == gosnmp.ObjectIdentifier {
+			return normalizeOid(v)
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traps
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gosnmp/gosnmp"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+func TestTrapFromPacket(t *testing.T) {
+	now := time.Unix(1545178344, 0)
+	for _, test := range []struct {
+		name          string
+		packet        *gosnmp.SnmpPacket
+		expected      Trap
+		expectedError bool
+	}{
+		{
+			name: "v2c",
+			packet: &gosnmp.SnmpPacket{
+				Version: gosnmp.Version2c,
+				PDUType: gosnmp.SNMPv2Trap,
+				Variables: []gosnmp.SnmpPDU{
+					{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(2000)},
+					{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.3"},
+					{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: []byte("Ethernet1/1")},
+				},
+			},
+			expected: Trap{
+				Target: "switch1",
+				OID:    "1.3.6.1.6.3.1.1.5.3",
+				Varbinds: map[string]interface{}{
+					"1.3.6.1.2.1.1.3.0":     "2000",
+					"1.3.6.1.2.1.2.2.1.2.2": "Ethernet1/1",
+				},
+				Timestamp: now,
+			},
+		},
+		{
+			name: "v1 generic",
+			packet: &gosnmp.SnmpPacket{
+				Version:  gosnmp.Version1,
+				PDUType:  gosnmp.Trap,
+				SnmpTrap: gosnmp.SnmpTrap{Enterprise: ".1.3.6.1.4.1.9", GenericTrap: 2},
+			},
+			expected: Trap{Target: "switch1", OID: "1.3.6.1.6.3.1.1.5.3", Varbinds: map[string]interface{}{}, Timestamp: now},
+		},
+		{
+			name: "v1 enterprise specific",
+			packet: &gosnmp.SnmpPacket{
+				Version:  gosnmp.Version1,
+				PDUType:  gosnmp.Trap,
+				SnmpTrap: gosnmp.SnmpTrap{Enterprise: ".1.3.6.1.4.1.9", GenericTrap: 6, SpecificTrap: 1},
+			},
+			expected: Trap{Target: "switch1", OID: "1.3.6.1.4.1.9.0.1", Varbinds: map[string]interface{}{}, Timestamp: now},
+		},
+		{
+			name:          "v2c without snmpTrapOID",
+			packet:        &gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.SNMPv2Trap},
+			expectedError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := trapFromPacket(test.packet, "switch1", now)
+			switch {
+			case err != nil && !test.expectedError:
+				t.Errorf("trapFromPacket() got error: %v", err)
+			case err == nil && test.expectedError:
+				t.Errorf("trapFromPacket() = %+v, expected error", got)
+			case err == nil && !cmp.Equal(got, test.expected):
+				t.Errorf("trapFromPacket() = %+v, expected %+v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestListenerIdentifiesTargets(t *testing.T) {
+	h, s := makeHandler(t)
+	l := NewListener(h, &pb.Inventory{
+		Targets: []*pb.Target{{Name: "switch1", Address: "192.0.2.1:161"}},
+	})
+	l.now = func() time.Time { return time.Unix(0, 42) }
+	packet := &gosnmp.SnmpPacket{
+		Version: gosnmp.Version2c,
+		PDUType: gosnmp.SNMPv2Trap,
+		Variables: []gosnmp.SnmpPDU{
+			{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.1"},
+			{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(2000)},
+		},
+	}
+	l.onTrap(packet, &net.UDPAddr{IP: net.ParseIP("192.0.2.1")})
+	l.onTrap(packet, &net.UDPAddr{IP: net.ParseIP("192.0.2.2")})
+	if len(s.notifications) != 2 {
+		t.Fatalf("onTrap() sent %d notifications, expected 2", len(s.notifications))
+	}
+	for i, expected := range []string{"switch1", "192.0.2.2"} {
+		if got := s.notifications[i].GetPrefix().GetTarget(); got != expected {
+			t.Errorf("notification %d has target %q, expected %q", i, got, expected)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package traps maps SNMP traps and informs to OpenConfig updates, covering event telemetry as well as
+polled state. Each trap is evaluated through the transformations of a TrapMappings proto (see
+proto/traps.proto), with the trap's varbinds in place of polled NocPaths, and the resulting updates
+are sent to a sink as a gNMI notification, as ON_CHANGE subscriptions would deliver them.
+*/
+package traps
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/orismologer/functions"
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/oparse"
+	"github.com/google/orismologer/sink"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// placeholderRe matches references to NocPaths in the keys of a TrapUpdate's path, eg: {if_descr}.
+var placeholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Trap is a received SNMP trap or inform.
+type Trap struct {
+	// Target names the device which sent the trap.
+	Target string
+	// OID identifies the kind of trap (see TrapMapping.trap_oid).
+	OID string
+	// Varbinds maps varbind OIDs to their values.
+	Varbinds  map[string]interface{}
+	Timestamp time.Time
+}
+
+type update struct {
+	path           string
+	transformation *pb.Transformation
+	expressions    []*oparse.Expression
+}
+
+// Handler converts traps to OpenConfig updates and sends them to a sink.
+type Handler struct {
+	updates   map[string][]update // Trap OID -> updates.
+	sink      sink.Sink
+	functions functions.Library
+}
+
+/*
+NewHandler returns a handler for the traps in the given mappings, which sends updates to the given
+sink. Expressions and path templates are validated up front.
+*/
+func NewHandler(mappings *pb.TrapMappings, s sink.Sink) (*Handler, error) {
+	h := &Handler{
+		updates:   map[string][]update{},
+		sink:      s,
+		functions: functions.NewLibrary(),
+	}
+	for _, trap := range mappings.GetTraps() {
+		oid := normalizeOid(trap.GetTrapOid())
+		if oid == "" {
+			return nil, fmt.Errorf("trap mapping without a trap OID")
+		}
+		for _, u := range trap.GetUpdates() {
+			parsed, err := h.newUpdate(u)
+			if err != nil {
+				return nil, fmt.Errorf("invalid update for trap %v: %v", oid, err)
+			}
+			h.updates[oid] = append(h.updates[oid], parsed)
+		}
+	}
+	return h, nil
+}
+
+func (h *Handler) newUpdate(u *pb.TrapUpdate) (update, error) {
+	transformation := u.GetTransformation()
+	nocPaths := map[string]bool{}
+	for _, nocPath := range transformation.GetNocPaths() {
+		nocPaths[nocPath.GetBind()] = true
+	}
+	if !strings.HasPrefix(u.GetPath(), "/") {
+		return update{}, fmt.Errorf("path %q is not absolute", u.GetPath())
+	}
+	for _, match := range placeholderRe.FindAllStringSubmatch(u.GetPath(), -1) {
+		if !nocPaths[match[1]] {
+			return update{}, fmt.Errorf("path %q refers to undefined NocPath %q", u.GetPath(), match[1])
+		}
+	}
+	parsed := update{path: u.GetPath(), transformation: transformation}
+	for _, expressionString := range transformation.GetExpressions() {
+		expression, err := oparse.Parse(expressionString)
+		if err != nil {
+			return update{}, fmt.Errorf("could not parse expression `%v`: %v", expressionString, err)
+		}
+		variables, funcs := expression.Identifiers()
+		for _, variable := range variables {
+			if !nocPaths[variable] {
+				return update{}, fmt.Errorf("expression `%v` refers to undefined NocPath %q", expressionString, variable)
+			}
+		}
+		for _, f := range funcs {
+			if !h.functions.Contains(f) {
+				return update{}, fmt.Errorf("expression `%v` calls undefined function %q", expressionString, f)
+			}
+		}
+		parsed.expressions = append(parsed.expressions, expression)
+	}
+	if len(parsed.expressions) == 0 {
+		return update{}, fmt.Errorf("transformation %q has no expressions", transformation.GetBind())
+	}
+	return parsed, nil
+}
+
+/*
+Handle converts a trap to a notification and sends it to the handler's sink. Traps which are not
+mapped are ignored.
+*/
+func (h *Handler) Handle(ctx context.Context, trap Trap) error {
+	notification, err := h.Notification(trap)
+	if err != nil {
+		return err
+	}
+	if notification == nil {
+		return nil
+	}
+	return h.sink.Send(ctx, notification)
+}
+
+/*
+Notification converts a trap to a notification, with one update per mapped leaf which could be
+evaluated. It returns nil if the trap is not mapped, or none of its leaves could be evaluated.
+*/
+func (h *Handler) Notification(trap Trap) (*gpb.Notification, error) {
+	updates, ok := h.updates[normalizeOid(trap.OID)]
+	if !ok {
+		glog.V(1).Infof("ignoring unmapped trap %v from %q", trap.OID, trap.Target)
+		return nil, nil
+	}
+	varbinds := map[string]interface{}{}
+	for oid, value := range trap.Varbinds {
+		varbinds[normalizeOid(oid)] = value
+	}
+	notification := &gpb.Notification{
+		Timestamp: trap.Timestamp.UnixNano(),
+		Prefix:    &gpb.Path{Target: trap.Target},
+	}
+	for _, u := range updates {
+		path, value, err := h.eval(u, varbinds)
+		if err != nil {
+			glog.Warningf("could not evaluate %q for trap %v from %q: %v", u.path, trap.OID, trap.Target, err)
+			continue
+		}
+		gnmiUpdate, err := gnmiserver.Update(path, value)
+		if err != nil {
+			return nil, err
+		}
+		notification.Update = append(notification.Update, gnmiUpdate)
+	}
+	if len(notification.Update) == 0 {
+		return nil, nil
+	}
+	return notification, nil
+}
+
+// eval evaluates an update with the given varbinds, returning the path (with keys filled in) and value.
+func (h *Handler) eval(u update, varbinds map[string]interface{}) (string, interface{}, error) {
+	values := oparse.Context{}
+	for _, nocPath := range u.transformation.GetNocPaths() {
+		if value, ok := lookup(nocPath, varbinds); ok {
+			values[nocPath.GetBind()] = value
+		}
+	}
+	var unresolved error
+	path := placeholderRe.ReplaceAllStringFunc(u.path, func(placeholder string) string {
+		bind := placeholder[1 : len(placeholder)-1]
+		value, ok := values[bind]
+		if !ok {
+			unresolved = fmt.Errorf("trap has no varbind for NocPath %q", bind)
+			return ""
+		}
+		return fmt.Sprint(value)
+	})
+	if unresolved != nil {
+		return "", nil, unresolved
+	}
+	for i, expression := range u.expressions {
+		variables, _ := expression.Identifiers()
+		complete := true
+		for _, variable := range variables {
+			if _, ok := values[variable]; !ok {
+				complete = false
+			}
+		}
+		if !complete {
+			glog.V(1).Infof("trap lacks varbinds for expression `%v`", u.transformation.GetExpressions()[i])
+			continue
+		}
+		value, err := oparse.Eval(expression, values, h.functions.Call)
+		if err != nil {
+			return "", nil, err
+		}
+		return path, value, nil
+	}
+	return "", nil, fmt.Errorf("trap lacks varbinds for every expression of transformation %q", u.transformation.GetBind())
+}
+
+/*
+lookup returns the value of the varbind matching the first of the NocPath's OIDs it can, ie: with an
+equal OID or the OID of an instance of it. If several instances match, the lowest OID (as a string)
+is used.
+*/
+func lookup(nocPath *pb.NocPath, varbinds map[string]interface{}) (interface{}, bool) {
+	for _, oid := range nocPath.GetOids() {
+		oid = normalizeOid(oid)
+		if value, ok := varbinds[oid]; ok {
+			return value, true
+		}
+		var instances []string
+		for varbind := range varbinds {
+			if strings.HasPrefix(varbind, oid+".") {
+				instances = append(instances, varbind)
+			}
+		}
+		if len(instances) > 0 {
+			sort.Strings(instances)
+			return varbinds[instances[0]], true
+		}
+	}
+	return nil, false
+}
+
+// normalizeOid removes the leading dot some agents and libraries include in OIDs.
+func normalizeOid(oid string) string {
+	return strings.TrimPrefix(oid, ".")
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/gnmiserver"
+	"github.com/google/orismologer/utils"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// recordingSink records the notifications sent to it.
+type recordingSink struct {
+	notifications []*gpb.Notification
+}
+
+func (s *recordingSink) Send(ctx context.Context, notification *gpb.Notification) error {
+	s.notifications = append(s.notifications, notification)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func makeHandler(t *testing.T) (*Handler, *recordingSink) {
+	mappings, err := utils.LoadTrapMappings("../testdata/traps_test.pb")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	s := &recordingSink{}
+	h, err := NewHandler(mappings, s)
+	if err != nil {
+		t.Fatalf("NewHandler() got error: %v", err)
+	}
+	return h, s
+}
+
+func mustUpdate(t *testing.T, path string, value interface{}) *gpb.Update {
+	update, err := gnmiserver.Update(path, value)
+	if err != nil {
+		t.Fatalf("Update(%q) got error: %v", path, err)
+	}
+	return update
+}
+
+func TestHandle(t *testing.T) {
+	h, s := makeHandler(t)
+	timestamp := time.Unix(1545178344, 0)
+	for _, test := range []struct {
+		name     string
+		trap     Trap
+		expected *gpb.Notification
+	}{
+		{
+			name: "linkDown",
+			trap: Trap{
+				Target: "switch1",
+				OID:    ".1.3.6.1.6.3.1.1.5.3",
+				Varbinds: map[string]interface{}{
+					".1.3.6.1.2.1.2.2.1.1.2": "2",
+					".1.3.6.1.2.1.2.2.1.7.2": "1",
+					".1.3.6.1.2.1.2.2.1.2.2": "Ethernet1/1",
+				},
+				Timestamp: timestamp,
+			},
+			expected: &gpb.Notification{
+				Timestamp: timestamp.UnixNano(),
+				Prefix:    &gpb.Path{Target: "switch1"},
+				Update: []*gpb.Update{
+					mustUpdate(t, "/interfaces/interface[name=Ethernet1/1]/state/oper-status", "DOWN"),
+					mustUpdate(t, "/interfaces/interface[name=Ethernet1/1]/state/admin-status", 1),
+				},
+			},
+		},
+		{
+			name: "linkDown without ifAdminStatus",
+			trap: Trap{
+				Target: "switch1",
+				OID:    "1.3.6.1.6.3.1.1.5.3",
+				Varbinds: map[string]interface{}{
+					"1.3.6.1.2.1.2.2.1.2.2": "Ethernet1/1",
+				},
+				Timestamp: timestamp,
+			},
+			expected: &gpb.Notification{
+				Timestamp: timestamp.UnixNano(),
+				Prefix:    &gpb.Path{Target: "switch1"},
+				Update: []*gpb.Update{
+					mustUpdate(t, "/interfaces/interface[name=Ethernet1/1]/state/oper-status", "DOWN"),
+				},
+			},
+		},
+		{
+			name: "unmapped trap",
+			trap: Trap{Target: "switch1", OID: "1.3.6.1.4.1.9.0.1", Timestamp: timestamp},
+		},
+		{
+			name: "no varbinds for path keys",
+			trap: Trap{Target: "switch1", OID: "1.3.6.1.6.3.1.1.5.3", Timestamp: timestamp},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s.notifications = nil
+			if err := h.Handle(context.Background(), test.trap); err != nil {
+				t.Fatalf("Handle() got error: %v", err)
+			}
+			switch {
+			case test.expected == nil && len(s.notifications) != 0:
+				t.Errorf("Handle() sent %v, expected nothing", s.notifications)
+			case test.expected != nil && len(s.notifications) != 1:
+				t.Errorf("Handle() sent %v, expected %v", s.notifications, test.expected)
+			case test.expected != nil && !proto.Equal(s.notifications[0], test.expected):
+				t.Errorf("Handle() sent %v, expected %v", s.notifications[0], test.expected)
+			}
+		})
+	}
+}
+
+func TestNewHandlerErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		update *pb.TrapUpdate
+	}{
+		{
+			name: "relative path",
+			update: &pb.TrapUpdate{
+				Path:           "system/state/up-time",
+				Transformation: &pb.Transformation{Bind: "t", Expressions: []string{"1"}},
+			},
+		},
+		{
+			name: "undefined path key",
+			update: &pb.TrapUpdate{
+				Path:           "/interfaces/interface[name={if_descr}]/state/oper-status",
+				Transformation: &pb.Transformation{Bind: "t", Expressions: []string{"1"}},
+			},
+		},
+		{
+			name: "undefined variable",
+			update: &pb.TrapUpdate{
+				Path:           "/system/state/up-time",
+				Transformation: &pb.Transformation{Bind: "t", Expressions: []string{"up_time"}},
+			},
+		},
+		{
+			name: "undefined function",
+			update: &pb.TrapUpdate{
+				Path:           "/system/state/up-time",
+				Transformation: &pb.Transformation{Bind: "t", Expressions: []string{"undefined(1)"}},
+			},
+		},
+		{
+			name: "no expressions",
+			update: &pb.TrapUpdate{
+				Path:           "/system/state/up-time",
+				Transformation: &pb.Transformation{Bind: "t"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mappings := &pb.TrapMappings{
+				Traps: []*pb.TrapMapping{{TrapOid: "1.3.6.1.6.3.1.1.5.1", Updates: []*pb.TrapUpdate{test.update}}},
+			}
+			if _, err := NewHandler(mappings, &recordingSink{}); err == nil {
+				t.Errorf("NewHandler() expected error, got none")
+			}
+		})
+	}
+}
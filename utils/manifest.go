@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// ManifestFile describes one of the files a configuration was loaded from.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+
+	// Role is what the file holds (eg: RoleMappings), if known.
+	Role string `json:"role,omitempty"`
+}
+
+// Roles of the files of a configuration (see ManifestFile.Role).
+const (
+	RoleMappings        = "mappings"
+	RoleTransformations = "transformations"
+	RoleVendorOids      = "vendor_oids"
+)
+
+/*
+Manifest summarizes a loaded configuration, so operators can confirm which version of a config a
+collector is running.
+*/
+type Manifest struct {
+	Files           []ManifestFile `json:"files"`
+	Leaves          int            `json:"leaves"`
+	Transformations int            `json:"transformations"`
+	NocPaths        int            `json:"noc_paths"`
+	Expressions     int            `json:"expressions"`
+
+	// Scripts lists the scripts of the transformations, which define functions.
+	Scripts []ManifestFile `json:"scripts,omitempty"`
+
+	// Profiles names the vendors whose profiles were included (see the profiles package).
+	Profiles []string `json:"profiles,omitempty"`
+
+	// Checksum identifies the configuration as a whole. It is the SHA256 of the files' and scripts' hashes.
+	Checksum string `json:"checksum"`
+}
+
+/*
+NewManifest builds a manifest for the given files and the Mappings and Transformations protos loaded
+from them. Files are listed in the order given, which also determines the overall checksum, followed
+by the transformations' scripts.
+*/
+func NewManifest(mappings *pb.Mappings, transformations *pb.Transformations, files ...string) (*Manifest, error) {
+	m := &Manifest{}
+	overall := sha256.New()
+	for _, file := range files {
+		f, err := hashFile(file, overall)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, f)
+	}
+	for _, script := range transformations.GetScripts() {
+		f, err := hashFile(script, overall)
+		if err != nil {
+			return nil, err
+		}
+		m.Scripts = append(m.Scripts, f)
+	}
+	m.Checksum = hex.EncodeToString(overall.Sum(nil))
+	for _, node := range mappings.GetNodes() {
+		m.Leaves += countBoundNodes(node)
+	}
+	for _, transformation := range transformations.GetTransformations() {
+		m.Transformations++
+		m.Expressions += len(transformation.GetExpressions())
+		m.NocPaths += len(transformation.GetNocPaths())
+	}
+	return m, nil
+}
+
+// hashFile describes the given file, adding its hash to overall.
+func hashFile(file string, overall hash.Hash) (ManifestFile, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("could not hash config file: %v", err)
+	}
+	sum := sha256.Sum256(contents)
+	overall.Write(sum[:])
+	return ManifestFile{
+		Path:   file,
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   len(contents),
+	}, nil
+}
+
+// countBoundNodes returns the number of nodes in the given subtree which are bound to a transformation.
+func countBoundNodes(node *pb.OpenConfigNode) int {
+	count := 0
+	if node.GetBind() != "" {
+		count++
+	}
+	for _, child := range node.GetChildren() {
+		count += countBoundNodes(child)
+	}
+	return count
+}
+
+// File returns the file with the given role (eg: RoleMappings), or false if there is none.
+func (m *Manifest) File(role string) (ManifestFile, bool) {
+	if m == nil {
+		return ManifestFile{}, false
+	}
+	for _, file := range m.Files {
+		if file.Role == role {
+			return file, true
+		}
+	}
+	return ManifestFile{}, false
+}
+
+func (m *Manifest) String() string {
+	lines := []string{fmt.Sprintf("checksum: %v", m.Checksum)}
+	for _, file := range m.Files {
+		lines = append(lines, fmt.Sprintf("file: %v (%d bytes, sha256 %v)", file.Path, file.Size, file.SHA256))
+	}
+	for _, script := range m.Scripts {
+		lines = append(lines, fmt.Sprintf("script: %v (%d bytes, sha256 %v)", script.Path, script.Size, script.SHA256))
+	}
+	lines = append(lines,
+		fmt.Sprintf("leaves: %d", m.Leaves),
+		fmt.Sprintf("transformations: %d", m.Transformations),
+		fmt.Sprintf("expressions: %d", m.Expressions),
+		fmt.Sprintf("noc paths: %d", m.NocPaths),
+	)
+	if len(m.Profiles) > 0 {
+		lines = append(lines, fmt.Sprintf("profiles: %v", strings.Join(m.Profiles, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestNewManifest(t *testing.T) {
+	const (
+		mappingsFile        = "../testdata/oc_tree_test_mappings.pb"
+		transformationsFile = "../testdata/orismologer_test_transformations.pb"
+	)
+	mappings, err := LoadMappings(mappingsFile)
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	transformations, err := LoadTransformations(transformationsFile)
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	m, err := NewManifest(mappings, transformations, mappingsFile, transformationsFile)
+	if err != nil {
+		t.Fatalf("NewManifest() got error: %v", err)
+	}
+	if len(m.Files) != 2 {
+		t.Errorf("NewManifest() listed %d files, expected 2", len(m.Files))
+	}
+	if m.Leaves != 1 {
+		t.Errorf("NewManifest() counted %d leaves, expected 1", m.Leaves)
+	}
+	if m.Transformations != 7 {
+		t.Errorf("NewManifest() counted %d transformations, expected 7", m.Transformations)
+	}
+	if m.NocPaths != 9 {
+		t.Errorf("NewManifest() counted %d NocPaths, expected 9", m.NocPaths)
+	}
+
+	// The overall checksum depends on file order.
+	reordered, err := NewManifest(mappings, transformations, transformationsFile, mappingsFile)
+	if err != nil {
+		t.Fatalf("NewManifest() got error: %v", err)
+	}
+	if m.Checksum == reordered.Checksum {
+		t.Errorf("NewManifest() checksum did not change when files were reordered")
+	}
+
+	if _, err := NewManifest(mappings, transformations, "missing.pb"); err == nil {
+		t.Errorf("NewManifest() with missing file expected error, got none")
+	}
+
+	// Scripts are part of the configuration.
+	transformations.Scripts = []string{mappingsFile}
+	withScripts, err := NewManifest(mappings, transformations, mappingsFile, transformationsFile)
+	if err != nil {
+		t.Fatalf("NewManifest() got error: %v", err)
+	}
+	if len(withScripts.Scripts) != 1 || withScripts.Checksum == m.Checksum {
+		t.Errorf("NewManifest() listed scripts %v with checksum %v, expected one script and a new checksum", withScripts.Scripts, withScripts.Checksum)
+	}
+	transformations.Scripts = []string{"missing.star"}
+	if _, err := NewManifest(mappings, transformations, mappingsFile, transformationsFile); err == nil {
+		t.Errorf("NewManifest() with missing script expected error, got none")
+	}
+}
+
+func TestManifestFile(t *testing.T) {
+	m := &Manifest{Files: []ManifestFile{{Path: "t.pb", Role: RoleTransformations}, {Path: "m.pb", Role: RoleMappings}}}
+	if file, ok := m.File(RoleMappings); !ok || file.Path != "m.pb" {
+		t.Errorf("File(%q) = %v, %v, expected m.pb", RoleMappings, file, ok)
+	}
+	if file, ok := m.File(RoleVendorOids); ok {
+		t.Errorf("File(%q) = %v, expected none", RoleVendorOids, file)
+	}
+	var missing *Manifest
+	if file, ok := missing.File(RoleMappings); ok {
+		t.Errorf("File() of a nil manifest = %v, expected none", file)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SecretPrefix marks a config value as a reference to a secret, eg: "secret:env:SNMP_COMMUNITY".
+const SecretPrefix = "secret:"
+
+// SecretProvider looks up the secret identified by a provider-specific reference.
+type SecretProvider interface {
+	Secret(ref string) (string, error)
+}
+
+// EnvSecretProvider reads secrets from environment variables. References are variable names.
+type EnvSecretProvider struct{}
+
+// Secret implements SecretProvider.
+func (EnvSecretProvider) Secret(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", ref)
+	}
+	return value, nil
+}
+
+/*
+FileSecretProvider reads secrets from files. References are paths, relative to Dir if they are not
+absolute. Trailing newlines are removed.
+*/
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret implements SecretProvider.
+func (p FileSecretProvider) Secret(ref string) (string, error) {
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.Dir, path)
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file: %v", err)
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+/*
+ExecSecretProvider runs a command (eg: a password manager CLI) with the reference appended to its
+arguments, and uses its standard output as the secret. Trailing newlines are removed.
+*/
+type ExecSecretProvider struct {
+	Command string
+	Args    []string
+}
+
+// Secret implements SecretProvider.
+func (p ExecSecretProvider) Secret(ref string) (string, error) {
+	cmd := exec.Command(p.Command, append(append([]string{}, p.Args...), ref)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret command %q failed: %v: %s", p.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+/*
+KMSClient decrypts data with a key held by a cloud key management service. Implementations wrap a
+particular cloud provider's SDK (eg: Cloud KMS's KeyManagementClient.Decrypt).
+*/
+type KMSClient interface {
+	Decrypt(ctx context.Context, keyName string, ciphertext []byte) ([]byte, error)
+}
+
+/*
+KMSSecretProvider decrypts secrets with a cloud KMS key. References are base64-encoded ciphertext,
+so encrypted secrets can be stored alongside the rest of a config.
+*/
+type KMSSecretProvider struct {
+	Client  KMSClient
+	KeyName string
+}
+
+// Secret implements SecretProvider.
+func (p KMSSecretProvider) Secret(ref string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return "", fmt.Errorf("KMS secret is not valid base64: %v", err)
+	}
+	plaintext, err := p.Client.Decrypt(context.Background(), p.KeyName, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret with key %q: %v", p.KeyName, err)
+	}
+	return string(plaintext), nil
+}
+
+/*
+Secrets maps reference schemes (eg: "env", "file") to the providers which handle them. Config
+loaders use it to resolve credential references of the form "secret:<scheme>:<ref>".
+*/
+type Secrets map[string]SecretProvider
+
+// DefaultSecrets returns the providers which need no configuration.
+func DefaultSecrets() Secrets {
+	return Secrets{
+		"env":  EnvSecretProvider{},
+		"file": FileSecretProvider{},
+	}
+}
+
+/*
+Resolve returns the secret referenced by value if it starts with SecretPrefix, and value unchanged
+otherwise.
+*/
+func (s Secrets) Resolve(value string) (string, error) {
+	if !strings.HasPrefix(value, SecretPrefix) {
+		return value, nil
+	}
+	ref := strings.TrimPrefix(value, SecretPrefix)
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("secret reference %q should be of the form %v<scheme>:<ref>", value, SecretPrefix)
+	}
+	provider, ok := s[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("no secret provider registered for scheme %q", parts[0])
+	}
+	secret, err := provider.Secret(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("could not resolve secret %q: %v", ref, err)
+	}
+	return secret, nil
+}
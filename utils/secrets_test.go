@@ -0,0 +1,129 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type reverseKMS struct{}
+
+func (reverseKMS) Decrypt(ctx context.Context, keyName string, ciphertext []byte) ([]byte, error) {
+	if keyName != "key" {
+		return nil, errors.New("unknown key")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	for i, b := range ciphertext {
+		plaintext[len(ciphertext)-1-i] = b
+	}
+	return plaintext, nil
+}
+
+func TestSecretsResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "community"), []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Error during test set up: %v", err)
+	}
+	os.Setenv("ORISMOLOGER_TEST_SECRET", "from-env")
+	defer os.Unsetenv("ORISMOLOGER_TEST_SECRET")
+
+	secrets := Secrets{
+		"env":  EnvSecretProvider{},
+		"file": FileSecretProvider{Dir: dir},
+		"exec": ExecSecretProvider{Command: "echo", Args: []string{"-n"}},
+		"kms":  KMSSecretProvider{Client: reverseKMS{}, KeyName: "key"},
+	}
+	for _, test := range []struct {
+		name         string
+		value        string
+		expected     string
+		expectsError bool
+	}{
+		{
+			name:     "literal",
+			value:    "public",
+			expected: "public",
+		},
+		{
+			name:     "env",
+			value:    "secret:env:ORISMOLOGER_TEST_SECRET",
+			expected: "from-env",
+		},
+		{
+			name:         "unset env",
+			value:        "secret:env:ORISMOLOGER_TEST_UNSET",
+			expectsError: true,
+		},
+		{
+			name:     "file",
+			value:    "secret:file:community",
+			expected: "from-file",
+		},
+		{
+			name:         "missing file",
+			value:        "secret:file:missing",
+			expectsError: true,
+		},
+		{
+			name:     "exec",
+			value:    "secret:exec:from-exec",
+			expected: "from-exec",
+		},
+		{
+			name:     "kms",
+			value:    "secret:kms:" + base64.StdEncoding.EncodeToString([]byte("smk-morf")),
+			expected: "from-kms",
+		},
+		{
+			name:         "kms invalid base64",
+			value:        "secret:kms:!!!",
+			expectsError: true,
+		},
+		{
+			name:         "unknown scheme",
+			value:        "secret:vault:thing",
+			expectsError: true,
+		},
+		{
+			name:         "malformed reference",
+			value:        "secret:env",
+			expectsError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := secrets.Resolve(test.value)
+			switch {
+			case err != nil && !test.expectsError:
+				t.Errorf("Resolve(%q) got error: %v", test.value, err)
+			case err == nil && test.expectsError:
+				t.Errorf("Resolve(%q) = %q, expected error", test.value, got)
+			case err == nil && got != test.expected:
+				t.Errorf("Resolve(%q) = %q, expected %q", test.value, got, test.expected)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ package utils
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/golang/protobuf/proto"
@@ -41,7 +42,7 @@ func LoadMappings(mappingsFile string) (*pb.Mappings, error) {
 }
 
 // LoadTransformations deserializes a text proto file at a given path as a Transformations proto
-// message.
+// message. Relative paths of scripts are resolved against the file's directory.
 func LoadTransformations(transformationsFile string) (*pb.Transformations, error) {
 	bytes, err := ioutil.ReadFile(transformationsFile)
 	if err != nil {
@@ -51,6 +52,11 @@ func LoadTransformations(transformationsFile string) (*pb.Transformations, error
 	if err := proto.UnmarshalText(string(bytes), transformations); err != nil {
 		return nil, fmt.Errorf("could not deserialize transformations: %v", err)
 	}
+	for i, script := range transformations.GetScripts() {
+		if !filepath.IsAbs(script) {
+			transformations.Scripts[i] = filepath.Join(filepath.Dir(transformationsFile), script)
+		}
+	}
 	return transformations, nil
 }
 
@@ -67,6 +73,66 @@ func LoadVendorOids(vendorOidsFile string) (*pb.VendorOids, error) {
 	return vendorOids, nil
 }
 
+/*
+LoadInventory deserializes a text proto file at a given path as an Inventory proto message.
+Credential values which reference secrets are replaced with the secrets, looked up using the given
+providers.
+*/
+func LoadInventory(inventoryFile string, secrets Secrets) (*pb.Inventory, error) {
+	bytes, err := ioutil.ReadFile(inventoryFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open inventory file: %v", err)
+	}
+	inventory := &pb.Inventory{}
+	if err := proto.UnmarshalText(string(bytes), inventory); err != nil {
+		return nil, fmt.Errorf("could not deserialize inventory: %v", err)
+	}
+	for _, target := range inventory.GetTargets() {
+		for key, value := range target.GetCredentials() {
+			secret, err := secrets.Resolve(value)
+			if err != nil {
+				return nil, fmt.Errorf("could not resolve credential %q of target %q: %v", key, target.GetName(), err)
+			}
+			target.Credentials[key] = secret
+		}
+	}
+	return inventory, nil
+}
+
+// LoadTrapMappings deserializes a text proto file at a given path as a TrapMappings proto message.
+func LoadTrapMappings(trapMappingsFile string) (*pb.TrapMappings, error) {
+	bytes, err := ioutil.ReadFile(trapMappingsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open trap mappings file: %v", err)
+	}
+	trapMappings := &pb.TrapMappings{}
+	if err := proto.UnmarshalText(string(bytes), trapMappings); err != nil {
+		return nil, fmt.Errorf("could not deserialize trap mappings: %v", err)
+	}
+	return trapMappings, nil
+}
+
+// LoadAlarms deserializes a text proto file at a given path as an Alarms proto message.
+func LoadAlarms(alarmsFile string) (*pb.Alarms, error) {
+	bytes, err := ioutil.ReadFile(alarmsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open alarms file: %v", err)
+	}
+	alarms := &pb.Alarms{}
+	if err := proto.UnmarshalText(string(bytes), alarms); err != nil {
+		return nil, fmt.Errorf("could not deserialize alarms: %v", err)
+	}
+	return alarms, nil
+}
+
+// SaveTextProto serializes a proto message as a text proto and writes it to the given path.
+func SaveTextProto(file string, message proto.Message) error {
+	if err := ioutil.WriteFile(file, []byte(proto.MarshalTextString(message)), 0644); err != nil {
+		return fmt.Errorf("could not write %q: %v", file, err)
+	}
+	return nil
+}
+
 // SliceToString returns a comma-separated string representing the contents of a slice.
 func SliceToString(slice []interface{}) string {
 	valueStrings := make([]string, len(slice))
@@ -75,3 +141,8 @@ func SliceToString(slice []interface{}) string {
 	}
 	return strings.Join(valueStrings, ", ")
 }
+
+// HasOidPrefix returns true if the given OID is equal to, or a descendant of, the given prefix.
+func HasOidPrefix(oid, prefix string) bool {
+	return oid == prefix || strings.HasPrefix(oid, prefix+".")
+}
@@ -17,7 +17,78 @@ limitations under the License.
 // Package utils provides miscellaneous utilities for Orismologer.
 package utils
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadInventory(t *testing.T) {
+	const inventoryFile = "../testdata/inventory_test.pb"
+	os.Setenv("ORISMOLOGER_TEST_COMMUNITY", "s3cret")
+	defer os.Unsetenv("ORISMOLOGER_TEST_COMMUNITY")
+	inventory, err := LoadInventory(inventoryFile, DefaultSecrets())
+	if err != nil {
+		t.Fatalf("LoadInventory() got error: %v", err)
+	}
+	credentials := inventory.GetTargets()[0].GetCredentials()
+	if got, expected := credentials["community"], "s3cret"; got != expected {
+		t.Errorf("LoadInventory() community = %q, expected %q", got, expected)
+	}
+	if got, expected := credentials["username"], "monitoring"; got != expected {
+		t.Errorf("LoadInventory() username = %q, expected %q", got, expected)
+	}
+
+	os.Unsetenv("ORISMOLOGER_TEST_COMMUNITY")
+	if _, err := LoadInventory(inventoryFile, DefaultSecrets()); err == nil {
+		t.Errorf("LoadInventory() with unset secret expected error, got none")
+	}
+}
+
+func TestLoadTransformationsScripts(t *testing.T) {
+	dir := t.TempDir()
+	transformationsFile := filepath.Join(dir, "transformations.pb")
+	if err := ioutil.WriteFile(transformationsFile, []byte(`scripts: "helpers.star" scripts: "/opt/scripts/vendor.star"`), 0644); err != nil {
+		t.Fatalf("Could not set up test: %v", err)
+	}
+	transformations, err := LoadTransformations(transformationsFile)
+	if err != nil {
+		t.Fatalf("LoadTransformations() got error: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "helpers.star"), "/opt/scripts/vendor.star"}
+	if diff := cmp.Diff(expected, transformations.GetScripts()); diff != "" {
+		t.Errorf("LoadTransformations() returned unexpected scripts (-expected +got):\n%v", diff)
+	}
+}
+
+func TestLoadTrapMappings(t *testing.T) {
+	trapMappings, err := LoadTrapMappings("../testdata/traps_test.pb")
+	if err != nil {
+		t.Fatalf("LoadTrapMappings() got error: %v", err)
+	}
+	if got, expected := len(trapMappings.GetTraps()), 2; got != expected {
+		t.Errorf("LoadTrapMappings() loaded %d traps, expected %d", got, expected)
+	}
+	if _, err := LoadTrapMappings("missing.pb"); err == nil {
+		t.Errorf("LoadTrapMappings() of missing file expected error, got none")
+	}
+}
+
+func TestLoadAlarms(t *testing.T) {
+	alarms, err := LoadAlarms("../testdata/alarms_test.pb")
+	if err != nil {
+		t.Fatalf("LoadAlarms() got error: %v", err)
+	}
+	if got, expected := len(alarms.GetAlarms()), 2; got != expected {
+		t.Errorf("LoadAlarms() loaded %d alarms, expected %d", got, expected)
+	}
+	if _, err := LoadAlarms("missing.pb"); err == nil {
+		t.Errorf("LoadAlarms() of missing file expected error, got none")
+	}
+}
 
 func TestSliceToString(t *testing.T) {
 	for _, test := range []struct {
@@ -43,3 +114,19 @@ func TestSliceToString(t *testing.T) {
 		})
 	}
 }
+
+func TestHasOidPrefix(t *testing.T) {
+	for _, test := range []struct {
+		oid, prefix string
+		expected    bool
+	}{
+		{oid: "1.3.6.1.4.1.9", prefix: "1.3.6.1.4.1.9", expected: true},
+		{oid: "1.3.6.1.4.1.9.9.109", prefix: "1.3.6.1.4.1.9", expected: true},
+		{oid: "1.3.6.1.4.1.99", prefix: "1.3.6.1.4.1.9"},
+		{oid: "1.3.6.1.4.1", prefix: "1.3.6.1.4.1.9"},
+	} {
+		if got := HasOidPrefix(test.oid, test.prefix); got != test.expected {
+			t.Errorf("HasOidPrefix(%q, %q) = %v, expected %v", test.oid, test.prefix, got, test.expected)
+		}
+	}
+}
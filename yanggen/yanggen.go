@@ -0,0 +1,232 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package yanggen generates Mappings skeletons from OpenConfig YANG modules, parsed with goyang. Every
+container, list and leaf in the modules becomes an OpenConfigNode, so that only transformations need
+be written by hand. Leaves are bound to suggested transformation names, and their YANG types are
+written as comments in the generated text proto.
+*/
+package yanggen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/openconfig/goyang/pkg/yang"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// Options controls which parts of the YANG schema are generated.
+type Options struct {
+	// StateOnly omits configuration (read-write) nodes, since telemetry is read from state nodes.
+	StateOnly bool
+}
+
+/*
+Load parses the given YANG modules (file or module names), searching the given directories for them
+and their imports, and returns the root entry of each module.
+*/
+func Load(paths, modules []string) ([]*yang.Entry, error) {
+	ms := yang.NewModules()
+	ms.AddPath(paths...)
+	for _, module := range modules {
+		if err := ms.Read(module); err != nil {
+			return nil, fmt.Errorf("could not read YANG module %q: %v", module, err)
+		}
+	}
+	if errs := ms.Process(); len(errs) > 0 {
+		return nil, fmt.Errorf("could not process YANG modules: %v", joinErrors(errs))
+	}
+	// Modules are keyed by both name and name@revision.
+	seen := map[*yang.Module]bool{}
+	var names []string
+	for name, module := range ms.Modules {
+		if !seen[module] {
+			seen[module] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var entries []*yang.Entry
+	for _, name := range names {
+		entry := yang.ToEntry(ms.Modules[name])
+		if errs := entry.GetErrors(); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid YANG module %q: %v", name, joinErrors(errs))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func joinErrors(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// node is a generated OpenConfigNode, with a comment describing it.
+type node struct {
+	proto    *pb.OpenConfigNode
+	comment  string
+	children []*node
+}
+
+// Generate returns a Mappings skeleton for the data nodes of the given module entries.
+func Generate(entries []*yang.Entry, options Options) *pb.Mappings {
+	mappings := &pb.Mappings{}
+	for _, n := range generate(entries, options) {
+		mappings.Nodes = append(mappings.Nodes, n.toProto())
+	}
+	return mappings
+}
+
+/*
+Write writes a Mappings skeleton for the given module entries as a text proto, with the YANG type of
+each leaf and the keys of each list as comments.
+*/
+func Write(w io.Writer, entries []*yang.Entry, options Options) error {
+	var b strings.Builder
+	b.WriteString("# proto-file: proto/mappings.proto\n# proto-message: Mappings\n")
+	for _, n := range generate(entries, options) {
+		b.WriteString("\n")
+		n.write(&b, "nodes", "")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func generate(entries []*yang.Entry, options Options) []*node {
+	var nodes []*node
+	for _, entry := range entries {
+		for _, child := range dataChildren(entry) {
+			if n := newNode(child, "/", nil, options); n != nil {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes
+}
+
+/*
+dataChildren returns the data nodes beneath an entry in name order. Choices and cases do not appear in
+data paths, so their children are returned in their place.
+*/
+func dataChildren(entry *yang.Entry) []*yang.Entry {
+	var children []*yang.Entry
+	for _, child := range entry.Dir {
+		switch {
+		case child.IsChoice() || child.IsCase():
+			children = append(children, dataChildren(child)...)
+		case child.Kind == yang.LeafEntry || child.Kind == yang.DirectoryEntry:
+			children = append(children, child)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
+
+/*
+newNode returns the node for an entry, whose subpath is prefixed with the given string (eg: "/" for
+top level nodes). elements holds the names of the entry's ancestors, for naming transformations. It
+returns nil if the entry and its descendants are omitted by the options.
+*/
+func newNode(entry *yang.Entry, prefix string, elements []string, options Options) *node {
+	if options.StateOnly && !entry.ReadOnly() && entry.Kind == yang.LeafEntry {
+		return nil
+	}
+	elements = append(elements[:len(elements):len(elements)], entry.Name)
+	n := &node{proto: &pb.OpenConfigNode{Subpath: &pb.OpenConfigPath{Path: prefix + entry.Name}}}
+	if entry.Kind == yang.LeafEntry {
+		n.proto.Bind = bindName(elements)
+		n.comment = typeName(entry)
+		return n
+	}
+	if entry.IsList() {
+		var keys []string
+		for _, key := range strings.Fields(entry.Key) {
+			n.proto.Subpath.Path += fmt.Sprintf("[%v=%v]", key, keyVariable(key))
+			keys = append(keys, key)
+		}
+		if len(keys) > 0 {
+			n.comment = fmt.Sprintf("list keyed by %v; map each key variable to a NocPath variable", strings.Join(keys, ", "))
+		}
+	}
+	for _, child := range dataChildren(entry) {
+		if c := newNode(child, "", elements, options); c != nil {
+			n.children = append(n.children, c)
+		}
+	}
+	if len(n.children) == 0 {
+		return nil
+	}
+	return n
+}
+
+// bindName suggests a transformation name for a leaf, eg: system_state_boot_time.
+func bindName(elements []string) string {
+	return strings.Replace(strings.Join(elements, "_"), "-", "_", -1)
+}
+
+// keyVariable names the variable bound to a list key, eg: name -> name_value.
+func keyVariable(key string) string {
+	return strings.Replace(key, "-", "_", -1) + "_value"
+}
+
+// typeName describes the YANG type of a leaf, eg: "uint64 (oc-types:timeticks64)".
+func typeName(entry *yang.Entry) string {
+	if entry.Type == nil {
+		return ""
+	}
+	name := entry.Type.Kind.String()
+	if entry.Type.Name != "" && entry.Type.Name != name {
+		name += fmt.Sprintf(" (%v)", entry.Type.Name)
+	}
+	if entry.IsLeafList() {
+		name = "leaf-list of " + name
+	}
+	return "type: " + name
+}
+
+func (n *node) toProto() *pb.OpenConfigNode {
+	for _, child := range n.children {
+		n.proto.Children = append(n.proto.Children, child.toProto())
+	}
+	return n.proto
+}
+
+// write writes the node as a text proto field with the given name, in the style of proto/mappings.pb.
+func (n *node) write(b *strings.Builder, field, indent string) {
+	fmt.Fprintf(b, "%v%v {\n", indent, field)
+	inner := indent + "  "
+	if n.comment != "" {
+		fmt.Fprintf(b, "%v# %v\n", inner, n.comment)
+	}
+	fmt.Fprintf(b, "%vsubpath {path: %q}\n", inner, n.proto.GetSubpath().GetPath())
+	if n.proto.GetBind() != "" {
+		fmt.Fprintf(b, "%vbind: %q\n", inner, n.proto.GetBind())
+	}
+	for _, child := range n.children {
+		b.WriteString("\n")
+		child.write(b, "children", inner)
+	}
+	fmt.Fprintf(b, "%v}\n", indent)
+}
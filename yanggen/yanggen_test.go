@@ -0,0 +1,201 @@
+/*
+Copyright 2019 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yanggen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/orismologer/octree"
+	"github.com/openconfig/goyang/pkg/yang"
+
+	pb "github.com/google/orismologer/proto_out/proto"
+)
+
+// dir returns a directory entry with the given children, setting their parents.
+func dir(name string, config yang.TriState, children ...*yang.Entry) *yang.Entry {
+	e := &yang.Entry{Name: name, Kind: yang.DirectoryEntry, Config: config, Dir: map[string]*yang.Entry{}}
+	for _, child := range children {
+		child.Parent = e
+		e.Dir[child.Name] = child
+	}
+	return e
+}
+
+func leaf(name string, kind yang.TypeKind, typeName string) *yang.Entry {
+	return &yang.Entry{Name: name, Kind: yang.LeafEntry, Type: &yang.YangType{Name: typeName, Kind: kind}}
+}
+
+// testModule is a cut-down openconfig-interfaces and openconfig-system.
+func testModule() *yang.Entry {
+	interfaceList := dir("interface", yang.TSUnset,
+		leaf("name", yang.Yleafref, ""),
+		dir("config", yang.TSTrue, leaf("mtu", yang.Yuint16, "")),
+		dir("state", yang.TSFalse,
+			leaf("mtu", yang.Yuint16, ""),
+			dir("counters", yang.TSUnset, leaf("in-octets", yang.Yuint64, "oc-yang:counter64")),
+		),
+	)
+	interfaceList.Key = "name"
+	interfaceList.ListAttr = &yang.ListAttr{}
+	choice := &yang.Entry{Name: "address-type", Kind: yang.ChoiceEntry, Dir: map[string]*yang.Entry{}}
+	ipv4 := &yang.Entry{Name: "ipv4", Kind: yang.CaseEntry, Dir: map[string]*yang.Entry{}, Parent: choice}
+	choice.Dir["ipv4"] = ipv4
+	address := leaf("address", yang.Ystring, "")
+	address.Parent = ipv4
+	ipv4.Dir["address"] = address
+	servers := leaf("servers", yang.Ystring, "")
+	servers.ListAttr = &yang.ListAttr{}
+	state := dir("state", yang.TSFalse, leaf("boot-time", yang.Yuint64, "oc-types:timeticks64"), servers)
+	choice.Parent = state
+	state.Dir["address-type"] = choice
+	return dir("openconfig-test", yang.TSUnset,
+		dir("interfaces", yang.TSUnset, interfaceList),
+		dir("system", yang.TSUnset, dir("config", yang.TSTrue, leaf("hostname", yang.Ystring, "")), state),
+	)
+}
+
+func TestGenerate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		options  Options
+		expected *pb.Mappings
+	}{
+		{
+			name: "all nodes",
+			expected: &pb.Mappings{Nodes: []*pb.OpenConfigNode{
+				{
+					Subpath: &pb.OpenConfigPath{Path: "/interfaces"},
+					Children: []*pb.OpenConfigNode{
+						{
+							Subpath: &pb.OpenConfigPath{Path: "interface[name=name_value]"},
+							Children: []*pb.OpenConfigNode{
+								{
+									Subpath:  &pb.OpenConfigPath{Path: "config"},
+									Children: []*pb.OpenConfigNode{{Subpath: &pb.OpenConfigPath{Path: "mtu"}, Bind: "interfaces_interface_config_mtu"}},
+								},
+								{Subpath: &pb.OpenConfigPath{Path: "name"}, Bind: "interfaces_interface_name"},
+								{
+									Subpath: &pb.OpenConfigPath{Path: "state"},
+									Children: []*pb.OpenConfigNode{
+										{
+											Subpath:  &pb.OpenConfigPath{Path: "counters"},
+											Children: []*pb.OpenConfigNode{{Subpath: &pb.OpenConfigPath{Path: "in-octets"}, Bind: "interfaces_interface_state_counters_in_octets"}},
+										},
+										{Subpath: &pb.OpenConfigPath{Path: "mtu"}, Bind: "interfaces_interface_state_mtu"},
+									},
+								},
+							},
+						},
+					},
+				},
+				{
+					Subpath: &pb.OpenConfigPath{Path: "/system"},
+					Children: []*pb.OpenConfigNode{
+						{
+							Subpath:  &pb.OpenConfigPath{Path: "config"},
+							Children: []*pb.OpenConfigNode{{Subpath: &pb.OpenConfigPath{Path: "hostname"}, Bind: "system_config_hostname"}},
+						},
+						{
+							Subpath: &pb.OpenConfigPath{Path: "state"},
+							Children: []*pb.OpenConfigNode{
+								{Subpath: &pb.OpenConfigPath{Path: "address"}, Bind: "system_state_address"},
+								{Subpath: &pb.OpenConfigPath{Path: "boot-time"}, Bind: "system_state_boot_time"},
+								{Subpath: &pb.OpenConfigPath{Path: "servers"}, Bind: "system_state_servers"},
+							},
+						},
+					},
+				},
+			}},
+		},
+		{
+			name:    "state only",
+			options: Options{StateOnly: true},
+			expected: &pb.Mappings{Nodes: []*pb.OpenConfigNode{
+				{
+					Subpath: &pb.OpenConfigPath{Path: "/interfaces"},
+					Children: []*pb.OpenConfigNode{
+						{
+							Subpath: &pb.OpenConfigPath{Path: "interface[name=name_value]"},
+							Children: []*pb.OpenConfigNode{
+								{
+									Subpath: &pb.OpenConfigPath{Path: "state"},
+									Children: []*pb.OpenConfigNode{
+										{
+											Subpath:  &pb.OpenConfigPath{Path: "counters"},
+											Children: []*pb.OpenConfigNode{{Subpath: &pb.OpenConfigPath{Path: "in-octets"}, Bind: "interfaces_interface_state_counters_in_octets"}},
+										},
+										{Subpath: &pb.OpenConfigPath{Path: "mtu"}, Bind: "interfaces_interface_state_mtu"},
+									},
+								},
+							},
+						},
+					},
+				},
+				{
+					Subpath: &pb.OpenConfigPath{Path: "/system"},
+					Children: []*pb.OpenConfigNode{
+						{
+							Subpath: &pb.OpenConfigPath{Path: "state"},
+							Children: []*pb.OpenConfigNode{
+								{Subpath: &pb.OpenConfigPath{Path: "address"}, Bind: "system_state_address"},
+								{Subpath: &pb.OpenConfigPath{Path: "boot-time"}, Bind: "system_state_boot_time"},
+								{Subpath: &pb.OpenConfigPath{Path: "servers"}, Bind: "system_state_servers"},
+							},
+						},
+					},
+				},
+			}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := Generate([]*yang.Entry{testModule()}, test.options)
+			if !proto.Equal(got, test.expected) {
+				t.Errorf("Generate() = %v, expected %v", proto.MarshalTextString(got), proto.MarshalTextString(test.expected))
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	entries := []*yang.Entry{testModule()}
+	var b strings.Builder
+	if err := Write(&b, entries, Options{}); err != nil {
+		t.Fatalf("Write() got error: %v", err)
+	}
+	text := b.String()
+	for _, comment := range []string{
+		"# type: uint64 (oc-types:timeticks64)",
+		"# type: leaf-list of string",
+		"# list keyed by name",
+	} {
+		if !strings.Contains(text, comment) {
+			t.Errorf("Write() output does not contain %q:\n%v", comment, text)
+		}
+	}
+	got := &pb.Mappings{}
+	if err := proto.UnmarshalText(text, got); err != nil {
+		t.Fatalf("Write() output is not a valid Mappings text proto: %v\n%v", err, text)
+	}
+	if expected := Generate(entries, Options{}); !proto.Equal(got, expected) {
+		t.Errorf("Write() output = %v, expected %v", got, expected)
+	}
+	if _, err := octree.NewTree(got); err != nil {
+		t.Errorf("Write() output could not be loaded as a tree: %v", err)
+	}
+}